@@ -0,0 +1,128 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package app
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+	"devops/cicd-tools/pkg/util/logger"
+	"devops/cicd-tools/pkg/util/printer"
+)
+
+func newAccountCommand(o *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "account",
+		Short: "启用、停用、解锁用户以及查看登录记录",
+	}
+
+	setDisabled := func(disabled bool, done string) func(cmd *cobra.Command, args []string) error {
+		return func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			u, err := findUser(s, args[0])
+			if err != nil {
+				return err
+			}
+			if err := s.Users().SetDisabled(u.ID, disabled); err != nil {
+				return err
+			}
+			logger.Info(fmt.Sprintf("已%s用户%s", done, u.Name))
+			return nil
+		}
+	}
+	enable := &cobra.Command{
+		Use:   "enable USER",
+		Short: "启用用户",
+		Args:  cobra.ExactArgs(1),
+		RunE:  setDisabled(false, "启用"),
+	}
+	disable := &cobra.Command{
+		Use:   "disable USER",
+		Short: "停用用户, 停用后无法登录, 已签发的令牌与个人访问令牌随即失效",
+		Args:  cobra.ExactArgs(1),
+		RunE:  setDisabled(true, "停用"),
+	}
+
+	unlock := &cobra.Command{
+		Use:   "unlock USER",
+		Short: "解除因连续登录失败导致的锁定并清零失败次数",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			u, err := findUser(s, args[0])
+			if err != nil {
+				return err
+			}
+			if err := s.Users().UpdateLoginState(u.ID, 0, nil); err != nil {
+				return err
+			}
+			logger.Info(fmt.Sprintf("已解锁用户%s", u.Name))
+			return nil
+		},
+	}
+
+	var (
+		user   string
+		failed bool
+		since  time.Duration
+		limit  int
+	)
+	history := &cobra.Command{
+		Use:   "history",
+		Short: "按时间倒序查看登录记录",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			q := model.LoginQuery{Username: user, Failed: failed, Limit: limit}
+			if since > 0 {
+				q.Since = time.Now().Add(-since)
+			}
+			records, err := s.Logins().Find(q)
+			if err != nil {
+				return err
+			}
+			t := printer.NewTable("TIME", "USER", "METHOD", "RESULT", "IP", "USER_AGENT", "REASON")
+			for _, value := range records {
+				result := "success"
+				if !value.Success {
+					result = "failure"
+				}
+				t.AddRow(value.CreatedAt, value.Username, value.Method, result, value.IP, value.UserAgent, value.Reason)
+			}
+			return o.printTable(t)
+		},
+	}
+	history.Flags().StringVar(&user, "user", "", "只显示该用户名的登录记录, 包括不存在的用户名")
+	history.Flags().BoolVar(&failed, "failed", false, "只显示失败的登录")
+	history.Flags().DurationVar(&since, "since", 0, "只显示最近一段时间的记录, 如24h")
+	history.Flags().IntVar(&limit, "limit", 50, "最多显示的条数, 0表示不限制")
+
+	cmd.AddCommand(enable, disable, unlock, history)
+	return cmd
+}
@@ -16,6 +16,126 @@
 
 package app
 
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+
+	"devops/cicd-tools/pkg/cicd-tools/config"
+	"devops/cicd-tools/pkg/cicd-tools/migrate"
+	"devops/cicd-tools/pkg/cicd-tools/model"
+	"devops/cicd-tools/pkg/cicd-tools/store/gormstore"
+	"devops/cicd-tools/pkg/util/logger"
+	"devops/cicd-tools/pkg/util/printer"
+)
+
+type options struct {
+	flags  *config.Flags
+	config *config.Config
+	db     *gorm.DB
+	print  printer.Options
+}
+
 func Run() {
+	if err := NewCommand().Execute(); err != nil {
+		logger.Error(err)
+		os.Exit(1)
+	}
+}
+
+func NewCommand() *cobra.Command {
+	o := new(options)
+	cmd := &cobra.Command{
+		Use:           "cicd-tools",
+		Short:         "CICD 工具",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return o.complete()
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		},
+	}
+	o.flags = config.AddFlags(cmd.PersistentFlags())
+	o.addPrintFlags(cmd.PersistentFlags())
+
+	cmd.AddCommand(
+		newMigrateCommand(o),
+		newSeedCommand(o),
+		newGrantCommand(o),
+		newPasswdCommand(o),
+		newAuthCommand(o),
+		newTokenCommand(o),
+		newServiceAccountCommand(o),
+		newLDAPCommand(o),
+		newMFACommand(o),
+		newAccountCommand(o),
+		newUserCommand(o),
+		newGroupCommand(o),
+		newRoleCommand(o),
+		newPermissionCommand(o),
+		newProjectCommand(o),
+		newEnvCommand(o),
+		newItemCommand(o),
+		newRepoCommand(o),
+		newBuildCommand(o),
+		newArtifactCommand(o),
+		newApplyCommand(o),
+		newDiffCommand(o),
+		newExportCommand(o),
+		newServeCommand(o),
+	)
+	return cmd
+}
+
+func (o *options) complete() error {
+	if _, err := o.print.Parse(); err != nil {
+		return err
+	}
+	c, err := o.flags.Load()
+	if err != nil {
+		return err
+	}
+	o.config = c
+	return nil
+}
+
+// open 按配置建立数据库连接, 不做表结构同步
+func (o *options) open() (*gorm.DB, error) {
+	if o.db != nil {
+		return o.db, nil
+	}
+	d := o.config.Database
+	conn, err := model.Open(d.Driver, d.DataSource(), d.TablePrefix)
+	if err != nil {
+		return nil, err
+	}
+	o.db = conn
+	return conn, nil
+}
+
+// connect 建立数据库连接并注入模型层, 开启 auto_migrate 时先执行全部迁移
+func (o *options) connect() error {
+	conn, err := o.open()
+	if err != nil {
+		return err
+	}
+	if o.config.Database.AutoMigrate {
+		if _, err := migrate.New(conn).Up(0); err != nil {
+			return err
+		}
+	}
+	model.SetStore(gormstore.New(conn))
+	model.SetPasswordPolicy(o.config.Auth.Password, o.config.Auth.Hash)
+	return nil
+}
 
+// store 建立连接并返回默认存储
+func (o *options) store() (model.Store, error) {
+	if err := o.connect(); err != nil {
+		return nil, err
+	}
+	return model.DefaultStore()
 }
@@ -0,0 +1,131 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package app
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"devops/cicd-tools/pkg/cicd-tools/manifest"
+	"devops/cicd-tools/pkg/util/logger"
+	"devops/cicd-tools/pkg/util/printer"
+)
+
+// manifestFlags apply 与 diff 共用的参数
+type manifestFlags struct {
+	file  string
+	prune bool
+}
+
+func (f *manifestFlags) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&f.file, "file", "f", "", "配置文件或目录, 目录下的.yaml与.yml文件会合并")
+	cmd.Flags().BoolVar(&f.prune, "prune", false, "删除配置中不存在的记录与关联关系, 不包括LDAP/OIDC来源的用户与组")
+}
+
+func (f *manifestFlags) load(o *options) (*manifest.Applier, *manifest.Manifest, error) {
+	if f.file == "" {
+		return nil, nil, errors.New("需通过--file指定配置文件或目录")
+	}
+	m, err := manifest.Load(f.file)
+	if err != nil {
+		return nil, nil, err
+	}
+	s, err := o.store()
+	if err != nil {
+		return nil, nil, err
+	}
+	return manifest.NewApplier(s, f.prune), m, nil
+}
+
+func newApplyCommand(o *options) *cobra.Command {
+	var (
+		flags  manifestFlags
+		dryRun bool
+	)
+	cmd := &cobra.Command{
+		Use:   "apply",
+		Short: "按YAML配置同步用户、组、角色、权限、项目、环境与应用, 全部变更在同一事务中执行",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			applier, m, err := flags.load(o)
+			if err != nil {
+				return err
+			}
+			var changes []manifest.Change
+			if dryRun {
+				changes, err = applier.Diff(m)
+			} else {
+				changes, err = applier.Apply(m)
+			}
+			if err != nil {
+				return err
+			}
+			if err := o.printChanges(changes); err != nil {
+				return err
+			}
+			if dryRun {
+				logger.Info(fmt.Sprintf("共%d项变更, 未执行", len(changes)))
+			} else {
+				logger.Info(fmt.Sprintf("配置同步完成, 共%d项变更", len(changes)))
+			}
+			return nil
+		},
+	}
+	flags.addFlags(cmd)
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "只列出需要的变更, 不修改数据库")
+	return cmd
+}
+
+func newDiffCommand(o *options) *cobra.Command {
+	var flags manifestFlags
+	cmd := &cobra.Command{
+		Use:   "diff",
+		Short: "列出按YAML配置同步需要的变更, 不修改数据库",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			applier, m, err := flags.load(o)
+			if err != nil {
+				return err
+			}
+			changes, err := applier.Diff(m)
+			if err != nil {
+				return err
+			}
+			if err := o.printChanges(changes); err != nil {
+				return err
+			}
+			logger.Info(fmt.Sprintf("共%d项变更", len(changes)))
+			return nil
+		},
+	}
+	flags.addFlags(cmd)
+	return cmd
+}
+
+// printChanges 没有变更时不输出
+func (o *options) printChanges(changes []manifest.Change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	t := printer.NewTable("ACTION", "KIND", "NAME", "DETAIL")
+	for _, value := range changes {
+		t.AddRow(value.Action, value.Kind, value.Name, value.Detail)
+	}
+	return o.printTable(t)
+}
@@ -0,0 +1,367 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"devops/cicd-tools/pkg/cicd-tools/auth"
+	"devops/cicd-tools/pkg/cicd-tools/auth/ldap"
+	"devops/cicd-tools/pkg/cicd-tools/auth/oidc"
+	"devops/cicd-tools/pkg/cicd-tools/rbac"
+	"devops/cicd-tools/pkg/util/logger"
+)
+
+// EnvToken 指定访问令牌的环境变量, 优先于凭据文件
+const EnvToken = "CICD_TOKEN"
+
+// cliClient 命令行登录时写入登录记录的来源
+var cliClient = auth.ClientInfo{UserAgent: "cicd-tools/cli"}
+
+func newAuthCommand(o *options) *cobra.Command {
+	var credentials string
+	cmd := &cobra.Command{
+		Use:   "auth",
+		Short: "登录、刷新和吊销访问令牌, 检查用户的权限",
+	}
+	cmd.PersistentFlags().StringVar(&credentials, "credentials", defaultCredentials(), "保存令牌的凭据文件")
+
+	var (
+		useOIDC bool
+		otp     string
+	)
+	login := &cobra.Command{
+		Use:   "login [USER]",
+		Short: "登录并保存令牌, 从标准输入读取密码; 指定--oidc时通过浏览器单点登录",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var (
+				pair *auth.TokenPair
+				err  error
+			)
+			if useOIDC {
+				pair, err = o.oidcLogin(cmd.Context())
+			} else {
+				if len(args) != 1 {
+					return errors.New("未指定用户")
+				}
+				var plain string
+				if plain, err = readSecret("密码"); err != nil {
+					return err
+				}
+				var a *auth.Authenticator
+				if a, err = o.authenticator(); err != nil {
+					return err
+				}
+				pair, err = a.LoginContext(auth.WithClient(cmd.Context(), cliClient), args[0], plain, otp)
+				if errors.Is(err, auth.ErrMFARequired) {
+					return fmt.Errorf("请通过--otp指定验证码或恢复码\n%w", err)
+				}
+			}
+			if err != nil {
+				return err
+			}
+			if err := saveCredentials(credentials, pair); err != nil {
+				return err
+			}
+			logger.Info(fmt.Sprintf("登录成功, 访问令牌有效期至%s", pair.ExpiresAt.Format("2006-01-02 15:04:05")))
+			return nil
+		},
+	}
+	login.Flags().BoolVar(&useOIDC, "oidc", false, "通过auth.oidc配置的认证服务登录")
+	login.Flags().StringVar(&otp, "otp", "", "已启用多因素认证时的TOTP验证码或恢复码")
+
+	var token string
+	whoami := &cobra.Command{
+		Use:   "whoami",
+		Short: "校验访问令牌并显示当前用户",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pair, err := loadCredentials(credentials)
+			if err != nil && token == "" && os.Getenv(EnvToken) == "" {
+				return err
+			}
+			value := accessToken(token, pair)
+			var a *auth.Authenticator
+			if strings.HasPrefix(value, auth.PersonalTokenPrefix) {
+				s, err := o.store()
+				if err != nil {
+					return err
+				}
+				a = auth.NewAuthenticator(s, nil)
+			} else if a, err = o.authenticator(); err != nil {
+				return err
+			}
+			id, err := a.Authenticate(value)
+			if err != nil {
+				return err
+			}
+			expiresAt := "长期有效"
+			if !id.ExpiresAt.IsZero() {
+				expiresAt = id.ExpiresAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("用户: %s\nID: %d\n角色: %s\n有效期至: %s\n",
+				id.Name, id.UserID, strings.Join(id.Roles, ", "), expiresAt)
+			if id.Scopes != nil {
+				fmt.Printf("令牌范围: %s\n", strings.Join(id.Scopes, ", "))
+			}
+			return nil
+		},
+	}
+	whoami.Flags().StringVar(&token, "token", "", "访问令牌, 默认依次读取环境变量"+EnvToken+"和凭据文件")
+
+	refresh := &cobra.Command{
+		Use:   "refresh",
+		Short: "使用刷新令牌换取新的令牌",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pair, err := loadCredentials(credentials)
+			if err != nil {
+				return err
+			}
+			a, err := o.authenticator()
+			if err != nil {
+				return err
+			}
+			pair, err = a.Refresh(pair.RefreshToken)
+			if err != nil {
+				return err
+			}
+			if err := saveCredentials(credentials, pair); err != nil {
+				return err
+			}
+			logger.Info(fmt.Sprintf("令牌已刷新, 有效期至%s", pair.ExpiresAt.Format("2006-01-02 15:04:05")))
+			return nil
+		},
+	}
+
+	logout := &cobra.Command{
+		Use:   "logout",
+		Short: "吊销凭据文件中的令牌并删除凭据文件",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pair, err := loadCredentials(credentials)
+			if err != nil {
+				return err
+			}
+			a, err := o.authenticator()
+			if err != nil {
+				return err
+			}
+			if err := a.Revoke(pair.AccessToken, pair.RefreshToken); err != nil {
+				return err
+			}
+			if err := os.Remove(credentials); err != nil {
+				return fmt.Errorf("删除凭据文件%s失败\n%w", credentials, err)
+			}
+			logger.Info("已退出登录")
+			return nil
+		},
+	}
+
+	var (
+		resourceID   uint
+		project, env string
+	)
+	can := &cobra.Command{
+		Use:   "can USER CATEGORY ACTION",
+		Short: "检查用户能否执行操作并说明决定结果的角色与权限, 拒绝时以非零状态退出",
+		Args:  cobra.ExactArgs(3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			u, err := findUser(s, args[0])
+			if err != nil {
+				return err
+			}
+			scope, err := findScope(s, project, env)
+			if err != nil {
+				return err
+			}
+			d, err := rbac.NewAuthorizer(s).Authorize(rbac.Request{
+				UserID:     u.ID,
+				Category:   args[1],
+				ResourceID: resourceID,
+				Action:     args[2],
+				Scope:      scope,
+			})
+			if err != nil {
+				return err
+			}
+			if !d.Allowed {
+				return errors.New(d.String())
+			}
+			fmt.Println(d.String())
+			return nil
+		},
+	}
+	can.Flags().UintVar(&resourceID, "resource-id", 0, "资源编号, 为0时只匹配未限定资源的权限")
+	can.Flags().StringVar(&project, "project", "", "请求所在的项目, 默认为全局范围")
+	can.Flags().StringVar(&env, "env", "", "请求所在的环境, 需同时指定--project")
+
+	cmd.AddCommand(login, whoami, refresh, logout, can)
+	return cmd
+}
+
+func (o *options) authenticator() (*auth.Authenticator, error) {
+	tokens, err := auth.NewTokens(o.config.Auth.Token)
+	if err != nil {
+		return nil, err
+	}
+	s, err := o.store()
+	if err != nil {
+		return nil, err
+	}
+	a := auth.NewAuthenticator(s, tokens).
+		WithMFA(auth.NewMFA(s, o.config.Auth.MFA)).
+		WithLockout(o.config.Auth.Lockout)
+	if o.config.Auth.LDAP.URL != "" {
+		a.AddProvider(ldap.NewProvider(s, ldap.NewClient(o.config.Auth.LDAP)))
+	}
+	return a, nil
+}
+
+// oidcLogin 在 redirect_url 上临时监听回调, 提示用户在浏览器中打开授权地址, 回调完成后签发令牌
+func (o *options) oidcLogin(ctx context.Context) (*auth.TokenPair, error) {
+	c := o.config.Auth.OIDC
+	if c.Issuer == "" {
+		return nil, errors.New("未配置auth.oidc.issuer")
+	}
+	redirect, err := url.Parse(c.RedirectURL)
+	if err != nil {
+		return nil, fmt.Errorf("auth.oidc.redirect_url无效\n%w", err)
+	}
+	a, err := o.authenticator()
+	if err != nil {
+		return nil, err
+	}
+	s, err := o.store()
+	if err != nil {
+		return nil, err
+	}
+	flow := oidc.NewFlow(a, oidc.NewClient(c), oidc.NewProvisioner(s, c))
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+	authURL, st, err := flow.Start(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", redirect.Host)
+	if err != nil {
+		return nil, fmt.Errorf("监听回调地址%s失败\n%w", redirect.Host, err)
+	}
+	type result struct {
+		pair *auth.TokenPair
+		err  error
+	}
+	done := make(chan result, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc(redirect.Path, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		var res result
+		if e := query.Get("error"); e != "" {
+			res.err = fmt.Errorf("OIDC认证失败: %s %s", e, query.Get("error_description"))
+		} else {
+			res.pair, res.err = flow.Finish(auth.WithClient(r.Context(), cliClient), st, query.Get("state"), query.Get("code"))
+		}
+		if res.err != nil {
+			http.Error(w, "登录失败, 请返回命令行查看原因", http.StatusUnauthorized)
+		} else {
+			fmt.Fprintln(w, "登录成功, 可以关闭此页面")
+		}
+		select {
+		case done <- res:
+		default:
+		}
+	})
+	server := &http.Server{Handler: mux}
+	go func() { _ = server.Serve(listener) }()
+	defer server.Close()
+
+	fmt.Fprintf(os.Stderr, "请在浏览器中打开以下地址完成登录:\n%s\n", authURL)
+	select {
+	case res := <-done:
+		return res.pair, res.err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("等待OIDC登录回调超时\n%w", ctx.Err())
+	}
+}
+
+// accessToken 按 --token, 环境变量, 凭据文件的顺序取访问令牌
+func accessToken(flag string, pair *auth.TokenPair) string {
+	if flag != "" {
+		return flag
+	}
+	if v := os.Getenv(EnvToken); v != "" {
+		return v
+	}
+	if pair != nil {
+		return pair.AccessToken
+	}
+	return ""
+}
+
+func defaultCredentials() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".cicd-tools-credentials.yaml"
+	}
+	return filepath.Join(home, ".cicd-tools", "credentials.yaml")
+}
+
+func loadCredentials(path string) (*auth.TokenPair, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取凭据文件%s失败, 请先登录\n%w", path, err)
+	}
+	pair := new(auth.TokenPair)
+	if err := yaml.Unmarshal(data, pair); err != nil {
+		return nil, fmt.Errorf("解析凭据文件%s失败\n%w", path, err)
+	}
+	return pair, nil
+}
+
+// saveCredentials 凭据文件只允许当前用户读写
+func saveCredentials(path string, pair *auth.TokenPair) error {
+	data, err := yaml.Marshal(pair)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("创建凭据目录失败\n%w", err)
+	}
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("保存凭据文件%s失败\n%w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,635 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package app
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+	"devops/cicd-tools/pkg/cicd-tools/rbac"
+	"devops/cicd-tools/pkg/util/logger"
+	"devops/cicd-tools/pkg/util/printer"
+)
+
+// repoFlags 创建与更新代码仓库共用的参数, 更新时只修改显式指定的字段
+type repoFlags struct {
+	url, sshURL, intro string
+}
+
+func (f *repoFlags) addFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&f.url, "url", "", "HTTP(S)地址")
+	fs.StringVar(&f.sshURL, "ssh-url", "", "SSH地址")
+	fs.StringVar(&f.intro, "intro", "", "描述")
+}
+
+func (f *repoFlags) apply(fs *pflag.FlagSet, r *model.GitRepo) bool {
+	values := map[string]func(){
+		"url":     func() { r.RepoURL = f.url },
+		"ssh-url": func() { r.RepoSSHURL = f.sshURL },
+		"intro":   func() { r.Intro = f.intro },
+	}
+	changed := false
+	for name, apply := range values {
+		if fs.Changed(name) {
+			apply()
+			changed = true
+		}
+	}
+	return changed
+}
+
+func newRepoCommand(o *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "repo",
+		Short: "管理代码仓库",
+	}
+
+	var createFlags repoFlags
+	create := &cobra.Command{
+		Use:   "create NAME",
+		Short: "创建代码仓库",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if createFlags.url == "" && createFlags.sshURL == "" {
+				return errors.New("需通过--url或--ssh-url指定仓库地址")
+			}
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			if _, err := s.Builds().FirstRepo(&model.GitRepo{Name: args[0]}); err == nil {
+				return fmt.Errorf("代码仓库%s已存在", args[0])
+			}
+			r := &model.GitRepo{Name: args[0]}
+			createFlags.apply(cmd.Flags(), r)
+			if err := s.Builds().FirstOrCreateRepo(r); err != nil {
+				return fmt.Errorf("创建代码仓库%s失败\n%w", r.Name, err)
+			}
+			logger.Info(fmt.Sprintf("已创建代码仓库%s", r.Name))
+			return nil
+		},
+	}
+	createFlags.addFlags(create.Flags())
+
+	var listQuery listFlags
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "查看代码仓库",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			var repos []model.GitRepo
+			if err := listQuery.list(s, &model.GitRepo{}, &repos); err != nil {
+				return err
+			}
+			t := printer.NewTable("ID", "NAME", "URL", "SSH_URL", "INTRO")
+			for _, value := range repos {
+				t.AddRow(value.ID, value.Name, value.RepoURL, value.RepoSSHURL, value.Intro)
+			}
+			return o.printTable(t)
+		},
+	}
+	listQuery.addFlags(list.Flags())
+
+	var updateFlags repoFlags
+	update := &cobra.Command{
+		Use:   "update NAME",
+		Short: "更新代码仓库信息, 只修改指定的字段",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			r, err := findRepo(s, args[0])
+			if err != nil {
+				return err
+			}
+			if !updateFlags.apply(cmd.Flags(), r) {
+				return errors.New("未指定需要更新的字段")
+			}
+			if err := s.Builds().SaveRepo(r); err != nil {
+				return fmt.Errorf("代码仓库%s数据更新失败\n%w", r.Name, err)
+			}
+			logger.Info(fmt.Sprintf("已更新代码仓库%s", r.Name))
+			return nil
+		},
+	}
+	updateFlags.addFlags(update.Flags())
+
+	remove := &cobra.Command{
+		Use:   "delete NAME",
+		Short: "删除代码仓库",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			r, err := findRepo(s, args[0])
+			if err != nil {
+				return err
+			}
+			if err := s.Builds().DeleteRepo(r.ID); err != nil {
+				return fmt.Errorf("删除代码仓库%s失败\n%w", r.Name, err)
+			}
+			if err := o.mirror(s).Remove(r.ID); err != nil {
+				logger.Warn(err.Error())
+			}
+			logger.Info(fmt.Sprintf("已删除代码仓库%s", r.Name))
+			return nil
+		},
+	}
+
+	cmd.AddCommand(create, list, update, remove)
+	cmd.AddCommand(repoMirrorCommands(o)...)
+	return cmd
+}
+
+func findRepo(s model.Store, name string) (*model.GitRepo, error) {
+	r, err := s.Builds().FirstRepo(&model.GitRepo{Name: name})
+	if err != nil {
+		return nil, fmt.Errorf("代码仓库%s不存在\n%w", name, err)
+	}
+	return r, nil
+}
+
+// envItemFlags 以项目、环境与应用名称定位 ProjectEnvItem
+type envItemFlags struct {
+	project, env, item string
+}
+
+func (f *envItemFlags) addFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&f.project, "project", "", "项目")
+	fs.StringVar(&f.env, "env", "", "环境")
+	fs.StringVar(&f.item, "item", "", "应用")
+}
+
+// find 三者都未指定时返回 nil
+func (f *envItemFlags) find(s model.Store) (*model.ProjectEnvItem, error) {
+	if f.project == "" && f.env == "" && f.item == "" {
+		return nil, nil
+	}
+	if f.project == "" || f.env == "" || f.item == "" {
+		return nil, errors.New("--project、--env与--item需同时指定")
+	}
+	p, err := findProject(s, f.project)
+	if err != nil {
+		return nil, err
+	}
+	e, err := findEnv(s, f.env)
+	if err != nil {
+		return nil, err
+	}
+	i, err := findItem(s, f.item)
+	if err != nil {
+		return nil, err
+	}
+	pei, err := s.Projects().FirstEnvItem(&model.ProjectEnvItem{ProjectID: p.ID, EnvID: e.ID, ItemID: i.ID})
+	if err != nil {
+		return nil, fmt.Errorf("项目%s的环境%s中没有应用%s\n%w", p.Name, e.Name, i.Name, err)
+	}
+	return pei, nil
+}
+
+func newBuildCommand(o *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "build",
+		Short: "管理构建记录",
+	}
+
+	var (
+		target                envItemFlags
+		name, branch, user    string
+		state, buildEnv, repo string
+	)
+	create := &cobra.Command{
+		Use:   "create",
+		Short: "登记一次构建, 构建编号在同一项目环境应用内递增",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			pei, err := target.find(s)
+			if err != nil {
+				return err
+			}
+			if pei == nil {
+				return errors.New("需通过--project、--env与--item指定构建的应用")
+			}
+			b := &model.BuildInfo{
+				BuildName:        name,
+				BuildDate:        time.Now(),
+				BuildEnv:         buildEnv,
+				ProjectEnvItemID: pei.ID,
+				GitRepoID:        pei.GitRepoID,
+				GitBranch:        branch,
+				BuildState:       state,
+			}
+			if c, err := model.EnvItemConfig(s, pei); err == nil {
+				b.BuildConfigID = c.ID
+			} else if !errors.Is(err, model.ErrNotFound) {
+				return err
+			}
+			if user != "" {
+				u, err := findUser(s, user)
+				if err != nil {
+					return err
+				}
+				d, err := rbac.NewAuthorizer(s).Authorize(rbac.Deploy(u.ID, pei.ProjectID, pei.EnvID))
+				if err != nil {
+					return err
+				}
+				if !d.Allowed {
+					return errors.New(d.String())
+				}
+				b.BuildUserID, b.BuildUserName = u.ID, u.Name
+			}
+			if repo != "" {
+				r, err := findRepo(s, repo)
+				if err != nil {
+					return err
+				}
+				b.GitRepoID = r.ID
+			}
+			if err := model.CreateBuild(s, b); err != nil {
+				return fmt.Errorf("登记构建失败\n%w", err)
+			}
+			logger.Info(fmt.Sprintf("已登记构建%d, 构建编号%d", b.ID, b.BuildID))
+			return nil
+		},
+	}
+	target.addFlags(create.Flags())
+	create.Flags().StringVar(&name, "name", "", "构建名称")
+	create.Flags().StringVar(&branch, "branch", "", "构建的分支")
+	create.Flags().StringVar(&repo, "repo", "", "代码仓库, 默认使用应用关联的仓库")
+	create.Flags().StringVar(&user, "user", "", "触发构建的用户, 需要该环境的env:deploy权限")
+	create.Flags().StringVar(&buildEnv, "build-env", "", "构建环境")
+	create.Flags().StringVar(&state, "state", "pending", "构建状态")
+
+	var listTarget envItemFlags
+	var listState string
+	var listQuery listFlags
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "查看构建记录",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			cond := &model.BuildInfo{BuildState: listState}
+			pei, err := listTarget.find(s)
+			if err != nil {
+				return err
+			}
+			if pei != nil {
+				cond.ProjectEnvItemID = pei.ID
+			}
+			var builds []model.BuildInfo
+			if err := listQuery.list(s, cond, &builds); err != nil {
+				return err
+			}
+			t := printer.NewTable(buildHeader...)
+			for i := range builds {
+				t.AddRow(buildRow(&builds[i])...)
+			}
+			return o.printTable(t)
+		},
+	}
+	listQuery.addFlags(list.Flags())
+	listTarget.addFlags(list.Flags())
+	list.Flags().StringVar(&listState, "state", "", "只显示该状态的构建")
+
+	get := &cobra.Command{
+		Use:   "get ID",
+		Short: "查看构建记录",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			b, err := getBuild(s, args[0])
+			if err != nil {
+				return err
+			}
+			t := printer.NewTable(buildHeader...)
+			t.AddRow(buildRow(b)...)
+			return o.printTable(t)
+		},
+	}
+
+	setState := &cobra.Command{
+		Use:   "set-state ID STATE",
+		Short: "更新构建状态",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			b, err := getBuild(s, args[0])
+			if err != nil {
+				return err
+			}
+			b.BuildState = args[1]
+			if err := s.Builds().Save(b); err != nil {
+				return fmt.Errorf("构建%d数据更新失败\n%w", b.ID, err)
+			}
+			logger.Info(fmt.Sprintf("构建%d的状态已更新为%s", b.ID, b.BuildState))
+			return nil
+		},
+	}
+
+	remove := &cobra.Command{
+		Use:   "delete ID",
+		Short: "删除构建记录",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			b, err := getBuild(s, args[0])
+			if err != nil {
+				return err
+			}
+			if err := s.Builds().Delete(b.ID); err != nil {
+				return fmt.Errorf("删除构建%d失败\n%w", b.ID, err)
+			}
+			logger.Info(fmt.Sprintf("已删除构建%d", b.ID))
+			return nil
+		},
+	}
+
+	var appendLog bool
+	log := &cobra.Command{
+		Use:   "log ID",
+		Short: "查看构建日志, 指定--append时从标准输入逐行追加日志并原样输出",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			b, err := getBuild(s, args[0])
+			if err != nil {
+				return err
+			}
+			if appendLog {
+				return appendBuildLog(s, b, os.Stdin)
+			}
+			logs, err := s.Builds().Logs(b.ID, 0)
+			if err != nil {
+				return fmt.Errorf("查询构建%d的日志失败\n%w", b.ID, err)
+			}
+			for _, value := range logs {
+				fmt.Println(value.Line)
+			}
+			return nil
+		},
+	}
+	log.Flags().BoolVar(&appendLog, "append", false, "从标准输入追加日志, 如 make 2>&1 | cicd-tools build log 1 --append")
+
+	cmd.AddCommand(create, list, get, setState, log, remove)
+	return cmd
+}
+
+// appendBuildLog 每读取一行即写入, 订阅该构建的 gRPC 客户端可以实时收到
+func appendBuildLog(s model.Store, b *model.BuildInfo, r io.Reader) error {
+	if b.Finished() {
+		return fmt.Errorf("构建%d已结束, 不能追加日志", b.ID)
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		fmt.Println(line)
+		if err := s.Builds().AddLogs([]model.BuildLog{{BuildInfoID: b.ID, Line: line}}); err != nil {
+			return fmt.Errorf("追加构建%d的日志失败\n%w", b.ID, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("读取构建%d的日志失败\n%w", b.ID, err)
+	}
+	return nil
+}
+
+var buildHeader = []string{"ID", "NUMBER", "NAME", "PROJECT_ENV_ITEM", "BRANCH", "USER", "STATE", "BUILD_DATE"}
+
+func buildRow(b *model.BuildInfo) []interface{} {
+	return []interface{}{b.ID, b.BuildID, b.BuildName, b.ProjectEnvItemID, b.GitBranch, b.BuildUserName, b.BuildState,
+		b.BuildDate}
+}
+
+func getBuild(s model.Store, value string) (*model.BuildInfo, error) {
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("构建编号%s无效\n%w", value, err)
+	}
+	b, err := s.Builds().Get(uint(id))
+	if err != nil {
+		return nil, fmt.Errorf("构建%d不存在\n%w", id, err)
+	}
+	return b, nil
+}
+
+func newArtifactCommand(o *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "artifact",
+		Short: "管理制品",
+	}
+
+	var (
+		name, release, version, file string
+		build                        uint
+	)
+	create := &cobra.Command{
+		Use:   "create",
+		Short: "登记制品, 指定--file时计算文件的校验和",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if name == "" && file == "" {
+				return errors.New("需通过--name或--file指定制品名称")
+			}
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			a := &model.Artifact{Name: name, Release: release, Version: version}
+			if build != 0 {
+				b, err := s.Builds().Get(build)
+				if err != nil {
+					return fmt.Errorf("构建%d不存在\n%w", build, err)
+				}
+				a.BuildInfoID, a.ProjectEnvItemID = b.ID, b.ProjectEnvItemID
+			}
+			if file != "" {
+				if err := checksum(file, a); err != nil {
+					return err
+				}
+				if a.Name == "" {
+					a.Name = filepath.Base(file)
+				}
+			}
+			if err := s.Artifacts().Create(a); err != nil {
+				return fmt.Errorf("登记制品%s失败\n%w", a.Name, err)
+			}
+			logger.Info(fmt.Sprintf("已登记制品%d", a.ID))
+			return nil
+		},
+	}
+	create.Flags().StringVar(&name, "name", "", "制品名称, 默认为文件名")
+	create.Flags().StringVar(&release, "release", "", "发布版本")
+	create.Flags().StringVar(&version, "version", "", "版本号")
+	create.Flags().StringVar(&file, "file", "", "制品文件, 用于计算校验和")
+	create.Flags().UintVar(&build, "build", 0, "产出制品的构建ID")
+
+	var listName string
+	var listBuild uint
+	var listQuery listFlags
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "查看制品",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			var artifacts []model.Artifact
+			if err := listQuery.list(s, &model.Artifact{Name: listName, BuildInfoID: listBuild}, &artifacts); err != nil {
+				return err
+			}
+			t := printer.NewTable(artifactHeader...)
+			for i := range artifacts {
+				t.AddRow(artifactRow(&artifacts[i])...)
+			}
+			return o.printTable(t)
+		},
+	}
+	listQuery.addFlags(list.Flags())
+	list.Flags().StringVar(&listName, "name", "", "只显示该名称的制品")
+	list.Flags().UintVar(&listBuild, "build", 0, "只显示该构建产出的制品")
+
+	get := &cobra.Command{
+		Use:   "get ID",
+		Short: "查看制品",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			a, err := getArtifact(s, args[0])
+			if err != nil {
+				return err
+			}
+			t := printer.NewTable(append(append([]string{}, artifactHeader...), "MD5", "SHA1", "SHA512")...)
+			t.AddRow(append(artifactRow(a), a.Md5, a.SHA1, a.SHA512)...)
+			return o.printTable(t)
+		},
+	}
+
+	remove := &cobra.Command{
+		Use:   "delete ID",
+		Short: "删除制品记录",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			a, err := getArtifact(s, args[0])
+			if err != nil {
+				return err
+			}
+			if err := s.Artifacts().Delete(a.ID); err != nil {
+				return fmt.Errorf("删除制品%d失败\n%w", a.ID, err)
+			}
+			logger.Info(fmt.Sprintf("已删除制品%d", a.ID))
+			return nil
+		},
+	}
+
+	cmd.AddCommand(create, list, get, remove)
+	return cmd
+}
+
+var artifactHeader = []string{"ID", "NAME", "RELEASE", "VERSION", "BUILD", "SHA256"}
+
+func artifactRow(a *model.Artifact) []interface{} {
+	return []interface{}{a.ID, a.Name, a.Release, a.Version, a.BuildInfoID, a.SHA256}
+}
+
+func getArtifact(s model.Store, value string) (*model.Artifact, error) {
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("制品编号%s无效\n%w", value, err)
+	}
+	a, err := s.Artifacts().Get(uint(id))
+	if err != nil {
+		return nil, fmt.Errorf("制品%d不存在\n%w", id, err)
+	}
+	return a, nil
+}
+
+// checksum 一次读取文件同时计算各校验和
+func checksum(path string, a *model.Artifact) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("打开制品文件%s失败\n%w", path, err)
+	}
+	defer f.Close()
+	hashes := []hash.Hash{md5.New(), sha1.New(), sha256.New(), sha512.New()}
+	writers := make([]io.Writer, 0, len(hashes))
+	for _, value := range hashes {
+		writers = append(writers, value)
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), f); err != nil {
+		return fmt.Errorf("读取制品文件%s失败\n%w", path, err)
+	}
+	a.Md5 = hex.EncodeToString(hashes[0].Sum(nil))
+	a.SHA1 = hex.EncodeToString(hashes[1].Sum(nil))
+	a.SHA256 = hex.EncodeToString(hashes[2].Sum(nil))
+	a.SHA512 = hex.EncodeToString(hashes[3].Sum(nil))
+	return nil
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"devops/cicd-tools/pkg/cicd-tools/manifest"
+	"devops/cicd-tools/pkg/util/logger"
+)
+
+func newExportCommand(o *options) *cobra.Command {
+	var dir string
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "将用户、组、角色、项目、仓库与构建配置导出为YAML, 可以通过apply还原, 不包含密码与凭据",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			m, err := manifest.Export(s)
+			if err != nil {
+				return err
+			}
+			if dir == "-" {
+				content, err := m.Marshal()
+				if err != nil {
+					return err
+				}
+				_, err = os.Stdout.Write(content)
+				return err
+			}
+			if dir == "" {
+				return errors.New("需通过--dir指定导出目录, 使用-时输出到标准输出")
+			}
+			files, err := m.WriteDir(dir)
+			if err != nil {
+				return err
+			}
+			for _, value := range files {
+				fmt.Println(value)
+			}
+			logger.Info(fmt.Sprintf("已导出%d个用户、%d个组、%d个角色、%d个项目", len(m.Users), len(m.Groups), len(m.Roles), len(m.Projects)))
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&dir, "dir", "d", "", "导出目录, 按类别写入多个文件并覆盖同名文件, 为-时输出到标准输出")
+	return cmd
+}
@@ -0,0 +1,227 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+	"devops/cicd-tools/pkg/cicd-tools/rbac"
+	"devops/cicd-tools/pkg/util/logger"
+	"devops/cicd-tools/pkg/util/printer"
+)
+
+func newGrantCommand(o *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "grant",
+		Short: "申请、审批临时角色并清理过期的角色绑定",
+	}
+
+	var (
+		user, role, project, env, reason string
+		duration                         time.Duration
+	)
+	request := &cobra.Command{
+		Use:   "request",
+		Short: "申请角色",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			u, err := findUser(s, user)
+			if err != nil {
+				return err
+			}
+			r, err := findRole(s, role)
+			if err != nil {
+				return err
+			}
+			scope, err := findScope(s, project, env)
+			if err != nil {
+				return err
+			}
+			req, err := rbac.NewWorkflow(s).Request(u.ID, r.ID, scope, duration, reason)
+			if err != nil {
+				return err
+			}
+			logger.Info(fmt.Sprintf("已提交角色申请%d", req.ID))
+			return nil
+		},
+	}
+	request.Flags().StringVar(&user, "user", "", "申请人用户名")
+	request.Flags().StringVar(&role, "role", "", "申请的角色")
+	request.Flags().StringVar(&project, "project", "", "限定生效的项目")
+	request.Flags().StringVar(&env, "env", "", "限定生效的环境, 需同时指定--project")
+	request.Flags().DurationVar(&duration, "duration", 0, "批准后的有效时长, 如8h, 默认长期有效")
+	request.Flags().StringVar(&reason, "reason", "", "申请理由")
+
+	var approver, comment string
+	decide := func(use string, short string, approve bool) *cobra.Command {
+		c := &cobra.Command{
+			Use:   use + " ID",
+			Short: short,
+			Args:  cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				id, err := strconv.ParseUint(args[0], 10, 64)
+				if err != nil {
+					return fmt.Errorf("申请编号%s无效\n%w", args[0], err)
+				}
+				s, err := o.store()
+				if err != nil {
+					return err
+				}
+				u, err := findUser(s, approver)
+				if err != nil {
+					return err
+				}
+				w := rbac.NewWorkflow(s)
+				if approve {
+					_, err = w.Approve(uint(id), u.ID, comment)
+				} else {
+					_, err = w.Reject(uint(id), u.ID, comment)
+				}
+				if err != nil {
+					return err
+				}
+				logger.Info(fmt.Sprintf("已%s角色申请%d", short, id))
+				return nil
+			},
+		}
+		c.Flags().StringVar(&approver, "approver", "", "审批人用户名")
+		c.Flags().StringVar(&comment, "comment", "", "审批意见")
+		return c
+	}
+
+	var status string
+	var listQuery listFlags
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "查看角色申请",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			var requests []model.RoleRequest
+			if err := listQuery.list(s, &model.RoleRequest{Status: status}, &requests); err != nil {
+				return err
+			}
+			t := printer.NewTable("ID", "USER", "ROLE", "SCOPE", "DURATION", "STATUS", "REASON")
+			for _, value := range requests {
+				scope, err := model.BindingScope(s, value.ProjectID, value.ProjectEnvID)
+				if err != nil {
+					return err
+				}
+				d := "-"
+				if value.Duration > 0 {
+					d = (time.Duration(value.Duration) * time.Second).String()
+				}
+				t.AddRow(value.ID, value.UserID, value.RoleID, scope.String(), d, value.Status, value.Reason)
+			}
+			return o.printTable(t)
+		},
+	}
+	listQuery.addFlags(list.Flags())
+	list.Flags().StringVar(&status, "status", "", "按状态筛选: pending, approved, rejected")
+
+	var interval time.Duration
+	sweep := &cobra.Command{
+		Use:   "sweep",
+		Short: "清理过期的角色绑定, 指定--interval时持续运行",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			w := rbac.NewWorkflow(s)
+			if interval > 0 {
+				ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+				defer stop()
+				w.Run(ctx, interval)
+				return nil
+			}
+			count, err := w.Sweep()
+			if err != nil {
+				return err
+			}
+			logger.Info(fmt.Sprintf("已清理%d个过期的角色绑定", count))
+			return nil
+		},
+	}
+	sweep.Flags().DurationVar(&interval, "interval", 0, "清理间隔, 如1m")
+
+	cmd.AddCommand(request, decide("approve", "批准", true), decide("reject", "拒绝", false), list, sweep)
+	return cmd
+}
+
+func findUser(s model.Store, name string) (*model.User, error) {
+	if name == "" {
+		return nil, errors.New("未指定用户")
+	}
+	u, err := s.Users().First(&model.User{Name: name})
+	if err != nil {
+		return nil, fmt.Errorf("用户%s不存在\n%w", name, err)
+	}
+	return u, nil
+}
+
+func findRole(s model.Store, name string) (*model.Role, error) {
+	if name == "" {
+		return nil, errors.New("未指定角色")
+	}
+	r, err := s.Roles().First(&model.Role{Name: name})
+	if err != nil {
+		return nil, fmt.Errorf("角色%s不存在\n%w", name, err)
+	}
+	return r, nil
+}
+
+// findScope 按项目和环境名称查找范围, 都为空时为全局范围
+func findScope(s model.Store, project string, env string) (model.Scope, error) {
+	var scope model.Scope
+	if project == "" {
+		if env != "" {
+			return scope, errors.New("指定--env时必须同时指定--project")
+		}
+		return scope, nil
+	}
+	p, err := s.Projects().First(&model.Project{Name: project})
+	if err != nil {
+		return scope, fmt.Errorf("项目%s不存在\n%w", project, err)
+	}
+	scope.ProjectID = p.ID
+	if env != "" {
+		e, err := s.Projects().FirstEnv(&model.Env{Name: env})
+		if err != nil {
+			return scope, fmt.Errorf("环境%s不存在\n%w", env, err)
+		}
+		scope.EnvID = e.ID
+	}
+	return scope, nil
+}
@@ -0,0 +1,264 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package app
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+	"devops/cicd-tools/pkg/util/logger"
+	"devops/cicd-tools/pkg/util/printer"
+)
+
+func newGroupCommand(o *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "group",
+		Short: "管理组及其成员和角色",
+	}
+
+	var intro string
+	create := &cobra.Command{
+		Use:   "create NAME",
+		Short: "创建组",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			if _, err := s.Groups().First(&model.Group{Name: args[0]}); err == nil {
+				return fmt.Errorf("组%s已存在", args[0])
+			}
+			g := &model.Group{Name: args[0], Intro: intro}
+			if g.Create(); g.Error != nil {
+				return g.Error
+			}
+			logger.Info(fmt.Sprintf("已创建组%s", g.Name))
+			return nil
+		},
+	}
+	create.Flags().StringVar(&intro, "intro", "", "描述")
+
+	var listQuery listFlags
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "查看组",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			var groups []model.Group
+			if err := listQuery.list(s, &model.Group{}, &groups); err != nil {
+				return err
+			}
+			t := printer.NewTable(groupHeader...)
+			for i := range groups {
+				t.AddRow(groupRow(&groups[i])...)
+			}
+			return o.printTable(t)
+		},
+	}
+	listQuery.addFlags(list.Flags())
+
+	get := &cobra.Command{
+		Use:   "get NAME",
+		Short: "查看组详情, 包括成员和绑定的角色",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			g, err := findGroup(s, args[0])
+			if err != nil {
+				return err
+			}
+			if g.GetUsers().GetRoles(); g.Error != nil {
+				return g.Error
+			}
+			users := make([]string, 0, len(*g.Users))
+			for _, value := range *g.Users {
+				users = append(users, value.Name)
+			}
+			t := printer.NewTable(append(append([]string{}, groupHeader...), "USERS", "ROLES")...)
+			t.AddRow(append(groupRow(g), users, roleNames(*g.Roles))...)
+			return o.printTable(t)
+		},
+	}
+
+	update := &cobra.Command{
+		Use:   "update NAME",
+		Short: "更新组的描述",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !cmd.Flags().Changed("intro") {
+				return errors.New("未指定需要更新的字段")
+			}
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			g, err := findGroup(s, args[0])
+			if err != nil {
+				return err
+			}
+			g.Intro = intro
+			if g.Update(); g.Error != nil {
+				return g.Error
+			}
+			logger.Info(fmt.Sprintf("已更新组%s", g.Name))
+			return nil
+		},
+	}
+	update.Flags().StringVar(&intro, "intro", "", "描述")
+
+	remove := &cobra.Command{
+		Use:   "delete NAME",
+		Short: "删除组",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			g, err := findGroup(s, args[0])
+			if err != nil {
+				return err
+			}
+			if err := s.Groups().Delete(g.ID); err != nil {
+				return fmt.Errorf("删除组%s失败\n%w", g.Name, err)
+			}
+			logger.Info(fmt.Sprintf("已删除组%s", g.Name))
+			return nil
+		},
+	}
+
+	addUsers := &cobra.Command{
+		Use:   "add-users NAME USER...",
+		Short: "向组中添加用户",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			g, err := findGroup(s, args[0])
+			if err != nil {
+				return err
+			}
+			for _, value := range args[1:] {
+				if _, err := findUser(s, value); err != nil {
+					return err
+				}
+			}
+			if g.AddUsers(args[1:]...); g.Error != nil {
+				return g.Error
+			}
+			logger.Info(fmt.Sprintf("已向组%s添加用户%s", g.Name, strings.Join(args[1:], ",")))
+			return nil
+		},
+	}
+
+	var bind roleBindingFlags
+	addRoles := &cobra.Command{
+		Use:   "add-roles NAME ROLE...",
+		Short: "为组绑定角色, 可限定项目、环境与有效时长",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			g, err := findGroup(s, args[0])
+			if err != nil {
+				return err
+			}
+			scope, err := findScope(s, bind.project, bind.env)
+			if err != nil {
+				return err
+			}
+			if bind.expiresIn > 0 {
+				g.AddTemporaryRoles(scope, time.Now().Add(bind.expiresIn), args[1:]...)
+			} else {
+				g.AddScopedRoles(scope, args[1:]...)
+			}
+			if g.Error != nil {
+				return g.Error
+			}
+			logger.Info(fmt.Sprintf("已为组%s绑定角色%s", g.Name, strings.Join(args[1:], ",")))
+			return nil
+		},
+	}
+	bind.addFlags(addRoles.Flags())
+
+	roles := &cobra.Command{
+		Use:   "roles NAME",
+		Short: "查看组绑定的角色及其范围",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			g, err := findGroup(s, args[0])
+			if err != nil {
+				return err
+			}
+			bindings, err := s.Groups().RoleBindings(g.ID)
+			if err != nil {
+				return err
+			}
+			t := printer.NewTable(bindingHeader...)
+			for _, gr := range bindings {
+				row, err := bindingRow(s, gr.ID, gr.RoleID, gr.ProjectID, gr.ProjectEnvID, gr.ExpiresAt)
+				if err != nil {
+					return err
+				}
+				t.AddRow(row...)
+			}
+			return o.printTable(t)
+		},
+	}
+
+	cmd.AddCommand(create, list, get, update, remove, addUsers, addRoles, roles)
+	return cmd
+}
+
+var groupHeader = []string{"ID", "NAME", "INTRO", "SOURCE"}
+
+func groupRow(g *model.Group) []interface{} {
+	source := g.Source
+	if source == model.SourceLocal {
+		source = "local"
+	}
+	return []interface{}{g.ID, g.Name, g.Intro, source}
+}
+
+func findGroup(s model.Store, name string) (*model.Group, error) {
+	g, err := s.Groups().First(&model.Group{Name: name})
+	if err != nil {
+		return nil, fmt.Errorf("组%s不存在\n%w", name, err)
+	}
+	return g, nil
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"devops/cicd-tools/pkg/cicd-tools/auth/ldap"
+	"devops/cicd-tools/pkg/util/logger"
+)
+
+func newLDAPCommand(o *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ldap",
+		Short: "从LDAP同步用户与组",
+	}
+
+	var (
+		dryRun, watch bool
+		interval      time.Duration
+	)
+	sync := &cobra.Command{
+		Use:   "sync",
+		Short: "同步LDAP中的用户与组, 指定--watch时持续运行",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir, err := o.directory()
+			if err != nil {
+				return err
+			}
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			syncer := ldap.NewSyncer(s, dir)
+			if watch {
+				if interval <= 0 {
+					interval = o.config.Auth.LDAP.SyncInterval
+				}
+				ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+				defer stop()
+				syncer.Run(ctx, interval)
+				return nil
+			}
+			var changes []ldap.Change
+			if dryRun {
+				changes, err = syncer.Diff()
+			} else {
+				changes, err = syncer.Sync()
+			}
+			if err != nil {
+				return err
+			}
+			for _, value := range changes {
+				fmt.Println(value.String())
+			}
+			if dryRun {
+				logger.Info(fmt.Sprintf("共%d项变更, 未执行", len(changes)))
+			} else {
+				logger.Info(fmt.Sprintf("LDAP同步完成, 共%d项变更", len(changes)))
+			}
+			return nil
+		},
+	}
+	sync.Flags().BoolVar(&dryRun, "dry-run", false, "只列出需要的变更, 不修改数据库")
+	sync.Flags().BoolVar(&watch, "watch", false, "按同步间隔持续运行")
+	sync.Flags().DurationVar(&interval, "interval", 0, "同步间隔, 默认使用auth.ldap.sync_interval")
+
+	test := &cobra.Command{
+		Use:   "test USER",
+		Short: "使用LDAP校验用户密码, 密码从标准输入读取",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir, err := o.directory()
+			if err != nil {
+				return err
+			}
+			password, err := readSecret("密码")
+			if err != nil {
+				return err
+			}
+			entry, err := dir.Authenticate(args[0], password)
+			if err != nil {
+				return err
+			}
+			logger.Info(fmt.Sprintf("LDAP用户%s校验通过, dn=%s, email=%s", entry.Username, entry.DN, entry.Email))
+			return nil
+		},
+	}
+
+	cmd.AddCommand(sync, test)
+	return cmd
+}
+
+// directory 按配置创建LDAP客户端
+func (o *options) directory() (*ldap.Client, error) {
+	if o.config.Auth.LDAP.URL == "" {
+		return nil, errors.New("未配置auth.ldap.url")
+	}
+	return ldap.NewClient(o.config.Auth.LDAP), nil
+}
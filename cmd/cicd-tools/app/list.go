@@ -0,0 +1,72 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package app
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/pflag"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+// listFlags 列表命令的筛选、排序与分页参数, 字段为数据表的列名, 与 --sort-by 不同, 在查询时生效
+type listFlags struct {
+	filters []string
+	orderBy string
+	limit   int
+	offset  int
+	cursor  string
+}
+
+func (f *listFlags) addFlags(fs *pflag.FlagSet) {
+	fs.StringArrayVar(&f.filters, "filter", nil,
+		"按字段筛选, 可重复指定, 比较方式为= != > >= < <= 和~(包含, 不区分大小写), 如name~web、created_at>=2024-01-01")
+	fs.StringVar(&f.orderBy, "order-by", "", "查询时按字段排序, 以逗号分隔, 以-开头时倒序, 如-created_at,id")
+	fs.IntVar(&f.limit, "limit", 0, "最多显示的记录数, 0为不限制")
+	fs.IntVar(&f.offset, "offset", 0, "跳过的记录数")
+	fs.StringVar(&f.cursor, "cursor", "", "上一页输出的游标, 从该处继续显示")
+}
+
+func (f *listFlags) query() (*model.Query, error) {
+	q := &model.Query{Sort: model.ParseSort(f.orderBy), Limit: f.limit, Offset: f.offset, Cursor: f.cursor}
+	for _, value := range f.filters {
+		filter, err := model.ParseFilter(value)
+		if err != nil {
+			return nil, err
+		}
+		q.Filters = append(q.Filters, filter)
+	}
+	return q, nil
+}
+
+// list 按参数查询与 cond 同一模型的记录, 还有下一页时在标准错误输出总数与游标, 不影响列表的输出格式
+func (f *listFlags) list(s model.Store, cond interface{}, out interface{}) error {
+	q, err := f.query()
+	if err != nil {
+		return err
+	}
+	page, err := s.List(cond, q, out)
+	if err != nil {
+		return err
+	}
+	if page.Next != "" {
+		fmt.Fprintf(os.Stderr, "共%d条记录, 查看下一页: --cursor %s\n", page.Total, page.Next)
+	}
+	return nil
+}
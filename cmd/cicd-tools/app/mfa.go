@@ -0,0 +1,186 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package app
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"devops/cicd-tools/pkg/cicd-tools/auth"
+	"devops/cicd-tools/pkg/cicd-tools/auth/totp"
+	"devops/cicd-tools/pkg/cicd-tools/model"
+	"devops/cicd-tools/pkg/util/logger"
+)
+
+func newMFACommand(o *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "mfa",
+		Short: "管理用户的TOTP多因素认证",
+	}
+
+	var qrFile string
+	enroll := &cobra.Command{
+		Use:   "enroll USER",
+		Short: "生成TOTP密钥并显示二维码, 需再执行mfa confirm确认",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			m, s, err := o.mfa()
+			if err != nil {
+				return err
+			}
+			u, err := findUser(s, args[0])
+			if err != nil {
+				return err
+			}
+			secret, uri, err := m.Enroll(u)
+			if err != nil {
+				return err
+			}
+			text, err := totp.QRText(uri)
+			if err != nil {
+				return err
+			}
+			fmt.Print(text)
+			fmt.Printf("密钥: %s\n地址: %s\n", secret, uri)
+			if qrFile != "" {
+				if err := totp.WriteQRPNG(qrFile, uri); err != nil {
+					return err
+				}
+			}
+			logger.Info(fmt.Sprintf("请使用验证器应用扫描二维码, 然后执行 mfa confirm %s 输入验证码", u.Name))
+			return nil
+		},
+	}
+	enroll.Flags().StringVar(&qrFile, "qr-png", "", "同时将二维码保存为PNG文件")
+
+	confirm := &cobra.Command{
+		Use:   "confirm USER",
+		Short: "输入验证码确认绑定并生成恢复码, 验证码从标准输入读取",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			m, s, err := o.mfa()
+			if err != nil {
+				return err
+			}
+			u, err := findUser(s, args[0])
+			if err != nil {
+				return err
+			}
+			code, err := readSecret("验证码")
+			if err != nil {
+				return err
+			}
+			codes, err := m.Confirm(u.ID, code)
+			if err != nil {
+				return err
+			}
+			printRecoveryCodes(codes)
+			logger.Info(fmt.Sprintf("用户%s已启用多因素认证, 请妥善保存恢复码, 每个恢复码只能使用一次", u.Name))
+			return nil
+		},
+	}
+
+	recovery := &cobra.Command{
+		Use:   "recovery-codes USER",
+		Short: "重新生成恢复码, 原有的恢复码作废",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			m, s, err := o.mfa()
+			if err != nil {
+				return err
+			}
+			u, err := findUser(s, args[0])
+			if err != nil {
+				return err
+			}
+			codes, err := m.RegenerateRecoveryCodes(u.ID)
+			if err != nil {
+				return err
+			}
+			printRecoveryCodes(codes)
+			return nil
+		},
+	}
+
+	disable := &cobra.Command{
+		Use:   "disable USER",
+		Short: "停用多因素认证, 删除密钥与恢复码",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			m, s, err := o.mfa()
+			if err != nil {
+				return err
+			}
+			u, err := findUser(s, args[0])
+			if err != nil {
+				return err
+			}
+			if err := m.Disable(u.ID); err != nil {
+				return err
+			}
+			logger.Info(fmt.Sprintf("已停用用户%s的多因素认证", u.Name))
+			return nil
+		},
+	}
+
+	status := &cobra.Command{
+		Use:   "status USER",
+		Short: "查看多因素认证状态",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			m, s, err := o.mfa()
+			if err != nil {
+				return err
+			}
+			u, err := findUser(s, args[0])
+			if err != nil {
+				return err
+			}
+			st, err := m.Status(u.ID)
+			if err != nil {
+				return err
+			}
+			state := "未启用"
+			switch {
+			case st.Confirmed:
+				state = "已启用"
+			case st.Enrolled:
+				state = "待确认"
+			}
+			fmt.Printf("用户: %s\n状态: %s\n策略要求: %t\n剩余恢复码: %d\n", u.Name, state, st.Required, st.RecoveryCodes)
+			return nil
+		},
+	}
+
+	cmd.AddCommand(enroll, confirm, recovery, disable, status)
+	return cmd
+}
+
+func (o *options) mfa() (*auth.MFA, model.Store, error) {
+	s, err := o.store()
+	if err != nil {
+		return nil, nil, err
+	}
+	return auth.NewMFA(s, o.config.Auth.MFA), s, nil
+}
+
+func printRecoveryCodes(codes []string) {
+	for _, value := range codes {
+		fmt.Println(value)
+	}
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package app
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"devops/cicd-tools/pkg/cicd-tools/migrate"
+	"devops/cicd-tools/pkg/util/logger"
+	"devops/cicd-tools/pkg/util/printer"
+)
+
+func newMigrateCommand(o *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "管理数据表结构迁移",
+	}
+
+	var target uint
+	up := &cobra.Command{
+		Use:   "up",
+		Short: "执行未执行的迁移",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			conn, err := o.open()
+			if err != nil {
+				return err
+			}
+			done, err := migrate.New(conn).Up(target)
+			for _, value := range done {
+				logger.Info(fmt.Sprintf("已执行迁移%d_%s", value.Version, value.Name))
+			}
+			if err == nil && len(done) == 0 {
+				logger.Info("没有需要执行的迁移")
+			}
+			return err
+		},
+	}
+	up.Flags().UintVar(&target, "to", 0, "迁移到指定版本, 默认迁移到最新版本")
+
+	var steps int
+	down := &cobra.Command{
+		Use:   "down",
+		Short: "回滚最近执行的迁移",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			conn, err := o.open()
+			if err != nil {
+				return err
+			}
+			done, err := migrate.New(conn).Down(steps)
+			for _, value := range done {
+				logger.Info(fmt.Sprintf("已回滚迁移%d_%s", value.Version, value.Name))
+			}
+			return err
+		},
+	}
+	down.Flags().IntVar(&steps, "steps", 1, "回滚的迁移数量")
+
+	status := &cobra.Command{
+		Use:   "status",
+		Short: "查看迁移执行状态",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			conn, err := o.open()
+			if err != nil {
+				return err
+			}
+			list, err := migrate.New(conn).Status()
+			if err != nil {
+				return err
+			}
+			t := printer.NewTable("VERSION", "NAME", "STATUS", "APPLIED_AT")
+			for _, value := range list {
+				state := "pending"
+				if value.Applied {
+					state = "applied"
+				}
+				t.AddRow(value.Version, value.Name, state, value.AppliedAt)
+			}
+			return o.printTable(t)
+		},
+	}
+
+	cmd.AddCommand(up, down, status)
+	return cmd
+}
@@ -0,0 +1,219 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"devops/cicd-tools/pkg/cicd-tools/mirror"
+	"devops/cicd-tools/pkg/cicd-tools/model"
+	"devops/cicd-tools/pkg/util/logger"
+	"devops/cicd-tools/pkg/util/printer"
+)
+
+// mirror 按配置创建代码仓库镜像
+func (o *options) mirror(s model.Store) *mirror.Mirror {
+	c := o.config.Mirror
+	return mirror.New(s, c.Dir).WithGit(c.Git).WithTimeout(c.Timeout).WithKeyDir(c.KeyDir).WithFileProtocol(c.AllowFile)
+}
+
+// repoMirrorCommands 代码仓库镜像相关的子命令
+func repoMirrorCommands(o *options) []*cobra.Command {
+	var (
+		watch    bool
+		interval time.Duration
+	)
+	fetch := &cobra.Command{
+		Use:   "fetch [NAME...]",
+		Short: "获取代码仓库的更新到本地镜像, 未指定仓库时获取全部仓库, 指定--watch时持续运行",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			m := o.mirror(s)
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+			if watch {
+				if len(args) > 0 {
+					return errors.New("--watch时获取全部代码仓库, 不能指定仓库")
+				}
+				if interval <= 0 {
+					interval = o.config.Mirror.FetchInterval
+				}
+				if interval <= 0 {
+					return errors.New("未指定获取间隔, 需设置--interval或mirror.fetch_interval")
+				}
+				m.Run(ctx, interval)
+				return nil
+			}
+			if len(args) == 0 {
+				failed, err := m.FetchAll(ctx)
+				if err != nil {
+					return fmt.Errorf("%d个代码仓库获取失败\n%w", failed, err)
+				}
+				logger.Info("已获取全部代码仓库的更新")
+				return nil
+			}
+			for _, name := range args {
+				r, err := findRepo(s, name)
+				if err != nil {
+					return err
+				}
+				if err := m.Fetch(ctx, r); err != nil {
+					return err
+				}
+				logger.Info(fmt.Sprintf("已获取代码仓库%s的更新", r.Name))
+			}
+			return nil
+		},
+	}
+	fetch.Flags().BoolVar(&watch, "watch", false, "按获取间隔持续运行")
+	fetch.Flags().DurationVar(&interval, "interval", 0, "获取间隔, 默认使用mirror.fetch_interval")
+
+	var refsFetch bool
+	refs := &cobra.Command{
+		Use:   "refs NAME",
+		Short: "查看代码仓库镜像中的分支与标签",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			r, err := findRepo(s, args[0])
+			if err != nil {
+				return err
+			}
+			m := o.mirror(s)
+			if refsFetch || !m.Exists(r.ID) {
+				if err := m.Fetch(context.Background(), r); err != nil {
+					return err
+				}
+			}
+			values, err := m.Refs(context.Background(), r)
+			if err != nil {
+				return err
+			}
+			t := printer.NewTable("NAME", "TYPE", "COMMIT")
+			for _, value := range values {
+				if value.Branch() != "" {
+					t.AddRow(value.Branch(), "branch", value.Hash)
+				} else {
+					t.AddRow(value.Tag(), "tag", value.Hash)
+				}
+			}
+			return o.printTable(t)
+		},
+	}
+	refs.Flags().BoolVar(&refsFetch, "fetch", false, "先获取更新, 镜像不存在时总是获取")
+
+	var resolveFetch bool
+	resolve := &cobra.Command{
+		Use:   "resolve NAME REF",
+		Short: "将分支、标签或提交散列解析为提交",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			r, err := findRepo(s, args[0])
+			if err != nil {
+				return err
+			}
+			m := o.mirror(s)
+			if resolveFetch || !m.Exists(r.ID) {
+				if err := m.Fetch(context.Background(), r); err != nil {
+					return err
+				}
+			}
+			c, err := m.Resolve(context.Background(), r, args[1])
+			if err != nil {
+				return err
+			}
+			t := printer.NewTable("COMMIT", "BRANCH", "TAG", "DATE", "AUTHOR", "EMAIL", "MESSAGE")
+			t.AddRow(c.CommitHash, c.GitBranch, c.GitTag, c.CommitDate.Format("2006-01-02 15:04:05"), c.CommitUser, c.CommitUserEmail,
+				strings.SplitN(c.CommitMessage, "\n", 2)[0])
+			return o.printTable(t)
+		},
+	}
+	resolve.Flags().BoolVar(&resolveFetch, "fetch", false, "先获取更新, 镜像不存在时总是获取")
+
+	var (
+		username, sshKey string
+		passwordStdin    bool
+	)
+	credential := &cobra.Command{
+		Use:   "credential NAME",
+		Short: "设置获取代码仓库时使用的认证信息, 只修改指定的字段",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			fs := cmd.Flags()
+			if !fs.Changed("username") && !fs.Changed("ssh-key") && !passwordStdin {
+				return errors.New("未指定需要设置的认证信息")
+			}
+			var password string
+			if passwordStdin {
+				value, err := readSecret("密码")
+				if err != nil {
+					return err
+				}
+				password = value
+			}
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			r, err := findRepo(s, args[0])
+			if err != nil {
+				return err
+			}
+			c := &model.GitConfig{GitRepoID: r.ID}
+			if err := s.Builds().FirstOrCreateGitConfig(c); err != nil {
+				return fmt.Errorf("读取代码仓库%s的认证信息失败\n%w", r.Name, err)
+			}
+			if fs.Changed("username") {
+				c.UserName = username
+			}
+			if fs.Changed("ssh-key") {
+				c.Credential = sshKey
+			}
+			if passwordStdin {
+				c.Password = password
+			}
+			if err := s.Builds().SaveGitConfig(c); err != nil {
+				return fmt.Errorf("保存代码仓库%s的认证信息失败\n%w", r.Name, err)
+			}
+			logger.Info(fmt.Sprintf("已更新代码仓库%s的认证信息", r.Name))
+			return nil
+		},
+	}
+	credential.Flags().StringVar(&username, "username", "", "HTTP(S)地址使用的用户名")
+	credential.Flags().BoolVar(&passwordStdin, "password-stdin", false, "从标准输入读取HTTP(S)地址使用的密码或访问令牌")
+	credential.Flags().StringVar(&sshKey, "ssh-key", "", "mirror.key_dir下SSH私钥的文件名, 设置后优先使用SSH地址, 为空时取消")
+
+	return []*cobra.Command{fetch, refs, resolve, credential}
+}
@@ -0,0 +1,42 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package app
+
+import (
+	"os"
+
+	"github.com/spf13/pflag"
+
+	"devops/cicd-tools/pkg/util/printer"
+)
+
+func (o *options) addPrintFlags(fs *pflag.FlagSet) {
+	fs.StringVarP(&o.print.Format, "output", "o", printer.FormatTable,
+		"列表的输出格式, 支持table、json、yaml、csv、go-template=<模板>和go-template-file=<文件>")
+	fs.StringSliceVar(&o.print.Columns, "columns", nil, "只输出指定的列, 按指定的顺序, 如id,name")
+	fs.StringVar(&o.print.SortBy, "sort-by", "", "按指定列排序, 以-开头时倒序, 如-id")
+	fs.BoolVar(&o.print.NoHeaders, "no-headers", false, "table与csv格式不输出表头")
+}
+
+// printTable 按全局输出参数输出列表
+func (o *options) printTable(t *printer.Table) error {
+	p, err := o.print.Parse()
+	if err != nil {
+		return err
+	}
+	return p.Print(os.Stdout, t)
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"devops/cicd-tools/pkg/util/logger"
+)
+
+func newPasswdCommand(o *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "passwd USER",
+		Short: "设置用户密码, 从标准输入读取新密码",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			plain, err := readSecret("新密码")
+			if err != nil {
+				return err
+			}
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			u, err := findUser(s, args[0])
+			if err != nil {
+				return err
+			}
+			if u.SetPassword(plain); u.Error != nil {
+				return u.Error
+			}
+			logger.Info(fmt.Sprintf("已更新用户%s的密码", u.Name))
+			return nil
+		},
+	}
+}
+
+// readSecret 从标准输入读取一行, 用于密码等不宜出现在命令行参数中的内容
+func readSecret(name string) (string, error) {
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("读取%s失败\n%w", name, err)
+	}
+	value := strings.TrimRight(line, "\r\n")
+	if value == "" {
+		return "", fmt.Errorf("%s不能为空", name)
+	}
+	return value, nil
+}
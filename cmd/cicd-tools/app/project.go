@@ -0,0 +1,601 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package app
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+	"devops/cicd-tools/pkg/util/logger"
+	"devops/cicd-tools/pkg/util/printer"
+)
+
+func newProjectCommand(o *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "project",
+		Short: "管理项目及其关联的环境和应用",
+	}
+
+	var (
+		intro       string
+		envs, items []string
+	)
+	create := &cobra.Command{
+		Use:   "create NAME",
+		Short: "创建项目, 可同时关联环境和应用",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			if _, err := s.Projects().First(&model.Project{Name: args[0]}); err == nil {
+				return fmt.Errorf("项目%s已存在", args[0])
+			}
+			return s.Transaction(func(tx model.Store) error {
+				p := &model.Project{Name: args[0], Intro: intro}
+				if err := tx.Projects().Create(p); err != nil {
+					return fmt.Errorf("创建项目%s失败\n%w", p.Name, err)
+				}
+				if err := addProjectEnvs(tx, p, envs); err != nil {
+					return err
+				}
+				if err := addProjectItems(tx, p, items); err != nil {
+					return err
+				}
+				logger.Info(fmt.Sprintf("已创建项目%s", p.Name))
+				return nil
+			})
+		},
+	}
+	create.Flags().StringVar(&intro, "intro", "", "描述")
+	create.Flags().StringSliceVar(&envs, "env", nil, "关联的环境, 可指定多次")
+	create.Flags().StringSliceVar(&items, "item", nil, "关联的应用, 可指定多次")
+
+	var listQuery listFlags
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "查看项目",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			var projects []model.Project
+			if err := listQuery.list(s, &model.Project{}, &projects); err != nil {
+				return err
+			}
+			t := printer.NewTable(projectHeader...)
+			for i := range projects {
+				row, err := projectRow(s, &projects[i])
+				if err != nil {
+					return err
+				}
+				t.AddRow(row...)
+			}
+			return o.printTable(t)
+		},
+	}
+	listQuery.addFlags(list.Flags())
+
+	get := &cobra.Command{
+		Use:   "get NAME",
+		Short: "查看项目详情",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			p, err := findProject(s, args[0])
+			if err != nil {
+				return err
+			}
+			row, err := projectRow(s, p)
+			if err != nil {
+				return err
+			}
+			t := printer.NewTable(projectHeader...)
+			t.AddRow(row...)
+			return o.printTable(t)
+		},
+	}
+
+	update := &cobra.Command{
+		Use:   "update NAME",
+		Short: "更新项目描述",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !cmd.Flags().Changed("intro") {
+				return errors.New("未指定需要更新的字段")
+			}
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			p, err := findProject(s, args[0])
+			if err != nil {
+				return err
+			}
+			p.Intro = intro
+			if err := s.Projects().Save(p); err != nil {
+				return fmt.Errorf("项目%s数据更新失败\n%w", p.Name, err)
+			}
+			logger.Info(fmt.Sprintf("已更新项目%s", p.Name))
+			return nil
+		},
+	}
+	update.Flags().StringVar(&intro, "intro", "", "描述")
+
+	remove := &cobra.Command{
+		Use:   "delete NAME",
+		Short: "删除项目",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			p, err := findProject(s, args[0])
+			if err != nil {
+				return err
+			}
+			if err := s.Projects().Delete(p.ID); err != nil {
+				return fmt.Errorf("删除项目%s失败\n%w", p.Name, err)
+			}
+			logger.Info(fmt.Sprintf("已删除项目%s", p.Name))
+			return nil
+		},
+	}
+
+	link := func(use string, short string, fn func(s model.Store, p *model.Project, names []string) error) *cobra.Command {
+		return &cobra.Command{
+			Use:   use,
+			Short: short,
+			Args:  cobra.MinimumNArgs(2),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				s, err := o.store()
+				if err != nil {
+					return err
+				}
+				p, err := findProject(s, args[0])
+				if err != nil {
+					return err
+				}
+				if err := s.Transaction(func(tx model.Store) error { return fn(tx, p, args[1:]) }); err != nil {
+					return err
+				}
+				logger.Info(fmt.Sprintf("项目%s已%s%s", p.Name, short, strings.Join(args[1:], ",")))
+				return nil
+			},
+		}
+	}
+	addEnvs := link("add-envs NAME ENV...", "关联环境", addProjectEnvs)
+	removeEnvs := link("remove-envs NAME ENV...", "取消关联环境", func(s model.Store, p *model.Project, names []string) error {
+		for _, value := range names {
+			e, err := findEnv(s, value)
+			if err != nil {
+				return err
+			}
+			if err := s.Projects().RemoveEnv(p.ID, e.ID); err != nil {
+				return fmt.Errorf("项目%s取消关联环境%s失败\n%w", p.Name, e.Name, err)
+			}
+		}
+		return nil
+	})
+	addItems := link("add-items NAME ITEM...", "关联应用", addProjectItems)
+	removeItems := link("remove-items NAME ITEM...", "取消关联应用", func(s model.Store, p *model.Project, names []string) error {
+		for _, value := range names {
+			i, err := findItem(s, value)
+			if err != nil {
+				return err
+			}
+			if err := s.Projects().RemoveItem(p.ID, i.ID); err != nil {
+				return fmt.Errorf("项目%s取消关联应用%s失败\n%w", p.Name, i.Name, err)
+			}
+		}
+		return nil
+	})
+
+	var env, item, repo string
+	addEnvItem := &cobra.Command{
+		Use:   "add-env-item NAME",
+		Short: "在项目的环境中部署应用, 环境与应用需已关联到项目, 构建记录按此关联登记",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if env == "" || item == "" {
+				return errors.New("需通过--env与--item指定环境和应用")
+			}
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			p, err := findProject(s, args[0])
+			if err != nil {
+				return err
+			}
+			e, err := findEnv(s, env)
+			if err != nil {
+				return err
+			}
+			i, err := findItem(s, item)
+			if err != nil {
+				return err
+			}
+			if _, err := s.Projects().ProjectEnv(p.ID, e.ID); err != nil {
+				return fmt.Errorf("环境%s未关联到项目%s\n%w", e.Name, p.Name, err)
+			}
+			linked, err := s.Projects().Items(p.ID)
+			if err != nil {
+				return err
+			}
+			found := false
+			for _, value := range linked {
+				found = found || value.ID == i.ID
+			}
+			if !found {
+				return fmt.Errorf("应用%s未关联到项目%s", i.Name, p.Name)
+			}
+			pei := &model.ProjectEnvItem{
+				Project:      p.Name,
+				ProjectID:    p.ID,
+				ProjectIntro: p.Intro,
+				Env:          e.Name,
+				EnvID:        e.ID,
+				EnvItro:      e.Intro,
+				Item:         i.Name,
+				ItemID:       i.ID,
+				ItemIntro:    i.Intro,
+			}
+			if repo != "" {
+				r, err := findRepo(s, repo)
+				if err != nil {
+					return err
+				}
+				pei.GitRepoID = r.ID
+			}
+			if _, err := s.Projects().FirstEnvItem(&model.ProjectEnvItem{ProjectID: p.ID, EnvID: e.ID, ItemID: i.ID}); err == nil {
+				return fmt.Errorf("项目%s的环境%s中已有应用%s", p.Name, e.Name, i.Name)
+			}
+			if err := s.Projects().FirstOrCreateEnvItem(pei); err != nil {
+				return fmt.Errorf("项目%s的环境%s部署应用%s失败\n%w", p.Name, e.Name, i.Name, err)
+			}
+			logger.Info(fmt.Sprintf("已在项目%s的环境%s中部署应用%s", p.Name, e.Name, i.Name))
+			return nil
+		},
+	}
+	addEnvItem.Flags().StringVar(&env, "env", "", "环境")
+	addEnvItem.Flags().StringVar(&item, "item", "", "应用")
+	addEnvItem.Flags().StringVar(&repo, "repo", "", "应用的代码仓库")
+
+	cmd.AddCommand(create, list, get, update, remove, addEnvs, removeEnvs, addItems, removeItems, addEnvItem)
+	return cmd
+}
+
+var projectHeader = []string{"ID", "NAME", "INTRO", "ENVS", "ITEMS"}
+
+func projectRow(s model.Store, p *model.Project) ([]interface{}, error) {
+	envs, err := s.Projects().Envs(p.ID)
+	if err != nil {
+		return nil, fmt.Errorf("项目%s查询环境时发生错误\n%w", p.Name, err)
+	}
+	items, err := s.Projects().Items(p.ID)
+	if err != nil {
+		return nil, fmt.Errorf("项目%s查询应用时发生错误\n%w", p.Name, err)
+	}
+	envNames := make([]string, 0, len(envs))
+	for _, value := range envs {
+		envNames = append(envNames, value.Name)
+	}
+	itemNames := make([]string, 0, len(items))
+	for _, value := range items {
+		itemNames = append(itemNames, value.Name)
+	}
+	return []interface{}{p.ID, p.Name, p.Intro, envNames, itemNames}, nil
+}
+
+func addProjectEnvs(s model.Store, p *model.Project, names []string) error {
+	for _, value := range names {
+		e, err := findEnv(s, value)
+		if err != nil {
+			return err
+		}
+		if _, err := s.Projects().AddEnv(p.ID, e.ID); err != nil {
+			return fmt.Errorf("项目%s关联环境%s失败\n%w", p.Name, e.Name, err)
+		}
+	}
+	return nil
+}
+
+func addProjectItems(s model.Store, p *model.Project, names []string) error {
+	for _, value := range names {
+		i, err := findItem(s, value)
+		if err != nil {
+			return err
+		}
+		if _, err := s.Projects().AddItem(p.ID, i.ID); err != nil {
+			return fmt.Errorf("项目%s关联应用%s失败\n%w", p.Name, i.Name, err)
+		}
+	}
+	return nil
+}
+
+func findProject(s model.Store, name string) (*model.Project, error) {
+	p, err := s.Projects().First(&model.Project{Name: name})
+	if err != nil {
+		return nil, fmt.Errorf("项目%s不存在\n%w", name, err)
+	}
+	return p, nil
+}
+
+func findEnv(s model.Store, name string) (*model.Env, error) {
+	e, err := s.Projects().FirstEnv(&model.Env{Name: name})
+	if err != nil {
+		return nil, fmt.Errorf("环境%s不存在\n%w", name, err)
+	}
+	return e, nil
+}
+
+func findItem(s model.Store, name string) (*model.Item, error) {
+	i, err := s.Projects().FirstItem(&model.Item{Name: name})
+	if err != nil {
+		return nil, fmt.Errorf("应用%s不存在\n%w", name, err)
+	}
+	return i, nil
+}
+
+func newEnvCommand(o *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "env",
+		Short: "管理环境",
+	}
+
+	var intro string
+	create := &cobra.Command{
+		Use:   "create NAME",
+		Short: "创建环境",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			if _, err := s.Projects().FirstEnv(&model.Env{Name: args[0]}); err == nil {
+				return fmt.Errorf("环境%s已存在", args[0])
+			}
+			e := &model.Env{Name: args[0], Intro: intro}
+			if err := s.Projects().FirstOrCreateEnv(e); err != nil {
+				return fmt.Errorf("创建环境%s失败\n%w", e.Name, err)
+			}
+			logger.Info(fmt.Sprintf("已创建环境%s", e.Name))
+			return nil
+		},
+	}
+	create.Flags().StringVar(&intro, "intro", "", "描述")
+
+	var listQuery listFlags
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "查看环境",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			var envs []model.Env
+			if err := listQuery.list(s, &model.Env{}, &envs); err != nil {
+				return err
+			}
+			t := printer.NewTable("ID", "NAME", "INTRO")
+			for _, value := range envs {
+				t.AddRow(value.ID, value.Name, value.Intro)
+			}
+			return o.printTable(t)
+		},
+	}
+	listQuery.addFlags(list.Flags())
+
+	update := &cobra.Command{
+		Use:   "update NAME",
+		Short: "更新环境描述",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !cmd.Flags().Changed("intro") {
+				return errors.New("未指定需要更新的字段")
+			}
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			e, err := findEnv(s, args[0])
+			if err != nil {
+				return err
+			}
+			e.Intro = intro
+			if err := s.Projects().SaveEnv(e); err != nil {
+				return fmt.Errorf("环境%s数据更新失败\n%w", e.Name, err)
+			}
+			logger.Info(fmt.Sprintf("已更新环境%s", e.Name))
+			return nil
+		},
+	}
+	update.Flags().StringVar(&intro, "intro", "", "描述")
+
+	remove := &cobra.Command{
+		Use:   "delete NAME",
+		Short: "删除环境",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			e, err := findEnv(s, args[0])
+			if err != nil {
+				return err
+			}
+			if err := s.Projects().DeleteEnv(e.ID); err != nil {
+				return fmt.Errorf("删除环境%s失败\n%w", e.Name, err)
+			}
+			logger.Info(fmt.Sprintf("已删除环境%s", e.Name))
+			return nil
+		},
+	}
+
+	cmd.AddCommand(create, list, update, remove)
+	return cmd
+}
+
+// itemFlags 创建与更新应用共用的参数, 更新时只修改显式指定的字段
+type itemFlags struct {
+	category, language, tier, intro string
+}
+
+func (f *itemFlags) addFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&f.category, "category", "", "类别")
+	fs.StringVar(&f.language, "language", "", "开发语言")
+	fs.StringVar(&f.tier, "tier", "", "层级")
+	fs.StringVar(&f.intro, "intro", "", "描述")
+}
+
+func (f *itemFlags) apply(fs *pflag.FlagSet, i *model.Item) bool {
+	values := map[string]func(){
+		"category": func() { i.Category = f.category },
+		"language": func() { i.Language = f.language },
+		"tier":     func() { i.Tier = f.tier },
+		"intro":    func() { i.Intro = f.intro },
+	}
+	changed := false
+	for name, apply := range values {
+		if fs.Changed(name) {
+			apply()
+			changed = true
+		}
+	}
+	return changed
+}
+
+func newItemCommand(o *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "item",
+		Short: "管理应用",
+	}
+
+	var createFlags itemFlags
+	create := &cobra.Command{
+		Use:   "create NAME",
+		Short: "创建应用",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			if _, err := s.Projects().FirstItem(&model.Item{Name: args[0]}); err == nil {
+				return fmt.Errorf("应用%s已存在", args[0])
+			}
+			i := &model.Item{Name: args[0]}
+			createFlags.apply(cmd.Flags(), i)
+			if err := s.Projects().FirstOrCreateItem(i); err != nil {
+				return fmt.Errorf("创建应用%s失败\n%w", i.Name, err)
+			}
+			logger.Info(fmt.Sprintf("已创建应用%s", i.Name))
+			return nil
+		},
+	}
+	createFlags.addFlags(create.Flags())
+
+	var listQuery listFlags
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "查看应用",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			var items []model.Item
+			if err := listQuery.list(s, &model.Item{}, &items); err != nil {
+				return err
+			}
+			t := printer.NewTable("ID", "NAME", "CATEGORY", "LANGUAGE", "TIER", "INTRO")
+			for _, value := range items {
+				t.AddRow(value.ID, value.Name, value.Category, value.Language, value.Tier, value.Intro)
+			}
+			return o.printTable(t)
+		},
+	}
+	listQuery.addFlags(list.Flags())
+
+	var updateFlags itemFlags
+	update := &cobra.Command{
+		Use:   "update NAME",
+		Short: "更新应用信息, 只修改指定的字段",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			i, err := findItem(s, args[0])
+			if err != nil {
+				return err
+			}
+			if !updateFlags.apply(cmd.Flags(), i) {
+				return errors.New("未指定需要更新的字段")
+			}
+			if err := s.Projects().SaveItem(i); err != nil {
+				return fmt.Errorf("应用%s数据更新失败\n%w", i.Name, err)
+			}
+			logger.Info(fmt.Sprintf("已更新应用%s", i.Name))
+			return nil
+		},
+	}
+	updateFlags.addFlags(update.Flags())
+
+	remove := &cobra.Command{
+		Use:   "delete NAME",
+		Short: "删除应用",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			i, err := findItem(s, args[0])
+			if err != nil {
+				return err
+			}
+			if err := s.Projects().DeleteItem(i.ID); err != nil {
+				return fmt.Errorf("删除应用%s失败\n%w", i.Name, err)
+			}
+			logger.Info(fmt.Sprintf("已删除应用%s", i.Name))
+			return nil
+		},
+	}
+
+	cmd.AddCommand(create, list, update, remove)
+	return cmd
+}
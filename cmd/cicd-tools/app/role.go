@@ -0,0 +1,315 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package app
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+	"devops/cicd-tools/pkg/util/logger"
+	"devops/cicd-tools/pkg/util/printer"
+)
+
+func newRoleCommand(o *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "role",
+		Short: "管理角色及其继承关系",
+	}
+
+	var (
+		intro   string
+		parents []string
+	)
+	create := &cobra.Command{
+		Use:   "create NAME",
+		Short: "创建角色, 可同时指定继承的角色",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			if _, err := s.Roles().First(&model.Role{Name: args[0]}); err == nil {
+				return fmt.Errorf("角色%s已存在", args[0])
+			}
+			r := &model.Role{Name: args[0], Intro: intro}
+			if r.Create(); r.Error != nil {
+				return r.Error
+			}
+			if r.AddParents(parents...); r.Error != nil {
+				return r.Error
+			}
+			logger.Info(fmt.Sprintf("已创建角色%s", r.Name))
+			return nil
+		},
+	}
+	create.Flags().StringVar(&intro, "intro", "", "描述")
+	create.Flags().StringSliceVar(&parents, "parent", nil, "继承的角色, 可指定多次")
+
+	var listQuery listFlags
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "查看角色",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			var roles []model.Role
+			if err := listQuery.list(s, &model.Role{}, &roles); err != nil {
+				return err
+			}
+			t := printer.NewTable(roleHeader...)
+			for i := range roles {
+				r := &roles[i]
+				if r.GetParents(); r.Error != nil {
+					return r.Error
+				}
+				t.AddRow(roleRow(r)...)
+			}
+			return o.printTable(t)
+		},
+	}
+	listQuery.addFlags(list.Flags())
+
+	get := &cobra.Command{
+		Use:   "get NAME",
+		Short: "查看角色详情, 用户与组包括通过子角色继承该角色的",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			r, err := findRole(s, args[0])
+			if err != nil {
+				return err
+			}
+			if r.GetParents().GetUsers().GetGroups(); r.Error != nil {
+				return r.Error
+			}
+			users := make([]string, 0, len(*r.Users))
+			for _, value := range *r.Users {
+				users = append(users, value.Name)
+			}
+			groups := make([]string, 0, len(*r.Groups))
+			for _, value := range *r.Groups {
+				groups = append(groups, value.Name)
+			}
+			t := printer.NewTable(append(append([]string{}, roleHeader...), "USERS", "GROUPS")...)
+			t.AddRow(append(roleRow(r), users, groups)...)
+			return o.printTable(t)
+		},
+	}
+
+	update := &cobra.Command{
+		Use:   "update NAME",
+		Short: "更新角色描述或替换继承的角色",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !cmd.Flags().Changed("intro") && !cmd.Flags().Changed("parent") {
+				return errors.New("未指定需要更新的字段")
+			}
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			r, err := findRole(s, args[0])
+			if err != nil {
+				return err
+			}
+			if cmd.Flags().Changed("intro") {
+				r.Intro = intro
+			}
+			if cmd.Flags().Changed("parent") {
+				roles := make([]model.Role, 0, len(parents))
+				for _, value := range parents {
+					p, err := findRole(s, value)
+					if err != nil {
+						return err
+					}
+					roles = append(roles, *p)
+				}
+				r.Parents = &roles
+			}
+			if r.Update(); r.Error != nil {
+				return r.Error
+			}
+			logger.Info(fmt.Sprintf("已更新角色%s", r.Name))
+			return nil
+		},
+	}
+	update.Flags().StringVar(&intro, "intro", "", "描述")
+	update.Flags().StringSliceVar(&parents, "parent", nil, "继承的角色, 替换原有的继承关系, 可指定多次")
+
+	remove := &cobra.Command{
+		Use:   "delete NAME",
+		Short: "删除角色, 同时解除用户与组的绑定并删除其权限",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			r, err := findRole(s, args[0])
+			if err != nil {
+				return err
+			}
+			children, err := s.Roles().Children(r.ID)
+			if err != nil {
+				return err
+			}
+			if len(children) > 0 {
+				return fmt.Errorf("角色%s被角色%s继承, 不能删除", r.Name, strings.Join(roleNames(children), ","))
+			}
+			err = s.Transaction(func(tx model.Store) error {
+				return model.DeleteRole(tx, r.ID)
+			})
+			if err != nil {
+				return fmt.Errorf("删除角色%s失败\n%w", r.Name, err)
+			}
+			logger.Info(fmt.Sprintf("已删除角色%s", r.Name))
+			return nil
+		},
+	}
+
+	cmd.AddCommand(create, list, get, update, remove)
+	return cmd
+}
+
+var roleHeader = []string{"ID", "NAME", "INTRO", "PARENTS"}
+
+func roleRow(r *model.Role) []interface{} {
+	parents := []string{}
+	if r.Parents != nil {
+		parents = roleNames(*r.Parents)
+	}
+	return []interface{}{r.ID, r.Name, r.Intro, parents}
+}
+
+func newPermissionCommand(o *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "permission",
+		Short: "管理角色的权限",
+	}
+
+	var (
+		name, category, action, effect string
+		resourceID                     uint
+	)
+	add := &cobra.Command{
+		Use:   "add ROLE",
+		Short: "为角色添加权限",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if category == "" || action == "" {
+				return errors.New("需通过--category与--action指定权限的类别和操作")
+			}
+			if err := model.CheckEffect(effect); err != nil {
+				return err
+			}
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			r, err := findRole(s, args[0])
+			if err != nil {
+				return err
+			}
+			if name == "" {
+				name = category + ":" + action
+			}
+			p := &model.Permission{
+				Name:       name,
+				ResourceID: resourceID,
+				Category:   category,
+				Action:     action,
+				Effect:     effect,
+				RoleID:     r.ID,
+			}
+			if err := s.Roles().AddPermission(p); err != nil {
+				return fmt.Errorf("角色%s添加权限%s失败\n%w", r.Name, name, err)
+			}
+			logger.Info(fmt.Sprintf("已为角色%s添加权限%d", r.Name, p.ID))
+			return nil
+		},
+	}
+	add.Flags().StringVar(&name, "name", "", "权限名称, 默认为<category>:<action>")
+	add.Flags().StringVar(&category, "category", "", "权限类别, 可使用*")
+	add.Flags().StringVar(&action, "action", "", "操作, 可使用*")
+	add.Flags().StringVar(&effect, "effect", model.EffectAllow, "效果, allow或deny, deny优先")
+	add.Flags().UintVar(&resourceID, "resource-id", 0, "资源ID")
+
+	list := &cobra.Command{
+		Use:   "list ROLE",
+		Short: "查看角色直接拥有的权限, 不包括继承的权限",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			r, err := findRole(s, args[0])
+			if err != nil {
+				return err
+			}
+			permissions, err := s.Roles().Permissions(r.ID)
+			if err != nil {
+				return err
+			}
+			t := printer.NewTable("ID", "NAME", "CATEGORY", "ACTION", "EFFECT", "RESOURCE_ID")
+			for _, value := range permissions {
+				effect := value.Effect
+				if effect == "" {
+					effect = model.EffectAllow
+				}
+				t.AddRow(value.ID, value.Name, value.Category, value.Action, effect, value.ResourceID)
+			}
+			return o.printTable(t)
+		},
+	}
+
+	remove := &cobra.Command{
+		Use:   "delete ID",
+		Short: "删除权限",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("权限编号%s无效\n%w", args[0], err)
+			}
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			if err := s.Roles().RemovePermission(uint(id)); err != nil {
+				return fmt.Errorf("删除权限%d失败\n%w", id, err)
+			}
+			logger.Info(fmt.Sprintf("已删除权限%d", id))
+			return nil
+		},
+	}
+
+	cmd.AddCommand(add, list, remove)
+	return cmd
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package app
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+	"devops/cicd-tools/pkg/cicd-tools/seed"
+	"devops/cicd-tools/pkg/util/logger"
+)
+
+func newSeedCommand(o *options) *cobra.Command {
+	var file string
+	cmd := &cobra.Command{
+		Use:   "seed",
+		Short: "从 YAML 文件导入初始化数据, 已存在的记录会跳过",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if file == "" {
+				return errors.New("需通过--file指定初始化数据文件")
+			}
+			data, err := seed.LoadFile(file)
+			if err != nil {
+				return err
+			}
+			if err := o.connect(); err != nil {
+				return err
+			}
+			s, err := model.DefaultStore()
+			if err != nil {
+				return err
+			}
+			result, err := seed.Load(s, data)
+			if err != nil {
+				return err
+			}
+			logger.Info(fmt.Sprintf("初始化数据导入完成, 新建%d条, 跳过%d条", result.Created, result.Skipped))
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&file, "file", "f", "", "初始化数据文件")
+	return cmd
+}
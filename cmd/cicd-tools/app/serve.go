@@ -0,0 +1,126 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+
+	"devops/cicd-tools/pkg/cicd-tools/api"
+	"devops/cicd-tools/pkg/cicd-tools/auth/oidc"
+	"devops/cicd-tools/pkg/util/logger"
+)
+
+func newServeCommand(o *options) *cobra.Command {
+	var listen, grpcListen string
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "启动HTTP接口, 接口路径前缀为" + api.Prefix + ", 配置了gRPC监听地址时同时启动gRPC接口, 配置了mirror.fetch_interval时定期更新代码仓库镜像, 收到退出信号后等待处理中的请求完成",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cmd.Flags().Changed("listen") {
+				o.config.Server.Listen = listen
+			}
+			if cmd.Flags().Changed("grpc-listen") {
+				o.config.Server.GRPCListen = grpcListen
+			}
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			a, err := o.authenticator()
+			if err != nil {
+				return err
+			}
+			m := o.mirror(s)
+			srv := api.NewServer(s, a).WithMirror(m)
+			if c := o.config.Auth.OIDC; c.Issuer != "" {
+				srv.WithOIDC(oidc.NewFlow(a, oidc.NewClient(c), oidc.NewProvisioner(s, c)).Handler())
+				logger.Info("已启用OIDC登录接口" + api.Prefix + "/auth/oidc/login")
+			}
+			server := &http.Server{
+				Addr:    o.config.Server.Listen,
+				Handler: srv.Handler(),
+			}
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			errs := make(chan error, 2)
+			go func() {
+				errs <- fmt.Errorf("HTTP接口监听%s失败\n%w", server.Addr, server.ListenAndServe())
+			}()
+			logger.Info(fmt.Sprintf("HTTP接口已在%s上启动", server.Addr))
+			var grpcServer *grpc.Server
+			if addr := o.config.Server.GRPCListen; addr != "" {
+				lis, err := net.Listen("tcp", addr)
+				if err != nil {
+					return fmt.Errorf("gRPC接口监听%s失败\n%w", addr, err)
+				}
+				grpcServer = srv.GRPCServer()
+				go func() {
+					errs <- fmt.Errorf("gRPC接口监听%s失败\n%w", addr, grpcServer.Serve(lis))
+				}()
+				logger.Info(fmt.Sprintf("gRPC接口已在%s上启动", addr))
+			}
+			if interval := o.config.Mirror.FetchInterval; interval > 0 {
+				go m.Run(ctx, interval)
+				logger.Info(fmt.Sprintf("代码仓库镜像每%s更新一次", interval))
+			}
+			select {
+			case err := <-errs:
+				return err
+			case <-ctx.Done():
+			}
+			shutdown, cancel := context.WithTimeout(context.Background(), o.config.Server.ShutdownTimeout)
+			defer cancel()
+			if grpcServer != nil {
+				stopGRPC(shutdown, grpcServer)
+				logger.Info("gRPC接口已关闭")
+			}
+			if err := server.Shutdown(shutdown); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				return fmt.Errorf("HTTP接口关闭失败\n%w", err)
+			}
+			logger.Info("HTTP接口已关闭")
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&listen, "listen", "", "监听地址, 默认使用配置server.listen")
+	cmd.Flags().StringVar(&grpcListen, "grpc-listen", "", "gRPC接口监听地址, 默认使用配置server.grpc_listen")
+	return cmd
+}
+
+// stopGRPC 等待处理中的请求完成, 超时后直接关闭, 未结束的 WatchBuild 订阅随之中断
+func stopGRPC(ctx context.Context, s *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.Stop()
+	}
+}
@@ -0,0 +1,193 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package app
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"devops/cicd-tools/pkg/cicd-tools/auth"
+	"devops/cicd-tools/pkg/cicd-tools/model"
+	"devops/cicd-tools/pkg/util/logger"
+	"devops/cicd-tools/pkg/util/printer"
+)
+
+func newTokenCommand(o *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "token",
+		Short: "管理个人访问令牌",
+	}
+
+	var (
+		name    string
+		scopes  []string
+		expires time.Duration
+	)
+	create := &cobra.Command{
+		Use:   "create USER",
+		Short: "创建个人访问令牌, 令牌明文只显示一次",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			u, err := findUser(s, args[0])
+			if err != nil {
+				return err
+			}
+			plain, t, err := auth.NewAuthenticator(s, nil).CreatePersonalToken(u.ID, name, scopes, expires)
+			if err != nil {
+				return err
+			}
+			// 提示写到标准错误, 标准输出只有令牌本身, 便于脚本读取
+			fmt.Fprintf(os.Stderr, "已为用户%s创建个人访问令牌%d, 请妥善保存, 令牌不会再次显示\n", u.Name, t.ID)
+			fmt.Println(plain)
+			return nil
+		},
+	}
+	create.Flags().StringVar(&name, "name", "", "令牌名称")
+	create.Flags().StringSliceVar(&scopes, "scope", nil, "令牌范围, 格式为category:action, 可指定多次, 如build:read")
+	create.Flags().DurationVar(&expires, "expires-in", 0, "有效时长, 如720h, 默认长期有效")
+
+	var user string
+	var listQuery listFlags
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "查看个人访问令牌",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			cond := new(model.PersonalToken)
+			if user != "" {
+				u, err := findUser(s, user)
+				if err != nil {
+					return err
+				}
+				cond.UserID = u.ID
+			}
+			var tokens []model.PersonalToken
+			if err := listQuery.list(s, cond, &tokens); err != nil {
+				return err
+			}
+			now := time.Now()
+			t := printer.NewTable("ID", "USER", "NAME", "PREFIX", "SCOPES", "EXPIRES_AT", "LAST_USED_AT", "STATUS")
+			for _, value := range tokens {
+				status := "active"
+				if value.RevokedAt != nil {
+					status = "revoked"
+				} else if !value.Active(now) {
+					status = "expired"
+				}
+				t.AddRow(value.ID, value.UserID, value.Name, value.Prefix, strings.Split(value.Scopes, ","),
+					value.ExpiresAt, value.LastUsedAt, status)
+			}
+			return o.printTable(t)
+		},
+	}
+	listQuery.addFlags(list.Flags())
+	list.Flags().StringVar(&user, "user", "", "只显示该用户的令牌")
+
+	revoke := &cobra.Command{
+		Use:   "revoke ID",
+		Short: "吊销个人访问令牌",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("令牌编号%s无效\n%w", args[0], err)
+			}
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			if _, err := auth.NewAuthenticator(s, nil).RevokePersonalToken(uint(id)); err != nil {
+				return err
+			}
+			logger.Info(fmt.Sprintf("已吊销个人访问令牌%d", id))
+			return nil
+		},
+	}
+
+	cmd.AddCommand(create, list, revoke)
+	return cmd
+}
+
+func newServiceAccountCommand(o *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "service-account",
+		Short: "管理服务账号, 服务账号只能使用个人访问令牌认证",
+	}
+
+	var email, intro string
+	create := &cobra.Command{
+		Use:   "create NAME",
+		Short: "创建服务账号",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			if email == "" {
+				email = args[0] + "@service-account.local"
+			}
+			u := &model.User{Name: args[0], FullName: intro, Email: email, ServiceAccount: true}
+			if err := s.Users().Create(u); err != nil {
+				return fmt.Errorf("创建服务账号%s失败\n%w", args[0], err)
+			}
+			logger.Info(fmt.Sprintf("已创建服务账号%s", u.Name))
+			return nil
+		},
+	}
+	create.Flags().StringVar(&email, "email", "", "邮箱, 默认为<NAME>@service-account.local")
+	create.Flags().StringVar(&intro, "full-name", "", "显示名称")
+
+	var listQuery listFlags
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "查看服务账号",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			var users []model.User
+			if err := listQuery.list(s, &model.User{ServiceAccount: true}, &users); err != nil {
+				return err
+			}
+			t := printer.NewTable("ID", "NAME", "FULL_NAME", "EMAIL")
+			for _, value := range users {
+				t.AddRow(value.ID, value.Name, value.FullName, value.Email)
+			}
+			return o.printTable(t)
+		},
+	}
+	listQuery.addFlags(list.Flags())
+
+	cmd.AddCommand(create, list)
+	return cmd
+}
@@ -0,0 +1,441 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package app
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+	"devops/cicd-tools/pkg/util/logger"
+	"devops/cicd-tools/pkg/util/printer"
+)
+
+// userFlags 创建与更新用户共用的参数, 更新时只修改显式指定的字段
+type userFlags struct {
+	fullName, gender, location, job, email, mobile, dingTalkID, wxWorkID string
+	age                                                                  uint
+}
+
+func (f *userFlags) addFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&f.fullName, "full-name", "", "中文名")
+	fs.StringVar(&f.gender, "gender", "", "性别")
+	fs.UintVar(&f.age, "age", 0, "年龄")
+	fs.StringVar(&f.location, "location", "", "地点")
+	fs.StringVar(&f.job, "job", "", "职位")
+	fs.StringVar(&f.email, "email", "", "邮箱")
+	fs.StringVar(&f.mobile, "mobile", "", "手机号")
+	fs.StringVar(&f.dingTalkID, "dingtalk-id", "", "钉钉ID")
+	fs.StringVar(&f.wxWorkID, "wxwork-id", "", "企业微信ID")
+}
+
+func (f *userFlags) apply(fs *pflag.FlagSet, u *model.User) {
+	values := map[string]func(){
+		"full-name":   func() { u.FullName = f.fullName },
+		"gender":      func() { u.Gender = f.gender },
+		"age":         func() { u.Age = f.age },
+		"location":    func() { u.Location = f.location },
+		"job":         func() { u.Job = f.job },
+		"email":       func() { u.Email = f.email },
+		"mobile":      func() { u.Mobile = f.mobile },
+		"dingtalk-id": func() { u.DingTalkID = f.dingTalkID },
+		"wxwork-id":   func() { u.WXWorkID = f.wxWorkID },
+	}
+	for name, apply := range values {
+		if fs.Changed(name) {
+			apply()
+		}
+	}
+}
+
+func newUserCommand(o *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "user",
+		Short: "管理用户及其所属的组和角色",
+	}
+
+	var (
+		createFlags userFlags
+		groups      []string
+	)
+	create := &cobra.Command{
+		Use:   "create NAME",
+		Short: "创建用户, 可同时加入组",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if createFlags.email == "" {
+				return errors.New("需通过--email指定邮箱")
+			}
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			if _, err := s.Users().First(&model.User{Name: args[0]}); err == nil {
+				return fmt.Errorf("用户%s已存在", args[0])
+			}
+			for _, value := range groups {
+				if _, err := findGroup(s, value); err != nil {
+					return err
+				}
+			}
+			u := &model.User{Name: args[0]}
+			createFlags.apply(cmd.Flags(), u)
+			if u.Create(); u.Error != nil {
+				return u.Error
+			}
+			if u.AddGroups(groups...); u.Error != nil {
+				return u.Error
+			}
+			logger.Info(fmt.Sprintf("已创建用户%s", u.Name))
+			return nil
+		},
+	}
+	createFlags.addFlags(create.Flags())
+	create.Flags().StringSliceVar(&groups, "group", nil, "加入的组, 可指定多次")
+
+	var source string
+	var listQuery listFlags
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "查看用户",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			var users []model.User
+			if err := listQuery.list(s, &model.User{Source: source}, &users); err != nil {
+				return err
+			}
+			t := printer.NewTable(userHeader...)
+			for i := range users {
+				t.AddRow(userRow(&users[i])...)
+			}
+			return o.printTable(t)
+		},
+	}
+	listQuery.addFlags(list.Flags())
+	list.Flags().StringVar(&source, "source", "", "只显示该来源的用户, 如ldap、oidc")
+
+	get := &cobra.Command{
+		Use:   "get NAME",
+		Short: "查看用户详情, 包括所属的组和绑定的角色",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			u, err := findUser(s, args[0])
+			if err != nil {
+				return err
+			}
+			if u.GetGroups().GetRoles(); u.Error != nil {
+				return u.Error
+			}
+			groupNames := make([]string, 0, len(*u.Groups))
+			for _, value := range *u.Groups {
+				groupNames = append(groupNames, value.Name)
+			}
+			t := printer.NewTable(append(append([]string{}, userHeader...), "FULL_NAME", "MOBILE", "JOB", "GROUPS", "ROLES")...)
+			t.AddRow(append(userRow(u), u.FullName, u.Mobile, u.Job, groupNames, roleNames(*u.Roles))...)
+			return o.printTable(t)
+		},
+	}
+
+	var updateFlags userFlags
+	update := &cobra.Command{
+		Use:   "update NAME",
+		Short: "更新用户信息, 只修改指定的字段",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			u, err := findUser(s, args[0])
+			if err != nil {
+				return err
+			}
+			updateFlags.apply(cmd.Flags(), u)
+			if u.Update(); u.Error != nil {
+				return u.Error
+			}
+			logger.Info(fmt.Sprintf("已更新用户%s", u.Name))
+			return nil
+		},
+	}
+	updateFlags.addFlags(update.Flags())
+
+	remove := &cobra.Command{
+		Use:   "delete NAME",
+		Short: "删除用户",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			u, err := findUser(s, args[0])
+			if err != nil {
+				return err
+			}
+			if err := s.Users().Delete(u.ID); err != nil {
+				return fmt.Errorf("删除用户%s失败\n%w", u.Name, err)
+			}
+			logger.Info(fmt.Sprintf("已删除用户%s", u.Name))
+			return nil
+		},
+	}
+
+	addGroups := &cobra.Command{
+		Use:   "add-groups NAME GROUP...",
+		Short: "将用户加入组",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			u, err := findUser(s, args[0])
+			if err != nil {
+				return err
+			}
+			for _, value := range args[1:] {
+				if _, err := findGroup(s, value); err != nil {
+					return err
+				}
+			}
+			if u.AddGroups(args[1:]...); u.Error != nil {
+				return u.Error
+			}
+			logger.Info(fmt.Sprintf("已将用户%s加入组%s", u.Name, strings.Join(args[1:], ",")))
+			return nil
+		},
+	}
+
+	removeGroups := &cobra.Command{
+		Use:   "remove-groups NAME GROUP...",
+		Short: "将用户移出组",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			u, err := findUser(s, args[0])
+			if err != nil {
+				return err
+			}
+			for _, value := range args[1:] {
+				g, err := findGroup(s, value)
+				if err != nil {
+					return err
+				}
+				if err := s.Users().RemoveGroup(u.ID, g.ID); err != nil {
+					return fmt.Errorf("将用户%s移出组%s失败\n%w", u.Name, g.Name, err)
+				}
+			}
+			logger.Info(fmt.Sprintf("已将用户%s移出组%s", u.Name, strings.Join(args[1:], ",")))
+			return nil
+		},
+	}
+
+	var bind roleBindingFlags
+	addRoles := &cobra.Command{
+		Use:   "add-roles NAME ROLE...",
+		Short: "为用户绑定角色, 可限定项目、环境与有效时长",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			u, err := findUser(s, args[0])
+			if err != nil {
+				return err
+			}
+			scope, err := findScope(s, bind.project, bind.env)
+			if err != nil {
+				return err
+			}
+			if bind.expiresIn > 0 {
+				u.AddTemporaryRoles(scope, time.Now().Add(bind.expiresIn), args[1:]...)
+			} else {
+				u.AddScopedRoles(scope, args[1:]...)
+			}
+			if u.Error != nil {
+				return u.Error
+			}
+			logger.Info(fmt.Sprintf("已为用户%s绑定角色%s", u.Name, strings.Join(args[1:], ",")))
+			return nil
+		},
+	}
+	bind.addFlags(addRoles.Flags())
+
+	removeRoles := &cobra.Command{
+		Use:   "remove-roles NAME ROLE...",
+		Short: "解除用户在指定范围内绑定的角色",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			u, err := findUser(s, args[0])
+			if err != nil {
+				return err
+			}
+			scope, err := findScope(s, bind.project, bind.env)
+			if err != nil {
+				return err
+			}
+			projectID, projectEnvID, err := model.ResolveScope(s, scope)
+			if err != nil {
+				return err
+			}
+			bindings, err := s.Users().RoleBindings(u.ID)
+			if err != nil {
+				return err
+			}
+			for _, value := range args[1:] {
+				r, err := findRole(s, value)
+				if err != nil {
+					return err
+				}
+				for _, ur := range bindings {
+					if ur.RoleID == r.ID && ur.ProjectID == projectID && ur.ProjectEnvID == projectEnvID {
+						if err := s.Users().RemoveRoleBinding(ur.ID); err != nil {
+							return fmt.Errorf("解除用户%s的角色%s失败\n%w", u.Name, r.Name, err)
+						}
+					}
+				}
+			}
+			logger.Info(fmt.Sprintf("已解除用户%s的角色%s", u.Name, strings.Join(args[1:], ",")))
+			return nil
+		},
+	}
+	removeRoles.Flags().StringVar(&bind.project, "project", "", "绑定生效的项目")
+	removeRoles.Flags().StringVar(&bind.env, "env", "", "绑定生效的环境, 需同时指定--project")
+
+	roles := &cobra.Command{
+		Use:   "roles NAME",
+		Short: "查看用户直接绑定的角色及其范围",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := o.store()
+			if err != nil {
+				return err
+			}
+			u, err := findUser(s, args[0])
+			if err != nil {
+				return err
+			}
+			bindings, err := s.Users().RoleBindings(u.ID)
+			if err != nil {
+				return err
+			}
+			t := printer.NewTable(bindingHeader...)
+			for _, ur := range bindings {
+				row, err := bindingRow(s, ur.ID, ur.RoleID, ur.ProjectID, ur.ProjectEnvID, ur.ExpiresAt)
+				if err != nil {
+					return err
+				}
+				t.AddRow(row...)
+			}
+			return o.printTable(t)
+		},
+	}
+
+	cmd.AddCommand(create, list, get, update, remove, addGroups, removeGroups, addRoles, removeRoles, roles)
+	return cmd
+}
+
+var userHeader = []string{"ID", "NAME", "EMAIL", "SOURCE", "SERVICE_ACCOUNT", "STATUS"}
+
+func userRow(u *model.User) []interface{} {
+	status := "active"
+	if u.Disabled {
+		status = "disabled"
+	} else if u.LockedUntil != nil && time.Now().Before(*u.LockedUntil) {
+		status = "locked"
+	}
+	source := u.Source
+	if source == model.SourceLocal {
+		source = "local"
+	}
+	return []interface{}{u.ID, u.Name, u.Email, source, u.ServiceAccount, status}
+}
+
+// roleBindingFlags 绑定角色时共用的范围与有效时长参数
+type roleBindingFlags struct {
+	project, env string
+	expiresIn    time.Duration
+}
+
+func (f *roleBindingFlags) addFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&f.project, "project", "", "限定生效的项目")
+	fs.StringVar(&f.env, "env", "", "限定生效的环境, 需同时指定--project")
+	fs.DurationVar(&f.expiresIn, "expires-in", 0, "有效时长, 如8h, 默认长期有效")
+}
+
+var bindingHeader = []string{"ID", "ROLE", "SCOPE", "EXPIRES_AT"}
+
+func bindingRow(s model.Store, id uint, rid uint, projectID uint, projectEnvID uint, expiresAt *time.Time) ([]interface{}, error) {
+	r, err := s.Roles().Get(rid)
+	if err != nil {
+		return nil, fmt.Errorf("角色%d不存在\n%w", rid, err)
+	}
+	scope, err := model.BindingScope(s, projectID, projectEnvID)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{id, r.Name, scopeString(s, scope), expiresAt}, nil
+}
+
+// scopeString 以项目与环境名称显示范围, 查询不到名称时退回 Scope.String
+func scopeString(s model.Store, scope model.Scope) string {
+	if scope.IsGlobal() {
+		return scope.String()
+	}
+	p, err := s.Projects().Get(scope.ProjectID)
+	if err != nil {
+		return scope.String()
+	}
+	if scope.EnvID == 0 {
+		return p.Name
+	}
+	e, err := s.Projects().GetEnv(scope.EnvID)
+	if err != nil {
+		return scope.String()
+	}
+	return p.Name + "/" + e.Name
+}
+
+func roleNames(roles []model.Role) []string {
+	names := make([]string, 0, len(roles))
+	for _, value := range roles {
+		names = append(names, value.Name)
+	}
+	return names
+}
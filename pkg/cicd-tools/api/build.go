@@ -0,0 +1,723 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"devops/cicd-tools/pkg/cicd-tools/auth"
+	"devops/cicd-tools/pkg/cicd-tools/model"
+	"devops/cicd-tools/pkg/util/logger"
+)
+
+type Repo struct {
+	ID         uint      `json:"id" api:"readonly" column:"id"`
+	Name       string    `json:"name" column:"name"`
+	RepoURL    string    `json:"repo_url" column:"repo_url"`
+	RepoSSHURL string    `json:"repo_ssh_url" column:"repo_ssh_url"`
+	Intro      string    `json:"intro" column:"intro"`
+	CreatedAt  time.Time `json:"created_at" api:"readonly" column:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at" api:"readonly" column:"updated_at"`
+}
+
+// BuildConfig 每个应用环境最多一个构建配置, project_env_item_id 与 git_repo_id 创建后不能修改
+type BuildConfig struct {
+	ID               uint      `json:"id" api:"readonly" column:"id"`
+	ProjectEnvItemID uint      `json:"project_env_item_id" column:"project_env_item_id"`
+	GitRepoID        uint      `json:"git_repo_id" column:"git_repo_id"`
+	BuildDir         string    `json:"build_dir" column:"build_dir"`
+	BuildCmd         string    `json:"build_cmd" column:"build_cmd"`
+	BuildEnv         string    `json:"build_env" column:"build_env"`
+	CreatedAt        time.Time `json:"created_at" api:"readonly" column:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at" api:"readonly" column:"updated_at"`
+}
+
+// Build 的 number 在同一应用环境内递增, 登记构建的用户为令牌对应的用户, 只有 name、build_env、git_branch 与 state 可以修改
+type Build struct {
+	ID               uint      `json:"id" api:"readonly" column:"id"`
+	Number           uint      `json:"number" api:"readonly" column:"build_id"`
+	Name             string    `json:"name" column:"build_name"`
+	BuildDate        time.Time `json:"build_date" api:"readonly" column:"build_date"`
+	UserID           uint      `json:"user_id" api:"readonly" column:"build_user_id"`
+	UserName         string    `json:"user_name" api:"readonly" column:"build_user_name"`
+	BuildEnv         string    `json:"build_env" column:"build_env"`
+	ProjectEnvItemID uint      `json:"project_env_item_id" column:"project_env_item_id"`
+	GitRepoID        uint      `json:"git_repo_id" column:"git_repo_id"`
+	GitBranch        string    `json:"git_branch" column:"git_branch"`
+	CommitInfoID     uint      `json:"commit_info_id" api:"readonly" column:"commit_info_id"`
+	BuildConfigID    uint      `json:"build_config_id" api:"readonly" column:"build_config_id"`
+	ArtifactID       uint      `json:"artifact_id" api:"readonly" column:"artifact_id"`
+	State            string    `json:"state" column:"build_state"`
+	CreatedAt        time.Time `json:"created_at" api:"readonly" column:"created_at"`
+}
+
+// Artifact 的 build_info_id 创建后不能修改, project_env_item_id 取自构建
+type Artifact struct {
+	ID               uint      `json:"id" api:"readonly" column:"id"`
+	Name             string    `json:"name" column:"artifact_name"`
+	Release          string    `json:"release" column:"release"`
+	Version          string    `json:"version" column:"version"`
+	Md5              string    `json:"md5" column:"md5_checksum"`
+	SHA1             string    `json:"sha1" column:"sha1_checksum"`
+	SHA256           string    `json:"sha256" column:"sha256_checksum"`
+	SHA512           string    `json:"sha512" column:"sha512_checksum"`
+	ProjectEnvItemID uint      `json:"project_env_item_id" api:"readonly" column:"project_env_item_id"`
+	BuildInfoID      uint      `json:"build_info_id" column:"build_info_id"`
+	CreatedAt        time.Time `json:"created_at" api:"readonly" column:"created_at"`
+}
+
+// BuildStatePending 登记构建时未指定状态的默认值
+const BuildStatePending = model.BuildStatePending
+
+func newRepo(r *model.GitRepo) Repo {
+	return Repo{ID: r.ID, Name: r.Name, RepoURL: r.RepoURL, RepoSSHURL: r.RepoSSHURL, Intro: r.Intro, CreatedAt: r.CreatedAt, UpdatedAt: r.UpdatedAt}
+}
+
+func newBuildConfig(c *model.BuildConfig) BuildConfig {
+	return BuildConfig{
+		ID:               c.ID,
+		ProjectEnvItemID: c.ProjectEnvItemID,
+		GitRepoID:        c.GitRepoID,
+		BuildDir:         c.BuildDir,
+		BuildCmd:         c.BuildCmd,
+		BuildEnv:         c.BuildEnv,
+		CreatedAt:        c.CreatedAt,
+		UpdatedAt:        c.UpdatedAt,
+	}
+}
+
+func newBuild(b *model.BuildInfo) Build {
+	return Build{
+		ID:               b.ID,
+		Number:           b.BuildID,
+		Name:             b.BuildName,
+		BuildDate:        b.BuildDate,
+		UserID:           b.BuildUserID,
+		UserName:         b.BuildUserName,
+		BuildEnv:         b.BuildEnv,
+		ProjectEnvItemID: b.ProjectEnvItemID,
+		GitRepoID:        b.GitRepoID,
+		GitBranch:        b.GitBranch,
+		CommitInfoID:     b.CommitInfoID,
+		BuildConfigID:    b.BuildConfigID,
+		ArtifactID:       b.ArtifactID,
+		State:            b.BuildState,
+		CreatedAt:        b.CreatedAt,
+	}
+}
+
+func newArtifact(a *model.Artifact) Artifact {
+	return Artifact{
+		ID:               a.ID,
+		Name:             a.Name,
+		Release:          a.Release,
+		Version:          a.Version,
+		Md5:              a.Md5,
+		SHA1:             a.SHA1,
+		SHA256:           a.SHA256,
+		SHA512:           a.SHA512,
+		ProjectEnvItemID: a.ProjectEnvItemID,
+		BuildInfoID:      a.BuildInfoID,
+		CreatedAt:        a.CreatedAt,
+	}
+}
+
+func (v Artifact) apply(a *model.Artifact) {
+	a.Name = v.Name
+	a.Release = v.Release
+	a.Version = v.Version
+	a.Md5 = v.Md5
+	a.SHA1 = v.SHA1
+	a.SHA256 = v.SHA256
+	a.SHA512 = v.SHA512
+}
+
+func (s *Server) buildRoutes() {
+	s.routes.add(Operation{Method: http.MethodGet, Path: "/repos", ID: "ListRepos", Summary: "查看代码仓库", Query: ListQuery{}, Response: []Repo{}}, s.listRepos)
+	s.routes.add(Operation{Method: http.MethodPost, Path: "/repos", ID: "CreateRepo", Summary: "创建代码仓库", Body: Repo{}, Response: Repo{}, Status: http.StatusCreated}, s.createRepo)
+	s.routes.add(Operation{Method: http.MethodGet, Path: "/repos/{id}", ID: "GetRepo", Summary: "查看代码仓库详情", Response: Repo{}}, s.getRepo)
+	s.routes.add(Operation{Method: http.MethodPut, Path: "/repos/{id}", ID: "UpdateRepo", Summary: "更新代码仓库", Body: Repo{}, Response: Repo{}}, s.updateRepo)
+	s.routes.add(Operation{Method: http.MethodDelete, Path: "/repos/{id}", ID: "DeleteRepo", Summary: "删除代码仓库"}, s.deleteRepo)
+
+	s.routes.add(Operation{Method: http.MethodGet, Path: "/build-configs", ID: "ListBuildConfigs", Summary: "查看构建配置", Query: BuildConfigQuery{}, Response: []BuildConfig{}}, s.listBuildConfigs)
+	s.routes.add(Operation{Method: http.MethodPost, Path: "/build-configs", ID: "CreateBuildConfig", Summary: "创建构建配置", Body: BuildConfig{}, Response: BuildConfig{}, Status: http.StatusCreated}, s.createBuildConfig)
+	s.routes.add(Operation{Method: http.MethodGet, Path: "/build-configs/{id}", ID: "GetBuildConfig", Summary: "查看构建配置详情", Response: BuildConfig{}}, s.getBuildConfig)
+	s.routes.add(Operation{Method: http.MethodPut, Path: "/build-configs/{id}", ID: "UpdateBuildConfig", Summary: "更新构建配置", Body: BuildConfig{}, Response: BuildConfig{}}, s.updateBuildConfig)
+	s.routes.add(Operation{Method: http.MethodDelete, Path: "/build-configs/{id}", ID: "DeleteBuildConfig", Summary: "删除构建配置"}, s.deleteBuildConfig)
+
+	s.routes.add(Operation{Method: http.MethodGet, Path: "/builds", ID: "ListBuilds", Summary: "查看构建记录", Query: BuildQuery{}, Response: []Build{}}, s.listBuilds)
+	s.routes.add(Operation{Method: http.MethodPost, Path: "/builds", ID: "CreateBuild", Summary: "登记构建", Body: Build{}, Response: Build{}, Status: http.StatusCreated}, s.createBuild)
+	s.routes.add(Operation{Method: http.MethodGet, Path: "/builds/{id}", ID: "GetBuild", Summary: "查看构建记录详情", Response: Build{}}, s.getBuild)
+	s.routes.add(Operation{Method: http.MethodPut, Path: "/builds/{id}", ID: "UpdateBuild", Summary: "更新构建记录", Body: Build{}, Response: Build{}}, s.updateBuild)
+	s.routes.add(Operation{Method: http.MethodDelete, Path: "/builds/{id}", ID: "DeleteBuild", Summary: "删除构建记录"}, s.deleteBuild)
+	s.routes.add(Operation{Method: http.MethodGet, Path: "/builds/{id}/logs", ID: "ListBuildLogs", Summary: "查看构建日志", Query: BuildLogQuery{}, Response: []BuildLog{}}, s.listBuildLogs)
+	s.routes.add(Operation{Method: http.MethodPost, Path: "/builds/{id}/logs", ID: "AppendBuildLog", Summary: "追加构建日志, 已结束的构建不能追加", Body: LogLines{}}, s.appendBuildLog)
+
+	s.routes.add(Operation{Method: http.MethodGet, Path: "/artifacts", ID: "ListArtifacts", Summary: "查看制品", Query: ArtifactQuery{}, Response: []Artifact{}}, s.listArtifacts)
+	s.routes.add(Operation{Method: http.MethodPost, Path: "/artifacts", ID: "CreateArtifact", Summary: "登记制品", Body: Artifact{}, Response: Artifact{}, Status: http.StatusCreated}, s.createArtifact)
+	s.routes.add(Operation{Method: http.MethodGet, Path: "/artifacts/{id}", ID: "GetArtifact", Summary: "查看制品详情", Response: Artifact{}}, s.getArtifact)
+	s.routes.add(Operation{Method: http.MethodPut, Path: "/artifacts/{id}", ID: "UpdateArtifact", Summary: "更新制品", Body: Artifact{}, Response: Artifact{}}, s.updateArtifact)
+	s.routes.add(Operation{Method: http.MethodDelete, Path: "/artifacts/{id}", ID: "DeleteArtifact", Summary: "删除制品"}, s.deleteArtifact)
+}
+
+// envItem 读取应用环境与其鉴权范围, id 为 0 时返回全局范围
+func (s *Server) envItem(id uint) (*model.ProjectEnvItem, model.Scope, error) {
+	if id == 0 {
+		return nil, model.Scope{}, nil
+	}
+	cond := new(model.ProjectEnvItem)
+	cond.ID = id
+	pei, err := s.store.Projects().FirstEnvItem(cond)
+	if err != nil {
+		return nil, model.Scope{}, fmt.Errorf("应用环境%d不存在\n%w", id, err)
+	}
+	return pei, envItemScope(pei), nil
+}
+
+func (s *Server) listRepos(c *call) error {
+	var q ListQuery
+	if err := c.decodeQuery(&q); err != nil {
+		return err
+	}
+	if err := c.authorize(CategoryRepo, ActionRead, 0, model.Scope{}); err != nil {
+		return err
+	}
+	var repos []model.GitRepo
+	page, err := s.list(&model.GitRepo{}, q, Repo{}, &repos)
+	if err != nil {
+		return err
+	}
+	items := make([]Repo, 0, len(repos))
+	for i := range repos {
+		items = append(items, newRepo(&repos[i]))
+	}
+	return c.page(items, page)
+}
+
+func (s *Server) createRepo(c *call) error {
+	if err := c.authorize(CategoryRepo, ActionCreate, 0, model.Scope{}); err != nil {
+		return err
+	}
+	var v Repo
+	if err := c.decode(&v); err != nil {
+		return err
+	}
+	if v.Name == "" {
+		return badRequest(errors.New("代码仓库需指定name"))
+	}
+	if _, err := s.store.Builds().FirstRepo(&model.GitRepo{Name: v.Name}); err == nil {
+		return conflict(fmt.Errorf("代码仓库%s已存在", v.Name))
+	}
+	r := &model.GitRepo{Name: v.Name, RepoURL: v.RepoURL, RepoSSHURL: v.RepoSSHURL, Intro: v.Intro}
+	if err := s.store.Builds().FirstOrCreateRepo(r); err != nil {
+		return fmt.Errorf("创建代码仓库%s失败\n%w", r.Name, err)
+	}
+	return c.json(http.StatusCreated, newRepo(r))
+}
+
+func (s *Server) repo(c *call, action string) (*model.GitRepo, error) {
+	id, err := c.uint("id")
+	if err != nil {
+		return nil, err
+	}
+	if err := c.authorize(CategoryRepo, action, id, model.Scope{}); err != nil {
+		return nil, err
+	}
+	r, err := s.store.Builds().GetRepo(id)
+	if err != nil {
+		return nil, fmt.Errorf("代码仓库%d不存在\n%w", id, err)
+	}
+	return r, nil
+}
+
+func (s *Server) getRepo(c *call) error {
+	r, err := s.repo(c, ActionRead)
+	if err != nil {
+		return err
+	}
+	return c.json(http.StatusOK, newRepo(r))
+}
+
+func (s *Server) updateRepo(c *call) error {
+	r, err := s.repo(c, ActionUpdate)
+	if err != nil {
+		return err
+	}
+	v := newRepo(r)
+	if err := c.decode(&v); err != nil {
+		return err
+	}
+	if v.Name != r.Name {
+		if _, err := s.store.Builds().FirstRepo(&model.GitRepo{Name: v.Name}); err == nil {
+			return conflict(fmt.Errorf("代码仓库%s已存在", v.Name))
+		}
+	}
+	r.Name, r.RepoURL, r.RepoSSHURL, r.Intro = v.Name, v.RepoURL, v.RepoSSHURL, v.Intro
+	if err := s.store.Builds().SaveRepo(r); err != nil {
+		return fmt.Errorf("代码仓库%s数据更新失败\n%w", r.Name, err)
+	}
+	return c.json(http.StatusOK, newRepo(r))
+}
+
+func (s *Server) deleteRepo(c *call) error {
+	r, err := s.repo(c, ActionDelete)
+	if err != nil {
+		return err
+	}
+	if err := s.store.Builds().DeleteRepo(r.ID); err != nil {
+		return fmt.Errorf("删除代码仓库%s失败\n%w", r.Name, err)
+	}
+	if s.mirror != nil {
+		if err := s.mirror.Remove(r.ID); err != nil {
+			logger.Warn(err.Error())
+		}
+	}
+	return c.noContent()
+}
+
+// listBuildConfigs 指定 project_env_item_id 时在该应用环境的范围内鉴权
+func (s *Server) listBuildConfigs(c *call) error {
+	var q BuildConfigQuery
+	if err := c.decodeQuery(&q); err != nil {
+		return err
+	}
+	_, scope, err := s.envItem(q.ProjectEnvItemID)
+	if err != nil {
+		return err
+	}
+	if err := c.authorize(CategoryBuildConfig, ActionRead, 0, scope); err != nil {
+		return err
+	}
+	var configs []model.BuildConfig
+	page, err := s.list(&model.BuildConfig{ProjectEnvItemID: q.ProjectEnvItemID}, q.ListQuery, BuildConfig{}, &configs)
+	if err != nil {
+		return err
+	}
+	items := make([]BuildConfig, 0, len(configs))
+	for i := range configs {
+		items = append(items, newBuildConfig(&configs[i]))
+	}
+	return c.page(items, page)
+}
+
+func (s *Server) createBuildConfig(c *call) error {
+	var v BuildConfig
+	if err := c.decode(&v); err != nil {
+		return err
+	}
+	if v.ProjectEnvItemID == 0 {
+		return badRequest(errors.New("构建配置需指定project_env_item_id"))
+	}
+	pei, scope, err := s.envItem(v.ProjectEnvItemID)
+	if err != nil {
+		return badRequest(err)
+	}
+	if err := c.authorize(CategoryBuildConfig, ActionCreate, 0, scope); err != nil {
+		return err
+	}
+	if _, err := model.EnvItemConfig(s.store, pei); err == nil {
+		return conflict(fmt.Errorf("应用环境%d已有构建配置", pei.ID))
+	} else if !errors.Is(err, model.ErrNotFound) {
+		return err
+	}
+	if v.GitRepoID == 0 {
+		v.GitRepoID = pei.GitRepoID
+	} else if _, err := s.store.Builds().GetRepo(v.GitRepoID); err != nil {
+		return badRequest(fmt.Errorf("代码仓库%d不存在", v.GitRepoID))
+	}
+	bc := &model.BuildConfig{
+		BuildDir:         v.BuildDir,
+		BuildCmd:         v.BuildCmd,
+		BuildEnv:         v.BuildEnv,
+		ProjectEnvItemID: pei.ID,
+		GitRepoID:        v.GitRepoID,
+	}
+	if err := s.store.Builds().FirstOrCreateConfig(bc); err != nil {
+		return fmt.Errorf("创建应用环境%d的构建配置失败\n%w", pei.ID, err)
+	}
+	return c.json(http.StatusCreated, newBuildConfig(bc))
+}
+
+func (s *Server) buildConfig(c *call, action string) (*model.BuildConfig, error) {
+	id, err := c.uint("id")
+	if err != nil {
+		return nil, err
+	}
+	bc, err := s.store.Builds().GetConfig(id)
+	if err != nil {
+		return nil, fmt.Errorf("构建配置%d不存在\n%w", id, err)
+	}
+	_, scope, err := s.envItem(bc.ProjectEnvItemID)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.authorize(CategoryBuildConfig, action, bc.ID, scope); err != nil {
+		return nil, err
+	}
+	return bc, nil
+}
+
+func (s *Server) getBuildConfig(c *call) error {
+	bc, err := s.buildConfig(c, ActionRead)
+	if err != nil {
+		return err
+	}
+	return c.json(http.StatusOK, newBuildConfig(bc))
+}
+
+func (s *Server) updateBuildConfig(c *call) error {
+	bc, err := s.buildConfig(c, ActionUpdate)
+	if err != nil {
+		return err
+	}
+	v := newBuildConfig(bc)
+	if err := c.decode(&v); err != nil {
+		return err
+	}
+	if v.ProjectEnvItemID != bc.ProjectEnvItemID || v.GitRepoID != bc.GitRepoID {
+		return badRequest(errors.New("构建配置的project_env_item_id与git_repo_id不能修改"))
+	}
+	bc.BuildDir, bc.BuildCmd, bc.BuildEnv = v.BuildDir, v.BuildCmd, v.BuildEnv
+	if err := s.store.Builds().SaveConfig(bc); err != nil {
+		return fmt.Errorf("构建配置%d数据更新失败\n%w", bc.ID, err)
+	}
+	return c.json(http.StatusOK, newBuildConfig(bc))
+}
+
+func (s *Server) deleteBuildConfig(c *call) error {
+	bc, err := s.buildConfig(c, ActionDelete)
+	if err != nil {
+		return err
+	}
+	if err := s.store.Builds().DeleteConfig(bc.ID); err != nil {
+		return fmt.Errorf("删除构建配置%d失败\n%w", bc.ID, err)
+	}
+	return c.noContent()
+}
+
+func (s *Server) listBuilds(c *call) error {
+	var q BuildQuery
+	if err := c.decodeQuery(&q); err != nil {
+		return err
+	}
+	items, page, err := s.builds(c.id, q)
+	if err != nil {
+		return err
+	}
+	return c.page(items, page)
+}
+
+// builds 支持按 project_env_item_id 与 state 筛选
+func (s *Server) builds(id *auth.Identity, q BuildQuery) ([]Build, Page, error) {
+	_, scope, err := s.envItem(q.ProjectEnvItemID)
+	if err != nil {
+		return nil, Page{}, err
+	}
+	if err := s.authorize(id, CategoryBuild, ActionRead, 0, scope); err != nil {
+		return nil, Page{}, err
+	}
+	cond := &model.BuildInfo{ProjectEnvItemID: q.ProjectEnvItemID, BuildState: q.State}
+	var builds []model.BuildInfo
+	page, err := s.list(cond, q.ListQuery, Build{}, &builds)
+	if err != nil {
+		return nil, Page{}, err
+	}
+	items := make([]Build, 0, len(builds))
+	for i := range builds {
+		items = append(items, newBuild(&builds[i]))
+	}
+	return items, page, nil
+}
+
+func (s *Server) createBuild(c *call) error {
+	var v Build
+	if err := c.decode(&v); err != nil {
+		return err
+	}
+	b, err := s.addBuild(c.id, v)
+	if err != nil {
+		return err
+	}
+	return c.json(http.StatusCreated, b)
+}
+
+// addBuild 需要 build:create 与目标环境的 env:deploy, 未指定 git_repo_id 时使用应用环境关联的仓库, 构建配置取应用环境当前的配置
+func (s *Server) addBuild(id *auth.Identity, v Build) (Build, error) {
+	if v.ProjectEnvItemID == 0 {
+		return Build{}, badRequest(errors.New("构建需指定project_env_item_id"))
+	}
+	pei, scope, err := s.envItem(v.ProjectEnvItemID)
+	if err != nil {
+		return Build{}, badRequest(err)
+	}
+	if err := s.authorize(id, CategoryBuild, ActionCreate, 0, scope); err != nil {
+		return Build{}, err
+	}
+	if err := s.authorizeDeploy(id, scope); err != nil {
+		return Build{}, err
+	}
+	u, err := s.store.Users().Get(id.UserID)
+	if err != nil {
+		return Build{}, err
+	}
+	b := &model.BuildInfo{
+		BuildName:        v.Name,
+		BuildDate:        time.Now(),
+		BuildUserID:      u.ID,
+		BuildUserName:    u.Name,
+		BuildEnv:         v.BuildEnv,
+		ProjectEnvItemID: pei.ID,
+		GitRepoID:        pei.GitRepoID,
+		GitBranch:        v.GitBranch,
+		BuildState:       v.State,
+	}
+	if b.BuildState == "" {
+		b.BuildState = BuildStatePending
+	}
+	if v.GitRepoID != 0 {
+		if _, err := s.store.Builds().GetRepo(v.GitRepoID); err != nil {
+			return Build{}, badRequest(fmt.Errorf("代码仓库%d不存在", v.GitRepoID))
+		}
+		b.GitRepoID = v.GitRepoID
+	}
+	if bc, err := model.EnvItemConfig(s.store, pei); err == nil {
+		b.BuildConfigID = bc.ID
+	} else if !errors.Is(err, model.ErrNotFound) {
+		return Build{}, err
+	}
+	if err := model.CreateBuild(s.store, b); err != nil {
+		return Build{}, fmt.Errorf("登记构建失败\n%w", err)
+	}
+	return newBuild(b), nil
+}
+
+func (s *Server) build(id *auth.Identity, bid uint, action string) (*model.BuildInfo, error) {
+	b, err := s.store.Builds().Get(bid)
+	if err != nil {
+		return nil, fmt.Errorf("构建%d不存在\n%w", bid, err)
+	}
+	_, scope, err := s.envItem(b.ProjectEnvItemID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorize(id, CategoryBuild, action, b.ID, scope); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (s *Server) pathBuild(c *call, action string) (*model.BuildInfo, error) {
+	id, err := c.uint("id")
+	if err != nil {
+		return nil, err
+	}
+	return s.build(c.id, id, action)
+}
+
+func (s *Server) getBuild(c *call) error {
+	b, err := s.pathBuild(c, ActionRead)
+	if err != nil {
+		return err
+	}
+	return c.json(http.StatusOK, newBuild(b))
+}
+
+func (s *Server) updateBuild(c *call) error {
+	b, err := s.pathBuild(c, ActionUpdate)
+	if err != nil {
+		return err
+	}
+	v := newBuild(b)
+	if err := c.decode(&v); err != nil {
+		return err
+	}
+	if v, err = s.saveBuild(b, v); err != nil {
+		return err
+	}
+	return c.json(http.StatusOK, v)
+}
+
+// saveBuild 只修改 name、build_env、git_branch 与 state, 并通知等待该构建的订阅者
+func (s *Server) saveBuild(b *model.BuildInfo, v Build) (Build, error) {
+	b.BuildName, b.BuildEnv, b.GitBranch, b.BuildState = v.Name, v.BuildEnv, v.GitBranch, v.State
+	if err := s.store.Builds().Save(b); err != nil {
+		return Build{}, fmt.Errorf("构建%d数据更新失败\n%w", b.ID, err)
+	}
+	s.events.notify(b.ID)
+	return newBuild(b), nil
+}
+
+func (s *Server) deleteBuild(c *call) error {
+	b, err := s.pathBuild(c, ActionDelete)
+	if err != nil {
+		return err
+	}
+	if err := s.store.Builds().Delete(b.ID); err != nil {
+		return fmt.Errorf("删除构建%d失败\n%w", b.ID, err)
+	}
+	s.events.notify(b.ID)
+	return c.noContent()
+}
+
+// artifactScope 制品按产出它的构建所在的应用环境鉴权, 未关联构建时为全局范围
+func (s *Server) artifactScope(a *model.Artifact) (model.Scope, error) {
+	_, scope, err := s.envItem(a.ProjectEnvItemID)
+	return scope, err
+}
+
+func (s *Server) listArtifacts(c *call) error {
+	var q ArtifactQuery
+	if err := c.decodeQuery(&q); err != nil {
+		return err
+	}
+	items, page, err := s.artifacts(c.id, q)
+	if err != nil {
+		return err
+	}
+	return c.page(items, page)
+}
+
+// artifacts 支持按 project_env_item_id 与 build_info_id 筛选
+func (s *Server) artifacts(id *auth.Identity, q ArtifactQuery) ([]Artifact, Page, error) {
+	cond := &model.Artifact{ProjectEnvItemID: q.ProjectEnvItemID, BuildInfoID: q.BuildInfoID}
+	if cond.BuildInfoID != 0 && cond.ProjectEnvItemID == 0 {
+		b, err := s.store.Builds().Get(cond.BuildInfoID)
+		if err != nil {
+			return nil, Page{}, fmt.Errorf("构建%d不存在\n%w", cond.BuildInfoID, err)
+		}
+		cond.ProjectEnvItemID = b.ProjectEnvItemID
+	}
+	scope, err := s.artifactScope(cond)
+	if err != nil {
+		return nil, Page{}, err
+	}
+	if err := s.authorize(id, CategoryArtifact, ActionRead, 0, scope); err != nil {
+		return nil, Page{}, err
+	}
+	var artifacts []model.Artifact
+	page, err := s.list(cond, q.ListQuery, Artifact{}, &artifacts)
+	if err != nil {
+		return nil, Page{}, err
+	}
+	items := make([]Artifact, 0, len(artifacts))
+	for i := range artifacts {
+		items = append(items, newArtifact(&artifacts[i]))
+	}
+	return items, page, nil
+}
+
+func (s *Server) createArtifact(c *call) error {
+	var v Artifact
+	if err := c.decode(&v); err != nil {
+		return err
+	}
+	a, err := s.addArtifact(c.id, v)
+	if err != nil {
+		return err
+	}
+	return c.json(http.StatusCreated, a)
+}
+
+func (s *Server) addArtifact(id *auth.Identity, v Artifact) (Artifact, error) {
+	if v.Name == "" {
+		return Artifact{}, badRequest(errors.New("制品需指定name"))
+	}
+	a := new(model.Artifact)
+	v.apply(a)
+	if v.BuildInfoID != 0 {
+		b, err := s.store.Builds().Get(v.BuildInfoID)
+		if err != nil {
+			return Artifact{}, badRequest(fmt.Errorf("构建%d不存在", v.BuildInfoID))
+		}
+		a.BuildInfoID, a.ProjectEnvItemID = b.ID, b.ProjectEnvItemID
+	}
+	scope, err := s.artifactScope(a)
+	if err != nil {
+		return Artifact{}, err
+	}
+	if err := s.authorize(id, CategoryArtifact, ActionCreate, 0, scope); err != nil {
+		return Artifact{}, err
+	}
+	if err := s.store.Artifacts().Create(a); err != nil {
+		return Artifact{}, fmt.Errorf("登记制品%s失败\n%w", a.Name, err)
+	}
+	return newArtifact(a), nil
+}
+
+func (s *Server) artifact(id *auth.Identity, aid uint, action string) (*model.Artifact, error) {
+	a, err := s.store.Artifacts().Get(aid)
+	if err != nil {
+		return nil, fmt.Errorf("制品%d不存在\n%w", aid, err)
+	}
+	scope, err := s.artifactScope(a)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorize(id, CategoryArtifact, action, a.ID, scope); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (s *Server) pathArtifact(c *call, action string) (*model.Artifact, error) {
+	id, err := c.uint("id")
+	if err != nil {
+		return nil, err
+	}
+	return s.artifact(c.id, id, action)
+}
+
+func (s *Server) getArtifact(c *call) error {
+	a, err := s.pathArtifact(c, ActionRead)
+	if err != nil {
+		return err
+	}
+	return c.json(http.StatusOK, newArtifact(a))
+}
+
+func (s *Server) updateArtifact(c *call) error {
+	a, err := s.pathArtifact(c, ActionUpdate)
+	if err != nil {
+		return err
+	}
+	v := newArtifact(a)
+	if err := c.decode(&v); err != nil {
+		return err
+	}
+	if v.BuildInfoID != a.BuildInfoID || v.ProjectEnvItemID != a.ProjectEnvItemID {
+		return badRequest(errors.New("制品的build_info_id与project_env_item_id不能修改"))
+	}
+	v.apply(a)
+	if err := s.store.Artifacts().Save(a); err != nil {
+		return fmt.Errorf("制品%d数据更新失败\n%w", a.ID, err)
+	}
+	return c.json(http.StatusOK, newArtifact(a))
+}
+
+func (s *Server) deleteArtifact(c *call) error {
+	a, err := s.pathArtifact(c, ActionDelete)
+	if err != nil {
+		return err
+	}
+	if err := s.store.Artifacts().Delete(a.ID); err != nil {
+		return fmt.Errorf("删除制品%d失败\n%w", a.ID, err)
+	}
+	return c.noContent()
+}
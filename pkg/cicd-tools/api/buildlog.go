@@ -0,0 +1,176 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"devops/cicd-tools/pkg/cicd-tools/auth"
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+// watchInterval 等待构建变化时重新读取存储的间隔, 用于发现其它进程 (如命令行) 所做的修改,
+// 通过本服务所做的修改会立即推送
+const watchInterval = 2 * time.Second
+
+// BuildLog 构建日志中的一行, id 按输出顺序递增
+type BuildLog struct {
+	ID        uint      `json:"id" api:"readonly"`
+	BuildID   uint      `json:"build_id" api:"readonly"`
+	Line      string    `json:"line"`
+	CreatedAt time.Time `json:"created_at" api:"readonly"`
+}
+
+// LogLines 追加的日志, 包含换行的元素按行拆分
+type LogLines struct {
+	Lines []string `json:"lines"`
+}
+
+// 构建事件的类型
+const (
+	BuildEventState = "state"
+	BuildEventLog   = "log"
+)
+
+// BuildEvent 订阅构建时推送的事件, type 为 state 时 build 为构建的最新数据, 为 log 时 log 为新的一行日志
+type BuildEvent struct {
+	Type  string    `json:"type"`
+	Build *Build    `json:"build,omitempty"`
+	Log   *BuildLog `json:"log,omitempty"`
+}
+
+func newBuildLog(l *model.BuildLog) BuildLog {
+	return BuildLog{ID: l.ID, BuildID: l.BuildInfoID, Line: l.Line, CreatedAt: l.CreatedAt}
+}
+
+func (s *Server) listBuildLogs(c *call) error {
+	id, err := c.uint("id")
+	if err != nil {
+		return err
+	}
+	var q BuildLogQuery
+	if err := c.decodeQuery(&q); err != nil {
+		return err
+	}
+	items, err := s.buildLogs(c.id, id, q.After)
+	if err != nil {
+		return err
+	}
+	return c.list(items)
+}
+
+func (s *Server) buildLogs(id *auth.Identity, bid uint, after uint) ([]BuildLog, error) {
+	b, err := s.build(id, bid, ActionRead)
+	if err != nil {
+		return nil, err
+	}
+	logs, err := s.store.Builds().Logs(b.ID, after)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]BuildLog, 0, len(logs))
+	for i := range logs {
+		items = append(items, newBuildLog(&logs[i]))
+	}
+	return items, nil
+}
+
+func (s *Server) appendBuildLog(c *call) error {
+	id, err := c.uint("id")
+	if err != nil {
+		return err
+	}
+	var v LogLines
+	if err := c.decode(&v); err != nil {
+		return err
+	}
+	if err := s.addBuildLog(c.id, id, v.Lines); err != nil {
+		return err
+	}
+	return c.noContent()
+}
+
+// addBuildLog 需要构建的 update 权限, 追加后通知等待该构建的订阅者
+func (s *Server) addBuildLog(id *auth.Identity, bid uint, lines []string) error {
+	b, err := s.build(id, bid, ActionUpdate)
+	if err != nil {
+		return err
+	}
+	if b.Finished() {
+		return conflict(fmt.Errorf("构建%d已结束, 不能追加日志", b.ID))
+	}
+	var logs []model.BuildLog
+	for _, value := range lines {
+		for _, line := range strings.Split(strings.TrimSuffix(value, "\n"), "\n") {
+			logs = append(logs, model.BuildLog{BuildInfoID: b.ID, Line: strings.TrimSuffix(line, "\r")})
+		}
+	}
+	if err := s.store.Builds().AddLogs(logs); err != nil {
+		return fmt.Errorf("追加构建%d的日志失败\n%w", b.ID, err)
+	}
+	s.events.notify(b.ID)
+	return nil
+}
+
+// watchBuild 先推送构建的当前数据与 after 之后的日志, 之后在状态变化时推送构建的最新数据, 并推送新的日志,
+// 构建结束且日志推送完后返回 nil, 构建被删除时返回查询不到记录的错误
+func (s *Server) watchBuild(ctx context.Context, id *auth.Identity, bid uint, after uint, send func(*BuildEvent) error) error {
+	b, err := s.build(id, bid, ActionRead)
+	if err != nil {
+		return err
+	}
+	changed, cancel := s.events.subscribe(b.ID)
+	defer cancel()
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	state, sent := "", false
+	for {
+		if !sent || b.BuildState != state {
+			v := newBuild(b)
+			if err := send(&BuildEvent{Type: BuildEventState, Build: &v}); err != nil {
+				return err
+			}
+			state, sent = b.BuildState, true
+		}
+		logs, err := s.store.Builds().Logs(b.ID, after)
+		if err != nil {
+			return err
+		}
+		for i := range logs {
+			l := newBuildLog(&logs[i])
+			if err := send(&BuildEvent{Type: BuildEventLog, Log: &l}); err != nil {
+				return err
+			}
+			after = l.ID
+		}
+		if b.Finished() {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		case <-ticker.C:
+		}
+		if b, err = s.store.Builds().Get(bid); err != nil {
+			return fmt.Errorf("构建%d不存在\n%w", bid, err)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package api
+
+import (
+	"sync"
+)
+
+// hub 通知等待构建变化的订阅者, 只传递构建 ID, 订阅者收到通知后从存储中读取最新的状态与日志,
+// 通知不会阻塞, 订阅者来不及处理的多次通知合并为一次
+type hub struct {
+	mu   sync.Mutex
+	subs map[uint]map[chan struct{}]struct{}
+}
+
+func newHub() *hub {
+	return &hub{subs: make(map[uint]map[chan struct{}]struct{})}
+}
+
+// subscribe 订阅构建 id 的变化, 不再需要时调用返回的 cancel
+func (h *hub) subscribe(id uint) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs[id] == nil {
+		h.subs[id] = make(map[chan struct{}]struct{})
+	}
+	h.subs[id][ch] = struct{}{}
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subs[id], ch)
+		if len(h.subs[id]) == 0 {
+			delete(h.subs, id)
+		}
+	}
+}
+
+func (h *hub) notify(id uint) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs[id] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
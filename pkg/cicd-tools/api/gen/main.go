@@ -0,0 +1,116 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// gen 根据 api.GRPCDescriptor 生成 gRPC 接口的 .proto 文件, 在 api 目录下通过 go generate 执行
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"devops/cicd-tools/pkg/cicd-tools/api"
+)
+
+// comment 文件的说明, 即 JSON 编码的传输约定
+const comment = `// Code generated by go run ./gen; DO NOT EDIT.
+
+// %s 的接口约定. 消息以 JSON 编码传输, 客户端需使用 content-subtype "%s",
+// 即 Content-Type: application/grpc+json (Go 中为 grpc.CallContentSubtype("%s")), 不支持 protobuf 二进制编码;
+// 字段按 json_name 匹配, 字段编号只用于描述, 未设置的字段取零值; 整数以 JSON 数字传输,
+// google.protobuf.Timestamp 为 RFC 3339 字符串. 令牌通过元数据 authorization: Bearer <token> 传递,
+// 鉴权规则与 HTTP 接口相同. 服务端注册了 gRPC 反射, 可以通过反射查询本文件描述的服务与消息.
+`
+
+func main() {
+	if err := generate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func generate() error {
+	file := api.GRPCDescriptor()
+	header, err := ioutil.ReadFile("grpc.go")
+	if err != nil {
+		return err
+	}
+	var w bytes.Buffer
+	// 沿用 grpc.go 的许可证声明
+	w.Write(header[:bytes.Index(header, []byte("*/"))+3])
+	w.WriteString("\n")
+	fmt.Fprintf(&w, comment, api.GRPCService, api.GRPCCodec, api.GRPCCodec)
+	fmt.Fprintf(&w, "\nsyntax = %q;\n\npackage %s;\n", file.GetSyntax(), file.GetPackage())
+	if len(file.Dependency) > 0 {
+		w.WriteString("\n")
+		for _, value := range file.Dependency {
+			fmt.Fprintf(&w, "import %q;\n", value)
+		}
+	}
+	prefix := "." + file.GetPackage() + "."
+	for _, service := range file.Service {
+		fmt.Fprintf(&w, "\nservice %s {\n", service.GetName())
+		for _, m := range service.Method {
+			stream := ""
+			if m.GetServerStreaming() {
+				stream = "stream "
+			}
+			fmt.Fprintf(&w, "  rpc %s(%s) returns (%s%s);\n", m.GetName(), typeName(m.GetInputType(), prefix), stream, typeName(m.GetOutputType(), prefix))
+		}
+		w.WriteString("}\n")
+	}
+	for _, msg := range file.MessageType {
+		fmt.Fprintf(&w, "\nmessage %s {", msg.GetName())
+		if len(msg.Field) == 0 {
+			w.WriteString("}\n")
+			continue
+		}
+		w.WriteString("\n")
+		for _, f := range msg.Field {
+			w.WriteString("  ")
+			if f.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REPEATED {
+				w.WriteString("repeated ")
+			}
+			fmt.Fprintf(&w, "%s %s = %d [json_name = %q];\n", fieldType(f, prefix), f.GetName(), f.GetNumber(), f.GetJsonName())
+		}
+		w.WriteString("}\n")
+	}
+	output := filepath.Join("proto", filepath.FromSlash(api.GRPCProtoFile))
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(output, w.Bytes(), 0644)
+}
+
+// typeName 同一包中的消息省略包名
+func typeName(name, prefix string) string {
+	if strings.HasPrefix(name, prefix) {
+		return strings.TrimPrefix(name, prefix)
+	}
+	return strings.TrimPrefix(name, ".")
+}
+
+func fieldType(f *descriptorpb.FieldDescriptorProto, prefix string) string {
+	if f.GetType() == descriptorpb.FieldDescriptorProto_TYPE_MESSAGE {
+		return typeName(f.GetTypeName(), prefix)
+	}
+	return strings.ToLower(strings.TrimPrefix(f.GetType().String(), "TYPE_"))
+}
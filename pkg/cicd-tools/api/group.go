@@ -0,0 +1,249 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+// Group 的 source 与时间字段只读
+type Group struct {
+	ID        uint      `json:"id" api:"readonly" column:"id"`
+	Name      string    `json:"name" column:"group_name"`
+	Intro     string    `json:"intro" column:"intro"`
+	Source    string    `json:"source" api:"readonly" column:"source"`
+	CreatedAt time.Time `json:"created_at" api:"readonly" column:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" api:"readonly" column:"updated_at"`
+}
+
+func newGroup(g *model.Group) Group {
+	return Group{ID: g.ID, Name: g.Name, Intro: g.Intro, Source: g.Source, CreatedAt: g.CreatedAt, UpdatedAt: g.UpdatedAt}
+}
+
+func newGroups(groups []model.Group) []Group {
+	items := make([]Group, 0, len(groups))
+	for i := range groups {
+		items = append(items, newGroup(&groups[i]))
+	}
+	return items
+}
+
+func (s *Server) groupRoutes() {
+	s.routes.add(Operation{Method: http.MethodGet, Path: "/groups", ID: "ListGroups", Summary: "查看组", Query: ListQuery{}, Response: []Group{}}, s.listGroups)
+	s.routes.add(Operation{Method: http.MethodPost, Path: "/groups", ID: "CreateGroup", Summary: "创建组", Body: Group{}, Response: Group{}, Status: http.StatusCreated}, s.createGroup)
+	s.routes.add(Operation{Method: http.MethodGet, Path: "/groups/{id}", ID: "GetGroup", Summary: "查看组详情", Response: Group{}}, s.getGroup)
+	s.routes.add(Operation{Method: http.MethodPut, Path: "/groups/{id}", ID: "UpdateGroup", Summary: "更新组", Body: Group{}, Response: Group{}}, s.updateGroup)
+	s.routes.add(Operation{Method: http.MethodDelete, Path: "/groups/{id}", ID: "DeleteGroup", Summary: "删除组"}, s.deleteGroup)
+	s.routes.add(Operation{Method: http.MethodGet, Path: "/groups/{id}/users", ID: "ListGroupUsers", Summary: "查看组成员", Query: ListQuery{}, Response: []User{}}, s.groupUsers)
+	s.routes.add(Operation{Method: http.MethodGet, Path: "/groups/{id}/roles", ID: "ListGroupBindings", Summary: "查看组的角色绑定", Query: ListQuery{}, Response: []Binding{}}, s.groupBindings)
+	s.routes.add(Operation{Method: http.MethodPost, Path: "/groups/{id}/roles", ID: "AddGroupBinding", Summary: "为组绑定角色", Body: Binding{}, Response: Binding{}, Status: http.StatusCreated}, s.addGroupBinding)
+	s.routes.add(Operation{Method: http.MethodDelete, Path: "/groups/{id}/roles/{binding_id}", ID: "RemoveGroupBinding", Summary: "解除组的角色绑定"}, s.removeGroupBinding)
+}
+
+func (s *Server) listGroups(c *call) error {
+	var q ListQuery
+	if err := c.decodeQuery(&q); err != nil {
+		return err
+	}
+	if err := c.authorize(CategoryGroup, ActionRead, 0, model.Scope{}); err != nil {
+		return err
+	}
+	var groups []model.Group
+	page, err := s.list(&model.Group{}, q, Group{}, &groups)
+	if err != nil {
+		return err
+	}
+	return c.page(newGroups(groups), page)
+}
+
+func (s *Server) createGroup(c *call) error {
+	if err := c.authorize(CategoryGroup, ActionCreate, 0, model.Scope{}); err != nil {
+		return err
+	}
+	var v Group
+	if err := c.decode(&v); err != nil {
+		return err
+	}
+	if v.Name == "" {
+		return badRequest(errors.New("组需指定name"))
+	}
+	if _, err := s.store.Groups().First(&model.Group{Name: v.Name}); err == nil {
+		return conflict(fmt.Errorf("组%s已存在", v.Name))
+	}
+	g := &model.Group{Name: v.Name, Intro: v.Intro}
+	if err := s.store.Groups().Create(g); err != nil {
+		return fmt.Errorf("创建组%s失败\n%w", v.Name, err)
+	}
+	return c.json(http.StatusCreated, newGroup(g))
+}
+
+// group 检查权限后读取组
+func (s *Server) group(c *call, id uint, action string) (*model.Group, error) {
+	if err := c.authorize(CategoryGroup, action, id, model.Scope{}); err != nil {
+		return nil, err
+	}
+	g, err := s.store.Groups().Get(id)
+	if err != nil {
+		return nil, fmt.Errorf("组%d不存在\n%w", id, err)
+	}
+	return g, nil
+}
+
+// pathGroup 读取路径中的组
+func (s *Server) pathGroup(c *call, action string) (*model.Group, error) {
+	id, err := c.uint("id")
+	if err != nil {
+		return nil, err
+	}
+	return s.group(c, id, action)
+}
+
+func (s *Server) getGroup(c *call) error {
+	g, err := s.pathGroup(c, ActionRead)
+	if err != nil {
+		return err
+	}
+	return c.json(http.StatusOK, newGroup(g))
+}
+
+func (s *Server) updateGroup(c *call) error {
+	g, err := s.pathGroup(c, ActionUpdate)
+	if err != nil {
+		return err
+	}
+	v := newGroup(g)
+	if err := c.decode(&v); err != nil {
+		return err
+	}
+	if v.Name != g.Name {
+		if _, err := s.store.Groups().First(&model.Group{Name: v.Name}); err == nil {
+			return conflict(fmt.Errorf("组%s已存在", v.Name))
+		}
+	}
+	g.Name, g.Intro = v.Name, v.Intro
+	if err := s.store.Groups().Save(g); err != nil {
+		return fmt.Errorf("组%s数据更新失败\n%w", g.Name, err)
+	}
+	return c.json(http.StatusOK, newGroup(g))
+}
+
+func (s *Server) deleteGroup(c *call) error {
+	g, err := s.pathGroup(c, ActionDelete)
+	if err != nil {
+		return err
+	}
+	if err := s.store.Groups().Delete(g.ID); err != nil {
+		return fmt.Errorf("删除组%s失败\n%w", g.Name, err)
+	}
+	return c.noContent()
+}
+
+func (s *Server) groupUsers(c *call) error {
+	var q ListQuery
+	if err := c.decodeQuery(&q); err != nil {
+		return err
+	}
+	g, err := s.pathGroup(c, ActionRead)
+	if err != nil {
+		return err
+	}
+	var users []model.User
+	page, err := s.listVia(model.UsersOfGroup(g.ID), &model.User{}, q, User{}, &users)
+	if err != nil {
+		return err
+	}
+	items := make([]User, 0, len(users))
+	for i := range users {
+		items = append(items, newUser(&users[i]))
+	}
+	return c.page(items, page)
+}
+
+func (s *Server) groupBindings(c *call) error {
+	var q ListQuery
+	if err := c.decodeQuery(&q); err != nil {
+		return err
+	}
+	g, err := s.pathGroup(c, ActionRead)
+	if err != nil {
+		return err
+	}
+	var rows []model.GroupRole
+	page, err := s.list(&model.GroupRole{GroupID: g.ID}, q, Binding{}, &rows)
+	if err != nil {
+		return err
+	}
+	items := make([]Binding, 0, len(rows))
+	for _, row := range rows {
+		b, err := s.binding(row.ID, row.RoleID, row.ProjectID, row.ProjectEnvID, row.ExpiresAt)
+		if err != nil {
+			return err
+		}
+		items = append(items, b)
+	}
+	return c.page(items, page)
+}
+
+func (s *Server) addGroupBinding(c *call) error {
+	g, err := s.pathGroup(c, ActionRead)
+	if err != nil {
+		return err
+	}
+	b, projectEnvID, err := s.bindRequest(c)
+	if err != nil {
+		return err
+	}
+	gr := &model.GroupRole{GroupID: g.ID, RoleID: b.RoleID, ProjectID: b.ProjectID, ProjectEnvID: projectEnvID, ExpiresAt: b.ExpiresAt}
+	if err := s.store.Groups().AddRoleBinding(gr); err != nil {
+		return fmt.Errorf("组%s绑定角色%d时发生错误\n%w", g.Name, b.RoleID, err)
+	}
+	b.ID = gr.ID
+	return c.json(http.StatusCreated, b)
+}
+
+func (s *Server) removeGroupBinding(c *call) error {
+	g, err := s.pathGroup(c, ActionRead)
+	if err != nil {
+		return err
+	}
+	id, err := c.uint("binding_id")
+	if err != nil {
+		return err
+	}
+	rows, err := s.store.Groups().RoleBindings(g.ID)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if row.ID != id {
+			continue
+		}
+		if err := s.unbind(c, row.RoleID, row.ProjectID, row.ProjectEnvID); err != nil {
+			return err
+		}
+		if err := s.store.Groups().RemoveRoleBinding(id); err != nil {
+			return fmt.Errorf("组%s解除角色绑定%d失败\n%w", g.Name, id, err)
+		}
+		return c.noContent()
+	}
+	return fmt.Errorf("组%s没有角色绑定%d\n%w", g.Name, id, model.ErrNotFound)
+}
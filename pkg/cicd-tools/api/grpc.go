@@ -0,0 +1,311 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package api
+
+//go:generate go run ./gen
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+
+	"devops/cicd-tools/pkg/cicd-tools/auth"
+	"devops/cicd-tools/pkg/cicd-tools/model"
+	"devops/cicd-tools/pkg/util/logger"
+)
+
+// GRPCService 构建与制品的 gRPC 服务, 消息以 JSON 编码, 结构与 HTTP 接口相同,
+// 客户端需使用 content-subtype GRPCCodec, 即 Content-Type: application/grpc+json;
+// 令牌通过元数据 authorization: Bearer <token> 传递, 鉴权规则与 HTTP 接口相同
+const (
+	GRPCService = "cicd.v1.BuildService"
+	GRPCCodec   = "json"
+)
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return GRPCCodec
+}
+
+// gRPC 接口的请求与响应, 其余消息使用 HTTP 接口的类型
+type BuildRequest struct {
+	ID uint `json:"id"`
+}
+
+type ArtifactRequest struct {
+	ID uint `json:"id"`
+}
+
+// BuildLogRequest ListBuildLogs 与 WatchBuild 的请求, after 为已读取的最后一行日志的 ID
+type BuildLogRequest struct {
+	BuildID uint `json:"build_id"`
+	After   uint `json:"after"`
+}
+
+type AppendBuildLogRequest struct {
+	BuildID uint     `json:"build_id"`
+	Lines   []string `json:"lines"`
+}
+
+type BuildList struct {
+	Items []Build `json:"items"`
+	Page
+}
+
+type BuildLogList struct {
+	Items []BuildLog `json:"items"`
+}
+
+type ArtifactList struct {
+	Items []Artifact `json:"items"`
+	Page
+}
+
+type Empty struct{}
+
+// grpcMethod 一元方法, request 创建请求消息, response 为响应消息的类型, handle 调用前已校验令牌
+type grpcMethod struct {
+	name     string
+	request  func() interface{}
+	response interface{}
+	handle   func(s *Server, id *auth.Identity, req interface{}) (interface{}, error)
+}
+
+var grpcMethods = []grpcMethod{
+	{"GetBuild", func() interface{} { return new(BuildRequest) }, Build{}, func(s *Server, id *auth.Identity, req interface{}) (interface{}, error) {
+		b, err := s.build(id, req.(*BuildRequest).ID, ActionRead)
+		if err != nil {
+			return nil, err
+		}
+		v := newBuild(b)
+		return &v, nil
+	}},
+	{"ListBuilds", func() interface{} { return new(BuildQuery) }, BuildList{}, func(s *Server, id *auth.Identity, req interface{}) (interface{}, error) {
+		items, page, err := s.builds(id, *req.(*BuildQuery))
+		if err != nil {
+			return nil, err
+		}
+		return &BuildList{Items: items, Page: page}, nil
+	}},
+	{"CreateBuild", func() interface{} { return new(Build) }, Build{}, func(s *Server, id *auth.Identity, req interface{}) (interface{}, error) {
+		v, err := s.addBuild(id, *req.(*Build))
+		if err != nil {
+			return nil, err
+		}
+		return &v, nil
+	}},
+	{"UpdateBuild", func() interface{} { return new(Build) }, Build{}, func(s *Server, id *auth.Identity, req interface{}) (interface{}, error) {
+		v := req.(*Build)
+		b, err := s.build(id, v.ID, ActionUpdate)
+		if err != nil {
+			return nil, err
+		}
+		saved, err := s.saveBuild(b, *v)
+		if err != nil {
+			return nil, err
+		}
+		return &saved, nil
+	}},
+	{"ListBuildLogs", func() interface{} { return new(BuildLogRequest) }, BuildLogList{}, func(s *Server, id *auth.Identity, req interface{}) (interface{}, error) {
+		r := req.(*BuildLogRequest)
+		items, err := s.buildLogs(id, r.BuildID, r.After)
+		if err != nil {
+			return nil, err
+		}
+		return &BuildLogList{Items: items}, nil
+	}},
+	{"AppendBuildLog", func() interface{} { return new(AppendBuildLogRequest) }, Empty{}, func(s *Server, id *auth.Identity, req interface{}) (interface{}, error) {
+		r := req.(*AppendBuildLogRequest)
+		if err := s.addBuildLog(id, r.BuildID, r.Lines); err != nil {
+			return nil, err
+		}
+		return &Empty{}, nil
+	}},
+	{"GetArtifact", func() interface{} { return new(ArtifactRequest) }, Artifact{}, func(s *Server, id *auth.Identity, req interface{}) (interface{}, error) {
+		a, err := s.artifact(id, req.(*ArtifactRequest).ID, ActionRead)
+		if err != nil {
+			return nil, err
+		}
+		v := newArtifact(a)
+		return &v, nil
+	}},
+	{"ListArtifacts", func() interface{} { return new(ArtifactQuery) }, ArtifactList{}, func(s *Server, id *auth.Identity, req interface{}) (interface{}, error) {
+		items, page, err := s.artifacts(id, *req.(*ArtifactQuery))
+		if err != nil {
+			return nil, err
+		}
+		return &ArtifactList{Items: items, Page: page}, nil
+	}},
+	{"CreateArtifact", func() interface{} { return new(Artifact) }, Artifact{}, func(s *Server, id *auth.Identity, req interface{}) (interface{}, error) {
+		v, err := s.addArtifact(id, *req.(*Artifact))
+		if err != nil {
+			return nil, err
+		}
+		return &v, nil
+	}},
+}
+
+// GRPCServer 创建提供 GRPCService 的 gRPC 服务, 与 HTTP 接口共用存储、认证与构建事件,
+// WatchBuild 可以收到通过 HTTP 接口所做的修改; 同时注册 gRPC 反射, 服务描述见 GRPCDescriptor
+func (s *Server) GRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	desc := grpc.ServiceDesc{
+		ServiceName: GRPCService,
+		HandlerType: (*interface{})(nil),
+		Metadata:    GRPCProtoFile,
+		Streams: []grpc.StreamDesc{
+			{StreamName: "WatchBuild", Handler: watchBuild, ServerStreams: true},
+		},
+	}
+	for _, value := range grpcMethods {
+		desc.Methods = append(desc.Methods, value.desc())
+	}
+	srv := grpc.NewServer(opts...)
+	srv.RegisterService(&desc, s)
+	if err := registerGRPCFile(); err != nil {
+		logger.Error(fmt.Errorf("登记gRPC服务描述失败, 反射无法返回消息结构\n%w", err))
+	}
+	reflection.Register(srv)
+	return srv
+}
+
+func (m grpcMethod) desc() grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: m.name,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			req := m.request()
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				s := srv.(*Server)
+				id, err := s.grpcIdentity(ctx)
+				if err != nil {
+					return nil, err
+				}
+				resp, err := m.handle(s, id, req)
+				if err != nil {
+					return nil, grpcError(m.name, err)
+				}
+				return resp, nil
+			}
+			if interceptor == nil {
+				return handler(ctx, req)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + GRPCService + "/" + m.name}
+			return interceptor(ctx, req, info, handler)
+		},
+	}
+}
+
+// watchBuild 请求为 BuildLogRequest, 推送 BuildEvent, 构建结束后正常关闭流
+func watchBuild(srv interface{}, stream grpc.ServerStream) error {
+	s := srv.(*Server)
+	id, err := s.grpcIdentity(stream.Context())
+	if err != nil {
+		return err
+	}
+	var req BuildLogRequest
+	if err := stream.RecvMsg(&req); err != nil {
+		return err
+	}
+	err = s.watchBuild(stream.Context(), id, req.BuildID, req.After, func(e *BuildEvent) error {
+		return stream.SendMsg(e)
+	})
+	if err != nil {
+		return grpcError("WatchBuild", err)
+	}
+	return nil
+}
+
+// grpcIdentity 校验元数据 authorization 中的令牌
+func (s *Server) grpcIdentity(ctx context.Context) (*auth.Identity, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var token string
+	for _, value := range md.Get("authorization") {
+		if len(value) > 7 && strings.EqualFold(value[:7], "Bearer ") {
+			token = strings.TrimSpace(value[7:])
+		}
+	}
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "缺少访问令牌")
+	}
+	id, err := s.authn.Authenticate(token)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, firstLine(err))
+	}
+	return id, nil
+}
+
+var grpcCodes = map[int]codes.Code{
+	http.StatusBadRequest: codes.InvalidArgument,
+	http.StatusForbidden:  codes.PermissionDenied,
+	http.StatusNotFound:   codes.NotFound,
+	http.StatusConflict:   codes.FailedPrecondition,
+}
+
+// grpcError 与 HTTP 接口相同, 只返回错误的第一行, 未标注状态码的错误记录日志并返回不含细节的 Internal
+func grpcError(method string, err error) error {
+	var e *Error
+	switch {
+	case errors.As(err, &e):
+		code, ok := grpcCodes[e.Status]
+		if !ok {
+			code = codes.Unknown
+		}
+		return status.Error(code, firstLine(e.Err))
+	case errors.Is(err, model.ErrNotFound):
+		return status.Error(codes.NotFound, firstLine(err))
+	case errors.Is(err, model.ErrInvalidQuery):
+		return status.Error(codes.InvalidArgument, firstLine(err))
+	case errors.Is(err, model.ErrDuplicated):
+		return status.Error(grpcCodes[http.StatusConflict], firstLine(err))
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	logger.Error(fmt.Errorf("gRPC %s失败\n%w", method, err))
+	return status.Error(codes.Internal, auth.ErrInternal.Error())
+}
+
+func firstLine(err error) string {
+	return strings.SplitN(err.Error(), "\n", 2)[0]
+}
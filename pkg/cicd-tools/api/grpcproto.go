@@ -0,0 +1,173 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package api
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// GRPCProtoFile 服务描述的文件名, 与仓库中由 go generate 生成的 .proto 文件对应, 也是 gRPC 反射返回的文件名
+const GRPCProtoFile = "cicd/v1/build.proto"
+
+const timestampProto = "google/protobuf/timestamp.proto"
+
+// GRPCDescriptor 由 gRPC 方法的请求与响应类型生成服务描述, 消息按 json 标签生成字段并以 json_name 标注,
+// 嵌入结构体的字段展开到外层, time.Time 为 google.protobuf.Timestamp (两者的 JSON 编码均为 RFC 3339 字符串);
+// 消息以 JSON 编码传输, 字段编号只用于描述
+func GRPCDescriptor() *descriptorpb.FileDescriptorProto {
+	dot := strings.LastIndex(GRPCService, ".")
+	g := &protoGen{
+		pkg:  GRPCService[:dot],
+		file: &descriptorpb.FileDescriptorProto{Name: proto.String(GRPCProtoFile), Syntax: proto.String("proto3")},
+		seen: map[string]bool{},
+	}
+	g.file.Package = proto.String(g.pkg)
+	service := &descriptorpb.ServiceDescriptorProto{Name: proto.String(GRPCService[dot+1:])}
+	for _, m := range grpcMethods {
+		service.Method = append(service.Method, &descriptorpb.MethodDescriptorProto{
+			Name:       proto.String(m.name),
+			InputType:  proto.String(g.message(reflect.TypeOf(m.request()).Elem())),
+			OutputType: proto.String(g.message(reflect.TypeOf(m.response))),
+		})
+	}
+	service.Method = append(service.Method, &descriptorpb.MethodDescriptorProto{
+		Name:            proto.String("WatchBuild"),
+		InputType:       proto.String(g.message(reflect.TypeOf(BuildLogRequest{}))),
+		OutputType:      proto.String(g.message(reflect.TypeOf(BuildEvent{}))),
+		ServerStreaming: proto.Bool(true),
+	})
+	g.file.Service = []*descriptorpb.ServiceDescriptorProto{service}
+	return g.file
+}
+
+var grpcFile struct {
+	once sync.Once
+	err  error
+}
+
+// registerGRPCFile 将服务描述登记到 protoregistry.GlobalFiles, gRPC 反射从中查找服务与消息
+func registerGRPCFile() error {
+	grpcFile.once.Do(func() {
+		fd, err := protodesc.NewFile(GRPCDescriptor(), protoregistry.GlobalFiles)
+		if err != nil {
+			grpcFile.err = err
+			return
+		}
+		grpcFile.err = protoregistry.GlobalFiles.RegisterFile(fd)
+	})
+	return grpcFile.err
+}
+
+type protoGen struct {
+	pkg  string
+	file *descriptorpb.FileDescriptorProto
+	seen map[string]bool
+}
+
+// message 登记结构体对应的消息并返回其全名
+func (g *protoGen) message(t reflect.Type) string {
+	name := "." + g.pkg + "." + t.Name()
+	if g.seen[t.Name()] {
+		return name
+	}
+	g.seen[t.Name()] = true
+	msg := &descriptorpb.DescriptorProto{Name: proto.String(t.Name())}
+	g.file.MessageType = append(g.file.MessageType, msg)
+	g.fields(msg, t)
+	return name
+}
+
+func (g *protoGen) fields(msg *descriptorpb.DescriptorProto, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" || field.PkgPath != "" {
+			continue
+		}
+		if name == "" && field.Anonymous && field.Type.Kind() == reflect.Struct {
+			g.fields(msg, field.Type)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(int32(len(msg.Field) + 1)),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		}
+		ft := field.Type
+		if ft.Kind() == reflect.Slice {
+			f.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		g.fieldType(f, ft)
+		msg.Field = append(msg.Field, f)
+	}
+}
+
+var protoKinds = map[reflect.Kind]descriptorpb.FieldDescriptorProto_Type{
+	reflect.String:  descriptorpb.FieldDescriptorProto_TYPE_STRING,
+	reflect.Bool:    descriptorpb.FieldDescriptorProto_TYPE_BOOL,
+	reflect.Int:     descriptorpb.FieldDescriptorProto_TYPE_INT64,
+	reflect.Int8:    descriptorpb.FieldDescriptorProto_TYPE_INT32,
+	reflect.Int16:   descriptorpb.FieldDescriptorProto_TYPE_INT32,
+	reflect.Int32:   descriptorpb.FieldDescriptorProto_TYPE_INT32,
+	reflect.Int64:   descriptorpb.FieldDescriptorProto_TYPE_INT64,
+	reflect.Uint:    descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+	reflect.Uint8:   descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+	reflect.Uint16:  descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+	reflect.Uint32:  descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+	reflect.Uint64:  descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+	reflect.Float32: descriptorpb.FieldDescriptorProto_TYPE_FLOAT,
+	reflect.Float64: descriptorpb.FieldDescriptorProto_TYPE_DOUBLE,
+}
+
+func (g *protoGen) fieldType(f *descriptorpb.FieldDescriptorProto, t reflect.Type) {
+	switch {
+	case t == timeType:
+		f.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+		f.TypeName = proto.String(".google.protobuf.Timestamp")
+		for _, value := range g.file.Dependency {
+			if value == timestampProto {
+				return
+			}
+		}
+		g.file.Dependency = append(g.file.Dependency, timestampProto)
+	case t.Kind() == reflect.Struct:
+		f.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+		f.TypeName = proto.String(g.message(t))
+	default:
+		kind, ok := protoKinds[t.Kind()]
+		if !ok {
+			kind = descriptorpb.FieldDescriptorProto_TYPE_STRING
+		}
+		f.Type = kind.Enum()
+	}
+}
@@ -0,0 +1,161 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"devops/cicd-tools/pkg/cicd-tools/mirror"
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+// Ref 代码仓库镜像中的分支或标签, type 为 branch 或 tag
+type Ref struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Commit string `json:"commit"`
+}
+
+// Commit 解析得到的提交, 按分支或标签解析时 branch 或 tag 不为空
+type Commit struct {
+	Hash    string    `json:"hash"`
+	Branch  string    `json:"branch"`
+	Tag     string    `json:"tag"`
+	Date    time.Time `json:"date"`
+	Author  string    `json:"author"`
+	Email   string    `json:"email"`
+	Message string    `json:"message"`
+}
+
+// RefQuery fetch 为 true 时先获取更新, 镜像不存在时总是获取, 获取更新需要 repo:update 权限
+type RefQuery struct {
+	Fetch bool `json:"fetch" query:"fetch"`
+}
+
+// ResolveQuery ref 为分支、标签或提交散列
+type ResolveQuery struct {
+	Ref   string `json:"ref" query:"ref"`
+	Fetch bool   `json:"fetch" query:"fetch"`
+}
+
+func newRefs(refs []mirror.Ref) []Ref {
+	items := make([]Ref, 0, len(refs))
+	for _, value := range refs {
+		if value.Branch() != "" {
+			items = append(items, Ref{Name: value.Branch(), Type: "branch", Commit: value.Hash})
+		} else {
+			items = append(items, Ref{Name: value.Tag(), Type: "tag", Commit: value.Hash})
+		}
+	}
+	return items
+}
+
+func newCommit(c *model.CommitInfo) Commit {
+	return Commit{
+		Hash:    c.CommitHash,
+		Branch:  c.GitBranch,
+		Tag:     c.GitTag,
+		Date:    c.CommitDate,
+		Author:  c.CommitUser,
+		Email:   c.CommitUserEmail,
+		Message: c.CommitMessage,
+	}
+}
+
+// WithMirror 启用代码仓库镜像接口, 未启用时这些接口返回 503
+func (s *Server) WithMirror(m *mirror.Mirror) *Server {
+	s.mirror = m
+	return s
+}
+
+func (s *Server) mirrorRoutes() {
+	s.routes.add(Operation{Method: http.MethodPost, Path: "/repos/{id}/fetch", ID: "FetchRepo", Summary: "获取代码仓库的更新到本地镜像, 返回镜像中的分支与标签", Response: []Ref{}}, s.fetchRepo)
+	s.routes.add(Operation{Method: http.MethodGet, Path: "/repos/{id}/refs", ID: "ListRepoRefs", Summary: "查看代码仓库镜像中的分支与标签", Query: RefQuery{}, Response: []Ref{}}, s.listRepoRefs)
+	s.routes.add(Operation{Method: http.MethodGet, Path: "/repos/{id}/resolve", ID: "ResolveRepoRef", Summary: "将分支、标签或提交散列解析为提交", Query: ResolveQuery{}, Response: Commit{}}, s.resolveRepoRef)
+}
+
+// mirrorRepo 按 repo:read 鉴权后返回代码仓库, fetch 为 true 或镜像不存在时先获取更新, 获取更新需要 repo:update
+func (s *Server) mirrorRepo(c *call, fetch bool) (*model.GitRepo, error) {
+	if s.mirror == nil {
+		return nil, &Error{Status: http.StatusServiceUnavailable, Err: errors.New("未启用代码仓库镜像")}
+	}
+	r, err := s.repo(c, ActionRead)
+	if err != nil {
+		return nil, err
+	}
+	if fetch || !s.mirror.Exists(r.ID) {
+		if err := c.authorize(CategoryRepo, ActionUpdate, r.ID, model.Scope{}); err != nil {
+			return nil, err
+		}
+		if err := s.mirror.Fetch(c.r.Context(), r); err != nil {
+			if errors.Is(err, mirror.ErrNoURL) || errors.Is(err, mirror.ErrProtocol) || errors.Is(err, mirror.ErrKey) {
+				return nil, badRequest(err)
+			}
+			return nil, &Error{Status: http.StatusBadGateway, Err: err}
+		}
+	}
+	return r, nil
+}
+
+func (s *Server) fetchRepo(c *call) error {
+	r, err := s.mirrorRepo(c, true)
+	if err != nil {
+		return err
+	}
+	refs, err := s.mirror.Refs(c.r.Context(), r)
+	if err != nil {
+		return err
+	}
+	return c.list(newRefs(refs))
+}
+
+func (s *Server) listRepoRefs(c *call) error {
+	var q RefQuery
+	if err := c.decodeQuery(&q); err != nil {
+		return err
+	}
+	r, err := s.mirrorRepo(c, q.Fetch)
+	if err != nil {
+		return err
+	}
+	refs, err := s.mirror.Refs(c.r.Context(), r)
+	if err != nil {
+		return err
+	}
+	return c.list(newRefs(refs))
+}
+
+func (s *Server) resolveRepoRef(c *call) error {
+	var q ResolveQuery
+	if err := c.decodeQuery(&q); err != nil {
+		return err
+	}
+	if q.Ref == "" {
+		return badRequest(errors.New("查询参数ref不能为空"))
+	}
+	r, err := s.mirrorRepo(c, q.Fetch)
+	if err != nil {
+		return err
+	}
+	commit, err := s.mirror.Resolve(c.r.Context(), r, q.Ref)
+	if err != nil {
+		return err
+	}
+	return c.json(http.StatusOK, newCommit(commit))
+}
@@ -0,0 +1,201 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OpenAPIVersion 生成的文档遵循的 OpenAPI 版本
+const OpenAPIVersion = "3.0.3"
+
+// OpenAPI 由 Operations 生成 OpenAPI 文档, 结构体按 json 标签生成字段, 带 api:"readonly" 标签的字段为只读,
+// 指针字段可以为 null; 需要认证的接口使用 Bearer 令牌
+func OpenAPI() map[string]interface{} {
+	g := &openapi{schemas: map[string]interface{}{}}
+	paths := map[string]interface{}{}
+	for _, op := range Operations() {
+		item, ok := paths[op.Path].(map[string]interface{})
+		if !ok {
+			item = map[string]interface{}{}
+			paths[op.Path] = item
+		}
+		item[strings.ToLower(op.Method)] = g.operation(op)
+	}
+	g.schemas["Error"] = map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"error":        map[string]interface{}{"type": "string"},
+			"mfa_required": map[string]interface{}{"type": "boolean", "description": "登录时缺少多因素认证验证码"},
+		},
+		"required": []string{"error"},
+	}
+	return map[string]interface{}{
+		"openapi": OpenAPIVersion,
+		"info": map[string]interface{}{
+			"title":   "CICD Tools",
+			"version": strings.TrimPrefix(Prefix, "/api/"),
+		},
+		"servers":  []interface{}{map[string]interface{}{"url": Prefix}},
+		"security": []interface{}{map[string]interface{}{"bearer": []string{}}},
+		"paths":    paths,
+		"components": map[string]interface{}{
+			"schemas": g.schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearer": map[string]interface{}{"type": "http", "scheme": "bearer", "description": "访问令牌或个人访问令牌"},
+			},
+			"responses": map[string]interface{}{
+				"Error": map[string]interface{}{
+					"description": "请求无效 (400)、未认证 (401)、无权限 (403)、不存在 (404)、方法不支持 (405) 或冲突 (409)",
+					"content":     jsonContent(ref("Error")),
+				},
+			},
+		},
+	}
+}
+
+type openapi struct {
+	schemas map[string]interface{}
+}
+
+func (g *openapi) operation(op Operation) map[string]interface{} {
+	o := map[string]interface{}{
+		"operationId": op.ID,
+		"summary":     op.Summary,
+		"tags":        []string{strings.SplitN(strings.TrimPrefix(op.Path, "/"), "/", 2)[0]},
+	}
+	if op.Public {
+		o["security"] = []interface{}{}
+	}
+	var params []interface{}
+	for _, name := range op.Params() {
+		params = append(params, map[string]interface{}{
+			"name":     name,
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]interface{}{"type": "integer", "minimum": 1},
+		})
+	}
+	if op.Query != nil {
+		for _, field := range queryFields(reflect.TypeOf(op.Query)) {
+			params = append(params, map[string]interface{}{"name": field.Tag.Get("query"), "in": "query", "schema": g.schema(field.Type)})
+		}
+	}
+	if len(params) > 0 {
+		o["parameters"] = params
+	}
+	if op.Body != nil {
+		o["requestBody"] = map[string]interface{}{"content": jsonContent(g.schema(reflect.TypeOf(op.Body)))}
+	}
+	success := map[string]interface{}{"description": http.StatusText(op.status())}
+	if op.Response != nil {
+		t := reflect.TypeOf(op.Response)
+		schema := g.schema(t)
+		if t.Kind() == reflect.Slice {
+			properties := map[string]interface{}{"items": schema}
+			required := []string{"items"}
+			if op.Paged() {
+				properties["total"] = map[string]interface{}{"type": "integer", "description": "满足筛选条件的记录总数"}
+				properties["next_cursor"] = map[string]interface{}{"type": "string", "description": "下一页的游标, 没有下一页时不返回"}
+				required = append(required, "total")
+			}
+			schema = map[string]interface{}{
+				"type":       "object",
+				"properties": properties,
+				"required":   required,
+			}
+		}
+		success["content"] = jsonContent(schema)
+	}
+	o["responses"] = map[string]interface{}{
+		strconv.Itoa(op.status()): success,
+		"default":                 map[string]interface{}{"$ref": "#/components/responses/Error"},
+	}
+	return o
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schema 命名结构体登记到 components.schemas 并返回引用
+func (g *openapi) schema(t reflect.Type) map[string]interface{} {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Ptr:
+		schema := map[string]interface{}{}
+		for key, value := range g.schema(t.Elem()) {
+			schema[key] = value
+		}
+		schema["nullable"] = true
+		return schema
+	case t.Kind() == reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case t.Kind() == reflect.Struct:
+		if _, ok := g.schemas[t.Name()]; !ok {
+			g.schemas[t.Name()] = nil
+			g.schemas[t.Name()] = g.object(t)
+		}
+		return ref(t.Name())
+	case t.Kind() == reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case t.Kind() == reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case t.Kind() >= reflect.Uint && t.Kind() <= reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+func (g *openapi) object(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" || field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		schema := g.schema(field.Type)
+		if field.Tag.Get("api") == "readonly" {
+			if _, ok := schema["$ref"]; ok {
+				schema = map[string]interface{}{"allOf": []interface{}{schema}}
+			}
+			schema["readOnly"] = true
+		}
+		properties[name] = schema
+	}
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+func ref(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+func jsonContent(schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+}
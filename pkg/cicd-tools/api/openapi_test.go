@@ -0,0 +1,142 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestOpenAPI /openapi.json 中的接口与 Operations 一一对应, 引用的结构均已定义, 且每个接口都由路由表处理
+func TestOpenAPI(t *testing.T) {
+	ts := newTestServer(t)
+	w := httptest.NewRecorder()
+	ts.handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /openapi.json = %d", w.Code)
+	}
+	var doc struct {
+		Paths      map[string]map[string]json.RawMessage
+		Components struct {
+			Schemas map[string]json.RawMessage
+		}
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[string]bool{}
+	count := 0
+	for _, item := range doc.Paths {
+		count += len(item)
+	}
+	ops := Operations()
+	if count != len(ops) {
+		t.Errorf("document has %d operations, want %d", count, len(ops))
+	}
+	for _, op := range ops {
+		if seen[op.ID] {
+			t.Errorf("duplicate operation %s", op.ID)
+		}
+		seen[op.ID] = true
+		raw, ok := doc.Paths[op.Path][strings.ToLower(op.Method)]
+		if !ok {
+			t.Errorf("%s %s missing from document", op.Method, op.Path)
+			continue
+		}
+		var o struct {
+			OperationID string `json:"operationId"`
+			Parameters  []struct {
+				Name string
+				In   string
+			}
+			RequestBody *json.RawMessage `json:"requestBody"`
+			Responses   map[string]json.RawMessage
+		}
+		if err := json.Unmarshal(raw, &o); err != nil {
+			t.Fatal(err)
+		}
+		var params []string
+		for _, p := range o.Parameters {
+			if p.In == "path" {
+				params = append(params, p.Name)
+			}
+		}
+		if o.OperationID != op.ID || strings.Join(params, ",") != strings.Join(op.Params(), ",") ||
+			(o.RequestBody != nil) != (op.Body != nil) {
+			t.Errorf("%s %s = %s %v, want %s %v", op.Method, op.Path, o.OperationID, params, op.ID, op.Params())
+		}
+		if _, ok := o.Responses[strconv.Itoa(op.status())]; !ok {
+			t.Errorf("%s has no %d response", op.ID, op.status())
+		}
+	}
+
+	var all interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &all); err != nil {
+		t.Fatal(err)
+	}
+	for _, value := range refs(all) {
+		name := strings.TrimPrefix(value, "#/components/schemas/")
+		if name == value {
+			continue
+		}
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			t.Errorf("schema %s referenced but not defined", name)
+		}
+	}
+
+	// 认证接口由 auth 包处理, 其余接口按路径参数为 1 的地址应匹配到同一个路由
+	srv := NewServer(ts.store, ts.authn)
+	for _, op := range ops {
+		path := op.Path
+		for _, name := range op.Params() {
+			path = strings.Replace(path, "{"+name+"}", "1", 1)
+		}
+		if strings.HasPrefix(path, "/auth/") {
+			if status := ts.do("", op.Method, path, map[string]string{}, nil); status == http.StatusNotFound || status == http.StatusMethodNotAllowed {
+				t.Errorf("%s %s = %d", op.Method, path, status)
+			}
+			continue
+		}
+		if rt, _, _ := srv.routes.match(op.Method, path); rt == nil || rt.op.ID != op.ID {
+			t.Errorf("%s %s not routed to %s", op.Method, path, op.ID)
+		}
+	}
+}
+
+// refs 文档中所有 $ref 的取值
+func refs(v interface{}) []string {
+	var out []string
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			if s, ok := child.(string); ok && key == "$ref" {
+				out = append(out, s)
+			}
+			out = append(out, refs(child)...)
+		}
+	case []interface{}:
+		for _, child := range value {
+			out = append(out, refs(child)...)
+		}
+	}
+	return out
+}
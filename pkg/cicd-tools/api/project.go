@@ -0,0 +1,604 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+type Project struct {
+	ID    uint   `json:"id" api:"readonly" column:"id"`
+	Name  string `json:"name" column:"project"`
+	Intro string `json:"intro" column:"intro"`
+}
+
+type Env struct {
+	ID    uint   `json:"id" api:"readonly" column:"id"`
+	Name  string `json:"name" column:"env"`
+	Intro string `json:"intro" column:"intro"`
+}
+
+type Item struct {
+	ID       uint   `json:"id" api:"readonly" column:"id"`
+	Name     string `json:"name" column:"item"`
+	Category string `json:"category" column:"category"`
+	Language string `json:"language" column:"language"`
+	Tier     string `json:"tier" column:"tier"`
+	Intro    string `json:"intro" column:"intro"`
+}
+
+// EnvItem 项目环境中部署的应用, 构建、构建配置与制品都按 id 关联, 创建后不能修改
+type EnvItem struct {
+	ID            uint      `json:"id" api:"readonly"`
+	ProjectID     uint      `json:"project_id" api:"readonly"`
+	EnvID         uint      `json:"env_id"`
+	ItemID        uint      `json:"item_id"`
+	GitRepoID     uint      `json:"git_repo_id"`
+	BuildConfigID uint      `json:"build_config_id" api:"readonly"`
+	CreatedAt     time.Time `json:"created_at" api:"readonly"`
+}
+
+// EnvLink 与 ItemLink 为项目关联环境与应用的请求体
+type EnvLink struct {
+	EnvID uint `json:"env_id"`
+}
+
+type ItemLink struct {
+	ItemID uint `json:"item_id"`
+}
+
+func newProject(p *model.Project) Project {
+	return Project{ID: p.ID, Name: p.Name, Intro: p.Intro}
+}
+
+func newEnv(e *model.Env) Env {
+	return Env{ID: e.ID, Name: e.Name, Intro: e.Intro}
+}
+
+func newEnvs(envs []model.Env) []Env {
+	items := make([]Env, 0, len(envs))
+	for i := range envs {
+		items = append(items, newEnv(&envs[i]))
+	}
+	return items
+}
+
+func newItem(i *model.Item) Item {
+	return Item{ID: i.ID, Name: i.Name, Category: i.Category, Language: i.Language, Tier: i.Tier, Intro: i.Intro}
+}
+
+func newItems(items []model.Item) []Item {
+	values := make([]Item, 0, len(items))
+	for i := range items {
+		values = append(values, newItem(&items[i]))
+	}
+	return values
+}
+
+func newEnvItem(pei *model.ProjectEnvItem) EnvItem {
+	return EnvItem{
+		ID:            pei.ID,
+		ProjectID:     pei.ProjectID,
+		EnvID:         pei.EnvID,
+		ItemID:        pei.ItemID,
+		GitRepoID:     pei.GitRepoID,
+		BuildConfigID: pei.BuildConfigID,
+		CreatedAt:     pei.CreatedAt,
+	}
+}
+
+func (s *Server) projectRoutes() {
+	s.routes.add(Operation{Method: http.MethodGet, Path: "/projects", ID: "ListProjects", Summary: "查看项目", Query: ListQuery{}, Response: []Project{}}, s.listProjects)
+	s.routes.add(Operation{Method: http.MethodPost, Path: "/projects", ID: "CreateProject", Summary: "创建项目", Body: Project{}, Response: Project{}, Status: http.StatusCreated}, s.createProject)
+	s.routes.add(Operation{Method: http.MethodGet, Path: "/projects/{id}", ID: "GetProject", Summary: "查看项目详情", Response: Project{}}, s.getProject)
+	s.routes.add(Operation{Method: http.MethodPut, Path: "/projects/{id}", ID: "UpdateProject", Summary: "更新项目", Body: Project{}, Response: Project{}}, s.updateProject)
+	s.routes.add(Operation{Method: http.MethodDelete, Path: "/projects/{id}", ID: "DeleteProject", Summary: "删除项目"}, s.deleteProject)
+	s.routes.add(Operation{Method: http.MethodGet, Path: "/projects/{id}/envs", ID: "ListProjectEnvs", Summary: "查看项目关联的环境", Response: []Env{}}, s.projectEnvs)
+	s.routes.add(Operation{Method: http.MethodPost, Path: "/projects/{id}/envs", ID: "AddProjectEnv", Summary: "项目关联环境", Body: EnvLink{}}, s.addProjectEnv)
+	s.routes.add(Operation{Method: http.MethodDelete, Path: "/projects/{id}/envs/{env_id}", ID: "RemoveProjectEnv", Summary: "项目取消关联环境"}, s.removeProjectEnv)
+	s.routes.add(Operation{Method: http.MethodGet, Path: "/projects/{id}/items", ID: "ListProjectItems", Summary: "查看项目关联的应用", Response: []Item{}}, s.projectItems)
+	s.routes.add(Operation{Method: http.MethodPost, Path: "/projects/{id}/items", ID: "AddProjectItem", Summary: "项目关联应用", Body: ItemLink{}}, s.addProjectItem)
+	s.routes.add(Operation{Method: http.MethodDelete, Path: "/projects/{id}/items/{item_id}", ID: "RemoveProjectItem", Summary: "项目取消关联应用"}, s.removeProjectItem)
+	s.routes.add(Operation{Method: http.MethodGet, Path: "/projects/{id}/env-items", ID: "ListEnvItems", Summary: "查看项目环境中部署的应用", Response: []EnvItem{}}, s.envItems)
+	s.routes.add(Operation{Method: http.MethodPost, Path: "/projects/{id}/env-items", ID: "CreateEnvItem", Summary: "在项目环境中部署应用", Body: EnvItem{}, Response: EnvItem{}, Status: http.StatusCreated}, s.addEnvItem)
+
+	s.routes.add(Operation{Method: http.MethodGet, Path: "/envs", ID: "ListEnvs", Summary: "查看环境", Query: ListQuery{}, Response: []Env{}}, s.listEnvs)
+	s.routes.add(Operation{Method: http.MethodPost, Path: "/envs", ID: "CreateEnv", Summary: "创建环境", Body: Env{}, Response: Env{}, Status: http.StatusCreated}, s.createEnv)
+	s.routes.add(Operation{Method: http.MethodGet, Path: "/envs/{id}", ID: "GetEnv", Summary: "查看环境详情", Response: Env{}}, s.getEnv)
+	s.routes.add(Operation{Method: http.MethodPut, Path: "/envs/{id}", ID: "UpdateEnv", Summary: "更新环境", Body: Env{}, Response: Env{}}, s.updateEnv)
+	s.routes.add(Operation{Method: http.MethodDelete, Path: "/envs/{id}", ID: "DeleteEnv", Summary: "删除环境"}, s.deleteEnv)
+
+	s.routes.add(Operation{Method: http.MethodGet, Path: "/items", ID: "ListItems", Summary: "查看应用", Query: ListQuery{}, Response: []Item{}}, s.listItems)
+	s.routes.add(Operation{Method: http.MethodPost, Path: "/items", ID: "CreateItem", Summary: "创建应用", Body: Item{}, Response: Item{}, Status: http.StatusCreated}, s.createItem)
+	s.routes.add(Operation{Method: http.MethodGet, Path: "/items/{id}", ID: "GetItem", Summary: "查看应用详情", Response: Item{}}, s.getItem)
+	s.routes.add(Operation{Method: http.MethodPut, Path: "/items/{id}", ID: "UpdateItem", Summary: "更新应用", Body: Item{}, Response: Item{}}, s.updateItem)
+	s.routes.add(Operation{Method: http.MethodDelete, Path: "/items/{id}", ID: "DeleteItem", Summary: "删除应用"}, s.deleteItem)
+}
+
+func (s *Server) listProjects(c *call) error {
+	var q ListQuery
+	if err := c.decodeQuery(&q); err != nil {
+		return err
+	}
+	if err := c.authorize(CategoryProject, ActionRead, 0, model.Scope{}); err != nil {
+		return err
+	}
+	var projects []model.Project
+	page, err := s.list(&model.Project{}, q, Project{}, &projects)
+	if err != nil {
+		return err
+	}
+	items := make([]Project, 0, len(projects))
+	for i := range projects {
+		items = append(items, newProject(&projects[i]))
+	}
+	return c.page(items, page)
+}
+
+func (s *Server) createProject(c *call) error {
+	if err := c.authorize(CategoryProject, ActionCreate, 0, model.Scope{}); err != nil {
+		return err
+	}
+	var v Project
+	if err := c.decode(&v); err != nil {
+		return err
+	}
+	if v.Name == "" {
+		return badRequest(errors.New("项目需指定name"))
+	}
+	if _, err := s.store.Projects().First(&model.Project{Name: v.Name}); err == nil {
+		return conflict(fmt.Errorf("项目%s已存在", v.Name))
+	}
+	p := &model.Project{Name: v.Name, Intro: v.Intro}
+	if err := s.store.Projects().Create(p); err != nil {
+		return fmt.Errorf("创建项目%s失败\n%w", p.Name, err)
+	}
+	return c.json(http.StatusCreated, newProject(p))
+}
+
+// project 以项目为范围鉴权后读取路径中的项目
+func (s *Server) project(c *call, action string) (*model.Project, error) {
+	id, err := c.uint("id")
+	if err != nil {
+		return nil, err
+	}
+	if err := c.authorize(CategoryProject, action, id, model.Scope{ProjectID: id}); err != nil {
+		return nil, err
+	}
+	p, err := s.store.Projects().Get(id)
+	if err != nil {
+		return nil, fmt.Errorf("项目%d不存在\n%w", id, err)
+	}
+	return p, nil
+}
+
+func (s *Server) getProject(c *call) error {
+	p, err := s.project(c, ActionRead)
+	if err != nil {
+		return err
+	}
+	return c.json(http.StatusOK, newProject(p))
+}
+
+func (s *Server) updateProject(c *call) error {
+	p, err := s.project(c, ActionUpdate)
+	if err != nil {
+		return err
+	}
+	v := newProject(p)
+	if err := c.decode(&v); err != nil {
+		return err
+	}
+	if v.Name != p.Name {
+		if _, err := s.store.Projects().First(&model.Project{Name: v.Name}); err == nil {
+			return conflict(fmt.Errorf("项目%s已存在", v.Name))
+		}
+	}
+	p.Name, p.Intro = v.Name, v.Intro
+	if err := s.store.Projects().Save(p); err != nil {
+		return fmt.Errorf("项目%s数据更新失败\n%w", p.Name, err)
+	}
+	return c.json(http.StatusOK, newProject(p))
+}
+
+func (s *Server) deleteProject(c *call) error {
+	p, err := s.project(c, ActionDelete)
+	if err != nil {
+		return err
+	}
+	if err := s.store.Projects().Delete(p.ID); err != nil {
+		return fmt.Errorf("删除项目%s失败\n%w", p.Name, err)
+	}
+	return c.noContent()
+}
+
+func (s *Server) projectEnvs(c *call) error {
+	p, err := s.project(c, ActionRead)
+	if err != nil {
+		return err
+	}
+	envs, err := s.store.Projects().Envs(p.ID)
+	if err != nil {
+		return err
+	}
+	return c.list(newEnvs(envs))
+}
+
+// addProjectEnv 关联与取消关联环境、应用需要项目的 project:update 权限
+func (s *Server) addProjectEnv(c *call) error {
+	p, err := s.project(c, ActionUpdate)
+	if err != nil {
+		return err
+	}
+	var body EnvLink
+	if err := c.decode(&body); err != nil {
+		return err
+	}
+	e, err := s.store.Projects().GetEnv(body.EnvID)
+	if err != nil {
+		return badRequest(fmt.Errorf("环境%d不存在", body.EnvID))
+	}
+	if _, err := s.store.Projects().AddEnv(p.ID, e.ID); err != nil {
+		return fmt.Errorf("项目%s关联环境%s失败\n%w", p.Name, e.Name, err)
+	}
+	return c.noContent()
+}
+
+// removeProjectEnv 环境中仍部署有应用时返回 409
+func (s *Server) removeProjectEnv(c *call) error {
+	p, err := s.project(c, ActionUpdate)
+	if err != nil {
+		return err
+	}
+	eid, err := c.uint("env_id")
+	if err != nil {
+		return err
+	}
+	if err := s.checkEnvItems(&model.ProjectEnvItem{ProjectID: p.ID, EnvID: eid}); err != nil {
+		return err
+	}
+	if err := s.store.Projects().RemoveEnv(p.ID, eid); err != nil {
+		return fmt.Errorf("项目%s取消关联环境%d失败\n%w", p.Name, eid, err)
+	}
+	return c.noContent()
+}
+
+func (s *Server) projectItems(c *call) error {
+	p, err := s.project(c, ActionRead)
+	if err != nil {
+		return err
+	}
+	items, err := s.store.Projects().Items(p.ID)
+	if err != nil {
+		return err
+	}
+	return c.list(newItems(items))
+}
+
+func (s *Server) addProjectItem(c *call) error {
+	p, err := s.project(c, ActionUpdate)
+	if err != nil {
+		return err
+	}
+	var body ItemLink
+	if err := c.decode(&body); err != nil {
+		return err
+	}
+	i, err := s.store.Projects().GetItem(body.ItemID)
+	if err != nil {
+		return badRequest(fmt.Errorf("应用%d不存在", body.ItemID))
+	}
+	if _, err := s.store.Projects().AddItem(p.ID, i.ID); err != nil {
+		return fmt.Errorf("项目%s关联应用%s失败\n%w", p.Name, i.Name, err)
+	}
+	return c.noContent()
+}
+
+func (s *Server) removeProjectItem(c *call) error {
+	p, err := s.project(c, ActionUpdate)
+	if err != nil {
+		return err
+	}
+	iid, err := c.uint("item_id")
+	if err != nil {
+		return err
+	}
+	if err := s.checkEnvItems(&model.ProjectEnvItem{ProjectID: p.ID, ItemID: iid}); err != nil {
+		return err
+	}
+	if err := s.store.Projects().RemoveItem(p.ID, iid); err != nil {
+		return fmt.Errorf("项目%s取消关联应用%d失败\n%w", p.Name, iid, err)
+	}
+	return c.noContent()
+}
+
+func (s *Server) checkEnvItems(cond *model.ProjectEnvItem) error {
+	values, err := s.store.Projects().FindEnvItems(cond)
+	if err != nil {
+		return err
+	}
+	if len(values) > 0 {
+		return conflict(fmt.Errorf("项目%d中仍有%d个应用部署记录, 不能取消关联", cond.ProjectID, len(values)))
+	}
+	return nil
+}
+
+func (s *Server) envItems(c *call) error {
+	p, err := s.project(c, ActionRead)
+	if err != nil {
+		return err
+	}
+	values, err := s.store.Projects().FindEnvItems(&model.ProjectEnvItem{ProjectID: p.ID})
+	if err != nil {
+		return err
+	}
+	items := make([]EnvItem, 0, len(values))
+	for i := range values {
+		items = append(items, newEnvItem(&values[i]))
+	}
+	return c.list(items)
+}
+
+// addEnvItem 在项目的环境中部署应用, 环境与应用需已关联到项目, 需要项目的 project:update 与该环境的 env:deploy
+func (s *Server) addEnvItem(c *call) error {
+	p, err := s.project(c, ActionUpdate)
+	if err != nil {
+		return err
+	}
+	var v EnvItem
+	if err := c.decode(&v); err != nil {
+		return err
+	}
+	e, err := s.store.Projects().GetEnv(v.EnvID)
+	if err != nil {
+		return badRequest(fmt.Errorf("环境%d不存在", v.EnvID))
+	}
+	i, err := s.store.Projects().GetItem(v.ItemID)
+	if err != nil {
+		return badRequest(fmt.Errorf("应用%d不存在", v.ItemID))
+	}
+	if _, err := s.store.Projects().ProjectEnv(p.ID, e.ID); err != nil {
+		return badRequest(fmt.Errorf("环境%s未关联到项目%s", e.Name, p.Name))
+	}
+	if err := s.authorizeDeploy(c.id, model.Scope{ProjectID: p.ID, EnvID: e.ID}); err != nil {
+		return err
+	}
+	linked, err := s.store.Projects().Items(p.ID)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, value := range linked {
+		found = found || value.ID == i.ID
+	}
+	if !found {
+		return badRequest(fmt.Errorf("应用%s未关联到项目%s", i.Name, p.Name))
+	}
+	if v.GitRepoID != 0 {
+		if _, err := s.store.Builds().GetRepo(v.GitRepoID); err != nil {
+			return badRequest(fmt.Errorf("代码仓库%d不存在", v.GitRepoID))
+		}
+	}
+	if _, err := s.store.Projects().FirstEnvItem(&model.ProjectEnvItem{ProjectID: p.ID, EnvID: e.ID, ItemID: i.ID}); err == nil {
+		return conflict(fmt.Errorf("项目%s的环境%s中已有应用%s", p.Name, e.Name, i.Name))
+	}
+	pei := &model.ProjectEnvItem{
+		Project:      p.Name,
+		ProjectID:    p.ID,
+		ProjectIntro: p.Intro,
+		Env:          e.Name,
+		EnvID:        e.ID,
+		EnvItro:      e.Intro,
+		Item:         i.Name,
+		ItemID:       i.ID,
+		ItemIntro:    i.Intro,
+		GitRepoID:    v.GitRepoID,
+	}
+	if err := s.store.Projects().FirstOrCreateEnvItem(pei); err != nil {
+		return fmt.Errorf("项目%s的环境%s部署应用%s失败\n%w", p.Name, e.Name, i.Name, err)
+	}
+	return c.json(http.StatusCreated, newEnvItem(pei))
+}
+
+func (s *Server) listEnvs(c *call) error {
+	var q ListQuery
+	if err := c.decodeQuery(&q); err != nil {
+		return err
+	}
+	if err := c.authorize(CategoryEnv, ActionRead, 0, model.Scope{}); err != nil {
+		return err
+	}
+	var envs []model.Env
+	page, err := s.list(&model.Env{}, q, Env{}, &envs)
+	if err != nil {
+		return err
+	}
+	return c.page(newEnvs(envs), page)
+}
+
+func (s *Server) createEnv(c *call) error {
+	if err := c.authorize(CategoryEnv, ActionCreate, 0, model.Scope{}); err != nil {
+		return err
+	}
+	var v Env
+	if err := c.decode(&v); err != nil {
+		return err
+	}
+	if v.Name == "" {
+		return badRequest(errors.New("环境需指定name"))
+	}
+	if _, err := s.store.Projects().FirstEnv(&model.Env{Name: v.Name}); err == nil {
+		return conflict(fmt.Errorf("环境%s已存在", v.Name))
+	}
+	e := &model.Env{Name: v.Name, Intro: v.Intro}
+	if err := s.store.Projects().FirstOrCreateEnv(e); err != nil {
+		return fmt.Errorf("创建环境%s失败\n%w", e.Name, err)
+	}
+	return c.json(http.StatusCreated, newEnv(e))
+}
+
+func (s *Server) env(c *call, action string) (*model.Env, error) {
+	id, err := c.uint("id")
+	if err != nil {
+		return nil, err
+	}
+	if err := c.authorize(CategoryEnv, action, id, model.Scope{}); err != nil {
+		return nil, err
+	}
+	e, err := s.store.Projects().GetEnv(id)
+	if err != nil {
+		return nil, fmt.Errorf("环境%d不存在\n%w", id, err)
+	}
+	return e, nil
+}
+
+func (s *Server) getEnv(c *call) error {
+	e, err := s.env(c, ActionRead)
+	if err != nil {
+		return err
+	}
+	return c.json(http.StatusOK, newEnv(e))
+}
+
+func (s *Server) updateEnv(c *call) error {
+	e, err := s.env(c, ActionUpdate)
+	if err != nil {
+		return err
+	}
+	v := newEnv(e)
+	if err := c.decode(&v); err != nil {
+		return err
+	}
+	if v.Name != e.Name {
+		if _, err := s.store.Projects().FirstEnv(&model.Env{Name: v.Name}); err == nil {
+			return conflict(fmt.Errorf("环境%s已存在", v.Name))
+		}
+	}
+	e.Name, e.Intro = v.Name, v.Intro
+	if err := s.store.Projects().SaveEnv(e); err != nil {
+		return fmt.Errorf("环境%s数据更新失败\n%w", e.Name, err)
+	}
+	return c.json(http.StatusOK, newEnv(e))
+}
+
+func (s *Server) deleteEnv(c *call) error {
+	e, err := s.env(c, ActionDelete)
+	if err != nil {
+		return err
+	}
+	if err := s.store.Projects().DeleteEnv(e.ID); err != nil {
+		return fmt.Errorf("删除环境%s失败\n%w", e.Name, err)
+	}
+	return c.noContent()
+}
+
+func (s *Server) listItems(c *call) error {
+	var q ListQuery
+	if err := c.decodeQuery(&q); err != nil {
+		return err
+	}
+	if err := c.authorize(CategoryItem, ActionRead, 0, model.Scope{}); err != nil {
+		return err
+	}
+	var items []model.Item
+	page, err := s.list(&model.Item{}, q, Item{}, &items)
+	if err != nil {
+		return err
+	}
+	return c.page(newItems(items), page)
+}
+
+func (s *Server) createItem(c *call) error {
+	if err := c.authorize(CategoryItem, ActionCreate, 0, model.Scope{}); err != nil {
+		return err
+	}
+	var v Item
+	if err := c.decode(&v); err != nil {
+		return err
+	}
+	if v.Name == "" {
+		return badRequest(errors.New("应用需指定name"))
+	}
+	if _, err := s.store.Projects().FirstItem(&model.Item{Name: v.Name}); err == nil {
+		return conflict(fmt.Errorf("应用%s已存在", v.Name))
+	}
+	i := &model.Item{Name: v.Name, Category: v.Category, Language: v.Language, Tier: v.Tier, Intro: v.Intro}
+	if err := s.store.Projects().FirstOrCreateItem(i); err != nil {
+		return fmt.Errorf("创建应用%s失败\n%w", i.Name, err)
+	}
+	return c.json(http.StatusCreated, newItem(i))
+}
+
+func (s *Server) item(c *call, action string) (*model.Item, error) {
+	id, err := c.uint("id")
+	if err != nil {
+		return nil, err
+	}
+	if err := c.authorize(CategoryItem, action, id, model.Scope{}); err != nil {
+		return nil, err
+	}
+	i, err := s.store.Projects().GetItem(id)
+	if err != nil {
+		return nil, fmt.Errorf("应用%d不存在\n%w", id, err)
+	}
+	return i, nil
+}
+
+func (s *Server) getItem(c *call) error {
+	i, err := s.item(c, ActionRead)
+	if err != nil {
+		return err
+	}
+	return c.json(http.StatusOK, newItem(i))
+}
+
+func (s *Server) updateItem(c *call) error {
+	i, err := s.item(c, ActionUpdate)
+	if err != nil {
+		return err
+	}
+	v := newItem(i)
+	if err := c.decode(&v); err != nil {
+		return err
+	}
+	if v.Name != i.Name {
+		if _, err := s.store.Projects().FirstItem(&model.Item{Name: v.Name}); err == nil {
+			return conflict(fmt.Errorf("应用%s已存在", v.Name))
+		}
+	}
+	i.Name, i.Category, i.Language, i.Tier, i.Intro = v.Name, v.Category, v.Language, v.Tier, v.Intro
+	if err := s.store.Projects().SaveItem(i); err != nil {
+		return fmt.Errorf("应用%s数据更新失败\n%w", i.Name, err)
+	}
+	return c.json(http.StatusOK, newItem(i))
+}
+
+func (s *Server) deleteItem(c *call) error {
+	i, err := s.item(c, ActionDelete)
+	if err != nil {
+		return err
+	}
+	if err := s.store.Projects().DeleteItem(i.ID); err != nil {
+		return fmt.Errorf("删除应用%s失败\n%w", i.Name, err)
+	}
+	return c.noContent()
+}
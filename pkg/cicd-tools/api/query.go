@@ -0,0 +1,234 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+// 查询参数结构体的字段通过 query 标签指定参数名, 零值表示不筛选, 作为 gRPC 请求时按 json 标签编码;
+// 嵌入 ListQuery 的为分页列表接口
+
+// 列表接口默认与最多返回的记录数
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// ListQuery 列表接口的分页、筛选与排序参数, 字段为响应中的字段名;
+// filter 可以重复, 如 filter=name~web&filter=created_at>=2024-01-01, 比较方式见 model.ParseFilter;
+// sort 以逗号分隔, 以 - 开头时倒序; cursor 为上一页返回的 next_cursor, 不能与 offset 同时使用
+type ListQuery struct {
+	Limit  int      `json:"limit" query:"limit"`
+	Offset int      `json:"offset" query:"offset"`
+	Cursor string   `json:"cursor" query:"cursor"`
+	Sort   string   `json:"sort" query:"sort"`
+	Filter []string `json:"filter" query:"filter"`
+}
+
+// Page 分页列表接口响应中的分页信息, total 为满足筛选条件的记录总数, 没有下一页时 next_cursor 为空
+type Page struct {
+	Total      int64  `json:"total"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+func newPage(p *model.Page) Page {
+	return Page{Total: p.Total, NextCursor: p.Next}
+}
+
+// query 按 view (列表项的结构体) 的 column 标签将字段名转换为列名, 没有 column 标签的字段不能用于筛选与排序
+func (q ListQuery) query(view interface{}) (*model.Query, error) {
+	columns := viewColumns(reflect.TypeOf(view))
+	column := func(name string, usage string) (string, error) {
+		if value, ok := columns[name]; ok {
+			return value, nil
+		}
+		names := make([]string, 0, len(columns))
+		for key := range columns {
+			names = append(names, key)
+		}
+		sort.Strings(names)
+		return "", badRequest(fmt.Errorf("不支持按%s%s, 可用的字段: %s", name, usage, strings.Join(names, ", ")))
+	}
+	mq := &model.Query{Limit: q.Limit, Offset: q.Offset, Cursor: q.Cursor}
+	switch {
+	case mq.Limit == 0:
+		mq.Limit = DefaultLimit
+	case mq.Limit < 0 || mq.Limit > MaxLimit:
+		return nil, badRequest(fmt.Errorf("limit应在1到%d之间", MaxLimit))
+	}
+	for _, value := range q.Filter {
+		f, err := model.ParseFilter(value)
+		if err != nil {
+			return nil, badRequest(err)
+		}
+		if f.Field, err = column(f.Field, "筛选"); err != nil {
+			return nil, err
+		}
+		mq.Filters = append(mq.Filters, f)
+	}
+	for _, value := range model.ParseSort(q.Sort) {
+		name, err := column(value.Field, "排序")
+		if err != nil {
+			return nil, err
+		}
+		mq.Sort = append(mq.Sort, model.Sort{Field: name, Desc: value.Desc})
+	}
+	return mq, nil
+}
+
+// list 按 view 转换 q 后分页查询与 cond 同一模型的记录, out 为该模型切片的指针
+func (s *Server) list(cond interface{}, q ListQuery, view interface{}, out interface{}) (Page, error) {
+	return s.listVia(nil, cond, q, view, out)
+}
+
+// listVia 与 list 相同, via 不为空时只查询通过关联表与指定记录关联的记录, 如组的成员
+func (s *Server) listVia(via *model.Via, cond interface{}, q ListQuery, view interface{}, out interface{}) (Page, error) {
+	mq, err := q.query(view)
+	if err != nil {
+		return Page{}, err
+	}
+	mq.Via = via
+	p, err := s.store.List(cond, mq, out)
+	if err != nil {
+		return Page{}, err
+	}
+	return newPage(p), nil
+}
+
+func viewColumns(t reflect.Type) map[string]string {
+	columns := map[string]string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if column := field.Tag.Get("column"); column != "" {
+			columns[strings.Split(field.Tag.Get("json"), ",")[0]] = column
+		}
+	}
+	return columns
+}
+
+type BuildConfigQuery struct {
+	ListQuery
+	ProjectEnvItemID uint `json:"project_env_item_id" query:"project_env_item_id"`
+}
+
+type BuildQuery struct {
+	ListQuery
+	ProjectEnvItemID uint   `json:"project_env_item_id" query:"project_env_item_id"`
+	State            string `json:"state" query:"state"`
+}
+
+type ArtifactQuery struct {
+	ListQuery
+	ProjectEnvItemID uint `json:"project_env_item_id" query:"project_env_item_id"`
+	BuildInfoID      uint `json:"build_info_id" query:"build_info_id"`
+}
+
+// BuildLogQuery after 为已读取的最后一行日志的 ID, 只返回其后的日志
+type BuildLogQuery struct {
+	After uint `json:"after" query:"after"`
+}
+
+// queryFields 带 query 标签的字段, 包括嵌入结构体中的字段, index 用于 FieldByIndex
+func queryFields(t reflect.Type) []reflect.StructField {
+	var fields []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			for _, value := range queryFields(field.Type) {
+				value.Index = append([]int{i}, value.Index...)
+				fields = append(fields, value)
+			}
+			continue
+		}
+		if field.Tag.Get("query") != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// decodeQuery 按 query 标签解析查询参数, 支持字符串、整数、布尔与字符串切片 (参数可重复) 字段, 未知参数被忽略
+func (c *call) decodeQuery(v interface{}) error {
+	values := c.r.URL.Query()
+	rv := reflect.ValueOf(v).Elem()
+	for _, f := range queryFields(rv.Type()) {
+		name := f.Tag.Get("query")
+		value := values.Get(name)
+		if value == "" {
+			continue
+		}
+		field := rv.FieldByIndex(f.Index)
+		var err error
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(value)
+		case reflect.Slice:
+			field.Set(reflect.ValueOf(values[name]))
+		case reflect.Uint, reflect.Uint32, reflect.Uint64:
+			var n uint64
+			if n, err = strconv.ParseUint(value, 10, 64); err == nil {
+				field.SetUint(n)
+			}
+		case reflect.Int, reflect.Int32, reflect.Int64:
+			var n int64
+			if n, err = strconv.ParseInt(value, 10, 64); err == nil {
+				field.SetInt(n)
+			}
+		case reflect.Bool:
+			var b bool
+			if b, err = strconv.ParseBool(value); err == nil {
+				field.SetBool(b)
+			}
+		}
+		if err != nil {
+			return badRequest(fmt.Errorf("查询参数%s的值%s无效", name, value))
+		}
+	}
+	return nil
+}
+
+// Values 按 query 标签将查询参数结构体编码为 url.Values, 零值字段被忽略, v 可以为 nil
+func Values(v interface{}) url.Values {
+	values := url.Values{}
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() || (rv.Kind() == reflect.Ptr && rv.IsNil()) {
+		return values
+	}
+	rv = reflect.Indirect(rv)
+	for _, f := range queryFields(rv.Type()) {
+		name := f.Tag.Get("query")
+		field := rv.FieldByIndex(f.Index)
+		switch {
+		case field.IsZero():
+		case field.Kind() == reflect.Slice:
+			for i := 0; i < field.Len(); i++ {
+				values.Add(name, fmt.Sprint(field.Index(i).Interface()))
+			}
+		default:
+			values.Set(name, fmt.Sprint(field.Interface()))
+		}
+	}
+	return values
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+func TestListQuery(t *testing.T) {
+	q, err := ListQuery{Filter: []string{"name~web", "number>=3"}, Sort: "-number,name"}.query(Build{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &model.Query{
+		Limit:   DefaultLimit,
+		Filters: []model.Filter{{Field: "build_name", Op: "~", Value: "web"}, {Field: "build_id", Op: ">=", Value: "3"}},
+		Sort:    []model.Sort{{Field: "build_id", Desc: true}, {Field: "build_name"}},
+	}
+	if fmt.Sprint(q) != fmt.Sprint(want) {
+		t.Errorf("query = %+v, want %+v", q, want)
+	}
+
+	// 只有响应中带 column 标签的字段可以使用, 模型的列名与隐藏字段均不可用
+	for _, bad := range []ListQuery{
+		{Filter: []string{"password=x"}},
+		{Filter: []string{"token_version>0"}},
+		{Filter: []string{"user_name=alice"}},
+		{Filter: []string{"name"}},
+		{Sort: "email_address"},
+		{Limit: MaxLimit + 1},
+		{Limit: -1},
+	} {
+		var e *Error
+		if _, err := bad.query(User{}); !errors.As(err, &e) || e.Status != http.StatusBadRequest {
+			t.Errorf("%+v: %v", bad, err)
+		}
+	}
+}
+
+func TestListUsersPaging(t *testing.T) {
+	ts := newTestServer(t)
+	for i := 0; i < 7; i++ {
+		ts.user(fmt.Sprintf("user%d", i))
+	}
+	type list struct {
+		Items []User `json:"items"`
+		Page
+	}
+	// 年龄均为 0, 排序字段相同时按 id 保证翻页稳定
+	var all list
+	if code := ts.do(ts.admin, http.MethodGet, "/users?sort=-age", nil, &all); code != http.StatusOK || all.Total != 8 {
+		t.Fatalf("list = %d, %+v", code, all.Page)
+	}
+	var ids []uint
+	var first string
+	path := "/users?sort=-age&limit=3"
+	for {
+		var page list
+		if code := ts.do(ts.admin, http.MethodGet, path, nil, &page); code != http.StatusOK {
+			t.Fatalf("GET %s = %d", path, code)
+		}
+		for _, u := range page.Items {
+			ids = append(ids, u.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		if first == "" {
+			first = page.NextCursor
+		}
+		path = "/users?sort=-age&limit=3&cursor=" + url.QueryEscape(page.NextCursor)
+	}
+	var want []uint
+	for _, u := range all.Items {
+		want = append(want, u.ID)
+	}
+	if fmt.Sprint(ids) != fmt.Sprint(want) {
+		t.Errorf("paged = %v, want %v", ids, want)
+	}
+
+	for _, path := range []string{
+		"/users?filter=" + url.QueryEscape("password=x"),
+		"/users?filter=" + url.QueryEscape("age~1"),
+		"/users?sort=locked_until",
+		"/users?cursor=bogus",
+		"/users?sort=age&cursor=" + url.QueryEscape(first),
+		"/users?offset=1&cursor=x",
+	} {
+		if code := ts.do(ts.admin, http.MethodGet, path, nil, nil); code != http.StatusBadRequest {
+			t.Errorf("GET %s = %d", path, code)
+		}
+	}
+}
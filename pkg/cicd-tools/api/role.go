@@ -0,0 +1,313 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+// Role 的 parent_ids 为直接继承的角色, 修改时整体替换
+type Role struct {
+	ID        uint      `json:"id" api:"readonly" column:"id"`
+	Name      string    `json:"name" column:"role"`
+	Intro     string    `json:"intro" column:"intro"`
+	ParentIDs []uint    `json:"parent_ids"`
+	CreatedAt time.Time `json:"created_at" api:"readonly" column:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" api:"readonly" column:"updated_at"`
+}
+
+// Permission 的 name 默认为 <category>:<action>, effect 默认为 allow
+type Permission struct {
+	ID         uint   `json:"id" api:"readonly"`
+	Name       string `json:"name"`
+	Category   string `json:"category"`
+	Action     string `json:"action"`
+	Effect     string `json:"effect"`
+	ResourceID uint   `json:"resource_id"`
+}
+
+func newPermission(p *model.Permission) Permission {
+	effect := p.Effect
+	if effect == "" {
+		effect = model.EffectAllow
+	}
+	return Permission{ID: p.ID, Name: p.Name, Category: p.Category, Action: p.Action, Effect: effect, ResourceID: p.ResourceID}
+}
+
+func (s *Server) roleRoutes() {
+	s.routes.add(Operation{Method: http.MethodGet, Path: "/roles", ID: "ListRoles", Summary: "查看角色", Query: ListQuery{}, Response: []Role{}}, s.listRoles)
+	s.routes.add(Operation{Method: http.MethodPost, Path: "/roles", ID: "CreateRole", Summary: "创建角色", Body: Role{}, Response: Role{}, Status: http.StatusCreated}, s.createRole)
+	s.routes.add(Operation{Method: http.MethodGet, Path: "/roles/{id}", ID: "GetRole", Summary: "查看角色详情", Response: Role{}}, s.getRole)
+	s.routes.add(Operation{Method: http.MethodPut, Path: "/roles/{id}", ID: "UpdateRole", Summary: "更新角色, parent_ids 整体替换", Body: Role{}, Response: Role{}}, s.updateRole)
+	s.routes.add(Operation{Method: http.MethodDelete, Path: "/roles/{id}", ID: "DeleteRole", Summary: "删除角色"}, s.deleteRole)
+	s.routes.add(Operation{Method: http.MethodGet, Path: "/roles/{id}/permissions", ID: "ListRolePermissions", Summary: "查看角色直接拥有的权限", Response: []Permission{}}, s.rolePermissions)
+	s.routes.add(Operation{Method: http.MethodPost, Path: "/roles/{id}/permissions", ID: "AddRolePermission", Summary: "为角色添加权限", Body: Permission{}, Response: Permission{}, Status: http.StatusCreated}, s.addPermission)
+	s.routes.add(Operation{Method: http.MethodDelete, Path: "/roles/{id}/permissions/{permission_id}", ID: "RemoveRolePermission", Summary: "删除角色的权限"}, s.removePermission)
+}
+
+func (s *Server) newRole(r *model.Role) (Role, error) {
+	parents, err := s.store.Roles().Parents(r.ID)
+	if err != nil {
+		return Role{}, err
+	}
+	v := Role{ID: r.ID, Name: r.Name, Intro: r.Intro, ParentIDs: []uint{}, CreatedAt: r.CreatedAt, UpdatedAt: r.UpdatedAt}
+	for _, value := range parents {
+		v.ParentIDs = append(v.ParentIDs, value.ID)
+	}
+	return v, nil
+}
+
+func (s *Server) listRoles(c *call) error {
+	var q ListQuery
+	if err := c.decodeQuery(&q); err != nil {
+		return err
+	}
+	if err := c.authorize(CategoryRole, ActionRead, 0, model.Scope{}); err != nil {
+		return err
+	}
+	var roles []model.Role
+	page, err := s.list(&model.Role{}, q, Role{}, &roles)
+	if err != nil {
+		return err
+	}
+	items := make([]Role, 0, len(roles))
+	for i := range roles {
+		v, err := s.newRole(&roles[i])
+		if err != nil {
+			return err
+		}
+		items = append(items, v)
+	}
+	return c.page(items, page)
+}
+
+// checkParents 继承的角色需存在且不能形成循环
+func (s *Server) checkParents(rid uint, pids []uint) error {
+	for _, pid := range pids {
+		if _, err := s.store.Roles().Get(pid); err != nil {
+			return badRequest(fmt.Errorf("继承的角色%d不存在", pid))
+		}
+		if rid == 0 {
+			continue
+		}
+		if err := model.CheckRoleCycle(s.store, rid, pid); err != nil {
+			return badRequest(err)
+		}
+	}
+	return nil
+}
+
+func (s *Server) createRole(c *call) error {
+	if err := c.authorize(CategoryRole, ActionCreate, 0, model.Scope{}); err != nil {
+		return err
+	}
+	var v Role
+	if err := c.decode(&v); err != nil {
+		return err
+	}
+	if v.Name == "" {
+		return badRequest(errors.New("角色需指定name"))
+	}
+	if _, err := s.store.Roles().First(&model.Role{Name: v.Name}); err == nil {
+		return conflict(fmt.Errorf("角色%s已存在", v.Name))
+	}
+	if err := s.checkParents(0, v.ParentIDs); err != nil {
+		return err
+	}
+	r := &model.Role{Name: v.Name, Intro: v.Intro}
+	err := s.store.Transaction(func(tx model.Store) error {
+		if err := tx.Roles().Create(r); err != nil {
+			return err
+		}
+		return model.SetRoleParents(tx, r.ID, v.ParentIDs)
+	})
+	if err != nil {
+		return fmt.Errorf("创建角色%s失败\n%w", v.Name, err)
+	}
+	created, err := s.newRole(r)
+	if err != nil {
+		return err
+	}
+	return c.json(http.StatusCreated, created)
+}
+
+func (s *Server) role(c *call, action string) (*model.Role, error) {
+	id, err := c.uint("id")
+	if err != nil {
+		return nil, err
+	}
+	if err := c.authorize(CategoryRole, action, id, model.Scope{}); err != nil {
+		return nil, err
+	}
+	r, err := s.store.Roles().Get(id)
+	if err != nil {
+		return nil, fmt.Errorf("角色%d不存在\n%w", id, err)
+	}
+	return r, nil
+}
+
+func (s *Server) getRole(c *call) error {
+	r, err := s.role(c, ActionRead)
+	if err != nil {
+		return err
+	}
+	v, err := s.newRole(r)
+	if err != nil {
+		return err
+	}
+	return c.json(http.StatusOK, v)
+}
+
+func (s *Server) updateRole(c *call) error {
+	r, err := s.role(c, ActionUpdate)
+	if err != nil {
+		return err
+	}
+	v, err := s.newRole(r)
+	if err != nil {
+		return err
+	}
+	if err := c.decode(&v); err != nil {
+		return err
+	}
+	if v.Name != r.Name {
+		if _, err := s.store.Roles().First(&model.Role{Name: v.Name}); err == nil {
+			return conflict(fmt.Errorf("角色%s已存在", v.Name))
+		}
+	}
+	if err := s.checkParents(r.ID, v.ParentIDs); err != nil {
+		return err
+	}
+	r.Name, r.Intro = v.Name, v.Intro
+	err = s.store.Transaction(func(tx model.Store) error {
+		if err := tx.Roles().Save(r); err != nil {
+			return err
+		}
+		return model.SetRoleParents(tx, r.ID, v.ParentIDs)
+	})
+	if err != nil {
+		return fmt.Errorf("角色%s数据更新失败\n%w", r.Name, err)
+	}
+	if v, err = s.newRole(r); err != nil {
+		return err
+	}
+	return c.json(http.StatusOK, v)
+}
+
+// deleteRole 仍被其它角色继承时返回 409, 删除时一并解除用户与组的绑定并删除权限与继承关系
+func (s *Server) deleteRole(c *call) error {
+	r, err := s.role(c, ActionDelete)
+	if err != nil {
+		return err
+	}
+	children, err := s.store.Roles().Children(r.ID)
+	if err != nil {
+		return err
+	}
+	if len(children) > 0 {
+		return conflict(fmt.Errorf("角色%s被%d个角色继承, 不能删除", r.Name, len(children)))
+	}
+	err = s.store.Transaction(func(tx model.Store) error {
+		return model.DeleteRole(tx, r.ID)
+	})
+	if err != nil {
+		return fmt.Errorf("删除角色%s失败\n%w", r.Name, err)
+	}
+	return c.noContent()
+}
+
+func (s *Server) rolePermissions(c *call) error {
+	r, err := s.role(c, ActionRead)
+	if err != nil {
+		return err
+	}
+	permissions, err := s.store.Roles().Permissions(r.ID)
+	if err != nil {
+		return err
+	}
+	items := make([]Permission, 0, len(permissions))
+	for i := range permissions {
+		items = append(items, newPermission(&permissions[i]))
+	}
+	return c.list(items)
+}
+
+// addPermission 修改角色的权限需要该角色的 role:update 权限
+func (s *Server) addPermission(c *call) error {
+	r, err := s.role(c, ActionUpdate)
+	if err != nil {
+		return err
+	}
+	var v Permission
+	if err := c.decode(&v); err != nil {
+		return err
+	}
+	if v.Category == "" || v.Action == "" {
+		return badRequest(errors.New("权限需指定category与action"))
+	}
+	if err := model.CheckEffect(v.Effect); err != nil {
+		return badRequest(err)
+	}
+	if v.Effect == "" {
+		v.Effect = model.EffectAllow
+	}
+	if v.Name == "" {
+		v.Name = v.Category + ":" + v.Action
+	}
+	p := &model.Permission{
+		Name:       v.Name,
+		ResourceID: v.ResourceID,
+		Category:   v.Category,
+		Action:     v.Action,
+		Effect:     v.Effect,
+		RoleID:     r.ID,
+	}
+	if err := s.store.Roles().AddPermission(p); err != nil {
+		return fmt.Errorf("角色%s添加权限%s失败\n%w", r.Name, v.Name, err)
+	}
+	return c.json(http.StatusCreated, newPermission(p))
+}
+
+func (s *Server) removePermission(c *call) error {
+	r, err := s.role(c, ActionUpdate)
+	if err != nil {
+		return err
+	}
+	id, err := c.uint("permission_id")
+	if err != nil {
+		return err
+	}
+	permissions, err := s.store.Roles().Permissions(r.ID)
+	if err != nil {
+		return err
+	}
+	for _, value := range permissions {
+		if value.ID != id {
+			continue
+		}
+		if err := s.store.Roles().RemovePermission(id); err != nil {
+			return fmt.Errorf("删除权限%d失败\n%w", id, err)
+		}
+		return c.noContent()
+	}
+	return fmt.Errorf("角色%s没有权限%d\n%w", r.Name, id, model.ErrNotFound)
+}
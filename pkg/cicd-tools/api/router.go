@@ -0,0 +1,132 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// router 按方法与路径分段匹配, 以 {name} 表示的分段为路径参数
+type router struct {
+	routes []route
+}
+
+type route struct {
+	op     Operation
+	parts  []string
+	handle func(c *call) error
+}
+
+// Operation 接口说明, 同时用于路由、生成 OpenAPI 文档与客户端; Query 与 Body 为查询参数与请求体的结构体,
+// Response 为切片时响应为 {"items": [...]}, 分页列表接口 (见 Paged) 另有 Page 的字段, 为 nil 时没有响应体
+type Operation struct {
+	Method   string
+	Path     string
+	ID       string
+	Summary  string
+	Query    interface{}
+	Body     interface{}
+	Response interface{}
+	// Status 为成功时的状态码, 为 0 时有响应体返回 200, 否则返回 204
+	Status int
+	// Public 为 true 时不需要访问令牌
+	Public bool
+}
+
+func (o Operation) status() int {
+	switch {
+	case o.Status != 0:
+		return o.Status
+	case o.Response == nil:
+		return http.StatusNoContent
+	default:
+		return http.StatusOK
+	}
+}
+
+// Paged Query 为 ListQuery 或嵌入了 ListQuery 时为分页列表接口
+func (o Operation) Paged() bool {
+	if o.Query == nil {
+		return false
+	}
+	t := reflect.TypeOf(o.Query)
+	if t == reflect.TypeOf(ListQuery{}) {
+		return true
+	}
+	field, ok := t.FieldByName("ListQuery")
+	return ok && field.Anonymous
+}
+
+// Params 路径参数名称, 按在路径中出现的顺序
+func (o Operation) Params() []string {
+	var names []string
+	for _, value := range split(o.Path) {
+		if name, ok := param(value); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func (rt *router) add(op Operation, handle func(c *call) error) {
+	rt.routes = append(rt.routes, route{op: op, parts: split(op.Path), handle: handle})
+}
+
+// match 路径匹配但方法不匹配时返回 nil 与支持的方法
+func (rt *router) match(method string, path string) (*route, map[string]string, []string) {
+	parts := split(path)
+	var allowed []string
+	for i := range rt.routes {
+		params, ok := rt.routes[i].params(parts)
+		if !ok {
+			continue
+		}
+		if rt.routes[i].op.Method == method {
+			return &rt.routes[i], params, nil
+		}
+		allowed = append(allowed, rt.routes[i].op.Method)
+	}
+	return nil, nil, allowed
+}
+
+func (r *route) params(parts []string) (map[string]string, bool) {
+	if len(parts) != len(r.parts) {
+		return nil, false
+	}
+	params := map[string]string{}
+	for i, value := range r.parts {
+		if name, ok := param(value); ok {
+			params[name] = parts[i]
+		} else if value != parts[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+func param(part string) (string, bool) {
+	if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+		return part[1 : len(part)-1], true
+	}
+	return "", false
+}
+
+func split(path string) []string {
+	return strings.FieldsFunc(path, func(r rune) bool { return r == '/' })
+}
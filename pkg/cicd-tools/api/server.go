@@ -0,0 +1,287 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"devops/cicd-tools/pkg/cicd-tools/auth"
+	"devops/cicd-tools/pkg/cicd-tools/mirror"
+	"devops/cicd-tools/pkg/cicd-tools/model"
+	"devops/cicd-tools/pkg/cicd-tools/rbac"
+	"devops/cicd-tools/pkg/util/logger"
+)
+
+// Prefix 接口路径前缀, 认证接口位于 Prefix + "/auth"
+const Prefix = "/api/v1"
+
+// 鉴权使用的操作, 绑定角色使用 role:bind, 资源 ID 为角色 ID, 范围为绑定的范围;
+// 登记构建与部署应用还需要 env:deploy, 资源 ID 为环境 ID, 范围为应用环境所在的项目与环境
+const (
+	ActionRead   = "read"
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+	ActionBind   = "bind"
+	ActionDeploy = rbac.ActionDeploy
+)
+
+// 鉴权使用的资源类别
+const (
+	CategoryUser        = "user"
+	CategoryGroup       = "group"
+	CategoryRole        = "role"
+	CategoryProject     = "project"
+	CategoryEnv         = "env"
+	CategoryItem        = "item"
+	CategoryRepo        = "repo"
+	CategoryBuildConfig = "build_config"
+	CategoryBuild       = "build"
+	CategoryArtifact    = "artifact"
+)
+
+// Server 提供模型层的 JSON 接口, 除认证接口与 /healthz 外都需要访问令牌,
+// 每个请求按 rbac 权限鉴权, 个人访问令牌还需令牌范围允许该操作
+type Server struct {
+	store  model.Store
+	authn  *auth.Authenticator
+	authz  *rbac.Authorizer
+	events *hub
+	mirror *mirror.Mirror
+	oidc   http.Handler
+	routes router
+}
+
+// Credentials 与 Refresh 为认证接口的请求体, 认证接口由 auth.Authenticator 处理, 这里只用于生成文档与客户端
+type Credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	OTP      string `json:"otp"`
+}
+
+type Refresh struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+var authOperations = []Operation{
+	{Method: http.MethodPost, Path: "/auth/login", ID: "Login", Summary: "使用密码登录, 启用多因素认证的用户需提供otp", Body: Credentials{}, Response: auth.TokenPair{}, Public: true},
+	{Method: http.MethodPost, Path: "/auth/refresh", ID: "Refresh", Summary: "使用刷新令牌换取新的令牌, 原刷新令牌被吊销", Body: Refresh{}, Response: auth.TokenPair{}, Public: true},
+	{Method: http.MethodPost, Path: "/auth/logout", ID: "Logout", Summary: "吊销访问令牌与请求体中的刷新令牌", Body: Refresh{}},
+}
+
+func NewServer(s model.Store, authn *auth.Authenticator) *Server {
+	srv := &Server{store: s, authn: authn, authz: rbac.NewAuthorizer(s), events: newHub()}
+	srv.register()
+	return srv
+}
+
+func (s *Server) register() {
+	s.userRoutes()
+	s.groupRoutes()
+	s.roleRoutes()
+	s.projectRoutes()
+	s.buildRoutes()
+	s.mirrorRoutes()
+}
+
+// Operations 返回全部接口的说明, 包括认证接口, 路径不包含 Prefix
+func Operations() []Operation {
+	srv := new(Server)
+	srv.register()
+	ops := append([]Operation{}, authOperations...)
+	for _, value := range srv.routes.routes {
+		ops = append(ops, value.op)
+	}
+	return ops
+}
+
+// WithOIDC 在 Prefix + "/auth/oidc" 下挂载 OIDC 登录接口, 通常为 oidc.Flow.Handler()
+func (s *Server) WithOIDC(h http.Handler) *Server {
+	s.oidc = h
+	return s
+}
+
+// Handler 除接口外还提供不需要认证的 /healthz 与 /openapi.json
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(Prefix+"/auth/", http.StripPrefix(Prefix+"/auth", s.authn.Handler()))
+	if s.oidc != nil {
+		mux.Handle(Prefix+"/auth/oidc/", http.StripPrefix(Prefix+"/auth/oidc", s.oidc))
+	}
+	mux.Handle(Prefix+"/", s.authn.Middleware(s))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		auth.WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	mux.HandleFunc("/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		auth.WriteJSON(w, http.StatusOK, OpenAPI())
+	})
+	return mux
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, Prefix)
+	rt, params, allowed := s.routes.match(r.Method, path)
+	if rt == nil {
+		if len(allowed) > 0 {
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			auth.WriteError(w, http.StatusMethodNotAllowed, fmt.Errorf("接口%s不支持%s请求", path, r.Method))
+			return
+		}
+		auth.WriteError(w, http.StatusNotFound, fmt.Errorf("接口%s不存在", path))
+		return
+	}
+	id, _ := auth.FromContext(r.Context())
+	c := &call{w: w, r: r, srv: s, id: id, params: params}
+	if err := rt.handle(c); err != nil {
+		c.fail(err)
+	}
+}
+
+// Error 带 HTTP 状态码的错误
+type Error struct {
+	Status int
+	Err    error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func badRequest(err error) error {
+	return &Error{Status: http.StatusBadRequest, Err: err}
+}
+
+func forbidden(err error) error {
+	return &Error{Status: http.StatusForbidden, Err: err}
+}
+
+func conflict(err error) error {
+	return &Error{Status: http.StatusConflict, Err: err}
+}
+
+// call 一次请求的上下文, params 为路径参数
+type call struct {
+	w      http.ResponseWriter
+	r      *http.Request
+	srv    *Server
+	id     *auth.Identity
+	params map[string]string
+}
+
+// fail 查询不到记录时返回 404, 查询条件无效时返回 400, 违反唯一索引时返回 409, 其它未标注状态码的错误返回 500 并记录日志
+func (c *call) fail(err error) {
+	var e *Error
+	switch {
+	case errors.As(err, &e):
+		auth.WriteError(c.w, e.Status, e.Err)
+	case errors.Is(err, model.ErrNotFound):
+		auth.WriteError(c.w, http.StatusNotFound, err)
+	case errors.Is(err, model.ErrInvalidQuery):
+		auth.WriteError(c.w, http.StatusBadRequest, err)
+	case errors.Is(err, model.ErrDuplicated):
+		auth.WriteError(c.w, http.StatusConflict, err)
+	default:
+		logger.Error(fmt.Errorf("%s %s失败\n%w", c.r.Method, c.r.URL.Path, err))
+		auth.WriteError(c.w, http.StatusInternalServerError, auth.ErrInternal)
+	}
+}
+
+// uint 读取路径中的编号
+func (c *call) uint(name string) (uint, error) {
+	id, err := strconv.ParseUint(c.params[name], 10, 64)
+	if err != nil || id == 0 {
+		return 0, badRequest(fmt.Errorf("路径参数%s的值%s不是有效编号", name, c.params[name]))
+	}
+	return uint(id), nil
+}
+
+// decode 解析请求体, 不允许未知字段
+func (c *call) decode(v interface{}) error {
+	decoder := json.NewDecoder(c.r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return badRequest(fmt.Errorf("请求体格式错误\n%w", err))
+	}
+	return nil
+}
+
+func (c *call) json(status int, v interface{}) error {
+	auth.WriteJSON(c.w, status, v)
+	return nil
+}
+
+// list 列表统一以 {"items": [...]} 返回
+func (c *call) list(items interface{}) error {
+	return c.json(http.StatusOK, map[string]interface{}{"items": items})
+}
+
+// page 分页列表在 items 之外返回 Page 的字段
+func (c *call) page(items interface{}, page Page) error {
+	return c.json(http.StatusOK, struct {
+		Items interface{} `json:"items"`
+		Page
+	}{items, page})
+}
+
+func (c *call) noContent() error {
+	c.w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (c *call) authorize(category string, action string, resourceID uint, scope model.Scope) error {
+	return c.srv.authorize(c.id, category, action, resourceID, scope)
+}
+
+// authorize 先检查令牌范围, 再按 rbac 权限鉴权, 拒绝时返回 403 与鉴权说明
+func (s *Server) authorize(id *auth.Identity, category string, action string, resourceID uint, scope model.Scope) error {
+	if !id.Allows(category, action) {
+		return forbidden(fmt.Errorf("令牌范围不允许%s:%s", category, action))
+	}
+	d, err := s.authz.Authorize(rbac.Request{
+		UserID:     id.UserID,
+		Category:   category,
+		ResourceID: resourceID,
+		Action:     action,
+		Scope:      scope,
+	})
+	if err != nil {
+		return err
+	}
+	if !d.Allowed {
+		return forbidden(errors.New(d.String()))
+	}
+	return nil
+}
+
+// authorizeDeploy 在项目的环境中部署应用或登记构建, 显式拒绝该环境部署的权限优先于其它角色的允许
+func (s *Server) authorizeDeploy(id *auth.Identity, scope model.Scope) error {
+	return s.authorize(id, CategoryEnv, ActionDeploy, scope.EnvID, scope)
+}
+
+// envItemScope 应用环境所在的项目与环境
+func envItemScope(pei *model.ProjectEnvItem) model.Scope {
+	return model.Scope{ProjectID: pei.ProjectID, EnvID: pei.EnvID}
+}
@@ -0,0 +1,308 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"devops/cicd-tools/pkg/cicd-tools/auth"
+	"devops/cicd-tools/pkg/cicd-tools/auth/password"
+	"devops/cicd-tools/pkg/cicd-tools/config"
+	"devops/cicd-tools/pkg/cicd-tools/model"
+	"devops/cicd-tools/pkg/cicd-tools/store/memstore"
+)
+
+const testPassword = "hello1234"
+
+// testServer 使用内存存储的接口服务, 用户 admin 拥有 *:* 权限
+type testServer struct {
+	t       *testing.T
+	store   model.Store
+	authn   *auth.Authenticator
+	handler http.Handler
+	admin   string
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	s := memstore.New()
+	model.SetStore(s)
+	model.SetPasswordPolicy(password.DefaultPolicy(), password.Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	c := config.Default().Auth.Token
+	c.Secret = strings.Repeat("k", 32)
+	tokens, err := auth.NewTokens(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authn := auth.NewAuthenticator(s, tokens)
+	ts := &testServer{t: t, store: s, authn: authn, handler: NewServer(s, authn).Handler()}
+	admin := ts.user("admin")
+	ts.bind(admin, ts.role("admin", "*:*"), model.Scope{})
+	ts.admin = ts.login("admin")
+	return ts
+}
+
+func (ts *testServer) check(err error) {
+	ts.t.Helper()
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+}
+
+func (ts *testServer) user(name string) *model.User {
+	ts.t.Helper()
+	u := (&model.User{Name: name, Email: name + "@example.org"}).Create()
+	ts.check(u.Error)
+	ts.check(u.SetPassword(testPassword).Error)
+	return u
+}
+
+func (ts *testServer) login(name string) string {
+	ts.t.Helper()
+	pair, err := ts.authn.Login(name, testPassword)
+	ts.check(err)
+	return pair.AccessToken
+}
+
+// role 创建角色, perms 的格式为 [deny ]category:action[#resourceID]
+func (ts *testServer) role(name string, perms ...string) *model.Role {
+	ts.t.Helper()
+	r := &model.Role{Name: name}
+	ts.check(ts.store.Roles().Create(r))
+	for i, perm := range perms {
+		p := &model.Permission{Name: fmt.Sprintf("%s-%d", name, i), RoleID: r.ID, Effect: model.EffectAllow}
+		if strings.HasPrefix(perm, "deny ") {
+			p.Effect, perm = model.EffectDeny, strings.TrimPrefix(perm, "deny ")
+		}
+		if n := strings.Index(perm, "#"); n >= 0 {
+			_, err := fmt.Sscan(perm[n+1:], &p.ResourceID)
+			ts.check(err)
+			perm = perm[:n]
+		}
+		parts := strings.SplitN(perm, ":", 2)
+		p.Category, p.Action = parts[0], parts[1]
+		ts.check(ts.store.Roles().AddPermission(p))
+	}
+	return r
+}
+
+func (ts *testServer) bind(u *model.User, r *model.Role, scope model.Scope) {
+	ts.t.Helper()
+	projectID, projectEnvID, err := model.ResolveScope(ts.store, scope)
+	ts.check(err)
+	ts.check(ts.store.Users().AddRoleBinding(&model.UserRole{UserID: u.ID, RoleID: r.ID, ProjectID: projectID, ProjectEnvID: projectEnvID}))
+}
+
+// do 发送请求并返回状态码, out 不为 nil 时解析响应
+func (ts *testServer) do(token string, method string, path string, body interface{}, out interface{}) int {
+	ts.t.Helper()
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		ts.check(err)
+		r = bytes.NewReader(b)
+	}
+	req := httptest.NewRequest(method, Prefix+path, r)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	ts.handler.ServeHTTP(w, req)
+	if out != nil && w.Code < 300 {
+		ts.check(json.Unmarshal(w.Body.Bytes(), out))
+	}
+	return w.Code
+}
+
+// project 创建项目并在其环境中部署应用, 返回各环境的应用环境
+func (ts *testServer) project(name string, item string, envs ...string) (*model.Project, []*model.ProjectEnvItem) {
+	ts.t.Helper()
+	p := &model.Project{Name: name}
+	ts.check(ts.store.Projects().Create(p))
+	i := &model.Item{Name: item}
+	ts.check(ts.store.Projects().FirstOrCreateItem(i))
+	_, err := ts.store.Projects().AddItem(p.ID, i.ID)
+	ts.check(err)
+	values := make([]*model.ProjectEnvItem, 0, len(envs))
+	for _, env := range envs {
+		e := &model.Env{Name: env}
+		ts.check(ts.store.Projects().FirstOrCreateEnv(e))
+		_, err := ts.store.Projects().AddEnv(p.ID, e.ID)
+		ts.check(err)
+		pei := &model.ProjectEnvItem{Project: p.Name, ProjectID: p.ID, Env: e.Name, EnvID: e.ID, Item: i.Name, ItemID: i.ID}
+		ts.check(ts.store.Projects().FirstOrCreateEnvItem(pei))
+		values = append(values, pei)
+	}
+	return p, values
+}
+
+// TestDeployDeny 对 prod 显式拒绝部署时, 即使拥有 *:* 也不能登记构建或部署应用
+func TestDeployDeny(t *testing.T) {
+	ts := newTestServer(t)
+	p, items := ts.project("pay", "api", "dev", "prod")
+	dev, prod := items[0], items[1]
+	web := &model.Item{Name: "web"}
+	ts.check(ts.store.Projects().FirstOrCreateItem(web))
+	_, err := ts.store.Projects().AddItem(p.ID, web.ID)
+	ts.check(err)
+
+	u := ts.user("alice")
+	ts.bind(u, ts.role("builder", "*:*"), model.Scope{})
+	ts.bind(u, ts.role("no-prod", fmt.Sprintf("deny env:deploy#%d", prod.EnvID)), model.Scope{ProjectID: p.ID})
+	token := ts.login("alice")
+
+	tests := []struct {
+		name   string
+		path   string
+		body   interface{}
+		status int
+	}{
+		{"build dev", "/builds", Build{ProjectEnvItemID: dev.ID}, http.StatusCreated},
+		{"build prod", "/builds", Build{ProjectEnvItemID: prod.ID}, http.StatusForbidden},
+		{"deploy dev", fmt.Sprintf("/projects/%d/env-items", p.ID), EnvItem{EnvID: dev.EnvID, ItemID: web.ID}, http.StatusCreated},
+		{"deploy prod", fmt.Sprintf("/projects/%d/env-items", p.ID), EnvItem{EnvID: prod.EnvID, ItemID: web.ID}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := ts.do(token, http.MethodPost, tt.path, tt.body, nil); status != tt.status {
+				t.Fatalf("status = %d, want %d", status, tt.status)
+			}
+		})
+	}
+	if status := ts.do(ts.admin, http.MethodPost, "/builds", Build{ProjectEnvItemID: prod.ID}, nil); status != http.StatusCreated {
+		t.Fatalf("admin status = %d", status)
+	}
+}
+
+// TestAuthorization 未登录返回 401, 权限不足返回 403, 项目范围内的绑定只在该项目内生效
+func TestAuthorization(t *testing.T) {
+	ts := newTestServer(t)
+	pay, _ := ts.project("pay", "api", "dev")
+	shop, _ := ts.project("shop", "web", "dev")
+	alice := ts.user("alice")
+	ts.bind(alice, ts.role("reader", "user:read"), model.Scope{})
+	ts.bind(alice, ts.role("pay-reader", "project:read"), model.Scope{ProjectID: pay.ID})
+	token := ts.login("alice")
+
+	tests := []struct {
+		token  string
+		method string
+		path   string
+		body   interface{}
+		status int
+	}{
+		{"", http.MethodGet, "/users", nil, http.StatusUnauthorized},
+		{"bogus", http.MethodGet, "/users", nil, http.StatusUnauthorized},
+		{token, http.MethodGet, "/me", nil, http.StatusOK},
+		{token, http.MethodGet, "/users", nil, http.StatusOK},
+		{token, http.MethodGet, fmt.Sprintf("/users/%d", alice.ID), nil, http.StatusOK},
+		{token, http.MethodPost, "/users", User{Name: "bob", Email: "bob@example.org"}, http.StatusForbidden},
+		{token, http.MethodDelete, fmt.Sprintf("/users/%d", alice.ID), nil, http.StatusForbidden},
+		{token, http.MethodGet, "/groups", nil, http.StatusForbidden},
+		{token, http.MethodPost, "/roles", Role{Name: "root"}, http.StatusForbidden},
+		{token, http.MethodGet, fmt.Sprintf("/projects/%d", pay.ID), nil, http.StatusOK},
+		{token, http.MethodGet, fmt.Sprintf("/projects/%d", shop.ID), nil, http.StatusForbidden},
+		{token, http.MethodDelete, fmt.Sprintf("/projects/%d", pay.ID), nil, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if status := ts.do(tt.token, tt.method, tt.path, tt.body, nil); status != tt.status {
+			t.Errorf("%s %s = %d, want %d", tt.method, tt.path, status, tt.status)
+		}
+	}
+}
+
+// TestErrorStatus 记录不存在返回 404, 名称冲突或仍被引用返回 409, 请求格式错误返回 400
+func TestErrorStatus(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.user("alice")
+	var parent Role
+	if status := ts.do(ts.admin, http.MethodPost, "/roles", Role{Name: "base"}, &parent); status != http.StatusCreated {
+		t.Fatalf("create role = %d", status)
+	}
+	if status := ts.do(ts.admin, http.MethodPost, "/roles", Role{Name: "child", ParentIDs: []uint{parent.ID}}, nil); status != http.StatusCreated {
+		t.Fatalf("create child role = %d", status)
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		body   interface{}
+		status int
+	}{
+		{http.MethodGet, "/users/999", nil, http.StatusNotFound},
+		{http.MethodPut, "/users/999", map[string]string{"job": "dev"}, http.StatusNotFound},
+		{http.MethodDelete, "/groups/999", nil, http.StatusNotFound},
+		{http.MethodGet, "/builds/999", nil, http.StatusNotFound},
+		{http.MethodGet, "/nothing", nil, http.StatusNotFound},
+		{http.MethodGet, "/users/abc", nil, http.StatusBadRequest},
+		{http.MethodPost, "/users", map[string]string{"name": "bob", "email": "bob@example.org", "salary": "1"}, http.StatusBadRequest},
+		{http.MethodPost, "/users", User{Name: "bob"}, http.StatusBadRequest},
+		{http.MethodPost, "/users", User{Name: "alice", Email: "other@example.org"}, http.StatusConflict},
+		{http.MethodPost, "/users", User{Name: "bob", Email: alice.Email}, http.StatusConflict},
+		{http.MethodPost, "/roles", Role{Name: "base"}, http.StatusConflict},
+		{http.MethodDelete, fmt.Sprintf("/roles/%d", parent.ID), nil, http.StatusConflict},
+		{http.MethodPost, "/users", User{Name: "bob", Email: "bob@example.org"}, http.StatusCreated},
+		{http.MethodPut, fmt.Sprintf("/users/%d", alice.ID), map[string]string{"name": "bob"}, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		if status := ts.do(ts.admin, tt.method, tt.path, tt.body, nil); status != tt.status {
+			t.Errorf("%s %s = %d, want %d", tt.method, tt.path, status, tt.status)
+		}
+	}
+}
+
+// TestPersonalTokenScope 个人访问令牌只能在其范围内使用用户的权限, 范围不能扩大用户本身的权限
+func TestPersonalTokenScope(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.user("alice")
+	ts.bind(alice, ts.role("editor", "user:*", "group:read"), model.Scope{})
+	token := func(scopes ...string) string {
+		value, _, err := ts.authn.CreatePersonalToken(alice.ID, strings.Join(scopes, ","), scopes, 0)
+		ts.check(err)
+		return value
+	}
+	read, all, wide := token("user:read"), token("*:read"), token("*:*")
+
+	tests := []struct {
+		token  string
+		method string
+		path   string
+		body   interface{}
+		status int
+	}{
+		{read, http.MethodGet, "/users", nil, http.StatusOK},
+		{read, http.MethodPost, "/users", User{Name: "bob", Email: "bob@example.org"}, http.StatusForbidden},
+		{read, http.MethodGet, "/groups", nil, http.StatusForbidden},
+		{all, http.MethodGet, "/groups", nil, http.StatusOK},
+		{all, http.MethodPost, "/groups", Group{Name: "dev"}, http.StatusForbidden},
+		{wide, http.MethodPost, "/groups", Group{Name: "dev"}, http.StatusForbidden},
+		{wide, http.MethodGet, "/roles", nil, http.StatusForbidden},
+		{wide, http.MethodPost, "/users", User{Name: "bob", Email: "bob@example.org"}, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		if status := ts.do(tt.token, tt.method, tt.path, tt.body, nil); status != tt.status {
+			t.Errorf("%s %s = %d, want %d", tt.method, tt.path, status, tt.status)
+		}
+	}
+}
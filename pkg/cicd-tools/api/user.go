@@ -0,0 +1,440 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+// User 不包含密码, source、locked_until 与时间字段只读
+type User struct {
+	ID             uint       `json:"id" api:"readonly" column:"id"`
+	Name           string     `json:"name" column:"user_name"`
+	Email          string     `json:"email" column:"email_address"`
+	FullName       string     `json:"full_name" column:"full_name"`
+	Gender         string     `json:"gender" column:"gender"`
+	Age            uint       `json:"age" column:"age"`
+	Location       string     `json:"location" column:"location"`
+	Job            string     `json:"job" column:"job"`
+	Mobile         string     `json:"mobile" column:"mobile"`
+	DingTalkID     string     `json:"dingtalk_id" column:"dingtalk_id"`
+	WXWorkID       string     `json:"wxwork_id" column:"wxwork_id"`
+	ServiceAccount bool       `json:"service_account" column:"service_account"`
+	Source         string     `json:"source" api:"readonly" column:"source"`
+	Disabled       bool       `json:"disabled" column:"disabled"`
+	LockedUntil    *time.Time `json:"locked_until" api:"readonly" column:"locked_until"`
+	CreatedAt      time.Time  `json:"created_at" api:"readonly" column:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at" api:"readonly" column:"updated_at"`
+}
+
+func newUser(u *model.User) User {
+	return User{
+		ID:             u.ID,
+		Name:           u.Name,
+		Email:          u.Email,
+		FullName:       u.FullName,
+		Gender:         u.Gender,
+		Age:            u.Age,
+		Location:       u.Location,
+		Job:            u.Job,
+		Mobile:         u.Mobile,
+		DingTalkID:     u.DingTalkID,
+		WXWorkID:       u.WXWorkID,
+		ServiceAccount: u.ServiceAccount,
+		Source:         u.Source,
+		Disabled:       u.Disabled,
+		LockedUntil:    u.LockedUntil,
+		CreatedAt:      u.CreatedAt,
+		UpdatedAt:      u.UpdatedAt,
+	}
+}
+
+func (v User) apply(u *model.User) {
+	u.Name = v.Name
+	u.Email = v.Email
+	u.FullName = v.FullName
+	u.Gender = v.Gender
+	u.Age = v.Age
+	u.Location = v.Location
+	u.Job = v.Job
+	u.Mobile = v.Mobile
+	u.DingTalkID = v.DingTalkID
+	u.WXWorkID = v.WXWorkID
+	u.ServiceAccount = v.ServiceAccount
+	u.Disabled = v.Disabled
+}
+
+// PasswordChange 用户修改自己的密码时需提供 current_password
+type PasswordChange struct {
+	Password        string `json:"password"`
+	CurrentPassword string `json:"current_password"`
+}
+
+// Membership 将用户加入组的请求体
+type Membership struct {
+	GroupID uint `json:"group_id"`
+}
+
+// Binding 用户或组的角色绑定, project_id 为 0 时为全局绑定, env_id 为 0 时在项目的全部环境生效
+type Binding struct {
+	ID        uint       `json:"id" api:"readonly" column:"id"`
+	RoleID    uint       `json:"role_id" column:"role_id"`
+	ProjectID uint       `json:"project_id" column:"project_id"`
+	EnvID     uint       `json:"env_id"`
+	ExpiresAt *time.Time `json:"expires_at" column:"expires_at"`
+}
+
+func (s *Server) userRoutes() {
+	s.routes.add(Operation{Method: http.MethodGet, Path: "/me", ID: "GetMe", Summary: "查看当前用户", Response: User{}}, s.me)
+	s.routes.add(Operation{Method: http.MethodGet, Path: "/users", ID: "ListUsers", Summary: "查看用户", Query: ListQuery{}, Response: []User{}}, s.listUsers)
+	s.routes.add(Operation{Method: http.MethodPost, Path: "/users", ID: "CreateUser", Summary: "创建用户", Body: User{}, Response: User{}, Status: http.StatusCreated}, s.createUser)
+	s.routes.add(Operation{Method: http.MethodGet, Path: "/users/{id}", ID: "GetUser", Summary: "查看用户详情", Response: User{}}, s.getUser)
+	s.routes.add(Operation{Method: http.MethodPut, Path: "/users/{id}", ID: "UpdateUser", Summary: "更新用户", Body: User{}, Response: User{}}, s.updateUser)
+	s.routes.add(Operation{Method: http.MethodDelete, Path: "/users/{id}", ID: "DeleteUser", Summary: "删除用户"}, s.deleteUser)
+	s.routes.add(Operation{Method: http.MethodPut, Path: "/users/{id}/password", ID: "SetPassword", Summary: "设置用户密码", Body: PasswordChange{}}, s.setPassword)
+	s.routes.add(Operation{Method: http.MethodGet, Path: "/users/{id}/groups", ID: "ListUserGroups", Summary: "查看用户所属的组", Query: ListQuery{}, Response: []Group{}}, s.userGroups)
+	s.routes.add(Operation{Method: http.MethodPost, Path: "/users/{id}/groups", ID: "AddUserGroup", Summary: "将用户加入组", Body: Membership{}}, s.addUserGroup)
+	s.routes.add(Operation{Method: http.MethodDelete, Path: "/users/{id}/groups/{group_id}", ID: "RemoveUserGroup", Summary: "将用户移出组"}, s.removeUserGroup)
+	s.routes.add(Operation{Method: http.MethodGet, Path: "/users/{id}/roles", ID: "ListUserBindings", Summary: "查看用户的角色绑定", Query: ListQuery{}, Response: []Binding{}}, s.userBindings)
+	s.routes.add(Operation{Method: http.MethodPost, Path: "/users/{id}/roles", ID: "AddUserBinding", Summary: "为用户绑定角色", Body: Binding{}, Response: Binding{}, Status: http.StatusCreated}, s.addUserBinding)
+	s.routes.add(Operation{Method: http.MethodDelete, Path: "/users/{id}/roles/{binding_id}", ID: "RemoveUserBinding", Summary: "解除用户的角色绑定"}, s.removeUserBinding)
+}
+
+// me 返回令牌对应的用户, 不需要额外权限
+func (s *Server) me(c *call) error {
+	u, err := s.store.Users().Get(c.id.UserID)
+	if err != nil {
+		return err
+	}
+	return c.json(http.StatusOK, newUser(u))
+}
+
+func (s *Server) listUsers(c *call) error {
+	var q ListQuery
+	if err := c.decodeQuery(&q); err != nil {
+		return err
+	}
+	if err := c.authorize(CategoryUser, ActionRead, 0, model.Scope{}); err != nil {
+		return err
+	}
+	var users []model.User
+	page, err := s.list(&model.User{}, q, User{}, &users)
+	if err != nil {
+		return err
+	}
+	items := make([]User, 0, len(users))
+	for i := range users {
+		items = append(items, newUser(&users[i]))
+	}
+	return c.page(items, page)
+}
+
+func (s *Server) createUser(c *call) error {
+	if err := c.authorize(CategoryUser, ActionCreate, 0, model.Scope{}); err != nil {
+		return err
+	}
+	var v User
+	if err := c.decode(&v); err != nil {
+		return err
+	}
+	if v.Name == "" || v.Email == "" {
+		return badRequest(errors.New("用户需指定name与email"))
+	}
+	if err := s.checkUnique(v, 0); err != nil {
+		return err
+	}
+	u := new(model.User)
+	v.apply(u)
+	if err := s.store.Users().Create(u); err != nil {
+		return fmt.Errorf("创建用户%s失败\n%w", v.Name, err)
+	}
+	return c.json(http.StatusCreated, newUser(u))
+}
+
+// user 读取路径中的用户, 用户查看和修改自己时不需要 rbac 权限, 但令牌范围仍需允许该操作
+func (s *Server) user(c *call, action string) (*model.User, error) {
+	id, err := c.uint("id")
+	if err != nil {
+		return nil, err
+	}
+	if id == c.id.UserID && (action == ActionRead || action == ActionUpdate) {
+		if !c.id.Allows(CategoryUser, action) {
+			return nil, forbidden(fmt.Errorf("令牌范围不允许%s:%s", CategoryUser, action))
+		}
+	} else if err := c.authorize(CategoryUser, action, id, model.Scope{}); err != nil {
+		return nil, err
+	}
+	u, err := s.store.Users().Get(id)
+	if err != nil {
+		return nil, fmt.Errorf("用户%d不存在\n%w", id, err)
+	}
+	return u, nil
+}
+
+func (s *Server) getUser(c *call) error {
+	u, err := s.user(c, ActionRead)
+	if err != nil {
+		return err
+	}
+	return c.json(http.StatusOK, newUser(u))
+}
+
+// updateUser 请求体中未出现的字段保持不变, 用户修改自己时不能修改 disabled 与 service_account
+func (s *Server) updateUser(c *call) error {
+	u, err := s.user(c, ActionUpdate)
+	if err != nil {
+		return err
+	}
+	v := newUser(u)
+	if err := c.decode(&v); err != nil {
+		return err
+	}
+	if u.ID == c.id.UserID && (v.Disabled != u.Disabled || v.ServiceAccount != u.ServiceAccount) {
+		if err := c.authorize(CategoryUser, ActionUpdate, u.ID, model.Scope{}); err != nil {
+			return err
+		}
+	}
+	if v.Name == "" || v.Email == "" {
+		return badRequest(errors.New("用户需指定name与email"))
+	}
+	if err := s.checkUnique(v, u.ID); err != nil {
+		return err
+	}
+	v.apply(u)
+	// 只更新资料列, 并发的修改密码、注销全部会话与锁定不会被覆盖
+	if err := s.store.Users().UpdateProfile(u); err != nil {
+		return fmt.Errorf("用户%v数据更新失败\n%w", u.Name, err)
+	}
+	return c.json(http.StatusOK, newUser(u))
+}
+
+// checkUnique 用户名或邮箱已被 id 以外的用户使用时返回 409
+func (s *Server) checkUnique(v User, id uint) error {
+	found, err := s.store.Users().First(&model.User{Name: v.Name})
+	if err == nil && found.ID != id {
+		return conflict(fmt.Errorf("用户%s已存在", v.Name))
+	} else if err != nil && !errors.Is(err, model.ErrNotFound) {
+		return fmt.Errorf("查询用户%s失败\n%w", v.Name, err)
+	}
+	found, err = s.store.Users().First(&model.User{Email: v.Email})
+	if err == nil && found.ID != id {
+		return conflict(fmt.Errorf("邮箱%s已被用户%s使用", v.Email, found.Name))
+	} else if err != nil && !errors.Is(err, model.ErrNotFound) {
+		return fmt.Errorf("查询邮箱%s失败\n%w", v.Email, err)
+	}
+	return nil
+}
+
+func (s *Server) deleteUser(c *call) error {
+	u, err := s.user(c, ActionDelete)
+	if err != nil {
+		return err
+	}
+	if err := s.store.Users().Delete(u.ID); err != nil {
+		return fmt.Errorf("删除用户%s失败\n%w", u.Name, err)
+	}
+	return c.noContent()
+}
+
+// setPassword 按密码策略校验, 不满足时返回 400; 用户修改自己的密码时需校验当前密码,
+// 设置后该用户已签发的令牌与个人访问令牌全部失效
+func (s *Server) setPassword(c *call) error {
+	u, err := s.user(c, ActionUpdate)
+	if err != nil {
+		return err
+	}
+	var body PasswordChange
+	if err := c.decode(&body); err != nil {
+		return err
+	}
+	if u.ID == c.id.UserID && !u.VerifyPassword(body.CurrentPassword) {
+		return forbidden(errors.New("当前密码错误"))
+	}
+	if u.SetPassword(body.Password); u.Error != nil {
+		return badRequest(u.Error)
+	}
+	return c.noContent()
+}
+
+func (s *Server) userGroups(c *call) error {
+	var q ListQuery
+	if err := c.decodeQuery(&q); err != nil {
+		return err
+	}
+	u, err := s.user(c, ActionRead)
+	if err != nil {
+		return err
+	}
+	var groups []model.Group
+	page, err := s.listVia(model.GroupsOfUser(u.ID), &model.Group{}, q, Group{}, &groups)
+	if err != nil {
+		return err
+	}
+	return c.page(newGroups(groups), page)
+}
+
+// addUserGroup 修改组成员需要该组的 group:update 权限
+func (s *Server) addUserGroup(c *call) error {
+	u, err := s.user(c, ActionRead)
+	if err != nil {
+		return err
+	}
+	var body Membership
+	if err := c.decode(&body); err != nil {
+		return err
+	}
+	g, err := s.group(c, body.GroupID, ActionUpdate)
+	if err != nil {
+		return err
+	}
+	if _, err := s.store.Users().AddGroup(u.ID, g.ID); err != nil {
+		return fmt.Errorf("用户%s添加到组%s时发生错误\n%w", u.Name, g.Name, err)
+	}
+	return c.noContent()
+}
+
+func (s *Server) removeUserGroup(c *call) error {
+	u, err := s.user(c, ActionRead)
+	if err != nil {
+		return err
+	}
+	gid, err := c.uint("group_id")
+	if err != nil {
+		return err
+	}
+	g, err := s.group(c, gid, ActionUpdate)
+	if err != nil {
+		return err
+	}
+	if err := s.store.Users().RemoveGroup(u.ID, g.ID); err != nil {
+		return fmt.Errorf("用户%s移出组%s失败\n%w", u.Name, g.Name, err)
+	}
+	return c.noContent()
+}
+
+func (s *Server) userBindings(c *call) error {
+	var q ListQuery
+	if err := c.decodeQuery(&q); err != nil {
+		return err
+	}
+	u, err := s.user(c, ActionRead)
+	if err != nil {
+		return err
+	}
+	var rows []model.UserRole
+	page, err := s.list(&model.UserRole{UserID: u.ID}, q, Binding{}, &rows)
+	if err != nil {
+		return err
+	}
+	items := make([]Binding, 0, len(rows))
+	for _, row := range rows {
+		b, err := s.binding(row.ID, row.RoleID, row.ProjectID, row.ProjectEnvID, row.ExpiresAt)
+		if err != nil {
+			return err
+		}
+		items = append(items, b)
+	}
+	return c.page(items, page)
+}
+
+func (s *Server) addUserBinding(c *call) error {
+	u, err := s.user(c, ActionRead)
+	if err != nil {
+		return err
+	}
+	b, projectEnvID, err := s.bindRequest(c)
+	if err != nil {
+		return err
+	}
+	ur := &model.UserRole{UserID: u.ID, RoleID: b.RoleID, ProjectID: b.ProjectID, ProjectEnvID: projectEnvID, ExpiresAt: b.ExpiresAt}
+	if err := s.store.Users().AddRoleBinding(ur); err != nil {
+		return fmt.Errorf("用户%s绑定角色%d时发生错误\n%w", u.Name, b.RoleID, err)
+	}
+	b.ID = ur.ID
+	return c.json(http.StatusCreated, b)
+}
+
+func (s *Server) removeUserBinding(c *call) error {
+	u, err := s.user(c, ActionRead)
+	if err != nil {
+		return err
+	}
+	id, err := c.uint("binding_id")
+	if err != nil {
+		return err
+	}
+	rows, err := s.store.Users().RoleBindings(u.ID)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if row.ID != id {
+			continue
+		}
+		if err := s.unbind(c, row.RoleID, row.ProjectID, row.ProjectEnvID); err != nil {
+			return err
+		}
+		if err := s.store.Users().RemoveRoleBinding(id); err != nil {
+			return fmt.Errorf("用户%s解除角色绑定%d失败\n%w", u.Name, id, err)
+		}
+		return c.noContent()
+	}
+	return fmt.Errorf("用户%s没有角色绑定%d\n%w", u.Name, id, model.ErrNotFound)
+}
+
+// binding 将绑定表中的项目环境编号转换为环境编号
+func (s *Server) binding(id uint, roleID uint, projectID uint, projectEnvID uint, expiresAt *time.Time) (Binding, error) {
+	scope, err := model.BindingScope(s.store, projectID, projectEnvID)
+	if err != nil {
+		return Binding{}, err
+	}
+	return Binding{ID: id, RoleID: roleID, ProjectID: scope.ProjectID, EnvID: scope.EnvID, ExpiresAt: expiresAt}, nil
+}
+
+// bindRequest 解析绑定请求并检查 role:bind 权限, 返回绑定与绑定表中的项目环境编号
+func (s *Server) bindRequest(c *call) (Binding, uint, error) {
+	var b Binding
+	if err := c.decode(&b); err != nil {
+		return b, 0, err
+	}
+	if _, err := s.store.Roles().Get(b.RoleID); err != nil {
+		return b, 0, badRequest(fmt.Errorf("角色%d不存在", b.RoleID))
+	}
+	scope := model.Scope{ProjectID: b.ProjectID, EnvID: b.EnvID}
+	if err := c.authorize(CategoryRole, ActionBind, b.RoleID, scope); err != nil {
+		return b, 0, err
+	}
+	_, projectEnvID, err := model.ResolveScope(s.store, scope)
+	if err != nil {
+		return b, 0, badRequest(err)
+	}
+	return b, projectEnvID, nil
+}
+
+// unbind 解除绑定同样需要在绑定范围内拥有该角色的 role:bind 权限
+func (s *Server) unbind(c *call, roleID uint, projectID uint, projectEnvID uint) error {
+	scope, err := model.BindingScope(s.store, projectID, projectEnvID)
+	if err != nil {
+		return err
+	}
+	return c.authorize(CategoryRole, ActionBind, roleID, scope)
+}
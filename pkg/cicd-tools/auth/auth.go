@@ -15,3 +15,365 @@
  */
 
 package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"devops/cicd-tools/pkg/cicd-tools/config"
+	"devops/cicd-tools/pkg/cicd-tools/model"
+	"devops/cicd-tools/pkg/cicd-tools/rbac"
+)
+
+var (
+	// ErrInvalidCredentials 用户不存在与密码错误返回同一错误, 避免泄露用户是否存在
+	ErrInvalidCredentials = errors.New("用户名或密码错误")
+	ErrInvalidToken       = errors.New("令牌无效")
+	ErrRevoked            = errors.New("令牌已吊销")
+	// ErrInternal 服务器内部错误只返回该错误, 详细信息记录在日志中
+	ErrInternal = errors.New("服务器内部错误")
+
+	errNoTokens = errors.New("未配置令牌签名密钥, 只支持个人访问令牌")
+)
+
+// Identity 令牌对应的用户身份, Roles 为签发时用户的全局有效角色,
+// Scopes 为个人访问令牌的范围, 为空表示不限制, ExpiresAt 为零值表示长期有效
+type Identity struct {
+	UserID    uint
+	Name      string
+	Roles     []string
+	Scopes    []string
+	TokenID   string
+	ExpiresAt time.Time
+}
+
+// Allows 判断令牌范围是否允许 category 下的 action, 用户本身的权限仍需通过 rbac 鉴权
+func (i *Identity) Allows(category string, action string) bool {
+	return i.Scopes == nil || ScopeAllows(i.Scopes, category, action)
+}
+
+func (i *Identity) HasRole(name string) bool {
+	for _, value := range i.Roles {
+		if value == name {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenPair 登录或刷新后返回的令牌
+type TokenPair struct {
+	AccessToken  string    `json:"access_token" yaml:"access_token"`
+	RefreshToken string    `json:"refresh_token" yaml:"refresh_token"`
+	TokenType    string    `json:"token_type" yaml:"token_type"`
+	ExpiresAt    time.Time `json:"expires_at" yaml:"expires_at"`
+}
+
+// Provider 外部认证源, 如 LDAP. Login 校验成功后返回对应的本地用户, 必要时创建或更新该用户;
+// 用户不属于该认证源或密码错误时返回 ErrInvalidCredentials
+type Provider interface {
+	// Name 与该认证源创建的用户的 User.Source 相同
+	Name() string
+	Login(name string, password string) (*model.User, error)
+}
+
+// Authenticator 校验用户密码并签发、校验、吊销令牌, tokens 为空时只支持个人访问令牌
+type Authenticator struct {
+	store     model.Store
+	tokens    *Tokens
+	providers []Provider
+	mfa       *MFA
+	lockout   config.Lockout
+	now       func() time.Time
+}
+
+func NewAuthenticator(s model.Store, tokens *Tokens) *Authenticator {
+	return &Authenticator{store: s, tokens: tokens, now: time.Now}
+}
+
+// AddProvider 添加外部认证源, 按添加顺序尝试
+func (a *Authenticator) AddProvider(p Provider) *Authenticator {
+	a.providers = append(a.providers, p)
+	return a
+}
+
+// WithMFA 启用多因素认证, 登录时按 MFA 的配置要求验证码
+func (a *Authenticator) WithMFA(m *MFA) *Authenticator {
+	a.mfa = m
+	return a
+}
+
+// Login 校验用户名与密码, 成功后签发访问令牌和刷新令牌
+// 本地用户校验本地密码, 外部来源的用户以及本地不存在的用户交给对应的 Provider 校验
+func (a *Authenticator) Login(name string, plain string) (*TokenPair, error) {
+	return a.LoginWithCode(name, plain, "")
+}
+
+// LoginWithCode 与 Login 相同, 已启用多因素认证的用户需要提供 TOTP 验证码或恢复码,
+// 未提供时返回 ErrMFARequired, 调用方可以提示用户输入后重试
+func (a *Authenticator) LoginWithCode(name string, plain string, code string) (*TokenPair, error) {
+	return a.LoginContext(context.Background(), name, plain, code)
+}
+
+// LoginContext 与 LoginWithCode 相同, ctx 中的 ClientInfo 记录到登录记录;
+// 已停用或处于锁定期的用户直接拒绝, 密码或验证码错误计入连续失败次数;
+// 用户不存在、密码错误、已停用与已锁定均返回 ErrInvalidCredentials, 具体原因只记录在服务端
+func (a *Authenticator) LoginContext(ctx context.Context, name string, plain string, code string) (*TokenPair, error) {
+	if a.tokens == nil {
+		return nil, errNoTokens
+	}
+	u, err := a.store.Users().First(&model.User{Name: name})
+	if errors.Is(err, model.ErrNotFound) {
+		u = nil
+	} else if err != nil {
+		return nil, fmt.Errorf("查询用户%s失败\n%w", name, err)
+	}
+	if u != nil {
+		if err := a.usable(u); err != nil {
+			// 与校验密码的耗时相近, 响应时间同样不泄露用户状态
+			model.HashDummyPassword(plain)
+			return nil, conceal(name, a.failed(ctx, u, name, model.LoginMethodPassword, err))
+		}
+	}
+	found, err := a.verify(u, name, plain)
+	if err != nil {
+		return nil, conceal(name, a.failed(ctx, u, name, model.LoginMethodPassword, err))
+	}
+	if err := a.usable(found); err != nil {
+		return nil, conceal(name, a.failed(ctx, found, name, model.LoginMethodPassword, err))
+	}
+	if a.mfa != nil {
+		if err := a.mfa.check(found, code); err != nil {
+			return nil, conceal(name, a.failed(ctx, found, name, model.LoginMethodPassword, err))
+		}
+	}
+	pair, err := a.issue(found)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.succeeded(ctx, found, model.LoginMethodPassword); err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// LoginUser 为已由外部认证 (如 OIDC) 确认身份的用户签发令牌, 多因素认证由外部认证服务负责,
+// 登录方式按用户来源记录
+func (a *Authenticator) LoginUser(ctx context.Context, u *model.User) (*TokenPair, error) {
+	if a.tokens == nil {
+		return nil, errNoTokens
+	}
+	if u.ServiceAccount {
+		return nil, fmt.Errorf("%w\n服务账号%s只能使用个人访问令牌", ErrInvalidCredentials, u.Name)
+	}
+	if err := a.usable(u); err != nil {
+		return nil, a.failed(ctx, u, u.Name, u.Source, err)
+	}
+	pair, err := a.issue(u)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.succeeded(ctx, u, u.Source); err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// verify 校验密码并返回用户, u 为按用户名查到的用户, 不存在时为 nil
+func (a *Authenticator) verify(u *model.User, name string, plain string) (*model.User, error) {
+	if u != nil && u.ServiceAccount {
+		return nil, fmt.Errorf("%w\n服务账号%s只能使用个人访问令牌", ErrInvalidCredentials, name)
+	}
+	if u != nil && u.Source == model.SourceLocal {
+		if !u.VerifyPassword(plain) {
+			if u.Error != nil {
+				return nil, fmt.Errorf("%w\n%v", ErrInvalidCredentials, u.Error)
+			}
+			return nil, ErrInvalidCredentials
+		}
+		return u, nil
+	}
+	for _, p := range a.providers {
+		if u != nil && u.Source != p.Name() {
+			continue
+		}
+		found, err := p.Login(name, plain)
+		if err == nil {
+			return found, nil
+		}
+		if !errors.Is(err, ErrInvalidCredentials) {
+			return nil, err
+		}
+	}
+	// 用户不存在时无论是否配置了外部认证源都计算一次哈希
+	if u == nil {
+		model.HashDummyPassword(plain)
+	}
+	return nil, ErrInvalidCredentials
+}
+
+// Refresh 使用刷新令牌换取新的令牌, 旧的刷新令牌随即吊销
+func (a *Authenticator) Refresh(refreshToken string) (*TokenPair, error) {
+	if a.tokens == nil {
+		return nil, errNoTokens
+	}
+	claims, err := a.check(refreshToken, TypeRefresh)
+	if err != nil {
+		return nil, err
+	}
+	uid, _ := claims.UserID()
+	u, err := a.store.Users().Get(uid)
+	if err != nil {
+		return nil, fmt.Errorf("%w: 用户%d不存在", ErrInvalidToken, uid)
+	}
+	if u.Disabled {
+		return nil, fmt.Errorf("%w\n用户%s已停用", ErrDisabled, u.Name)
+	}
+	if claims.Version != u.TokenVersion {
+		return nil, ErrRevoked
+	}
+	// 吊销与检查在同一次插入中完成, 并发使用同一刷新令牌时只有一个请求能换取新令牌
+	revoked, err := a.revoke(claims)
+	if err != nil {
+		return nil, err
+	}
+	if !revoked {
+		return nil, ErrRevoked
+	}
+	return a.issue(u)
+}
+
+// Authenticate 校验访问令牌或个人访问令牌并返回用户身份
+func (a *Authenticator) Authenticate(accessToken string) (*Identity, error) {
+	if strings.HasPrefix(accessToken, PersonalTokenPrefix) {
+		return a.authenticatePersonal(accessToken)
+	}
+	if a.tokens == nil {
+		return nil, errNoTokens
+	}
+	claims, err := a.check(accessToken, TypeAccess)
+	if err != nil {
+		return nil, err
+	}
+	uid, _ := claims.UserID()
+	u, err := a.store.Users().Get(uid)
+	if err != nil {
+		return nil, fmt.Errorf("%w: 用户%d不存在", ErrInvalidToken, uid)
+	}
+	if u.Disabled {
+		return nil, fmt.Errorf("%w\n用户%s已停用", ErrDisabled, u.Name)
+	}
+	if claims.Version != u.TokenVersion {
+		return nil, ErrRevoked
+	}
+	return &Identity{
+		UserID:    uid,
+		Name:      claims.Name,
+		Roles:     claims.Roles,
+		TokenID:   claims.ID,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}, nil
+}
+
+// Revoke 吊销访问令牌或刷新令牌, 已失效的令牌直接忽略
+func (a *Authenticator) Revoke(tokens ...string) error {
+	if a.tokens == nil {
+		return errNoTokens
+	}
+	for _, value := range tokens {
+		if value == "" {
+			continue
+		}
+		claims, err := a.tokens.Parse(value, TypeAccess)
+		if err != nil {
+			claims, err = a.tokens.Parse(value, TypeRefresh)
+		}
+		if err != nil {
+			continue
+		}
+		if _, err := a.revoke(claims); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PurgeRevoked 清理已过期令牌的吊销记录
+func (a *Authenticator) PurgeRevoked() error {
+	return a.store.Tokens().Purge(a.now())
+}
+
+func (a *Authenticator) check(token string, typ string) (*Claims, error) {
+	claims, err := a.tokens.Parse(token, typ)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := claims.UserID(); err != nil {
+		return nil, err
+	}
+	revoked, err := a.store.Tokens().IsRevoked(claims.ID)
+	if err != nil {
+		return nil, fmt.Errorf("查询令牌吊销列表失败\n%w", err)
+	}
+	if revoked {
+		return nil, ErrRevoked
+	}
+	return claims, nil
+}
+
+// revoke 返回令牌是否由本次调用吊销, 已吊销的令牌返回 false
+func (a *Authenticator) revoke(claims *Claims) (bool, error) {
+	uid, _ := claims.UserID()
+	revoked, err := a.store.Tokens().Revoke(&model.RevokedToken{
+		TokenID:   claims.ID,
+		UserID:    uid,
+		ExpiresAt: claims.ExpiresAt.Time,
+	})
+	if err != nil {
+		return false, fmt.Errorf("吊销令牌失败\n%w", err)
+	}
+	return revoked, nil
+}
+
+func (a *Authenticator) issue(u *model.User) (*TokenPair, error) {
+	roles, err := a.roles(u.ID)
+	if err != nil {
+		return nil, err
+	}
+	access, claims, err := a.tokens.Issue(TypeAccess, u.ID, u.Name, u.TokenVersion, roles)
+	if err != nil {
+		return nil, err
+	}
+	refresh, _, err := a.tokens.Issue(TypeRefresh, u.ID, u.Name, u.TokenVersion, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresAt:    claims.ExpiresAt.Time,
+	}, nil
+}
+
+// roles 返回用户全局有效角色的名称, 项目范围内的角色在鉴权时按请求范围另行计算
+func (a *Authenticator) roles(uid uint) ([]string, error) {
+	grants, err := rbac.NewAuthorizer(a.store).EffectiveRoles(uid, model.Scope{})
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var names []string
+	for _, value := range grants {
+		if !seen[value.Role.Name] {
+			seen[value.Role.Name] = true
+			names = append(names, value.Role.Name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,153 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"devops/cicd-tools/pkg/util/logger"
+)
+
+type contextKey struct{}
+
+// FromContext 返回 Middleware 写入请求上下文的用户身份
+func FromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(contextKey{}).(*Identity)
+	return id, ok
+}
+
+func NewContext(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// BearerToken 从 Authorization: Bearer <token> 请求头中取出令牌
+func BearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+// Middleware 校验请求中的访问令牌, 校验失败返回 401, 成功后可通过 FromContext 获取用户身份
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := BearerToken(r)
+		if token == "" {
+			WriteError(w, http.StatusUnauthorized, errors.New("缺少访问令牌"))
+			return
+		}
+		id, err := a.Authenticate(token)
+		if err != nil {
+			WriteError(w, http.StatusUnauthorized, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), id)))
+	})
+}
+
+// Handler 提供 POST /login, /refresh, /logout 接口, 请求与响应均为 JSON;
+// 启用多因素认证的用户在 /login 中通过 otp 字段提供验证码, 缺少时返回 401 与 "mfa_required": true;
+// 登录记录中的 IP 取自连接的对端地址
+func (a *Authenticator) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", post(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+			OTP      string `json:"otp"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		pair, err := a.LoginContext(WithClient(r.Context(), ClientFromRequest(r)), body.Username, body.Password, body.OTP)
+		switch {
+		case errors.Is(err, ErrMFARequired):
+			WriteJSON(w, http.StatusUnauthorized, map[string]interface{}{"error": err.Error(), "mfa_required": true})
+			return
+		case errors.Is(err, ErrMFAInvalid), errors.Is(err, ErrMFANotEnrolled):
+			WriteError(w, http.StatusUnauthorized, err)
+			return
+		case err != nil:
+			WriteError(w, http.StatusUnauthorized, ErrInvalidCredentials)
+			return
+		}
+		WriteJSON(w, http.StatusOK, pair)
+	}))
+	mux.HandleFunc("/refresh", post(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		pair, err := a.Refresh(body.RefreshToken)
+		if err != nil {
+			WriteError(w, http.StatusUnauthorized, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, pair)
+	}))
+	mux.HandleFunc("/logout", post(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				WriteError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+		if err := a.Revoke(BearerToken(r), body.RefreshToken); err != nil {
+			logger.Error(fmt.Errorf("注销失败\n%w", err))
+			WriteError(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	return mux
+}
+
+func post(fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			WriteError(w, http.StatusMethodNotAllowed, errors.New("只支持POST请求"))
+			return
+		}
+		fn(w, r)
+	}
+}
+
+// WriteJSON 以 JSON 格式写入响应
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// WriteError 写入 {"error": ...} 响应, 只包含错误的第一行, 不暴露底层错误
+func WriteError(w http.ResponseWriter, status int, err error) {
+	WriteJSON(w, status, map[string]string{"error": strings.SplitN(err.Error(), "\n", 2)[0]})
+}
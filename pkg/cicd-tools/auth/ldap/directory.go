@@ -0,0 +1,208 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package ldap
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+
+	goldap "github.com/go-ldap/ldap/v3"
+
+	"devops/cicd-tools/pkg/cicd-tools/config"
+)
+
+// ErrInvalidCredentials 用户不存在或密码错误
+var ErrInvalidCredentials = errors.New("LDAP用户名或密码错误")
+
+// Entry 目录中的用户, 属性按配置映射到 User 的 Name, Email, FullName, Mobile
+type Entry struct {
+	DN       string
+	Username string
+	Email    string
+	FullName string
+	Mobile   string
+}
+
+// GroupEntry 目录中的组, Members 为成员的 DN 或用户名 (posixGroup 的 memberUid)
+type GroupEntry struct {
+	DN      string
+	Name    string
+	Members []string
+}
+
+// Directory 用户目录, 同步与认证只依赖该接口, 便于替换为测试用的实现
+type Directory interface {
+	// Authenticate 校验用户名与密码, 失败返回 ErrInvalidCredentials
+	Authenticate(username string, password string) (*Entry, error)
+	Users() ([]Entry, error)
+	Groups() ([]GroupEntry, error)
+}
+
+// Client 基于 LDAP 协议的 Directory 实现, 每次操作使用新的连接
+type Client struct {
+	config config.LDAP
+}
+
+func NewClient(c config.LDAP) *Client {
+	return &Client{config: c}
+}
+
+func (c *Client) Authenticate(username string, password string) (*Entry, error) {
+	// 空密码会被服务端当作匿名绑定而成功, 必须提前拒绝
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+	conn, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	filter := fmt.Sprintf("(&%s(%s=%s))", c.config.UserFilter, c.config.UsernameAttr, goldap.EscapeFilter(username))
+	entries, err := c.search(conn, c.config.BaseDN, filter, c.userAttributes())
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	if err := conn.Bind(entries[0].DN, password); err != nil {
+		if goldap.IsErrorWithCode(err, goldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("LDAP用户%s绑定失败\n%w", username, err)
+	}
+	entry := c.entry(entries[0])
+	return &entry, nil
+}
+
+func (c *Client) Users() ([]Entry, error) {
+	conn, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	entries, err := c.search(conn, c.config.BaseDN, c.config.UserFilter, c.userAttributes())
+	if err != nil {
+		return nil, err
+	}
+	var users []Entry
+	for _, value := range entries {
+		entry := c.entry(value)
+		if entry.Username == "" {
+			continue
+		}
+		users = append(users, entry)
+	}
+	return users, nil
+}
+
+func (c *Client) Groups() ([]GroupEntry, error) {
+	conn, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	base := c.config.GroupBaseDN
+	if base == "" {
+		base = c.config.BaseDN
+	}
+	entries, err := c.search(conn, base, c.config.GroupFilter, []string{c.config.GroupNameAttr, c.config.GroupMemberAttr})
+	if err != nil {
+		return nil, err
+	}
+	var groups []GroupEntry
+	for _, value := range entries {
+		name := value.GetAttributeValue(c.config.GroupNameAttr)
+		if name == "" {
+			continue
+		}
+		groups = append(groups, GroupEntry{
+			DN:      value.DN,
+			Name:    name,
+			Members: value.GetAttributeValues(c.config.GroupMemberAttr),
+		})
+	}
+	return groups, nil
+}
+
+// dial 建立连接, 配置了 BindDN 时使用服务账号绑定, 否则匿名查询
+func (c *Client) dial() (*goldap.Conn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: c.config.InsecureSkipVerify}
+	conn, err := goldap.DialURL(c.config.URL, goldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("连接LDAP服务%s失败\n%w", c.config.URL, err)
+	}
+	if c.config.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("LDAP StartTLS失败\n%w", err)
+		}
+	}
+	if c.config.BindDN != "" {
+		if err := conn.Bind(c.config.BindDN, c.config.BindPassword); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("LDAP服务账号%s绑定失败\n%w", c.config.BindDN, err)
+		}
+	}
+	return conn, nil
+}
+
+func (c *Client) search(conn *goldap.Conn, base string, filter string, attributes []string) ([]*goldap.Entry, error) {
+	req := goldap.NewSearchRequest(base, goldap.ScopeWholeSubtree, goldap.NeverDerefAliases,
+		0, 0, false, filter, attributes, nil)
+	result, err := conn.SearchWithPaging(req, 500)
+	if err != nil {
+		return nil, fmt.Errorf("LDAP查询%s失败\n%w", filter, err)
+	}
+	return result.Entries, nil
+}
+
+func (c *Client) userAttributes() []string {
+	return []string{c.config.UsernameAttr, c.config.EmailAttr, c.config.FullNameAttr, c.config.MobileAttr}
+}
+
+func (c *Client) entry(e *goldap.Entry) Entry {
+	return Entry{
+		DN:       e.DN,
+		Username: e.GetAttributeValue(c.config.UsernameAttr),
+		Email:    e.GetAttributeValue(c.config.EmailAttr),
+		FullName: e.GetAttributeValue(c.config.FullNameAttr),
+		Mobile:   e.GetAttributeValue(c.config.MobileAttr),
+	}
+}
+
+// NormalizeDN 统一 DN 的大小写与空格, 用于比较组成员
+func NormalizeDN(dn string) string {
+	parsed, err := goldap.ParseDN(dn)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(dn))
+	}
+	var rdns []string
+	for _, rdn := range parsed.RDNs {
+		var attrs []string
+		for _, attr := range rdn.Attributes {
+			attrs = append(attrs, strings.ToLower(attr.Type)+"="+strings.ToLower(attr.Value))
+		}
+		rdns = append(rdns, strings.Join(attrs, "+"))
+	}
+	return strings.Join(rdns, ",")
+}
@@ -0,0 +1,93 @@
+//go:build integration
+// +build integration
+
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package ldap
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"devops/cicd-tools/pkg/cicd-tools/config"
+	"devops/cicd-tools/pkg/cicd-tools/model"
+	"devops/cicd-tools/pkg/cicd-tools/store/memstore"
+)
+
+// 需要先启动 docs/ldap 中的 OpenLDAP:
+//
+//	docker compose -f docs/ldap/docker-compose.yaml up -d
+//	go test -tags integration ./pkg/cicd-tools/auth/ldap/
+//
+// 地址默认为 ldap://127.0.0.1:1389, 可以通过 CICD_LDAP_URL 指定
+func testClient(t *testing.T) *Client {
+	c := config.Default().Auth.LDAP
+	c.URL = os.Getenv("CICD_LDAP_URL")
+	if c.URL == "" {
+		c.URL = "ldap://127.0.0.1:1389"
+	}
+	c.BindDN = "cn=admin,dc=example,dc=org"
+	c.BindPassword = "admin"
+	c.BaseDN = "ou=people,dc=example,dc=org"
+	c.GroupBaseDN = "ou=groups,dc=example,dc=org"
+	return NewClient(c)
+}
+
+func TestIntegrationAuthenticate(t *testing.T) {
+	c := testClient(t)
+	entry, err := c.Authenticate("alice", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Email != "alice@example.org" || entry.Mobile != "13800000001" {
+		t.Fatalf("alice = %+v", entry)
+	}
+	if _, err := c.Authenticate("alice", "wrong"); err != ErrInvalidCredentials {
+		t.Fatalf("wrong password: %v", err)
+	}
+}
+
+func TestIntegrationSync(t *testing.T) {
+	s := memstore.New()
+	syncer := NewSyncer(s, testClient(t))
+	if _, err := syncer.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"alice", "bob"} {
+		u, err := s.Users().First(&model.User{Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.Source != model.SourceLDAP {
+			t.Fatalf("%s = %+v", name, u)
+		}
+	}
+	if got := members(t, s, "developers"); !reflect.DeepEqual(got, []string{"alice", "bob"}) {
+		t.Fatalf("developers = %v", got)
+	}
+	if got := members(t, s, "ops"); !reflect.DeepEqual(got, []string{"bob"}) {
+		t.Fatalf("ops = %v", got)
+	}
+	changes, err := syncer.Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("changes after sync: %v", changes)
+	}
+}
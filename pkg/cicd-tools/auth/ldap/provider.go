@@ -0,0 +1,66 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package ldap
+
+import (
+	"errors"
+	"fmt"
+
+	"devops/cicd-tools/pkg/cicd-tools/auth"
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+// Provider 使用目录校验密码的认证源, 登录成功后创建或更新对应的本地用户, 组成员关系由 Syncer 维护
+type Provider struct {
+	store model.Store
+	dir   Directory
+}
+
+func NewProvider(s model.Store, dir Directory) *Provider {
+	return &Provider{store: s, dir: dir}
+}
+
+func (p *Provider) Name() string {
+	return model.SourceLDAP
+}
+
+func (p *Provider) Login(name string, password string) (*model.User, error) {
+	entry, err := p.dir.Authenticate(name, password)
+	if errors.Is(err, ErrInvalidCredentials) {
+		return nil, auth.ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	var u *model.User
+	err = p.store.Transaction(func(tx model.Store) error {
+		var err error
+		u, _, err = NewSyncer(tx, p.dir).syncUser(tx, *entry, true)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, fmt.Errorf("%w\nLDAP用户%s缺少邮箱, 无法创建本地用户", auth.ErrInvalidCredentials, name)
+	}
+	if u.Source != model.SourceLDAP {
+		// 同名的本地用户不能通过目录密码登录
+		return nil, auth.ErrInvalidCredentials
+	}
+	return u, nil
+}
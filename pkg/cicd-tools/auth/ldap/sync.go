@@ -0,0 +1,310 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package ldap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+	"devops/cicd-tools/pkg/util/logger"
+)
+
+// 同步变更类型
+const (
+	ActionCreateUser   = "create_user"
+	ActionUpdateUser   = "update_user"
+	ActionSkipUser     = "skip_user"
+	ActionCreateGroup  = "create_group"
+	ActionAdoptGroup   = "adopt_group"
+	ActionAddMember    = "add_member"
+	ActionRemoveMember = "remove_member"
+)
+
+// Change 一项同步变更, Detail 为变更说明
+type Change struct {
+	Action string
+	User   string
+	Group  string
+	Detail string
+}
+
+func (c Change) String() string {
+	var fields []string
+	if c.User != "" {
+		fields = append(fields, "user="+c.User)
+	}
+	if c.Group != "" {
+		fields = append(fields, "group="+c.Group)
+	}
+	if c.Detail != "" {
+		fields = append(fields, c.Detail)
+	}
+	return fmt.Sprintf("%-14s %s", c.Action, strings.Join(fields, " "))
+}
+
+// Syncer 将目录中的用户与组同步到本地存储
+//
+// 用户依次按 ExternalID (DN)、用户名、邮箱匹配本地用户, 匹配不到时创建 Source 为 ldap 的用户;
+// 同名的本地组会被接管 (Source 改为 ldap). 只移除 Source 为 ldap 的组中的成员, 不删除用户与组,
+// 本地创建的组和角色绑定不受影响
+type Syncer struct {
+	store model.Store
+	dir   Directory
+}
+
+func NewSyncer(s model.Store, dir Directory) *Syncer {
+	return &Syncer{store: s, dir: dir}
+}
+
+// Diff 计算同步需要的变更, 不修改存储
+func (s *Syncer) Diff() ([]Change, error) {
+	var changes []Change
+	err := s.store.Transaction(func(tx model.Store) error {
+		var err error
+		changes, err = s.sync(tx, false)
+		return err
+	})
+	return changes, err
+}
+
+// Sync 在同一事务中执行同步并返回已执行的变更
+func (s *Syncer) Sync() ([]Change, error) {
+	var changes []Change
+	err := s.store.Transaction(func(tx model.Store) error {
+		var err error
+		changes, err = s.sync(tx, true)
+		return err
+	})
+	return changes, err
+}
+
+// Run 每隔 interval 同步一次, 直到 ctx 取消
+func (s *Syncer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		changes, err := s.Sync()
+		if err != nil {
+			logger.Error(err)
+		} else if len(changes) > 0 {
+			logger.Info(fmt.Sprintf("LDAP同步完成, 共%d项变更", len(changes)))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Syncer) sync(tx model.Store, apply bool) ([]Change, error) {
+	entries, err := s.dir.Users()
+	if err != nil {
+		return nil, err
+	}
+	groups, err := s.dir.Groups()
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	// 目录中的用户按规范化的 DN 和用户名索引, 用于解析组成员; 值为本地用户, 未创建时 ID 为 0
+	byDN := map[string]*model.User{}
+	byName := map[string]*model.User{}
+	for _, entry := range entries {
+		u, change, err := s.syncUser(tx, entry, apply)
+		if err != nil {
+			return nil, err
+		}
+		if change != nil {
+			changes = append(changes, *change)
+		}
+		if u == nil {
+			continue
+		}
+		byDN[NormalizeDN(entry.DN)] = u
+		byName[strings.ToLower(entry.Username)] = u
+	}
+
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	for _, entry := range groups {
+		members := map[string]*model.User{}
+		for _, value := range entry.Members {
+			u, ok := byDN[NormalizeDN(value)]
+			if !ok {
+				u, ok = byName[strings.ToLower(value)]
+			}
+			if ok {
+				members[u.Name] = u
+			}
+		}
+		groupChanges, err := s.syncGroup(tx, entry, members, apply)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, groupChanges...)
+	}
+	return changes, nil
+}
+
+// syncUser 返回目录用户对应的本地用户, 跳过的用户返回 nil
+func (s *Syncer) syncUser(tx model.Store, entry Entry, apply bool) (*model.User, *Change, error) {
+	u, err := s.match(tx, entry)
+	if err != nil {
+		return nil, nil, err
+	}
+	if u == nil {
+		if entry.Email == "" {
+			return nil, &Change{Action: ActionSkipUser, User: entry.Username, Detail: "缺少邮箱"}, nil
+		}
+		u = &model.User{
+			Name:       entry.Username,
+			FullName:   entry.FullName,
+			Email:      entry.Email,
+			Mobile:     entry.Mobile,
+			Source:     model.SourceLDAP,
+			ExternalID: entry.DN,
+		}
+		if apply {
+			if err := tx.Users().Create(u); err != nil {
+				return nil, nil, fmt.Errorf("创建LDAP用户%s失败\n%w", entry.Username, err)
+			}
+		}
+		return u, &Change{Action: ActionCreateUser, User: entry.Username, Detail: "dn=" + entry.DN}, nil
+	}
+	if u.Source != model.SourceLDAP {
+		// 本地用户由管理员维护, 只用于解析组成员, 不覆盖其属性
+		return u, nil, nil
+	}
+
+	var diff []string
+	update := func(field string, current *string, value string) {
+		if value != "" && *current != value {
+			diff = append(diff, fmt.Sprintf("%s:%s->%s", field, *current, value))
+			*current = value
+		}
+	}
+	update("name", &u.Name, entry.Username)
+	update("full_name", &u.FullName, entry.FullName)
+	update("email", &u.Email, entry.Email)
+	update("mobile", &u.Mobile, entry.Mobile)
+	update("dn", &u.ExternalID, entry.DN)
+	if len(diff) == 0 {
+		return u, nil, nil
+	}
+	if apply {
+		if err := tx.Users().Save(u); err != nil {
+			return nil, nil, fmt.Errorf("更新LDAP用户%s失败\n%w", entry.Username, err)
+		}
+	}
+	return u, &Change{Action: ActionUpdateUser, User: u.Name, Detail: strings.Join(diff, " ")}, nil
+}
+
+// match 依次按 DN、用户名、邮箱查找本地用户
+func (s *Syncer) match(tx model.Store, entry Entry) (*model.User, error) {
+	conds := []*model.User{
+		{Source: model.SourceLDAP, ExternalID: entry.DN},
+		{Name: entry.Username},
+	}
+	if entry.Email != "" {
+		conds = append(conds, &model.User{Email: entry.Email})
+	}
+	for _, cond := range conds {
+		u, err := tx.Users().First(cond)
+		if err == nil {
+			return u, nil
+		}
+		if !errors.Is(err, model.ErrNotFound) {
+			return nil, fmt.Errorf("查询用户%s失败\n%w", entry.Username, err)
+		}
+	}
+	return nil, nil
+}
+
+func (s *Syncer) syncGroup(tx model.Store, entry GroupEntry, members map[string]*model.User, apply bool) ([]Change, error) {
+	var changes []Change
+	g, err := tx.Groups().First(&model.Group{Name: entry.Name})
+	if errors.Is(err, model.ErrNotFound) {
+		g = &model.Group{Name: entry.Name, Source: model.SourceLDAP}
+		if apply {
+			if err := tx.Groups().Create(g); err != nil {
+				return nil, fmt.Errorf("创建LDAP组%s失败\n%w", entry.Name, err)
+			}
+		}
+		changes = append(changes, Change{Action: ActionCreateGroup, Group: entry.Name, Detail: "dn=" + entry.DN})
+	} else if err != nil {
+		return nil, fmt.Errorf("查询组%s失败\n%w", entry.Name, err)
+	} else if g.Source != model.SourceLDAP {
+		g.Source = model.SourceLDAP
+		if apply {
+			if err := tx.Groups().Save(g); err != nil {
+				return nil, fmt.Errorf("更新组%s失败\n%w", entry.Name, err)
+			}
+		}
+		changes = append(changes, Change{Action: ActionAdoptGroup, Group: entry.Name})
+	}
+
+	current := map[string]model.User{}
+	if g.ID != 0 {
+		users, err := tx.Groups().Users(g.ID)
+		if err != nil {
+			return nil, fmt.Errorf("查询组%s的成员失败\n%w", entry.Name, err)
+		}
+		for _, value := range users {
+			current[value.Name] = value
+		}
+	}
+
+	var names []string
+	for name := range members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := current[name]; ok {
+			continue
+		}
+		if apply {
+			if _, err := tx.Users().AddGroup(members[name].ID, g.ID); err != nil {
+				return nil, fmt.Errorf("添加用户%s到组%s失败\n%w", name, entry.Name, err)
+			}
+		}
+		changes = append(changes, Change{Action: ActionAddMember, User: name, Group: entry.Name})
+	}
+
+	names = names[:0]
+	for name := range current {
+		if _, ok := members[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if apply {
+			if err := tx.Users().RemoveGroup(current[name].ID, g.ID); err != nil {
+				return nil, fmt.Errorf("从组%s移除用户%s失败\n%w", entry.Name, name, err)
+			}
+		}
+		changes = append(changes, Change{Action: ActionRemoveMember, User: name, Group: entry.Name})
+	}
+	return changes, nil
+}
@@ -0,0 +1,278 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package ldap
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+	"devops/cicd-tools/pkg/cicd-tools/store/memstore"
+)
+
+// fakeDirectory 内存中的目录, 用于测试同步
+type fakeDirectory struct {
+	users  []Entry
+	groups []GroupEntry
+}
+
+func (d *fakeDirectory) Authenticate(username string, password string) (*Entry, error) {
+	return nil, ErrInvalidCredentials
+}
+
+func (d *fakeDirectory) Users() ([]Entry, error) {
+	return append([]Entry(nil), d.users...), nil
+}
+
+func (d *fakeDirectory) Groups() ([]GroupEntry, error) {
+	return append([]GroupEntry(nil), d.groups...), nil
+}
+
+func newDirectory() *fakeDirectory {
+	return &fakeDirectory{
+		users: []Entry{
+			{DN: "uid=alice,ou=people,dc=example,dc=org", Username: "alice", Email: "alice@example.org", FullName: "Alice"},
+			{DN: "uid=bob,ou=people,dc=example,dc=org", Username: "bob", Email: "bob@example.org", FullName: "Bob"},
+			{DN: "uid=nomail,ou=people,dc=example,dc=org", Username: "nomail"},
+		},
+		groups: []GroupEntry{
+			{DN: "cn=developers,ou=groups,dc=example,dc=org", Name: "developers", Members: []string{"UID=Alice, ou=people,dc=example,dc=org", "uid=bob,ou=people,dc=example,dc=org"}},
+			{DN: "cn=ops,ou=groups,dc=example,dc=org", Name: "ops", Members: []string{"bob"}},
+		},
+	}
+}
+
+func actions(changes []Change) []string {
+	var out []string
+	for _, c := range changes {
+		out = append(out, c.Action+":"+c.User+":"+c.Group)
+	}
+	return out
+}
+
+func members(t *testing.T, s model.Store, group string) []string {
+	t.Helper()
+	g, err := s.Groups().First(&model.Group{Name: group})
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, err := s.Groups().Users(g.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, u := range users {
+		names = append(names, u.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestSyncCreate(t *testing.T) {
+	s := memstore.New()
+	changes, err := NewSyncer(s, newDirectory()).Sync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"create_user:alice:",
+		"create_user:bob:",
+		"skip_user:nomail:",
+		"create_group::developers",
+		"add_member:alice:developers",
+		"add_member:bob:developers",
+		"create_group::ops",
+		"add_member:bob:ops",
+	}
+	if got := actions(changes); !reflect.DeepEqual(got, want) {
+		t.Fatalf("changes = %v, want %v", got, want)
+	}
+	alice, err := s.Users().First(&model.User{Name: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alice.Source != model.SourceLDAP || alice.ExternalID != "uid=alice,ou=people,dc=example,dc=org" || alice.Email != "alice@example.org" {
+		t.Fatalf("alice = %+v", alice)
+	}
+	if _, err := s.Users().First(&model.User{Name: "nomail"}); err == nil {
+		t.Fatal("user without email should be skipped")
+	}
+	if got := members(t, s, "developers"); !reflect.DeepEqual(got, []string{"alice", "bob"}) {
+		t.Fatalf("developers = %v", got)
+	}
+
+	changes, err = NewSyncer(s, newDirectory()).Sync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := actions(changes); !reflect.DeepEqual(got, []string{"skip_user:nomail:"}) {
+		t.Fatalf("second sync changes = %v", got)
+	}
+}
+
+func TestSyncUpdate(t *testing.T) {
+	s := memstore.New()
+	dir := newDirectory()
+	if _, err := NewSyncer(s, dir).Sync(); err != nil {
+		t.Fatal(err)
+	}
+	// 本地用户只用于解析组成员, 不覆盖其属性
+	carol := &model.User{Name: "carol", Email: "carol@local", FullName: "Local Carol"}
+	if err := s.Users().Create(carol); err != nil {
+		t.Fatal(err)
+	}
+	dir.users[0].Email = "alice@corp.example.org"
+	dir.users[0].Username = "alice2"
+	dir.users = append(dir.users, Entry{DN: "uid=carol,ou=people,dc=example,dc=org", Username: "carol", Email: "carol@example.org", FullName: "Carol"})
+	dir.groups[1].Members = append(dir.groups[1].Members, "uid=carol,ou=people,dc=example,dc=org")
+
+	changes, err := NewSyncer(s, dir).Sync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"update_user:alice2:", "skip_user:nomail:", "add_member:carol:ops"}
+	if got := actions(changes); !reflect.DeepEqual(got, want) {
+		t.Fatalf("changes = %v, want %v", got, want)
+	}
+	alice, err := s.Users().First(&model.User{Source: model.SourceLDAP, ExternalID: "uid=alice,ou=people,dc=example,dc=org"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alice.Name != "alice2" || alice.Email != "alice@corp.example.org" {
+		t.Fatalf("alice = %+v", alice)
+	}
+	got, err := s.Users().Get(carol.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Source != model.SourceLocal || got.Email != "carol@local" || got.FullName != "Local Carol" {
+		t.Fatalf("local user changed: %+v", got)
+	}
+}
+
+func TestSyncAdoptGroup(t *testing.T) {
+	s := memstore.New()
+	ops := &model.Group{Name: "ops", Intro: "运维"}
+	if err := s.Groups().Create(ops); err != nil {
+		t.Fatal(err)
+	}
+	local := &model.Group{Name: "local"}
+	if err := s.Groups().Create(local); err != nil {
+		t.Fatal(err)
+	}
+	dave := &model.User{Name: "dave", Email: "dave@local"}
+	if err := s.Users().Create(dave); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Users().AddGroup(dave.ID, ops.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Users().AddGroup(dave.ID, local.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := NewSyncer(s, newDirectory()).Sync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var adopted bool
+	for _, c := range changes {
+		if c.Action == ActionAdoptGroup && c.Group == "ops" {
+			adopted = true
+		}
+	}
+	if !adopted {
+		t.Fatalf("ops not adopted: %v", actions(changes))
+	}
+	g, err := s.Groups().Get(ops.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Source != model.SourceLDAP || g.Intro != "运维" {
+		t.Fatalf("ops = %+v", g)
+	}
+	// 接管后的组按目录维护成员, 本地组不受影响
+	if got := members(t, s, "ops"); !reflect.DeepEqual(got, []string{"bob"}) {
+		t.Fatalf("ops = %v", got)
+	}
+	if got := members(t, s, "local"); !reflect.DeepEqual(got, []string{"dave"}) {
+		t.Fatalf("local = %v", got)
+	}
+}
+
+func TestSyncRemoveMember(t *testing.T) {
+	s := memstore.New()
+	dir := newDirectory()
+	if _, err := NewSyncer(s, dir).Sync(); err != nil {
+		t.Fatal(err)
+	}
+	dir.groups[0].Members = dir.groups[0].Members[1:]
+	changes, err := NewSyncer(s, dir).Sync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := actions(changes); !reflect.DeepEqual(got, []string{"skip_user:nomail:", "remove_member:alice:developers"}) {
+		t.Fatalf("changes = %v", got)
+	}
+	if got := members(t, s, "developers"); !reflect.DeepEqual(got, []string{"bob"}) {
+		t.Fatalf("developers = %v", got)
+	}
+	// 移除成员不删除用户
+	if _, err := s.Users().First(&model.User{Name: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSyncDiff(t *testing.T) {
+	s := memstore.New()
+	ops := &model.Group{Name: "ops"}
+	if err := s.Groups().Create(ops); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := NewSyncer(s, newDirectory()).Diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"create_user:alice:",
+		"create_user:bob:",
+		"skip_user:nomail:",
+		"create_group::developers",
+		"add_member:alice:developers",
+		"add_member:bob:developers",
+		"adopt_group::ops",
+		"add_member:bob:ops",
+	}
+	if got := actions(changes); !reflect.DeepEqual(got, want) {
+		t.Fatalf("changes = %v, want %v", got, want)
+	}
+	users, err := s.Users().Find(&model.User{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups, err := s.Groups().Find(&model.Group{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 0 || len(groups) != 1 || groups[0].Source != model.SourceLocal {
+		t.Fatalf("diff modified store: users %v, groups %v", users, groups)
+	}
+	if got := members(t, s, "ops"); len(got) != 0 {
+		t.Fatalf("ops = %v", got)
+	}
+}
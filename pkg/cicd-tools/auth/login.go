@@ -0,0 +1,156 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"devops/cicd-tools/pkg/cicd-tools/config"
+	"devops/cicd-tools/pkg/cicd-tools/model"
+	"devops/cicd-tools/pkg/util/logger"
+)
+
+var (
+	ErrDisabled = errors.New("用户已停用")
+	ErrLocked   = errors.New("连续登录失败次数过多, 用户已被临时锁定")
+)
+
+// ClientInfo 登录请求的来源, 记录到登录记录中
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+type clientKey struct{}
+
+func WithClient(ctx context.Context, c ClientInfo) context.Context {
+	return context.WithValue(ctx, clientKey{}, c)
+}
+
+func ClientFromContext(ctx context.Context) ClientInfo {
+	c, _ := ctx.Value(clientKey{}).(ClientInfo)
+	return c
+}
+
+// ClientFromRequest 取请求的对端地址与 User-Agent, 不信任 X-Forwarded-For 等可伪造的请求头
+func ClientFromRequest(r *http.Request) ClientInfo {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return ClientInfo{IP: ip, UserAgent: r.UserAgent()}
+}
+
+// conceal 用户不存在、密码错误、已停用与已锁定对调用方返回同一个 ErrInvalidCredentials,
+// 避免据此判断用户是否存在, 具体原因写入日志 (登录记录中同样保存)
+func conceal(name string, err error) error {
+	if !errors.Is(err, ErrInvalidCredentials) && !errors.Is(err, ErrLocked) && !errors.Is(err, ErrDisabled) {
+		return err
+	}
+	logger.Warn(fmt.Sprintf("用户%s登录失败: %s", name, strings.ReplaceAll(err.Error(), "\n", ", ")))
+	return ErrInvalidCredentials
+}
+
+// WithLockout 启用账号锁定, 连续输错密码或验证码达到次数后锁定一段时间
+func (a *Authenticator) WithLockout(c config.Lockout) *Authenticator {
+	a.lockout = c
+	return a
+}
+
+// usable 检查用户是否已停用或处于锁定期
+func (a *Authenticator) usable(u *model.User) error {
+	if u.Disabled {
+		return fmt.Errorf("%w\n用户%s已停用", ErrDisabled, u.Name)
+	}
+	if u.LockedUntil != nil && a.now().Before(*u.LockedUntil) {
+		return fmt.Errorf("%w\n请于%s后重试", ErrLocked, u.LockedUntil.Local().Format("2006-01-02 15:04:05"))
+	}
+	return nil
+}
+
+// failed 记录一次失败的登录, 密码或验证码错误时累计失败次数, 达到上限后锁定用户并清零次数
+func (a *Authenticator) failed(ctx context.Context, u *model.User, name string, method string, cause error) error {
+	var uid uint
+	if u != nil {
+		uid = u.ID
+	}
+	_ = a.record(ctx, uid, name, method, cause)
+	if u == nil || a.lockout.MaxAttempts <= 0 ||
+		!(errors.Is(cause, ErrInvalidCredentials) || errors.Is(cause, ErrMFAInvalid)) {
+		return cause
+	}
+	// 失败次数在存储中原子递增, 并发的失败登录不会互相覆盖
+	count, err := a.store.Users().IncrementFailedLogins(u.ID)
+	if err != nil {
+		return fmt.Errorf("%v\n更新用户%s的登录失败次数失败\n%w", cause, u.Name, err)
+	}
+	if count < a.lockout.MaxAttempts {
+		return cause
+	}
+	until := a.now().Add(a.lockout.Duration)
+	if err := a.store.Users().UpdateLoginState(u.ID, 0, &until); err != nil {
+		return fmt.Errorf("%v\n锁定用户%s失败\n%w", cause, u.Name, err)
+	}
+	return fmt.Errorf("%w\n连续失败%d次, 请于%s后重试", ErrLocked, a.lockout.MaxAttempts, until.Local().Format("2006-01-02 15:04:05"))
+}
+
+// succeeded 记录一次成功的登录并清除失败次数与锁定
+func (a *Authenticator) succeeded(ctx context.Context, u *model.User, method string) error {
+	if u.FailedLogins != 0 || u.LockedUntil != nil {
+		if err := a.store.Users().UpdateLoginState(u.ID, 0, nil); err != nil {
+			return fmt.Errorf("重置用户%s的登录失败次数失败\n%w", u.Name, err)
+		}
+	}
+	return a.record(ctx, u.ID, u.Name, method, nil)
+}
+
+func (a *Authenticator) record(ctx context.Context, uid uint, name string, method string, cause error) error {
+	c := ClientFromContext(ctx)
+	h := &model.LoginHistory{
+		UserID:    uid,
+		Username:  truncate(name, 60),
+		Method:    method,
+		Success:   cause == nil,
+		IP:        truncate(c.IP, 64),
+		UserAgent: truncate(c.UserAgent, 255),
+	}
+	if cause != nil {
+		h.Reason = truncate(strings.SplitN(cause.Error(), "\n", 2)[0], 255)
+	}
+	if err := a.store.Logins().Add(h); err != nil {
+		return fmt.Errorf("写入登录记录失败\n%w", err)
+	}
+	return nil
+}
+
+// truncate 按字节截断, 不截断多字节字符
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	s = s[:n]
+	for len(s) > 0 && !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s
+}
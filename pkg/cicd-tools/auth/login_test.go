@@ -0,0 +1,152 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package auth
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"devops/cicd-tools/pkg/cicd-tools/config"
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+func TestLockout(t *testing.T) {
+	s, a, u := newTestAuthenticator(t)
+	now := time.Now()
+	a.now = func() time.Time { return now }
+	a.WithLockout(config.Lockout{MaxAttempts: 3, Duration: 15 * time.Minute})
+
+	for i := 0; i < 2; i++ {
+		if _, err := a.Login("alice", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("attempt %d: %v", i+1, err)
+		}
+	}
+	stored, err := s.Users().Get(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.FailedLogins != 2 || stored.LockedUntil != nil {
+		t.Fatalf("after 2 failures: %d, %v", stored.FailedLogins, stored.LockedUntil)
+	}
+	// 锁定与密码错误返回同一错误
+	if _, err := a.Login("alice", "wrong"); err != ErrInvalidCredentials {
+		t.Fatalf("attempt 3: %v", err)
+	}
+	// 锁定期内正确的密码也被拒绝
+	if _, err := a.Login("alice", "hello1234"); err != ErrInvalidCredentials {
+		t.Fatalf("correct password while locked: %v", err)
+	}
+	stored, err = s.Users().Get(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.LockedUntil == nil || !stored.LockedUntil.Equal(now.Add(15*time.Minute)) || stored.FailedLogins != 0 {
+		t.Fatalf("locked state: %d, %v", stored.FailedLogins, stored.LockedUntil)
+	}
+
+	// 锁定到期后自动解锁, 成功登录清除锁定
+	now = now.Add(16 * time.Minute)
+	if _, err := a.Login("alice", "hello1234"); err != nil {
+		t.Fatal(err)
+	}
+	stored, err = s.Users().Get(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.FailedLogins != 0 || stored.LockedUntil != nil {
+		t.Fatalf("after login: %d, %v", stored.FailedLogins, stored.LockedUntil)
+	}
+
+	failed, err := s.Logins().Find(model.LoginQuery{UserID: u.ID, Failed: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 4 {
+		t.Fatalf("%d failed logins recorded", len(failed))
+	}
+	// 登录记录保存具体原因
+	locked := 0
+	for _, value := range failed {
+		if value.Reason == ErrLocked.Error() {
+			locked++
+		}
+	}
+	if locked != 1 {
+		t.Fatalf("%d failed logins recorded as locked", locked)
+	}
+}
+
+func TestLockoutUnlock(t *testing.T) {
+	s, a, u := newTestAuthenticator(t)
+	a.WithLockout(config.Lockout{MaxAttempts: 2, Duration: time.Hour})
+	for i := 0; i < 2; i++ {
+		_, _ = a.Login("alice", "wrong")
+	}
+	if _, err := a.Login("alice", "hello1234"); err != ErrInvalidCredentials {
+		t.Fatalf("not locked: %v", err)
+	}
+	// 管理员解锁 (account unlock) 清除锁定时间
+	if err := s.Users().UpdateLoginState(u.ID, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Login("alice", "hello1234"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockoutConcurrent(t *testing.T) {
+	s, a, u := newTestAuthenticator(t)
+	a.WithLockout(config.Lockout{MaxAttempts: 100, Duration: time.Hour})
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = a.Login("alice", "wrong")
+		}()
+	}
+	wg.Wait()
+	stored, err := s.Users().Get(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.FailedLogins != 20 {
+		t.Fatalf("failed logins = %d, want 20", stored.FailedLogins)
+	}
+}
+
+func TestLockoutDisabled(t *testing.T) {
+	s, a, u := newTestAuthenticator(t)
+	for i := 0; i < 10; i++ {
+		_, _ = a.Login("alice", "wrong")
+	}
+	if _, err := a.Login("alice", "hello1234"); err != nil {
+		t.Fatalf("locked without lockout config: %v", err)
+	}
+	if err := s.Users().SetDisabled(u.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Login("alice", "hello1234"); err != ErrInvalidCredentials {
+		t.Fatalf("disabled user: %v", err)
+	}
+	// 用户不存在时不泄露用户是否存在
+	if _, err := a.Login("nobody", "hello1234"); err != ErrInvalidCredentials {
+		t.Fatalf("unknown user: %v", err)
+	}
+}
@@ -0,0 +1,282 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"devops/cicd-tools/pkg/cicd-tools/auth/totp"
+	"devops/cicd-tools/pkg/cicd-tools/config"
+	"devops/cicd-tools/pkg/cicd-tools/model"
+	"devops/cicd-tools/pkg/cicd-tools/rbac"
+)
+
+var (
+	// ErrMFARequired 用户已启用 TOTP, 登录时需要提供验证码或恢复码
+	ErrMFARequired = errors.New("需要多因素认证验证码")
+	ErrMFAInvalid  = errors.New("多因素认证验证码错误")
+	// ErrMFANotEnrolled 用户的权限要求启用多因素认证, 但尚未绑定 TOTP
+	ErrMFANotEnrolled = errors.New("当前用户的权限要求启用多因素认证, 请先绑定TOTP")
+)
+
+// recoveryAlphabet 恢复码使用的字符, 去掉了容易混淆的 0/1/l/o
+const recoveryAlphabet = "23456789abcdefghijkmnpqrstuvwxyz"
+
+// MFAStatus 用户的多因素认证状态
+type MFAStatus struct {
+	Enrolled      bool
+	Confirmed     bool
+	Required      bool
+	RecoveryCodes int
+}
+
+// MFA 管理用户的 TOTP 绑定与恢复码, 并按配置判断用户是否必须启用多因素认证
+type MFA struct {
+	store  model.Store
+	config config.MFA
+	now    func() time.Time
+}
+
+func NewMFA(s model.Store, c config.MFA) *MFA {
+	return &MFA{store: s, config: c, now: time.Now}
+}
+
+// Required 判断用户的有效权限中是否包含 RequiredActions 中的任一操作
+func (m *MFA) Required(uid uint) (bool, error) {
+	authorizer := rbac.NewAuthorizer(m.store)
+	for _, value := range m.config.RequiredActions {
+		category, action := "", value
+		if i := strings.Index(value, ":"); i >= 0 {
+			category, action = value[:i], value[i+1:]
+		}
+		held, err := authorizer.Holds(uid, category, action)
+		if err != nil {
+			return false, err
+		}
+		if held {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MFA) Status(uid uint) (*MFAStatus, error) {
+	status := new(MFAStatus)
+	required, err := m.Required(uid)
+	if err != nil {
+		return nil, err
+	}
+	status.Required = required
+	t, err := m.totp(uid)
+	if err != nil || t == nil {
+		return status, err
+	}
+	status.Enrolled = true
+	status.Confirmed = t.Confirmed()
+	codes, err := m.store.MFA().RecoveryCodes(uid)
+	if err != nil {
+		return nil, fmt.Errorf("查询用户%d的恢复码失败\n%w", uid, err)
+	}
+	for _, value := range codes {
+		if value.UsedAt == nil {
+			status.RecoveryCodes++
+		}
+	}
+	return status, nil
+}
+
+// Enroll 为用户生成新的 TOTP 密钥并返回密钥与 otpauth:// 地址, 需要调用 Confirm 确认后才生效;
+// 已启用的用户需先调用 Disable
+func (m *MFA) Enroll(u *model.User) (string, string, error) {
+	t, err := m.totp(u.ID)
+	if err != nil {
+		return "", "", err
+	}
+	if t.Confirmed() {
+		return "", "", fmt.Errorf("用户%s已启用多因素认证, 重新绑定前需先停用", u.Name)
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if t == nil {
+		t = &model.UserTOTP{UserID: u.ID}
+	}
+	t.Secret = model.Secret(secret)
+	if err := m.store.MFA().SaveTOTP(t); err != nil {
+		return "", "", fmt.Errorf("保存用户%s的TOTP密钥失败\n%w", u.Name, err)
+	}
+	return secret, totp.URI(m.config.Issuer, u.Name, secret), nil
+}
+
+// Confirm 使用验证器应用生成的验证码确认绑定, 成功后启用 TOTP 并返回新的恢复码
+func (m *MFA) Confirm(uid uint, code string) ([]string, error) {
+	var codes []string
+	err := m.store.Transaction(func(tx model.Store) error {
+		t, err := tx.MFA().TOTP(uid)
+		if errors.Is(err, model.ErrNotFound) {
+			return fmt.Errorf("用户%d尚未生成TOTP密钥", uid)
+		} else if err != nil {
+			return fmt.Errorf("查询用户%d的TOTP密钥失败\n%w", uid, err)
+		}
+		if t.Confirmed() {
+			return fmt.Errorf("用户%d已启用多因素认证", uid)
+		}
+		step, ok := totp.Validate(string(t.Secret), code, m.now())
+		if !ok {
+			return ErrMFAInvalid
+		}
+		now := m.now()
+		t.ConfirmedAt = &now
+		t.LastStep = step
+		if err := tx.MFA().SaveTOTP(t); err != nil {
+			return fmt.Errorf("启用用户%d的TOTP失败\n%w", uid, err)
+		}
+		codes, err = m.replaceRecoveryCodes(tx, uid)
+		return err
+	})
+	return codes, err
+}
+
+// RegenerateRecoveryCodes 作废原有的恢复码并返回新的恢复码
+func (m *MFA) RegenerateRecoveryCodes(uid uint) ([]string, error) {
+	var codes []string
+	err := m.store.Transaction(func(tx model.Store) error {
+		t, err := tx.MFA().TOTP(uid)
+		if err != nil || !t.Confirmed() {
+			return fmt.Errorf("用户%d未启用多因素认证", uid)
+		}
+		codes, err = m.replaceRecoveryCodes(tx, uid)
+		return err
+	})
+	return codes, err
+}
+
+// Disable 删除用户的 TOTP 密钥与恢复码
+func (m *MFA) Disable(uid uint) error {
+	if err := m.store.MFA().DeleteTOTP(uid); err != nil {
+		return fmt.Errorf("停用用户%d的多因素认证失败\n%w", uid, err)
+	}
+	return nil
+}
+
+// Verify 校验 TOTP 验证码或恢复码, 验证码在同一时间步内只能使用一次, 恢复码只能使用一次
+func (m *MFA) Verify(uid uint, code string) error {
+	return m.store.Transaction(func(tx model.Store) error {
+		t, err := tx.MFA().TOTP(uid)
+		if err != nil || !t.Confirmed() {
+			return ErrMFAInvalid
+		}
+		if step, ok := totp.Validate(string(t.Secret), code, m.now()); ok {
+			if step <= t.LastStep {
+				return fmt.Errorf("%w: 验证码已使用", ErrMFAInvalid)
+			}
+			t.LastStep = step
+			return tx.MFA().SaveTOTP(t)
+		}
+		codes, err := tx.MFA().RecoveryCodes(uid)
+		if err != nil {
+			return fmt.Errorf("查询用户%d的恢复码失败\n%w", uid, err)
+		}
+		hash := hashRecoveryCode(code)
+		for i := range codes {
+			if codes[i].UsedAt == nil && codes[i].Hash == hash {
+				now := m.now()
+				codes[i].UsedAt = &now
+				return tx.MFA().SaveRecoveryCode(&codes[i])
+			}
+		}
+		return ErrMFAInvalid
+	})
+}
+
+// check 登录时在密码校验通过后调用: 已启用 TOTP 的用户必须提供正确的验证码,
+// 未启用但按策略必须启用的用户拒绝登录
+func (m *MFA) check(u *model.User, code string) error {
+	t, err := m.totp(u.ID)
+	if err != nil {
+		return err
+	}
+	if t.Confirmed() {
+		if strings.TrimSpace(code) == "" {
+			return ErrMFARequired
+		}
+		return m.Verify(u.ID, code)
+	}
+	required, err := m.Required(u.ID)
+	if err != nil {
+		return err
+	}
+	if required {
+		return ErrMFANotEnrolled
+	}
+	return nil
+}
+
+// totp 返回用户的 TOTP 密钥, 不存在时返回 nil
+func (m *MFA) totp(uid uint) (*model.UserTOTP, error) {
+	t, err := m.store.MFA().TOTP(uid)
+	if errors.Is(err, model.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询用户%d的TOTP密钥失败\n%w", uid, err)
+	}
+	return t, nil
+}
+
+func (m *MFA) replaceRecoveryCodes(tx model.Store, uid uint) ([]string, error) {
+	plain := make([]string, m.config.RecoveryCodes)
+	codes := make([]model.RecoveryCode, m.config.RecoveryCodes)
+	for i := range plain {
+		value, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		plain[i] = value
+		codes[i] = model.RecoveryCode{UserID: uid, Hash: hashRecoveryCode(value)}
+	}
+	if err := tx.MFA().ReplaceRecoveryCodes(uid, codes); err != nil {
+		return nil, fmt.Errorf("保存用户%d的恢复码失败\n%w", uid, err)
+	}
+	return plain, nil
+}
+
+// newRecoveryCode 生成形如 xxxxx-xxxxx 的恢复码, 50 位随机数
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("生成恢复码失败\n%w", err)
+	}
+	for i := range b {
+		b[i] = recoveryAlphabet[int(b[i])%len(recoveryAlphabet)]
+	}
+	return string(b[:5]) + "-" + string(b[5:]), nil
+}
+
+// hashRecoveryCode 忽略大小写、空格与连字符
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"devops/cicd-tools/pkg/cicd-tools/auth/totp"
+	"devops/cicd-tools/pkg/cicd-tools/config"
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+// enrollTOTP 为用户绑定并确认 TOTP, 返回密钥与恢复码
+func enrollTOTP(t *testing.T, m *MFA, u *model.User) (string, []string) {
+	t.Helper()
+	secret, _, err := m.Enroll(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := totp.Code(secret, totp.Step(m.now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, err := m.Confirm(u.ID, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return secret, codes
+}
+
+func TestMFAReplay(t *testing.T) {
+	s, a, u := newTestAuthenticator(t)
+	now := time.Unix(1700000000, 0)
+	m := NewMFA(s, config.Default().Auth.MFA)
+	m.now = func() time.Time { return now }
+	a.WithMFA(m)
+	secret, _ := enrollTOTP(t, m, u)
+
+	// 确认绑定使用的验证码不能再用于登录
+	code, err := totp.Code(secret, totp.Step(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Verify(u.ID, code); !errors.Is(err, ErrMFAInvalid) {
+		t.Fatalf("confirm code reused: %v", err)
+	}
+
+	now = now.Add(totp.Period * time.Second)
+	code, err = totp.Code(secret, totp.Step(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Login("alice", "hello1234"); !errors.Is(err, ErrMFARequired) {
+		t.Fatalf("login without code: %v", err)
+	}
+	if _, err := a.LoginWithCode("alice", "hello1234", code); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.LoginWithCode("alice", "hello1234", code); !errors.Is(err, ErrMFAInvalid) {
+		t.Fatalf("replayed code: %v", err)
+	}
+	// 已使用的时间步之前的验证码在误差范围内也不能再使用
+	previous, err := totp.Code(secret, totp.Step(now)-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Verify(u.ID, previous); !errors.Is(err, ErrMFAInvalid) {
+		t.Fatalf("earlier code: %v", err)
+	}
+	next, err := totp.Code(secret, totp.Step(now)+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Verify(u.ID, next); err != nil {
+		t.Fatalf("next code within skew: %v", err)
+	}
+}
+
+func TestMFARecoveryCode(t *testing.T) {
+	s, a, u := newTestAuthenticator(t)
+	m := NewMFA(s, config.Default().Auth.MFA)
+	a.WithMFA(m)
+	_, codes := enrollTOTP(t, m, u)
+	if len(codes) != config.Default().Auth.MFA.RecoveryCodes {
+		t.Fatalf("%d recovery codes", len(codes))
+	}
+	if _, err := a.LoginWithCode("alice", "hello1234", codes[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.LoginWithCode("alice", "hello1234", codes[0]); !errors.Is(err, ErrMFAInvalid) {
+		t.Fatalf("reused recovery code: %v", err)
+	}
+	status, err := m.Status(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Confirmed || status.RecoveryCodes != len(codes)-1 {
+		t.Fatalf("status = %+v", status)
+	}
+	if err := m.Disable(u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Login("alice", "hello1234"); err != nil {
+		t.Fatalf("login after disable: %v", err)
+	}
+}
@@ -0,0 +1,384 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"devops/cicd-tools/pkg/cicd-tools/config"
+)
+
+// ErrInvalidIDToken ID 令牌签名、签发者、受众、有效期或 nonce 校验失败
+var ErrInvalidIDToken = errors.New("OIDC ID令牌无效")
+
+// 支持的 ID 令牌签名算法, 不接受 none 与 HS*
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// Discovery /.well-known/openid-configuration 中用到的字段
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims 从 ID 令牌中按配置取出的用户信息
+type Claims struct {
+	Subject       string
+	Username      string
+	Email         string
+	EmailVerified bool
+	FullName      string
+	Groups        []string
+}
+
+// Client OIDC 授权码 + PKCE 流程的客户端, 首次使用时获取认证服务的配置
+type Client struct {
+	config config.OIDC
+	http   *http.Client
+
+	mu        sync.Mutex
+	discovery *Discovery
+	keys      map[string]interface{}
+}
+
+func NewClient(c config.OIDC) *Client {
+	return &Client{config: c, http: http.DefaultClient}
+}
+
+// WithHTTPClient 替换访问认证服务使用的 HTTP 客户端
+func (c *Client) WithHTTPClient(h *http.Client) *Client {
+	c.http = h
+	return c
+}
+
+// AuthCodeURL 返回授权地址, verifier 为 PKCE 的 code_verifier, 只发送其 S256 摘要
+func (c *Client) AuthCodeURL(ctx context.Context, state string, nonce string, verifier string) (string, error) {
+	d, err := c.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	values := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {c.config.ClientID},
+		"redirect_uri":          {c.config.RedirectURL},
+		"scope":                 {strings.Join(c.scopes(), " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + values.Encode(), nil
+}
+
+// Exchange 使用授权码与 code_verifier 换取令牌, 校验 ID 令牌后返回其中的用户信息
+func (c *Client) Exchange(ctx context.Context, code string, verifier string, nonce string) (*Claims, error) {
+	d, err := c.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {c.config.RedirectURL},
+		"client_id":     {c.config.ClientID},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if c.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(c.config.ClientID), url.QueryEscape(c.config.ClientSecret))
+	}
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := c.do(req, &body)
+	if err != nil {
+		return nil, fmt.Errorf("OIDC授权码换取令牌失败\n%w", err)
+	}
+	if status != http.StatusOK || body.Error != "" {
+		return nil, fmt.Errorf("OIDC授权码换取令牌失败: %d %s %s", status, body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return nil, errors.New("OIDC令牌响应中缺少id_token")
+	}
+	return c.Verify(ctx, body.IDToken, nonce)
+}
+
+// Verify 校验 ID 令牌的签名、签发者、受众、有效期与 nonce, nonce 不能为空
+func (c *Client) Verify(ctx context.Context, idToken string, nonce string) (*Claims, error) {
+	d, err := c.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	claims := jwt.MapClaims{}
+	parser := jwt.NewParser(jwt.WithValidMethods(signingMethods))
+	_, err = parser.ParseWithClaims(idToken, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return c.key(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w\n%v", ErrInvalidIDToken, err)
+	}
+	if !claims.VerifyIssuer(d.Issuer, true) {
+		return nil, fmt.Errorf("%w: 签发者不是%s", ErrInvalidIDToken, d.Issuer)
+	}
+	if !claims.VerifyAudience(c.config.ClientID, true) {
+		return nil, fmt.Errorf("%w: 受众不包含%s", ErrInvalidIDToken, c.config.ClientID)
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, fmt.Errorf("%w: 缺少exp", ErrInvalidIDToken)
+	}
+	if value, _ := claims["nonce"].(string); nonce == "" || value != nonce {
+		return nil, fmt.Errorf("%w: nonce不匹配", ErrInvalidIDToken)
+	}
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return nil, fmt.Errorf("%w: 缺少sub", ErrInvalidIDToken)
+	}
+	verified, _ := claims["email_verified"].(bool)
+	return &Claims{
+		Subject:       sub,
+		Username:      stringClaim(claims, c.config.UsernameClaim),
+		Email:         stringClaim(claims, c.config.EmailClaim),
+		EmailVerified: verified,
+		FullName:      stringClaim(claims, c.config.FullNameClaim),
+		Groups:        stringsClaim(claims, c.config.GroupsClaim),
+	}, nil
+}
+
+// Discover 获取并缓存认证服务的配置, 返回的 issuer 必须与配置一致
+func (c *Client) Discover(ctx context.Context) (*Discovery, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.discovery != nil {
+		return c.discovery, nil
+	}
+	issuer := strings.TrimSuffix(c.config.Issuer, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	d := new(Discovery)
+	status, err := c.do(req, d)
+	if err == nil && status != http.StatusOK {
+		err = fmt.Errorf("HTTP %d", status)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("获取OIDC配置%s失败\n%w", issuer, err)
+	}
+	if strings.TrimSuffix(d.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("OIDC配置中的issuer %s与配置的%s不一致", d.Issuer, c.config.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, fmt.Errorf("OIDC配置%s缺少authorization_endpoint、token_endpoint或jwks_uri", issuer)
+	}
+	c.discovery = d
+	return d, nil
+}
+
+// key 按 kid 查找签名公钥, 找不到时重新获取一次 JWKS 以支持密钥轮换
+func (c *Client) key(ctx context.Context, kid string) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if k, ok := c.lookup(kid); ok {
+		return k, nil
+	}
+	keys, err := c.fetchKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.keys = keys
+	if k, ok := c.lookup(kid); ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("未找到签名密钥%s", kid)
+}
+
+// lookup kid 为空且只有一个密钥时使用该密钥
+func (c *Client) lookup(kid string) (interface{}, bool) {
+	if kid == "" && len(c.keys) == 1 {
+		for _, k := range c.keys {
+			return k, true
+		}
+	}
+	k, ok := c.keys[kid]
+	return k, ok
+}
+
+func (c *Client) fetchKeys(ctx context.Context) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.discovery.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	status, err := c.do(req, &set)
+	if err == nil && status != http.StatusOK {
+		err = fmt.Errorf("HTTP %d", status)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("获取OIDC签名密钥失败\n%w", err)
+	}
+	keys := map[string]interface{}{}
+	for _, value := range set.Keys {
+		if value.Use != "" && value.Use != "sig" {
+			continue
+		}
+		k, err := value.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[value.Kid] = k
+	}
+	return keys, nil
+}
+
+func (c *Client) do(req *http.Request, out interface{}) (int, error) {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if err := json.Unmarshal(data, out); err != nil && resp.StatusCode == http.StatusOK {
+		return resp.StatusCode, fmt.Errorf("解析响应失败\n%w", err)
+	}
+	return resp.StatusCode, nil
+}
+
+func (c *Client) scopes() []string {
+	scopes := c.config.Scopes
+	for _, value := range scopes {
+		if value == "openid" {
+			return scopes
+		}
+	}
+	return append([]string{"openid"}, scopes...)
+}
+
+// jsonWebKey JWKS 中的 RSA 或 EC 公钥
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("不支持的曲线%s", k.Crv)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("EC公钥不在曲线上")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("不支持的密钥类型%s", k.Kty)
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+func stringClaim(claims jwt.MapClaims, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
+
+// stringsClaim 兼容数组与以空格分隔的字符串两种格式
+func stringsClaim(claims jwt.MapClaims, name string) []string {
+	switch value := claims[name].(type) {
+	case []interface{}:
+		var values []string
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	case string:
+		return strings.Fields(value)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package oidc
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"devops/cicd-tools/pkg/cicd-tools/auth"
+)
+
+// cookieName 浏览器登录时保存 State 的 Cookie
+const cookieName = "cicd_oidc"
+
+// ErrStateMismatch 回调中的 state 与发起登录时不一致, 可能是伪造的回调
+var ErrStateMismatch = errors.New("OIDC回调的state不匹配")
+
+// State 一次登录流程的随机值, 需在发起登录与处理回调之间由调用方保存
+type State struct {
+	State    string
+	Nonce    string
+	Verifier string
+}
+
+// Flow 串联授权码流程: 跳转认证服务, 换取并校验 ID 令牌, 创建本地用户并签发本系统的令牌
+type Flow struct {
+	authenticator *auth.Authenticator
+	client        *Client
+	provisioner   *Provisioner
+}
+
+func NewFlow(a *auth.Authenticator, c *Client, p *Provisioner) *Flow {
+	return &Flow{authenticator: a, client: c, provisioner: p}
+}
+
+// Start 生成 State 并返回授权地址
+func (f *Flow) Start(ctx context.Context) (string, *State, error) {
+	st := &State{State: RandomString(16), Nonce: RandomString(16), Verifier: NewVerifier()}
+	u, err := f.client.AuthCodeURL(ctx, st.State, st.Nonce, st.Verifier)
+	if err != nil {
+		return "", nil, err
+	}
+	return u, st, nil
+}
+
+// Finish 处理回调参数, state 与 code 取自回调地址的查询参数, st 中的随机值不能为空
+func (f *Flow) Finish(ctx context.Context, st *State, state string, code string) (*auth.TokenPair, error) {
+	if st == nil || st.State == "" || st.Nonce == "" || st.Verifier == "" || subtle.ConstantTimeCompare([]byte(st.State), []byte(state)) != 1 {
+		return nil, ErrStateMismatch
+	}
+	if code == "" {
+		return nil, errors.New("OIDC回调中缺少code")
+	}
+	claims, err := f.client.Exchange(ctx, code, st.Verifier, st.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	u, err := f.provisioner.Provision(claims)
+	if err != nil {
+		return nil, err
+	}
+	return f.authenticator.LoginUser(ctx, u)
+}
+
+// Handler 提供 GET /login 与 GET /callback 接口: /login 跳转到认证服务,
+// /callback 完成登录后以 JSON 返回令牌, State 保存在 HttpOnly Cookie 中
+func (f *Flow) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		u, st, err := f.Start(r.Context())
+		if err != nil {
+			auth.WriteError(w, http.StatusBadGateway, err)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     cookieName,
+			Value:    strings.Join([]string{st.State, st.Nonce, st.Verifier}, "."),
+			Path:     "/",
+			MaxAge:   int((10 * time.Minute).Seconds()),
+			HttpOnly: true,
+			Secure:   r.TLS != nil || strings.HasPrefix(f.client.config.RedirectURL, "https://"),
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, u, http.StatusFound)
+	})
+	mux.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: cookieName, Path: "/", MaxAge: -1})
+		query := r.URL.Query()
+		if e := query.Get("error"); e != "" {
+			auth.WriteError(w, http.StatusUnauthorized, fmt.Errorf("OIDC认证失败: %s %s", e, query.Get("error_description")))
+			return
+		}
+		var st *State
+		if c, err := r.Cookie(cookieName); err == nil {
+			if parts := strings.Split(c.Value, "."); len(parts) == 3 {
+				st = &State{State: parts[0], Nonce: parts[1], Verifier: parts[2]}
+			}
+		}
+		pair, err := f.Finish(auth.WithClient(r.Context(), auth.ClientFromRequest(r)), st, query.Get("state"), query.Get("code"))
+		if err != nil {
+			auth.WriteError(w, http.StatusUnauthorized, err)
+			return
+		}
+		auth.WriteJSON(w, http.StatusOK, pair)
+	})
+	return mux
+}
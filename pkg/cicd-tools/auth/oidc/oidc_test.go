@@ -0,0 +1,291 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"devops/cicd-tools/pkg/cicd-tools/auth"
+	"devops/cicd-tools/pkg/cicd-tools/auth/oidc/oidctest"
+	"devops/cicd-tools/pkg/cicd-tools/config"
+	"devops/cicd-tools/pkg/cicd-tools/model"
+	"devops/cicd-tools/pkg/cicd-tools/store/memstore"
+)
+
+type testEnv struct {
+	issuer *oidctest.Issuer
+	store  model.Store
+	authn  *auth.Authenticator
+	client *Client
+	flow   *Flow
+	url    string
+}
+
+// newTestEnv 启动 oidctest 认证服务与挂载了 Flow.Handler 的应用, 回调地址为 <url>/oidc/callback
+func newTestEnv(t *testing.T) *testEnv {
+	iss := oidctest.NewIssuer("cicd", "secret")
+	t.Cleanup(iss.Close)
+	s := memstore.New()
+	if err := s.Roles().Create(&model.Role{Name: "admin"}); err != nil {
+		t.Fatal(err)
+	}
+	tc := config.Default().Auth.Token
+	tc.Secret = strings.Repeat("k", 32)
+	tokens, err := auth.NewTokens(tc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := auth.NewAuthenticator(s, tokens)
+
+	mux := http.NewServeMux()
+	app := httptest.NewServer(mux)
+	t.Cleanup(app.Close)
+	c := config.Default().Auth.OIDC
+	c.Issuer = iss.URL()
+	c.ClientID = "cicd"
+	c.ClientSecret = "secret"
+	c.RedirectURL = app.URL + "/oidc/callback"
+	c.GroupMapping = []config.OIDCMapping{{Claim: "platform", Group: "admins", Roles: []string{"admin"}}, {Claim: "dev", Group: "developers"}}
+	client := NewClient(c)
+	flow := NewFlow(a, client, NewProvisioner(s, c))
+	mux.Handle("/oidc/", http.StripPrefix("/oidc", flow.Handler()))
+	return &testEnv{issuer: iss, store: s, authn: a, client: client, flow: flow, url: app.URL}
+}
+
+// login 使用浏览器流程登录, 返回回调的状态码与令牌
+func (e *testEnv) login(t *testing.T) (int, *auth.TokenPair) {
+	t.Helper()
+	jar, _ := cookiejar.New(nil)
+	resp, err := (&http.Client{Jar: jar}).Get(e.url + "/oidc/login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	pair := new(auth.TokenPair)
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(pair); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode, pair
+}
+
+// authorize 发起授权并直接取得回调中的 state 与 code
+func (e *testEnv) authorize(t *testing.T) (*State, string, string) {
+	t.Helper()
+	u, st, err := e.flow.Start(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := noRedirect.Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	loc, err := resp.Location()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st, loc.Query().Get("state"), loc.Query().Get("code")
+}
+
+func TestFlowLogin(t *testing.T) {
+	e := newTestEnv(t)
+	e.issuer.SetClaims(map[string]interface{}{
+		"sub":                "u1",
+		"preferred_username": "alice",
+		"email":              "alice@example.org",
+		"email_verified":     true,
+		"name":               "Alice",
+		"groups":             []string{"platform", "dev", "other"},
+	})
+	status, pair := e.login(t)
+	if status != http.StatusOK {
+		t.Fatalf("status = %d", status)
+	}
+	id, err := e.authn.Authenticate(pair.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Name != "alice" || !id.HasRole("admin") {
+		t.Fatalf("identity = %+v", id)
+	}
+	u, err := e.store.Users().First(&model.User{Name: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Source != model.SourceOIDC || u.ExternalID != "u1" || u.FullName != "Alice" {
+		t.Fatalf("user = %+v", u)
+	}
+
+	// 再次登录时按声明更新邮箱与组成员
+	e.issuer.SetClaims(map[string]interface{}{"sub": "u1", "preferred_username": "alice", "email": "alice2@example.org", "email_verified": true, "groups": "dev"})
+	if status, _ := e.login(t); status != http.StatusOK {
+		t.Fatalf("status = %d", status)
+	}
+	u, err = e.store.Users().Get(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups, err := e.store.Users().Groups(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Email != "alice2@example.org" || len(groups) != 1 || groups[0].Name != "developers" {
+		t.Fatalf("user = %+v, groups = %v", u, groups)
+	}
+}
+
+func TestFlowRejectsUnverifiedEmail(t *testing.T) {
+	e := newTestEnv(t)
+	if err := e.store.Users().Create(&model.User{Name: "carol", Email: "carol@example.org"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, verified := range []interface{}{nil, false, "true"} {
+		claims := map[string]interface{}{"sub": "u2", "preferred_username": "carol2", "email": "carol@example.org"}
+		if verified != nil {
+			claims["email_verified"] = verified
+		}
+		e.issuer.SetClaims(claims)
+		if status, _ := e.login(t); status != http.StatusUnauthorized {
+			t.Fatalf("email_verified=%v: status = %d", verified, status)
+		}
+	}
+	if _, err := e.store.Users().First(&model.User{Source: model.SourceOIDC, ExternalID: "u2"}); !errors.Is(err, model.ErrNotFound) {
+		t.Fatalf("unverified user provisioned: %v", err)
+	}
+}
+
+func TestFlowState(t *testing.T) {
+	e := newTestEnv(t)
+	e.issuer.SetClaims(map[string]interface{}{"sub": "u1", "preferred_username": "alice", "email": "alice@example.org", "email_verified": true})
+	ctx := context.Background()
+
+	// 没有 Cookie 的回调
+	resp, err := http.Get(e.url + "/oidc/callback?state=x&code=y")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+
+	st, state, code := e.authorize(t)
+	if _, err := e.flow.Finish(ctx, st, "other", code); !errors.Is(err, ErrStateMismatch) {
+		t.Fatalf("wrong state: %v", err)
+	}
+	if _, err := e.flow.Finish(ctx, &State{Verifier: st.Verifier}, "", code); !errors.Is(err, ErrStateMismatch) {
+		t.Fatalf("empty state: %v", err)
+	}
+	if _, err := e.flow.Finish(ctx, &State{State: st.State, Verifier: st.Verifier}, state, code); !errors.Is(err, ErrStateMismatch) {
+		t.Fatalf("empty nonce: %v", err)
+	}
+	if _, err := e.flow.Finish(ctx, st, state, code); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFlowPKCE(t *testing.T) {
+	e := newTestEnv(t)
+	e.issuer.SetClaims(map[string]interface{}{"sub": "u1", "preferred_username": "alice", "email": "alice@example.org", "email_verified": true})
+	st, state, code := e.authorize(t)
+	wrong := *st
+	wrong.Verifier = NewVerifier()
+	if _, err := e.flow.Finish(context.Background(), &wrong, state, code); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Fatalf("wrong verifier: %v", err)
+	}
+	// 授权码只能使用一次, 这里需要重新授权
+	st, state, code = e.authorize(t)
+	if _, err := e.flow.Finish(context.Background(), st, state, code); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	e := newTestEnv(t)
+	ctx := context.Background()
+	now := time.Now()
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{"iss": e.issuer.URL(), "aud": "cicd", "sub": "x", "exp": now.Add(time.Minute).Unix(), "nonce": "n"}
+	}
+	sign := func(claims jwt.MapClaims) string {
+		token, err := e.issuer.Sign(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	claims, err := e.client.Verify(ctx, sign(valid()), "n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "x" {
+		t.Fatalf("claims = %+v", claims)
+	}
+
+	hs256, err := jwt.NewWithClaims(jwt.SigningMethodHS256, valid()).SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	none, err := jwt.NewWithClaims(jwt.SigningMethodNone, valid()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	with := func(name string, value interface{}) string {
+		c := valid()
+		if value == nil {
+			delete(c, name)
+		} else {
+			c[name] = value
+		}
+		return sign(c)
+	}
+	cases := []struct {
+		name  string
+		token string
+		nonce string
+	}{
+		{"wrong issuer", with("iss", "http://evil.example.org"), "n"},
+		{"wrong audience", with("aud", "other"), "n"},
+		{"expired", with("exp", now.Add(-time.Minute).Unix()), "n"},
+		{"missing exp", with("exp", nil), "n"},
+		{"missing sub", with("sub", nil), "n"},
+		{"nonce mismatch", sign(valid()), "m"},
+		{"missing nonce claim", with("nonce", nil), "n"},
+		{"empty nonce", with("nonce", ""), ""},
+		{"HS256", hs256, "n"},
+		{"none", none, "n"},
+	}
+	for _, c := range cases {
+		if _, err := e.client.Verify(ctx, c.token, c.nonce); !errors.Is(err, ErrInvalidIDToken) {
+			t.Errorf("%s: err = %v", c.name, err)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package oidc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"devops/cicd-tools/pkg/cicd-tools/config"
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+// Provisioner 按 ID 令牌中的信息创建或更新本地用户, 并按 GroupMapping 维护组成员与组的角色
+//
+// 用户按 Source 为 oidc 且 ExternalID 为 sub 匹配, 首次登录时创建; 邮箱需经认证服务验证 (email_verified),
+// 用户名或邮箱已被其它用户占用时拒绝登录, 不会接管本地用户. 用户只在映射中出现的组之间增减, 不影响其它组的成员关系
+type Provisioner struct {
+	store  model.Store
+	config config.OIDC
+}
+
+func NewProvisioner(s model.Store, c config.OIDC) *Provisioner {
+	return &Provisioner{store: s, config: c}
+}
+
+func (p *Provisioner) Provision(c *Claims) (*model.User, error) {
+	var u *model.User
+	err := p.store.Transaction(func(tx model.Store) error {
+		var err error
+		if u, err = p.user(tx, c); err != nil {
+			return err
+		}
+		return p.groups(tx, u, c.Groups)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (p *Provisioner) user(tx model.Store, c *Claims) (*model.User, error) {
+	name := c.Username
+	if name == "" {
+		name = strings.SplitN(c.Email, "@", 2)[0]
+	}
+	if name == "" || c.Email == "" {
+		return nil, fmt.Errorf("OIDC用户%s缺少用户名或邮箱", c.Subject)
+	}
+	if !c.EmailVerified {
+		return nil, fmt.Errorf("OIDC用户%s的邮箱%s未验证", c.Subject, c.Email)
+	}
+	u, err := tx.Users().First(&model.User{Source: model.SourceOIDC, ExternalID: c.Subject})
+	if errors.Is(err, model.ErrNotFound) {
+		u = &model.User{Source: model.SourceOIDC, ExternalID: c.Subject}
+	} else if err != nil {
+		return nil, fmt.Errorf("查询OIDC用户%s失败\n%w", c.Subject, err)
+	}
+	if err := p.unique(tx, u.ID, &model.User{Name: name}, "用户名"+name); err != nil {
+		return nil, err
+	}
+	if err := p.unique(tx, u.ID, &model.User{Email: c.Email}, "邮箱"+c.Email); err != nil {
+		return nil, err
+	}
+	if u.ID != 0 && u.Name == name && u.Email == c.Email && (c.FullName == "" || u.FullName == c.FullName) {
+		return u, nil
+	}
+	u.Name = name
+	u.Email = c.Email
+	if c.FullName != "" {
+		u.FullName = c.FullName
+	}
+	if u.ID == 0 {
+		err = tx.Users().Create(u)
+	} else {
+		err = tx.Users().Save(u)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("保存OIDC用户%s失败\n%w", name, err)
+	}
+	return u, nil
+}
+
+// unique 检查 cond 对应的用户不存在或就是 id 本身
+func (p *Provisioner) unique(tx model.Store, id uint, cond *model.User, what string) error {
+	other, err := tx.Users().First(cond)
+	if errors.Is(err, model.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("查询%s失败\n%w", what, err)
+	}
+	if other.ID != id {
+		return fmt.Errorf("%s已被其它用户使用, 无法通过OIDC登录", what)
+	}
+	return nil
+}
+
+func (p *Provisioner) groups(tx model.Store, u *model.User, claims []string) error {
+	if len(p.config.GroupMapping) == 0 {
+		return nil
+	}
+	in := map[string]bool{}
+	for _, value := range claims {
+		in[value] = true
+	}
+	// 同一组可以由多个声明值映射, 任一命中即为成员
+	member := map[string]bool{}
+	var names []string
+	for _, value := range p.config.GroupMapping {
+		if _, ok := member[value.Group]; !ok {
+			names = append(names, value.Group)
+		}
+		member[value.Group] = member[value.Group] || in[value.Claim]
+	}
+
+	current := map[string]bool{}
+	groups, err := tx.Users().Groups(u.ID)
+	if err != nil {
+		return fmt.Errorf("查询用户%s的组失败\n%w", u.Name, err)
+	}
+	for _, value := range groups {
+		current[value.Name] = true
+	}
+
+	for _, name := range names {
+		if !member[name] && !current[name] {
+			continue
+		}
+		g, err := p.group(tx, name)
+		if err != nil {
+			return err
+		}
+		if member[name] == current[name] {
+			continue
+		}
+		if member[name] {
+			_, err = tx.Users().AddGroup(u.ID, g.ID)
+		} else {
+			err = tx.Users().RemoveGroup(u.ID, g.ID)
+		}
+		if err != nil {
+			return fmt.Errorf("更新用户%s在组%s中的成员关系失败\n%w", u.Name, name, err)
+		}
+	}
+	return nil
+}
+
+// group 返回映射的组, 不存在时创建, 并确保组绑定了映射中配置的全局角色
+func (p *Provisioner) group(tx model.Store, name string) (*model.Group, error) {
+	g, err := tx.Groups().First(&model.Group{Name: name})
+	if errors.Is(err, model.ErrNotFound) {
+		g = &model.Group{Name: name, Source: model.SourceOIDC}
+		err = tx.Groups().Create(g)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("获取组%s失败\n%w", name, err)
+	}
+	for _, mapping := range p.config.GroupMapping {
+		if mapping.Group != name {
+			continue
+		}
+		for _, value := range mapping.Roles {
+			r, err := tx.Roles().First(&model.Role{Name: value})
+			if err != nil {
+				return nil, fmt.Errorf("组%s映射的角色%s不存在\n%w", name, value, err)
+			}
+			if _, err := tx.Groups().AddRole(g.ID, r.ID); err != nil {
+				return nil, fmt.Errorf("为组%s绑定角色%s失败\n%w", name, value, err)
+			}
+		}
+	}
+	return g, nil
+}
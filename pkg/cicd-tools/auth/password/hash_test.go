@@ -0,0 +1,121 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package password
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testParams 降低内存与迭代次数以缩短测试时间
+var testParams = Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestHashVerify(t *testing.T) {
+	encoded, err := Hash("correct horse", testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Fatalf("encoded = %s", encoded)
+	}
+	if ok, err := Verify("correct horse", encoded); err != nil || !ok {
+		t.Fatalf("Verify(correct) = %v, %v", ok, err)
+	}
+	if ok, err := Verify("wrong horse", encoded); err != nil || ok {
+		t.Fatalf("Verify(wrong) = %v, %v", ok, err)
+	}
+	other, err := Hash("correct horse", testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == encoded {
+		t.Fatal("same salt for two hashes")
+	}
+}
+
+func TestVerifyBcrypt(t *testing.T) {
+	data, err := bcrypt.GenerateFromPassword([]byte("legacy"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := string(data)
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		encoded := prefix + hash[4:]
+		if ok, err := Verify("legacy", encoded); err != nil || !ok {
+			t.Fatalf("%s: Verify(correct) = %v, %v", prefix, ok, err)
+		}
+		if ok, err := Verify("other", encoded); err != nil || ok {
+			t.Fatalf("%s: Verify(wrong) = %v, %v", prefix, ok, err)
+		}
+	}
+}
+
+func TestVerifyInvalid(t *testing.T) {
+	encoded, err := Hash("x", testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(encoded, "$")
+	cases := []string{
+		"",
+		"plain",
+		"$argon2i$v=19$m=1024,t=1,p=1$" + parts[4] + "$" + parts[5],
+		"$argon2id$v=16$m=1024,t=1,p=1$" + parts[4] + "$" + parts[5],
+		"$argon2id$v=19$m=x,t=1,p=1$" + parts[4] + "$" + parts[5],
+		"$argon2id$v=19$m=1024,t=1,p=1$!!$" + parts[5],
+		"$argon2id$v=19$m=1024,t=1,p=1$" + parts[4] + "$",
+	}
+	for _, value := range cases {
+		if ok, err := Verify("x", value); ok || !errors.Is(err, ErrInvalidHash) {
+			t.Errorf("Verify(%q) = %v, %v", value, ok, err)
+		}
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	encoded, err := Hash("x", testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if NeedsRehash(encoded, testParams) {
+		t.Fatal("same params need rehash")
+	}
+	changed := []func(*Params){
+		func(p *Params) { p.Memory *= 2 },
+		func(p *Params) { p.Iterations++ },
+		func(p *Params) { p.Parallelism++ },
+		func(p *Params) { p.SaltLength = 32 },
+		func(p *Params) { p.KeyLength = 64 },
+	}
+	for i, change := range changed {
+		p := testParams
+		change(&p)
+		if !NeedsRehash(encoded, p) {
+			t.Errorf("case %d: changed params %+v do not need rehash", i, p)
+		}
+	}
+	legacy, err := bcrypt.GenerateFromPassword([]byte("x"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !NeedsRehash(string(legacy), testParams) {
+		t.Fatal("bcrypt hash does not need rehash")
+	}
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package password
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Policy 密码策略, History 为新密码不能与之相同的最近使用过的密码数量, 为 0 时不检查
+type Policy struct {
+	MinLength     int  `yaml:"min_length"`
+	MaxLength     int  `yaml:"max_length"`
+	RequireUpper  bool `yaml:"require_upper"`
+	RequireLower  bool `yaml:"require_lower"`
+	RequireDigit  bool `yaml:"require_digit"`
+	RequireSymbol bool `yaml:"require_symbol"`
+	History       int  `yaml:"history"`
+}
+
+func DefaultPolicy() Policy {
+	return Policy{
+		MinLength:    8,
+		MaxLength:    128,
+		RequireLower: true,
+		RequireDigit: true,
+		History:      3,
+	}
+}
+
+// Validate 检查密码是否满足长度与复杂度要求, 不满足时一次返回全部未满足的规则
+func (p Policy) Validate(password string) error {
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			symbol = true
+		}
+	}
+
+	var problems []string
+	length := len([]rune(password))
+	if length < p.MinLength {
+		problems = append(problems, fmt.Sprintf("长度不能少于%d位", p.MinLength))
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		problems = append(problems, fmt.Sprintf("长度不能超过%d位", p.MaxLength))
+	}
+	if p.RequireUpper && !upper {
+		problems = append(problems, "需包含大写字母")
+	}
+	if p.RequireLower && !lower {
+		problems = append(problems, "需包含小写字母")
+	}
+	if p.RequireDigit && !digit {
+		problems = append(problems, "需包含数字")
+	}
+	if p.RequireSymbol && !symbol {
+		problems = append(problems, "需包含特殊字符")
+	}
+	if len(problems) > 0 {
+		return errors.New("密码不符合策略: " + strings.Join(problems, ", "))
+	}
+	return nil
+}
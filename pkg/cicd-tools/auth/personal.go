@@ -0,0 +1,170 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+	"devops/cicd-tools/pkg/cicd-tools/rbac"
+)
+
+// PersonalTokenPrefix 个人访问令牌的固定前缀, 用于与 JWT 区分
+const PersonalTokenPrefix = "cicd_"
+
+// ParseScopes 校验并规范化 category:action 形式的令牌范围, 两部分都可以为 *
+func ParseScopes(values []string) ([]string, error) {
+	var scopes []string
+	for _, value := range values {
+		for _, scope := range strings.Split(value, ",") {
+			scope = strings.TrimSpace(scope)
+			if scope == "" {
+				continue
+			}
+			parts := strings.Split(scope, ":")
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				return nil, fmt.Errorf("令牌范围%s无效, 格式为category:action", scope)
+			}
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, errors.New("个人访问令牌至少需要一个范围")
+	}
+	return scopes, nil
+}
+
+// ScopeAllows 判断令牌范围是否包含 category 下的 action
+func ScopeAllows(scopes []string, category string, action string) bool {
+	for _, value := range scopes {
+		parts := strings.SplitN(value, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if (parts[0] == rbac.Wildcard || parts[0] == category) && (parts[1] == rbac.Wildcard || parts[1] == action) {
+			return true
+		}
+	}
+	return false
+}
+
+// CreatePersonalToken 为用户创建个人访问令牌, ttl 为 0 时长期有效; 令牌明文只在创建时返回一次
+func (a *Authenticator) CreatePersonalToken(uid uint, name string, scopes []string, ttl time.Duration) (string, *model.PersonalToken, error) {
+	if name == "" {
+		return "", nil, errors.New("个人访问令牌需指定名称")
+	}
+	scopes, err := ParseScopes(scopes)
+	if err != nil {
+		return "", nil, err
+	}
+	if _, err := a.store.Users().Get(uid); err != nil {
+		return "", nil, fmt.Errorf("用户%d不存在\n%w", uid, err)
+	}
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, fmt.Errorf("生成个人访问令牌失败\n%w", err)
+	}
+	plain := PersonalTokenPrefix + hex.EncodeToString(b)
+	t := &model.PersonalToken{
+		UserID: uid,
+		Name:   name,
+		Prefix: plain[:len(PersonalTokenPrefix)+6],
+		Hash:   hashToken(plain),
+		Scopes: strings.Join(scopes, ","),
+	}
+	if ttl > 0 {
+		expiresAt := a.now().Add(ttl)
+		t.ExpiresAt = &expiresAt
+	}
+	if err := a.store.Tokens().CreatePersonal(t); err != nil {
+		return "", nil, fmt.Errorf("保存个人访问令牌失败\n%w", err)
+	}
+	return plain, t, nil
+}
+
+// RevokePersonalToken 吊销个人访问令牌, 记录保留用于审计
+func (a *Authenticator) RevokePersonalToken(id uint) (*model.PersonalToken, error) {
+	t, err := a.store.Tokens().GetPersonal(id)
+	if err != nil {
+		return nil, fmt.Errorf("个人访问令牌%d不存在\n%w", id, err)
+	}
+	if t.RevokedAt != nil {
+		return t, nil
+	}
+	if err := a.store.Tokens().RevokePersonal(id, a.now()); err != nil {
+		return nil, fmt.Errorf("吊销个人访问令牌%d失败\n%w", id, err)
+	}
+	return a.store.Tokens().GetPersonal(id)
+}
+
+func (a *Authenticator) authenticatePersonal(token string) (*Identity, error) {
+	t, err := a.store.Tokens().PersonalByHash(hashToken(token))
+	if errors.Is(err, model.ErrNotFound) {
+		return nil, ErrInvalidToken
+	} else if err != nil {
+		return nil, fmt.Errorf("查询个人访问令牌失败\n%w", err)
+	}
+	now := a.now()
+	if t.RevokedAt != nil {
+		return nil, ErrRevoked
+	}
+	if !t.Active(now) {
+		return nil, fmt.Errorf("%w: 个人访问令牌已过期", ErrInvalidToken)
+	}
+	u, err := a.store.Users().Get(t.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: 用户%d不存在", ErrInvalidToken, t.UserID)
+	}
+	if u.Disabled {
+		return nil, fmt.Errorf("%w\n用户%s已停用", ErrDisabled, u.Name)
+	}
+	roles, err := a.roles(u.ID)
+	if err != nil {
+		return nil, err
+	}
+	// 只在令牌未被并发吊销时更新使用时间, 吊销与使用同时发生时以吊销为准
+	touched, err := a.store.Tokens().TouchPersonal(t.ID, now)
+	if err != nil {
+		return nil, fmt.Errorf("更新个人访问令牌使用时间失败\n%w", err)
+	}
+	if !touched {
+		return nil, ErrRevoked
+	}
+	t.LastUsedAt = &now
+	id := &Identity{
+		UserID:  u.ID,
+		Name:    u.Name,
+		Roles:   roles,
+		Scopes:  strings.Split(t.Scopes, ","),
+		TokenID: fmt.Sprintf("pat:%d", t.ID),
+	}
+	if t.ExpiresAt != nil {
+		id.ExpiresAt = *t.ExpiresAt
+	}
+	return id, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,153 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package auth
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseScopes(t *testing.T) {
+	scopes, err := ParseScopes([]string{"repo:read, build:*", "*:read"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"repo:read", "build:*", "*:read"}; !reflect.DeepEqual(scopes, want) {
+		t.Fatalf("scopes = %v, want %v", scopes, want)
+	}
+	for _, value := range []string{"", " , ", "repo", "repo:", ":read", "repo:read:x"} {
+		if _, err := ParseScopes([]string{value}); err == nil {
+			t.Errorf("ParseScopes(%q) accepted", value)
+		}
+	}
+}
+
+func TestScopeAllows(t *testing.T) {
+	cases := []struct {
+		scopes   []string
+		category string
+		action   string
+		allowed  bool
+	}{
+		{[]string{"repo:read"}, "repo", "read", true},
+		{[]string{"repo:read"}, "repo", "update", false},
+		{[]string{"repo:read"}, "build", "read", false},
+		{[]string{"repo:*"}, "repo", "delete", true},
+		{[]string{"repo:*"}, "project", "delete", false},
+		{[]string{"*:read"}, "build", "read", true},
+		{[]string{"*:read"}, "build", "create", false},
+		{[]string{"*:*"}, "user", "delete", true},
+		{[]string{"build:create", "repo:read"}, "repo", "read", true},
+		{[]string{"repo"}, "repo", "read", false},
+		{[]string{"repo:re*"}, "repo", "read", false},
+		{nil, "repo", "read", false},
+	}
+	for _, c := range cases {
+		if got := ScopeAllows(c.scopes, c.category, c.action); got != c.allowed {
+			t.Errorf("ScopeAllows(%v, %s, %s) = %v, want %v", c.scopes, c.category, c.action, got, c.allowed)
+		}
+	}
+}
+
+func TestPersonalToken(t *testing.T) {
+	s, a, u := newTestAuthenticator(t)
+	plain, pt, err := a.CreatePersonalToken(u.ID, "ci", []string{"repo:read,build:*"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(plain, PersonalTokenPrefix) || !strings.HasPrefix(plain, pt.Prefix) || strings.Contains(pt.Hash, plain) {
+		t.Fatalf("token %s stored as %+v", plain, pt)
+	}
+	id, err := a.Authenticate(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.UserID != u.ID || id.ExpiresAt.IsZero() {
+		t.Fatalf("identity = %+v", id)
+	}
+	for _, c := range []struct {
+		category, action string
+		allowed          bool
+	}{
+		{"repo", "read", true},
+		{"repo", "update", false},
+		{"build", "create", true},
+		{"user", "read", false},
+	} {
+		if got := id.Allows(c.category, c.action); got != c.allowed {
+			t.Errorf("Allows(%s, %s) = %v, want %v", c.category, c.action, got, c.allowed)
+		}
+	}
+	stored, err := s.Tokens().GetPersonal(pt.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.LastUsedAt == nil {
+		t.Fatal("last used time not recorded")
+	}
+
+	// 访问令牌不受范围限制
+	pair, err := a.Login("alice", "hello1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := a.Authenticate(pair.AccessToken); err != nil || !id.Allows("user", "delete") {
+		t.Fatalf("access token identity = %+v, %v", id, err)
+	}
+
+	if _, err := a.Authenticate(PersonalTokenPrefix + "0000"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("unknown token: %v", err)
+	}
+	a.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if _, err := a.Authenticate(plain); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expired token: %v", err)
+	}
+	a.now = time.Now
+	if _, err := a.RevokePersonalToken(pt.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Authenticate(plain); !errors.Is(err, ErrRevoked) {
+		t.Fatalf("revoked token: %v", err)
+	}
+}
+
+func TestPersonalTokenInvalid(t *testing.T) {
+	_, a, u := newTestAuthenticator(t)
+	if _, _, err := a.CreatePersonalToken(u.ID, "", []string{"repo:read"}, 0); err == nil {
+		t.Fatal("token without name accepted")
+	}
+	if _, _, err := a.CreatePersonalToken(u.ID, "ci", nil, 0); err == nil {
+		t.Fatal("token without scopes accepted")
+	}
+	if _, _, err := a.CreatePersonalToken(u.ID+1, "ci", []string{"repo:read"}, 0); err == nil {
+		t.Fatal("token for unknown user accepted")
+	}
+	plain, _, err := a.CreatePersonalToken(u.ID, "ci", []string{"repo:read"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := a.Authenticate(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !id.ExpiresAt.IsZero() {
+		t.Fatalf("token without ttl expires at %s", id.ExpiresAt)
+	}
+}
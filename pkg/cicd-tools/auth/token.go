@@ -0,0 +1,231 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"devops/cicd-tools/pkg/cicd-tools/config"
+)
+
+// 令牌类型, 刷新令牌只能用于换取新的令牌
+const (
+	TypeAccess  = "access"
+	TypeRefresh = "refresh"
+)
+
+// Claims 令牌内容, Subject 为用户 ID, Roles 为签发时用户的全局有效角色, Version 为签发时用户的令牌版本
+type Claims struct {
+	jwt.RegisteredClaims
+	Type    string   `json:"typ"`
+	Name    string   `json:"name,omitempty"`
+	Roles   []string `json:"roles,omitempty"`
+	Version int      `json:"ver,omitempty"`
+}
+
+// Tokens 负责令牌的签发与校验, 只配置公钥时只能校验不能签发
+type Tokens struct {
+	method     jwt.SigningMethod
+	signKey    interface{}
+	verifyKey  interface{}
+	issuer     string
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	now        func() time.Time
+}
+
+func NewTokens(c config.Token) (*Tokens, error) {
+	t := &Tokens{issuer: c.Issuer, accessTTL: c.AccessTTL, refreshTTL: c.RefreshTTL, now: time.Now}
+	switch strings.ToUpper(c.Algorithm) {
+	case "", "HS256":
+		secret, err := loadSecret(c)
+		if err != nil {
+			return nil, err
+		}
+		t.method, t.signKey, t.verifyKey = jwt.SigningMethodHS256, secret, secret
+	case "EDDSA", "ED25519":
+		t.method = jwt.SigningMethodEdDSA
+		if c.PrivateKeyFile != "" {
+			key, err := loadPrivateKey(c.PrivateKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			t.signKey, t.verifyKey = key, key.Public()
+		}
+		if c.PublicKeyFile != "" {
+			key, err := loadPublicKey(c.PublicKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			t.verifyKey = key
+		}
+		if t.verifyKey == nil {
+			return nil, errors.New("EdDSA签名需配置auth.token.private_key_file或auth.token.public_key_file")
+		}
+	default:
+		return nil, fmt.Errorf("不支持的令牌签名算法%s, 支持HS256和EdDSA", c.Algorithm)
+	}
+	return t, nil
+}
+
+// Issue 签发指定类型的令牌, 返回令牌及其 Claims
+func (t *Tokens) Issue(typ string, uid uint, name string, version int, roles []string) (string, *Claims, error) {
+	if t.signKey == nil {
+		return "", nil, errors.New("未配置签名私钥, 不能签发令牌")
+	}
+	ttl := t.accessTTL
+	if typ == TypeRefresh {
+		ttl = t.refreshTTL
+	}
+	id, err := newTokenID()
+	if err != nil {
+		return "", nil, err
+	}
+	now := t.now()
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        id,
+			Issuer:    t.issuer,
+			Subject:   fmt.Sprint(uid),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+		Type:    typ,
+		Name:    name,
+		Version: version,
+	}
+	if typ == TypeAccess {
+		claims.Roles = roles
+	}
+	signed, err := jwt.NewWithClaims(t.method, claims).SignedString(t.signKey)
+	if err != nil {
+		return "", nil, fmt.Errorf("签发令牌失败\n%w", err)
+	}
+	return signed, claims, nil
+}
+
+// Parse 校验签名、签发者、有效期与令牌类型, 不检查吊销列表
+func (t *Tokens) Parse(token string, typ string) (*Claims, error) {
+	claims := new(Claims)
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{t.method.Alg()}))
+	_, err := parser.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return t.verifyKey, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w\n%v", ErrInvalidToken, err)
+	}
+	if t.issuer != "" && !claims.VerifyIssuer(t.issuer, true) {
+		return nil, fmt.Errorf("%w: 签发者不匹配", ErrInvalidToken)
+	}
+	if claims.Type != typ {
+		return nil, fmt.Errorf("%w: 需要%s令牌", ErrInvalidToken, typ)
+	}
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return nil, fmt.Errorf("%w: 缺少jti或exp", ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+// UserID 返回 Subject 中的用户 ID
+func (c *Claims) UserID() (uint, error) {
+	var uid uint
+	if _, err := fmt.Sscanf(c.Subject, "%d", &uid); err != nil || uid == 0 {
+		return 0, fmt.Errorf("%w: 无效的用户%s", ErrInvalidToken, c.Subject)
+	}
+	return uid, nil
+}
+
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("生成令牌ID失败\n%w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// loadSecret HS256 密钥不能少于 32 字节
+func loadSecret(c config.Token) ([]byte, error) {
+	secret := []byte(c.Secret)
+	if c.SecretFile != "" {
+		data, err := os.ReadFile(c.SecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取令牌密钥文件%s失败\n%w", c.SecretFile, err)
+		}
+		secret = []byte(strings.TrimSpace(string(data)))
+	}
+	if len(secret) < 32 {
+		return nil, errors.New("HS256签名需配置不少于32字节的auth.token.secret或auth.token.secret_file")
+	}
+	return secret, nil
+}
+
+func loadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("解析私钥%s失败\n%w", path, err)
+	}
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("私钥%s不是Ed25519私钥", path)
+	}
+	return private, nil
+}
+
+func loadPublicKey(path string) (crypto.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("解析公钥%s失败\n%w", path, err)
+	}
+	public, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("公钥%s不是Ed25519公钥", path)
+	}
+	return public, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取密钥文件%s失败\n%w", path, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("密钥文件%s不是PEM格式", path)
+	}
+	return block, nil
+}
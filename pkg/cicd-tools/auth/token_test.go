@@ -0,0 +1,226 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"devops/cicd-tools/pkg/cicd-tools/auth/password"
+	"devops/cicd-tools/pkg/cicd-tools/config"
+	"devops/cicd-tools/pkg/cicd-tools/model"
+	"devops/cicd-tools/pkg/cicd-tools/store/memstore"
+)
+
+var testSecret = strings.Repeat("k", 32)
+
+func newTestTokens(t *testing.T) *Tokens {
+	t.Helper()
+	c := config.Default().Auth.Token
+	c.Secret = testSecret
+	c.Issuer = "cicd-test"
+	tokens, err := NewTokens(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokens
+}
+
+// newTestAuthenticator 返回使用内存存储的认证器, 用户 alice 的密码为 hello1234
+func newTestAuthenticator(t *testing.T) (model.Store, *Authenticator, *model.User) {
+	t.Helper()
+	s := memstore.New()
+	model.SetStore(s)
+	model.SetPasswordPolicy(password.DefaultPolicy(), password.Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	u := (&model.User{Name: "alice", Email: "alice@example.org"}).Create()
+	if u.Error != nil {
+		t.Fatal(u.Error)
+	}
+	if u.SetPassword("hello1234"); u.Error != nil {
+		t.Fatal(u.Error)
+	}
+	return s, NewAuthenticator(s, newTestTokens(t)), u
+}
+
+func TestTokensParse(t *testing.T) {
+	tokens := newTestTokens(t)
+	access, claims, err := tokens.Issue(TypeAccess, 7, "alice", 2, []string{"dev"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := tokens.Parse(access, TypeAccess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.ID != claims.ID || parsed.Subject != "7" || parsed.Version != 2 || len(parsed.Roles) != 1 {
+		t.Fatalf("claims = %+v", parsed)
+	}
+	refresh, _, err := tokens.Issue(TypeRefresh, 7, "alice", 2, []string{"dev"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := func() jwt.MapClaims {
+		now := time.Now()
+		return jwt.MapClaims{"jti": "x", "iss": "cicd-test", "sub": "7", "typ": TypeAccess, "exp": now.Add(time.Minute).Unix()}
+	}
+	sign := func(method jwt.SigningMethod, claims jwt.MapClaims, key interface{}) string {
+		token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	if _, err := tokens.Parse(sign(jwt.SigningMethodHS256, valid(), []byte(testSecret)), TypeAccess); err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	with := func(name string, value interface{}) jwt.MapClaims {
+		c := valid()
+		if value == nil {
+			delete(c, name)
+		} else {
+			c[name] = value
+		}
+		return c
+	}
+	expired := time.Now()
+	tokens.now = func() time.Time { return expired.Add(-2 * time.Hour) }
+	old, _, err := tokens.Issue(TypeAccess, 7, "alice", 2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens.now = time.Now
+
+	cases := []struct {
+		name  string
+		token string
+		typ   string
+	}{
+		{"refresh as access", refresh, TypeAccess},
+		{"access as refresh", access, TypeRefresh},
+		{"HS384", sign(jwt.SigningMethodHS384, valid(), []byte(testSecret)), TypeAccess},
+		{"EdDSA", sign(jwt.SigningMethodEdDSA, valid(), edKey), TypeAccess},
+		{"none", sign(jwt.SigningMethodNone, valid(), jwt.UnsafeAllowNoneSignatureType), TypeAccess},
+		{"other secret", sign(jwt.SigningMethodHS256, valid(), []byte(strings.Repeat("x", 32))), TypeAccess},
+		{"tampered", access[:len(access)-2] + "AA", TypeAccess},
+		{"expired", old, TypeAccess},
+		{"expired claims", sign(jwt.SigningMethodHS256, with("exp", time.Now().Add(-time.Minute).Unix()), []byte(testSecret)), TypeAccess},
+		{"missing exp", sign(jwt.SigningMethodHS256, with("exp", nil), []byte(testSecret)), TypeAccess},
+		{"missing jti", sign(jwt.SigningMethodHS256, with("jti", nil), []byte(testSecret)), TypeAccess},
+		{"wrong issuer", sign(jwt.SigningMethodHS256, with("iss", "other"), []byte(testSecret)), TypeAccess},
+		{"missing typ", sign(jwt.SigningMethodHS256, with("typ", nil), []byte(testSecret)), TypeAccess},
+	}
+	for _, c := range cases {
+		if _, err := tokens.Parse(c.token, c.typ); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: err = %v", c.name, err)
+		}
+	}
+}
+
+func TestAuthenticateRevoked(t *testing.T) {
+	_, a, _ := newTestAuthenticator(t)
+	pair, err := a.Login("alice", "hello1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := a.Authenticate(pair.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Name != "alice" {
+		t.Fatalf("identity = %+v", id)
+	}
+	if err := a.Revoke(pair.AccessToken, pair.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Authenticate(pair.AccessToken); !errors.Is(err, ErrRevoked) {
+		t.Fatalf("revoked access token: %v", err)
+	}
+	if _, err := a.Refresh(pair.RefreshToken); !errors.Is(err, ErrRevoked) {
+		t.Fatalf("revoked refresh token: %v", err)
+	}
+	// 吊销已失效的令牌时直接忽略
+	if err := a.Revoke("not a token", pair.AccessToken); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRefreshRotation(t *testing.T) {
+	_, a, _ := newTestAuthenticator(t)
+	pair, err := a.Login("alice", "hello1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Refresh(pair.AccessToken); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("access token used as refresh token: %v", err)
+	}
+	next, err := a.Refresh(pair.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.RefreshToken == pair.RefreshToken {
+		t.Fatal("refresh token not rotated")
+	}
+	if _, err := a.Refresh(pair.RefreshToken); !errors.Is(err, ErrRevoked) {
+		t.Fatalf("reused refresh token: %v", err)
+	}
+	if _, err := a.Authenticate(next.AccessToken); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTokenVersion(t *testing.T) {
+	s, a, u := newTestAuthenticator(t)
+	pair, err := a.Login("alice", "hello1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 修改密码后提升令牌版本, 之前签发的令牌全部失效
+	if u.SetPassword("hello5678"); u.Error != nil {
+		t.Fatal(u.Error)
+	}
+	if _, err := a.Authenticate(pair.AccessToken); !errors.Is(err, ErrRevoked) {
+		t.Fatalf("access token after password change: %v", err)
+	}
+	if _, err := a.Refresh(pair.RefreshToken); !errors.Is(err, ErrRevoked) {
+		t.Fatalf("refresh token after password change: %v", err)
+	}
+	stored, err := s.Users().Get(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.TokenVersion != u.TokenVersion {
+		t.Fatalf("token version = %d, want %d", stored.TokenVersion, u.TokenVersion)
+	}
+	pair, err = a.Login("alice", "hello5678")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Authenticate(pair.AccessToken); err != nil {
+		t.Fatal(err)
+	}
+}
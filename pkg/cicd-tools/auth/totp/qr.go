@@ -0,0 +1,70 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package totp
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"rsc.io/qr"
+)
+
+// QRText 将内容编码为二维码, 以 Unicode 半高方块字符返回, 可直接在终端中扫描
+func QRText(content string) (string, error) {
+	code, err := qr.Encode(content, qr.M)
+	if err != nil {
+		return "", fmt.Errorf("生成二维码失败\n%w", err)
+	}
+	// 四周保留 2 个模块的空白, 每个字符表示上下两个模块
+	const quiet = 2
+	black := func(x, y int) bool {
+		x, y = x-quiet, y-quiet
+		return x >= 0 && y >= 0 && x < code.Size && y < code.Size && code.Black(x, y)
+	}
+	var b strings.Builder
+	size := code.Size + 2*quiet
+	for y := 0; y < size; y += 2 {
+		for x := 0; x < size; x++ {
+			top, bottom := black(x, y), black(x, y+1)
+			switch {
+			case top && bottom:
+				b.WriteString(" ")
+			case top:
+				b.WriteString("▄")
+			case bottom:
+				b.WriteString("▀")
+			default:
+				b.WriteString("█")
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
+
+// WriteQRPNG 将内容编码为 PNG 格式的二维码并写入文件
+func WriteQRPNG(path string, content string) error {
+	code, err := qr.Encode(content, qr.M)
+	if err != nil {
+		return fmt.Errorf("生成二维码失败\n%w", err)
+	}
+	if err := ioutil.WriteFile(path, code.PNG(), 0600); err != nil {
+		return fmt.Errorf("写入二维码文件%s失败\n%w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package totp
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// rfcSecret RFC 6238 附录 B 中 SHA1 的密钥 "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// TestCodeRFC6238 附录 B 的验证码为 8 位, 6 位验证码取其后 6 位
+func TestCodeRFC6238(t *testing.T) {
+	cases := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, c := range cases {
+		code, err := Code(rfcSecret, Step(time.Unix(c.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != c.code {
+			t.Errorf("Code(%d) = %s, want %s", c.unix, code, c.code)
+		}
+	}
+	// 密钥不区分大小写并忽略空格
+	if code, _ := Code("gezd gnbv gy3t qojq gezd gnbv gy3t qojq", Step(time.Unix(59, 0))); code != "287082" {
+		t.Errorf("lower case secret: %s", code)
+	}
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("invalid secret accepted")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+	for _, offset := range []int64{-1, 0, 1} {
+		code, err := Code(rfcSecret, step+offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := Validate(rfcSecret, " "+code+" ", now)
+		if !ok || got != step+offset {
+			t.Errorf("offset %d: Validate = %d, %v", offset, got, ok)
+		}
+	}
+	for _, offset := range []int64{-2, 2} {
+		code, err := Code(rfcSecret, step+offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := Validate(rfcSecret, code, now); ok {
+			t.Errorf("offset %d accepted", offset)
+		}
+	}
+	for _, code := range []string{"", "05047", "0504711", "abcdef"} {
+		if _, ok := Validate(rfcSecret, code, now); ok {
+			t.Errorf("code %q accepted", code)
+		}
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := decode(secret)
+	if err != nil || len(key) != 20 {
+		t.Fatalf("secret %s: %d bytes, %v", secret, len(key), err)
+	}
+	other, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == secret {
+		t.Fatal("same secret generated twice")
+	}
+}
+
+func TestURI(t *testing.T) {
+	u, err := url.Parse(URI("CICD Tools", "alice", rfcSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/CICD Tools:alice" {
+		t.Fatalf("uri = %s", u)
+	}
+	q := u.Query()
+	if q.Get("secret") != rfcSecret || q.Get("issuer") != "CICD Tools" || q.Get("digits") != "6" || q.Get("period") != "30" {
+		t.Fatalf("query = %v", q)
+	}
+}
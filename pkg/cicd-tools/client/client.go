@@ -0,0 +1,118 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package client 是 cicd-tools HTTP 接口的客户端, 每个接口对应一个方法, 由 api.Operations 生成,
+// 接口变化后执行 go generate 重新生成 operations.go; gRPC 接口的客户端为 BuildService
+package client
+
+//go:generate go run ./gen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"devops/cicd-tools/pkg/cicd-tools/api"
+)
+
+// Client 的 Update 方法发送完整的对象, 未设置的字段会被清空, 通常先 Get 再修改
+type Client struct {
+	base  string
+	token string
+	http  *http.Client
+}
+
+// New baseURL 为服务地址, 如 http://127.0.0.1:8080, 不包含 api.Prefix
+func New(baseURL string) *Client {
+	return &Client{base: strings.TrimSuffix(baseURL, "/"), http: http.DefaultClient}
+}
+
+// WithToken 设置访问令牌或个人访问令牌
+func (c *Client) WithToken(token string) *Client {
+	c.token = token
+	return c
+}
+
+func (c *Client) WithHTTPClient(hc *http.Client) *Client {
+	c.http = hc
+	return c
+}
+
+// Error 接口返回的错误, Status 为 HTTP 状态码
+type Error struct {
+	Status      int
+	Message     string `json:"error"`
+	MFARequired bool   `json:"mfa_required"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s", e.Status, e.Message)
+}
+
+// do query 为查询参数结构体, body 与 out 为 nil 时不发送请求体与不解析响应
+func (c *Client) do(ctx context.Context, method string, path string, query interface{}, body interface{}, out interface{}) error {
+	u := c.base + api.Prefix + path
+	if values := api.Values(query); len(values) > 0 {
+		u += "?" + values.Encode()
+	}
+	var reader io.Reader
+	if body != nil && !reflect.ValueOf(body).IsNil() {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return err
+	}
+	if reader != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("请求%s %s失败\n%w", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("读取%s %s的响应失败\n%w", method, path, err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		e := &Error{Status: resp.StatusCode}
+		if err := json.Unmarshal(data, e); err != nil || e.Message == "" {
+			e.Message = http.StatusText(resp.StatusCode)
+		}
+		return e
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("解析%s %s的响应失败\n%w", method, path, err)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// gen 根据 api.Operations 生成客户端方法, 在 client 目录下通过 go generate 执行
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"devops/cicd-tools/pkg/cicd-tools/api"
+)
+
+const output = "operations.go"
+
+func main() {
+	src, err := generate(".")
+	if err == nil {
+		err = ioutil.WriteFile(output, src, 0644)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// generate 返回 dir (client 目录) 下 operations.go 应有的内容
+func generate(dir string) ([]byte, error) {
+	// std 为标准库, imports 为请求与响应类型所在的包
+	std := map[string]bool{"context": true, "net/http": true}
+	imports := map[string]bool{}
+	var body bytes.Buffer
+	for _, op := range api.Operations() {
+		if len(op.Params()) > 0 {
+			std["fmt"] = true
+		}
+		method(&body, op, imports)
+	}
+	header, err := ioutil.ReadFile(filepath.Join(dir, "client.go"))
+	if err != nil {
+		return nil, err
+	}
+	var src bytes.Buffer
+	// 沿用 client.go 的许可证声明
+	src.Write(header[:bytes.Index(header, []byte("*/"))+3])
+	src.WriteString("\n// Code generated by go run ./gen; DO NOT EDIT.\n\npackage client\n\nimport (\n")
+	writeImports(&src, std)
+	src.WriteString("\n")
+	writeImports(&src, imports)
+	src.WriteString(")\n")
+	src.Write(body.Bytes())
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("格式化生成的代码失败\n%w", err)
+	}
+	return formatted, nil
+}
+
+// method 路径参数依次作为 uint 参数, 查询参数与请求体为对应结构体的指针, 列表接口返回切片, 分页列表接口还返回分页信息
+func method(w *bytes.Buffer, op api.Operation, imports map[string]bool) {
+	args := []string{"ctx context.Context"}
+	pathExpr := fmt.Sprintf("%q", op.Path)
+	if params := op.Params(); len(params) > 0 {
+		format := op.Path
+		var names []string
+		for _, value := range params {
+			format = strings.Replace(format, "{"+value+"}", "%d", 1)
+			names = append(names, camel(value))
+			args = append(args, camel(value)+" uint")
+		}
+		pathExpr = fmt.Sprintf("fmt.Sprintf(%q, %s)", format, strings.Join(names, ", "))
+	}
+	query, body := "nil", "nil"
+	if op.Query != nil {
+		args = append(args, "q *"+typeName(reflect.TypeOf(op.Query), imports))
+		query = "q"
+	}
+	if op.Body != nil {
+		args = append(args, "body *"+typeName(reflect.TypeOf(op.Body), imports))
+		body = "body"
+	}
+	call := fmt.Sprintf("c.do(ctx, http.Method%s, %s, %s, %s", strings.Title(strings.ToLower(op.Method)), pathExpr, query, body)
+
+	fmt.Fprintf(w, "\n// %s %s, %s %s\n", op.ID, op.Summary, op.Method, op.Path)
+	signature := fmt.Sprintf("func (c *Client) %s(%s)", op.ID, strings.Join(args, ", "))
+	if op.Response == nil {
+		fmt.Fprintf(w, "%s error {\n\treturn %s, nil)\n}\n", signature, call)
+		return
+	}
+	t := reflect.TypeOf(op.Response)
+	name := typeName(t, imports)
+	if t.Kind() == reflect.Slice && op.Paged() {
+		page := typeName(reflect.TypeOf(api.Page{}), imports)
+		fmt.Fprintf(w, "%s (%s, *%s, error) {\n", signature, name, page)
+		fmt.Fprintf(w, "\tvar out struct {\n\t\tItems %s `json:\"items\"`\n\t\t%s\n\t}\n", name, page)
+		fmt.Fprintf(w, "\tif err := %s, &out); err != nil {\n\t\treturn nil, nil, err\n\t}\n\treturn out.Items, &out.Page, nil\n}\n", call)
+		return
+	}
+	if t.Kind() == reflect.Slice {
+		fmt.Fprintf(w, "%s (%s, error) {\n", signature, name)
+		fmt.Fprintf(w, "\tvar out struct {\n\t\tItems %s `json:\"items\"`\n\t}\n", name)
+		fmt.Fprintf(w, "\terr := %s, &out)\n\treturn out.Items, err\n}\n", call)
+		return
+	}
+	fmt.Fprintf(w, "%s (*%s, error) {\n", signature, name)
+	fmt.Fprintf(w, "\tout := new(%s)\n\tif err := %s, out); err != nil {\n\t\treturn nil, err\n\t}\n\treturn out, nil\n}\n", name, call)
+}
+
+func writeImports(w *bytes.Buffer, imports map[string]bool) {
+	var paths []string
+	for value := range imports {
+		paths = append(paths, value)
+	}
+	sort.Strings(paths)
+	for _, value := range paths {
+		fmt.Fprintf(w, "\t%q\n", value)
+	}
+}
+
+func typeName(t reflect.Type, imports map[string]bool) string {
+	if t.Kind() == reflect.Slice {
+		return "[]" + typeName(t.Elem(), imports)
+	}
+	imports[t.PkgPath()] = true
+	return path.Base(t.PkgPath()) + "." + t.Name()
+}
+
+// camel 将 group_id 转换为 groupID
+func camel(name string) string {
+	parts := strings.Split(name, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] == "id" {
+			parts[i] = "ID"
+		} else {
+			parts[i] = strings.Title(parts[i])
+		}
+	}
+	return strings.Join(parts, "")
+}
@@ -0,0 +1,162 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package client
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"devops/cicd-tools/pkg/cicd-tools/api"
+)
+
+// BuildService 是 api.GRPCService 的客户端, 返回的错误为 gRPC 状态, 可通过 status.Code 判断
+type BuildService struct {
+	cc    grpc.ClientConnInterface
+	token string
+}
+
+// NewBuildService cc 为 grpc.Dial 创建的连接
+func NewBuildService(cc grpc.ClientConnInterface) *BuildService {
+	return &BuildService{cc: cc}
+}
+
+// WithToken 设置访问令牌或个人访问令牌, 每次调用时通过元数据发送
+func (c *BuildService) WithToken(token string) *BuildService {
+	c.token = token
+	return c
+}
+
+func (c *BuildService) context(ctx context.Context) context.Context {
+	if c.token == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+c.token)
+}
+
+func (c *BuildService) invoke(ctx context.Context, method string, req interface{}, resp interface{}) error {
+	return c.cc.Invoke(c.context(ctx), "/"+api.GRPCService+"/"+method, req, resp, grpc.CallContentSubtype(api.GRPCCodec))
+}
+
+func (c *BuildService) GetBuild(ctx context.Context, id uint) (*api.Build, error) {
+	out := new(api.Build)
+	if err := c.invoke(ctx, "GetBuild", &api.BuildRequest{ID: id}, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListBuilds q 为 nil 时不筛选, 返回第一页 (默认 api.DefaultLimit 条)
+func (c *BuildService) ListBuilds(ctx context.Context, q *api.BuildQuery) ([]api.Build, *api.Page, error) {
+	if q == nil {
+		q = new(api.BuildQuery)
+	}
+	out := new(api.BuildList)
+	if err := c.invoke(ctx, "ListBuilds", q, out); err != nil {
+		return nil, nil, err
+	}
+	return out.Items, &out.Page, nil
+}
+
+func (c *BuildService) CreateBuild(ctx context.Context, b *api.Build) (*api.Build, error) {
+	out := new(api.Build)
+	if err := c.invoke(ctx, "CreateBuild", b, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UpdateBuild 与 HTTP 接口相同, 发送完整的构建数据, 按 b.ID 更新
+func (c *BuildService) UpdateBuild(ctx context.Context, b *api.Build) (*api.Build, error) {
+	out := new(api.Build)
+	if err := c.invoke(ctx, "UpdateBuild", b, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListBuildLogs 返回 ID 大于 after 的日志
+func (c *BuildService) ListBuildLogs(ctx context.Context, buildID uint, after uint) ([]api.BuildLog, error) {
+	out := new(api.BuildLogList)
+	if err := c.invoke(ctx, "ListBuildLogs", &api.BuildLogRequest{BuildID: buildID, After: after}, out); err != nil {
+		return nil, err
+	}
+	return out.Items, nil
+}
+
+func (c *BuildService) AppendBuildLog(ctx context.Context, buildID uint, lines ...string) error {
+	return c.invoke(ctx, "AppendBuildLog", &api.AppendBuildLogRequest{BuildID: buildID, Lines: lines}, new(api.Empty))
+}
+
+func (c *BuildService) GetArtifact(ctx context.Context, id uint) (*api.Artifact, error) {
+	out := new(api.Artifact)
+	if err := c.invoke(ctx, "GetArtifact", &api.ArtifactRequest{ID: id}, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListArtifacts q 为 nil 时不筛选, 返回第一页 (默认 api.DefaultLimit 条)
+func (c *BuildService) ListArtifacts(ctx context.Context, q *api.ArtifactQuery) ([]api.Artifact, *api.Page, error) {
+	if q == nil {
+		q = new(api.ArtifactQuery)
+	}
+	out := new(api.ArtifactList)
+	if err := c.invoke(ctx, "ListArtifacts", q, out); err != nil {
+		return nil, nil, err
+	}
+	return out.Items, &out.Page, nil
+}
+
+func (c *BuildService) CreateArtifact(ctx context.Context, a *api.Artifact) (*api.Artifact, error) {
+	out := new(api.Artifact)
+	if err := c.invoke(ctx, "CreateArtifact", a, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// WatchBuild 订阅构建的状态变化与 ID 大于 after 的日志, 取消 ctx 可以提前结束订阅
+func (c *BuildService) WatchBuild(ctx context.Context, buildID uint, after uint) (*BuildWatcher, error) {
+	desc := &grpc.StreamDesc{StreamName: "WatchBuild", ServerStreams: true}
+	stream, err := c.cc.NewStream(c.context(ctx), desc, "/"+api.GRPCService+"/WatchBuild", grpc.CallContentSubtype(api.GRPCCodec))
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.SendMsg(&api.BuildLogRequest{BuildID: buildID, After: after}); err != nil {
+		return nil, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return &BuildWatcher{stream: stream}, nil
+}
+
+// BuildWatcher 构建事件流
+type BuildWatcher struct {
+	stream grpc.ClientStream
+}
+
+// Recv 返回下一个事件, 构建结束且事件全部收到后返回 io.EOF
+func (w *BuildWatcher) Recv() (*api.BuildEvent, error) {
+	e := new(api.BuildEvent)
+	if err := w.stream.RecvMsg(e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
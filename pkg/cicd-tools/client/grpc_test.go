@@ -0,0 +1,292 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package client
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"devops/cicd-tools/pkg/cicd-tools/api"
+	"devops/cicd-tools/pkg/cicd-tools/auth"
+	"devops/cicd-tools/pkg/cicd-tools/auth/password"
+	"devops/cicd-tools/pkg/cicd-tools/config"
+	"devops/cicd-tools/pkg/cicd-tools/model"
+	"devops/cicd-tools/pkg/cicd-tools/store/memstore"
+)
+
+const testPassword = "hello1234"
+
+// fixture 同一个 api.Server 同时提供 HTTP 接口与经 bufconn 连接的 gRPC 服务, admin 拥有 *:* 权限, bob 没有任何权限
+type fixture struct {
+	t     *testing.T
+	store model.Store
+	rest  *Client
+	conn  *grpc.ClientConn
+	admin string
+	bob   string
+	item  *api.EnvItem
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	s := memstore.New()
+	model.SetStore(s)
+	model.SetPasswordPolicy(password.DefaultPolicy(), password.Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	c := config.Default().Auth.Token
+	c.Secret = strings.Repeat("k", 32)
+	tokens, err := auth.NewTokens(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authn := auth.NewAuthenticator(s, tokens)
+	srv := api.NewServer(s, authn)
+
+	hs := httptest.NewServer(srv.Handler())
+	t.Cleanup(hs.Close)
+	lis := bufconn.Listen(1 << 20)
+	gs := srv.GRPCServer()
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	f := &fixture{t: t, store: s, conn: conn}
+	admin := f.user("admin")
+	role := &model.Role{Name: "admin"}
+	f.check(s.Roles().Create(role))
+	f.check(s.Roles().AddPermission(&model.Permission{Name: "all", Category: "*", Action: "*", RoleID: role.ID, Effect: model.EffectAllow}))
+	f.check(s.Users().AddRoleBinding(&model.UserRole{UserID: admin.ID, RoleID: role.ID}))
+	f.user("bob")
+	for _, name := range []string{"admin", "bob"} {
+		pair, err := authn.Login(name, testPassword)
+		f.check(err)
+		if name == "admin" {
+			f.admin = pair.AccessToken
+		} else {
+			f.bob = pair.AccessToken
+		}
+	}
+	f.rest = New(hs.URL).WithToken(f.admin)
+
+	// 通过 HTTP 接口准备应用环境
+	ctx := context.Background()
+	env, err := f.rest.CreateEnv(ctx, &api.Env{Name: "prod"})
+	f.check(err)
+	item, err := f.rest.CreateItem(ctx, &api.Item{Name: "web"})
+	f.check(err)
+	p, err := f.rest.CreateProject(ctx, &api.Project{Name: "shop"})
+	f.check(err)
+	f.check(f.rest.AddProjectEnv(ctx, p.ID, &api.EnvLink{EnvID: env.ID}))
+	f.check(f.rest.AddProjectItem(ctx, p.ID, &api.ItemLink{ItemID: item.ID}))
+	f.item, err = f.rest.CreateEnvItem(ctx, p.ID, &api.EnvItem{EnvID: env.ID, ItemID: item.ID})
+	f.check(err)
+	return f
+}
+
+func (f *fixture) check(err error) {
+	f.t.Helper()
+	if err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+func (f *fixture) user(name string) *model.User {
+	f.t.Helper()
+	u := (&model.User{Name: name, Email: name + "@example.org"}).Create()
+	f.check(u.Error)
+	f.check(u.SetPassword(testPassword).Error)
+	return u
+}
+
+func (f *fixture) service() *BuildService {
+	return NewBuildService(f.conn).WithToken(f.admin)
+}
+
+// TestGRPCBuilds 经 JSON 编码的 gRPC 调用与 HTTP 接口返回相同的数据, 错误转换为对应的 gRPC 状态码
+func TestGRPCBuilds(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	if _, _, err := NewBuildService(f.conn).ListBuilds(ctx, nil); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("ListBuilds without token: %v", err)
+	}
+	if _, _, err := NewBuildService(f.conn).WithToken(f.bob).ListBuilds(ctx, nil); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("ListBuilds as bob: %v", err)
+	}
+
+	c := f.service()
+	var builds []*api.Build
+	for i := 1; i <= 3; i++ {
+		b, err := c.CreateBuild(ctx, &api.Build{ProjectEnvItemID: f.item.ID, GitBranch: "main"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.Number != uint(i) || b.State != "pending" || b.UserName != "admin" || b.BuildDate.IsZero() {
+			t.Fatalf("build %d = %+v", i, b)
+		}
+		builds = append(builds, b)
+	}
+	rest, err := f.rest.GetBuild(ctx, builds[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.GetBuild(ctx, builds[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.BuildDate.Equal(rest.BuildDate) || !got.CreatedAt.Equal(rest.CreatedAt) {
+		t.Errorf("times differ: gRPC %v %v, HTTP %v %v", got.BuildDate, got.CreatedAt, rest.BuildDate, rest.CreatedAt)
+	}
+	got.BuildDate, got.CreatedAt, rest.BuildDate, rest.CreatedAt = time.Time{}, time.Time{}, time.Time{}, time.Time{}
+	if *got != *rest {
+		t.Errorf("GetBuild = %+v, HTTP %+v", got, rest)
+	}
+
+	q := &api.BuildQuery{ListQuery: api.ListQuery{Limit: 2, Sort: "-number"}, ProjectEnvItemID: f.item.ID}
+	items, page, err := c.ListBuilds(ctx, q)
+	if err != nil || len(items) != 2 || items[0].Number != 3 || page.Total != 3 || page.NextCursor == "" {
+		t.Fatalf("ListBuilds = %v, %+v, %v", items, page, err)
+	}
+	q.Cursor = page.NextCursor
+	items, page, err = c.ListBuilds(ctx, q)
+	if err != nil || len(items) != 1 || items[0].Number != 1 || page.NextCursor != "" {
+		t.Fatalf("ListBuilds next page = %v, %+v, %v", items, page, err)
+	}
+
+	if _, err := c.GetBuild(ctx, 99); status.Code(err) != codes.NotFound {
+		t.Errorf("GetBuild(99): %v", err)
+	}
+	if _, _, err := c.ListBuilds(ctx, &api.BuildQuery{ListQuery: api.ListQuery{Filter: []string{"password=x"}}}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("ListBuilds with invalid filter: %v", err)
+	}
+	if _, err := c.CreateBuild(ctx, &api.Build{ProjectEnvItemID: 99}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("CreateBuild for missing item: %v", err)
+	}
+
+	a, err := c.CreateArtifact(ctx, &api.Artifact{Name: "web.tar", BuildInfoID: builds[0].ID})
+	if err != nil || a.ProjectEnvItemID != f.item.ID {
+		t.Fatalf("CreateArtifact = %+v, %v", a, err)
+	}
+	artifacts, _, err := c.ListArtifacts(ctx, &api.ArtifactQuery{BuildInfoID: builds[0].ID})
+	if err != nil || len(artifacts) != 1 || artifacts[0].ID != a.ID {
+		t.Fatalf("ListArtifacts = %v, %v", artifacts, err)
+	}
+	if got, err := c.GetArtifact(ctx, a.ID); err != nil || got.Name != "web.tar" {
+		t.Fatalf("GetArtifact = %+v, %v", got, err)
+	}
+}
+
+// TestGRPCWatchBuild 先返回构建当前的状态与已有日志, 之后推送 gRPC 与 HTTP 接口的变更, 构建结束后关闭流
+func TestGRPCWatchBuild(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	c := f.service()
+	b, err := c.CreateBuild(ctx, &api.Build{ProjectEnvItemID: f.item.ID, GitBranch: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AppendBuildLog(ctx, b.ID, "early"); err != nil {
+		t.Fatal(err)
+	}
+	w, err := c.WatchBuild(ctx, b.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := make(chan *api.BuildEvent, 16)
+	done := make(chan error, 1)
+	go func() {
+		for {
+			e, err := w.Recv()
+			if err != nil {
+				done <- err
+				return
+			}
+			events <- e
+		}
+	}()
+	expect := func(typ string, value string) {
+		t.Helper()
+		select {
+		case e := <-events:
+			got := ""
+			switch {
+			case e.Build != nil:
+				got = e.Build.State
+			case e.Log != nil:
+				got = e.Log.Line
+			}
+			if e.Type != typ || got != value {
+				t.Fatalf("event = %s %q, want %s %q", e.Type, got, typ, value)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no %s event %q", typ, value)
+		}
+	}
+	expect("state", "pending")
+	expect("log", "early")
+
+	b.State = "running"
+	if _, err := c.UpdateBuild(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	expect("state", "running")
+	if err := c.AppendBuildLog(ctx, b.ID, "a\nb"); err != nil {
+		t.Fatal(err)
+	}
+	expect("log", "a")
+	expect("log", "b")
+	if err := f.rest.AppendBuildLog(ctx, b.ID, &api.LogLines{Lines: []string{"rest"}}); err != nil {
+		t.Fatal(err)
+	}
+	expect("log", "rest")
+	b.State = "success"
+	if _, err := f.rest.UpdateBuild(ctx, b.ID, b); err != nil {
+		t.Fatal(err)
+	}
+	expect("state", "success")
+	select {
+	case err := <-done:
+		if err != io.EOF {
+			t.Fatalf("Recv after success: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("stream not closed after the build finished")
+	}
+
+	if err := c.AppendBuildLog(ctx, b.ID, "late"); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("AppendBuildLog after success: %v", err)
+	}
+	logs, err := c.ListBuildLogs(ctx, b.ID, 0)
+	if err != nil || len(logs) != 4 {
+		t.Fatalf("ListBuildLogs = %v, %v", logs, err)
+	}
+}
@@ -0,0 +1,711 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Code generated by go run ./gen; DO NOT EDIT.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"devops/cicd-tools/pkg/cicd-tools/api"
+	"devops/cicd-tools/pkg/cicd-tools/auth"
+)
+
+// Login 使用密码登录, 启用多因素认证的用户需提供otp, POST /auth/login
+func (c *Client) Login(ctx context.Context, body *api.Credentials) (*auth.TokenPair, error) {
+	out := new(auth.TokenPair)
+	if err := c.do(ctx, http.MethodPost, "/auth/login", nil, body, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Refresh 使用刷新令牌换取新的令牌, 原刷新令牌被吊销, POST /auth/refresh
+func (c *Client) Refresh(ctx context.Context, body *api.Refresh) (*auth.TokenPair, error) {
+	out := new(auth.TokenPair)
+	if err := c.do(ctx, http.MethodPost, "/auth/refresh", nil, body, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Logout 吊销访问令牌与请求体中的刷新令牌, POST /auth/logout
+func (c *Client) Logout(ctx context.Context, body *api.Refresh) error {
+	return c.do(ctx, http.MethodPost, "/auth/logout", nil, body, nil)
+}
+
+// GetMe 查看当前用户, GET /me
+func (c *Client) GetMe(ctx context.Context) (*api.User, error) {
+	out := new(api.User)
+	if err := c.do(ctx, http.MethodGet, "/me", nil, nil, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListUsers 查看用户, GET /users
+func (c *Client) ListUsers(ctx context.Context, q *api.ListQuery) ([]api.User, *api.Page, error) {
+	var out struct {
+		Items []api.User `json:"items"`
+		api.Page
+	}
+	if err := c.do(ctx, http.MethodGet, "/users", q, nil, &out); err != nil {
+		return nil, nil, err
+	}
+	return out.Items, &out.Page, nil
+}
+
+// CreateUser 创建用户, POST /users
+func (c *Client) CreateUser(ctx context.Context, body *api.User) (*api.User, error) {
+	out := new(api.User)
+	if err := c.do(ctx, http.MethodPost, "/users", nil, body, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetUser 查看用户详情, GET /users/{id}
+func (c *Client) GetUser(ctx context.Context, id uint) (*api.User, error) {
+	out := new(api.User)
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/users/%d", id), nil, nil, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UpdateUser 更新用户, PUT /users/{id}
+func (c *Client) UpdateUser(ctx context.Context, id uint, body *api.User) (*api.User, error) {
+	out := new(api.User)
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("/users/%d", id), nil, body, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DeleteUser 删除用户, DELETE /users/{id}
+func (c *Client) DeleteUser(ctx context.Context, id uint) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/users/%d", id), nil, nil, nil)
+}
+
+// SetPassword 设置用户密码, PUT /users/{id}/password
+func (c *Client) SetPassword(ctx context.Context, id uint, body *api.PasswordChange) error {
+	return c.do(ctx, http.MethodPut, fmt.Sprintf("/users/%d/password", id), nil, body, nil)
+}
+
+// ListUserGroups 查看用户所属的组, GET /users/{id}/groups
+func (c *Client) ListUserGroups(ctx context.Context, id uint, q *api.ListQuery) ([]api.Group, *api.Page, error) {
+	var out struct {
+		Items []api.Group `json:"items"`
+		api.Page
+	}
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/users/%d/groups", id), q, nil, &out); err != nil {
+		return nil, nil, err
+	}
+	return out.Items, &out.Page, nil
+}
+
+// AddUserGroup 将用户加入组, POST /users/{id}/groups
+func (c *Client) AddUserGroup(ctx context.Context, id uint, body *api.Membership) error {
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/users/%d/groups", id), nil, body, nil)
+}
+
+// RemoveUserGroup 将用户移出组, DELETE /users/{id}/groups/{group_id}
+func (c *Client) RemoveUserGroup(ctx context.Context, id uint, groupID uint) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/users/%d/groups/%d", id, groupID), nil, nil, nil)
+}
+
+// ListUserBindings 查看用户的角色绑定, GET /users/{id}/roles
+func (c *Client) ListUserBindings(ctx context.Context, id uint, q *api.ListQuery) ([]api.Binding, *api.Page, error) {
+	var out struct {
+		Items []api.Binding `json:"items"`
+		api.Page
+	}
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/users/%d/roles", id), q, nil, &out); err != nil {
+		return nil, nil, err
+	}
+	return out.Items, &out.Page, nil
+}
+
+// AddUserBinding 为用户绑定角色, POST /users/{id}/roles
+func (c *Client) AddUserBinding(ctx context.Context, id uint, body *api.Binding) (*api.Binding, error) {
+	out := new(api.Binding)
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/users/%d/roles", id), nil, body, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RemoveUserBinding 解除用户的角色绑定, DELETE /users/{id}/roles/{binding_id}
+func (c *Client) RemoveUserBinding(ctx context.Context, id uint, bindingID uint) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/users/%d/roles/%d", id, bindingID), nil, nil, nil)
+}
+
+// ListGroups 查看组, GET /groups
+func (c *Client) ListGroups(ctx context.Context, q *api.ListQuery) ([]api.Group, *api.Page, error) {
+	var out struct {
+		Items []api.Group `json:"items"`
+		api.Page
+	}
+	if err := c.do(ctx, http.MethodGet, "/groups", q, nil, &out); err != nil {
+		return nil, nil, err
+	}
+	return out.Items, &out.Page, nil
+}
+
+// CreateGroup 创建组, POST /groups
+func (c *Client) CreateGroup(ctx context.Context, body *api.Group) (*api.Group, error) {
+	out := new(api.Group)
+	if err := c.do(ctx, http.MethodPost, "/groups", nil, body, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetGroup 查看组详情, GET /groups/{id}
+func (c *Client) GetGroup(ctx context.Context, id uint) (*api.Group, error) {
+	out := new(api.Group)
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/groups/%d", id), nil, nil, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UpdateGroup 更新组, PUT /groups/{id}
+func (c *Client) UpdateGroup(ctx context.Context, id uint, body *api.Group) (*api.Group, error) {
+	out := new(api.Group)
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("/groups/%d", id), nil, body, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DeleteGroup 删除组, DELETE /groups/{id}
+func (c *Client) DeleteGroup(ctx context.Context, id uint) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/groups/%d", id), nil, nil, nil)
+}
+
+// ListGroupUsers 查看组成员, GET /groups/{id}/users
+func (c *Client) ListGroupUsers(ctx context.Context, id uint, q *api.ListQuery) ([]api.User, *api.Page, error) {
+	var out struct {
+		Items []api.User `json:"items"`
+		api.Page
+	}
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/groups/%d/users", id), q, nil, &out); err != nil {
+		return nil, nil, err
+	}
+	return out.Items, &out.Page, nil
+}
+
+// ListGroupBindings 查看组的角色绑定, GET /groups/{id}/roles
+func (c *Client) ListGroupBindings(ctx context.Context, id uint, q *api.ListQuery) ([]api.Binding, *api.Page, error) {
+	var out struct {
+		Items []api.Binding `json:"items"`
+		api.Page
+	}
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/groups/%d/roles", id), q, nil, &out); err != nil {
+		return nil, nil, err
+	}
+	return out.Items, &out.Page, nil
+}
+
+// AddGroupBinding 为组绑定角色, POST /groups/{id}/roles
+func (c *Client) AddGroupBinding(ctx context.Context, id uint, body *api.Binding) (*api.Binding, error) {
+	out := new(api.Binding)
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/groups/%d/roles", id), nil, body, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RemoveGroupBinding 解除组的角色绑定, DELETE /groups/{id}/roles/{binding_id}
+func (c *Client) RemoveGroupBinding(ctx context.Context, id uint, bindingID uint) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/groups/%d/roles/%d", id, bindingID), nil, nil, nil)
+}
+
+// ListRoles 查看角色, GET /roles
+func (c *Client) ListRoles(ctx context.Context, q *api.ListQuery) ([]api.Role, *api.Page, error) {
+	var out struct {
+		Items []api.Role `json:"items"`
+		api.Page
+	}
+	if err := c.do(ctx, http.MethodGet, "/roles", q, nil, &out); err != nil {
+		return nil, nil, err
+	}
+	return out.Items, &out.Page, nil
+}
+
+// CreateRole 创建角色, POST /roles
+func (c *Client) CreateRole(ctx context.Context, body *api.Role) (*api.Role, error) {
+	out := new(api.Role)
+	if err := c.do(ctx, http.MethodPost, "/roles", nil, body, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetRole 查看角色详情, GET /roles/{id}
+func (c *Client) GetRole(ctx context.Context, id uint) (*api.Role, error) {
+	out := new(api.Role)
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/roles/%d", id), nil, nil, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UpdateRole 更新角色, parent_ids 整体替换, PUT /roles/{id}
+func (c *Client) UpdateRole(ctx context.Context, id uint, body *api.Role) (*api.Role, error) {
+	out := new(api.Role)
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("/roles/%d", id), nil, body, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DeleteRole 删除角色, DELETE /roles/{id}
+func (c *Client) DeleteRole(ctx context.Context, id uint) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/roles/%d", id), nil, nil, nil)
+}
+
+// ListRolePermissions 查看角色直接拥有的权限, GET /roles/{id}/permissions
+func (c *Client) ListRolePermissions(ctx context.Context, id uint) ([]api.Permission, error) {
+	var out struct {
+		Items []api.Permission `json:"items"`
+	}
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/roles/%d/permissions", id), nil, nil, &out)
+	return out.Items, err
+}
+
+// AddRolePermission 为角色添加权限, POST /roles/{id}/permissions
+func (c *Client) AddRolePermission(ctx context.Context, id uint, body *api.Permission) (*api.Permission, error) {
+	out := new(api.Permission)
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/roles/%d/permissions", id), nil, body, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RemoveRolePermission 删除角色的权限, DELETE /roles/{id}/permissions/{permission_id}
+func (c *Client) RemoveRolePermission(ctx context.Context, id uint, permissionID uint) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/roles/%d/permissions/%d", id, permissionID), nil, nil, nil)
+}
+
+// ListProjects 查看项目, GET /projects
+func (c *Client) ListProjects(ctx context.Context, q *api.ListQuery) ([]api.Project, *api.Page, error) {
+	var out struct {
+		Items []api.Project `json:"items"`
+		api.Page
+	}
+	if err := c.do(ctx, http.MethodGet, "/projects", q, nil, &out); err != nil {
+		return nil, nil, err
+	}
+	return out.Items, &out.Page, nil
+}
+
+// CreateProject 创建项目, POST /projects
+func (c *Client) CreateProject(ctx context.Context, body *api.Project) (*api.Project, error) {
+	out := new(api.Project)
+	if err := c.do(ctx, http.MethodPost, "/projects", nil, body, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetProject 查看项目详情, GET /projects/{id}
+func (c *Client) GetProject(ctx context.Context, id uint) (*api.Project, error) {
+	out := new(api.Project)
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/projects/%d", id), nil, nil, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UpdateProject 更新项目, PUT /projects/{id}
+func (c *Client) UpdateProject(ctx context.Context, id uint, body *api.Project) (*api.Project, error) {
+	out := new(api.Project)
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("/projects/%d", id), nil, body, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DeleteProject 删除项目, DELETE /projects/{id}
+func (c *Client) DeleteProject(ctx context.Context, id uint) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/projects/%d", id), nil, nil, nil)
+}
+
+// ListProjectEnvs 查看项目关联的环境, GET /projects/{id}/envs
+func (c *Client) ListProjectEnvs(ctx context.Context, id uint) ([]api.Env, error) {
+	var out struct {
+		Items []api.Env `json:"items"`
+	}
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/projects/%d/envs", id), nil, nil, &out)
+	return out.Items, err
+}
+
+// AddProjectEnv 项目关联环境, POST /projects/{id}/envs
+func (c *Client) AddProjectEnv(ctx context.Context, id uint, body *api.EnvLink) error {
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/projects/%d/envs", id), nil, body, nil)
+}
+
+// RemoveProjectEnv 项目取消关联环境, DELETE /projects/{id}/envs/{env_id}
+func (c *Client) RemoveProjectEnv(ctx context.Context, id uint, envID uint) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/projects/%d/envs/%d", id, envID), nil, nil, nil)
+}
+
+// ListProjectItems 查看项目关联的应用, GET /projects/{id}/items
+func (c *Client) ListProjectItems(ctx context.Context, id uint) ([]api.Item, error) {
+	var out struct {
+		Items []api.Item `json:"items"`
+	}
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/projects/%d/items", id), nil, nil, &out)
+	return out.Items, err
+}
+
+// AddProjectItem 项目关联应用, POST /projects/{id}/items
+func (c *Client) AddProjectItem(ctx context.Context, id uint, body *api.ItemLink) error {
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/projects/%d/items", id), nil, body, nil)
+}
+
+// RemoveProjectItem 项目取消关联应用, DELETE /projects/{id}/items/{item_id}
+func (c *Client) RemoveProjectItem(ctx context.Context, id uint, itemID uint) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/projects/%d/items/%d", id, itemID), nil, nil, nil)
+}
+
+// ListEnvItems 查看项目环境中部署的应用, GET /projects/{id}/env-items
+func (c *Client) ListEnvItems(ctx context.Context, id uint) ([]api.EnvItem, error) {
+	var out struct {
+		Items []api.EnvItem `json:"items"`
+	}
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/projects/%d/env-items", id), nil, nil, &out)
+	return out.Items, err
+}
+
+// CreateEnvItem 在项目环境中部署应用, POST /projects/{id}/env-items
+func (c *Client) CreateEnvItem(ctx context.Context, id uint, body *api.EnvItem) (*api.EnvItem, error) {
+	out := new(api.EnvItem)
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/projects/%d/env-items", id), nil, body, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListEnvs 查看环境, GET /envs
+func (c *Client) ListEnvs(ctx context.Context, q *api.ListQuery) ([]api.Env, *api.Page, error) {
+	var out struct {
+		Items []api.Env `json:"items"`
+		api.Page
+	}
+	if err := c.do(ctx, http.MethodGet, "/envs", q, nil, &out); err != nil {
+		return nil, nil, err
+	}
+	return out.Items, &out.Page, nil
+}
+
+// CreateEnv 创建环境, POST /envs
+func (c *Client) CreateEnv(ctx context.Context, body *api.Env) (*api.Env, error) {
+	out := new(api.Env)
+	if err := c.do(ctx, http.MethodPost, "/envs", nil, body, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetEnv 查看环境详情, GET /envs/{id}
+func (c *Client) GetEnv(ctx context.Context, id uint) (*api.Env, error) {
+	out := new(api.Env)
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/envs/%d", id), nil, nil, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UpdateEnv 更新环境, PUT /envs/{id}
+func (c *Client) UpdateEnv(ctx context.Context, id uint, body *api.Env) (*api.Env, error) {
+	out := new(api.Env)
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("/envs/%d", id), nil, body, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DeleteEnv 删除环境, DELETE /envs/{id}
+func (c *Client) DeleteEnv(ctx context.Context, id uint) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/envs/%d", id), nil, nil, nil)
+}
+
+// ListItems 查看应用, GET /items
+func (c *Client) ListItems(ctx context.Context, q *api.ListQuery) ([]api.Item, *api.Page, error) {
+	var out struct {
+		Items []api.Item `json:"items"`
+		api.Page
+	}
+	if err := c.do(ctx, http.MethodGet, "/items", q, nil, &out); err != nil {
+		return nil, nil, err
+	}
+	return out.Items, &out.Page, nil
+}
+
+// CreateItem 创建应用, POST /items
+func (c *Client) CreateItem(ctx context.Context, body *api.Item) (*api.Item, error) {
+	out := new(api.Item)
+	if err := c.do(ctx, http.MethodPost, "/items", nil, body, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetItem 查看应用详情, GET /items/{id}
+func (c *Client) GetItem(ctx context.Context, id uint) (*api.Item, error) {
+	out := new(api.Item)
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/items/%d", id), nil, nil, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UpdateItem 更新应用, PUT /items/{id}
+func (c *Client) UpdateItem(ctx context.Context, id uint, body *api.Item) (*api.Item, error) {
+	out := new(api.Item)
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("/items/%d", id), nil, body, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DeleteItem 删除应用, DELETE /items/{id}
+func (c *Client) DeleteItem(ctx context.Context, id uint) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/items/%d", id), nil, nil, nil)
+}
+
+// ListRepos 查看代码仓库, GET /repos
+func (c *Client) ListRepos(ctx context.Context, q *api.ListQuery) ([]api.Repo, *api.Page, error) {
+	var out struct {
+		Items []api.Repo `json:"items"`
+		api.Page
+	}
+	if err := c.do(ctx, http.MethodGet, "/repos", q, nil, &out); err != nil {
+		return nil, nil, err
+	}
+	return out.Items, &out.Page, nil
+}
+
+// CreateRepo 创建代码仓库, POST /repos
+func (c *Client) CreateRepo(ctx context.Context, body *api.Repo) (*api.Repo, error) {
+	out := new(api.Repo)
+	if err := c.do(ctx, http.MethodPost, "/repos", nil, body, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetRepo 查看代码仓库详情, GET /repos/{id}
+func (c *Client) GetRepo(ctx context.Context, id uint) (*api.Repo, error) {
+	out := new(api.Repo)
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/repos/%d", id), nil, nil, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UpdateRepo 更新代码仓库, PUT /repos/{id}
+func (c *Client) UpdateRepo(ctx context.Context, id uint, body *api.Repo) (*api.Repo, error) {
+	out := new(api.Repo)
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("/repos/%d", id), nil, body, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DeleteRepo 删除代码仓库, DELETE /repos/{id}
+func (c *Client) DeleteRepo(ctx context.Context, id uint) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/repos/%d", id), nil, nil, nil)
+}
+
+// ListBuildConfigs 查看构建配置, GET /build-configs
+func (c *Client) ListBuildConfigs(ctx context.Context, q *api.BuildConfigQuery) ([]api.BuildConfig, *api.Page, error) {
+	var out struct {
+		Items []api.BuildConfig `json:"items"`
+		api.Page
+	}
+	if err := c.do(ctx, http.MethodGet, "/build-configs", q, nil, &out); err != nil {
+		return nil, nil, err
+	}
+	return out.Items, &out.Page, nil
+}
+
+// CreateBuildConfig 创建构建配置, POST /build-configs
+func (c *Client) CreateBuildConfig(ctx context.Context, body *api.BuildConfig) (*api.BuildConfig, error) {
+	out := new(api.BuildConfig)
+	if err := c.do(ctx, http.MethodPost, "/build-configs", nil, body, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetBuildConfig 查看构建配置详情, GET /build-configs/{id}
+func (c *Client) GetBuildConfig(ctx context.Context, id uint) (*api.BuildConfig, error) {
+	out := new(api.BuildConfig)
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/build-configs/%d", id), nil, nil, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UpdateBuildConfig 更新构建配置, PUT /build-configs/{id}
+func (c *Client) UpdateBuildConfig(ctx context.Context, id uint, body *api.BuildConfig) (*api.BuildConfig, error) {
+	out := new(api.BuildConfig)
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("/build-configs/%d", id), nil, body, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DeleteBuildConfig 删除构建配置, DELETE /build-configs/{id}
+func (c *Client) DeleteBuildConfig(ctx context.Context, id uint) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/build-configs/%d", id), nil, nil, nil)
+}
+
+// ListBuilds 查看构建记录, GET /builds
+func (c *Client) ListBuilds(ctx context.Context, q *api.BuildQuery) ([]api.Build, *api.Page, error) {
+	var out struct {
+		Items []api.Build `json:"items"`
+		api.Page
+	}
+	if err := c.do(ctx, http.MethodGet, "/builds", q, nil, &out); err != nil {
+		return nil, nil, err
+	}
+	return out.Items, &out.Page, nil
+}
+
+// CreateBuild 登记构建, POST /builds
+func (c *Client) CreateBuild(ctx context.Context, body *api.Build) (*api.Build, error) {
+	out := new(api.Build)
+	if err := c.do(ctx, http.MethodPost, "/builds", nil, body, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetBuild 查看构建记录详情, GET /builds/{id}
+func (c *Client) GetBuild(ctx context.Context, id uint) (*api.Build, error) {
+	out := new(api.Build)
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/builds/%d", id), nil, nil, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UpdateBuild 更新构建记录, PUT /builds/{id}
+func (c *Client) UpdateBuild(ctx context.Context, id uint, body *api.Build) (*api.Build, error) {
+	out := new(api.Build)
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("/builds/%d", id), nil, body, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DeleteBuild 删除构建记录, DELETE /builds/{id}
+func (c *Client) DeleteBuild(ctx context.Context, id uint) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/builds/%d", id), nil, nil, nil)
+}
+
+// ListBuildLogs 查看构建日志, GET /builds/{id}/logs
+func (c *Client) ListBuildLogs(ctx context.Context, id uint, q *api.BuildLogQuery) ([]api.BuildLog, error) {
+	var out struct {
+		Items []api.BuildLog `json:"items"`
+	}
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/builds/%d/logs", id), q, nil, &out)
+	return out.Items, err
+}
+
+// AppendBuildLog 追加构建日志, 已结束的构建不能追加, POST /builds/{id}/logs
+func (c *Client) AppendBuildLog(ctx context.Context, id uint, body *api.LogLines) error {
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/builds/%d/logs", id), nil, body, nil)
+}
+
+// ListArtifacts 查看制品, GET /artifacts
+func (c *Client) ListArtifacts(ctx context.Context, q *api.ArtifactQuery) ([]api.Artifact, *api.Page, error) {
+	var out struct {
+		Items []api.Artifact `json:"items"`
+		api.Page
+	}
+	if err := c.do(ctx, http.MethodGet, "/artifacts", q, nil, &out); err != nil {
+		return nil, nil, err
+	}
+	return out.Items, &out.Page, nil
+}
+
+// CreateArtifact 登记制品, POST /artifacts
+func (c *Client) CreateArtifact(ctx context.Context, body *api.Artifact) (*api.Artifact, error) {
+	out := new(api.Artifact)
+	if err := c.do(ctx, http.MethodPost, "/artifacts", nil, body, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetArtifact 查看制品详情, GET /artifacts/{id}
+func (c *Client) GetArtifact(ctx context.Context, id uint) (*api.Artifact, error) {
+	out := new(api.Artifact)
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/artifacts/%d", id), nil, nil, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UpdateArtifact 更新制品, PUT /artifacts/{id}
+func (c *Client) UpdateArtifact(ctx context.Context, id uint, body *api.Artifact) (*api.Artifact, error) {
+	out := new(api.Artifact)
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("/artifacts/%d", id), nil, body, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DeleteArtifact 删除制品, DELETE /artifacts/{id}
+func (c *Client) DeleteArtifact(ctx context.Context, id uint) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/artifacts/%d", id), nil, nil, nil)
+}
+
+// FetchRepo 获取代码仓库的更新到本地镜像, 返回镜像中的分支与标签, POST /repos/{id}/fetch
+func (c *Client) FetchRepo(ctx context.Context, id uint) ([]api.Ref, error) {
+	var out struct {
+		Items []api.Ref `json:"items"`
+	}
+	err := c.do(ctx, http.MethodPost, fmt.Sprintf("/repos/%d/fetch", id), nil, nil, &out)
+	return out.Items, err
+}
+
+// ListRepoRefs 查看代码仓库镜像中的分支与标签, GET /repos/{id}/refs
+func (c *Client) ListRepoRefs(ctx context.Context, id uint, q *api.RefQuery) ([]api.Ref, error) {
+	var out struct {
+		Items []api.Ref `json:"items"`
+	}
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/repos/%d/refs", id), q, nil, &out)
+	return out.Items, err
+}
+
+// ResolveRepoRef 将分支、标签或提交散列解析为提交, GET /repos/{id}/resolve
+func (c *Client) ResolveRepoRef(ctx context.Context, id uint, q *api.ResolveQuery) (*api.Commit, error) {
+	out := new(api.Commit)
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/repos/%d/resolve", id), q, nil, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
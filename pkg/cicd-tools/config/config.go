@@ -0,0 +1,364 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"devops/cicd-tools/pkg/cicd-tools/auth/password"
+)
+
+// EnvConfigFile 指定配置文件路径的环境变量
+const EnvConfigFile = "CICD_CONFIG"
+
+var (
+	// DefaultFiles 未指定配置文件时依次查找的路径
+	DefaultFiles = []string{
+		"cicd-tools.yaml",
+		"/etc/cicd-tools/config.yaml",
+	}
+)
+
+// Config 配置的加载顺序为: 默认值 < 配置文件 < 环境变量 < 命令行参数
+type Config struct {
+	Database Database `yaml:"database"`
+	Auth     Auth     `yaml:"auth"`
+	Server   Server   `yaml:"server"`
+	Mirror   Mirror   `yaml:"mirror"`
+}
+
+type Database struct {
+	Driver      string `yaml:"driver"`
+	DSN         string `yaml:"dsn"`
+	Host        string `yaml:"host"`
+	Port        int    `yaml:"port"`
+	User        string `yaml:"user"`
+	Password    string `yaml:"password"`
+	Name        string `yaml:"name"`
+	Params      string `yaml:"params"`
+	TablePrefix string `yaml:"table_prefix"`
+	AutoMigrate bool   `yaml:"auto_migrate"`
+}
+
+// Auth 认证相关配置, Password 为密码策略, Hash 为 argon2id 参数, 调整 Hash 后旧密码在下次登录时升级
+type Auth struct {
+	Password password.Policy `yaml:"password"`
+	Hash     password.Params `yaml:"hash"`
+	Token    Token           `yaml:"token"`
+	LDAP     LDAP            `yaml:"ldap"`
+	OIDC     OIDC            `yaml:"oidc"`
+	MFA      MFA             `yaml:"mfa"`
+	Lockout  Lockout         `yaml:"lockout"`
+}
+
+// Token 访问令牌的签名配置, Algorithm 为 HS256 时使用 Secret 或 SecretFile,
+// 为 EdDSA 时使用 PEM 格式的 Ed25519 私钥签名, 只校验令牌时可以只配置公钥
+type Token struct {
+	Algorithm      string        `yaml:"algorithm"`
+	Secret         string        `yaml:"secret"`
+	SecretFile     string        `yaml:"secret_file"`
+	PrivateKeyFile string        `yaml:"private_key_file"`
+	PublicKeyFile  string        `yaml:"public_key_file"`
+	Issuer         string        `yaml:"issuer"`
+	AccessTTL      time.Duration `yaml:"access_ttl"`
+	RefreshTTL     time.Duration `yaml:"refresh_ttl"`
+}
+
+// LDAP 目录配置, URL 为空时不启用; 属性名与过滤条件可按目录结构调整, GroupBaseDN 为空时使用 BaseDN
+type LDAP struct {
+	URL                string        `yaml:"url"`
+	BindDN             string        `yaml:"bind_dn"`
+	BindPassword       string        `yaml:"bind_password"`
+	StartTLS           bool          `yaml:"start_tls"`
+	InsecureSkipVerify bool          `yaml:"insecure_skip_verify"`
+	BaseDN             string        `yaml:"base_dn"`
+	UserFilter         string        `yaml:"user_filter"`
+	UsernameAttr       string        `yaml:"username_attr"`
+	EmailAttr          string        `yaml:"email_attr"`
+	FullNameAttr       string        `yaml:"full_name_attr"`
+	MobileAttr         string        `yaml:"mobile_attr"`
+	GroupBaseDN        string        `yaml:"group_base_dn"`
+	GroupFilter        string        `yaml:"group_filter"`
+	GroupNameAttr      string        `yaml:"group_name_attr"`
+	GroupMemberAttr    string        `yaml:"group_member_attr"`
+	SyncInterval       time.Duration `yaml:"sync_interval"`
+}
+
+// OIDC 单点登录配置, Issuer 为空时不启用; RedirectURL 需与在认证服务中登记的回调地址一致,
+// 命令行登录时在该地址上临时监听, 因此通常登记为 http://127.0.0.1:<端口>/callback
+type OIDC struct {
+	Issuer        string        `yaml:"issuer"`
+	ClientID      string        `yaml:"client_id"`
+	ClientSecret  string        `yaml:"client_secret"`
+	RedirectURL   string        `yaml:"redirect_url"`
+	Scopes        []string      `yaml:"scopes"`
+	UsernameClaim string        `yaml:"username_claim"`
+	EmailClaim    string        `yaml:"email_claim"`
+	FullNameClaim string        `yaml:"full_name_claim"`
+	GroupsClaim   string        `yaml:"groups_claim"`
+	GroupMapping  []OIDCMapping `yaml:"group_mapping"`
+}
+
+// OIDCMapping 将 groups 声明中的值映射为本地组, Roles 为绑定到该组的全局角色
+type OIDCMapping struct {
+	Claim string   `yaml:"claim"`
+	Group string   `yaml:"group"`
+	Roles []string `yaml:"roles"`
+}
+
+// MFA 多因素认证配置, 有效权限 (任意范围内) 包含 RequiredActions 中任一操作的用户必须启用 TOTP,
+// 操作的格式为 category:action 或 action, 如 env:deploy; RecoveryCodes 为每次生成的恢复码数量
+type MFA struct {
+	Issuer          string   `yaml:"issuer"`
+	RequiredActions []string `yaml:"required_actions"`
+	RecoveryCodes   int      `yaml:"recovery_codes"`
+}
+
+// Lockout 连续登录失败 MaxAttempts 次后锁定账号 Duration, MaxAttempts 为 0 时不锁定
+type Lockout struct {
+	MaxAttempts int           `yaml:"max_attempts"`
+	Duration    time.Duration `yaml:"duration"`
+}
+
+// Server serve 命令的 HTTP 接口配置, ShutdownTimeout 为收到退出信号后等待处理中请求完成的时间;
+// GRPCListen 为 gRPC 接口的监听地址, 为空时不启动 gRPC 接口
+type Server struct {
+	Listen          string        `yaml:"listen"`
+	GRPCListen      string        `yaml:"grpc_listen"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+// Mirror 代码仓库镜像配置, Dir 为镜像所在目录, Git 为 git 可执行文件, Timeout 为单个 git 命令的最长执行时间;
+// FetchInterval 大于 0 时 serve 命令按该间隔获取全部代码仓库的更新; KeyDir 为 SSH 私钥所在目录,
+// 代码仓库只能引用其中的私钥; AllowFile 允许本地路径与 file:// 地址, 只用于测试
+type Mirror struct {
+	Dir           string        `yaml:"dir"`
+	Git           string        `yaml:"git"`
+	Timeout       time.Duration `yaml:"timeout"`
+	FetchInterval time.Duration `yaml:"fetch_interval"`
+	KeyDir        string        `yaml:"key_dir"`
+	AllowFile     bool          `yaml:"allow_file"`
+}
+
+func Default() *Config {
+	return &Config{
+		Database: Database{
+			Driver:      "mysql",
+			Host:        "127.0.0.1",
+			Port:        3306,
+			User:        "root",
+			Name:        "data100_rnd",
+			Params:      "charset=utf8mb4&parseTime=True&loc=Local",
+			TablePrefix: "rnd_",
+		},
+		Auth: Auth{
+			Password: password.DefaultPolicy(),
+			Hash:     password.DefaultParams(),
+			Token: Token{
+				Algorithm:  "HS256",
+				Issuer:     "cicd-tools",
+				AccessTTL:  15 * time.Minute,
+				RefreshTTL: 7 * 24 * time.Hour,
+			},
+			LDAP: LDAP{
+				UserFilter:      "(objectClass=inetOrgPerson)",
+				UsernameAttr:    "uid",
+				EmailAttr:       "mail",
+				FullNameAttr:    "cn",
+				MobileAttr:      "mobile",
+				GroupFilter:     "(objectClass=groupOfNames)",
+				GroupNameAttr:   "cn",
+				GroupMemberAttr: "member",
+				SyncInterval:    time.Hour,
+			},
+			OIDC: OIDC{
+				Scopes:        []string{"openid", "profile", "email"},
+				UsernameClaim: "preferred_username",
+				EmailClaim:    "email",
+				FullNameClaim: "name",
+				GroupsClaim:   "groups",
+			},
+			MFA: MFA{
+				Issuer:        "cicd-tools",
+				RecoveryCodes: 10,
+			},
+			Lockout: Lockout{
+				MaxAttempts: 5,
+				Duration:    15 * time.Minute,
+			},
+		},
+		Server: Server{
+			Listen:          ":8080",
+			ShutdownTimeout: 10 * time.Second,
+		},
+		Mirror: Mirror{
+			Dir:     "mirrors",
+			Git:     "git",
+			Timeout: 10 * time.Minute,
+		},
+	}
+}
+
+// Load 加载配置, path 为空时依次尝试 CICD_CONFIG 与 DefaultFiles, 都不存在则只使用默认值和环境变量
+func Load(path string) (*Config, error) {
+	c := Default()
+	if path == "" {
+		path = os.Getenv(EnvConfigFile)
+	}
+	if path == "" {
+		for _, value := range DefaultFiles {
+			if _, err := os.Stat(value); err == nil {
+				path = value
+				break
+			}
+		}
+	}
+	if path != "" {
+		if err := c.LoadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.LoadEnv(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Config) LoadFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("读取配置文件%s失败\n%w", path, err)
+	}
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("解析配置文件%s失败\n%w", path, err)
+	}
+	return nil
+}
+
+func (c *Config) LoadEnv() error {
+	d := &c.Database
+	values := map[string]*string{
+		"CICD_DB_DRIVER":          &d.Driver,
+		"CICD_DB_DSN":             &d.DSN,
+		"CICD_DB_HOST":            &d.Host,
+		"CICD_DB_USER":            &d.User,
+		"CICD_DB_PASSWORD":        &d.Password,
+		"CICD_DB_NAME":            &d.Name,
+		"CICD_DB_PARAMS":          &d.Params,
+		"CICD_DB_TABLE_PREFIX":    &d.TablePrefix,
+		"CICD_AUTH_TOKEN_SECRET":  &c.Auth.Token.Secret,
+		"CICD_LDAP_URL":           &c.Auth.LDAP.URL,
+		"CICD_LDAP_BIND_PASSWORD": &c.Auth.LDAP.BindPassword,
+		"CICD_OIDC_ISSUER":        &c.Auth.OIDC.Issuer,
+		"CICD_OIDC_CLIENT_ID":     &c.Auth.OIDC.ClientID,
+		"CICD_OIDC_CLIENT_SECRET": &c.Auth.OIDC.ClientSecret,
+		"CICD_SERVER_LISTEN":      &c.Server.Listen,
+		"CICD_SERVER_GRPC_LISTEN": &c.Server.GRPCListen,
+		"CICD_MIRROR_DIR":         &c.Mirror.Dir,
+	}
+	for key, value := range values {
+		if v, ok := os.LookupEnv(key); ok {
+			*value = v
+		}
+	}
+	if v, ok := os.LookupEnv("CICD_DB_PORT"); ok {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("环境变量CICD_DB_PORT的值%s不是有效端口\n%w", v, err)
+		}
+		d.Port = port
+	}
+	if v, ok := os.LookupEnv("CICD_DB_AUTO_MIGRATE"); ok {
+		migrate, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("环境变量CICD_DB_AUTO_MIGRATE的值%s不是有效布尔值\n%w", v, err)
+		}
+		d.AutoMigrate = migrate
+	}
+	return nil
+}
+
+func (c *Config) Validate() error {
+	if c.Database.Driver == "" {
+		return errors.New("未配置数据库类型database.driver")
+	}
+	if c.Database.Driver != "sqlite" && c.Database.DSN == "" && c.Database.Host == "" {
+		return errors.New("未配置数据库连接, 需设置database.dsn或database.host")
+	}
+	if c.Auth.Password.MinLength < 1 {
+		return errors.New("auth.password.min_length不能小于1")
+	}
+	h := c.Auth.Hash
+	if h.Memory == 0 || h.Iterations == 0 || h.Parallelism == 0 || h.SaltLength < 8 || h.KeyLength < 16 {
+		return errors.New("auth.hash参数无效, memory/iterations/parallelism不能为0, salt_length不能小于8, key_length不能小于16")
+	}
+	if c.Auth.Token.AccessTTL <= 0 || c.Auth.Token.RefreshTTL <= 0 {
+		return errors.New("auth.token.access_ttl与auth.token.refresh_ttl必须大于0")
+	}
+	if c.Auth.LDAP.URL != "" && c.Auth.LDAP.BaseDN == "" {
+		return errors.New("启用LDAP时需配置auth.ldap.base_dn")
+	}
+	if c.Auth.LDAP.SyncInterval <= 0 {
+		return errors.New("auth.ldap.sync_interval必须大于0")
+	}
+	if c.Auth.Lockout.MaxAttempts < 0 || (c.Auth.Lockout.MaxAttempts > 0 && c.Auth.Lockout.Duration <= 0) {
+		return errors.New("auth.lockout.max_attempts不能小于0, 启用锁定时auth.lockout.duration必须大于0")
+	}
+	if c.Auth.MFA.RecoveryCodes < 1 {
+		return errors.New("auth.mfa.recovery_codes不能小于1")
+	}
+	if c.Server.Listen == "" || c.Server.ShutdownTimeout <= 0 {
+		return errors.New("server.listen不能为空, server.shutdown_timeout必须大于0")
+	}
+	if c.Mirror.Dir == "" || c.Mirror.Git == "" || c.Mirror.Timeout <= 0 || c.Mirror.FetchInterval < 0 {
+		return errors.New("mirror.dir与mirror.git不能为空, mirror.timeout必须大于0, mirror.fetch_interval不能小于0")
+	}
+	if o := c.Auth.OIDC; o.Issuer != "" {
+		if o.ClientID == "" || o.RedirectURL == "" {
+			return errors.New("启用OIDC时需配置auth.oidc.client_id与auth.oidc.redirect_url")
+		}
+		for _, value := range o.GroupMapping {
+			if value.Claim == "" || value.Group == "" {
+				return errors.New("auth.oidc.group_mapping中的claim与group不能为空")
+			}
+		}
+	}
+	return nil
+}
+
+// DataSource 返回数据库连接串, 显式配置的 DSN 优先
+// SQLite 未配置 DSN 时使用 name 作为数据库文件名
+func (d *Database) DataSource() string {
+	if d.DSN != "" {
+		return d.DSN
+	}
+	if d.Driver == "sqlite" {
+		return d.Name + ".db"
+	}
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", d.User, d.Password, d.Host, d.Port, d.Name)
+	if d.Params != "" {
+		dsn += "?" + d.Params
+	}
+	return dsn
+}
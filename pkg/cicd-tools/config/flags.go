@@ -0,0 +1,76 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import (
+	"github.com/spf13/pflag"
+)
+
+// Flags 命令行参数只覆盖显式指定的配置项
+type Flags struct {
+	File     string
+	fs       *pflag.FlagSet
+	database Database
+}
+
+func AddFlags(fs *pflag.FlagSet) *Flags {
+	f := &Flags{fs: fs}
+	fs.StringVarP(&f.File, "config", "c", "", "配置文件路径, 也可通过环境变量"+EnvConfigFile+"指定")
+	fs.StringVar(&f.database.Driver, "db-driver", "", "数据库类型, 支持mysql和sqlite")
+	fs.StringVar(&f.database.DSN, "db-dsn", "", "数据库连接串, 设置后忽略其它连接参数")
+	fs.StringVar(&f.database.Host, "db-host", "", "数据库地址")
+	fs.IntVar(&f.database.Port, "db-port", 0, "数据库端口")
+	fs.StringVar(&f.database.User, "db-user", "", "数据库用户")
+	fs.StringVar(&f.database.Password, "db-password", "", "数据库密码")
+	_ = fs.MarkDeprecated("db-password", "命令行中的密码会被其他用户看到, 请改用环境变量CICD_DB_PASSWORD或配置文件的database.password")
+	fs.StringVar(&f.database.Name, "db-name", "", "数据库名称")
+	fs.StringVar(&f.database.TablePrefix, "db-table-prefix", "", "数据表前缀")
+	fs.BoolVar(&f.database.AutoMigrate, "db-auto-migrate", false, "连接后自动执行全部未执行的迁移")
+	return f
+}
+
+func (f *Flags) Apply(c *Config) {
+	values := map[string]func(){
+		"db-driver":       func() { c.Database.Driver = f.database.Driver },
+		"db-dsn":          func() { c.Database.DSN = f.database.DSN },
+		"db-host":         func() { c.Database.Host = f.database.Host },
+		"db-port":         func() { c.Database.Port = f.database.Port },
+		"db-user":         func() { c.Database.User = f.database.User },
+		"db-password":     func() { c.Database.Password = f.database.Password },
+		"db-name":         func() { c.Database.Name = f.database.Name },
+		"db-table-prefix": func() { c.Database.TablePrefix = f.database.TablePrefix },
+		"db-auto-migrate": func() { c.Database.AutoMigrate = f.database.AutoMigrate },
+	}
+	for name, apply := range values {
+		if f.fs.Changed(name) {
+			apply()
+		}
+	}
+}
+
+// Load 按 默认值 < 配置文件 < 环境变量 < 命令行参数 的顺序加载配置
+func (f *Flags) Load() (*Config, error) {
+	c, err := Load(f.File)
+	if err != nil {
+		return nil, err
+	}
+	f.Apply(c)
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
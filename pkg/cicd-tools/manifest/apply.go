@@ -0,0 +1,1289 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+// 变更类型
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+	ActionAdd    = "add"
+	ActionRemove = "remove"
+)
+
+// 变更的记录类别
+const (
+	KindUser    = "user"
+	KindGroup   = "group"
+	KindRole    = "role"
+	KindProject = "project"
+	KindEnv     = "env"
+	KindItem    = "item"
+	KindRepo    = "repo"
+)
+
+// Change 一项变更, add/remove 表示关联关系的增删, Detail 为变更说明
+type Change struct {
+	Action string
+	Kind   string
+	Name   string
+	Detail string
+}
+
+func (c Change) String() string {
+	return strings.TrimSpace(fmt.Sprintf("%-7s %s/%s %s", c.Action, c.Kind, c.Name, c.Detail))
+}
+
+// errDiff 用于回滚 Diff 中执行的变更
+var errDiff = errors.New("manifest: diff")
+
+// Applier 将配置同步到存储, 全部变更在同一事务中执行, 任一步出错时整体回滚
+//
+// 实体方法 (Create/Update/AddRow 等) 使用默认存储, 不能加入事务, 因此这里直接调用事务中的存储接口,
+// 记录按名称匹配, 配置中的字段覆盖数据库中的值, 用户未填写的可选字段只在指定 prune 时清空. 未指定 prune 时只新增和更新,
+// 指定 prune 时删除配置中不存在的记录与关联关系, 来源为 LDAP/OIDC 的用户与组不会被删除,
+// 这些组中的成员也不受影响, 应用环境与构建配置关联着构建记录, 也不会被删除
+type Applier struct {
+	store model.Store
+	prune bool
+}
+
+func NewApplier(s model.Store, prune bool) *Applier {
+	return &Applier{store: s, prune: prune}
+}
+
+// Diff 计算需要的变更, 在事务中执行后回滚, 不修改存储
+func (a *Applier) Diff(m *Manifest) ([]Change, error) {
+	var changes []Change
+	err := a.store.Transaction(func(tx model.Store) error {
+		var err error
+		if changes, err = a.apply(tx, m); err != nil {
+			return err
+		}
+		return errDiff
+	})
+	if errors.Is(err, errDiff) {
+		err = nil
+	}
+	return changes, err
+}
+
+// Apply 执行同步并返回已执行的变更
+func (a *Applier) Apply(m *Manifest) ([]Change, error) {
+	var changes []Change
+	err := a.store.Transaction(func(tx model.Store) error {
+		var err error
+		changes, err = a.apply(tx, m)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+func (a *Applier) apply(tx model.Store, m *Manifest) ([]Change, error) {
+	if a.prune {
+		if err := m.References(); err != nil {
+			return nil, err
+		}
+	}
+	r := &run{tx: tx, m: m, prune: a.prune}
+	steps := []func() error{r.envs, r.items, r.repos, r.roles, r.projects, r.groups, r.users}
+	if a.prune {
+		steps = append(steps, r.pruneUsers, r.pruneGroups, r.pruneProjects, r.pruneRoles, r.pruneItems, r.pruneEnvs, r.pruneRepos)
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return nil, err
+		}
+	}
+	return r.changes, nil
+}
+
+type run struct {
+	tx      model.Store
+	m       *Manifest
+	prune   bool
+	changes []Change
+}
+
+func (r *run) record(action string, kind string, name string, detail string) {
+	r.changes = append(r.changes, Change{Action: action, Kind: kind, Name: name, Detail: detail})
+}
+
+// fields 记录被修改的字段
+type fields []string
+
+func (f *fields) str(name string, dst *string, value string) {
+	if *dst != value {
+		*dst = value
+		*f = append(*f, name)
+	}
+}
+
+func (f *fields) uint(name string, dst *uint, value uint) {
+	if *dst != value {
+		*dst = value
+		*f = append(*f, name)
+	}
+}
+
+func (f *fields) bool(name string, dst *bool, value bool) {
+	if *dst != value {
+		*dst = value
+		*f = append(*f, name)
+	}
+}
+
+// optStr 等用于可选字段, value 为空时 prune 为 true 则清空, 否则保持不变
+func (f *fields) optStr(name string, dst *string, value *string, prune bool) {
+	if value != nil {
+		f.str(name, dst, *value)
+	} else if prune {
+		f.str(name, dst, "")
+	}
+}
+
+func (f *fields) optUint(name string, dst *uint, value *uint, prune bool) {
+	if value != nil {
+		f.uint(name, dst, *value)
+	} else if prune {
+		f.uint(name, dst, 0)
+	}
+}
+
+func (f *fields) optBool(name string, dst *bool, value *bool, prune bool) {
+	if value != nil {
+		f.bool(name, dst, *value)
+	} else if prune {
+		f.bool(name, dst, false)
+	}
+}
+
+func (f fields) String() string {
+	return strings.Join(f, ",")
+}
+
+func (r *run) envs() error {
+	for _, value := range r.m.Envs {
+		e, err := r.tx.Projects().FirstEnv(&model.Env{Name: value.Name})
+		if errors.Is(err, model.ErrNotFound) {
+			e = &model.Env{Name: value.Name, Intro: value.Intro}
+			if err := r.tx.Projects().FirstOrCreateEnv(e); err != nil {
+				return fmt.Errorf("创建环境%s失败\n%w", value.Name, err)
+			}
+			r.record(ActionCreate, KindEnv, value.Name, "")
+			continue
+		} else if err != nil {
+			return fmt.Errorf("查询环境%s失败\n%w", value.Name, err)
+		}
+		var f fields
+		f.str("intro", &e.Intro, value.Intro)
+		if len(f) == 0 {
+			continue
+		}
+		if err := r.tx.Projects().SaveEnv(e); err != nil {
+			return fmt.Errorf("更新环境%s失败\n%w", value.Name, err)
+		}
+		r.record(ActionUpdate, KindEnv, value.Name, f.String())
+	}
+	return nil
+}
+
+func (r *run) items() error {
+	for _, value := range r.m.Items {
+		i, err := r.tx.Projects().FirstItem(&model.Item{Name: value.Name})
+		if errors.Is(err, model.ErrNotFound) {
+			i = &model.Item{
+				Name:     value.Name,
+				Category: value.Category,
+				Language: value.Language,
+				Tier:     value.Tier,
+				Intro:    value.Intro,
+			}
+			if err := r.tx.Projects().FirstOrCreateItem(i); err != nil {
+				return fmt.Errorf("创建应用%s失败\n%w", value.Name, err)
+			}
+			r.record(ActionCreate, KindItem, value.Name, "")
+			continue
+		} else if err != nil {
+			return fmt.Errorf("查询应用%s失败\n%w", value.Name, err)
+		}
+		var f fields
+		f.str("category", &i.Category, value.Category)
+		f.str("language", &i.Language, value.Language)
+		f.str("tier", &i.Tier, value.Tier)
+		f.str("intro", &i.Intro, value.Intro)
+		if len(f) == 0 {
+			continue
+		}
+		if err := r.tx.Projects().SaveItem(i); err != nil {
+			return fmt.Errorf("更新应用%s失败\n%w", value.Name, err)
+		}
+		r.record(ActionUpdate, KindItem, value.Name, f.String())
+	}
+	return nil
+}
+
+// roles 先创建全部角色, 再处理继承关系与权限, 使角色之间可以任意顺序引用
+func (r *run) roles() error {
+	ids := make([]uint, len(r.m.Roles))
+	for index, value := range r.m.Roles {
+		role, err := r.tx.Roles().First(&model.Role{Name: value.Name})
+		if errors.Is(err, model.ErrNotFound) {
+			role = &model.Role{Name: value.Name, Intro: value.Intro}
+			if err := r.tx.Roles().Create(role); err != nil {
+				return fmt.Errorf("创建角色%s失败\n%w", value.Name, err)
+			}
+			r.record(ActionCreate, KindRole, value.Name, "")
+		} else if err != nil {
+			return fmt.Errorf("查询角色%s失败\n%w", value.Name, err)
+		} else {
+			var f fields
+			f.str("intro", &role.Intro, value.Intro)
+			if len(f) > 0 {
+				if err := r.tx.Roles().Save(role); err != nil {
+					return fmt.Errorf("更新角色%s失败\n%w", value.Name, err)
+				}
+				r.record(ActionUpdate, KindRole, value.Name, f.String())
+			}
+		}
+		ids[index] = role.ID
+	}
+	for index, value := range r.m.Roles {
+		if err := r.parents(ids[index], value); err != nil {
+			return err
+		}
+		if err := r.permissions(ids[index], value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *run) parents(rid uint, value Role) error {
+	current, err := r.tx.Roles().Parents(rid)
+	if err != nil {
+		return fmt.Errorf("查询角色%s继承的角色失败\n%w", value.Name, err)
+	}
+	existing := map[uint]bool{}
+	for _, parent := range current {
+		existing[parent.ID] = true
+	}
+	keep := map[uint]bool{}
+	for _, name := range value.Parents {
+		parent, err := r.role(name)
+		if err != nil {
+			return fmt.Errorf("角色%s继承的角色%s不存在\n%w", value.Name, name, err)
+		}
+		keep[parent.ID] = true
+		if existing[parent.ID] {
+			continue
+		}
+		if err := model.CheckRoleCycle(r.tx, rid, parent.ID); err != nil {
+			return fmt.Errorf("角色%s继承角色%s失败\n%w", value.Name, name, err)
+		}
+		if _, err := r.tx.Roles().AddParent(rid, parent.ID); err != nil {
+			return fmt.Errorf("角色%s继承角色%s失败\n%w", value.Name, name, err)
+		}
+		r.record(ActionAdd, KindRole, value.Name, "parent="+name)
+	}
+	if !r.prune {
+		return nil
+	}
+	for _, parent := range current {
+		if keep[parent.ID] {
+			continue
+		}
+		if err := r.tx.Roles().RemoveParent(rid, parent.ID); err != nil {
+			return fmt.Errorf("角色%s移除继承的角色%s失败\n%w", value.Name, parent.Name, err)
+		}
+		r.record(ActionRemove, KindRole, value.Name, "parent="+parent.Name)
+	}
+	return nil
+}
+
+// permissionKey 权限按名称、类别、操作与资源匹配, 效果不同时重新创建
+type permissionKey struct {
+	name, category, action string
+	resourceID             uint
+}
+
+func (r *run) permissions(rid uint, value Role) error {
+	current, err := r.tx.Roles().Permissions(rid)
+	if err != nil {
+		return fmt.Errorf("查询角色%s的权限失败\n%w", value.Name, err)
+	}
+	existing := map[permissionKey]model.Permission{}
+	for _, p := range current {
+		if p.Effect == "" {
+			p.Effect = model.EffectAllow
+		}
+		existing[permissionKey{p.Name, p.Category, p.Action, p.ResourceID}] = p
+	}
+	keep := map[uint]bool{}
+	for _, p := range value.Permissions {
+		key := permissionKey{p.name(), p.Category, p.Action, p.ResourceID}
+		action := ActionAdd
+		if found, ok := existing[key]; ok {
+			if keep[found.ID] || found.Effect == p.effect() {
+				keep[found.ID] = true
+				continue
+			}
+			if err := r.tx.Roles().RemovePermission(found.ID); err != nil {
+				return fmt.Errorf("角色%s更新权限%s失败\n%w", value.Name, p.name(), err)
+			}
+			keep[found.ID] = true
+			action = ActionUpdate
+		}
+		permission := &model.Permission{
+			Name:       p.name(),
+			ResourceID: p.ResourceID,
+			Category:   p.Category,
+			Action:     p.Action,
+			Effect:     p.effect(),
+			RoleID:     rid,
+		}
+		if err := r.tx.Roles().AddPermission(permission); err != nil {
+			return fmt.Errorf("角色%s添加权限%s失败\n%w", value.Name, p.name(), err)
+		}
+		keep[permission.ID] = true
+		existing[key] = *permission
+		r.record(action, KindRole, value.Name, "permission="+p.String())
+	}
+	if !r.prune {
+		return nil
+	}
+	for _, p := range current {
+		if keep[p.ID] {
+			continue
+		}
+		if err := r.tx.Roles().RemovePermission(p.ID); err != nil {
+			return fmt.Errorf("角色%s删除权限%s失败\n%w", value.Name, p.Name, err)
+		}
+		r.record(ActionRemove, KindRole, value.Name, "permission="+permissionString(p))
+	}
+	return nil
+}
+
+func permissionString(p model.Permission) string {
+	return Permission{
+		Name:       p.Name,
+		Category:   p.Category,
+		Action:     p.Action,
+		Effect:     p.Effect,
+		ResourceID: p.ResourceID,
+	}.String()
+}
+
+func (r *run) projects() error {
+	for _, value := range r.m.Projects {
+		p, err := r.tx.Projects().First(&model.Project{Name: value.Name})
+		if errors.Is(err, model.ErrNotFound) {
+			p = &model.Project{Name: value.Name, Intro: value.Intro}
+			if err := r.tx.Projects().Create(p); err != nil {
+				return fmt.Errorf("创建项目%s失败\n%w", value.Name, err)
+			}
+			r.record(ActionCreate, KindProject, value.Name, "")
+		} else if err != nil {
+			return fmt.Errorf("查询项目%s失败\n%w", value.Name, err)
+		} else {
+			var f fields
+			f.str("intro", &p.Intro, value.Intro)
+			if len(f) > 0 {
+				if err := r.tx.Projects().Save(p); err != nil {
+					return fmt.Errorf("更新项目%s失败\n%w", value.Name, err)
+				}
+				r.record(ActionUpdate, KindProject, value.Name, f.String())
+			}
+		}
+		if err := r.projectEnvs(p, value.Envs); err != nil {
+			return err
+		}
+		if err := r.projectItems(p, value.Items); err != nil {
+			return err
+		}
+		for _, ei := range value.EnvItems {
+			if err := r.envItem(p, ei); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *run) repos() error {
+	for _, value := range r.m.Repos {
+		repo, err := r.tx.Builds().FirstRepo(&model.GitRepo{Name: value.Name})
+		if errors.Is(err, model.ErrNotFound) {
+			repo = &model.GitRepo{Name: value.Name, RepoURL: value.URL, RepoSSHURL: value.SSHURL, Intro: value.Intro}
+			if err := r.tx.Builds().FirstOrCreateRepo(repo); err != nil {
+				return fmt.Errorf("创建仓库%s失败\n%w", value.Name, err)
+			}
+			r.record(ActionCreate, KindRepo, value.Name, "")
+			continue
+		} else if err != nil {
+			return fmt.Errorf("查询仓库%s失败\n%w", value.Name, err)
+		}
+		var f fields
+		f.str("repo_url", &repo.RepoURL, value.URL)
+		f.str("repo_ssh_url", &repo.RepoSSHURL, value.SSHURL)
+		f.str("intro", &repo.Intro, value.Intro)
+		if len(f) == 0 {
+			continue
+		}
+		if err := r.tx.Builds().SaveRepo(repo); err != nil {
+			return fmt.Errorf("更新仓库%s失败\n%w", value.Name, err)
+		}
+		r.record(ActionUpdate, KindRepo, value.Name, f.String())
+	}
+	return nil
+}
+
+// envItem 应用环境与构建配置的关联字段只在创建时写入, 已存在的应用环境只更新构建配置的内容
+func (r *run) envItem(p *model.Project, value EnvItem) error {
+	what := fmt.Sprintf("项目%s的应用环境%s", p.Name, value)
+	e, err := r.tx.Projects().FirstEnv(&model.Env{Name: value.Env})
+	if err != nil {
+		return fmt.Errorf("%s的环境不存在\n%w", what, err)
+	}
+	i, err := r.tx.Projects().FirstItem(&model.Item{Name: value.Item})
+	if err != nil {
+		return fmt.Errorf("%s的应用不存在\n%w", what, err)
+	}
+	var repoID uint
+	if value.Repo != "" {
+		repo, err := r.tx.Builds().FirstRepo(&model.GitRepo{Name: value.Repo})
+		if err != nil {
+			return fmt.Errorf("%s的仓库%s不存在\n%w", what, value.Repo, err)
+		}
+		repoID = repo.ID
+	}
+
+	pei, err := r.tx.Projects().FirstEnvItem(&model.ProjectEnvItem{ProjectID: p.ID, EnvID: e.ID, ItemID: i.ID})
+	if errors.Is(err, model.ErrNotFound) {
+		pei = &model.ProjectEnvItem{
+			Project:      p.Name,
+			ProjectID:    p.ID,
+			ProjectIntro: p.Intro,
+			Env:          e.Name,
+			EnvID:        e.ID,
+			EnvItro:      e.Intro,
+			Item:         i.Name,
+			ItemID:       i.ID,
+			ItemIntro:    i.Intro,
+			GitRepoID:    repoID,
+		}
+		if err := r.tx.Projects().FirstOrCreateEnvItem(pei); err != nil {
+			return fmt.Errorf("创建%s失败\n%w", what, err)
+		}
+		r.record(ActionAdd, KindProject, p.Name, "env_item="+value.String())
+		if value.Build == nil {
+			return nil
+		}
+		c := &model.BuildConfig{
+			BuildDir:         value.Build.Dir,
+			BuildCmd:         value.Build.Cmd,
+			BuildEnv:         value.Build.Env,
+			ProjectEnvItemID: pei.ID,
+			GitRepoID:        repoID,
+		}
+		if err := r.tx.Builds().FirstOrCreateConfig(c); err != nil {
+			return fmt.Errorf("创建%s的构建配置失败\n%w", what, err)
+		}
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("查询%s失败\n%w", what, err)
+	}
+
+	if value.Repo != "" && pei.GitRepoID != repoID {
+		return fmt.Errorf("%s创建后不能修改仓库, 需删除后重新创建", what)
+	}
+	if value.Build == nil {
+		return nil
+	}
+	c, err := model.EnvItemConfig(r.tx, pei)
+	if errors.Is(err, model.ErrNotFound) {
+		c = &model.BuildConfig{
+			BuildDir:         value.Build.Dir,
+			BuildCmd:         value.Build.Cmd,
+			BuildEnv:         value.Build.Env,
+			ProjectEnvItemID: pei.ID,
+			GitRepoID:        pei.GitRepoID,
+		}
+		if err := r.tx.Builds().FirstOrCreateConfig(c); err != nil {
+			return fmt.Errorf("创建%s的构建配置失败\n%w", what, err)
+		}
+		r.record(ActionAdd, KindProject, p.Name, "build="+value.String())
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("查询%s的构建配置失败\n%w", what, err)
+	}
+	var f fields
+	f.str("build_dir", &c.BuildDir, value.Build.Dir)
+	f.str("build_cmd", &c.BuildCmd, value.Build.Cmd)
+	f.str("build_env", &c.BuildEnv, value.Build.Env)
+	if len(f) == 0 {
+		return nil
+	}
+	if err := r.tx.Builds().SaveConfig(c); err != nil {
+		return fmt.Errorf("更新%s的构建配置失败\n%w", what, err)
+	}
+	r.record(ActionUpdate, KindProject, p.Name, "build="+value.String()+" "+f.String())
+	return nil
+}
+
+func (r *run) projectEnvs(p *model.Project, names []string) error {
+	current, err := r.tx.Projects().Envs(p.ID)
+	if err != nil {
+		return fmt.Errorf("查询项目%s关联的环境失败\n%w", p.Name, err)
+	}
+	existing := map[uint]bool{}
+	for _, e := range current {
+		existing[e.ID] = true
+	}
+	keep := map[uint]bool{}
+	for _, name := range names {
+		e, err := r.tx.Projects().FirstEnv(&model.Env{Name: name})
+		if err != nil {
+			return fmt.Errorf("项目%s关联的环境%s不存在\n%w", p.Name, name, err)
+		}
+		keep[e.ID] = true
+		if existing[e.ID] {
+			continue
+		}
+		if _, err := r.tx.Projects().AddEnv(p.ID, e.ID); err != nil {
+			return fmt.Errorf("项目%s关联环境%s时发生错误\n%w", p.Name, name, err)
+		}
+		r.record(ActionAdd, KindProject, p.Name, "env="+name)
+	}
+	if !r.prune {
+		return nil
+	}
+	for _, e := range current {
+		if !keep[e.ID] {
+			if err := r.removeProjectEnv(p, e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// removeProjectEnv 同时移除限定在该项目环境的角色绑定, 已配置应用环境的不能移除
+func (r *run) removeProjectEnv(p *model.Project, e model.Env) error {
+	if err := r.checkEnvItems(&model.ProjectEnvItem{ProjectID: p.ID, EnvID: e.ID}, fmt.Sprintf("项目%s的环境%s", p.Name, e.Name)); err != nil {
+		return err
+	}
+	pe, err := r.tx.Projects().ProjectEnv(p.ID, e.ID)
+	if err != nil {
+		return fmt.Errorf("查询项目%s的环境%s失败\n%w", p.Name, e.Name, err)
+	}
+	if err := r.dropBindings(func(b binding) bool { return b.ProjectEnvID == pe.ID }); err != nil {
+		return err
+	}
+	if err := r.tx.Projects().RemoveEnv(p.ID, e.ID); err != nil {
+		return fmt.Errorf("项目%s移除环境%s失败\n%w", p.Name, e.Name, err)
+	}
+	r.record(ActionRemove, KindProject, p.Name, "env="+e.Name)
+	return nil
+}
+
+func (r *run) projectItems(p *model.Project, names []string) error {
+	current, err := r.tx.Projects().Items(p.ID)
+	if err != nil {
+		return fmt.Errorf("查询项目%s关联的应用失败\n%w", p.Name, err)
+	}
+	existing := map[uint]bool{}
+	for _, i := range current {
+		existing[i.ID] = true
+	}
+	keep := map[uint]bool{}
+	for _, name := range names {
+		i, err := r.tx.Projects().FirstItem(&model.Item{Name: name})
+		if err != nil {
+			return fmt.Errorf("项目%s关联的应用%s不存在\n%w", p.Name, name, err)
+		}
+		keep[i.ID] = true
+		if existing[i.ID] {
+			continue
+		}
+		if _, err := r.tx.Projects().AddItem(p.ID, i.ID); err != nil {
+			return fmt.Errorf("项目%s关联应用%s时发生错误\n%w", p.Name, name, err)
+		}
+		r.record(ActionAdd, KindProject, p.Name, "item="+name)
+	}
+	if !r.prune {
+		return nil
+	}
+	for _, i := range current {
+		if keep[i.ID] {
+			continue
+		}
+		if err := r.checkEnvItems(&model.ProjectEnvItem{ProjectID: p.ID, ItemID: i.ID}, fmt.Sprintf("项目%s的应用%s", p.Name, i.Name)); err != nil {
+			return err
+		}
+		if err := r.tx.Projects().RemoveItem(p.ID, i.ID); err != nil {
+			return fmt.Errorf("项目%s移除应用%s失败\n%w", p.Name, i.Name, err)
+		}
+		r.record(ActionRemove, KindProject, p.Name, "item="+i.Name)
+	}
+	return nil
+}
+
+// checkEnvItems 应用环境关联了构建记录, 不随配置删除
+func (r *run) checkEnvItems(cond *model.ProjectEnvItem, what string) error {
+	found, err := r.tx.Projects().FindEnvItems(cond)
+	if err != nil {
+		return fmt.Errorf("查询%s的应用环境失败\n%w", what, err)
+	}
+	if len(found) > 0 {
+		return fmt.Errorf("%s存在%d个应用环境, 需先删除应用环境", what, len(found))
+	}
+	return nil
+}
+
+func (r *run) groups() error {
+	for _, value := range r.m.Groups {
+		g, err := r.tx.Groups().First(&model.Group{Name: value.Name})
+		if errors.Is(err, model.ErrNotFound) {
+			g = &model.Group{Name: value.Name, Intro: value.Intro}
+			if err := r.tx.Groups().Create(g); err != nil {
+				return fmt.Errorf("创建组%s失败\n%w", value.Name, err)
+			}
+			r.record(ActionCreate, KindGroup, value.Name, "")
+		} else if err != nil {
+			return fmt.Errorf("查询组%s失败\n%w", value.Name, err)
+		} else {
+			var f fields
+			f.str("intro", &g.Intro, value.Intro)
+			if len(f) > 0 {
+				if err := r.tx.Groups().Save(g); err != nil {
+					return fmt.Errorf("更新组%s失败\n%w", value.Name, err)
+				}
+				r.record(ActionUpdate, KindGroup, value.Name, f.String())
+			}
+		}
+
+		rows, err := r.tx.Groups().RoleBindings(g.ID)
+		if err != nil {
+			return fmt.Errorf("查询组%s的角色绑定失败\n%w", value.Name, err)
+		}
+		current := make([]binding, 0, len(rows))
+		for _, row := range rows {
+			current = append(current, binding{row.ID, row.RoleID, row.ProjectID, row.ProjectEnvID, row.ExpiresAt})
+		}
+		gid := g.ID
+		err = r.bindings(KindGroup, value.Name, value.Roles, current, func(b binding) error {
+			return r.tx.Groups().AddRoleBinding(&model.GroupRole{
+				GroupID:      gid,
+				RoleID:       b.RoleID,
+				ProjectID:    b.ProjectID,
+				ProjectEnvID: b.ProjectEnvID,
+				ExpiresAt:    b.ExpiresAt,
+			})
+		}, r.tx.Groups().RemoveRoleBinding)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *run) users() error {
+	for _, value := range r.m.Users {
+		u, err := r.tx.Users().First(&model.User{Name: value.Name})
+		if errors.Is(err, model.ErrNotFound) {
+			u = new(model.User)
+			setUser(u, value, false)
+			if err := r.tx.Users().Create(u); err != nil {
+				return fmt.Errorf("创建用户%s失败\n%w", value.Name, err)
+			}
+			r.record(ActionCreate, KindUser, value.Name, "")
+		} else if err != nil {
+			return fmt.Errorf("查询用户%s失败\n%w", value.Name, err)
+		} else if f := setUser(u, value, r.prune); len(f) > 0 {
+			if err := r.tx.Users().Save(u); err != nil {
+				return fmt.Errorf("用户%v数据更新失败\n%w", value.Name, err)
+			}
+			r.record(ActionUpdate, KindUser, value.Name, f.String())
+		}
+
+		if err := r.userGroups(u, value.Groups); err != nil {
+			return err
+		}
+		rows, err := r.tx.Users().RoleBindings(u.ID)
+		if err != nil {
+			return fmt.Errorf("查询用户%s的角色绑定失败\n%w", value.Name, err)
+		}
+		current := make([]binding, 0, len(rows))
+		for _, row := range rows {
+			current = append(current, binding{row.ID, row.RoleID, row.ProjectID, row.ProjectEnvID, row.ExpiresAt})
+		}
+		uid := u.ID
+		err = r.bindings(KindUser, value.Name, value.Roles, current, func(b binding) error {
+			return r.tx.Users().AddRoleBinding(&model.UserRole{
+				UserID:       uid,
+				RoleID:       b.RoleID,
+				ProjectID:    b.ProjectID,
+				ProjectEnvID: b.ProjectEnvID,
+				ExpiresAt:    b.ExpiresAt,
+			})
+		}, r.tx.Users().RemoveRoleBinding)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setUser 来源为 LDAP/OIDC 的用户的邮箱、姓名与手机号由目录同步维护, 不按配置修改
+func setUser(u *model.User, value User, prune bool) fields {
+	var f fields
+	f.str("user_name", &u.Name, value.Name)
+	if u.Source == model.SourceLocal {
+		if value.Email != "" {
+			f.str("email_address", &u.Email, value.Email)
+		}
+		f.optStr("full_name", &u.FullName, value.FullName, prune)
+		f.optStr("mobile", &u.Mobile, value.Mobile, prune)
+	}
+	f.optStr("gender", &u.Gender, value.Gender, prune)
+	f.optUint("age", &u.Age, value.Age, prune)
+	f.optStr("location", &u.Location, value.Location, prune)
+	f.optStr("job", &u.Job, value.Job, prune)
+	f.optStr("dingtalk_id", &u.DingTalkID, value.DingTalkID, prune)
+	f.optStr("wxwork_id", &u.WXWorkID, value.WXWorkID, prune)
+	f.optBool("service_account", &u.ServiceAccount, value.ServiceAccount, prune)
+	f.optBool("disabled", &u.Disabled, value.Disabled, prune)
+	return f
+}
+
+// userGroups 移除成员时跳过来源为 LDAP/OIDC 的组, 这些组的成员由目录同步维护
+func (r *run) userGroups(u *model.User, names []string) error {
+	current, err := r.tx.Users().Groups(u.ID)
+	if err != nil {
+		return fmt.Errorf("查询用户%s所属的组失败\n%w", u.Name, err)
+	}
+	existing := map[uint]bool{}
+	for _, g := range current {
+		existing[g.ID] = true
+	}
+	keep := map[uint]bool{}
+	for _, name := range names {
+		g, err := r.tx.Groups().First(&model.Group{Name: name})
+		if err != nil {
+			return fmt.Errorf("用户%s所属的组%s不存在\n%w", u.Name, name, err)
+		}
+		keep[g.ID] = true
+		if existing[g.ID] {
+			continue
+		}
+		if _, err := r.tx.Users().AddGroup(u.ID, g.ID); err != nil {
+			return fmt.Errorf("用户%s添加到组%s时发生错误\n%w", u.Name, name, err)
+		}
+		r.record(ActionAdd, KindUser, u.Name, "group="+name)
+	}
+	if !r.prune {
+		return nil
+	}
+	for _, g := range current {
+		if keep[g.ID] || g.Source != model.SourceLocal {
+			continue
+		}
+		if err := r.tx.Users().RemoveGroup(u.ID, g.ID); err != nil {
+			return fmt.Errorf("用户%s移出组%s失败\n%w", u.Name, g.Name, err)
+		}
+		r.record(ActionRemove, KindUser, u.Name, "group="+g.Name)
+	}
+	return nil
+}
+
+// binding 用户与组的角色绑定
+type binding struct {
+	ID           uint
+	RoleID       uint
+	ProjectID    uint
+	ProjectEnvID uint
+	ExpiresAt    *time.Time
+}
+
+type bindingKey struct {
+	roleID, projectID, projectEnvID uint
+}
+
+func (b binding) key() bindingKey {
+	return bindingKey{b.RoleID, b.ProjectID, b.ProjectEnvID}
+}
+
+// bindings 按角色与范围匹配, 过期时间不同时更新, save 遇到相同范围的绑定时更新过期时间
+func (r *run) bindings(kind string, name string, desired []Binding, current []binding, save func(binding) error, remove func(uint) error) error {
+	existing := map[bindingKey]binding{}
+	for _, b := range current {
+		existing[b.key()] = b
+	}
+	keep := map[uint]bool{}
+	for _, value := range desired {
+		b, err := r.resolve(value)
+		if err != nil {
+			return fmt.Errorf("%s%s绑定角色%s失败\n%w", kindName(kind), name, value.Role, err)
+		}
+		action := ActionAdd
+		if found, ok := existing[b.key()]; ok {
+			keep[found.ID] = true
+			if sameTime(found.ExpiresAt, b.ExpiresAt) {
+				continue
+			}
+			action = ActionUpdate
+		}
+		if err := save(b); err != nil {
+			return fmt.Errorf("%s%s绑定角色%s时发生错误\n%w", kindName(kind), name, value.Role, err)
+		}
+		existing[b.key()] = b
+		r.record(action, kind, name, "role="+value.String()+expiresString(b.ExpiresAt))
+	}
+	if !r.prune {
+		return nil
+	}
+	for _, b := range current {
+		if keep[b.ID] {
+			continue
+		}
+		if err := remove(b.ID); err != nil {
+			return fmt.Errorf("%s%s解除角色绑定%d失败\n%w", kindName(kind), name, b.ID, err)
+		}
+		r.record(ActionRemove, kind, name, "role="+r.describe(b))
+	}
+	return nil
+}
+
+// resolve 将配置中的角色与项目、环境名称转换为绑定表中的编号
+func (r *run) resolve(value Binding) (binding, error) {
+	var b binding
+	role, err := r.role(value.Role)
+	if err != nil {
+		return b, fmt.Errorf("角色%s不存在\n%w", value.Role, err)
+	}
+	var scope model.Scope
+	if value.Project != "" {
+		p, err := r.tx.Projects().First(&model.Project{Name: value.Project})
+		if err != nil {
+			return b, fmt.Errorf("项目%s不存在\n%w", value.Project, err)
+		}
+		scope.ProjectID = p.ID
+	}
+	if value.Env != "" {
+		e, err := r.tx.Projects().FirstEnv(&model.Env{Name: value.Env})
+		if err != nil {
+			return b, fmt.Errorf("环境%s不存在\n%w", value.Env, err)
+		}
+		scope.EnvID = e.ID
+	}
+	projectID, projectEnvID, err := model.ResolveScope(r.tx, scope)
+	if err != nil {
+		return b, err
+	}
+	return binding{RoleID: role.ID, ProjectID: projectID, ProjectEnvID: projectEnvID, ExpiresAt: value.ExpiresAt}, nil
+}
+
+// describe 还原绑定的角色与范围名称, 查询失败时使用编号
+func (r *run) describe(b binding) string {
+	value := Binding{Role: fmt.Sprint(b.RoleID)}
+	if role, err := r.tx.Roles().Get(b.RoleID); err == nil {
+		value.Role = role.Name
+	}
+	if b.ProjectID != 0 {
+		value.Project = fmt.Sprint(b.ProjectID)
+		if p, err := r.tx.Projects().Get(b.ProjectID); err == nil {
+			value.Project = p.Name
+		}
+	}
+	if scope, err := model.BindingScope(r.tx, b.ProjectID, b.ProjectEnvID); err == nil && scope.EnvID != 0 {
+		value.Env = fmt.Sprint(scope.EnvID)
+		if e, err := r.tx.Projects().GetEnv(scope.EnvID); err == nil {
+			value.Env = e.Name
+		}
+	}
+	return value.String()
+}
+
+func (r *run) role(name string) (*model.Role, error) {
+	return r.tx.Roles().First(&model.Role{Name: name})
+}
+
+func kindName(kind string) string {
+	switch kind {
+	case KindUser:
+		return "用户"
+	case KindGroup:
+		return "组"
+	case KindRole:
+		return "角色"
+	case KindProject:
+		return "项目"
+	case KindEnv:
+		return "环境"
+	case KindItem:
+		return "应用"
+	case KindRepo:
+		return "仓库"
+	}
+	return kind
+}
+
+// sameTime 比较到秒, 避免数据库精度不同导致重复更新
+func sameTime(a *time.Time, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Unix() == b.Unix()
+}
+
+func expiresString(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return " expires_at=" + t.Format(time.RFC3339)
+}
+
+// dropBindings 解除所有用户与组中满足 match 的角色绑定
+func (r *run) dropBindings(match func(binding) bool) error {
+	users, err := r.tx.Users().Find(&model.User{})
+	if err != nil {
+		return fmt.Errorf("查询用户失败\n%w", err)
+	}
+	for _, u := range users {
+		rows, err := r.tx.Users().RoleBindings(u.ID)
+		if err != nil {
+			return fmt.Errorf("查询用户%s的角色绑定失败\n%w", u.Name, err)
+		}
+		for _, row := range rows {
+			b := binding{row.ID, row.RoleID, row.ProjectID, row.ProjectEnvID, row.ExpiresAt}
+			if !match(b) {
+				continue
+			}
+			detail := "role=" + r.describe(b)
+			if err := r.tx.Users().RemoveRoleBinding(row.ID); err != nil {
+				return fmt.Errorf("用户%s解除角色绑定%d失败\n%w", u.Name, row.ID, err)
+			}
+			r.record(ActionRemove, KindUser, u.Name, detail)
+		}
+	}
+	groups, err := r.tx.Groups().Find(&model.Group{})
+	if err != nil {
+		return fmt.Errorf("查询组失败\n%w", err)
+	}
+	for _, g := range groups {
+		rows, err := r.tx.Groups().RoleBindings(g.ID)
+		if err != nil {
+			return fmt.Errorf("查询组%s的角色绑定失败\n%w", g.Name, err)
+		}
+		for _, row := range rows {
+			b := binding{row.ID, row.RoleID, row.ProjectID, row.ProjectEnvID, row.ExpiresAt}
+			if !match(b) {
+				continue
+			}
+			detail := "role=" + r.describe(b)
+			if err := r.tx.Groups().RemoveRoleBinding(row.ID); err != nil {
+				return fmt.Errorf("组%s解除角色绑定%d失败\n%w", g.Name, row.ID, err)
+			}
+			r.record(ActionRemove, KindGroup, g.Name, detail)
+		}
+	}
+	return nil
+}
+
+func (r *run) pruneUsers() error {
+	keep := map[string]bool{}
+	for _, value := range r.m.Users {
+		keep[value.Name] = true
+	}
+	users, err := r.tx.Users().Find(&model.User{})
+	if err != nil {
+		return fmt.Errorf("查询用户失败\n%w", err)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name })
+	for _, u := range users {
+		if keep[u.Name] || u.Source != model.SourceLocal {
+			continue
+		}
+		groups, err := r.tx.Users().Groups(u.ID)
+		if err != nil {
+			return fmt.Errorf("查询用户%s所属的组失败\n%w", u.Name, err)
+		}
+		for _, g := range groups {
+			if err := r.tx.Users().RemoveGroup(u.ID, g.ID); err != nil {
+				return fmt.Errorf("用户%s移出组%s失败\n%w", u.Name, g.Name, err)
+			}
+		}
+		bindings, err := r.tx.Users().RoleBindings(u.ID)
+		if err != nil {
+			return fmt.Errorf("查询用户%s的角色绑定失败\n%w", u.Name, err)
+		}
+		for _, b := range bindings {
+			if err := r.tx.Users().RemoveRoleBinding(b.ID); err != nil {
+				return fmt.Errorf("用户%s解除角色绑定%d失败\n%w", u.Name, b.ID, err)
+			}
+		}
+		if err := r.tx.Users().Delete(u.ID); err != nil {
+			return fmt.Errorf("删除用户%s失败\n%w", u.Name, err)
+		}
+		r.record(ActionDelete, KindUser, u.Name, "")
+	}
+	return nil
+}
+
+func (r *run) pruneGroups() error {
+	keep := map[string]bool{}
+	for _, value := range r.m.Groups {
+		keep[value.Name] = true
+	}
+	groups, err := r.tx.Groups().Find(&model.Group{})
+	if err != nil {
+		return fmt.Errorf("查询组失败\n%w", err)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	for _, g := range groups {
+		if keep[g.Name] || g.Source != model.SourceLocal {
+			continue
+		}
+		users, err := r.tx.Groups().Users(g.ID)
+		if err != nil {
+			return fmt.Errorf("查询组%s的成员失败\n%w", g.Name, err)
+		}
+		for _, u := range users {
+			if err := r.tx.Users().RemoveGroup(u.ID, g.ID); err != nil {
+				return fmt.Errorf("用户%s移出组%s失败\n%w", u.Name, g.Name, err)
+			}
+		}
+		bindings, err := r.tx.Groups().RoleBindings(g.ID)
+		if err != nil {
+			return fmt.Errorf("查询组%s的角色绑定失败\n%w", g.Name, err)
+		}
+		for _, b := range bindings {
+			if err := r.tx.Groups().RemoveRoleBinding(b.ID); err != nil {
+				return fmt.Errorf("组%s解除角色绑定%d失败\n%w", g.Name, b.ID, err)
+			}
+		}
+		if err := r.tx.Groups().Delete(g.ID); err != nil {
+			return fmt.Errorf("删除组%s失败\n%w", g.Name, err)
+		}
+		r.record(ActionDelete, KindGroup, g.Name, "")
+	}
+	return nil
+}
+
+func (r *run) pruneProjects() error {
+	keep := map[string]bool{}
+	for _, value := range r.m.Projects {
+		keep[value.Name] = true
+	}
+	projects, err := r.tx.Projects().Find(&model.Project{})
+	if err != nil {
+		return fmt.Errorf("查询项目失败\n%w", err)
+	}
+	sort.Slice(projects, func(i, j int) bool { return projects[i].Name < projects[j].Name })
+	for _, p := range projects {
+		if keep[p.Name] {
+			continue
+		}
+		if err := r.checkEnvItems(&model.ProjectEnvItem{ProjectID: p.ID}, "项目"+p.Name); err != nil {
+			return err
+		}
+		pid := p.ID
+		if err := r.dropBindings(func(b binding) bool { return b.ProjectID == pid }); err != nil {
+			return err
+		}
+		envs, err := r.tx.Projects().Envs(p.ID)
+		if err != nil {
+			return fmt.Errorf("查询项目%s关联的环境失败\n%w", p.Name, err)
+		}
+		for _, e := range envs {
+			if err := r.tx.Projects().RemoveEnv(p.ID, e.ID); err != nil {
+				return fmt.Errorf("项目%s移除环境%s失败\n%w", p.Name, e.Name, err)
+			}
+		}
+		items, err := r.tx.Projects().Items(p.ID)
+		if err != nil {
+			return fmt.Errorf("查询项目%s关联的应用失败\n%w", p.Name, err)
+		}
+		for _, i := range items {
+			if err := r.tx.Projects().RemoveItem(p.ID, i.ID); err != nil {
+				return fmt.Errorf("项目%s移除应用%s失败\n%w", p.Name, i.Name, err)
+			}
+		}
+		if err := r.tx.Projects().Delete(p.ID); err != nil {
+			return fmt.Errorf("删除项目%s失败\n%w", p.Name, err)
+		}
+		r.record(ActionDelete, KindProject, p.Name, "")
+	}
+	return nil
+}
+
+// pruneRoles 配置中的角色已按配置替换了继承关系, 剩余的子角色都会被一并删除
+func (r *run) pruneRoles() error {
+	keep := map[string]bool{}
+	for _, value := range r.m.Roles {
+		keep[value.Name] = true
+	}
+	roles, err := r.tx.Roles().Find(&model.Role{})
+	if err != nil {
+		return fmt.Errorf("查询角色失败\n%w", err)
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+	for _, role := range roles {
+		if keep[role.Name] {
+			continue
+		}
+		rid := role.ID
+		if err := r.dropBindings(func(b binding) bool { return b.RoleID == rid }); err != nil {
+			return err
+		}
+		permissions, err := r.tx.Roles().Permissions(role.ID)
+		if err != nil {
+			return fmt.Errorf("查询角色%s的权限失败\n%w", role.Name, err)
+		}
+		for _, p := range permissions {
+			if err := r.tx.Roles().RemovePermission(p.ID); err != nil {
+				return fmt.Errorf("角色%s删除权限%s失败\n%w", role.Name, p.Name, err)
+			}
+		}
+		parents, err := r.tx.Roles().Parents(role.ID)
+		if err != nil {
+			return fmt.Errorf("查询角色%s继承的角色失败\n%w", role.Name, err)
+		}
+		for _, parent := range parents {
+			if err := r.tx.Roles().RemoveParent(role.ID, parent.ID); err != nil {
+				return fmt.Errorf("角色%s移除继承的角色%s失败\n%w", role.Name, parent.Name, err)
+			}
+		}
+		children, err := r.tx.Roles().Children(role.ID)
+		if err != nil {
+			return fmt.Errorf("查询角色%s的子角色失败\n%w", role.Name, err)
+		}
+		for _, child := range children {
+			if err := r.tx.Roles().RemoveParent(child.ID, role.ID); err != nil {
+				return fmt.Errorf("角色%s移除继承的角色%s失败\n%w", child.Name, role.Name, err)
+			}
+		}
+		if err := r.tx.Roles().Delete(role.ID); err != nil {
+			return fmt.Errorf("删除角色%s失败\n%w", role.Name, err)
+		}
+		r.record(ActionDelete, KindRole, role.Name, "")
+	}
+	return nil
+}
+
+// pruneItems 与 pruneEnvs 在项目之后执行, 此时剩余项目的关联关系已与配置一致
+func (r *run) pruneItems() error {
+	keep := map[string]bool{}
+	for _, value := range r.m.Items {
+		keep[value.Name] = true
+	}
+	items, err := r.tx.Projects().FindItems(&model.Item{})
+	if err != nil {
+		return fmt.Errorf("查询应用失败\n%w", err)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+	for _, i := range items {
+		if keep[i.Name] {
+			continue
+		}
+		if err := r.checkEnvItems(&model.ProjectEnvItem{ItemID: i.ID}, "应用"+i.Name); err != nil {
+			return err
+		}
+		if err := r.tx.Projects().DeleteItem(i.ID); err != nil {
+			return fmt.Errorf("删除应用%s失败\n%w", i.Name, err)
+		}
+		r.record(ActionDelete, KindItem, i.Name, "")
+	}
+	return nil
+}
+
+func (r *run) pruneEnvs() error {
+	keep := map[string]bool{}
+	for _, value := range r.m.Envs {
+		keep[value.Name] = true
+	}
+	envs, err := r.tx.Projects().FindEnvs(&model.Env{})
+	if err != nil {
+		return fmt.Errorf("查询环境失败\n%w", err)
+	}
+	sort.Slice(envs, func(i, j int) bool { return envs[i].Name < envs[j].Name })
+	for _, e := range envs {
+		if keep[e.Name] {
+			continue
+		}
+		if err := r.checkEnvItems(&model.ProjectEnvItem{EnvID: e.ID}, "环境"+e.Name); err != nil {
+			return err
+		}
+		if err := r.tx.Projects().DeleteEnv(e.ID); err != nil {
+			return fmt.Errorf("删除环境%s失败\n%w", e.Name, err)
+		}
+		r.record(ActionDelete, KindEnv, e.Name, "")
+	}
+	return nil
+}
+
+// pruneRepos 被应用环境、构建配置或构建记录引用的仓库不会被删除
+func (r *run) pruneRepos() error {
+	keep := map[string]bool{}
+	for _, value := range r.m.Repos {
+		keep[value.Name] = true
+	}
+	repos, err := r.tx.Builds().FindRepos(&model.GitRepo{})
+	if err != nil {
+		return fmt.Errorf("查询仓库失败\n%w", err)
+	}
+	sort.Slice(repos, func(i, j int) bool { return repos[i].Name < repos[j].Name })
+	for _, repo := range repos {
+		if keep[repo.Name] {
+			continue
+		}
+		items, err := r.tx.Projects().FindEnvItems(&model.ProjectEnvItem{GitRepoID: repo.ID})
+		if err != nil {
+			return fmt.Errorf("查询仓库%s的引用失败\n%w", repo.Name, err)
+		}
+		configs, err := r.tx.Builds().FindConfigs(&model.BuildConfig{GitRepoID: repo.ID})
+		if err != nil {
+			return fmt.Errorf("查询仓库%s的引用失败\n%w", repo.Name, err)
+		}
+		builds, err := r.tx.Builds().Find(&model.BuildInfo{GitRepoID: repo.ID})
+		if err != nil {
+			return fmt.Errorf("查询仓库%s的引用失败\n%w", repo.Name, err)
+		}
+		if n := len(items) + len(configs) + len(builds); n > 0 {
+			return fmt.Errorf("仓库%s仍被%d个应用环境、构建配置或构建记录引用, 不能删除", repo.Name, n)
+		}
+		if err := r.tx.Builds().DeleteRepo(repo.ID); err != nil {
+			return fmt.Errorf("删除仓库%s失败\n%w", repo.Name, err)
+		}
+		r.record(ActionDelete, KindRepo, repo.Name, "")
+	}
+	return nil
+}
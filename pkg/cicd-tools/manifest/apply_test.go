@@ -0,0 +1,256 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package manifest_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"devops/cicd-tools/pkg/cicd-tools/manifest"
+	"devops/cicd-tools/pkg/cicd-tools/model"
+	"devops/cicd-tools/pkg/cicd-tools/store/memstore"
+)
+
+// docs 为 docs/manifest 中的示例配置
+const docs = "../../../docs/manifest"
+
+func load(t *testing.T, path string) *manifest.Manifest {
+	t.Helper()
+	m, err := manifest.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// parse 将 content 写入临时目录后读取
+func parse(t *testing.T, content string) *manifest.Manifest {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "manifest.yaml")
+	if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return load(t, name)
+}
+
+func apply(t *testing.T, s model.Store, m *manifest.Manifest, prune bool) []manifest.Change {
+	t.Helper()
+	changes, err := manifest.NewApplier(s, prune).Apply(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return changes
+}
+
+// plan 返回 Diff 的结果, 每项变更为 "action kind/name"
+func plan(t *testing.T, s model.Store, m *manifest.Manifest, prune bool) []string {
+	t.Helper()
+	changes, err := manifest.NewApplier(s, prune).Diff(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return summary(changes)
+}
+
+func summary(changes []manifest.Change) []string {
+	values := make([]string, 0, len(changes))
+	for _, c := range changes {
+		values = append(values, c.Action+" "+c.Kind+"/"+c.Name)
+	}
+	return values
+}
+
+func contains(values []string, want string) bool {
+	for _, value := range values {
+		if value == want {
+			return true
+		}
+	}
+	return false
+}
+
+func TestApplyDocs(t *testing.T) {
+	s := memstore.New()
+	m := load(t, docs)
+	changes := summary(apply(t, s, m, false))
+	for _, want := range []string{"create env/prod", "create role/developer", "create project/mall", "create group/mall-dev", "create user/alice"} {
+		if !contains(changes, want) {
+			t.Errorf("changes %v 中缺少 %s", changes, want)
+		}
+	}
+
+	alice, err := s.Users().First(&model.User{Name: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups, _ := s.Users().Groups(alice.ID)
+	bindings, _ := s.Users().RoleBindings(alice.ID)
+	if len(groups) != 1 || groups[0].Name != "mall-dev" || len(bindings) != 2 {
+		t.Fatalf("alice groups = %v, bindings = %v", groups, bindings)
+	}
+	developer, _ := s.Roles().First(&model.Role{Name: "developer"})
+	parents, _ := s.Roles().Parents(developer.ID)
+	permissions, _ := s.Roles().Permissions(developer.ID)
+	if len(parents) != 1 || parents[0].Name != "viewer" || len(permissions) != 2 {
+		t.Fatalf("developer parents = %v, permissions = %v", parents, permissions)
+	}
+
+	for _, prune := range []bool{false, true} {
+		if values := plan(t, s, m, prune); len(values) != 0 {
+			t.Fatalf("再次应用 (prune=%v) 应没有变更: %v", prune, values)
+		}
+	}
+}
+
+// TestDiff Diff 在事务中计算变更后回滚, 不修改存储
+func TestDiff(t *testing.T) {
+	s := memstore.New()
+	m := load(t, docs)
+	values := plan(t, s, m, false)
+	if !contains(values, "create user/alice") || !contains(values, "create project/mall") {
+		t.Fatalf("plan = %v", values)
+	}
+	if users, _ := s.Users().Find(&model.User{}); len(users) != 0 {
+		t.Fatalf("Diff 不应创建用户: %v", users)
+	}
+	if envs, _ := s.Projects().FindEnvs(&model.Env{}); len(envs) != 0 {
+		t.Fatalf("Diff 不应创建环境: %v", envs)
+	}
+	if got := summary(apply(t, s, m, false)); strings.Join(got, ",") != strings.Join(values, ",") {
+		t.Fatalf("Apply = %v, Diff = %v", got, values)
+	}
+}
+
+func TestApplyUpdate(t *testing.T) {
+	s := memstore.New()
+	apply(t, s, parse(t, `
+roles:
+  - role: viewer
+    intro: 只读
+    permissions:
+      - category: build
+        action: read
+users:
+  - user_name: alice
+    email_address: alice@example.org
+    full_name: Alice
+    job: 开发
+    roles: [viewer]
+`), false)
+
+	m := parse(t, `
+roles:
+  - role: viewer
+    intro: 只读角色
+    permissions:
+      - category: build
+        action: read
+      - category: artifact
+        action: read
+users:
+  - user_name: alice
+    email_address: alice@example.com
+    full_name: Alice
+`)
+	changes := summary(apply(t, s, m, false))
+	for _, want := range []string{"update role/viewer", "add role/viewer", "update user/alice"} {
+		if !contains(changes, want) {
+			t.Errorf("changes %v 中缺少 %s", changes, want)
+		}
+	}
+	alice, _ := s.Users().First(&model.User{Name: "alice"})
+	if alice.Email != "alice@example.com" || alice.Job != "开发" {
+		t.Fatalf("未指定 prune 时只更新填写的字段: %+v", alice)
+	}
+	if bindings, _ := s.Users().RoleBindings(alice.ID); len(bindings) != 1 {
+		t.Fatalf("未指定 prune 时不解除绑定: %v", bindings)
+	}
+
+	changes = summary(apply(t, s, m, true))
+	if !contains(changes, "update user/alice") || !contains(changes, "remove user/alice") {
+		t.Fatalf("prune changes = %v", changes)
+	}
+	alice, _ = s.Users().First(&model.User{Name: "alice"})
+	if alice.Job != "" {
+		t.Fatalf("指定 prune 时清空未填写的字段: %+v", alice)
+	}
+	if bindings, _ := s.Users().RoleBindings(alice.ID); len(bindings) != 0 {
+		t.Fatalf("指定 prune 时解除配置中没有的绑定: %v", bindings)
+	}
+}
+
+func TestApplyPrune(t *testing.T) {
+	s := memstore.New()
+	apply(t, s, load(t, docs), false)
+	extra := []*model.User{
+		{Name: "bob", Email: "bob@example.org"},
+		{Name: "ldap-user", Email: "ldap@example.org", Source: model.SourceLDAP},
+	}
+	for _, u := range extra {
+		if err := s.Users().Create(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Projects().FirstOrCreateEnv(&model.Env{Name: "staging"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Roles().Create(&model.Role{Name: "unused"}); err != nil {
+		t.Fatal(err)
+	}
+
+	m := load(t, docs)
+	if values := plan(t, s, m, false); len(values) != 0 {
+		t.Fatalf("未指定 prune 时不删除: %v", values)
+	}
+	changes := summary(apply(t, s, m, true))
+	for _, want := range []string{"delete user/bob", "delete env/staging", "delete role/unused"} {
+		if !contains(changes, want) {
+			t.Errorf("changes %v 中缺少 %s", changes, want)
+		}
+	}
+	if contains(changes, "delete user/ldap-user") {
+		t.Fatalf("不应删除来源为 LDAP 的用户: %v", changes)
+	}
+	if _, err := s.Users().First(&model.User{Name: "bob"}); err == nil {
+		t.Fatal("bob 应被删除")
+	}
+	if _, err := s.Users().First(&model.User{Name: "ldap-user"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestApplyRollback 任一步出错时整体回滚, 已执行的变更不会保留
+func TestApplyRollback(t *testing.T) {
+	s := memstore.New()
+	m := load(t, docs)
+	// 绕过 Load 的校验, 引用不存在的角色使用户一步出错, 此时环境、角色与项目已经创建
+	m.Users[0].Roles = append(m.Users[0].Roles, manifest.Binding{Role: "missing"})
+	if _, err := manifest.NewApplier(s, false).Apply(m); err == nil {
+		t.Fatal("引用不存在的角色应返回错误")
+	}
+	if envs, _ := s.Projects().FindEnvs(&model.Env{}); len(envs) != 0 {
+		t.Fatalf("环境应被回滚: %v", envs)
+	}
+	if roles, _ := s.Roles().Find(&model.Role{}); len(roles) != 0 {
+		t.Fatalf("角色应被回滚: %v", roles)
+	}
+	if users, _ := s.Users().Find(&model.User{}); len(users) != 0 {
+		t.Fatalf("用户应被回滚: %v", users)
+	}
+}
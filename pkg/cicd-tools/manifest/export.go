@@ -0,0 +1,387 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package manifest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+	"devops/cicd-tools/pkg/util/logger"
+)
+
+// Export 读取存储中的全部配置, 导出结果可以通过 Applier 还原. 用户不包含密码, 仓库不包含访问凭据,
+// 引用的记录已不存在的角色绑定与应用环境会被跳过
+func Export(s model.Store) (*Manifest, error) {
+	e := &exporter{store: s, m: new(Manifest)}
+	for _, step := range []func() error{e.envs, e.items, e.repos, e.roles, e.projects, e.groups, e.users} {
+		if err := step(); err != nil {
+			return nil, err
+		}
+	}
+	return e.m, nil
+}
+
+type exporter struct {
+	store model.Store
+	m     *Manifest
+}
+
+func (e *exporter) envs() error {
+	envs, err := e.store.Projects().FindEnvs(&model.Env{})
+	if err != nil {
+		return fmt.Errorf("查询环境失败\n%w", err)
+	}
+	for _, value := range envs {
+		e.m.Envs = append(e.m.Envs, Env{Name: value.Name, Intro: value.Intro})
+	}
+	sort.Slice(e.m.Envs, func(i, j int) bool { return e.m.Envs[i].Name < e.m.Envs[j].Name })
+	return nil
+}
+
+func (e *exporter) items() error {
+	items, err := e.store.Projects().FindItems(&model.Item{})
+	if err != nil {
+		return fmt.Errorf("查询应用失败\n%w", err)
+	}
+	for _, value := range items {
+		e.m.Items = append(e.m.Items, Item{
+			Name:     value.Name,
+			Category: value.Category,
+			Language: value.Language,
+			Tier:     value.Tier,
+			Intro:    value.Intro,
+		})
+	}
+	sort.Slice(e.m.Items, func(i, j int) bool { return e.m.Items[i].Name < e.m.Items[j].Name })
+	return nil
+}
+
+func (e *exporter) repos() error {
+	repos, err := e.store.Builds().FindRepos(&model.GitRepo{})
+	if err != nil {
+		return fmt.Errorf("查询仓库失败\n%w", err)
+	}
+	for _, value := range repos {
+		e.m.Repos = append(e.m.Repos, Repo{Name: value.Name, URL: value.RepoURL, SSHURL: value.RepoSSHURL, Intro: value.Intro})
+	}
+	sort.Slice(e.m.Repos, func(i, j int) bool { return e.m.Repos[i].Name < e.m.Repos[j].Name })
+	return nil
+}
+
+func (e *exporter) roles() error {
+	roles, err := e.store.Roles().Find(&model.Role{})
+	if err != nil {
+		return fmt.Errorf("查询角色失败\n%w", err)
+	}
+	for _, value := range roles {
+		role := Role{Name: value.Name, Intro: value.Intro}
+		parents, err := e.store.Roles().Parents(value.ID)
+		if err != nil {
+			return fmt.Errorf("查询角色%s继承的角色失败\n%w", value.Name, err)
+		}
+		for _, parent := range parents {
+			role.Parents = append(role.Parents, parent.Name)
+		}
+		sort.Strings(role.Parents)
+		permissions, err := e.store.Roles().Permissions(value.ID)
+		if err != nil {
+			return fmt.Errorf("查询角色%s的权限失败\n%w", value.Name, err)
+		}
+		for _, p := range permissions {
+			permission := Permission{Category: p.Category, Action: p.Action, ResourceID: p.ResourceID}
+			if p.Name != p.Category+":"+p.Action {
+				permission.Name = p.Name
+			}
+			if p.Effect != model.EffectAllow {
+				permission.Effect = p.Effect
+			}
+			role.Permissions = append(role.Permissions, permission)
+		}
+		sort.Slice(role.Permissions, func(i, j int) bool {
+			return role.Permissions[i].String() < role.Permissions[j].String()
+		})
+		e.m.Roles = append(e.m.Roles, role)
+	}
+	sort.Slice(e.m.Roles, func(i, j int) bool { return e.m.Roles[i].Name < e.m.Roles[j].Name })
+	return nil
+}
+
+func (e *exporter) projects() error {
+	projects, err := e.store.Projects().Find(&model.Project{})
+	if err != nil {
+		return fmt.Errorf("查询项目失败\n%w", err)
+	}
+	for _, value := range projects {
+		project := Project{Name: value.Name, Intro: value.Intro}
+		envs, err := e.store.Projects().Envs(value.ID)
+		if err != nil {
+			return fmt.Errorf("查询项目%s关联的环境失败\n%w", value.Name, err)
+		}
+		for _, env := range envs {
+			project.Envs = append(project.Envs, env.Name)
+		}
+		items, err := e.store.Projects().Items(value.ID)
+		if err != nil {
+			return fmt.Errorf("查询项目%s关联的应用失败\n%w", value.Name, err)
+		}
+		for _, item := range items {
+			project.Items = append(project.Items, item.Name)
+		}
+		sort.Strings(project.Envs)
+		sort.Strings(project.Items)
+
+		rows, err := e.store.Projects().FindEnvItems(&model.ProjectEnvItem{ProjectID: value.ID})
+		if err != nil {
+			return fmt.Errorf("查询项目%s的应用环境失败\n%w", value.Name, err)
+		}
+		for index := range rows {
+			ei, err := e.envItem(&rows[index], envs, items)
+			if err != nil {
+				return err
+			}
+			if ei != nil {
+				project.EnvItems = append(project.EnvItems, *ei)
+			}
+		}
+		sort.Slice(project.EnvItems, func(i, j int) bool {
+			return project.EnvItems[i].String() < project.EnvItems[j].String()
+		})
+		e.m.Projects = append(e.m.Projects, project)
+	}
+	sort.Slice(e.m.Projects, func(i, j int) bool { return e.m.Projects[i].Name < e.m.Projects[j].Name })
+	return nil
+}
+
+// envItem 环境或应用已不在项目中时返回 nil
+func (e *exporter) envItem(pei *model.ProjectEnvItem, envs []model.Env, items []model.Item) (*EnvItem, error) {
+	ei := new(EnvItem)
+	for _, value := range envs {
+		if value.ID == pei.EnvID {
+			ei.Env = value.Name
+		}
+	}
+	for _, value := range items {
+		if value.ID == pei.ItemID {
+			ei.Item = value.Name
+		}
+	}
+	if ei.Env == "" || ei.Item == "" {
+		logger.Warn(fmt.Sprintf("应用环境%d的环境或应用未关联到项目%s, 已跳过", pei.ID, pei.Project))
+		return nil, nil
+	}
+	if pei.GitRepoID != 0 {
+		repo, err := e.store.Builds().GetRepo(pei.GitRepoID)
+		if err != nil {
+			logger.Warn(fmt.Sprintf("应用环境%d的仓库%d不存在, 已跳过", pei.ID, pei.GitRepoID))
+			return nil, nil
+		}
+		ei.Repo = repo.Name
+	}
+	c, err := model.EnvItemConfig(e.store, pei)
+	if err == nil {
+		ei.Build = &Build{Dir: c.BuildDir, Cmd: c.BuildCmd, Env: c.BuildEnv}
+	} else if !errors.Is(err, model.ErrNotFound) {
+		return nil, fmt.Errorf("查询应用环境%d的构建配置失败\n%w", pei.ID, err)
+	}
+	return ei, nil
+}
+
+func (e *exporter) groups() error {
+	groups, err := e.store.Groups().Find(&model.Group{})
+	if err != nil {
+		return fmt.Errorf("查询组失败\n%w", err)
+	}
+	for _, value := range groups {
+		group := Group{Name: value.Name, Intro: value.Intro}
+		rows, err := e.store.Groups().RoleBindings(value.ID)
+		if err != nil {
+			return fmt.Errorf("查询组%s的角色绑定失败\n%w", value.Name, err)
+		}
+		for _, row := range rows {
+			if b, ok := e.binding("组"+value.Name, row.RoleID, row.ProjectID, row.ProjectEnvID, row.ExpiresAt); ok {
+				group.Roles = append(group.Roles, b)
+			}
+		}
+		sortBindings(group.Roles)
+		e.m.Groups = append(e.m.Groups, group)
+	}
+	sort.Slice(e.m.Groups, func(i, j int) bool { return e.m.Groups[i].Name < e.m.Groups[j].Name })
+	return nil
+}
+
+func (e *exporter) users() error {
+	users, err := e.store.Users().Find(&model.User{})
+	if err != nil {
+		return fmt.Errorf("查询用户失败\n%w", err)
+	}
+	for _, value := range users {
+		user := User{
+			Name:           value.Name,
+			Email:          value.Email,
+			FullName:       optStr(value.FullName),
+			Gender:         optStr(value.Gender),
+			Age:            optUint(value.Age),
+			Location:       optStr(value.Location),
+			Job:            optStr(value.Job),
+			Mobile:         optStr(value.Mobile),
+			DingTalkID:     optStr(value.DingTalkID),
+			WXWorkID:       optStr(value.WXWorkID),
+			ServiceAccount: optBool(value.ServiceAccount),
+			Disabled:       optBool(value.Disabled),
+		}
+		groups, err := e.store.Users().Groups(value.ID)
+		if err != nil {
+			return fmt.Errorf("查询用户%s所属的组失败\n%w", value.Name, err)
+		}
+		for _, g := range groups {
+			user.Groups = append(user.Groups, g.Name)
+		}
+		sort.Strings(user.Groups)
+		rows, err := e.store.Users().RoleBindings(value.ID)
+		if err != nil {
+			return fmt.Errorf("查询用户%s的角色绑定失败\n%w", value.Name, err)
+		}
+		for _, row := range rows {
+			if b, ok := e.binding("用户"+value.Name, row.RoleID, row.ProjectID, row.ProjectEnvID, row.ExpiresAt); ok {
+				user.Roles = append(user.Roles, b)
+			}
+		}
+		sortBindings(user.Roles)
+		e.m.Users = append(e.m.Users, user)
+	}
+	sort.Slice(e.m.Users, func(i, j int) bool { return e.m.Users[i].Name < e.m.Users[j].Name })
+	return nil
+}
+
+// binding 将绑定表中的编号转换为名称, 引用的记录不存在时返回 false
+func (e *exporter) binding(owner string, roleID uint, projectID uint, projectEnvID uint, expiresAt *time.Time) (Binding, bool) {
+	var b Binding
+	role, err := e.store.Roles().Get(roleID)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("%s绑定的角色%d不存在, 已跳过", owner, roleID))
+		return b, false
+	}
+	b.Role = role.Name
+	if projectID != 0 {
+		p, err := e.store.Projects().Get(projectID)
+		if err != nil {
+			logger.Warn(fmt.Sprintf("%s绑定角色%s的项目%d不存在, 已跳过", owner, role.Name, projectID))
+			return b, false
+		}
+		b.Project = p.Name
+	}
+	if projectEnvID != 0 {
+		scope, err := model.BindingScope(e.store, projectID, projectEnvID)
+		if err != nil {
+			logger.Warn(fmt.Sprintf("%s绑定角色%s的项目环境%d不存在, 已跳过", owner, role.Name, projectEnvID))
+			return b, false
+		}
+		env, err := e.store.Projects().GetEnv(scope.EnvID)
+		if err != nil {
+			logger.Warn(fmt.Sprintf("%s绑定角色%s的环境%d不存在, 已跳过", owner, role.Name, scope.EnvID))
+			return b, false
+		}
+		b.Env = env.Name
+	}
+	if expiresAt != nil {
+		t := expiresAt.UTC()
+		b.ExpiresAt = &t
+	}
+	return b, true
+}
+
+func sortBindings(bindings []Binding) {
+	sort.Slice(bindings, func(i, j int) bool { return bindings[i].String() < bindings[j].String() })
+}
+
+// Files 按类别拆分后的文件名与内容, 没有记录的类别也会生成文件, 便于在 git 中跟踪删除
+func (m *Manifest) Files() map[string]*Manifest {
+	return map[string]*Manifest{
+		"envs.yaml":     {Envs: m.Envs},
+		"items.yaml":    {Items: m.Items},
+		"repos.yaml":    {Repos: m.Repos},
+		"projects.yaml": {Projects: m.Projects},
+		"roles.yaml":    {Roles: m.Roles},
+		"groups.yaml":   {Groups: m.Groups},
+		"users.yaml":    {Users: m.Users},
+	}
+}
+
+// WriteDir 将配置按类别写入目录, 覆盖目录中同名的文件, 返回写入的文件
+func (m *Manifest) WriteDir(dir string) ([]string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建目录%s失败\n%w", dir, err)
+	}
+	var written []string
+	for name, value := range m.Files() {
+		content, err := value.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, content, 0o644); err != nil {
+			return nil, fmt.Errorf("写入配置文件%s失败\n%w", path, err)
+		}
+		written = append(written, path)
+	}
+	sort.Strings(written)
+	return written, nil
+}
+
+func (m *Manifest) Marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(m); err != nil {
+		return nil, fmt.Errorf("序列化配置失败\n%w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("序列化配置失败\n%w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// optStr 等导出可选字段, 零值不导出, 通过 apply --prune 还原时清空
+func optStr(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+func optUint(value uint) *uint {
+	if value == 0 {
+		return nil
+	}
+	return &value
+}
+
+func optBool(value bool) *bool {
+	if !value {
+		return nil
+	}
+	return &value
+}
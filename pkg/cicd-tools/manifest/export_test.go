@@ -0,0 +1,112 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package manifest_test
+
+import (
+	"bytes"
+	"testing"
+
+	"devops/cicd-tools/pkg/cicd-tools/manifest"
+	"devops/cicd-tools/pkg/cicd-tools/model"
+	"devops/cicd-tools/pkg/cicd-tools/store/memstore"
+)
+
+func export(t *testing.T, s model.Store) *manifest.Manifest {
+	t.Helper()
+	m, err := manifest.Export(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func marshal(t *testing.T, m *manifest.Manifest) []byte {
+	t.Helper()
+	content, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+// TestExportRoundTrip 导出的目录重新应用到同一存储时没有变更, 应用到空存储后导出的结果相同
+func TestExportRoundTrip(t *testing.T) {
+	s := memstore.New()
+	apply(t, s, load(t, docs), false)
+	apply(t, s, parse(t, `
+roles:
+  - role: releaser
+    permissions:
+      - permission: deploy-prod
+        category: env
+        resource_id: 2
+        action: deploy
+      - category: "*"
+        action: delete
+        effect: deny
+groups:
+  - group_name: oncall
+    roles:
+      - role: releaser
+        project: mall
+        env: prod
+        expires_at: 2030-06-01T08:00:00Z
+users:
+  - user_name: bob
+    email_address: bob@example.com
+    gender: male
+    age: 30
+    mobile: "13800000000"
+    disabled: true
+    groups: [oncall, mall-dev]
+`), false)
+	bob, err := s.Users().First(&model.User{Name: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Users().UpdatePassword(bob.ID, "$argon2id$v=19$secret-hash"); err != nil {
+		t.Fatal(err)
+	}
+
+	m := export(t, s)
+	dir := t.TempDir()
+	if _, err := m.WriteDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	content := marshal(t, m)
+	for _, want := range []string{"resource_id: 2", "expires_at: 2030-06-01T08:00:00Z", "age: 30", "disabled: true"} {
+		if !bytes.Contains(content, []byte(want)) {
+			t.Fatalf("导出的配置中缺少%s:\n%s", want, content)
+		}
+	}
+	if bytes.Contains(content, []byte("secret-hash")) {
+		t.Fatal("导出的配置不应包含密码")
+	}
+
+	loaded := load(t, dir)
+	for _, prune := range []bool{false, true} {
+		if values := plan(t, s, loaded, prune); len(values) != 0 {
+			t.Fatalf("重新应用导出的配置 (prune=%v) 应没有变更: %v", prune, values)
+		}
+	}
+
+	other := memstore.New()
+	apply(t, other, loaded, false)
+	if again := marshal(t, export(t, other)); !bytes.Equal(again, content) {
+		t.Fatalf("导出结果不一致:\n%s\n---\n%s", content, again)
+	}
+}
@@ -0,0 +1,455 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+// Manifest 声明式配置, 字段名与数据表列名保持一致, 一个目录下的多个文件合并为一份
+type Manifest struct {
+	Groups   []Group   `yaml:"groups,omitempty"`
+	Users    []User    `yaml:"users,omitempty"`
+	Roles    []Role    `yaml:"roles,omitempty"`
+	Envs     []Env     `yaml:"envs,omitempty"`
+	Items    []Item    `yaml:"items,omitempty"`
+	Projects []Project `yaml:"projects,omitempty"`
+	Repos    []Repo    `yaml:"repos,omitempty"`
+}
+
+// User 不包含密码等敏感信息, 密码仍通过 passwd 命令设置.
+// 可选字段为指针, 未填写时不修改已有用户的值 (指定 prune 时清空), 填写空值时清空
+type User struct {
+	Name           string    `yaml:"user_name"`
+	Email          string    `yaml:"email_address,omitempty"`
+	FullName       *string   `yaml:"full_name,omitempty"`
+	Gender         *string   `yaml:"gender,omitempty"`
+	Age            *uint     `yaml:"age,omitempty"`
+	Location       *string   `yaml:"location,omitempty"`
+	Job            *string   `yaml:"job,omitempty"`
+	Mobile         *string   `yaml:"mobile,omitempty"`
+	DingTalkID     *string   `yaml:"dingtalk_id,omitempty"`
+	WXWorkID       *string   `yaml:"wxwork_id,omitempty"`
+	ServiceAccount *bool     `yaml:"service_account,omitempty"`
+	Disabled       *bool     `yaml:"disabled,omitempty"`
+	Groups         []string  `yaml:"groups,omitempty"`
+	Roles          []Binding `yaml:"roles,omitempty"`
+}
+
+type Group struct {
+	Name  string    `yaml:"group_name"`
+	Intro string    `yaml:"intro,omitempty"`
+	Roles []Binding `yaml:"roles,omitempty"`
+}
+
+type Role struct {
+	Name        string       `yaml:"role"`
+	Intro       string       `yaml:"intro,omitempty"`
+	Parents     []string     `yaml:"parents,omitempty"`
+	Permissions []Permission `yaml:"permissions,omitempty"`
+}
+
+// Permission 未设置 permission 时名称为 <category>:<action>, 未设置 effect 时为 allow
+type Permission struct {
+	Name       string `yaml:"permission,omitempty"`
+	Category   string `yaml:"category"`
+	Action     string `yaml:"action"`
+	Effect     string `yaml:"effect,omitempty"`
+	ResourceID uint   `yaml:"resource_id,omitempty"`
+}
+
+// Binding 角色绑定, 只有角色名称时可以简写为字符串, 表示长期有效的全局绑定
+type Binding struct {
+	Role      string     `yaml:"role"`
+	Project   string     `yaml:"project,omitempty"`
+	Env       string     `yaml:"env,omitempty"`
+	ExpiresAt *time.Time `yaml:"expires_at,omitempty"`
+}
+
+type Env struct {
+	Name  string `yaml:"env"`
+	Intro string `yaml:"intro,omitempty"`
+}
+
+type Item struct {
+	Name     string `yaml:"item"`
+	Category string `yaml:"category,omitempty"`
+	Language string `yaml:"language,omitempty"`
+	Tier     string `yaml:"tier,omitempty"`
+	Intro    string `yaml:"intro,omitempty"`
+}
+
+type Project struct {
+	Name     string    `yaml:"project"`
+	Intro    string    `yaml:"intro,omitempty"`
+	Envs     []string  `yaml:"envs,omitempty"`
+	Items    []string  `yaml:"items,omitempty"`
+	EnvItems []EnvItem `yaml:"env_items,omitempty"`
+}
+
+// EnvItem 项目环境中部署的应用, 环境与应用需在项目的 envs 与 items 中,
+// 仓库与是否有构建配置在创建后不能修改, 构建配置的内容可以修改
+type EnvItem struct {
+	Env   string `yaml:"env"`
+	Item  string `yaml:"item"`
+	Repo  string `yaml:"repo,omitempty"`
+	Build *Build `yaml:"build,omitempty"`
+}
+
+type Build struct {
+	Dir string `yaml:"build_dir,omitempty"`
+	Cmd string `yaml:"build_cmd,omitempty"`
+	Env string `yaml:"build_env,omitempty"`
+}
+
+// Repo 只包含仓库地址, 不包含访问凭据
+type Repo struct {
+	Name   string `yaml:"name"`
+	URL    string `yaml:"repo_url,omitempty"`
+	SSHURL string `yaml:"repo_ssh_url,omitempty"`
+	Intro  string `yaml:"intro,omitempty"`
+}
+
+func (ei EnvItem) String() string {
+	return ei.Env + "/" + ei.Item
+}
+
+func (b *Binding) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*b = Binding{Role: value.Value}
+		return nil
+	}
+	type plain Binding
+	return value.Decode((*plain)(b))
+}
+
+func (b Binding) MarshalYAML() (interface{}, error) {
+	if b.Project == "" && b.Env == "" && b.ExpiresAt == nil {
+		return b.Role, nil
+	}
+	type plain Binding
+	return plain(b), nil
+}
+
+func (b Binding) String() string {
+	s := b.Role
+	if b.Project != "" {
+		s += "@" + b.Project
+		if b.Env != "" {
+			s += "/" + b.Env
+		}
+	}
+	return s
+}
+
+func (p Permission) name() string {
+	if p.Name == "" {
+		return p.Category + ":" + p.Action
+	}
+	return p.Name
+}
+
+func (p Permission) effect() string {
+	if p.Effect == "" {
+		return model.EffectAllow
+	}
+	return p.Effect
+}
+
+func (p Permission) String() string {
+	s := p.Category + ":" + p.Action
+	if p.ResourceID != 0 {
+		s += fmt.Sprintf("#%d", p.ResourceID)
+	}
+	if p.name() != p.Category+":"+p.Action {
+		s = p.name() + "(" + s + ")"
+	}
+	return s + "=" + p.effect()
+}
+
+// Load 读取文件或目录, 目录下的 .yaml 与 .yml 文件按路径顺序合并, 每个文件可包含多个文档
+func Load(path string) (*Manifest, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取配置%s失败\n%w", path, err)
+	}
+	files := []string{path}
+	if info.IsDir() {
+		files = nil
+		err := filepath.Walk(path, func(name string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			ext := strings.ToLower(filepath.Ext(name))
+			if !fi.IsDir() && (ext == ".yaml" || ext == ".yml") {
+				files = append(files, name)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("读取配置目录%s失败\n%w", path, err)
+		}
+		sort.Strings(files)
+	}
+
+	m := new(Manifest)
+	for _, name := range files {
+		if err := m.loadFile(name); err != nil {
+			return nil, err
+		}
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *Manifest) loadFile(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("读取配置文件%s失败\n%w", name, err)
+	}
+	defer f.Close()
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	for {
+		doc := new(Manifest)
+		if err := decoder.Decode(doc); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("解析配置文件%s失败\n%w", name, err)
+		}
+		m.Merge(doc)
+	}
+}
+
+// Merge 追加 other 中的全部记录, 重复的名称由 Validate 检查
+func (m *Manifest) Merge(other *Manifest) {
+	m.Groups = append(m.Groups, other.Groups...)
+	m.Users = append(m.Users, other.Users...)
+	m.Roles = append(m.Roles, other.Roles...)
+	m.Envs = append(m.Envs, other.Envs...)
+	m.Items = append(m.Items, other.Items...)
+	m.Projects = append(m.Projects, other.Projects...)
+	m.Repos = append(m.Repos, other.Repos...)
+}
+
+// Validate 检查必填字段与重复的名称, 引用的记录是否存在在执行时检查
+func (m *Manifest) Validate() error {
+	names := newNameSet()
+	for _, value := range m.Envs {
+		if err := names.add("环境", value.Name); err != nil {
+			return err
+		}
+	}
+	for _, value := range m.Items {
+		if err := names.add("应用", value.Name); err != nil {
+			return err
+		}
+	}
+	for _, value := range m.Repos {
+		if err := names.add("仓库", value.Name); err != nil {
+			return err
+		}
+	}
+	for _, value := range m.Projects {
+		if err := names.add("项目", value.Name); err != nil {
+			return err
+		}
+		if err := validEnvItems(value); err != nil {
+			return err
+		}
+	}
+	for _, value := range m.Roles {
+		if err := names.add("角色", value.Name); err != nil {
+			return err
+		}
+		for _, p := range value.Permissions {
+			if p.Category == "" || p.Action == "" {
+				return fmt.Errorf("角色%s的权限%s未设置category或action", value.Name, p.Name)
+			}
+			if err := model.CheckEffect(p.Effect); err != nil {
+				return fmt.Errorf("角色%s的权限%s无效\n%w", value.Name, p.name(), err)
+			}
+		}
+	}
+	for _, value := range m.Groups {
+		if err := names.add("组", value.Name); err != nil {
+			return err
+		}
+		if err := validBindings("组"+value.Name, value.Roles); err != nil {
+			return err
+		}
+	}
+	emails := map[string]string{}
+	for _, value := range m.Users {
+		if err := names.add("用户", value.Name); err != nil {
+			return err
+		}
+		if value.Email == "" {
+			return fmt.Errorf("用户%s未设置email_address", value.Name)
+		}
+		if other, ok := emails[value.Email]; ok {
+			return fmt.Errorf("用户%s与%s的邮箱%s重复", other, value.Name, value.Email)
+		}
+		emails[value.Email] = value.Name
+		if err := validBindings("用户"+value.Name, value.Roles); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validEnvItems(p Project) error {
+	envs, items, seen := map[string]bool{}, map[string]bool{}, map[string]bool{}
+	for _, name := range p.Envs {
+		envs[name] = true
+	}
+	for _, name := range p.Items {
+		items[name] = true
+	}
+	for _, value := range p.EnvItems {
+		if !envs[value.Env] || !items[value.Item] {
+			return fmt.Errorf("项目%s的应用环境%s中的环境与应用需在envs与items中", p.Name, value)
+		}
+		if seen[value.String()] {
+			return fmt.Errorf("项目%s的应用环境%s重复定义", p.Name, value)
+		}
+		seen[value.String()] = true
+	}
+	return nil
+}
+
+func validBindings(owner string, bindings []Binding) error {
+	for _, value := range bindings {
+		if value.Role == "" {
+			return fmt.Errorf("%s的角色绑定未设置role", owner)
+		}
+		if value.Env != "" && value.Project == "" {
+			return fmt.Errorf("%s绑定角色%s时限定了环境%s但未指定项目", owner, value.Role, value.Env)
+		}
+	}
+	return nil
+}
+
+// nameSet 按类别记录已出现的名称
+type nameSet map[string]bool
+
+func newNameSet() nameSet {
+	return nameSet{}
+}
+
+func (s nameSet) add(kind string, name string) error {
+	if name == "" {
+		return fmt.Errorf("存在未设置名称的%s", kind)
+	}
+	key := kind + "/" + name
+	if s[key] {
+		return fmt.Errorf("%s%s重复定义", kind, name)
+	}
+	s[key] = true
+	return nil
+}
+
+// References 检查引用的记录都在配置中定义, 删除配置中不存在的记录前需先通过该检查
+func (m *Manifest) References() error {
+	names := newNameSet()
+	for _, value := range m.Envs {
+		names["环境/"+value.Name] = true
+	}
+	for _, value := range m.Items {
+		names["应用/"+value.Name] = true
+	}
+	for _, value := range m.Projects {
+		names["项目/"+value.Name] = true
+	}
+	for _, value := range m.Roles {
+		names["角色/"+value.Name] = true
+	}
+	for _, value := range m.Repos {
+		names["仓库/"+value.Name] = true
+	}
+	for _, value := range m.Groups {
+		names["组/"+value.Name] = true
+	}
+
+	check := func(owner string, kind string, refs ...string) error {
+		for _, name := range refs {
+			if name != "" && !names[kind+"/"+name] {
+				return fmt.Errorf("%s引用的%s%s未在配置中定义", owner, kind, name)
+			}
+		}
+		return nil
+	}
+	bindings := func(owner string, values []Binding) error {
+		for _, value := range values {
+			if err := check(owner, "角色", value.Role); err != nil {
+				return err
+			}
+			if err := check(owner, "项目", value.Project); err != nil {
+				return err
+			}
+			if err := check(owner, "环境", value.Env); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, value := range m.Projects {
+		if err := check("项目"+value.Name, "环境", value.Envs...); err != nil {
+			return err
+		}
+		if err := check("项目"+value.Name, "应用", value.Items...); err != nil {
+			return err
+		}
+		for _, ei := range value.EnvItems {
+			if err := check("项目"+value.Name, "仓库", ei.Repo); err != nil {
+				return err
+			}
+		}
+	}
+	for _, value := range m.Roles {
+		if err := check("角色"+value.Name, "角色", value.Parents...); err != nil {
+			return err
+		}
+	}
+	for _, value := range m.Groups {
+		if err := bindings("组"+value.Name, value.Roles); err != nil {
+			return err
+		}
+	}
+	for _, value := range m.Users {
+		if err := check("用户"+value.Name, "组", value.Groups...); err != nil {
+			return err
+		}
+		if err := bindings("用户"+value.Name, value.Roles); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration 一次版本化的表结构变更, Version 需全局唯一且递增
+type Migration struct {
+	Version uint
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// SchemaMigration 记录已执行的迁移
+type SchemaMigration struct {
+	Version   uint      `gorm:"column:version;primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"column:name;type:varchar(128);not null"`
+	AppliedAt time.Time `gorm:"column:applied_at;type:datetime"`
+}
+
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+func New(db *gorm.DB) *Migrator {
+	return NewWithMigrations(db, migrations)
+}
+
+func NewWithMigrations(db *gorm.DB, list []Migration) *Migrator {
+	sorted := make([]Migration, len(list))
+	copy(sorted, list)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	return &Migrator{db: db, migrations: sorted}
+}
+
+func (m *Migrator) init() error {
+	for i := 1; i < len(m.migrations); i++ {
+		if m.migrations[i].Version == m.migrations[i-1].Version {
+			return fmt.Errorf("迁移版本%d重复", m.migrations[i].Version)
+		}
+	}
+	if err := m.db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return fmt.Errorf("创建迁移记录表失败\n%w", err)
+	}
+	return nil
+}
+
+func (m *Migrator) applied() (map[uint]SchemaMigration, error) {
+	var rows []SchemaMigration
+	if err := m.db.Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("查询已执行的迁移失败\n%w", err)
+	}
+	result := make(map[uint]SchemaMigration, len(rows))
+	for _, value := range rows {
+		result[value.Version] = value
+	}
+	return result, nil
+}
+
+// Up 依次执行未执行的迁移直到 target 版本, target 为 0 时执行全部
+func (m *Migrator) Up(target uint) ([]Migration, error) {
+	if err := m.init(); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, value := range m.migrations {
+		if target != 0 && value.Version > target {
+			break
+		}
+		if _, ok := applied[value.Version]; ok {
+			continue
+		}
+		migration := value
+		err := m.db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				AppliedAt: time.Now(),
+			}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("执行迁移%d_%s失败\n%w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Down 按版本倒序回滚最近执行的 steps 个迁移
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	if steps <= 0 {
+		return nil, errors.New("回滚步数必须大于0")
+	}
+	if err := m.init(); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if migration.Down == nil {
+			return done, fmt.Errorf("迁移%d_%s不支持回滚", migration.Version, migration.Name)
+		}
+		err := m.db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, migration.Version).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("回滚迁移%d_%s失败\n%w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+func (m *Migrator) Status() ([]Status, error) {
+	if err := m.init(); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Status, 0, len(m.migrations))
+	for _, value := range m.migrations {
+		s := Status{Migration: value}
+		if row, ok := applied[value.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = row.AppliedAt
+		}
+		result = append(result, s)
+	}
+	return result, nil
+}
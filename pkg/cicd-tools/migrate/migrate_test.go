@@ -0,0 +1,179 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package migrate_test
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"devops/cicd-tools/pkg/cicd-tools/migrate"
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+func tables(t *testing.T, db *gorm.DB) string {
+	t.Helper()
+	list, err := db.Migrator().GetTables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// sqlite_sequence 等为 SQLite 的内部表
+	var names []string
+	for _, name := range list {
+		if !strings.HasPrefix(name, "sqlite_") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, " ")
+}
+
+func applied(t *testing.T, m *migrate.Migrator) []uint {
+	t.Helper()
+	status, err := m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versions []uint
+	for _, s := range status {
+		if s.Applied {
+			versions = append(versions, s.Version)
+		}
+	}
+	return versions
+}
+
+// TestUpDown 在 SQLite 上执行全部迁移后逐个回滚到初始状态, 再重新执行一遍, 保证每个迁移的 Down 都能撤销其 Up
+func TestUpDown(t *testing.T) {
+	db, err := model.OpenSQLite(":memory:", "cicd_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := migrate.New(db)
+	status, err := m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status) < 13 {
+		t.Fatalf("%d migrations", len(status))
+	}
+	empty := tables(t, db)
+
+	for round := 0; round < 2; round++ {
+		done, err := m.Up(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(done) != len(status) || len(applied(t, m)) != len(status) {
+			t.Fatalf("round %d: Up applied %d of %d", round, len(done), len(status))
+		}
+		if done, err := m.Up(0); err != nil || len(done) != 0 {
+			t.Fatalf("second Up = %d, %v", len(done), err)
+		}
+		for _, column := range []string{"service_account", "source", "locked_until", "token_version"} {
+			if !db.Migrator().HasColumn("cicd_user", column) {
+				t.Errorf("cicd_user.%s missing", column)
+			}
+		}
+		if !db.Migrator().HasColumn("cicd_permission", "effect") || !db.Migrator().HasTable("cicd_build_log") ||
+			!db.Migrator().HasTable("cicd_role_request") {
+			t.Errorf("tables after Up: %s", tables(t, db))
+		}
+
+		for i := len(status) - 1; i >= 0; i-- {
+			done, err := m.Down(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(done) != 1 || done[0].Version != status[i].Version {
+				t.Fatalf("Down rolled back %+v, want %d", done, status[i].Version)
+			}
+			if versions := applied(t, m); len(versions) != i {
+				t.Fatalf("applied after rolling back %d = %v", status[i].Version, versions)
+			}
+		}
+		if got := tables(t, db); got != empty {
+			t.Fatalf("tables after Down = %s, want %s", got, empty)
+		}
+		if done, err := m.Down(1); err != nil || len(done) != 0 {
+			t.Fatalf("Down without migrations = %d, %v", len(done), err)
+		}
+	}
+}
+
+func TestUpTarget(t *testing.T) {
+	db, err := model.OpenSQLite(":memory:", "cicd_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := migrate.New(db)
+	if _, err := m.Up(4); err != nil {
+		t.Fatal(err)
+	}
+	if versions := applied(t, m); len(versions) != 4 || versions[3] != 4 {
+		t.Fatalf("applied = %v", versions)
+	}
+	if db.Migrator().HasTable("cicd_role_request") {
+		t.Error("migration 5 applied before its target")
+	}
+	done, err := m.Down(10)
+	if err != nil || len(done) != 4 {
+		t.Fatalf("Down(10) = %d, %v", len(done), err)
+	}
+	if _, err := m.Down(0); err == nil {
+		t.Error("Down(0) succeeded")
+	}
+}
+
+// TestRenumberBuilds 创建构建编号的唯一索引前, 重复的编号除最早的一条外改为应用环境内新的最大编号
+func TestRenumberBuilds(t *testing.T) {
+	db, err := model.OpenSQLite(":memory:", "cicd_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := migrate.New(db)
+	if _, err := m.Up(13); err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range [][2]uint{{1, 1}, {1, 2}, {1, 2}, {1, 3}, {1, 3}, {2, 1}, {2, 1}} {
+		err := db.Exec("INSERT INTO cicd_build_info (project_env_item_id, build_id) VALUES (?, ?)", row[0], row[1]).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := m.Up(0); err != nil {
+		t.Fatal(err)
+	}
+	var builds []model.BuildInfo
+	if err := db.Order("id").Find(&builds).Error; err != nil {
+		t.Fatal(err)
+	}
+	var got []uint
+	for _, b := range builds {
+		got = append(got, b.BuildID)
+	}
+	if fmt.Sprint(got) != "[1 2 4 3 5 1 2]" {
+		t.Fatalf("build numbers = %v", got)
+	}
+	err = db.Exec("INSERT INTO cicd_build_info (project_env_item_id, build_id) VALUES (1, 5)").Error
+	if err == nil {
+		t.Fatal("duplicate build number inserted")
+	}
+}
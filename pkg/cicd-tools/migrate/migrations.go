@@ -0,0 +1,256 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package migrate
+
+import (
+	"gorm.io/gorm"
+)
+
+// migrations 按版本号追加, 已发布的迁移不要修改; 迁移只使用 schema.go 中对应版本的表结构快照, 不引用模型
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create_base_tables",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(baseTables()...)
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(baseTables()...)
+		},
+	},
+	{
+		Version: 2,
+		Name:    "add_permission_effect",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&permissionV2{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, &permissionV2{}, "effect")
+		},
+	},
+	{
+		Version: 3,
+		Name:    "create_role_parent",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&roleParentV3{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&roleParentV3{})
+		},
+	},
+	{
+		Version: 4,
+		Name:    "add_role_binding_scope",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&userRoleV4{}, &groupRoleV4{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := dropColumns(tx, &userRoleV4{}, "project_id", "project_env_id"); err != nil {
+				return err
+			}
+			return dropColumns(tx, &groupRoleV4{}, "project_id", "project_env_id")
+		},
+	},
+	{
+		Version: 5,
+		Name:    "add_role_grant_expiry",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&userRoleV5{}, &groupRoleV5{}, &roleRequestV5{}, &roleGrantLogV5{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&roleGrantLogV5{}, &roleRequestV5{}); err != nil {
+				return err
+			}
+			if err := dropColumns(tx, &userRoleV5{}, "expires_at"); err != nil {
+				return err
+			}
+			return dropColumns(tx, &groupRoleV5{}, "expires_at")
+		},
+	},
+	{
+		Version: 6,
+		Name:    "create_password_history",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&passwordHistoryV6{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&passwordHistoryV6{})
+		},
+	},
+	{
+		Version: 7,
+		Name:    "create_revoked_token",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&revokedTokenV7{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&revokedTokenV7{})
+		},
+	},
+	{
+		Version: 8,
+		Name:    "add_service_account_and_personal_token",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&userV8{}, &personalTokenV8{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&personalTokenV8{}); err != nil {
+				return err
+			}
+			return dropColumns(tx, &userV8{}, "service_account")
+		},
+	},
+	{
+		Version: 9,
+		Name:    "add_user_group_source",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&userV9{}, &groupV9{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := dropColumns(tx, &userV9{}, "source", "external_id"); err != nil {
+				return err
+			}
+			return dropColumns(tx, &groupV9{}, "source")
+		},
+	},
+	{
+		Version: 10,
+		Name:    "create_user_mfa",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&userTOTPV10{}, &recoveryCodeV10{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&recoveryCodeV10{}, &userTOTPV10{})
+		},
+	},
+	{
+		Version: 11,
+		Name:    "add_user_lockout_and_login_history",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&userV11{}, &loginHistoryV11{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&loginHistoryV11{}); err != nil {
+				return err
+			}
+			return dropColumns(tx, &userV11{}, "disabled", "failed_logins", "locked_until")
+		},
+	},
+	{
+		Version: 12,
+		Name:    "create_build_log",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&buildLogV12{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&buildLogV12{})
+		},
+	},
+	{
+		Version: 13,
+		Name:    "add_user_token_version",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&userV13{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, &userV13{}, "token_version")
+		},
+	},
+	{
+		Version: 14,
+		Name:    "add_build_info_number_index",
+		Up: func(tx *gorm.DB) error {
+			if err := renumberBuilds(tx); err != nil {
+				return err
+			}
+			return tx.AutoMigrate(&buildInfoV14{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if !tx.Migrator().HasIndex(&buildInfoV14{}, "idx_build_info_number") {
+				return nil
+			}
+			return tx.Migrator().DropIndex(&buildInfoV14{}, "idx_build_info_number")
+		},
+	},
+}
+
+// renumberBuilds 并发登记产生的重复构建编号中, 除最早的一条外依次改为应用环境内新的最大编号, 之后才能创建唯一索引
+func renumberBuilds(tx *gorm.DB) error {
+	var dups []buildInfoV14
+	err := tx.Model(&buildInfoV14{}).Select("project_env_item_id, build_id").
+		Group("project_env_item_id, build_id").Having("COUNT(*) > 1").Scan(&dups).Error
+	if err != nil {
+		return err
+	}
+	for _, dup := range dups {
+		var ids []uint
+		err := tx.Model(&buildInfoV14{}).Where("project_env_item_id = ? AND build_id = ?", dup.ProjectEnvItemID, dup.BuildID).
+			Order("id").Pluck("id", &ids).Error
+		if err != nil {
+			return err
+		}
+		for _, id := range ids[1:] {
+			var max uint
+			err := tx.Model(&buildInfoV14{}).Where("project_env_item_id = ?", dup.ProjectEnvItemID).
+				Select("COALESCE(MAX(build_id), 0)").Scan(&max).Error
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&buildInfoV14{}).Where("id = ?", id).Update("build_id", max+1).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// dropColumns 忽略不存在的列, 保证回滚可重复执行
+func dropColumns(tx *gorm.DB, value interface{}, columns ...string) error {
+	for _, column := range columns {
+		if !tx.Migrator().HasColumn(value, column) {
+			continue
+		}
+		if err := tx.Migrator().DropColumn(value, column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func baseTables() []interface{} {
+	return []interface{}{
+		&userV1{},
+		&groupV1{},
+		&roleV1{},
+		&permissionV1{},
+		&userGroupV1{},
+		&userRoleV1{},
+		&groupRoleV1{},
+		&projectV1{},
+		&envV1{},
+		&itemV1{},
+		&projectEnvV1{},
+		&projectItemV1{},
+		&projectEnvItemV1{},
+		&gitRepoV1{},
+		&gitConfigV1{},
+		&commitInfoV1{},
+		&artifactV1{},
+		&buildConfigV1{},
+		&buildInfoV1{},
+	}
+}
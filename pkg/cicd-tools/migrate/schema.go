@@ -0,0 +1,432 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package migrate
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// 迁移使用的表结构快照, 按版本号命名, 只包含该版本创建的表或新增的列;
+// 模型变更时不修改已有的快照, 而是为新的迁移添加快照, 保证每个版本的表结构固定不变
+
+// tableName 与模型的默认表名相同, 包括表前缀
+type tableName string
+
+func (t tableName) name(n schema.Namer) string {
+	return n.TableName(string(t))
+}
+
+type userV1 struct {
+	gorm.Model
+	Name       string `gorm:"column:user_name;type:varchar(30);not null"`
+	FullName   string `gorm:"column:full_name;type:varchar(30)"`
+	Gender     string `gorm:"column:gender;type:varchar(10)"`
+	Age        uint   `gorm:"column:age;type:integer"`
+	Location   string `gorm:"column:location;type:varchar(255)"`
+	Job        string `gorm:"column:job;type:varchar(30)"`
+	Password   string `gorm:"column:password;type:varchar(128)"`
+	Email      string `gorm:"column:email_address;type:varchar(90);unique;not null"`
+	Mobile     string `gorm:"column:mobile;type:varchar(30)"`
+	DingTalkID string `gorm:"column:dingtalk_id;type:varchar(30)"`
+	WXWorkID   string `gorm:"column:wxwork_id;type:varchar(30)"`
+}
+
+func (userV1) TableName(n schema.Namer) string { return tableName("User").name(n) }
+
+type groupV1 struct {
+	gorm.Model
+	Name  string `gorm:"column:group_name;type:varchar(60);unique;not null"`
+	Intro string `gorm:"column:intro;type:varchar(128)"`
+}
+
+func (groupV1) TableName(n schema.Namer) string { return tableName("Group").name(n) }
+
+type roleV1 struct {
+	gorm.Model
+	Name  string `gorm:"column:role;type:varchar(60);not null"`
+	Intro string `gorm:"column:intro;type:varchar(128)"`
+}
+
+func (roleV1) TableName(n schema.Namer) string { return tableName("Role").name(n) }
+
+type permissionV1 struct {
+	gorm.Model
+	Name       string `gorm:"column:permission;type:varchar(60);not null"`
+	ResourceID uint   `gorm:"column:resource_id;type:integer;not null"`
+	Category   string `gorm:"column:category;type:varchar(128);not null"`
+	Action     string `gorm:"column:action;type:varchar(60);not null"`
+	RoleID     uint   `gorm:"column:role_id;type:integer;not null"`
+}
+
+func (permissionV1) TableName(n schema.Namer) string { return tableName("Permission").name(n) }
+
+type userGroupV1 struct {
+	gorm.Model
+	UserID  uint `gorm:"column:user_id;type:integer"`
+	GroupID uint `gorm:"column:group_id;type:integer"`
+}
+
+func (userGroupV1) TableName(n schema.Namer) string { return tableName("UserGroup").name(n) }
+
+type userRoleV1 struct {
+	gorm.Model
+	UserID uint `gorm:"column:user_id;type:integer"`
+	RoleID uint `gorm:"column:role_id;type:integer"`
+}
+
+func (userRoleV1) TableName(n schema.Namer) string { return tableName("UserRole").name(n) }
+
+type groupRoleV1 struct {
+	gorm.Model
+	GroupID uint `gorm:"column:group_id;type:integer"`
+	RoleID  uint `gorm:"column:role_id;type:integer"`
+}
+
+func (groupRoleV1) TableName(n schema.Namer) string { return tableName("GroupRole").name(n) }
+
+type projectV1 struct {
+	ID    uint   `gorm:"column:id;primaryKey;autoIncrement"`
+	Name  string `gorm:"column:project;type:varchar(90);not null"`
+	Intro string `gorm:"column:intro;type:varchar(256)"`
+}
+
+func (projectV1) TableName() string { return "cicd_project" }
+
+type envV1 struct {
+	ID    uint   `gorm:"column:id;primaryKey;autoIncrement"`
+	Name  string `gorm:"column:env;type:varchar(60);not null"`
+	Intro string `gorm:"column:intro;type:varchar(128)"`
+}
+
+func (envV1) TableName() string { return "cicd_env" }
+
+type itemV1 struct {
+	ID       uint   `gorm:"column:id;primaryKey;autoIncrement"`
+	Name     string `gorm:"column:item;type:varchar(90);not null"`
+	Category string `gorm:"column:category;type:varchar(60)"`
+	Language string `gorm:"column:language;type:varchar(30)"`
+	Tier     string `gorm:"column:tier;type:varchar(20)"`
+	Intro    string `gorm:"column:intro;type:varchar(128)"`
+}
+
+func (itemV1) TableName() string { return "cicd_item" }
+
+type projectEnvV1 struct {
+	ID        uint `gorm:"column:id;primaryKey;autoIncrement"`
+	ProjectID uint `gorm:"column:project_id;type:integer"`
+	EnvID     uint `gorm:"column:env_id;type:integer"`
+}
+
+func (projectEnvV1) TableName() string { return "cicd_project_env" }
+
+type projectItemV1 struct {
+	ID        uint `gorm:"column:id;primaryKey;autoIncrement"`
+	ProjectID uint `gorm:"column:project_id;type:integer"`
+	ItemID    uint `gorm:"column:item_id;type:integer"`
+}
+
+func (projectItemV1) TableName() string { return "cicd_project_item" }
+
+type projectEnvItemV1 struct {
+	gorm.Model
+	Project       string `gorm:"column:project;type:varchar(256)"`
+	ProjectID     uint   `gorm:"column:project_id;type:integer"`
+	ProjectIntro  string `gorm:"column:project_intro;type:varchar(256)"`
+	Env           string `gorm:"column:env;type:varchar(60)"`
+	EnvID         uint   `gorm:"column:env_id;type:integer"`
+	EnvItro       string `gorm:"column:env_intro;type:varchar(256)"`
+	Item          string `gorm:"column:item;type:varchar(256)"`
+	ItemID        uint   `gorm:"column:item_id;type:integer"`
+	ItemIntro     string `gorm:"column:item_intro;type:varchar(256)"`
+	GitRepoID     uint   `gorm:"column:git_repo_id;type:integer"`
+	GitConfigID   uint   `gorm:"column:git_config_id;type:integer"`
+	BuildConfigID uint   `gorm:"column:build_config_id;type:integer"`
+}
+
+func (projectEnvItemV1) TableName() string { return "cicd_project_env_item" }
+
+type gitRepoV1 struct {
+	gorm.Model
+	Name       string `gorm:"column:name;type:varchar(60)"`
+	RepoURL    string `gorm:"column:repo_url;type:varchar(512)"`
+	RepoSSHURL string `gorm:"column:repo_ssh_url;type:varchar(512)"`
+	Intro      string `gorm:"column:intro;type:varchar(256)"`
+}
+
+func (gitRepoV1) TableName() string { return "cicd_git_repo" }
+
+type gitConfigV1 struct {
+	gorm.Model
+	GitRepoID  uint   `gorm:"column:git_repo_id;type:integer"`
+	Remote     string `gorm:"column:remote;type:varchar(90)"`
+	GitBranch  string `gorm:"column:git_branch;type:varchar(90)"`
+	UserName   string `gorm:"column:user_name;type:varchar(60)"`
+	UserEmail  string `gorm:"column:user_email;type:varchar(90)"`
+	Password   string `gorm:"column:password;type:varchar(128)"`
+	Credential string `gorm:"column:credential;type:varchar(256)"`
+}
+
+func (gitConfigV1) TableName() string { return "cicd_git_config" }
+
+type commitInfoV1 struct {
+	gorm.Model
+	GitRepoID       uint      `gorm:"column:git_repo_id;type:integer"`
+	GitBranch       string    `gorm:"column:git_branch;type:varchar(90)"`
+	GitTag          string    `gorm:"column:git_tag;type:varchar(256)"`
+	CommitHash      string    `gorm:"column:commit_hash;type:varchar(128)"`
+	CommitDate      time.Time `gorm:"column:commit_date;type:datetime"`
+	CommitUser      string    `gorm:"column:commit_user;type:varchar(90)"`
+	CommitUserEmail string    `gorm:"column:commit_user_email;type:varchar(90)"`
+	CommitMessage   string    `gorm:"column:commit_message;type:text"`
+	ChangeLogs      string    `gorm:"column:change_logs;type:text"`
+}
+
+func (commitInfoV1) TableName() string { return "cicd_commit_info" }
+
+type artifactV1 struct {
+	gorm.Model
+	Name             string `gorm:"column:artifact_name;type:varchar(256)"`
+	Release          string `gorm:"column:release;type:varchar(60)"`
+	Version          string `gorm:"column:version;type:varchar(60)"`
+	Md5              string `gorm:"column:md5_checksum;type:varchar(32);index:idx_atf_checksum"`
+	SHA1             string `gorm:"column:sha1_checksum;type:varchar(40);index:idx_atf_checksum"`
+	SHA256           string `gorm:"column:sha256_checksum;type:varchar(64);index:idx_atf_checksum"`
+	SHA512           string `gorm:"column:sha512_checksum;type:varchar(128);index:idx_atf_checksum"`
+	ProjectEnvItemID uint   `gorm:"column:project_env_item_id;type:integer"`
+	BuildInfoID      uint   `gorm:"column:build_info_id;type:integer"`
+}
+
+func (artifactV1) TableName() string { return "cicd_artifact" }
+
+type buildConfigV1 struct {
+	gorm.Model
+	BuildDir         string `gorm:"column:build_dir;type:varchar(256)"`
+	BuildCmd         string `gorm:"column:build_cmd;type:text"`
+	BuildEnv         string `gorm:"column:build_env;type:varchar(256)"`
+	ProjectEnvItemID uint   `gorm:"column:project_env_item_id;type:integer"`
+	GitRepoID        uint   `gorm:"column:git_repo_id;type:integer"`
+}
+
+func (buildConfigV1) TableName() string { return "cicd_build_config" }
+
+type buildInfoV1 struct {
+	gorm.Model
+	BuildID          uint      `gorm:"column:build_id;type:integer"`
+	BuildName        string    `gorm:"column:build_name;type:varchar(90)"`
+	BuildDate        time.Time `gorm:"column:build_date;type:datetime"`
+	BuildUserID      uint      `gorm:"column:build_user_id;type:integer"`
+	BuildUserName    string    `gorm:"column:build_user_name;type:varchar(90)"`
+	BuildEnv         string    `gorm:"column:build_env;type:varchar(256)"`
+	ProjectEnvItemID uint      `gorm:"column:project_env_item_id;type:integer"`
+	GitRepoID        uint      `gorm:"column:git_repo_id;type:integer"`
+	GitBranch        string    `gorm:"column:git_branch;type:varchar(90)"`
+	CommitInfoID     uint      `gorm:"column:commit_info_id;type:integer"`
+	BuildConfigID    uint      `gorm:"column:build_config_id;type:integer"`
+	ArtifactID       uint      `gorm:"column:artifact_id;type:integer"`
+	BuildState       string    `gorm:"column:build_state;type:varchar(30)"`
+}
+
+func (buildInfoV1) TableName() string { return "cicd_build_info" }
+
+type permissionV2 struct {
+	Effect string `gorm:"column:effect;type:varchar(10);not null;default:allow"`
+}
+
+func (permissionV2) TableName(n schema.Namer) string { return tableName("Permission").name(n) }
+
+type roleParentV3 struct {
+	gorm.Model
+	RoleID   uint `gorm:"column:role_id;type:integer"`
+	ParentID uint `gorm:"column:parent_id;type:integer"`
+}
+
+func (roleParentV3) TableName(n schema.Namer) string { return tableName("RoleParent").name(n) }
+
+type bindingScopeV4 struct {
+	ProjectID    uint `gorm:"column:project_id;type:integer;not null;default:0"`
+	ProjectEnvID uint `gorm:"column:project_env_id;type:integer;not null;default:0"`
+}
+
+type userRoleV4 bindingScopeV4
+
+func (userRoleV4) TableName(n schema.Namer) string { return tableName("UserRole").name(n) }
+
+type groupRoleV4 bindingScopeV4
+
+func (groupRoleV4) TableName(n schema.Namer) string { return tableName("GroupRole").name(n) }
+
+type userRoleV5 struct {
+	ExpiresAt *time.Time `gorm:"column:expires_at;index"`
+}
+
+func (userRoleV5) TableName(n schema.Namer) string { return tableName("UserRole").name(n) }
+
+type groupRoleV5 struct {
+	ExpiresAt *time.Time `gorm:"column:expires_at;index"`
+}
+
+func (groupRoleV5) TableName(n schema.Namer) string { return tableName("GroupRole").name(n) }
+
+type roleRequestV5 struct {
+	gorm.Model
+	UserID       uint       `gorm:"column:user_id;type:integer;not null;index"`
+	RoleID       uint       `gorm:"column:role_id;type:integer;not null"`
+	ProjectID    uint       `gorm:"column:project_id;type:integer;not null;default:0"`
+	ProjectEnvID uint       `gorm:"column:project_env_id;type:integer;not null;default:0"`
+	Duration     int64      `gorm:"column:duration;type:bigint;not null;default:0"`
+	Reason       string     `gorm:"column:reason;type:varchar(255)"`
+	Status       string     `gorm:"column:status;type:varchar(20);not null;default:pending;index"`
+	ApproverID   uint       `gorm:"column:approver_id;type:integer;not null;default:0"`
+	Comment      string     `gorm:"column:comment;type:varchar(255)"`
+	DecidedAt    *time.Time `gorm:"column:decided_at"`
+	UserRoleID   uint       `gorm:"column:user_role_id;type:integer;not null;default:0"`
+}
+
+func (roleRequestV5) TableName(n schema.Namer) string { return tableName("RoleRequest").name(n) }
+
+type roleGrantLogV5 struct {
+	gorm.Model
+	Action       string     `gorm:"column:action;type:varchar(20);not null"`
+	RequestID    uint       `gorm:"column:request_id;type:integer;not null;default:0;index"`
+	UserID       uint       `gorm:"column:user_id;type:integer;not null;default:0;index"`
+	GroupID      uint       `gorm:"column:group_id;type:integer;not null;default:0"`
+	RoleID       uint       `gorm:"column:role_id;type:integer;not null"`
+	ProjectID    uint       `gorm:"column:project_id;type:integer;not null;default:0"`
+	ProjectEnvID uint       `gorm:"column:project_env_id;type:integer;not null;default:0"`
+	ActorID      uint       `gorm:"column:actor_id;type:integer;not null;default:0"`
+	ExpiresAt    *time.Time `gorm:"column:expires_at"`
+	Comment      string     `gorm:"column:comment;type:varchar(255)"`
+}
+
+func (roleGrantLogV5) TableName(n schema.Namer) string { return tableName("RoleGrantLog").name(n) }
+
+type passwordHistoryV6 struct {
+	gorm.Model
+	UserID uint   `gorm:"column:user_id;type:integer;not null;index"`
+	Hash   string `gorm:"column:hash;type:varchar(128);not null"`
+}
+
+func (passwordHistoryV6) TableName(n schema.Namer) string {
+	return tableName("PasswordHistory").name(n)
+}
+
+type revokedTokenV7 struct {
+	gorm.Model
+	TokenID   string    `gorm:"column:token_id;type:varchar(64);not null;uniqueIndex"`
+	UserID    uint      `gorm:"column:user_id;type:integer;not null"`
+	ExpiresAt time.Time `gorm:"column:expires_at;not null;index"`
+}
+
+func (revokedTokenV7) TableName(n schema.Namer) string { return tableName("RevokedToken").name(n) }
+
+type userV8 struct {
+	ServiceAccount bool `gorm:"column:service_account;not null;default:false"`
+}
+
+func (userV8) TableName(n schema.Namer) string { return tableName("User").name(n) }
+
+type personalTokenV8 struct {
+	gorm.Model
+	UserID     uint       `gorm:"column:user_id;type:integer;not null;index"`
+	Name       string     `gorm:"column:name;type:varchar(60);not null"`
+	Prefix     string     `gorm:"column:prefix;type:varchar(20);not null"`
+	Hash       string     `gorm:"column:hash;type:varchar(64);not null;uniqueIndex"`
+	Scopes     string     `gorm:"column:scopes;type:varchar(1024);not null"`
+	ExpiresAt  *time.Time `gorm:"column:expires_at"`
+	LastUsedAt *time.Time `gorm:"column:last_used_at"`
+	RevokedAt  *time.Time `gorm:"column:revoked_at"`
+}
+
+func (personalTokenV8) TableName(n schema.Namer) string { return tableName("PersonalToken").name(n) }
+
+type userV9 struct {
+	Source     string `gorm:"column:source;type:varchar(20);not null;default:''"`
+	ExternalID string `gorm:"column:external_id;type:varchar(255);index"`
+}
+
+func (userV9) TableName(n schema.Namer) string { return tableName("User").name(n) }
+
+type groupV9 struct {
+	Source string `gorm:"column:source;type:varchar(20);not null;default:''"`
+}
+
+func (groupV9) TableName(n schema.Namer) string { return tableName("Group").name(n) }
+
+type userTOTPV10 struct {
+	gorm.Model
+	UserID      uint       `gorm:"column:user_id;type:integer;not null;uniqueIndex"`
+	Secret      string     `gorm:"column:secret;type:varchar(64);not null"`
+	ConfirmedAt *time.Time `gorm:"column:confirmed_at"`
+	LastStep    int64      `gorm:"column:last_step;not null;default:0"`
+}
+
+func (userTOTPV10) TableName(n schema.Namer) string { return tableName("UserTOTP").name(n) }
+
+type recoveryCodeV10 struct {
+	gorm.Model
+	UserID uint       `gorm:"column:user_id;type:integer;not null;index"`
+	Hash   string     `gorm:"column:hash;type:varchar(64);not null"`
+	UsedAt *time.Time `gorm:"column:used_at"`
+}
+
+func (recoveryCodeV10) TableName(n schema.Namer) string { return tableName("RecoveryCode").name(n) }
+
+type userV11 struct {
+	Disabled     bool       `gorm:"column:disabled;not null;default:false"`
+	FailedLogins int        `gorm:"column:failed_logins;not null;default:0"`
+	LockedUntil  *time.Time `gorm:"column:locked_until"`
+}
+
+func (userV11) TableName(n schema.Namer) string { return tableName("User").name(n) }
+
+type loginHistoryV11 struct {
+	gorm.Model
+	UserID    uint   `gorm:"column:user_id;type:integer;not null;index"`
+	Username  string `gorm:"column:user_name;type:varchar(60);not null"`
+	Method    string `gorm:"column:method;type:varchar(20);not null"`
+	Success   bool   `gorm:"column:success;not null"`
+	Reason    string `gorm:"column:reason;type:varchar(255)"`
+	IP        string `gorm:"column:ip;type:varchar(64)"`
+	UserAgent string `gorm:"column:user_agent;type:varchar(255)"`
+}
+
+func (loginHistoryV11) TableName(n schema.Namer) string { return tableName("LoginHistory").name(n) }
+
+type buildLogV12 struct {
+	ID          uint      `gorm:"column:id;primaryKey;autoIncrement"`
+	BuildInfoID uint      `gorm:"column:build_info_id;type:integer;not null;index"`
+	Line        string    `gorm:"column:line;type:text"`
+	CreatedAt   time.Time `gorm:"column:created_at"`
+}
+
+func (buildLogV12) TableName() string { return "cicd_build_log" }
+
+type userV13 struct {
+	TokenVersion int `gorm:"column:token_version;not null;default:0"`
+}
+
+func (userV13) TableName(n schema.Namer) string { return tableName("User").name(n) }
+
+type buildInfoV14 struct {
+	BuildID          uint `gorm:"column:build_id;type:integer;uniqueIndex:idx_build_info_number,priority:2"`
+	ProjectEnvItemID uint `gorm:"column:project_env_item_id;type:integer;uniqueIndex:idx_build_info_number,priority:1"`
+}
+
+func (buildInfoV14) TableName() string { return "cicd_build_info" }
@@ -0,0 +1,175 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+// auth 代码仓库的认证信息, 来自 GitConfig: HTTP(S) 地址使用 UserName 与 Password,
+// Credential 为 mirror.key_dir 下 SSH 私钥的文件名, 配置后优先使用 SSH 地址
+type auth struct {
+	username string
+	password string
+	sshKey   string
+}
+
+// credentials 读取代码仓库的 GitConfig, 没有配置时不使用认证
+func (m *Mirror) credentials(r *model.GitRepo) (*auth, error) {
+	c, err := m.store.Builds().FirstGitConfig(&model.GitConfig{GitRepoID: r.ID})
+	if errors.Is(err, model.ErrNotFound) {
+		return new(auth), nil
+	} else if err != nil {
+		return nil, fmt.Errorf("读取代码仓库%s的认证信息失败\n%w", r.Name, err)
+	}
+	a := &auth{username: c.UserName, password: c.Password}
+	if c.Credential != "" {
+		if a.sshKey, err = m.keyPath(c.Credential); err != nil {
+			return nil, fmt.Errorf("代码仓库%s的SSH私钥%s无效\n%w", r.Name, c.Credential, err)
+		}
+	}
+	return a, nil
+}
+
+// keyPath 私钥只能是 keyDir 下的文件, 不接受绝对路径或跳出该目录的相对路径
+func (m *Mirror) keyPath(name string) (string, error) {
+	if m.keyDir == "" {
+		return "", fmt.Errorf("%w: 未配置mirror.key_dir", ErrKey)
+	}
+	if filepath.IsAbs(name) || filepath.Clean(name) != name || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: 只能是mirror.key_dir下的相对路径", ErrKey)
+	}
+	return filepath.Join(m.keyDir, name), nil
+}
+
+// checkURL 按协议白名单检查地址, 与 run 中的 GIT_ALLOW_PROTOCOL 一起防止克隆服务器本地的仓库;
+// 与 git 相同, <协议>::<地址> 为远程助手, 没有协议的地址中冒号前不含斜杠时为 scp 形式的 SSH 地址, 否则为本地路径
+func (m *Mirror) checkURL(url string) error {
+	i := 0
+	for i < len(url) && (isAlnum(url[i]) || i > 0 && strings.IndexByte("+-.", url[i]) >= 0) {
+		i++
+	}
+	var scheme string
+	switch rest := url[i:]; {
+	case i > 0 && (strings.HasPrefix(rest, "::") || strings.HasPrefix(rest, "://")):
+		scheme = strings.ToLower(url[:i])
+	case strings.Contains(url, ":") && !strings.Contains(url[:strings.Index(url, ":")], "/"):
+		scheme = "ssh"
+	default:
+		scheme = "file"
+	}
+	for _, value := range m.protocols() {
+		if scheme == value {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s, 允许的协议为%s", ErrProtocol, scheme, strings.Join(m.protocols(), ", "))
+}
+
+func isAlnum(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+func (m *Mirror) protocols() []string {
+	if m.allowFile {
+		return []string{"https", "ssh", "file"}
+	}
+	return []string{"https", "ssh"}
+}
+
+func (a *auth) url(r *model.GitRepo) string {
+	if r.RepoSSHURL != "" && (a.sshKey != "" || r.RepoURL == "") {
+		return r.RepoSSHURL
+	}
+	return r.RepoURL
+}
+
+// askpass 通过环境变量回答 git 的用户名与密码提示, 认证信息不写入镜像的配置与命令行参数
+const askpass = `#!/bin/sh
+case "$1" in
+Username*) printf '%s\n' "$CICD_GIT_USERNAME" ;;
+*) printf '%s\n' "$CICD_GIT_PASSWORD" ;;
+esac
+`
+
+// run 在 dir 中执行 git 命令并返回标准输出, dir 为空时在当前目录执行; 失败时错误中包含 git 的错误输出
+func (m *Mirror) run(ctx context.Context, a *auth, dir string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, m.git, args...)
+	cmd.Dir = dir
+	// 禁止交互式提示, 限制可用的协议 (包括重定向与子模块), 并固定输出语言以便记录错误
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ALLOW_PROTOCOL="+strings.Join(m.protocols(), ":"), "LC_ALL=C")
+	if a != nil {
+		env, cleanup, err := a.env()
+		if err != nil {
+			return "", err
+		}
+		defer cleanup()
+		cmd.Env = append(cmd.Env, env...)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s失败: %s\n%w", args[0], msg, err)
+		}
+		return "", fmt.Errorf("git %s失败\n%w", args[0], err)
+	}
+	return stdout.String(), nil
+}
+
+// env 认证所需的环境变量, cleanup 删除生成的临时文件
+func (a *auth) env() ([]string, func(), error) {
+	var env []string
+	cleanup := func() {}
+	if a.sshKey != "" {
+		env = append(env, "GIT_SSH_COMMAND=ssh -i "+shellQuote(a.sshKey)+" -o IdentitiesOnly=yes -o BatchMode=yes")
+	}
+	if a.username != "" || a.password != "" {
+		dir, err := ioutil.TempDir("", "cicd-askpass")
+		if err != nil {
+			return nil, nil, fmt.Errorf("创建临时目录失败\n%w", err)
+		}
+		cleanup = func() { os.RemoveAll(dir) }
+		script := filepath.Join(dir, "askpass.sh")
+		if err := ioutil.WriteFile(script, []byte(askpass), 0700); err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("创建凭据脚本失败\n%w", err)
+		}
+		env = append(env, "GIT_ASKPASS="+script, "CICD_GIT_USERNAME="+a.username, "CICD_GIT_PASSWORD="+a.password)
+	}
+	return env, cleanup, nil
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
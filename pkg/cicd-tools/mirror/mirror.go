@@ -0,0 +1,302 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package mirror 在本地为登记的代码仓库维护裸镜像, 通过 git 命令行获取更新并将分支、标签解析为提交
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+	"devops/cicd-tools/pkg/util/logger"
+)
+
+var (
+	// ErrNoURL 代码仓库没有配置地址
+	ErrNoURL = errors.New("代码仓库未配置地址")
+	// ErrProtocol 代码仓库地址使用了不允许的协议, 默认只允许 https 与 ssh
+	ErrProtocol = errors.New("代码仓库地址的协议不允许")
+	// ErrKey SSH 私钥不在 mirror.key_dir 中
+	ErrKey = errors.New("SSH私钥无效")
+)
+
+// Mirror 在 dir 下为每个代码仓库维护一个裸镜像, 目录名为 <仓库ID>.git, 仓库改名或修改地址后仍使用同一镜像;
+// 同一仓库的获取与解析串行执行, 不同仓库之间互不影响
+type Mirror struct {
+	store     model.Store
+	dir       string
+	git       string
+	timeout   time.Duration
+	keyDir    string
+	allowFile bool
+
+	mu    sync.Mutex
+	locks map[uint]*sync.Mutex
+}
+
+func New(s model.Store, dir string) *Mirror {
+	return &Mirror{store: s, dir: dir, git: "git", timeout: 10 * time.Minute, locks: map[uint]*sync.Mutex{}}
+}
+
+// WithGit 指定 git 可执行文件, 默认从 PATH 中查找
+func (m *Mirror) WithGit(path string) *Mirror {
+	m.git = path
+	return m
+}
+
+// WithTimeout 指定单个 git 命令的最长执行时间
+func (m *Mirror) WithTimeout(d time.Duration) *Mirror {
+	m.timeout = d
+	return m
+}
+
+// WithKeyDir 指定 SSH 私钥所在目录, GitConfig.Credential 为该目录下的文件名; 未指定时不能使用 SSH 私钥
+func (m *Mirror) WithKeyDir(dir string) *Mirror {
+	m.keyDir = dir
+	return m
+}
+
+// WithFileProtocol 允许克隆本地路径与 file:// 地址, 只用于测试, 否则登记仓库的用户可以读取服务器上的任意仓库
+func (m *Mirror) WithFileProtocol(allow bool) *Mirror {
+	m.allowFile = allow
+	return m
+}
+
+// Path 代码仓库的镜像目录
+func (m *Mirror) Path(id uint) string {
+	return filepath.Join(m.dir, strconv.FormatUint(uint64(id), 10)+".git")
+}
+
+// Exists 代码仓库的镜像是否已获取
+func (m *Mirror) Exists(id uint) bool {
+	_, err := os.Stat(filepath.Join(m.Path(id), "HEAD"))
+	return err == nil
+}
+
+func (m *Mirror) lock(id uint) func() {
+	m.mu.Lock()
+	l, ok := m.locks[id]
+	if !ok {
+		l = new(sync.Mutex)
+		m.locks[id] = l
+	}
+	m.mu.Unlock()
+	l.Lock()
+	return l.Unlock
+}
+
+// Fetch 获取代码仓库的更新, 镜像不存在时先克隆; 远程已删除的分支与标签同时从镜像中删除
+func (m *Mirror) Fetch(ctx context.Context, r *model.GitRepo) error {
+	unlock := m.lock(r.ID)
+	defer unlock()
+	return m.fetch(ctx, r)
+}
+
+func (m *Mirror) fetch(ctx context.Context, r *model.GitRepo) error {
+	auth, err := m.credentials(r)
+	if err != nil {
+		return err
+	}
+	url := auth.url(r)
+	if url == "" {
+		return fmt.Errorf("代码仓库%s获取失败\n%w", r.Name, ErrNoURL)
+	}
+	if err := m.checkURL(url); err != nil {
+		return fmt.Errorf("代码仓库%s获取失败\n%w", r.Name, err)
+	}
+	path := m.Path(r.ID)
+	if !m.Exists(r.ID) {
+		if err := os.MkdirAll(m.dir, 0755); err != nil {
+			return fmt.Errorf("创建镜像目录%s失败\n%w", m.dir, err)
+		}
+		// 先克隆到临时目录, 避免中断后留下不完整的镜像
+		tmp := path + ".tmp"
+		if err := os.RemoveAll(tmp); err != nil {
+			return err
+		}
+		if _, err := m.run(ctx, auth, "", "clone", "--mirror", "--quiet", "--", url, tmp); err != nil {
+			os.RemoveAll(tmp)
+			return fmt.Errorf("克隆代码仓库%s失败\n%w", r.Name, err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			os.RemoveAll(tmp)
+			return fmt.Errorf("保存代码仓库%s的镜像失败\n%w", r.Name, err)
+		}
+		return nil
+	}
+	// 每次使用当前登记的地址, 仓库地址修改后不需要重新克隆
+	if _, err := m.run(ctx, auth, path, "remote", "set-url", "origin", url); err != nil {
+		return fmt.Errorf("更新代码仓库%s的地址失败\n%w", r.Name, err)
+	}
+	if _, err := m.run(ctx, auth, path, "fetch", "--prune", "--quiet", "origin"); err != nil {
+		return fmt.Errorf("获取代码仓库%s的更新失败\n%w", r.Name, err)
+	}
+	return nil
+}
+
+// FetchAll 依次获取全部代码仓库的更新, 单个仓库失败不影响其它仓库, 返回失败的仓库数与最后一个错误
+func (m *Mirror) FetchAll(ctx context.Context) (int, error) {
+	repos, err := m.store.Builds().FindRepos(&model.GitRepo{})
+	if err != nil {
+		return 0, fmt.Errorf("查询代码仓库失败\n%w", err)
+	}
+	var failed int
+	var last error
+	for i := range repos {
+		if ctx.Err() != nil {
+			return failed, ctx.Err()
+		}
+		if err := m.Fetch(ctx, &repos[i]); err != nil {
+			logger.Error(err)
+			failed++
+			last = err
+		}
+	}
+	return failed, last
+}
+
+// Run 每隔 interval 获取一次全部代码仓库的更新, 直到 ctx 取消
+func (m *Mirror) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if failed, _ := m.FetchAll(ctx); failed > 0 {
+			logger.Warn(fmt.Sprintf("代码仓库镜像更新完成, %d个仓库获取失败", failed))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Remove 删除代码仓库的镜像, 镜像不存在时不报错
+func (m *Mirror) Remove(id uint) error {
+	unlock := m.lock(id)
+	defer unlock()
+	if err := os.RemoveAll(m.Path(id)); err != nil {
+		return fmt.Errorf("删除代码仓库%d的镜像失败\n%w", id, err)
+	}
+	return nil
+}
+
+// Ref 镜像中的分支或标签, Hash 为其指向的提交, 附注标签也解析为提交
+type Ref struct {
+	Name string
+	Hash string
+}
+
+// Branch 分支名, 不是分支时为空
+func (r Ref) Branch() string {
+	return trimPrefix(r.Name, "refs/heads/")
+}
+
+// Tag 标签名, 不是标签时为空
+func (r Ref) Tag() string {
+	return trimPrefix(r.Name, "refs/tags/")
+}
+
+func trimPrefix(s string, prefix string) string {
+	if !strings.HasPrefix(s, prefix) {
+		return ""
+	}
+	return s[len(prefix):]
+}
+
+// Refs 列出镜像中的分支与标签, 不获取更新; 镜像不存在时返回 model.ErrNotFound
+func (m *Mirror) Refs(ctx context.Context, r *model.GitRepo) ([]Ref, error) {
+	unlock := m.lock(r.ID)
+	defer unlock()
+	if !m.Exists(r.ID) {
+		return nil, fmt.Errorf("代码仓库%s尚未获取\n%w", r.Name, model.ErrNotFound)
+	}
+	out, err := m.run(ctx, nil, m.Path(r.ID), "for-each-ref", "--format=%(objectname) %(*objectname) %(refname)", "refs/heads", "refs/tags")
+	if err != nil {
+		return nil, fmt.Errorf("读取代码仓库%s的分支与标签失败\n%w", r.Name, err)
+	}
+	var refs []Ref
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.Fields(line)
+		switch len(fields) {
+		case 2:
+			refs = append(refs, Ref{Name: fields[1], Hash: fields[0]})
+		case 3:
+			refs = append(refs, Ref{Name: fields[2], Hash: fields[1]})
+		}
+	}
+	return refs, nil
+}
+
+// commitFormat 提交信息的输出格式, 字段以 NUL 分隔, 依次为散列、提交时间、作者、邮箱与提交说明
+const commitFormat = "--format=%H%x00%cI%x00%an%x00%ae%x00%B"
+
+// Resolve 将分支、标签或提交散列解析为提交, 依次按分支、标签与任意版本表达式查找, 不获取更新;
+// 返回的 CommitInfo 未保存, 查找不到时返回 model.ErrNotFound
+func (m *Mirror) Resolve(ctx context.Context, r *model.GitRepo, ref string) (*model.CommitInfo, error) {
+	if ref == "" || strings.HasPrefix(ref, "-") {
+		return nil, fmt.Errorf("版本%s无效\n%w", ref, model.ErrNotFound)
+	}
+	unlock := m.lock(r.ID)
+	defer unlock()
+	if !m.Exists(r.ID) {
+		return nil, fmt.Errorf("代码仓库%s尚未获取\n%w", r.Name, model.ErrNotFound)
+	}
+	path := m.Path(r.ID)
+	c := &model.CommitInfo{GitRepoID: r.ID}
+	var hash string
+	for _, candidate := range []string{"refs/heads/" + ref, "refs/tags/" + ref, ref} {
+		out, err := m.run(ctx, nil, path, "rev-parse", "--verify", "--quiet", candidate+"^{commit}")
+		if err != nil {
+			continue
+		}
+		hash = strings.TrimSpace(out)
+		switch {
+		case strings.HasPrefix(candidate, "refs/heads/"):
+			c.GitBranch = ref
+		case strings.HasPrefix(candidate, "refs/tags/"):
+			c.GitTag = ref
+		}
+		break
+	}
+	if hash == "" {
+		return nil, fmt.Errorf("代码仓库%s中不存在%s\n%w", r.Name, ref, model.ErrNotFound)
+	}
+	out, err := m.run(ctx, nil, path, "show", "--no-patch", commitFormat, hash)
+	if err != nil {
+		return nil, fmt.Errorf("读取代码仓库%s的提交%s失败\n%w", r.Name, hash, err)
+	}
+	fields := strings.SplitN(out, "\x00", 5)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("无法解析提交%s的信息", hash)
+	}
+	c.CommitHash = fields[0]
+	if c.CommitDate, err = time.Parse(time.RFC3339, fields[1]); err != nil {
+		return nil, fmt.Errorf("无法解析提交%s的时间%s\n%w", hash, fields[1], err)
+	}
+	c.CommitUser = fields[2]
+	c.CommitUserEmail = fields[3]
+	c.CommitMessage = strings.TrimSpace(fields[4])
+	return c, nil
+}
@@ -0,0 +1,242 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package mirror
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+	"devops/cicd-tools/pkg/cicd-tools/store/memstore"
+)
+
+// origin 测试用的远程仓库, bare 为裸仓库, work 为推送提交的工作区
+type origin struct {
+	t    *testing.T
+	bare string
+	work string
+}
+
+func newOrigin(t *testing.T) *origin {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("未安装git")
+	}
+	root := t.TempDir()
+	o := &origin{t: t, bare: filepath.Join(root, "origin.git"), work: filepath.Join(root, "work")}
+	o.git(root, "init", "--bare", "--quiet", o.bare)
+	o.git(o.bare, "symbolic-ref", "HEAD", "refs/heads/main")
+	o.git(root, "init", "--quiet", o.work)
+	o.git(o.work, "checkout", "--quiet", "-b", "main")
+	o.git(o.work, "remote", "add", "origin", o.bare)
+	return o
+}
+
+func (o *origin) git(dir string, args ...string) string {
+	o.t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=tester", "GIT_AUTHOR_EMAIL=tester@example.com",
+		"GIT_COMMITTER_NAME=tester", "GIT_COMMITTER_EMAIL=tester@example.com",
+		"GIT_CONFIG_NOSYSTEM=1", "HOME="+dir)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		o.t.Fatalf("git %s: %s\n%v", strings.Join(args, " "), out, err)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// commit 提交一次修改并返回提交散列
+func (o *origin) commit(message string) string {
+	o.t.Helper()
+	if err := ioutil.WriteFile(filepath.Join(o.work, "file"), []byte(message), 0644); err != nil {
+		o.t.Fatal(err)
+	}
+	o.git(o.work, "add", "file")
+	o.git(o.work, "commit", "--quiet", "-m", message)
+	return o.git(o.work, "rev-parse", "HEAD")
+}
+
+func (o *origin) push(refs ...string) {
+	o.t.Helper()
+	o.git(o.work, append([]string{"push", "--quiet", "origin"}, refs...)...)
+}
+
+func newMirror(t *testing.T, o *origin) (*Mirror, *model.GitRepo) {
+	s := memstore.New()
+	r := &model.GitRepo{Name: "demo", RepoURL: "file://" + o.bare}
+	if err := s.Builds().FirstOrCreateRepo(r); err != nil {
+		t.Fatal(err)
+	}
+	return New(s, t.TempDir()).WithFileProtocol(true), r
+}
+
+func TestMirror(t *testing.T) {
+	o := newOrigin(t)
+	first := o.commit("first\n\nbody")
+	o.git(o.work, "tag", "light")
+	o.git(o.work, "tag", "-a", "annotated", "-m", "release")
+	o.git(o.work, "branch", "feature")
+	second := o.commit("second")
+	o.push("main", "feature", "light", "annotated")
+
+	m, r := newMirror(t, o)
+	ctx := context.Background()
+	if _, err := m.Refs(ctx, r); !errors.Is(err, model.ErrNotFound) {
+		t.Fatalf("镜像不存在时应返回ErrNotFound, 实际为%v", err)
+	}
+	if err := m.Fetch(ctx, r); err != nil {
+		t.Fatal(err)
+	}
+
+	refs, err := m.Refs(ctx, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"refs/heads/main":     second,
+		"refs/heads/feature":  first,
+		"refs/tags/light":     first,
+		"refs/tags/annotated": first,
+	}
+	if len(refs) != len(want) {
+		t.Fatalf("分支与标签为%v, 期望%v", refs, want)
+	}
+	for _, ref := range refs {
+		if want[ref.Name] != ref.Hash {
+			t.Errorf("%s指向%s, 期望%s", ref.Name, ref.Hash, want[ref.Name])
+		}
+	}
+
+	tests := []struct {
+		ref    string
+		hash   string
+		branch string
+		tag    string
+	}{
+		{ref: "main", hash: second, branch: "main"},
+		{ref: "feature", hash: first, branch: "feature"},
+		{ref: "light", hash: first, tag: "light"},
+		{ref: "annotated", hash: first, tag: "annotated"},
+		{ref: first, hash: first},
+		{ref: first[:10], hash: first},
+	}
+	for _, tt := range tests {
+		c, err := m.Resolve(ctx, r, tt.ref)
+		if err != nil {
+			t.Errorf("解析%s失败: %v", tt.ref, err)
+			continue
+		}
+		if c.CommitHash != tt.hash || c.GitBranch != tt.branch || c.GitTag != tt.tag {
+			t.Errorf("解析%s得到%s(分支%q, 标签%q), 期望%s(分支%q, 标签%q)",
+				tt.ref, c.CommitHash, c.GitBranch, c.GitTag, tt.hash, tt.branch, tt.tag)
+		}
+		if c.GitRepoID != r.ID || c.CommitUser != "tester" || c.CommitUserEmail != "tester@example.com" {
+			t.Errorf("解析%s得到的提交信息不完整: %+v", tt.ref, c)
+		}
+	}
+	c, err := m.Resolve(ctx, r, "annotated")
+	if err == nil && c.CommitMessage != "first\n\nbody" {
+		t.Errorf("提交说明为%q", c.CommitMessage)
+	}
+
+	for _, ref := range []string{"unknown", "refs/heads/unknown", "-h", ""} {
+		if _, err := m.Resolve(ctx, r, ref); !errors.Is(err, model.ErrNotFound) {
+			t.Errorf("解析%q应返回ErrNotFound, 实际为%v", ref, err)
+		}
+	}
+}
+
+func TestMirrorPrune(t *testing.T) {
+	o := newOrigin(t)
+	o.commit("first")
+	o.git(o.work, "branch", "feature")
+	o.push("main", "feature")
+
+	m, r := newMirror(t, o)
+	ctx := context.Background()
+	if err := m.Fetch(ctx, r); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Resolve(ctx, r, "feature"); err != nil {
+		t.Fatal(err)
+	}
+
+	o.push(":feature")
+	third := o.commit("third")
+	o.push("main")
+	if err := m.Fetch(ctx, r); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Resolve(ctx, r, "feature"); !errors.Is(err, model.ErrNotFound) {
+		t.Fatalf("远程已删除的分支应从镜像中删除, 实际为%v", err)
+	}
+	c, err := m.Resolve(ctx, r, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.CommitHash != third {
+		t.Fatalf("main指向%s, 期望%s", c.CommitHash, third)
+	}
+}
+
+func TestMirrorProtocol(t *testing.T) {
+	o := newOrigin(t)
+	o.commit("first")
+	o.push("main")
+
+	m, r := newMirror(t, o)
+	m.WithFileProtocol(false)
+	ctx := context.Background()
+	for _, url := range []string{"file://" + o.bare, o.bare, "ext::sh -c id", "http://git.example.com/demo.git", "git+ssh://git.example.com/demo.git"} {
+		r.RepoURL = url
+		if err := m.Fetch(ctx, r); !errors.Is(err, ErrProtocol) {
+			t.Errorf("地址%s应被拒绝, 实际为%v", url, err)
+		}
+	}
+	if m.Exists(r.ID) {
+		t.Fatal("被拒绝的地址不应创建镜像")
+	}
+	for _, url := range []string{"https://git.example.com/demo.git", "ssh://git@git.example.com/demo.git", "git@git.example.com:demo.git"} {
+		if err := m.checkURL(url); err != nil {
+			t.Errorf("地址%s应被允许: %v", url, err)
+		}
+	}
+}
+
+func TestMirrorKeyPath(t *testing.T) {
+	m := New(memstore.New(), t.TempDir())
+	if _, err := m.keyPath("deploy"); !errors.Is(err, ErrKey) {
+		t.Fatalf("未配置key_dir时应拒绝私钥, 实际为%v", err)
+	}
+	m.WithKeyDir("/etc/cicd-tools/keys")
+	path, err := m.keyPath("team/deploy")
+	if err != nil || path != filepath.Join("/etc/cicd-tools/keys", "team/deploy") {
+		t.Fatalf("私钥路径为%s: %v", path, err)
+	}
+	for _, name := range []string{"/root/.ssh/id_rsa", "../id_rsa", "..", "team/../../id_rsa", "./deploy"} {
+		if _, err := m.keyPath(name); !errors.Is(err, ErrKey) {
+			t.Errorf("私钥%s应被拒绝, 实际为%v", name, err)
+		}
+	}
+}
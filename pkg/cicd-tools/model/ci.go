@@ -17,6 +17,8 @@
 package model
 
 import (
+	"errors"
+	"fmt"
 	"gorm.io/gorm"
 	"time"
 )
@@ -42,8 +44,8 @@ type Env struct {
 type Item struct {
 	ID       uint   `gorm:"column:id;primaryKey;autoIncrement"`
 	Name     string `gorm:"column:item;type:varchar(90);not null"`
-	Category string `gorm:"column:category;tape:varchar(60)"`
-	Language string `gorm:"column:language;tape:varchar(30)"`
+	Category string `gorm:"column:category;type:varchar(60)"`
+	Language string `gorm:"column:language;type:varchar(30)"`
 	Tier     string `gorm:"column:tier;type:varchar(20)"`
 	Intro    string `gorm:"column:intro;type:varchar(128)"`
 	Error    error  `gorm:"-"`
@@ -96,8 +98,8 @@ type GitConfig struct {
 	GitBranch  string `gorm:"column:git_branch;type:varchar(90)"`
 	UserName   string `gorm:"column:user_name;type:varchar(60)"`
 	UserEmail  string `gorm:"column:user_email;type:varchar(90)"`
-	Password   string `gorm:"column:password;type:varchar(128)"`
-	Credential string `gorm:"column:credential;type:varchar(256)"`
+	Password   string `gorm:"column:password;type:varchar(128)" query:"-"`
+	Credential string `gorm:"column:credential;type:varchar(256)" query:"-"`
 	Error      error  `gorm:"-"`
 }
 
@@ -110,20 +112,20 @@ type CommitInfo struct {
 	CommitDate      time.Time `gorm:"column:commit_date;type:datetime"`
 	CommitUser      string    `gorm:"column:commit_user;type:varchar(90)"`
 	CommitUserEmail string    `gorm:"column:commit_user_email;type:varchar(90)"`
-	CommitMessage   string    `gorm:"column:commit_message;type:varchar(65531)"`
-	ChangeLogs      string    `gorm:"column:change_logs;type:varchar(65531)"`
+	CommitMessage   string    `gorm:"column:commit_message;type:text"`
+	ChangeLogs      string    `gorm:"column:change_logs;type:text"`
 	Error           error     `gorm:"-"`
 }
 
 type Artifact struct {
 	gorm.Model
-	Name             string `gorm:"column:artifact_name;varchar(256)"`
-	Release          string `gorm:"column:release;varchar(60)"`
-	Version          string `gorm:"column:version;varchar(60)"`
-	Md5              string `gorm:"column:md5_checksum;varchar(32);index:idx_atf_checksum"`
-	SHA1             string `gorm:"column:sha1_checksum;varchar(40);index:idx_atf_checksum"`
-	SHA256           string `gorm:"column:sha256_checksum;varchar(64);index:idx_atf_checksum"`
-	SHA512           string `gorm:"column:sha512_checksum;varchar(128);index:idx_atf_checksum"`
+	Name             string `gorm:"column:artifact_name;type:varchar(256)"`
+	Release          string `gorm:"column:release;type:varchar(60)"`
+	Version          string `gorm:"column:version;type:varchar(60)"`
+	Md5              string `gorm:"column:md5_checksum;type:varchar(32);index:idx_atf_checksum"`
+	SHA1             string `gorm:"column:sha1_checksum;type:varchar(40);index:idx_atf_checksum"`
+	SHA256           string `gorm:"column:sha256_checksum;type:varchar(64);index:idx_atf_checksum"`
+	SHA512           string `gorm:"column:sha512_checksum;type:varchar(128);index:idx_atf_checksum"`
 	ProjectEnvItemID uint   `gorm:"column:project_env_item_id;type:integer;<-:create"`
 	BuildInfoID      uint   `gorm:"column:build_info_id;type:integer;<-:create"`
 	Error            error  `gorm:"-"`
@@ -131,9 +133,9 @@ type Artifact struct {
 
 type BuildConfig struct {
 	gorm.Model
-	BuildDir         string `gorm:"column:build_dir;varchar(256)"`
-	BuildCmd         string `gorm:"column:build_cmd;varchar(65531)"`
-	BuildEnv         string `gorm:"column:build_env;varchar(256)"`
+	BuildDir         string `gorm:"column:build_dir;type:varchar(256)"`
+	BuildCmd         string `gorm:"column:build_cmd;type:text"`
+	BuildEnv         string `gorm:"column:build_env;type:varchar(256)"`
 	ProjectEnvItemID uint   `gorm:"column:project_env_item_id;type:integer;<-:create"`
 	GitRepoID        uint   `gorm:"column:git_repo_id;type:integer;<-:create"`
 	Error            error  `gorm:"-"`
@@ -141,21 +143,38 @@ type BuildConfig struct {
 
 type BuildInfo struct {
 	gorm.Model
-	BuildID          uint      `gorm:"column:build_id;type:integer;<-:create"`
-	BuildName        string    `gorm:"column:build_name;varchar(90)"`
+	BuildID          uint      `gorm:"column:build_id;type:integer;uniqueIndex:idx_build_info_number,priority:2;<-:create"`
+	BuildName        string    `gorm:"column:build_name;type:varchar(90)"`
 	BuildDate        time.Time `gorm:"column:build_date;type:datetime"`
 	BuildUserID      uint      `gorm:"column:build_user_id;type:integer;<-:create"`
-	BuildUserName    string    `gorm:"column:build_user_name;varchar(90)"`
-	BuildEnv         string    `gorm:"column:build_env;varchar(256)"`
-	ProjectEnvItemID uint      `gorm:"column:project_env_item_id;type:integer;<-:create"`
+	BuildUserName    string    `gorm:"column:build_user_name;type:varchar(90)"`
+	BuildEnv         string    `gorm:"column:build_env;type:varchar(256)"`
+	ProjectEnvItemID uint      `gorm:"column:project_env_item_id;type:integer;uniqueIndex:idx_build_info_number,priority:1;<-:create"`
 	GitRepoID        uint      `gorm:"column:git_repo_id;type:integer;<-:create"`
-	GitBranch        string    `grom:"column:git_branch;varchar(90)"`
+	GitBranch        string    `gorm:"column:git_branch;type:varchar(90)"`
 	CommitInfoID     uint      `gorm:"column:commit_info_id;type:integer;<-:create"`
 	BuildConfigID    uint      `gorm:"column:build_config_id;type:integer;<-:create"`
 	ArtifactID       uint      `gorm:"column:artifact_id;type:integer;<-:create"`
 	BuildState       string    `gorm:"column:build_state;type:varchar(30)"`
 }
 
+// 构建状态, 状态变为 success、failed 或 canceled 后构建结束
+const (
+	BuildStatePending  = "pending"
+	BuildStateRunning  = "running"
+	BuildStateSuccess  = "success"
+	BuildStateFailed   = "failed"
+	BuildStateCanceled = "canceled"
+)
+
+// BuildLog 构建输出的一行日志, 按 ID 顺序即为输出顺序
+type BuildLog struct {
+	ID          uint      `gorm:"column:id;primaryKey;autoIncrement"`
+	BuildInfoID uint      `gorm:"column:build_info_id;type:integer;not null;index;<-:create"`
+	Line        string    `gorm:"column:line;type:text;<-:create"`
+	CreatedAt   time.Time `gorm:"column:created_at;<-:create"`
+}
+
 func (Project) TableName() string {
 	return "cicd_project"
 }
@@ -204,6 +223,51 @@ func (BuildInfo) TableName() string {
 	return "cicd_build_info"
 }
 
+func (BuildLog) TableName() string {
+	return "cicd_build_log"
+}
+
+// Finished 构建是否已结束, 结束后不再有状态变化与新的日志
+func (b *BuildInfo) Finished() bool {
+	switch b.BuildState {
+	case BuildStateSuccess, BuildStateFailed, BuildStateCanceled:
+		return true
+	}
+	return false
+}
+
+// createBuildAttempts 并发登记同一应用环境的构建时, 编号冲突后重新分配的次数
+const createBuildAttempts = 5
+
+// CreateBuild 在事务中登记构建, BuildID 在同一 ProjectEnvItem 内递增;
+// 并发登记时依靠 (project_env_item_id, build_id) 的唯一索引发现编号冲突, 冲突后重新分配编号
+func CreateBuild(s Store, b *BuildInfo) error {
+	var err error
+	for i := 0; i < createBuildAttempts; i++ {
+		err = s.Transaction(func(tx Store) error {
+			max, err := tx.Builds().MaxBuildID(b.ProjectEnvItemID)
+			if err != nil {
+				return err
+			}
+			b.ID = 0
+			b.BuildID = max + 1
+			return tx.Builds().Create(b)
+		})
+		if !errors.Is(err, ErrDuplicated) {
+			return err
+		}
+	}
+	return fmt.Errorf("应用环境%d的构建编号冲突, 已重试%d次\n%w", b.ProjectEnvItemID, createBuildAttempts, err)
+}
+
+// EnvItemConfig 查询应用环境的构建配置, 未记录 BuildConfigID 时按 BuildConfig.ProjectEnvItemID 查找
+func EnvItemConfig(s Store, pei *ProjectEnvItem) (*BuildConfig, error) {
+	if pei.BuildConfigID != 0 {
+		return s.Builds().GetConfig(pei.BuildConfigID)
+	}
+	return s.Builds().FirstConfig(&BuildConfig{ProjectEnvItemID: pei.ID})
+}
+
 func (p *Project) name() {
 
 }
@@ -0,0 +1,60 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package model
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	DriverMySQL  string = "mysql"
+	DriverSQLite string = "sqlite"
+)
+
+// Open 按数据库类型建立连接
+func Open(driver string, dsn string, tablePrefix string) (*gorm.DB, error) {
+	switch driver {
+	case DriverMySQL:
+		return OpenMySQL(dsn, tablePrefix)
+	case DriverSQLite:
+		return OpenSQLite(dsn, tablePrefix)
+	default:
+		return nil, fmt.Errorf("不支持的数据库类型%s", driver)
+	}
+}
+
+// gormConfig 各数据库共用的 GORM 配置, 查询不到记录属于正常流程, 不输出日志
+func gormConfig(tablePrefix string) *gorm.Config {
+	return &gorm.Config{
+		NamingStrategy: schema.NamingStrategy{
+			TablePrefix:   tablePrefix,
+			SingularTable: true,
+		},
+		Logger: gormlogger.New(log.New(os.Stderr, "[GORM]: ", log.LstdFlags|log.Lmsgprefix), gormlogger.Config{
+			SlowThreshold:             time.Second,
+			LogLevel:                  gormlogger.Warn,
+			IgnoreRecordNotFoundError: true,
+		}),
+	}
+}
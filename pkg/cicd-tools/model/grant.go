@@ -0,0 +1,85 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RoleRequest 的状态, 只有 pending 状态的申请可以被批准或拒绝
+const (
+	RequestPending  string = "pending"
+	RequestApproved string = "approved"
+	RequestRejected string = "rejected"
+)
+
+// RoleGrantLog 记录的授权变更
+const (
+	GrantRequested string = "requested"
+	GrantApproved  string = "approved"
+	GrantRejected  string = "rejected"
+	GrantExpired   string = "expired"
+)
+
+// RoleRequest 用户申请在某个范围内临时获得角色, Duration 为批准后的有效时长 (秒), 为 0 时长期有效
+type RoleRequest struct {
+	gorm.Model
+	UserID       uint       `gorm:"column:user_id;type:integer;not null;index;<-:create"`
+	RoleID       uint       `gorm:"column:role_id;type:integer;not null;<-:create"`
+	ProjectID    uint       `gorm:"column:project_id;type:integer;not null;default:0;<-:create"`
+	ProjectEnvID uint       `gorm:"column:project_env_id;type:integer;not null;default:0;<-:create"`
+	Duration     int64      `gorm:"column:duration;type:bigint;not null;default:0;<-:create"`
+	Reason       string     `gorm:"column:reason;type:varchar(255)"`
+	Status       string     `gorm:"column:status;type:varchar(20);not null;default:pending;index"`
+	ApproverID   uint       `gorm:"column:approver_id;type:integer;not null;default:0"`
+	Comment      string     `gorm:"column:comment;type:varchar(255)"`
+	DecidedAt    *time.Time `gorm:"column:decided_at"`
+	UserRoleID   uint       `gorm:"column:user_role_id;type:integer;not null;default:0"`
+	Error        error      `gorm:"-"`
+}
+
+// RoleGrantLog 角色授权的变更记录, 只追加不修改
+// 用户绑定的 GroupID 为 0, 组绑定的 UserID 为 0, ActorID 为 0 表示由系统执行
+type RoleGrantLog struct {
+	gorm.Model
+	Action       string     `gorm:"column:action;type:varchar(20);not null;<-:create"`
+	RequestID    uint       `gorm:"column:request_id;type:integer;not null;default:0;index;<-:create"`
+	UserID       uint       `gorm:"column:user_id;type:integer;not null;default:0;index;<-:create"`
+	GroupID      uint       `gorm:"column:group_id;type:integer;not null;default:0;<-:create"`
+	RoleID       uint       `gorm:"column:role_id;type:integer;not null;<-:create"`
+	ProjectID    uint       `gorm:"column:project_id;type:integer;not null;default:0;<-:create"`
+	ProjectEnvID uint       `gorm:"column:project_env_id;type:integer;not null;default:0;<-:create"`
+	ActorID      uint       `gorm:"column:actor_id;type:integer;not null;default:0;<-:create"`
+	ExpiresAt    *time.Time `gorm:"column:expires_at;<-:create"`
+	Comment      string     `gorm:"column:comment;type:varchar(255);<-:create"`
+	Error        error      `gorm:"-"`
+}
+
+func (r *RoleRequest) IsPending() bool {
+	return r.Status == "" || r.Status == RequestPending
+}
+
+// Expired 判断绑定在 now 时是否已过期, 未设置过期时间的绑定永不过期
+func (ur *UserRole) Expired(now time.Time) bool {
+	return ur.ExpiresAt != nil && !ur.ExpiresAt.After(now)
+}
+
+func (gr *GroupRole) Expired(now time.Time) bool {
+	return gr.ExpiresAt != nil && !gr.ExpiresAt.After(now)
+}
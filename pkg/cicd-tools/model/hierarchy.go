@@ -0,0 +1,168 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package model
+
+import (
+	"fmt"
+)
+
+// RoleAncestors 返回角色直接或间接继承的全部角色, 按与该角色的距离由近到远排列
+func RoleAncestors(s Store, rid uint) ([]Role, error) {
+	return walkRoles(s, rid, s.Roles().Parents)
+}
+
+// RoleDescendants 返回直接或间接继承该角色的全部角色
+func RoleDescendants(s Store, rid uint) ([]Role, error) {
+	return walkRoles(s, rid, s.Roles().Children)
+}
+
+// walkRoles 广度优先遍历, 已访问的角色不再展开, 数据中存在环时也能结束
+func walkRoles(s Store, rid uint, next func(uint) ([]Role, error)) ([]Role, error) {
+	visited := map[uint]bool{rid: true}
+	queue := []uint{rid}
+	var result []Role
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		roles, err := next(current)
+		if err != nil {
+			return nil, err
+		}
+		for _, value := range roles {
+			if visited[value.ID] {
+				continue
+			}
+			visited[value.ID] = true
+			result = append(result, value)
+			queue = append(queue, value.ID)
+		}
+	}
+	return result, nil
+}
+
+// CheckRoleCycle 检查角色 rid 继承角色 pid 后是否会形成循环继承
+func CheckRoleCycle(s Store, rid uint, pid uint) error {
+	if rid == pid {
+		return fmt.Errorf("角色%d不能继承自身", rid)
+	}
+	ancestors, err := RoleAncestors(s, pid)
+	if err != nil {
+		return err
+	}
+	for _, value := range ancestors {
+		if value.ID == rid {
+			return fmt.Errorf("角色%d已经是角色%d的祖先角色, 继承后将形成循环", rid, pid)
+		}
+	}
+	return nil
+}
+
+// SetRoleParents 将角色的继承关系替换为 pids, 任一继承会形成循环时返回错误, 需在事务中调用以保证出错时整体回滚
+func SetRoleParents(s Store, rid uint, pids []uint) error {
+	current, err := s.Roles().Parents(rid)
+	if err != nil {
+		return err
+	}
+	keep := map[uint]bool{}
+	for _, pid := range pids {
+		keep[pid] = true
+	}
+	for _, value := range current {
+		if !keep[value.ID] {
+			if err := s.Roles().RemoveParent(rid, value.ID); err != nil {
+				return err
+			}
+		}
+	}
+	for _, pid := range pids {
+		if err := CheckRoleCycle(s, rid, pid); err != nil {
+			return err
+		}
+		if _, err := s.Roles().AddParent(rid, pid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteRole 删除角色及其用户与组的角色绑定、权限和继承关系, 避免删除后残留的绑定指向不存在的角色;
+// 调用方需先确认没有角色继承该角色, 并在事务中调用以保证出错时整体回滚
+func DeleteRole(s Store, rid uint) error {
+	users, err := s.Roles().Users(rid)
+	if err != nil {
+		return fmt.Errorf("查询绑定角色%d的用户失败\n%w", rid, err)
+	}
+	for _, u := range users {
+		bindings, err := s.Users().RoleBindings(u.ID)
+		if err != nil {
+			return fmt.Errorf("查询用户%s的角色绑定失败\n%w", u.Name, err)
+		}
+		for _, value := range bindings {
+			if value.RoleID != rid {
+				continue
+			}
+			if err := s.Users().RemoveRoleBinding(value.ID); err != nil {
+				return fmt.Errorf("用户%s解除角色绑定%d失败\n%w", u.Name, value.ID, err)
+			}
+		}
+	}
+	groups, err := s.Roles().Groups(rid)
+	if err != nil {
+		return fmt.Errorf("查询绑定角色%d的组失败\n%w", rid, err)
+	}
+	for _, g := range groups {
+		bindings, err := s.Groups().RoleBindings(g.ID)
+		if err != nil {
+			return fmt.Errorf("查询组%s的角色绑定失败\n%w", g.Name, err)
+		}
+		for _, value := range bindings {
+			if value.RoleID != rid {
+				continue
+			}
+			if err := s.Groups().RemoveRoleBinding(value.ID); err != nil {
+				return fmt.Errorf("组%s解除角色绑定%d失败\n%w", g.Name, value.ID, err)
+			}
+		}
+	}
+	permissions, err := s.Roles().Permissions(rid)
+	if err != nil {
+		return fmt.Errorf("查询角色%d的权限失败\n%w", rid, err)
+	}
+	for _, value := range permissions {
+		if err := s.Roles().RemovePermission(value.ID); err != nil {
+			return fmt.Errorf("删除角色%d的权限%s失败\n%w", rid, value.Name, err)
+		}
+	}
+	parents, err := s.Roles().Parents(rid)
+	if err != nil {
+		return fmt.Errorf("查询角色%d继承的角色失败\n%w", rid, err)
+	}
+	for _, value := range parents {
+		if err := s.Roles().RemoveParent(rid, value.ID); err != nil {
+			return fmt.Errorf("角色%d移除继承的角色%s失败\n%w", rid, value.Name, err)
+		}
+	}
+	return s.Roles().Delete(rid)
+}
+
+func roleIDs(roles []Role) []uint {
+	ids := make([]uint, 0, len(roles))
+	for _, value := range roles {
+		ids = append(ids, value.ID)
+	}
+	return ids
+}
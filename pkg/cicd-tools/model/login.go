@@ -0,0 +1,51 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 登录方式
+const (
+	LoginMethodPassword = "password"
+	LoginMethodOIDC     = "oidc"
+)
+
+// LoginHistory 登录记录, 用户不存在时 UserID 为 0, Username 为登录时输入的用户名; Reason 为失败原因
+type LoginHistory struct {
+	gorm.Model
+	UserID    uint   `gorm:"column:user_id;type:integer;not null;index;<-:create"`
+	Username  string `gorm:"column:user_name;type:varchar(60);not null;<-:create"`
+	Method    string `gorm:"column:method;type:varchar(20);not null;<-:create"`
+	Success   bool   `gorm:"column:success;not null;<-:create"`
+	Reason    string `gorm:"column:reason;type:varchar(255);<-:create"`
+	IP        string `gorm:"column:ip;type:varchar(64);<-:create"`
+	UserAgent string `gorm:"column:user_agent;type:varchar(255);<-:create"`
+	Error     error  `gorm:"-"`
+}
+
+// LoginQuery 登录记录的查询条件, 零值字段不参与过滤, Limit 为 0 时不限制数量
+type LoginQuery struct {
+	UserID   uint
+	Username string
+	Failed   bool
+	Since    time.Time
+	Limit    int
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Secret 需要还原使用的密钥 (如 TOTP 密钥), 格式化输出与序列化时只显示掩码
+type Secret string
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return maskedPassword
+}
+
+func (s Secret) GoString() string {
+	return fmt.Sprintf("%q", s.String())
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return []byte(`""`), nil
+}
+
+func (s Secret) MarshalYAML() (interface{}, error) {
+	return "", nil
+}
+
+// UserTOTP 用户的 TOTP 密钥, ConfirmedAt 为空表示已生成密钥但尚未用验证码确认, 此时不要求也不接受验证码;
+// LastStep 为最近一次使用的时间步, 同一时间步的验证码只能使用一次
+type UserTOTP struct {
+	gorm.Model
+	UserID      uint       `gorm:"column:user_id;type:integer;not null;uniqueIndex;<-:create"`
+	Secret      Secret     `gorm:"column:secret;type:varchar(64);not null" query:"-"`
+	ConfirmedAt *time.Time `gorm:"column:confirmed_at"`
+	LastStep    int64      `gorm:"column:last_step;not null;default:0"`
+	Error       error      `gorm:"-"`
+}
+
+// Confirmed 判断 TOTP 是否已启用
+func (t *UserTOTP) Confirmed() bool {
+	return t != nil && t.ConfirmedAt != nil
+}
+
+// RecoveryCode 一次性恢复码, 只保存 SHA-256 哈希, 用于无法使用 TOTP 设备时登录
+type RecoveryCode struct {
+	gorm.Model
+	UserID uint       `gorm:"column:user_id;type:integer;not null;index;<-:create"`
+	Hash   string     `gorm:"column:hash;type:varchar(64);not null;<-:create" json:"-" yaml:"-" query:"-"`
+	UsedAt *time.Time `gorm:"column:used_at"`
+	Error  error      `gorm:"-"`
+}
@@ -17,35 +17,25 @@
 package model
 
 import (
+	"fmt"
+
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
-	"gorm.io/gorm/schema"
-)
-
-const (
-	MySQLDSN    string = "root:123456@tcp(192.168.116.131:3306)/data100_rnd?charset=utf8mb4&parseTime=True&loc=Local"
-	TablePrefix string = "rnd_"
 )
 
-var (
-	db, _ = gorm.Open(mysql.Open(MySQLDSN), &gorm.Config{
-		NamingStrategy: schema.NamingStrategy{
-			TablePrefix:   TablePrefix,
-			SingularTable: true,
-		},
-	})
-)
+// OpenMySQL 建立数据库连接并检查连通性, 连接失败时返回错误而不是丢弃
+func OpenMySQL(dsn string, tablePrefix string) (*gorm.DB, error) {
+	conn, err := gorm.Open(mysql.Open(dsn), gormConfig(tablePrefix))
+	if err != nil {
+		return nil, fmt.Errorf("连接MySQL数据库失败\n%w", err)
+	}
 
-// func (m *MySQL) DB() *gorm.DB {
-//     db, err := gorm.Open(mysql.Open(MySQLDSN), &gorm.Config{
-//         NamingStrategy: schema.NamingStrategy{
-//             TablePrefix:   TablePrefix,
-//             SingularTable: true,
-//         },
-//     })
-//
-//     if err != nil {
-//         fmt.Println(err)
-//     }
-//     return db
-// }
+	sqlDB, err := conn.DB()
+	if err != nil {
+		return nil, fmt.Errorf("获取MySQL数据库连接失败\n%w", err)
+	}
+	if err := sqlDB.Ping(); err != nil {
+		return nil, fmt.Errorf("MySQL数据库无法访问\n%w", err)
+	}
+	return conn, nil
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"devops/cicd-tools/pkg/cicd-tools/auth/password"
+)
+
+var (
+	passwordPolicy = password.DefaultPolicy()
+	passwordParams = password.DefaultParams()
+)
+
+// PasswordHash 密码哈希, 格式化输出与序列化时只显示掩码, 避免哈希出现在日志或导出数据中
+type PasswordHash string
+
+const maskedPassword = "******"
+
+func (h PasswordHash) String() string {
+	if h == "" {
+		return ""
+	}
+	return maskedPassword
+}
+
+func (h PasswordHash) GoString() string {
+	return fmt.Sprintf("%q", h.String())
+}
+
+func (h PasswordHash) MarshalJSON() ([]byte, error) {
+	return []byte(`""`), nil
+}
+
+func (h PasswordHash) MarshalYAML() (interface{}, error) {
+	return "", nil
+}
+
+// PasswordHistory 用户设置过的密码哈希, 用于禁止重复使用最近的密码
+type PasswordHistory struct {
+	gorm.Model
+	UserID uint         `gorm:"column:user_id;type:integer;not null;index;<-:create"`
+	Hash   PasswordHash `gorm:"column:hash;type:varchar(128);not null;<-:create"`
+	Error  error        `gorm:"-"`
+}
+
+// SetPasswordPolicy 设置 SetPassword 使用的密码策略与哈希参数
+func SetPasswordPolicy(policy password.Policy, params password.Params) {
+	passwordPolicy = policy
+	passwordParams = params
+}
+
+// SetPassword 校验密码策略后保存 argon2id 哈希, 新密码不能与最近 History 次设置过的密码相同;
+// 设置后用户之前签发的令牌与个人访问令牌全部失效
+func (u *User) SetPassword(plain string) *User {
+	if u.ID == 0 {
+		u.Error = fmt.Errorf("用户%s未创建, 不能设置密码", u.Name)
+		return u
+	}
+	if err := passwordPolicy.Validate(plain); err != nil {
+		u.Error = err
+		return u
+	}
+	if err := u.checkHistory(plain); err != nil {
+		u.Error = err
+		return u
+	}
+	hash, err := password.Hash(plain, passwordParams)
+	if err != nil {
+		u.Error = err
+		return u
+	}
+	err = store.Transaction(func(s Store) error {
+		if err := s.Users().UpdatePassword(u.ID, PasswordHash(hash)); err != nil {
+			return err
+		}
+		if err := s.Users().AddPasswordHistory(&PasswordHistory{UserID: u.ID, Hash: PasswordHash(hash)}); err != nil {
+			return err
+		}
+		if err := s.Users().IncrementTokenVersion(u.ID); err != nil {
+			return err
+		}
+		return s.Tokens().RevokePersonalByUser(u.ID, time.Now())
+	})
+	if err != nil {
+		u.Error = fmt.Errorf("用户%s设置密码失败\n%w", u.Name, err)
+		return u
+	}
+	u.Password = PasswordHash(hash)
+	u.TokenVersion++
+	return u
+}
+
+func (u *User) checkHistory(plain string) error {
+	if passwordPolicy.History <= 0 {
+		return nil
+	}
+	history, err := store.Users().PasswordHistory(u.ID, passwordPolicy.History)
+	if err != nil {
+		return fmt.Errorf("查询用户%s的历史密码失败\n%w", u.Name, err)
+	}
+	hashes := []PasswordHash{u.Password}
+	for _, value := range history {
+		hashes = append(hashes, value.Hash)
+	}
+	for _, value := range hashes {
+		if value == "" {
+			continue
+		}
+		if ok, _ := password.Verify(plain, string(value)); ok {
+			return fmt.Errorf("新密码不能与最近%d次使用过的密码相同", passwordPolicy.History)
+		}
+	}
+	return nil
+}
+
+// HashDummyPassword 按当前参数计算一次哈希并丢弃, 用户不存在时调用, 使响应时间与密码错误时相近
+func HashDummyPassword(plain string) {
+	_, _ = password.Hash(plain, passwordParams)
+}
+
+// VerifyPassword 校验密码, 成功且哈希格式或参数落后于当前配置时重新计算并保存哈希
+func (u *User) VerifyPassword(plain string) bool {
+	if u.Password == "" {
+		u.Error = errors.New("用户未设置密码")
+		return false
+	}
+	ok, err := password.Verify(plain, string(u.Password))
+	if err != nil {
+		u.Error = fmt.Errorf("用户%s的密码哈希无效\n%w", u.Name, err)
+		return false
+	}
+	if !ok {
+		return false
+	}
+	if password.NeedsRehash(string(u.Password), passwordParams) {
+		hash, err := password.Hash(plain, passwordParams)
+		if err == nil {
+			err = store.Users().UpdatePassword(u.ID, PasswordHash(hash))
+		}
+		if err != nil {
+			u.Error = fmt.Errorf("用户%s升级密码哈希失败\n%w", u.Name, err)
+		} else {
+			u.Password = PasswordHash(hash)
+		}
+	}
+	return true
+}
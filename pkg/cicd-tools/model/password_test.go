@@ -0,0 +1,75 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package model_test
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"devops/cicd-tools/pkg/cicd-tools/auth/password"
+	"devops/cicd-tools/pkg/cicd-tools/model"
+	"devops/cicd-tools/pkg/cicd-tools/store/memstore"
+)
+
+func TestVerifyPasswordRehash(t *testing.T) {
+	s := memstore.New()
+	model.SetStore(s)
+	params := password.Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	model.SetPasswordPolicy(password.DefaultPolicy(), params)
+
+	legacy, err := bcrypt.GenerateFromPassword([]byte("hello1234"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := &model.User{Name: "alice", Email: "alice@example.org", Password: model.PasswordHash(legacy)}
+	if err := s.Users().Create(u); err != nil {
+		t.Fatal(err)
+	}
+	if u.VerifyPassword("wrong") {
+		t.Fatal("wrong password accepted")
+	}
+	if string(u.Password) != string(legacy) {
+		t.Fatal("hash changed after failed verification")
+	}
+	if !u.VerifyPassword("hello1234") || u.Error != nil {
+		t.Fatalf("legacy password rejected: %v", u.Error)
+	}
+	stored, err := s.Users().Get(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(stored.Password), "$argon2id$") || stored.Password != u.Password {
+		t.Fatalf("hash not upgraded: %s", stored.Password)
+	}
+
+	// 调整参数后在下次登录时按新参数重新计算
+	upgraded := params
+	upgraded.Iterations = 2
+	model.SetPasswordPolicy(password.DefaultPolicy(), upgraded)
+	before := stored.Password
+	if !stored.VerifyPassword("hello1234") {
+		t.Fatal("argon2id password rejected")
+	}
+	if stored.Password == before || password.NeedsRehash(string(stored.Password), upgraded) {
+		t.Fatalf("hash not upgraded to new params: %s", stored.Password)
+	}
+	if !stored.VerifyPassword("hello1234") {
+		t.Fatal("upgraded password rejected")
+	}
+}
@@ -0,0 +1,442 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package model
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm/schema"
+)
+
+// 筛选条件的比较方式, OpContains 只用于字符串字段, 不区分大小写
+const (
+	OpEq       = "="
+	OpNe       = "!="
+	OpGt       = ">"
+	OpGe       = ">="
+	OpLt       = "<"
+	OpLe       = "<="
+	OpContains = "~"
+)
+
+// ErrInvalidQuery 查询条件中的字段、取值或游标无效
+var ErrInvalidQuery = errors.New("查询条件无效")
+
+// Query 列表查询的筛选、排序与分页条件, 字段为数据表的列名, 带 query:"-" 标签的字段不能使用;
+// 排序最后总是按 id 升序, 保证分页结果稳定; Limit 为 0 时不限制数量;
+// Cursor 为上一页返回的 Page.Next, 不能与 Offset 同时使用, 翻页时筛选与排序条件需保持不变
+type Query struct {
+	Filters []Filter
+	Sort    []Sort
+	Limit   int
+	Offset  int
+	Cursor  string
+	Via     *Via
+}
+
+// Via 只查询通过关联表与指定记录关联的记录, 如用户所在的组为 Via{Cond: &UserGroup{UserID: uid}, Column: "group_id"};
+// Cond 为关联表模型的指针, 其非零字段作为条件, Column 为关联表中指向被查询记录 id 的列
+type Via struct {
+	Cond   interface{}
+	Column string
+}
+
+// GroupsOfUser 用户所在的组, 与 UsersOfGroup、UsersOfRole、GroupsOfRole 一样用于 Query.Via
+func GroupsOfUser(uid uint) *Via {
+	return &Via{Cond: &UserGroup{UserID: uid}, Column: "group_id"}
+}
+
+func UsersOfGroup(gid uint) *Via {
+	return &Via{Cond: &UserGroup{GroupID: gid}, Column: "user_id"}
+}
+
+// UsersOfRole 与 GroupsOfRole 包括任意范围内直接绑定该角色的用户或组, 不包括继承
+func UsersOfRole(rid uint) *Via {
+	return &Via{Cond: &UserRole{RoleID: rid}, Column: "user_id"}
+}
+
+func GroupsOfRole(rid uint) *Via {
+	return &Via{Cond: &GroupRole{RoleID: rid}, Column: "group_id"}
+}
+
+type Filter struct {
+	Field string
+	Op    string
+	Value string
+}
+
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// Page 列表查询的分页信息, Total 为满足全部条件的记录总数, 不受分页影响; Next 为下一页的游标, 没有下一页时为空
+type Page struct {
+	Total int64
+	Next  string
+}
+
+// filterOps 两个字符的比较方式在前, 解析时优先匹配
+var filterOps = []string{OpNe, OpGe, OpLe, OpEq, OpGt, OpLt, OpContains}
+
+// ParseFilter 解析 字段、比较方式与取值相连的筛选条件, 如 name~web、created_at>=2024-01-01
+func ParseFilter(s string) (Filter, error) {
+	i := 0
+	for i < len(s) && (s[i] == '_' || 'a' <= s[i] && s[i] <= 'z' || '0' <= s[i] && s[i] <= '9') {
+		i++
+	}
+	for _, op := range filterOps {
+		if i > 0 && strings.HasPrefix(s[i:], op) {
+			return Filter{Field: s[:i], Op: op, Value: s[i+len(op):]}, nil
+		}
+	}
+	return Filter{}, fmt.Errorf("筛选条件%s格式错误, 应为字段、比较方式 (%s) 与取值, 如name~web\n%w",
+		s, strings.Join(filterOps, " "), ErrInvalidQuery)
+}
+
+// ParseSort 解析以逗号分隔的排序字段, 以 - 开头时倒序, 如 -created_at,name
+func ParseSort(s string) []Sort {
+	var sorts []Sort
+	for _, value := range strings.Split(s, ",") {
+		value = strings.TrimSpace(value)
+		switch {
+		case value == "":
+		case strings.HasPrefix(value, "-"):
+			sorts = append(sorts, Sort{Field: value[1:], Desc: true})
+		default:
+			sorts = append(sorts, Sort{Field: value})
+		}
+	}
+	return sorts
+}
+
+// QueryPlan 按模型解析后的查询条件, 供存储实现使用, 字段已校验
+//
+// Sort 的最后一项总是 id, After 为游标中对应 Sort 各字段的取值, 为空表示从第一条开始;
+// 存储实现在 Limit 大于 0 时多查询一条记录, 再由 Page 判断是否有下一页
+type QueryPlan struct {
+	Filters []PlanFilter
+	Sort    []PlanSort
+	After   []interface{}
+	Limit   int
+	Offset  int
+	Via     *PlanVia
+}
+
+// PlanVia 的 Index 为 Column 在关联表模型中的字段位置
+type PlanVia struct {
+	Cond   interface{}
+	Column string
+	Index  []int
+}
+
+// PlanFilter 的 Value 为 OpContains 时是原始字符串, 其余为字段类型的值
+type PlanFilter struct {
+	Column string
+	Index  []int
+	Op     string
+	Value  interface{}
+}
+
+type PlanSort struct {
+	Column string
+	Index  []int
+	Desc   bool
+}
+
+// Plan 按 v (模型结构体的指针) 的字段解析查询条件, q 为 nil 时只按 id 排序
+func (q *Query) Plan(v interface{}) (*QueryPlan, error) {
+	if q == nil {
+		q = new(Query)
+	}
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	columns := columnsOf(t)
+	if q.Limit < 0 || q.Offset < 0 {
+		return nil, fmt.Errorf("limit与offset不能小于0\n%w", ErrInvalidQuery)
+	}
+	if q.Cursor != "" && q.Offset > 0 {
+		return nil, fmt.Errorf("cursor与offset不能同时使用\n%w", ErrInvalidQuery)
+	}
+	p := &QueryPlan{Limit: q.Limit, Offset: q.Offset}
+	if q.Via != nil {
+		c, err := columnsOf(reflect.Indirect(reflect.ValueOf(q.Via.Cond)).Type()).lookup(q.Via.Column, "关联")
+		if err != nil {
+			return nil, err
+		}
+		p.Via = &PlanVia{Cond: q.Via.Cond, Column: q.Via.Column, Index: c.index}
+	}
+	for _, f := range q.Filters {
+		c, err := columns.lookup(f.Field, "筛选")
+		if err != nil {
+			return nil, err
+		}
+		typ := c.typ
+		if typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+		if f.Op == OpContains && typ.Kind() != reflect.String {
+			return nil, fmt.Errorf("字段%s不是字符串, 不能使用%s\n%w", f.Field, OpContains, ErrInvalidQuery)
+		}
+		if !validOp(f.Op) {
+			return nil, fmt.Errorf("不支持比较方式%s\n%w", f.Op, ErrInvalidQuery)
+		}
+		var value interface{} = f.Value
+		if f.Op != OpContains {
+			if value, err = parseValue(typ, f.Value); err != nil {
+				return nil, fmt.Errorf("字段%s的取值%s无效\n%w", f.Field, f.Value, ErrInvalidQuery)
+			}
+		}
+		p.Filters = append(p.Filters, PlanFilter{Column: f.Field, Index: c.index, Op: f.Op, Value: value})
+	}
+	sorted := make(map[string]bool)
+	for _, s := range append(append([]Sort{}, q.Sort...), Sort{Field: "id"}) {
+		if sorted[s.Field] {
+			continue
+		}
+		c, err := columns.lookup(s.Field, "排序")
+		if err != nil {
+			return nil, err
+		}
+		if c.typ.Kind() == reflect.Ptr {
+			return nil, fmt.Errorf("字段%s可以为空, 不能用于排序\n%w", s.Field, ErrInvalidQuery)
+		}
+		sorted[s.Field] = true
+		p.Sort = append(p.Sort, PlanSort{Column: s.Field, Index: c.index, Desc: s.Desc})
+	}
+	if q.Cursor != "" {
+		after, err := p.decodeCursor(columns, q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		p.After = after
+	}
+	return p, nil
+}
+
+// Page out 为存储实现查询到的记录 (模型切片的指针), 多出 Limit 的记录被去掉, 并以最后一条生成下一页的游标
+func (p *QueryPlan) Page(out interface{}, total int64) (*Page, error) {
+	page := &Page{Total: total}
+	rows := reflect.ValueOf(out).Elem()
+	if p.Limit == 0 || rows.Len() <= p.Limit {
+		return page, nil
+	}
+	rows.Set(rows.Slice(0, p.Limit))
+	last := rows.Index(p.Limit - 1)
+	cursor := cursor{Sort: p.sortSpec()}
+	for _, s := range p.Sort {
+		cursor.Values = append(cursor.Values, last.FieldByIndex(s.Index).Interface())
+	}
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return nil, err
+	}
+	page.Next = base64.RawURLEncoding.EncodeToString(data)
+	return page, nil
+}
+
+// cursor 记录上一页最后一条记录的排序字段取值, Sort 用于确认翻页时排序条件未变
+type cursor struct {
+	Sort   string        `json:"s"`
+	Values []interface{} `json:"v"`
+}
+
+func (p *QueryPlan) sortSpec() string {
+	fields := make([]string, 0, len(p.Sort))
+	for _, s := range p.Sort {
+		if s.Desc {
+			fields = append(fields, "-"+s.Column)
+		} else {
+			fields = append(fields, s.Column)
+		}
+	}
+	return strings.Join(fields, ",")
+}
+
+func (p *QueryPlan) decodeCursor(columns columns, value string) ([]interface{}, error) {
+	invalid := fmt.Errorf("游标%s无效\n%w", value, ErrInvalidQuery)
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, invalid
+	}
+	var raw struct {
+		Sort   string            `json:"s"`
+		Values []json.RawMessage `json:"v"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil || len(raw.Values) != len(p.Sort) {
+		return nil, invalid
+	}
+	if raw.Sort != p.sortSpec() {
+		return nil, fmt.Errorf("游标对应的排序条件为%s, 与当前的排序条件不同\n%w", raw.Sort, ErrInvalidQuery)
+	}
+	after := make([]interface{}, 0, len(p.Sort))
+	for i, s := range p.Sort {
+		v := reflect.New(columns[s.Column].typ)
+		if err := json.Unmarshal(raw.Values[i], v.Interface()); err != nil {
+			return nil, invalid
+		}
+		after = append(after, v.Elem().Interface())
+	}
+	return after, nil
+}
+
+func validOp(op string) bool {
+	for _, value := range filterOps {
+		if op == value {
+			return true
+		}
+	}
+	return false
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// timeLayouts 筛选时间字段时支持的格式, 不带时区的按本地时间解析
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02"}
+
+// parseValue 将筛选条件的取值转换为 t 类型
+func parseValue(t reflect.Type, s string) (interface{}, error) {
+	v := reflect.New(t).Elem()
+	switch {
+	case t == timeType:
+		for _, layout := range timeLayouts {
+			if value, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+				return value, nil
+			}
+		}
+		return nil, fmt.Errorf("时间%s格式错误", s)
+	case t.Kind() == reflect.String:
+		v.SetString(s)
+	case t.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, err
+		}
+		v.SetBool(b)
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, t.Bits())
+		if err != nil {
+			return nil, err
+		}
+		v.SetInt(n)
+	case t.Kind() >= reflect.Uint && t.Kind() <= reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, t.Bits())
+		if err != nil {
+			return nil, err
+		}
+		v.SetUint(n)
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		n, err := strconv.ParseFloat(s, t.Bits())
+		if err != nil {
+			return nil, err
+		}
+		v.SetFloat(n)
+	default:
+		return nil, fmt.Errorf("不支持%s类型的字段", t)
+	}
+	return v.Interface(), nil
+}
+
+type column struct {
+	index []int
+	typ   reflect.Type
+}
+
+// columns 模型可用于查询的列, 键为列名
+type columns map[string]column
+
+func (c columns) lookup(name string, usage string) (column, error) {
+	if value, ok := c[name]; ok {
+		return value, nil
+	}
+	names := make([]string, 0, len(c))
+	for key := range c {
+		names = append(names, key)
+	}
+	sort.Strings(names)
+	return column{}, fmt.Errorf("不支持按%s%s, 可用的字段: %s\n%w", name, usage, strings.Join(names, ", "), ErrInvalidQuery)
+}
+
+var (
+	columnCache sync.Map
+	columnNamer = schema.NamingStrategy{}
+)
+
+// columnsOf 按 gorm 标签中的 column 或 gorm 的默认规则确定列名, 包括嵌入的 gorm.Model,
+// 只包括字符串、数值、布尔与时间类型的字段
+func columnsOf(t reflect.Type) columns {
+	if value, ok := columnCache.Load(t); ok {
+		return value.(columns)
+	}
+	c := make(columns)
+	collectColumns(t, nil, c)
+	columnCache.Store(t, c)
+	return c
+}
+
+func collectColumns(t reflect.Type, index []int, c columns) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		idx := append(append([]int{}, index...), i)
+		tag := f.Tag.Get("gorm")
+		if f.PkgPath != "" || tag == "-" || f.Tag.Get("query") == "-" {
+			continue
+		}
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			collectColumns(f.Type, idx, c)
+			continue
+		}
+		if !queryable(f.Type) {
+			continue
+		}
+		name := ""
+		for _, value := range strings.Split(tag, ";") {
+			if strings.HasPrefix(value, "column:") {
+				name = strings.TrimPrefix(value, "column:")
+			}
+		}
+		if name == "" {
+			name = columnNamer.ColumnName("", f.Name)
+		}
+		c[name] = column{index: idx, typ: f.Type}
+	}
+}
+
+func queryable(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return t == timeType
+}
@@ -21,33 +21,47 @@ import (
 	"fmt"
 	"gorm.io/gorm"
 	"strconv"
+	"time"
 )
 
+// User 的 ServiceAccount 为 true 时为服务账号, 不能使用密码登录, 只能使用个人访问令牌
+// Source 为用户来源, 本地创建的用户为空, 外部目录同步的用户 ExternalID 为其在目录中的标识 (如 LDAP DN)
+// Disabled 为 true 时所有认证方式均被拒绝; FailedLogins 为连续登录失败次数, 达到上限后锁定到 LockedUntil
+// TokenVersion 写入签发的令牌, 修改密码时递增, 使之前签发的令牌全部失效
 type User struct {
 	gorm.Model
-	Name        string        `gorm:"column:user_name;type:varchar(30);not null"`
-	FullName    string        `gorm:"column:full_name;type:varchar(30)"`
-	Gender      string        `gorm:"column:gender;type:varchar(10)"`
-	Age         uint          `gorm:"column:age;type:integer"`
-	Location    string        `gorm:"column:location;type:varchar(255)"`
-	Job         string        `gorm:"column:job;type:varchar(30)"`
-	Password    string        `gorm:"column:password;type:varchar(128)"`
-	Email       string        `gorm:"column:email_address;type:varchar(90);unique;not null"`
-	Mobile      string        `gorm:"column:mobile;type:varchar(30)"`
-	DingTalkID  string        `gorm:"column:dingtalk_id;type:varchar(30)"`
-	WXWorkID    string        `gorm:"column:wxwork_id;type:varchar(30)"`
-	Groups      *[]Group      `gorm:"-"`
-	Roles       *[]Role       `gorm:"-"`
-	Permissions *[]Permission `gorm:"-"`
-	UserGroup   *UserGroup    `gorm:"-"`
-	UserRole    *UserRole     `gorm:"-"`
-	Error       error         `gorm:"-"`
-}
-
+	Name           string        `gorm:"column:user_name;type:varchar(30);not null"`
+	FullName       string        `gorm:"column:full_name;type:varchar(30)"`
+	Gender         string        `gorm:"column:gender;type:varchar(10)"`
+	Age            uint          `gorm:"column:age;type:integer"`
+	Location       string        `gorm:"column:location;type:varchar(255)"`
+	Job            string        `gorm:"column:job;type:varchar(30)"`
+	Password       PasswordHash  `gorm:"column:password;type:varchar(128)" json:"-" yaml:"-" query:"-"`
+	Email          string        `gorm:"column:email_address;type:varchar(90);unique;not null"`
+	Mobile         string        `gorm:"column:mobile;type:varchar(30)"`
+	DingTalkID     string        `gorm:"column:dingtalk_id;type:varchar(30)"`
+	WXWorkID       string        `gorm:"column:wxwork_id;type:varchar(30)"`
+	ServiceAccount bool          `gorm:"column:service_account;not null;default:false"`
+	Source         string        `gorm:"column:source;type:varchar(20);not null;default:''"`
+	ExternalID     string        `gorm:"column:external_id;type:varchar(255);index"`
+	Disabled       bool          `gorm:"column:disabled;not null;default:false"`
+	FailedLogins   int           `gorm:"column:failed_logins;not null;default:0"`
+	LockedUntil    *time.Time    `gorm:"column:locked_until"`
+	TokenVersion   int           `gorm:"column:token_version;not null;default:0" json:"-" yaml:"-" query:"-"`
+	Groups         *[]Group      `gorm:"-"`
+	Roles          *[]Role       `gorm:"-"`
+	Permissions    *[]Permission `gorm:"-"`
+	UserGroup      *UserGroup    `gorm:"-"`
+	UserRole       *UserRole     `gorm:"-"`
+	Error          error         `gorm:"-"`
+}
+
+// Group 的 Source 不为空时成员关系由外部目录维护, 同步时会移除目录中已不存在的成员
 type Group struct {
 	gorm.Model
 	Name        string        `gorm:"column:group_name;type:varchar(60);unique;not null"`
 	Intro       string        `gorm:"column:intro;type:varchar(128)"`
+	Source      string        `gorm:"column:source;type:varchar(20);not null;default:''"`
 	Users       *[]User       `gorm:"-"`
 	Roles       *[]Role       `gorm:"-"`
 	Permissions *[]Permission `gorm:"-"`
@@ -63,17 +77,40 @@ type Role struct {
 	Users       *[]User       `gorm:"-"`
 	Groups      *[]Group      `gorm:"-"`
 	Permissions *[]Permission `gorm:"-"`
+	Parents     *[]Role       `gorm:"-"`
 	UserRole    *UserRole     `gorm:"-"`
 	GroupRole   *GroupRole    `gorm:"-"`
 	Error       error         `gorm:"-"`
 }
 
+// User 与 Group 的 Source 取值
+const (
+	SourceLocal string = ""
+	SourceLDAP  string = "ldap"
+	SourceOIDC  string = "oidc"
+)
+
+// Permission 的 Effect 取值, 为空时按 EffectAllow 处理, 其它取值按 EffectDeny 处理
+const (
+	EffectAllow string = "allow"
+	EffectDeny  string = "deny"
+)
+
+// CheckEffect 创建权限前校验 Effect, 空值视为 EffectAllow
+func CheckEffect(effect string) error {
+	if effect != "" && effect != EffectAllow && effect != EffectDeny {
+		return fmt.Errorf("权限效果%s无效, 可选%s和%s", effect, EffectAllow, EffectDeny)
+	}
+	return nil
+}
+
 type Permission struct {
 	gorm.Model
 	Name       string `gorm:"column:permission;type:varchar(60);not null"`
 	ResourceID uint   `gorm:"column:resource_id;type:integer;not null;<-:create"`
 	Category   string `gorm:"column:category;type:varchar(128);not null"`
 	Action     string `gorm:"column:action;type:varchar(60);not null"`
+	Effect     string `gorm:"column:effect;type:varchar(10);not null;default:allow"`
 	RoleID     uint   `gorm:"column:role_id;type:integer;not null;<-:create"`
 	Error      error  `gorm:"-"`
 }
@@ -85,47 +122,72 @@ type UserGroup struct {
 	Error   error `gorm:"-"`
 }
 
+// UserRole 与 GroupRole 的 ProjectID 为 0 时全局生效, 否则只在该项目内生效,
+// ProjectEnvID 不为 0 时进一步限定为项目关联的某个环境 (ProjectEnv),
+// ExpiresAt 为空时长期有效, 否则到期后不再生效并由定时任务清理
 type UserRole struct {
 	gorm.Model
-	UserID uint  `gorm:"column:user_id;type:integer;<-:create"`
-	RoleID uint  `gorm:"column:role_id;type:integer;<-:create"`
-	Error  error `gorm:"-"`
+	UserID       uint       `gorm:"column:user_id;type:integer;<-:create"`
+	RoleID       uint       `gorm:"column:role_id;type:integer;<-:create"`
+	ProjectID    uint       `gorm:"column:project_id;type:integer;not null;default:0;<-:create"`
+	ProjectEnvID uint       `gorm:"column:project_env_id;type:integer;not null;default:0;<-:create"`
+	ExpiresAt    *time.Time `gorm:"column:expires_at;index"`
+	Error        error      `gorm:"-"`
 }
 
 type GroupRole struct {
 	gorm.Model
-	GroupID uint  `gorm:"column:group_id;type:integer;<-:create"`
-	RoleID  uint  `gorm:"column:group_id;type:integer;<-:create"`
-	Error   error `gorm:"-"`
+	GroupID      uint       `gorm:"column:group_id;type:integer;<-:create"`
+	RoleID       uint       `gorm:"column:role_id;type:integer;<-:create"`
+	ProjectID    uint       `gorm:"column:project_id;type:integer;not null;default:0;<-:create"`
+	ProjectEnvID uint       `gorm:"column:project_env_id;type:integer;not null;default:0;<-:create"`
+	ExpiresAt    *time.Time `gorm:"column:expires_at;index"`
+	Error        error      `gorm:"-"`
+}
+
+// RoleParent 角色继承关系, RoleID 对应的角色拥有 ParentID 对应角色的全部权限
+type RoleParent struct {
+	gorm.Model
+	RoleID   uint  `gorm:"column:role_id;type:integer;<-:create"`
+	ParentID uint  `gorm:"column:parent_id;type:integer;<-:create"`
+	Error    error `gorm:"-"`
 }
 
 func (u *User) Exists() bool {
-	if result := db.Where(u).First(u); errors.Is(result.Error, gorm.ErrRecordNotFound) {
-		u.Error = gorm.ErrRecordNotFound
+	users, err := store.Users().Find(u)
+	if err != nil {
+		u.Error = err
+		return false
+	} else if len(users) == 0 {
+		u.Error = ErrNotFound
 		return false
-	} else if result.RowsAffected > 1 {
+	} else if len(users) > 1 {
 		u.Error = errors.New("查询到存在重复用户, 需添加额外字段")
 		return false
 	}
+	*u = users[0]
 	return true
 }
 
 func (u *User) Find() *User {
-	if result := db.Where(u).First(u); errors.Is(result.Error, gorm.ErrRecordNotFound) {
-		u.Error = gorm.ErrRecordNotFound
+	found, err := store.Users().First(u)
+	if err != nil {
+		u.Error = err
+		return u
 	}
+	*u = *found
 	return u
 }
 
 func (u *User) Create() *User {
-	if err := db.Where(u).FirstOrCreate(u).Error; err != nil {
+	if err := store.Users().FirstOrCreate(u); err != nil {
 		u.Error = fmt.Errorf("创建用户%s失败\n%w", u.Name, err)
 	}
 	return u
 }
 
 func (u *User) Update() *User {
-	if err := db.Save(u).Error; err != nil {
+	if err := store.Users().Save(u); err != nil {
 		u.Error = fmt.Errorf("用户%v数据更新失败\n%w", u.Name, err)
 	}
 	return u
@@ -136,28 +198,70 @@ func (u *User) AddGroups(names ...string) {
 		g := new(Group)
 		g.Name = value
 		if g.Exists() {
-			err := u.UserGroup.AddRow(u.ID, g.ID)
+			ug, err := store.Users().AddGroup(u.ID, g.ID)
 			if err != nil {
 				u.Error = fmt.Errorf("用户%s添加到组%s时发生错误\n%w", u.Name, g.Name, err)
 				return
 			}
+			u.UserGroup = ug
 		}
 	}
 }
 
+func (u *User) AddRoles(names ...string) *User {
+	return u.AddScopedRoles(Scope{}, names...)
+}
+
+// AddScopedRoles 绑定只在 scope 范围内生效的角色
+func (u *User) AddScopedRoles(scope Scope, names ...string) *User {
+	return u.addRoles(scope, nil, names...)
+}
+
+// AddTemporaryRoles 绑定在 expiresAt 之前有效的角色, 已存在的绑定会更新过期时间
+func (u *User) AddTemporaryRoles(scope Scope, expiresAt time.Time, names ...string) *User {
+	return u.addRoles(scope, &expiresAt, names...)
+}
+
+func (u *User) addRoles(scope Scope, expiresAt *time.Time, names ...string) *User {
+	projectID, projectEnvID, err := ResolveScope(store, scope)
+	if err != nil {
+		u.Error = fmt.Errorf("用户%s绑定角色失败\n%w", u.Name, err)
+		return u
+	}
+	for _, value := range names {
+		r := new(Role)
+		r.Name = value
+		if !r.Exists() {
+			u.Error = fmt.Errorf("用户%s绑定的角色%s不存在\n%w", u.Name, value, r.Error)
+			return u
+		}
+		ur := &UserRole{UserID: u.ID, RoleID: r.ID, ProjectID: projectID, ProjectEnvID: projectEnvID, ExpiresAt: expiresAt}
+		if err := store.Users().AddRoleBinding(ur); err != nil {
+			u.Error = fmt.Errorf("用户%s绑定角色%s时发生错误\n%w", u.Name, value, err)
+			return u
+		}
+		u.UserRole = ur
+	}
+	return u
+}
+
 func (u *User) GetGroups() *User {
-	u.Groups = u.UserGroup.GetGroups(u.ID)
-	if u.UserGroup.Error != nil {
-		u.Error = fmt.Errorf("用户%s查询组时发生错误\n%w", u.Name, u.UserGroup.Error)
+	groups, err := store.Users().Groups(u.ID)
+	if err != nil {
+		u.Error = fmt.Errorf("用户%s查询组时发生错误\n%w", u.Name, err)
+		return u
 	}
+	u.Groups = &groups
 	return u
 }
 
 func (u *User) GetRoles() *User {
-	u.Roles = u.UserRole.GetRoles(u.ID)
-	if u.UserRole.Error != nil {
-		u.Error = fmt.Errorf("用户%s查询角色时发生错误\n%w", u.Name, u.UserRole.Error)
+	roles, err := store.Users().Roles(u.ID)
+	if err != nil {
+		u.Error = fmt.Errorf("用户%s查询角色时发生错误\n%w", u.Name, err)
+		return u
 	}
+	u.Roles = &roles
 	return u
 }
 
@@ -173,52 +277,61 @@ func (u *User) Printf() {
 	手机号: %v
 	钉钉: %v
 	企业微信: %v
+	服务账号: %v
+	已停用: %v
 `, u.Name, u.FullName, u.Gender, u.Age,
 		u.Location, u.Job, u.Email, u.Mobile,
-		u.DingTalkID, u.WXWorkID,
+		u.DingTalkID, u.WXWorkID, u.ServiceAccount, u.Disabled,
 	)
 }
 
 func (u *User) Map() map[string]string {
 	m := map[string]string{
-		"user_name":   u.Name,
-		"full_name":   u.FullName,
-		"gender":      u.Gender,
-		"age":         strconv.FormatUint(uint64(u.Age), 10),
-		"location":    u.Location,
-		"job":         u.Job,
-		"email":       u.Email,
-		"mobile":      u.Mobile,
-		"dingtalk_id": u.DingTalkID,
-		"wxwork_id":   u.WXWorkID,
+		"user_name":       u.Name,
+		"full_name":       u.FullName,
+		"gender":          u.Gender,
+		"age":             strconv.FormatUint(uint64(u.Age), 10),
+		"location":        u.Location,
+		"job":             u.Job,
+		"email":           u.Email,
+		"mobile":          u.Mobile,
+		"dingtalk_id":     u.DingTalkID,
+		"wxwork_id":       u.WXWorkID,
+		"service_account": strconv.FormatBool(u.ServiceAccount),
+		"disabled":        strconv.FormatBool(u.Disabled),
 	}
 	return m
 }
 
 func (g *Group) Exists() bool {
-	if result := db.Where(g).First(g); errors.Is(result.Error, gorm.ErrRecordNotFound) {
-		g.Error = gorm.ErrRecordNotFound
+	found, err := store.Groups().First(g)
+	if err != nil {
+		g.Error = err
 		return false
 	}
+	*g = *found
 	return true
 }
 
 func (g *Group) Find() *Group {
-	if result := db.Where(g).First(g); errors.Is(result.Error, gorm.ErrRecordNotFound) {
-		g.Error = gorm.ErrRecordNotFound
+	found, err := store.Groups().First(g)
+	if err != nil {
+		g.Error = err
+		return g
 	}
+	*g = *found
 	return g
 }
 
 func (g *Group) Create() *Group {
-	if err := db.Where(g).FirstOrCreate(g).Error; err != nil {
+	if err := store.Groups().FirstOrCreate(g); err != nil {
 		g.Error = fmt.Errorf("创建组%s失败\n%w", g.Name, err)
 	}
 	return g
 }
 
 func (g *Group) Update() *Group {
-	if err := db.Save(g).Error; err != nil {
+	if err := store.Groups().Save(g); err != nil {
 		g.Error = fmt.Errorf("组%s数据更新失败\n%w", g.Name, err)
 	}
 
@@ -230,28 +343,70 @@ func (g *Group) AddUsers(names ...string) {
 		u := new(User)
 		u.Name = value
 		if u.Exists() {
-			err := u.UserGroup.AddRow(u.ID, g.ID)
+			ug, err := store.Users().AddGroup(u.ID, g.ID)
 			if err != nil {
 				g.Error = fmt.Errorf("组%s添加用户%s时发生错误\n%w", g.Name, u.Name, err)
 				return
 			}
+			g.UserGroup = ug
 		}
 	}
 }
 
+func (g *Group) AddRoles(names ...string) *Group {
+	return g.AddScopedRoles(Scope{}, names...)
+}
+
+// AddScopedRoles 绑定只在 scope 范围内生效的角色
+func (g *Group) AddScopedRoles(scope Scope, names ...string) *Group {
+	return g.addRoles(scope, nil, names...)
+}
+
+// AddTemporaryRoles 绑定在 expiresAt 之前有效的角色, 已存在的绑定会更新过期时间
+func (g *Group) AddTemporaryRoles(scope Scope, expiresAt time.Time, names ...string) *Group {
+	return g.addRoles(scope, &expiresAt, names...)
+}
+
+func (g *Group) addRoles(scope Scope, expiresAt *time.Time, names ...string) *Group {
+	projectID, projectEnvID, err := ResolveScope(store, scope)
+	if err != nil {
+		g.Error = fmt.Errorf("组%s绑定角色失败\n%w", g.Name, err)
+		return g
+	}
+	for _, value := range names {
+		r := new(Role)
+		r.Name = value
+		if !r.Exists() {
+			g.Error = fmt.Errorf("组%s绑定的角色%s不存在\n%w", g.Name, value, r.Error)
+			return g
+		}
+		gr := &GroupRole{GroupID: g.ID, RoleID: r.ID, ProjectID: projectID, ProjectEnvID: projectEnvID, ExpiresAt: expiresAt}
+		if err := store.Groups().AddRoleBinding(gr); err != nil {
+			g.Error = fmt.Errorf("组%s绑定角色%s时发生错误\n%w", g.Name, value, err)
+			return g
+		}
+		g.GroupRole = gr
+	}
+	return g
+}
+
 func (g *Group) GetUsers() *Group {
-	g.Users = g.UserGroup.GetUsers(g.ID)
-	if g.UserGroup.Error != nil {
-		g.Error = fmt.Errorf("组%s查询用户时发生错误\n%w", g.Name, g.UserGroup.Error)
+	users, err := store.Groups().Users(g.ID)
+	if err != nil {
+		g.Error = fmt.Errorf("组%s查询用户时发生错误\n%w", g.Name, err)
+		return g
 	}
+	g.Users = &users
 	return g
 }
 
 func (g *Group) GetRoles() *Group {
-	g.Roles = g.GroupRole.GetRoles(g.ID)
-	if g.GroupRole.Error != nil {
-		g.Error = fmt.Errorf("组%s查询角色时发生错误\n%w", g.Name, g.GroupRole.Error)
+	roles, err := store.Groups().Roles(g.ID)
+	if err != nil {
+		g.Error = fmt.Errorf("组%s查询角色时发生错误\n%w", g.Name, err)
+		return g
 	}
+	g.Roles = &roles
 	return g
 }
 
@@ -271,51 +426,136 @@ func (g *Group) Map() map[string]string {
 }
 
 func (r *Role) Exists() bool {
-	if result := db.Where(r).First(r); errors.Is(result.Error, gorm.ErrRecordNotFound) {
-		r.Error = gorm.ErrRecordNotFound
+	found, err := store.Roles().First(r)
+	if err != nil {
+		r.Error = err
 		return false
 	}
+	*r = *found
 	return true
 }
 
 func (r *Role) Find() *Role {
-	if result := db.Where(r).First(r); errors.Is(result.Error, gorm.ErrRecordNotFound) {
-		r.Error = gorm.ErrRecordNotFound
+	found, err := store.Roles().First(r)
+	if err != nil {
+		r.Error = err
+		return r
 	}
+	*r = *found
 	return r
 }
 
 func (r *Role) Create() *Role {
-	if err := db.Where(r).FirstOrCreate(r).Error; err != nil {
+	if err := store.Roles().FirstOrCreate(r); err != nil {
 		r.Error = fmt.Errorf("角色%v创建失败\n%w", r.Name, err)
 	}
 	return r
 }
 
+// Update 设置了 Parents 时同时替换继承关系, 会形成循环继承时拒绝更新
 func (r *Role) Update() *Role {
-	if r.Exists() {
-		if err := db.Save(r).Error; err != nil {
-			r.Error = fmt.Errorf("角色%v更新失败\n%w", r.Name, err)
+	if _, err := store.Roles().Get(r.ID); err != nil {
+		r.Error = fmt.Errorf("角色%v不存在\n%w", r.Name, err)
+		return r
+	}
+	err := store.Transaction(func(s Store) error {
+		if err := s.Roles().Save(r); err != nil {
+			return err
+		}
+		if r.Parents == nil {
+			return nil
+		}
+		pids := make([]uint, 0, len(*r.Parents))
+		for _, value := range *r.Parents {
+			pids = append(pids, value.ID)
 		}
-	} else {
-		r.Error = fmt.Errorf("角色%v不存在\n%w", r.Name, r.Error)
+		return SetRoleParents(s, r.ID, pids)
+	})
+	if err != nil {
+		r.Error = fmt.Errorf("角色%v更新失败\n%w", r.Name, err)
 	}
 	return r
 }
 
+func (r *Role) AddParents(names ...string) *Role {
+	for _, value := range names {
+		p := new(Role)
+		p.Name = value
+		if !p.Exists() {
+			r.Error = fmt.Errorf("角色%s继承的角色%s不存在\n%w", r.Name, value, p.Error)
+			return r
+		}
+		if err := CheckRoleCycle(store, r.ID, p.ID); err != nil {
+			r.Error = fmt.Errorf("角色%s继承角色%s失败\n%w", r.Name, value, err)
+			return r
+		}
+		if _, err := store.Roles().AddParent(r.ID, p.ID); err != nil {
+			r.Error = fmt.Errorf("角色%s继承角色%s失败\n%w", r.Name, value, err)
+			return r
+		}
+	}
+	return r
+}
+
+func (r *Role) GetParents() *Role {
+	parents, err := store.Roles().Parents(r.ID)
+	if err != nil {
+		r.Error = fmt.Errorf("角色%s查询继承的角色时发生错误\n%w", r.Name, err)
+		return r
+	}
+	r.Parents = &parents
+	return r
+}
+
+// GetUsers 包括绑定了该角色以及绑定了继承该角色的子角色的用户
 func (r *Role) GetUsers() *Role {
-	r.Users = r.UserRole.GetUsers(r.ID)
-	if r.UserRole.Error != nil {
-		r.Error = fmt.Errorf("角色%s查询用户时发生错误\n%w", r.Name, r.UserRole.Error)
+	roles, err := RoleDescendants(store, r.ID)
+	if err != nil {
+		r.Error = fmt.Errorf("角色%s查询子角色时发生错误\n%w", r.Name, err)
+		return r
+	}
+	seen := map[uint]bool{}
+	users := make([]User, 0)
+	for _, rid := range append([]uint{r.ID}, roleIDs(roles)...) {
+		result, err := store.Roles().Users(rid)
+		if err != nil {
+			r.Error = fmt.Errorf("角色%s查询用户时发生错误\n%w", r.Name, err)
+			return r
+		}
+		for _, value := range result {
+			if !seen[value.ID] {
+				seen[value.ID] = true
+				users = append(users, value)
+			}
+		}
 	}
+	r.Users = &users
 	return r
 }
 
+// GetGroups 包括绑定了该角色以及绑定了继承该角色的子角色的组
 func (r *Role) GetGroups() *Role {
-	r.Groups = r.GroupRole.GetGroups(r.ID)
-	if r.GroupRole.Error != nil {
-		r.Error = fmt.Errorf("角色%s查询组时发生错误\n%w", r.Name, r.GroupRole.Error)
+	roles, err := RoleDescendants(store, r.ID)
+	if err != nil {
+		r.Error = fmt.Errorf("角色%s查询子角色时发生错误\n%w", r.Name, err)
+		return r
+	}
+	seen := map[uint]bool{}
+	groups := make([]Group, 0)
+	for _, rid := range append([]uint{r.ID}, roleIDs(roles)...) {
+		result, err := store.Roles().Groups(rid)
+		if err != nil {
+			r.Error = fmt.Errorf("角色%s查询组时发生错误\n%w", r.Name, err)
+			return r
+		}
+		for _, value := range result {
+			if !seen[value.ID] {
+				seen[value.ID] = true
+				groups = append(groups, value)
+			}
+		}
 	}
+	r.Groups = &groups
 	return r
 }
 
@@ -334,185 +574,126 @@ func (r *Role) Map() map[string]string {
 	return m
 }
 
+// IsDeny 无效的 Effect 同样视为拒绝, 避免写错的取值被当作允许
+func (p *Permission) IsDeny() bool {
+	return p.Effect != "" && p.Effect != EffectAllow
+}
+
 func (ug *UserGroup) Exists(uid uint, gid uint) bool {
-	ug.UserID = uid
-	ug.GroupID = gid
-	if result := db.Where(ug).First(ug); errors.Is(result.Error, gorm.ErrRecordNotFound) {
-		ug.Error = gorm.ErrRecordNotFound
+	groups, err := store.Users().Groups(uid)
+	if err != nil {
+		ug.Error = err
 		return false
 	}
-	return true
+	for _, value := range groups {
+		if value.ID == gid {
+			ug.UserID = uid
+			ug.GroupID = gid
+			return true
+		}
+	}
+	ug.Error = ErrNotFound
+	return false
 }
 
 func (ug *UserGroup) GetGroups(uid uint) (groups *[]Group) {
-	gids := new([]uint)
-	if err := db.Where("user_id = ?", uid).Find(ug).Limit(1000).Error; err != nil {
-		ug.Error = fmt.Errorf("用户分组表中没有查询到user_id为%d的数据\n%w", uid, err)
-		return nil
-	}
-
-	if err := db.Model(ug).Pluck("group_id", gids).Error; err != nil {
-		ug.Error = fmt.Errorf("用户分组表中查询group_id集合失败\n%w", err)
-		return nil
-	} else if len(*gids) == 0 {
-		ug.Error = errors.New(fmt.Sprintf("user_id为%d的用户没有添加任何组", uid))
-		return nil
-	}
-
-	if err := db.Where(gids).Find(groups).Limit(1000).Error; err != nil {
+	result, err := store.Users().Groups(uid)
+	if err != nil {
 		ug.Error = fmt.Errorf("通过group_id查询对应组时失败\n%w", err)
 		return nil
+	} else if len(result) == 0 {
+		ug.Error = fmt.Errorf("user_id为%d的用户没有添加任何组", uid)
+		return nil
 	}
-
-	return
+	return &result
 }
 
 func (ug *UserGroup) GetUsers(gid uint) (users *[]User) {
-	uids := new([]uint)
-	if err := db.Where("group_id = ?", gid).Find(ug).Limit(1000).Error; err != nil {
-		ug.Error = fmt.Errorf("用户分组表中没有查询到group_id为%d的数据\n%w", gid, err)
-		return nil
-	}
-
-	if err := db.Model(ug).Pluck("user_id", uids).Error; err != nil {
-		ug.Error = fmt.Errorf("用户分组表中查询uid集合失败\n%w", err)
-		return nil
-	} else if len(*uids) == 0 {
-		ug.Error = errors.New(fmt.Sprintf("group_id为%d的组中没有添加任何用户", gid))
-		return nil
-	}
-
-	if err := db.Where(uids).Find(users).Limit(1000).Error; err != nil {
+	result, err := store.Groups().Users(gid)
+	if err != nil {
 		ug.Error = fmt.Errorf("通过user_id查询对应用户时失败\n%w", err)
 		return nil
+	} else if len(result) == 0 {
+		ug.Error = fmt.Errorf("group_id为%d的组中没有添加任何用户", gid)
+		return nil
 	}
-
-	return
+	return &result
 }
 
 func (ug *UserGroup) AddRow(uid uint, gid uint) error {
-	session := db.Session(&gorm.Session{NewDB: true})
-	if session.Error != nil {
-		ug.Error = fmt.Errorf("添加用户分组时数据库连接失败\n%w", session.Error)
-		return ug.Error
-	}
-
-	if err := session.Where(UserGroup{UserID: uid, GroupID: gid}).FirstOrCreate(ug).Error; err != nil {
+	row, err := store.Users().AddGroup(uid, gid)
+	if err != nil {
 		ug.Error = fmt.Errorf("用户分组表数据添加失败\n%w", err)
+		return ug.Error
 	}
-	return ug.Error
+	*ug = *row
+	return nil
 }
 
 func (ur *UserRole) GetRoles(uid uint) (roles *[]Role) {
-	rids := new([]uint)
-	if err := db.Where("user_id = ?", uid).Find(ur).Limit(1000).Error; err != nil {
-		ur.Error = fmt.Errorf("用户角色表中没有查询到user_id为%d的数据\n%w", uid, err)
-		return nil
-	}
-
-	if err := db.Model(ur).Pluck("role_id", rids).Error; err != nil {
-		ur.Error = fmt.Errorf("用户角色表中查询role_id集合失败\n%w", err)
-		return nil
-	} else if len(*rids) == 0 {
-		ur.Error = errors.New(fmt.Sprintf("user_id为%d的用户没有绑定任何角色", uid))
-		return nil
-	}
-
-	if err := db.Where(rids).Find(roles).Limit(1000).Error; err != nil {
+	result, err := store.Users().Roles(uid)
+	if err != nil {
 		ur.Error = fmt.Errorf("通过role_id查对应角色时失败\n%w", err)
 		return nil
+	} else if len(result) == 0 {
+		ur.Error = fmt.Errorf("user_id为%d的用户没有绑定任何角色", uid)
+		return nil
 	}
-	return
+	return &result
 }
 
 func (ur *UserRole) GetUsers(rid uint) (users *[]User) {
-	uids := new([]uint)
-	if err := db.Where("role_id = ?", rid).Find(ur).Limit(1000).Error; err != nil {
-		ur.Error = fmt.Errorf("用户角色表中没有查询到role_id为%d的数据\n%w", rid, err)
-		return nil
-	}
-
-	if err := db.Model(ur).Pluck("user_id", uids).Error; err != nil {
-		ur.Error = fmt.Errorf("用户角色表中查询user_id集合失败\n%w", err)
-		return nil
-	} else if len(*uids) == 0 {
-		ur.Error = errors.New(fmt.Sprintf("role_id为%d的角色没有绑定任何用户", rid))
-		return nil
-	}
-
-	if err := db.Where(uids).Find(users).Limit(1000).Error; err != nil {
+	result, err := store.Roles().Users(rid)
+	if err != nil {
 		ur.Error = fmt.Errorf("通过user_id查对应用户时失败\n%w", err)
 		return nil
+	} else if len(result) == 0 {
+		ur.Error = fmt.Errorf("role_id为%d的角色没有绑定任何用户", rid)
+		return nil
 	}
-
-	return
+	return &result
 }
 
 func (ur *UserRole) AddRow(uid uint, rid uint) error {
-	session := db.Session(&gorm.Session{NewDB: true})
-	if session.Error != nil {
-		ur.Error = fmt.Errorf("添加用户角色时数据库连接失败\n%w", session.Error)
-		return ur.Error
-	}
-
-	if err := session.Where(UserRole{UserID: uid, RoleID: rid}).FirstOrCreate(ur).Error; err != nil {
+	row, err := store.Users().AddRole(uid, rid)
+	if err != nil {
 		ur.Error = fmt.Errorf("用户角色表数据添加失败\n%w", err)
+		return ur.Error
 	}
-	return ur.Error
+	*ur = *row
+	return nil
 }
 
 func (gr *GroupRole) GetRoles(gid uint) (roles *[]Role) {
-	rids := new([]uint)
-	if err := db.Where("group_id = ?", gid).Find(gr).Limit(1000).Error; err != nil {
-		gr.Error = fmt.Errorf("组角色表中没有查询到group_id为%d的数据\n%w", gid, err)
-		return nil
-	}
-
-	if err := db.Model(gr).Pluck("role_id", rids).Error; err != nil {
-		gr.Error = fmt.Errorf("组角色表中查询role_id集合失败\n%w", err)
-		return nil
-	} else if len(*rids) == 0 {
-		gr.Error = errors.New(fmt.Sprintf("group_id为%d的组没有绑定任何角色", gid))
-		return nil
-	}
-
-	if err := db.Where(rids).Find(roles).Limit(1000).Error; err != nil {
+	result, err := store.Groups().Roles(gid)
+	if err != nil {
 		gr.Error = fmt.Errorf("通过role_id查对应角色时失败\n%w", err)
 		return nil
+	} else if len(result) == 0 {
+		gr.Error = fmt.Errorf("group_id为%d的组没有绑定任何角色", gid)
+		return nil
 	}
-	return
+	return &result
 }
 
 func (gr *GroupRole) GetGroups(rid uint) (groups *[]Group) {
-	gids := new([]uint)
-	if err := db.Where("role_id = ?", rid).Find(gr).Limit(1000).Error; err != nil {
-		gr.Error = fmt.Errorf("组角色表中没有查询到role_id为%d的数据\n%w", rid, err)
-		return nil
-	}
-
-	if err := db.Model(gr).Pluck("group_id", gids).Error; err != nil {
-		gr.Error = fmt.Errorf("组角色表中查询group_id集合失败\n%w", err)
-		return nil
-	} else if len(*gids) == 0 {
-		gr.Error = errors.New(fmt.Sprintf("role_id为%d的角色没有绑定任何组", rid))
-		return nil
-	}
-
-	if err := db.Where(gids).Find(groups).Limit(1000).Error; err != nil {
+	result, err := store.Roles().Groups(rid)
+	if err != nil {
 		gr.Error = fmt.Errorf("通过group_id查对应组时失败\n%w", err)
 		return nil
+	} else if len(result) == 0 {
+		gr.Error = fmt.Errorf("role_id为%d的角色没有绑定任何组", rid)
+		return nil
 	}
-	return
+	return &result
 }
 
 func (gr *GroupRole) AddRow(gid uint, rid uint) error {
-	session := db.Session(&gorm.Session{NewDB: true})
-	if session.Error != nil {
-		gr.Error = fmt.Errorf("添加组角色时数据库连接失败\n%w", session.Error)
-		return gr.Error
-	}
-	if err := session.Where(GroupRole{GroupID: gid, RoleID: rid}).FirstOrCreate(gr).Error; err != nil {
+	row, err := store.Groups().AddRole(gid, rid)
+	if err != nil {
 		gr.Error = fmt.Errorf("组角色表数据添加失败\n%w", err)
+		return gr.Error
 	}
-	return gr.Error
+	*gr = *row
+	return nil
 }
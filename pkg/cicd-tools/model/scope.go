@@ -0,0 +1,88 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package model
+
+import (
+	"fmt"
+)
+
+// Scope 角色绑定的生效范围, ProjectID 为 0 表示全局, EnvID 为 0 表示项目下的全部环境
+type Scope struct {
+	ProjectID uint
+	EnvID     uint
+}
+
+func (s Scope) IsGlobal() bool {
+	return s.ProjectID == 0
+}
+
+func (s Scope) String() string {
+	switch {
+	case s.ProjectID == 0:
+		return "全局"
+	case s.EnvID == 0:
+		return fmt.Sprintf("项目%d", s.ProjectID)
+	default:
+		return fmt.Sprintf("项目%d/环境%d", s.ProjectID, s.EnvID)
+	}
+}
+
+// Contains 判断绑定范围 s 是否覆盖请求范围 other
+func (s Scope) Contains(other Scope) bool {
+	if s.ProjectID == 0 {
+		return true
+	}
+	if s.ProjectID != other.ProjectID {
+		return false
+	}
+	return s.EnvID == 0 || s.EnvID == other.EnvID
+}
+
+// ResolveScope 将 Scope 转换为绑定表中的 ProjectID 与 ProjectEnvID, 指定的环境需已关联到项目
+func ResolveScope(s Store, scope Scope) (uint, uint, error) {
+	if scope.ProjectID == 0 {
+		if scope.EnvID != 0 {
+			return 0, 0, fmt.Errorf("限定环境%d时必须同时指定项目", scope.EnvID)
+		}
+		return 0, 0, nil
+	}
+	if _, err := s.Projects().Get(scope.ProjectID); err != nil {
+		return 0, 0, fmt.Errorf("项目%d不存在\n%w", scope.ProjectID, err)
+	}
+	if scope.EnvID == 0 {
+		return scope.ProjectID, 0, nil
+	}
+	pe, err := s.Projects().ProjectEnv(scope.ProjectID, scope.EnvID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("环境%d未关联到项目%d\n%w", scope.EnvID, scope.ProjectID, err)
+	}
+	return scope.ProjectID, pe.ID, nil
+}
+
+// BindingScope 根据绑定表中的 ProjectID 与 ProjectEnvID 还原 Scope
+func BindingScope(s Store, projectID uint, projectEnvID uint) (Scope, error) {
+	scope := Scope{ProjectID: projectID}
+	if projectEnvID == 0 {
+		return scope, nil
+	}
+	pe, err := s.Projects().GetProjectEnv(projectEnvID)
+	if err != nil {
+		return scope, fmt.Errorf("绑定的项目环境%d不存在\n%w", projectEnvID, err)
+	}
+	scope.EnvID = pe.EnvID
+	return scope, nil
+}
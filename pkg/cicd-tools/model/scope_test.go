@@ -0,0 +1,46 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package model_test
+
+import (
+	"testing"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+func TestScopeContains(t *testing.T) {
+	tests := []struct {
+		binding, req model.Scope
+		want         bool
+	}{
+		{model.Scope{}, model.Scope{}, true},
+		{model.Scope{}, model.Scope{ProjectID: 1, EnvID: 2}, true},
+		{model.Scope{ProjectID: 1}, model.Scope{}, false},
+		{model.Scope{ProjectID: 1}, model.Scope{ProjectID: 1}, true},
+		{model.Scope{ProjectID: 1}, model.Scope{ProjectID: 1, EnvID: 2}, true},
+		{model.Scope{ProjectID: 1}, model.Scope{ProjectID: 2}, false},
+		{model.Scope{ProjectID: 1, EnvID: 2}, model.Scope{ProjectID: 1}, false},
+		{model.Scope{ProjectID: 1, EnvID: 2}, model.Scope{ProjectID: 1, EnvID: 2}, true},
+		{model.Scope{ProjectID: 1, EnvID: 2}, model.Scope{ProjectID: 1, EnvID: 3}, false},
+		{model.Scope{ProjectID: 1, EnvID: 2}, model.Scope{ProjectID: 3, EnvID: 2}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.binding.Contains(tt.req); got != tt.want {
+			t.Errorf("%s.Contains(%s) = %v", tt.binding, tt.req, got)
+		}
+	}
+}
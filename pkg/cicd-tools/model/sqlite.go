@@ -0,0 +1,46 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package model
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// OpenSQLite 打开 SQLite 数据库, dsn 为文件路径或 ":memory:"
+func OpenSQLite(dsn string, tablePrefix string) (*gorm.DB, error) {
+	conn, err := gorm.Open(sqlite.Open(dsn), gormConfig(tablePrefix))
+	if err != nil {
+		return nil, fmt.Errorf("打开SQLite数据库%s失败\n%w", dsn, err)
+	}
+
+	sqlDB, err := conn.DB()
+	if err != nil {
+		return nil, fmt.Errorf("获取SQLite数据库连接失败\n%w", err)
+	}
+	// 内存数据库每个连接相互独立, 需固定为单连接才能共享同一份数据
+	if strings.Contains(dsn, ":memory:") || strings.Contains(dsn, "mode=memory") {
+		sqlDB.SetMaxOpenConns(1)
+	}
+	if err := sqlDB.Ping(); err != nil {
+		return nil, fmt.Errorf("SQLite数据库%s无法访问\n%w", dsn, err)
+	}
+	return conn, nil
+}
@@ -0,0 +1,299 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package model
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrNotFound 各存储实现查询不到记录时统一返回该错误
+var ErrNotFound = gorm.ErrRecordNotFound
+
+// ErrDuplicated 各存储实现写入的记录违反唯一索引时返回包装了该错误的错误
+var ErrDuplicated = gorm.ErrDuplicatedKey
+
+var (
+	store Store
+)
+
+// Store 聚合各实体的存储接口
+//
+// First/Find 以条件结构体中的非零字段作为查询条件, FirstOrCreate 查询不到时按条件创建
+// AddRole/RemoveRole 只处理全局绑定, 带范围的绑定使用 AddRoleBinding/RemoveRoleBinding,
+// AddRoleBinding 遇到相同范围的已有绑定时更新其过期时间, Roles 返回所有范围内绑定的角色 (包括已过期的)
+type Store interface {
+	Users() UserStore
+	Groups() GroupStore
+	Roles() RoleStore
+	Projects() ProjectStore
+	Builds() BuildStore
+	Artifacts() ArtifactStore
+	Grants() GrantStore
+	Tokens() TokenStore
+	MFA() MFAStore
+	Logins() LoginStore
+	// List 按 q 分页查询与 cond 同一模型的记录, cond 中的非零字段同样作为条件, out 为该模型切片的指针
+	List(cond interface{}, q *Query, out interface{}) (*Page, error)
+	// Transaction 在同一事务中执行 fn, fn 返回错误时全部回滚
+	Transaction(fn func(s Store) error) error
+}
+
+type UserStore interface {
+	Get(id uint) (*User, error)
+	First(cond *User) (*User, error)
+	Find(cond *User) ([]User, error)
+	Create(u *User) error
+	FirstOrCreate(u *User) error
+	Save(u *User) error
+	Delete(id uint) error
+	AddGroup(uid uint, gid uint) (*UserGroup, error)
+	RemoveGroup(uid uint, gid uint) error
+	Groups(uid uint) ([]Group, error)
+	AddRole(uid uint, rid uint) (*UserRole, error)
+	RemoveRole(uid uint, rid uint) error
+	Roles(uid uint) ([]Role, error)
+	AddRoleBinding(ur *UserRole) error
+	RemoveRoleBinding(id uint) error
+	RoleBindings(uid uint) ([]UserRole, error)
+	UpdatePassword(uid uint, hash PasswordHash) error
+	// UpdateProfile 只更新用户资料以及 service_account 与 disabled, 不覆盖密码、令牌版本与登录状态
+	UpdateProfile(u *User) error
+	// UpdateLoginState 只更新连续登录失败次数与锁定时间
+	UpdateLoginState(uid uint, failedLogins int, lockedUntil *time.Time) error
+	// IncrementFailedLogins 原子地递增连续登录失败次数并返回递增后的值
+	IncrementFailedLogins(uid uint) (int, error)
+	SetDisabled(uid uint, disabled bool) error
+	// IncrementTokenVersion 递增令牌版本, 使用户已签发的令牌失效
+	IncrementTokenVersion(uid uint) error
+	AddPasswordHistory(h *PasswordHistory) error
+	// PasswordHistory 按设置时间倒序返回最近 limit 条历史密码
+	PasswordHistory(uid uint, limit int) ([]PasswordHistory, error)
+}
+
+type GroupStore interface {
+	Get(id uint) (*Group, error)
+	First(cond *Group) (*Group, error)
+	Find(cond *Group) ([]Group, error)
+	Create(g *Group) error
+	FirstOrCreate(g *Group) error
+	Save(g *Group) error
+	Delete(id uint) error
+	Users(gid uint) ([]User, error)
+	AddRole(gid uint, rid uint) (*GroupRole, error)
+	RemoveRole(gid uint, rid uint) error
+	Roles(gid uint) ([]Role, error)
+	AddRoleBinding(gr *GroupRole) error
+	RemoveRoleBinding(id uint) error
+	RoleBindings(gid uint) ([]GroupRole, error)
+}
+
+type RoleStore interface {
+	Get(id uint) (*Role, error)
+	First(cond *Role) (*Role, error)
+	Find(cond *Role) ([]Role, error)
+	Create(r *Role) error
+	FirstOrCreate(r *Role) error
+	Save(r *Role) error
+	Delete(id uint) error
+	Users(rid uint) ([]User, error)
+	Groups(rid uint) ([]Group, error)
+	Permissions(rid uint) ([]Permission, error)
+	AddPermission(p *Permission) error
+	RemovePermission(id uint) error
+	AddParent(rid uint, pid uint) (*RoleParent, error)
+	RemoveParent(rid uint, pid uint) error
+	Parents(rid uint) ([]Role, error)
+	Children(rid uint) ([]Role, error)
+}
+
+type ProjectStore interface {
+	Get(id uint) (*Project, error)
+	First(cond *Project) (*Project, error)
+	Find(cond *Project) ([]Project, error)
+	Create(p *Project) error
+	FirstOrCreate(p *Project) error
+	Save(p *Project) error
+	Delete(id uint) error
+
+	GetEnv(id uint) (*Env, error)
+	FirstEnv(cond *Env) (*Env, error)
+	FindEnvs(cond *Env) ([]Env, error)
+	FirstOrCreateEnv(e *Env) error
+	SaveEnv(e *Env) error
+	DeleteEnv(id uint) error
+
+	GetItem(id uint) (*Item, error)
+	FirstItem(cond *Item) (*Item, error)
+	FindItems(cond *Item) ([]Item, error)
+	FirstOrCreateItem(i *Item) error
+	SaveItem(i *Item) error
+	DeleteItem(id uint) error
+
+	AddEnv(pid uint, eid uint) (*ProjectEnv, error)
+	RemoveEnv(pid uint, eid uint) error
+	ProjectEnv(pid uint, eid uint) (*ProjectEnv, error)
+	GetProjectEnv(id uint) (*ProjectEnv, error)
+	Envs(pid uint) ([]Env, error)
+	AddItem(pid uint, iid uint) (*ProjectItem, error)
+	RemoveItem(pid uint, iid uint) error
+	Items(pid uint) ([]Item, error)
+
+	FirstEnvItem(cond *ProjectEnvItem) (*ProjectEnvItem, error)
+	FindEnvItems(cond *ProjectEnvItem) ([]ProjectEnvItem, error)
+	FirstOrCreateEnvItem(pei *ProjectEnvItem) error
+	SaveEnvItem(pei *ProjectEnvItem) error
+	DeleteEnvItem(id uint) error
+}
+
+type BuildStore interface {
+	Get(id uint) (*BuildInfo, error)
+	First(cond *BuildInfo) (*BuildInfo, error)
+	Find(cond *BuildInfo) ([]BuildInfo, error)
+	// MaxBuildID 应用环境已使用的最大构建编号, 包括已删除的构建, 没有构建时为 0
+	MaxBuildID(projectEnvItemID uint) (uint, error)
+	// Create 构建编号在应用环境内已存在时返回 ErrDuplicated
+	Create(b *BuildInfo) error
+	Save(b *BuildInfo) error
+	Delete(id uint) error
+
+	GetConfig(id uint) (*BuildConfig, error)
+	FirstConfig(cond *BuildConfig) (*BuildConfig, error)
+	FindConfigs(cond *BuildConfig) ([]BuildConfig, error)
+	FirstOrCreateConfig(c *BuildConfig) error
+	SaveConfig(c *BuildConfig) error
+	DeleteConfig(id uint) error
+
+	GetRepo(id uint) (*GitRepo, error)
+	FirstRepo(cond *GitRepo) (*GitRepo, error)
+	FindRepos(cond *GitRepo) ([]GitRepo, error)
+	FirstOrCreateRepo(r *GitRepo) error
+	SaveRepo(r *GitRepo) error
+	DeleteRepo(id uint) error
+
+	FirstGitConfig(cond *GitConfig) (*GitConfig, error)
+	FindGitConfigs(cond *GitConfig) ([]GitConfig, error)
+	FirstOrCreateGitConfig(c *GitConfig) error
+	SaveGitConfig(c *GitConfig) error
+	DeleteGitConfig(id uint) error
+
+	FirstCommit(cond *CommitInfo) (*CommitInfo, error)
+	FindCommits(cond *CommitInfo) ([]CommitInfo, error)
+	FirstOrCreateCommit(c *CommitInfo) error
+
+	// AddLogs 按顺序追加构建日志, Logs 按 ID 升序返回构建中 ID 大于 afterID 的日志
+	AddLogs(logs []BuildLog) error
+	Logs(buildID uint, afterID uint) ([]BuildLog, error)
+}
+
+// GrantStore 角色申请与授权变更记录
+type GrantStore interface {
+	CreateRequest(r *RoleRequest) error
+	GetRequest(id uint) (*RoleRequest, error)
+	// LockRequest 在事务内查询并锁定申请, 直到事务结束, 用于审批前再次检查状态
+	LockRequest(id uint) (*RoleRequest, error)
+	FindRequests(cond *RoleRequest) ([]RoleRequest, error)
+	SaveRequest(r *RoleRequest) error
+	AddLog(l *RoleGrantLog) error
+	FindLogs(cond *RoleGrantLog) ([]RoleGrantLog, error)
+	// ExpiredUserRoles 与 ExpiredGroupRoles 返回在 now 时已过期的绑定
+	ExpiredUserRoles(now time.Time) ([]UserRole, error)
+	ExpiredGroupRoles(now time.Time) ([]GroupRole, error)
+}
+
+// TokenStore 令牌吊销列表与个人访问令牌, 吊销记录只需保留到令牌原本的过期时间
+type TokenStore interface {
+	// Revoke 插入吊销记录, 令牌已吊销时不插入并返回 false, 用于原子地判断刷新令牌是否被重复使用
+	Revoke(t *RevokedToken) (bool, error)
+	IsRevoked(tokenID string) (bool, error)
+	// Purge 删除 before 之前已过期的记录
+	Purge(before time.Time) error
+
+	CreatePersonal(t *PersonalToken) error
+	GetPersonal(id uint) (*PersonalToken, error)
+	FindPersonal(cond *PersonalToken) ([]PersonalToken, error)
+	// PersonalByHash 按令牌哈希查找, 用于校验令牌
+	PersonalByHash(hash string) (*PersonalToken, error)
+	// TouchPersonal 只更新未吊销令牌的最后使用时间, 令牌已吊销时返回 false
+	TouchPersonal(id uint, at time.Time) (bool, error)
+	// RevokePersonal 只更新 revoked_at, 已吊销的令牌保持原吊销时间
+	RevokePersonal(id uint, at time.Time) error
+	// RevokePersonalByUser 吊销用户全部未吊销的个人访问令牌
+	RevokePersonalByUser(uid uint, at time.Time) error
+}
+
+// MFAStore 多因素认证的密钥与恢复码
+type MFAStore interface {
+	// TOTP 查询用户的 TOTP 密钥, 不存在时返回 ErrNotFound
+	TOTP(uid uint) (*UserTOTP, error)
+	SaveTOTP(t *UserTOTP) error
+	// DeleteTOTP 删除用户的 TOTP 密钥与全部恢复码
+	DeleteTOTP(uid uint) error
+	// ReplaceRecoveryCodes 删除用户原有的恢复码并保存新的恢复码
+	ReplaceRecoveryCodes(uid uint, codes []RecoveryCode) error
+	RecoveryCodes(uid uint) ([]RecoveryCode, error)
+	SaveRecoveryCode(c *RecoveryCode) error
+}
+
+// LoginStore 登录记录
+type LoginStore interface {
+	Add(h *LoginHistory) error
+	// Find 按时间倒序返回登录记录
+	Find(q LoginQuery) ([]LoginHistory, error)
+}
+
+type ArtifactStore interface {
+	Get(id uint) (*Artifact, error)
+	First(cond *Artifact) (*Artifact, error)
+	Find(cond *Artifact) ([]Artifact, error)
+	Create(a *Artifact) error
+	FirstOrCreate(a *Artifact) error
+	Save(a *Artifact) error
+	Delete(id uint) error
+}
+
+// SetStore 设置实体方法使用的默认存储, 需在调用任何实体方法前完成
+func SetStore(s Store) {
+	store = s
+}
+
+func DefaultStore() (Store, error) {
+	if store == nil {
+		return nil, errors.New("存储未初始化")
+	}
+	return store, nil
+}
+
+// Transaction 在默认存储的同一事务中执行 fn
+func Transaction(fn func(s Store) error) error {
+	s, err := DefaultStore()
+	if err != nil {
+		return err
+	}
+	return s.Transaction(fn)
+}
+
+// List 使用默认存储分页查询, 见 Store.List, 如 List(&User{Source: SourceLDAP}, &Query{Limit: 20}, &users)
+func List(cond interface{}, q *Query, out interface{}) (*Page, error) {
+	s, err := DefaultStore()
+	if err != nil {
+		return nil, err
+	}
+	return s.List(cond, q, out)
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RevokedToken 已吊销的令牌, TokenID 为 JWT 的 jti, 过期后的记录可以清理
+type RevokedToken struct {
+	gorm.Model
+	TokenID   string    `gorm:"column:token_id;type:varchar(64);not null;uniqueIndex;<-:create"`
+	UserID    uint      `gorm:"column:user_id;type:integer;not null;<-:create"`
+	ExpiresAt time.Time `gorm:"column:expires_at;not null;index;<-:create"`
+	Error     error     `gorm:"-"`
+}
+
+// PersonalToken 个人访问令牌, 只保存令牌的 SHA-256 哈希, Prefix 为令牌开头的若干字符, 用于展示和辨认
+// Scopes 为逗号分隔的 category:action 列表, 令牌只能执行用户权限与 Scopes 的交集
+type PersonalToken struct {
+	gorm.Model
+	UserID     uint       `gorm:"column:user_id;type:integer;not null;index;<-:create"`
+	Name       string     `gorm:"column:name;type:varchar(60);not null"`
+	Prefix     string     `gorm:"column:prefix;type:varchar(20);not null;<-:create"`
+	Hash       string     `gorm:"column:hash;type:varchar(64);not null;uniqueIndex;<-:create" json:"-" yaml:"-" query:"-"`
+	Scopes     string     `gorm:"column:scopes;type:varchar(1024);not null"`
+	ExpiresAt  *time.Time `gorm:"column:expires_at"`
+	LastUsedAt *time.Time `gorm:"column:last_used_at"`
+	RevokedAt  *time.Time `gorm:"column:revoked_at"`
+	Error      error      `gorm:"-"`
+}
+
+// Active 判断令牌在 now 时是否可用
+func (t *PersonalToken) Active(now time.Time) bool {
+	if t.RevokedAt != nil {
+		return false
+	}
+	return t.ExpiresAt == nil || t.ExpiresAt.After(now)
+}
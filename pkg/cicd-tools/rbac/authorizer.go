@@ -0,0 +1,349 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package rbac
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+// Wildcard 用于 Permission 的 Category 与 Action, 匹配任意值
+// Permission.ResourceID 为 0 时匹配该类别下的任意资源
+const Wildcard = "*"
+
+// Request 的 Scope 为请求所在的项目与环境, 为空时只有全局绑定的角色生效
+type Request struct {
+	UserID     uint
+	Category   string
+	ResourceID uint
+	Action     string
+	Scope      model.Scope
+}
+
+// 部署应用与登记构建所需的权限, ResourceID 为环境 ID, 在应用环境所在的项目与环境内鉴权
+const (
+	CategoryEnv  = "env"
+	ActionDeploy = "deploy"
+)
+
+// Deploy 用户在项目的环境中部署应用或登记构建的鉴权请求
+func Deploy(uid uint, projectID uint, envID uint) Request {
+	return Request{
+		UserID:     uid,
+		Category:   CategoryEnv,
+		ResourceID: envID,
+		Action:     ActionDeploy,
+		Scope:      model.Scope{ProjectID: projectID, EnvID: envID},
+	}
+}
+
+func (r Request) String() string {
+	s := fmt.Sprintf("%s:%s:%s", r.Category, resourceString(r.ResourceID), r.Action)
+	if !r.Scope.IsGlobal() {
+		s += "@" + r.Scope.String()
+	}
+	return s
+}
+
+// Grant 用户获得某个角色的途径, Group 为空表示直接绑定, InheritedFrom 不为空表示由绑定的角色继承而来,
+// Scope 与 ExpiresAt 为绑定的生效范围和过期时间, 继承的角色沿用原绑定的范围和过期时间
+type Grant struct {
+	Role          model.Role
+	Group         *model.Group
+	InheritedFrom *model.Role
+	Scope         model.Scope
+	ExpiresAt     *time.Time
+}
+
+func (g Grant) Source() string {
+	source := "直接绑定"
+	if g.Group != nil {
+		source = fmt.Sprintf("通过组%s", g.Group.Name)
+	}
+	source += fmt.Sprintf(", 范围%s", g.Scope)
+	if g.ExpiresAt != nil {
+		source += fmt.Sprintf(", 有效期至%s", g.ExpiresAt.Format("2006-01-02 15:04:05"))
+	}
+	if g.InheritedFrom != nil {
+		source += fmt.Sprintf(", 由角色%s继承", g.InheritedFrom.Name)
+	}
+	return source
+}
+
+// Decision 鉴权结果, Grant 与 Permission 为决定结果的角色和权限, 默认拒绝时为空
+type Decision struct {
+	Allowed    bool
+	Request    Request
+	Grant      *Grant
+	Permission *model.Permission
+	Reason     string
+}
+
+func (d *Decision) String() string {
+	result := "拒绝"
+	if d.Allowed {
+		result = "允许"
+	}
+	return fmt.Sprintf("%s %s: %s", result, d.Request, d.Reason)
+}
+
+type Authorizer struct {
+	store model.Store
+}
+
+func NewAuthorizer(s model.Store) *Authorizer {
+	return &Authorizer{store: s}
+}
+
+// EffectiveRoles 返回在 scope 范围内生效的角色: 用户直接绑定的角色、通过 UserGroup -> GroupRole 获得的角色
+// 以及这些角色继承的角色. 全局绑定在任何范围内生效, 项目绑定在该项目的任意环境内生效, 已过期的绑定被忽略
+func (a *Authorizer) EffectiveRoles(uid uint, scope model.Scope) ([]Grant, error) {
+	return a.effectiveRoles(uid, &scope)
+}
+
+// AllRoles 返回用户在任意范围内生效的角色, 即不按范围过滤的 EffectiveRoles
+func (a *Authorizer) AllRoles(uid uint) ([]Grant, error) {
+	return a.effectiveRoles(uid, nil)
+}
+
+// Holds 判断用户是否在任一范围内被授予了 category 下的 action, 只检查 allow 权限, 不考虑 deny 与具体资源,
+// 用于按权限决定是否启用更严格的安全策略 (如强制多因素认证); category 为空时匹配任意类别
+func (a *Authorizer) Holds(uid uint, category string, action string) (bool, error) {
+	grants, err := a.AllRoles(uid)
+	if err != nil {
+		return false, err
+	}
+	for _, grant := range grants {
+		permissions, err := a.store.Roles().Permissions(grant.Role.ID)
+		if err != nil {
+			return false, fmt.Errorf("查询角色%s的权限失败\n%w", grant.Role.Name, err)
+		}
+		for _, p := range permissions {
+			if p.IsDeny() {
+				continue
+			}
+			if category != "" && p.Category != category && p.Category != Wildcard {
+				continue
+			}
+			if p.Action == action || p.Action == Wildcard {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// effectiveRoles scope 为 nil 时不按范围过滤
+func (a *Authorizer) effectiveRoles(uid uint, scope *model.Scope) ([]Grant, error) {
+	var bound []Grant
+	now := time.Now()
+	bindings, err := a.store.Users().RoleBindings(uid)
+	if err != nil {
+		return nil, fmt.Errorf("查询用户%d绑定的角色失败\n%w", uid, err)
+	}
+	for _, value := range bindings {
+		if value.Expired(now) {
+			continue
+		}
+		grant, err := a.grant(value.RoleID, value.ProjectID, value.ProjectEnvID, scope)
+		if err != nil {
+			return nil, err
+		}
+		if grant != nil {
+			grant.ExpiresAt = value.ExpiresAt
+			bound = append(bound, *grant)
+		}
+	}
+
+	groups, err := a.store.Users().Groups(uid)
+	if err != nil {
+		return nil, fmt.Errorf("查询用户%d所属的组失败\n%w", uid, err)
+	}
+	for i := range groups {
+		group := groups[i]
+		bindings, err := a.store.Groups().RoleBindings(group.ID)
+		if err != nil {
+			return nil, fmt.Errorf("查询组%s绑定的角色失败\n%w", group.Name, err)
+		}
+		for _, value := range bindings {
+			if value.Expired(now) {
+				continue
+			}
+			grant, err := a.grant(value.RoleID, value.ProjectID, value.ProjectEnvID, scope)
+			if err != nil {
+				return nil, err
+			}
+			if grant != nil {
+				grant.Group = &group
+				grant.ExpiresAt = value.ExpiresAt
+				bound = append(bound, *grant)
+			}
+		}
+	}
+	return a.inherit(bound)
+}
+
+// grant 将一条角色绑定转换为 Grant, 绑定范围不覆盖 scope 或角色已删除时返回 nil, scope 为 nil 时不检查范围
+func (a *Authorizer) grant(rid uint, projectID uint, projectEnvID uint, scope *model.Scope) (*Grant, error) {
+	if scope != nil && projectID != 0 && projectID != scope.ProjectID {
+		return nil, nil
+	}
+	bindingScope, err := model.BindingScope(a.store, projectID, projectEnvID)
+	if err != nil {
+		return nil, err
+	}
+	if scope != nil && !bindingScope.Contains(*scope) {
+		return nil, nil
+	}
+	role, err := a.store.Roles().Get(rid)
+	if errors.Is(err, model.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询角色%d失败\n%w", rid, err)
+	}
+	return &Grant{Role: *role, Scope: bindingScope}, nil
+}
+
+// inherit 在绑定的角色之后追加其继承的角色
+func (a *Authorizer) inherit(bound []Grant) ([]Grant, error) {
+	grants := bound
+	for i := range bound {
+		role := bound[i].Role
+		ancestors, err := model.RoleAncestors(a.store, role.ID)
+		if err != nil {
+			return nil, fmt.Errorf("查询角色%s继承的角色失败\n%w", role.Name, err)
+		}
+		for _, value := range ancestors {
+			grants = append(grants, Grant{Role: value, Group: bound[i].Group, InheritedFrom: &role,
+				Scope: bound[i].Scope, ExpiresAt: bound[i].ExpiresAt})
+		}
+	}
+	return grants, nil
+}
+
+// Authorize 在用户的有效角色中查找与请求匹配的权限, 优先级为: 显式拒绝 > 显式允许 > 默认拒绝
+func (a *Authorizer) Authorize(req Request) (*Decision, error) {
+	grants, err := a.EffectiveRoles(req.UserID, req.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		allow, deny *match
+		checked     []string
+	)
+	for i := range grants {
+		grant := grants[i]
+		permissions, err := a.store.Roles().Permissions(grant.Role.ID)
+		if err != nil {
+			return nil, fmt.Errorf("查询角色%s的权限失败\n%w", grant.Role.Name, err)
+		}
+		checked = append(checked, grant.Role.Name)
+		for j := range permissions {
+			m := &match{grant: &grant, permission: &permissions[j], score: Match(&permissions[j], req)}
+			if m.score < 0 {
+				continue
+			}
+			if m.permission.IsDeny() {
+				deny = m.better(deny)
+			} else {
+				allow = m.better(allow)
+			}
+		}
+	}
+
+	d := &Decision{Request: req}
+	switch {
+	case deny != nil:
+		d.Grant, d.Permission = deny.grant, deny.permission
+		reason := "显式拒绝该操作"
+		if deny.permission.Effect != model.EffectDeny {
+			reason = "效果无效, 按拒绝处理"
+		}
+		d.Reason = fmt.Sprintf("角色%s(%s)的权限%s(%s)%s",
+			deny.grant.Role.Name, deny.grant.Source(), deny.permission.Name, PermissionString(deny.permission), reason)
+	case allow != nil:
+		d.Allowed = true
+		d.Grant, d.Permission = allow.grant, allow.permission
+		d.Reason = fmt.Sprintf("角色%s(%s)的权限%s(%s)允许该操作",
+			allow.grant.Role.Name, allow.grant.Source(), allow.permission.Name, PermissionString(allow.permission))
+	case len(checked) > 0:
+		d.Reason = fmt.Sprintf("已检查角色[%s], 均未授予该权限, 默认拒绝", strings.Join(checked, ", "))
+	default:
+		d.Reason = "没有角色授予该权限, 默认拒绝"
+	}
+	return d, nil
+}
+
+type match struct {
+	grant      *Grant
+	permission *model.Permission
+	score      int
+}
+
+// better 返回两者中更具体的匹配, 具体程度相同时保留先出现的
+func (m *match) better(other *match) *match {
+	if other == nil || m.score > other.score {
+		return m
+	}
+	return other
+}
+
+// Match 判断权限是否匹配请求, 不匹配返回 -1, 匹配时返回值越大表示越具体;
+// 只比较类别、操作与资源, 效果由调用方通过 IsDeny 区分, Effect 无效的权限按拒绝参与决策
+func Match(p *model.Permission, req Request) int {
+	score := 0
+	switch {
+	case p.Category == req.Category:
+		score += 2
+	case p.Category != Wildcard:
+		return -1
+	}
+	switch {
+	case p.Action == req.Action:
+		score += 1
+	case p.Action != Wildcard:
+		return -1
+	}
+	switch {
+	case p.ResourceID != 0 && p.ResourceID == req.ResourceID:
+		score += 4
+	case p.ResourceID != 0:
+		return -1
+	}
+	return score
+}
+
+func PermissionString(p *model.Permission) string {
+	effect := p.Effect
+	if effect == "" {
+		effect = model.EffectAllow
+	}
+	return fmt.Sprintf("%s %s:%s:%s", effect, p.Category, resourceString(p.ResourceID), p.Action)
+}
+
+func resourceString(id uint) string {
+	if id == 0 {
+		return Wildcard
+	}
+	return fmt.Sprint(id)
+}
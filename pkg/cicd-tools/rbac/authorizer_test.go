@@ -0,0 +1,528 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package rbac
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+	"devops/cicd-tools/pkg/cicd-tools/store/memstore"
+)
+
+// fixture 在内存存储中构造用户、组、角色与项目环境
+type fixture struct {
+	t *testing.T
+	s model.Store
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	return &fixture{t: t, s: memstore.New()}
+}
+
+func (f *fixture) check(err error) {
+	f.t.Helper()
+	if err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+func (f *fixture) user(name string) *model.User {
+	f.t.Helper()
+	u := &model.User{Name: name, Email: name + "@example.org"}
+	f.check(f.s.Users().Create(u))
+	return u
+}
+
+// role 创建角色, perms 的格式为 [effect ]category:action[#resourceID], 如 "deny env:deploy#3"
+func (f *fixture) role(name string, parents []*model.Role, perms ...string) *model.Role {
+	f.t.Helper()
+	r := &model.Role{Name: name}
+	f.check(f.s.Roles().Create(r))
+	for _, p := range parents {
+		_, err := f.s.Roles().AddParent(r.ID, p.ID)
+		f.check(err)
+	}
+	for i, perm := range perms {
+		f.check(f.s.Roles().AddPermission(parsePermission(f.t, r, i, perm)))
+	}
+	return r
+}
+
+func parsePermission(t *testing.T, r *model.Role, i int, s string) *model.Permission {
+	t.Helper()
+	p := &model.Permission{RoleID: r.ID, Effect: model.EffectAllow}
+	if fields := strings.Fields(s); len(fields) == 2 {
+		p.Effect, s = fields[0], fields[1]
+	}
+	if n := strings.Index(s, "#"); n >= 0 {
+		id, err := strconv.ParseUint(s[n+1:], 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.ResourceID, s = uint(id), s[:n]
+	}
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		t.Fatalf("权限%s格式错误", s)
+	}
+	p.Category, p.Action = parts[0], parts[1]
+	p.Name = fmt.Sprintf("%s-%d", r.Name, i)
+	return p
+}
+
+func (f *fixture) group(name string, users ...*model.User) *model.Group {
+	f.t.Helper()
+	g := &model.Group{Name: name}
+	f.check(f.s.Groups().Create(g))
+	for _, u := range users {
+		_, err := f.s.Users().AddGroup(u.ID, g.ID)
+		f.check(err)
+	}
+	return g
+}
+
+// project 创建项目与环境并关联
+func (f *fixture) project(name string, envs ...string) (*model.Project, []*model.Env) {
+	f.t.Helper()
+	p := &model.Project{Name: name}
+	f.check(f.s.Projects().Create(p))
+	values := make([]*model.Env, 0, len(envs))
+	for _, name := range envs {
+		e := &model.Env{Name: name}
+		if found, err := f.s.Projects().FirstEnv(&model.Env{Name: name}); err == nil {
+			e = found
+		} else {
+			f.check(f.s.Projects().FirstOrCreateEnv(e))
+		}
+		_, err := f.s.Projects().AddEnv(p.ID, e.ID)
+		f.check(err)
+		values = append(values, e)
+	}
+	return p, values
+}
+
+// bindUser 在 scope 范围内为用户绑定角色, expiresAt 为 nil 时长期有效
+func (f *fixture) bindUser(u *model.User, r *model.Role, scope model.Scope, expiresAt *time.Time) {
+	f.t.Helper()
+	projectID, projectEnvID, err := model.ResolveScope(f.s, scope)
+	f.check(err)
+	f.check(f.s.Users().AddRoleBinding(&model.UserRole{UserID: u.ID, RoleID: r.ID, ProjectID: projectID, ProjectEnvID: projectEnvID, ExpiresAt: expiresAt}))
+}
+
+func (f *fixture) bindGroup(g *model.Group, r *model.Role, scope model.Scope, expiresAt *time.Time) {
+	f.t.Helper()
+	projectID, projectEnvID, err := model.ResolveScope(f.s, scope)
+	f.check(err)
+	f.check(f.s.Groups().AddRoleBinding(&model.GroupRole{GroupID: g.ID, RoleID: r.ID, ProjectID: projectID, ProjectEnvID: projectEnvID, ExpiresAt: expiresAt}))
+}
+
+// TestDeployDeny 对某个环境显式拒绝部署, 优先于继承或组获得的通配允许
+func TestDeployDeny(t *testing.T) {
+	f := newFixture(t)
+	pay, envs := f.project("pay", "dev", "prod")
+	dev, prod := envs[0], envs[1]
+
+	admin := f.role("admin", nil, "*:*")
+	ops := f.role("ops", []*model.Role{admin})
+	contractor := f.role("contractor", nil, fmt.Sprintf("deny env:deploy#%d", prod.ID))
+
+	// alice 通过继承获得允许, 通过组获得拒绝
+	alice := f.user("alice")
+	f.bindUser(alice, ops, model.Scope{}, nil)
+	f.bindGroup(f.group("outsourcing", alice), contractor, model.Scope{ProjectID: pay.ID}, nil)
+	// bob 通过组获得允许, 直接绑定拒绝
+	bob := f.user("bob")
+	f.bindGroup(f.group("platform", bob), admin, model.Scope{}, nil)
+	f.bindUser(bob, contractor, model.Scope{}, nil)
+	// carol 只有继承的允许
+	carol := f.user("carol")
+	f.bindUser(carol, ops, model.Scope{ProjectID: pay.ID}, nil)
+
+	tests := []struct {
+		name    string
+		user    *model.User
+		env     *model.Env
+		allowed bool
+		role    string
+	}{
+		{"inherited allow, group deny", alice, prod, false, "contractor"},
+		{"inherited allow, other env", alice, dev, true, "admin"},
+		{"group allow, direct deny", bob, prod, false, "contractor"},
+		{"group allow, other env", bob, dev, true, "admin"},
+		{"inherited allow only", carol, prod, true, "admin"},
+	}
+	a := NewAuthorizer(f.s)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := a.Authorize(Deploy(tt.user.ID, pay.ID, tt.env.ID))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.Allowed != tt.allowed || d.Grant == nil || d.Grant.Role.Name != tt.role {
+				t.Fatalf("Authorize = %s", d)
+			}
+			if !tt.allowed && (d.Permission == nil || !d.Permission.IsDeny() || d.Permission.ResourceID != prod.ID) {
+				t.Fatalf("Permission = %+v", d.Permission)
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	req := Request{Category: "build", Action: "read", ResourceID: 5}
+	tests := []struct {
+		category, action string
+		resourceID       uint
+		want             int
+	}{
+		{"*", "*", 0, 0},
+		{"*", "read", 0, 1},
+		{"build", "*", 0, 2},
+		{"build", "read", 0, 3},
+		{"*", "*", 5, 4},
+		{"build", "read", 5, 7},
+		{"build", "read", 6, -1},
+		{"env", "read", 0, -1},
+		{"build", "update", 0, -1},
+	}
+	for _, tt := range tests {
+		p := &model.Permission{Category: tt.category, Action: tt.action, ResourceID: tt.resourceID}
+		if got := Match(p, req); got != tt.want {
+			t.Errorf("Match(%s, %s) = %d, want %d", PermissionString(p), req, got, tt.want)
+		}
+	}
+	if got := Match(&model.Permission{Category: "build", Action: "read", ResourceID: 5}, Request{Category: "build", Action: "read"}); got != -1 {
+		t.Errorf("限定资源的权限不应匹配未指定资源的请求, got %d", got)
+	}
+}
+
+// TestAuthorize 显式拒绝 > 显式允许 > 默认拒绝, 同一优先级内选择最具体的权限
+func TestAuthorize(t *testing.T) {
+	f := newFixture(t)
+	viewer := f.role("viewer", nil, "*:read")
+	builder := f.role("builder", nil, "build:*", "build:read#7", "build:restart#7")
+	guard := f.role("guard", nil, "deny build:delete#9", "deny *:purge", "deny *:restart")
+	alice := f.user("alice")
+	for _, r := range []*model.Role{viewer, builder, guard} {
+		f.bindUser(alice, r, model.Scope{}, nil)
+	}
+	nobody := f.user("nobody")
+
+	tests := []struct {
+		name       string
+		user       *model.User
+		req        string
+		resourceID uint
+		allowed    bool
+		permission string
+		reason     string
+	}{
+		{"most specific allow", alice, "build:read", 0, true, "builder-0", "允许该操作"},
+		{"resource allow", alice, "build:read", 7, true, "builder-1", "允许该操作"},
+		{"wildcard category", alice, "user:read", 0, true, "viewer-0", "允许该操作"},
+		{"deny over allow", alice, "build:delete", 9, false, "guard-0", "显式拒绝该操作"},
+		{"deny other resource", alice, "build:delete", 8, true, "builder-0", "允许该操作"},
+		{"wildcard deny", alice, "user:purge", 0, false, "guard-1", "显式拒绝该操作"},
+		{"less specific deny", alice, "build:restart", 7, false, "guard-2", "显式拒绝该操作"},
+		{"default deny", alice, "user:delete", 0, false, "", "已检查角色[viewer, builder, guard]"},
+		{"no roles", nobody, "user:read", 0, false, "", "没有角色授予该权限"},
+	}
+	a := NewAuthorizer(f.s)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts := strings.SplitN(tt.req, ":", 2)
+			d, err := a.Authorize(Request{UserID: tt.user.ID, Category: parts[0], Action: parts[1], ResourceID: tt.resourceID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.Allowed != tt.allowed || !strings.Contains(d.Reason, tt.reason) {
+				t.Fatalf("Authorize = %s", d)
+			}
+			name := ""
+			if d.Permission != nil {
+				name = d.Permission.Name
+			}
+			if name != tt.permission {
+				t.Fatalf("Permission = %s, want %s (%s)", name, tt.permission, d)
+			}
+		})
+	}
+}
+
+// TestAuthorizeGroup 通过组获得的角色与直接绑定的角色同样生效, 说明中给出组名
+func TestAuthorizeGroup(t *testing.T) {
+	f := newFixture(t)
+	viewer := f.role("viewer", nil, "*:read")
+	guard := f.role("guard", nil, "deny user:read")
+	alice, bob := f.user("alice"), f.user("bob")
+	dev := f.group("dev", alice, bob)
+	f.bindGroup(dev, viewer, model.Scope{}, nil)
+	f.bindGroup(f.group("contractors", bob), guard, model.Scope{}, nil)
+
+	a := NewAuthorizer(f.s)
+	d, err := a.Authorize(Request{UserID: alice.ID, Category: "build", Action: "read"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Allowed || d.Grant.Group == nil || d.Grant.Group.Name != "dev" || !strings.Contains(d.Reason, "通过组dev") {
+		t.Fatalf("alice: %s", d)
+	}
+	d, err = a.Authorize(Request{UserID: bob.ID, Category: "user", Action: "read"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Allowed || d.Grant.Group == nil || d.Grant.Group.Name != "contractors" {
+		t.Fatalf("bob: %s", d)
+	}
+
+	// 移出组后不再拥有组的角色
+	f.check(f.s.Users().RemoveGroup(alice.ID, dev.ID))
+	d, err = a.Authorize(Request{UserID: alice.ID, Category: "build", Action: "read"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Allowed {
+		t.Fatalf("alice after leaving dev: %s", d)
+	}
+}
+
+// TestAuthorizeInheritance 继承的角色沿用原绑定的途径与范围, 说明中给出继承来源
+func TestAuthorizeInheritance(t *testing.T) {
+	f := newFixture(t)
+	pay, _ := f.project("pay", "dev")
+	shop, _ := f.project("shop", "dev")
+	viewer := f.role("viewer", nil, "*:read")
+	developer := f.role("developer", []*model.Role{viewer}, "build:*")
+	admin := f.role("project-admin", []*model.Role{developer}, "project:update")
+	alice, bob := f.user("alice"), f.user("bob")
+	f.bindUser(alice, admin, model.Scope{}, nil)
+	f.bindGroup(f.group("dev", bob), developer, model.Scope{ProjectID: pay.ID}, nil)
+
+	a := NewAuthorizer(f.s)
+	grants, err := a.EffectiveRoles(alice.ID, model.Scope{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, g := range grants {
+		names = append(names, g.Role.Name)
+	}
+	if strings.Join(names, ",") != "project-admin,developer,viewer" {
+		t.Fatalf("EffectiveRoles = %v", names)
+	}
+
+	tests := []struct {
+		name      string
+		user      *model.User
+		req       string
+		scope     model.Scope
+		allowed   bool
+		role      string
+		inherited string
+		group     string
+	}{
+		{"bound role", alice, "project:update", model.Scope{}, true, "project-admin", "", ""},
+		{"parent", alice, "build:read", model.Scope{}, true, "developer", "project-admin", ""},
+		{"grandparent", alice, "user:read", model.Scope{}, true, "viewer", "project-admin", ""},
+		{"not inherited downwards", bob, "project:update", model.Scope{ProjectID: pay.ID}, false, "", "", ""},
+		{"group and parent", bob, "user:read", model.Scope{ProjectID: pay.ID}, true, "viewer", "developer", "dev"},
+		{"parent keeps binding scope", bob, "user:read", model.Scope{ProjectID: shop.ID}, false, "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts := strings.SplitN(tt.req, ":", 2)
+			d, err := a.Authorize(Request{UserID: tt.user.ID, Category: parts[0], Action: parts[1], Scope: tt.scope})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.Allowed != tt.allowed {
+				t.Fatalf("Authorize = %s", d)
+			}
+			if !tt.allowed {
+				return
+			}
+			g := d.Grant
+			inherited, group := "", ""
+			if g.InheritedFrom != nil {
+				inherited = g.InheritedFrom.Name
+				if !strings.Contains(d.Reason, "由角色"+inherited+"继承") {
+					t.Fatalf("Reason = %s", d.Reason)
+				}
+			}
+			if g.Group != nil {
+				group = g.Group.Name
+			}
+			if g.Role.Name != tt.role || inherited != tt.inherited || group != tt.group {
+				t.Fatalf("Grant = %s via %q/%q (%s)", g.Role.Name, inherited, group, d)
+			}
+		})
+	}
+}
+
+// TestRoleCycle 保存时拒绝循环继承, 数据中已有的环也不会导致鉴权死循环
+func TestRoleCycle(t *testing.T) {
+	f := newFixture(t)
+	base := f.role("base", nil, "build:read")
+	mid := f.role("mid", []*model.Role{base})
+	top := f.role("top", []*model.Role{mid}, "build:update")
+
+	tests := []struct {
+		name     string
+		role     *model.Role
+		parent   *model.Role
+		rejected bool
+	}{
+		{"self", base, base, true},
+		{"direct", base, mid, true},
+		{"indirect", base, top, true},
+		{"child as parent", mid, top, true},
+		{"new branch", top, base, false},
+	}
+	for _, tt := range tests {
+		if err := model.CheckRoleCycle(f.s, tt.role.ID, tt.parent.ID); (err != nil) != tt.rejected {
+			t.Errorf("%s: CheckRoleCycle(%s, %s) = %v", tt.name, tt.role.Name, tt.parent.Name, err)
+		}
+	}
+	err := f.s.Transaction(func(s model.Store) error {
+		return model.SetRoleParents(s, base.ID, []uint{top.ID})
+	})
+	if err == nil {
+		t.Fatal("SetRoleParents 形成循环时应返回错误")
+	}
+	if parents, _ := f.s.Roles().Parents(base.ID); len(parents) != 0 {
+		t.Fatalf("base parents = %v", parents)
+	}
+
+	// 绕过检查直接写入环: base -> top -> mid -> base
+	_, err = f.s.Roles().AddParent(base.ID, top.ID)
+	f.check(err)
+	alice := f.user("alice")
+	f.bindUser(alice, base, model.Scope{}, nil)
+	a := NewAuthorizer(f.s)
+	grants, err := a.EffectiveRoles(alice.ID, model.Scope{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(grants) != 3 {
+		t.Fatalf("EffectiveRoles = %d grants", len(grants))
+	}
+	d, err := a.Authorize(Request{UserID: alice.ID, Category: "build", Action: "update"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Allowed || d.Grant.Role.Name != "top" || d.Grant.InheritedFrom.Name != "base" {
+		t.Fatalf("Authorize = %s", d)
+	}
+}
+
+// TestAuthorizeScope 全局绑定处处生效, 项目绑定在该项目的任意环境内生效, 环境绑定只在该环境内生效
+func TestAuthorizeScope(t *testing.T) {
+	f := newFixture(t)
+	pay, payEnvs := f.project("pay", "dev", "prod")
+	shop, shopEnvs := f.project("shop", "dev", "prod")
+	dev, prod := payEnvs[0], payEnvs[1]
+	if shopEnvs[0].ID != dev.ID {
+		t.Fatal("项目应共用环境")
+	}
+	reader := f.role("reader", nil, "project:read")
+	builder := f.role("builder", nil, "build:create")
+	deployer := f.role("deployer", nil, "env:deploy")
+
+	alice := f.user("alice")
+	f.bindUser(alice, reader, model.Scope{}, nil)
+	f.bindUser(alice, builder, model.Scope{ProjectID: pay.ID}, nil)
+	f.bindGroup(f.group("ops", alice), deployer, model.Scope{ProjectID: pay.ID, EnvID: prod.ID}, nil)
+
+	global := model.Scope{}
+	payScope := model.Scope{ProjectID: pay.ID}
+	payDev := model.Scope{ProjectID: pay.ID, EnvID: dev.ID}
+	payProd := model.Scope{ProjectID: pay.ID, EnvID: prod.ID}
+	shopProd := model.Scope{ProjectID: shop.ID, EnvID: prod.ID}
+	tests := []struct {
+		req     string
+		scope   model.Scope
+		allowed bool
+	}{
+		{"project:read", global, true},
+		{"project:read", shopProd, true},
+		{"build:create", global, false},
+		{"build:create", payScope, true},
+		{"build:create", payDev, true},
+		{"build:create", shopProd, false},
+		{"env:deploy", payScope, false},
+		{"env:deploy", payDev, false},
+		{"env:deploy", payProd, true},
+		{"env:deploy", shopProd, false},
+	}
+	a := NewAuthorizer(f.s)
+	for _, tt := range tests {
+		parts := strings.SplitN(tt.req, ":", 2)
+		d, err := a.Authorize(Request{UserID: alice.ID, Category: parts[0], Action: parts[1], Scope: tt.scope})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Allowed != tt.allowed {
+			t.Errorf("%s@%s: %s", tt.req, tt.scope, d)
+		}
+	}
+
+	// AllRoles 与 Holds 不按范围过滤
+	all, err := a.AllRoles(alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("AllRoles = %d grants", len(all))
+	}
+	if ok, err := a.Holds(alice.ID, "env", "deploy"); err != nil || !ok {
+		t.Fatalf("Holds(env:deploy) = %v, %v", ok, err)
+	}
+
+	// 环境需已关联到项目
+	other := &model.Env{Name: "staging"}
+	f.check(f.s.Projects().FirstOrCreateEnv(other))
+	if _, _, err := model.ResolveScope(f.s, model.Scope{ProjectID: pay.ID, EnvID: other.ID}); err == nil {
+		t.Fatal("未关联的环境不应能作为绑定范围")
+	}
+	if _, _, err := model.ResolveScope(f.s, model.Scope{EnvID: prod.ID}); err == nil {
+		t.Fatal("限定环境时必须指定项目")
+	}
+}
+
+// TestAuthorizeDeletedRole 指向已删除角色的绑定被忽略
+func TestAuthorizeDeletedRole(t *testing.T) {
+	f := newFixture(t)
+	viewer := f.role("viewer", nil, "*:read")
+	gone := f.role("gone", nil, "*:*")
+	alice := f.user("alice")
+	f.bindUser(alice, viewer, model.Scope{}, nil)
+	f.bindUser(alice, gone, model.Scope{}, nil)
+	f.check(f.s.Roles().Delete(gone.ID))
+
+	d, err := NewAuthorizer(f.s).Authorize(Request{UserID: alice.ID, Category: "build", Action: "update"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Allowed || !strings.Contains(d.Reason, "[viewer]") {
+		t.Fatalf("Authorize = %s", d)
+	}
+}
@@ -0,0 +1,314 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package rbac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+	"devops/cicd-tools/pkg/util/logger"
+)
+
+// 审批角色申请所需的权限, ResourceID 为申请的角色 ID, 在申请的范围内鉴权
+const (
+	CategoryRole  = "role"
+	ActionApprove = "approve"
+)
+
+// Workflow 角色申请与临时授权流程, 每次状态变更都记录到 RoleGrantLog
+type Workflow struct {
+	store model.Store
+	now   func() time.Time
+}
+
+func NewWorkflow(s model.Store) *Workflow {
+	return &Workflow{store: s, now: time.Now}
+}
+
+// Request 用户申请在 scope 范围内获得角色, duration 为批准后的有效时长, 为 0 时长期有效
+func (w *Workflow) Request(uid uint, rid uint, scope model.Scope, duration time.Duration, reason string) (*model.RoleRequest, error) {
+	if duration < 0 {
+		return nil, fmt.Errorf("申请的有效时长%s无效", duration)
+	}
+	if _, err := w.store.Users().Get(uid); err != nil {
+		return nil, fmt.Errorf("用户%d不存在\n%w", uid, err)
+	}
+	role, err := w.store.Roles().Get(rid)
+	if err != nil {
+		return nil, fmt.Errorf("角色%d不存在\n%w", rid, err)
+	}
+	projectID, projectEnvID, err := model.ResolveScope(w.store, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &model.RoleRequest{
+		UserID:       uid,
+		RoleID:       rid,
+		ProjectID:    projectID,
+		ProjectEnvID: projectEnvID,
+		Duration:     int64(duration / time.Second),
+		Reason:       reason,
+		Status:       model.RequestPending,
+	}
+	err = w.store.Transaction(func(s model.Store) error {
+		pending, err := s.Grants().FindRequests(&model.RoleRequest{UserID: uid, RoleID: rid, Status: model.RequestPending})
+		if err != nil {
+			return err
+		}
+		for _, value := range pending {
+			if value.ProjectID == projectID && value.ProjectEnvID == projectEnvID {
+				return fmt.Errorf("用户%d已在%s范围内申请角色%s, 申请%d尚未处理", uid, scope, role.Name, value.ID)
+			}
+		}
+		if err := s.Grants().CreateRequest(r); err != nil {
+			return err
+		}
+		return s.Grants().AddLog(requestLog(r, model.GrantRequested, uid, reason))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("创建角色申请失败\n%w", err)
+	}
+	return r, nil
+}
+
+// Approve 批准申请并创建角色绑定, 审批人需在申请范围内拥有 role:<角色ID>:approve 权限, 且不能审批自己的申请
+func (w *Workflow) Approve(id uint, approverID uint, comment string) (*model.RoleRequest, error) {
+	now := w.now()
+	var r *model.RoleRequest
+	err := w.store.Transaction(func(s model.Store) error {
+		var err error
+		if r, err = decidable(s, id, approverID); err != nil {
+			return err
+		}
+		var expiresAt *time.Time
+		if r.Duration > 0 {
+			t := now.Add(time.Duration(r.Duration) * time.Second)
+			expiresAt = &t
+		}
+		ur, err := userBinding(s, r)
+		if err != nil {
+			return err
+		}
+		if ur == nil || !covers(ur.ExpiresAt, expiresAt) {
+			ur = &model.UserRole{
+				UserID:       r.UserID,
+				RoleID:       r.RoleID,
+				ProjectID:    r.ProjectID,
+				ProjectEnvID: r.ProjectEnvID,
+				ExpiresAt:    expiresAt,
+			}
+			if err := s.Users().AddRoleBinding(ur); err != nil {
+				return err
+			}
+		}
+		r.Status = model.RequestApproved
+		r.ApproverID = approverID
+		r.Comment = comment
+		r.DecidedAt = &now
+		r.UserRoleID = ur.ID
+		if err := s.Grants().SaveRequest(r); err != nil {
+			return err
+		}
+		l := requestLog(r, model.GrantApproved, approverID, comment)
+		l.ExpiresAt = ur.ExpiresAt
+		return s.Grants().AddLog(l)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("批准角色申请%d失败\n%w", id, err)
+	}
+	return r, nil
+}
+
+// Reject 拒绝申请, 审批人的要求与 Approve 相同
+func (w *Workflow) Reject(id uint, approverID uint, comment string) (*model.RoleRequest, error) {
+	now := w.now()
+	var r *model.RoleRequest
+	err := w.store.Transaction(func(s model.Store) error {
+		var err error
+		if r, err = decidable(s, id, approverID); err != nil {
+			return err
+		}
+		r.Status = model.RequestRejected
+		r.ApproverID = approverID
+		r.Comment = comment
+		r.DecidedAt = &now
+		if err := s.Grants().SaveRequest(r); err != nil {
+			return err
+		}
+		return s.Grants().AddLog(requestLog(r, model.GrantRejected, approverID, comment))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("拒绝角色申请%d失败\n%w", id, err)
+	}
+	return r, nil
+}
+
+// decidable 在审批的事务内锁定申请, 检查申请是否待处理以及审批人是否有权处理,
+// 鉴权与批准在同一事务中, 审批人的权限在提交前被撤销时不会批准
+func decidable(s model.Store, id uint, approverID uint) (*model.RoleRequest, error) {
+	r, err := lockPending(s, id)
+	if err != nil {
+		return nil, err
+	}
+	if r.UserID == approverID {
+		return nil, errors.New("不能审批自己的角色申请")
+	}
+	scope, err := model.BindingScope(s, r.ProjectID, r.ProjectEnvID)
+	if err != nil {
+		return nil, err
+	}
+	d, err := NewAuthorizer(s).Authorize(Request{
+		UserID:     approverID,
+		Category:   CategoryRole,
+		ResourceID: r.RoleID,
+		Action:     ActionApprove,
+		Scope:      scope,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !d.Allowed {
+		return nil, fmt.Errorf("用户%d无权审批角色申请%d: %s", approverID, id, d.Reason)
+	}
+	return r, nil
+}
+
+// lockPending 在事务内锁定申请并检查状态, 避免并发审批时重复处理
+func lockPending(s model.Store, id uint) (*model.RoleRequest, error) {
+	r, err := s.Grants().LockRequest(id)
+	if err != nil {
+		return nil, fmt.Errorf("角色申请%d不存在\n%w", id, err)
+	}
+	if !r.IsPending() {
+		return nil, fmt.Errorf("角色申请%d已处理, 当前状态为%s", id, r.Status)
+	}
+	return r, nil
+}
+
+// userBinding 查询申请范围内用户已有的角色绑定, 不存在时返回 nil
+func userBinding(s model.Store, r *model.RoleRequest) (*model.UserRole, error) {
+	bindings, err := s.Users().RoleBindings(r.UserID)
+	if err != nil {
+		return nil, err
+	}
+	for _, value := range bindings {
+		if value.RoleID == r.RoleID && value.ProjectID == r.ProjectID && value.ProjectEnvID == r.ProjectEnvID {
+			return &value, nil
+		}
+	}
+	return nil, nil
+}
+
+// covers 判断已有绑定的过期时间 current 是否不早于 expiresAt, nil 表示长期有效;
+// 批准申请只会延长已有绑定, 不会把长期绑定改为临时绑定或提前其过期时间
+func covers(current *time.Time, expiresAt *time.Time) bool {
+	if current == nil {
+		return true
+	}
+	return expiresAt != nil && !current.Before(*expiresAt)
+}
+
+// Sweep 删除在当前时间已过期的用户和组的角色绑定, 返回删除的数量
+func (w *Workflow) Sweep() (int, error) {
+	now := w.now()
+	count := 0
+	err := w.store.Transaction(func(s model.Store) error {
+		userRoles, err := s.Grants().ExpiredUserRoles(now)
+		if err != nil {
+			return err
+		}
+		for _, value := range userRoles {
+			if err := s.Users().RemoveRoleBinding(value.ID); err != nil {
+				return err
+			}
+			err := s.Grants().AddLog(&model.RoleGrantLog{
+				Action:       model.GrantExpired,
+				UserID:       value.UserID,
+				RoleID:       value.RoleID,
+				ProjectID:    value.ProjectID,
+				ProjectEnvID: value.ProjectEnvID,
+				ExpiresAt:    value.ExpiresAt,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		groupRoles, err := s.Grants().ExpiredGroupRoles(now)
+		if err != nil {
+			return err
+		}
+		for _, value := range groupRoles {
+			if err := s.Groups().RemoveRoleBinding(value.ID); err != nil {
+				return err
+			}
+			err := s.Grants().AddLog(&model.RoleGrantLog{
+				Action:       model.GrantExpired,
+				GroupID:      value.GroupID,
+				RoleID:       value.RoleID,
+				ProjectID:    value.ProjectID,
+				ProjectEnvID: value.ProjectEnvID,
+				ExpiresAt:    value.ExpiresAt,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		count = len(userRoles) + len(groupRoles)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("清理过期的角色绑定失败\n%w", err)
+	}
+	return count, nil
+}
+
+// Run 每隔 interval 执行一次 Sweep, 直到 ctx 结束; 单次失败只记录日志, 不中断任务
+func (w *Workflow) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		count, err := w.Sweep()
+		if err != nil {
+			logger.Error(err)
+		} else if count > 0 {
+			logger.Info(fmt.Sprintf("已清理%d个过期的角色绑定", count))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func requestLog(r *model.RoleRequest, action string, actorID uint, comment string) *model.RoleGrantLog {
+	return &model.RoleGrantLog{
+		Action:       action,
+		RequestID:    r.ID,
+		UserID:       r.UserID,
+		RoleID:       r.RoleID,
+		ProjectID:    r.ProjectID,
+		ProjectEnvID: r.ProjectEnvID,
+		ActorID:      actorID,
+		Comment:      comment,
+	}
+}
@@ -0,0 +1,283 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package rbac
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+// TestAuthorizeExpiry 已过期的用户与组绑定在鉴权时被忽略
+func TestAuthorizeExpiry(t *testing.T) {
+	f := newFixture(t)
+	past, future := time.Now().Add(-time.Minute), time.Now().Add(time.Hour)
+	oncall := f.role("oncall", nil, "env:deploy")
+	viewer := f.role("viewer", nil, "*:read")
+	alice, bob, carol := f.user("alice"), f.user("bob"), f.user("carol")
+	f.bindUser(alice, oncall, model.Scope{}, &past)
+	f.bindUser(bob, oncall, model.Scope{}, &future)
+	f.bindGroup(f.group("ops", alice, carol), viewer, model.Scope{}, &past)
+
+	tests := []struct {
+		user    *model.User
+		req     string
+		allowed bool
+	}{
+		{alice, "env:deploy", false},
+		{alice, "user:read", false},
+		{bob, "env:deploy", true},
+		{carol, "user:read", false},
+	}
+	a := NewAuthorizer(f.s)
+	for _, tt := range tests {
+		parts := strings.SplitN(tt.req, ":", 2)
+		d, err := a.Authorize(Request{UserID: tt.user.ID, Category: parts[0], Action: parts[1]})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Allowed != tt.allowed {
+			t.Errorf("%s %s: %s", tt.user.Name, tt.req, d)
+		}
+		if d.Allowed && (d.Grant.ExpiresAt == nil || !strings.Contains(d.Reason, "有效期至")) {
+			t.Errorf("%s %s: 说明中应包含过期时间: %s", tt.user.Name, tt.req, d)
+		}
+	}
+	if ok, err := a.Holds(alice.ID, "env", "deploy"); err != nil || ok {
+		t.Fatalf("Holds = %v, %v", ok, err)
+	}
+}
+
+func TestCovers(t *testing.T) {
+	now := time.Now()
+	earlier, later := now.Add(-time.Hour), now.Add(time.Hour)
+	tests := []struct {
+		name               string
+		current, expiresAt *time.Time
+		want               bool
+	}{
+		{"permanent covers permanent", nil, nil, true},
+		{"permanent covers temporary", nil, &now, true},
+		{"temporary does not cover permanent", &now, nil, false},
+		{"later covers earlier", &later, &now, true},
+		{"same time", &now, &now, true},
+		{"earlier does not cover later", &earlier, &now, false},
+	}
+	for _, tt := range tests {
+		if got := covers(tt.current, tt.expiresAt); got != tt.want {
+			t.Errorf("%s: covers = %v", tt.name, got)
+		}
+	}
+}
+
+// workflowFixture 项目 pay 的 prod 环境, 角色 oncall, 申请人 alice, 在 pay 内可审批 oncall 的 bob
+type workflowFixture struct {
+	*fixture
+	w        *Workflow
+	now      time.Time
+	scope    model.Scope
+	oncall   *model.Role
+	alice    *model.User
+	bob      *model.User
+	outsider *model.User
+}
+
+func newWorkflowFixture(t *testing.T) *workflowFixture {
+	f := &workflowFixture{fixture: newFixture(t), now: time.Now().Truncate(time.Second)}
+	pay, envs := f.project("pay", "prod")
+	shop, _ := f.project("shop", "prod")
+	f.scope = model.Scope{ProjectID: pay.ID, EnvID: envs[0].ID}
+	f.oncall = f.role("oncall", nil, "env:deploy")
+	approver := f.role("approver", nil, fmt.Sprintf("role:approve#%d", f.oncall.ID))
+	f.alice, f.bob, f.outsider = f.user("alice"), f.user("bob"), f.user("outsider")
+	f.bindUser(f.bob, approver, model.Scope{ProjectID: pay.ID}, nil)
+	f.bindUser(f.outsider, approver, model.Scope{ProjectID: shop.ID}, nil)
+	f.w = NewWorkflow(f.s)
+	f.w.now = func() time.Time { return f.now }
+	return f
+}
+
+func (f *workflowFixture) request(duration time.Duration) *model.RoleRequest {
+	f.t.Helper()
+	r, err := f.w.Request(f.alice.ID, f.oncall.ID, f.scope, duration, "处理故障")
+	f.check(err)
+	return r
+}
+
+// actions 返回申请的变更记录
+func (f *workflowFixture) actions(r *model.RoleRequest) []string {
+	f.t.Helper()
+	logs, err := f.s.Grants().FindLogs(&model.RoleGrantLog{RequestID: r.ID})
+	f.check(err)
+	var actions []string
+	for _, l := range logs {
+		actions = append(actions, l.Action)
+	}
+	return actions
+}
+
+func TestWorkflowApprove(t *testing.T) {
+	f := newWorkflowFixture(t)
+	r := f.request(8 * time.Hour)
+	if _, err := f.w.Request(f.alice.ID, f.oncall.ID, f.scope, time.Hour, ""); err == nil {
+		t.Fatal("同一范围内的重复申请应被拒绝")
+	}
+	if _, err := f.w.Request(f.alice.ID, f.oncall.ID, f.scope, -time.Hour, ""); err == nil {
+		t.Fatal("负的有效时长应被拒绝")
+	}
+
+	tests := []struct {
+		name     string
+		approver *model.User
+		reason   string
+	}{
+		{"self approval", f.alice, "不能审批自己的角色申请"},
+		{"approver in other project", f.outsider, "无权审批"},
+	}
+	for _, tt := range tests {
+		if _, err := f.w.Approve(r.ID, tt.approver.ID, ""); err == nil || !strings.Contains(err.Error(), tt.reason) {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+	}
+
+	a := NewAuthorizer(f.s)
+	deploy := Deploy(f.alice.ID, f.scope.ProjectID, f.scope.EnvID)
+	if d, _ := a.Authorize(deploy); d.Allowed {
+		t.Fatalf("批准前: %s", d)
+	}
+	approved, err := f.w.Approve(r.ID, f.bob.ID, "同意")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if approved.Status != model.RequestApproved || approved.ApproverID != f.bob.ID || approved.UserRoleID == 0 {
+		t.Fatalf("approved = %+v", approved)
+	}
+	bindings, err := f.s.Users().RoleBindings(f.alice.ID)
+	f.check(err)
+	if len(bindings) != 1 || bindings[0].ExpiresAt == nil || !bindings[0].ExpiresAt.Equal(f.now.Add(8*time.Hour)) {
+		t.Fatalf("bindings = %+v", bindings)
+	}
+	if d, _ := a.Authorize(deploy); !d.Allowed {
+		t.Fatalf("批准后: %s", d)
+	}
+	if _, err := f.w.Approve(r.ID, f.bob.ID, ""); err == nil || !strings.Contains(err.Error(), "已处理") {
+		t.Fatalf("重复批准: %v", err)
+	}
+	if _, err := f.w.Reject(r.ID, f.bob.ID, ""); err == nil {
+		t.Fatal("已批准的申请不能再拒绝")
+	}
+	if got := strings.Join(f.actions(r), ","); got != "requested,approved" {
+		t.Fatalf("logs = %s", got)
+	}
+}
+
+func TestWorkflowReject(t *testing.T) {
+	f := newWorkflowFixture(t)
+	r := f.request(0)
+	if _, err := f.w.Reject(r.ID, f.alice.ID, ""); err == nil {
+		t.Fatal("不能拒绝自己的申请")
+	}
+	rejected, err := f.w.Reject(r.ID, f.bob.ID, "不需要")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rejected.Status != model.RequestRejected || rejected.Comment != "不需要" || rejected.DecidedAt == nil {
+		t.Fatalf("rejected = %+v", rejected)
+	}
+	if bindings, _ := f.s.Users().RoleBindings(f.alice.ID); len(bindings) != 0 {
+		t.Fatalf("拒绝后不应创建绑定: %+v", bindings)
+	}
+	if _, err := f.w.Approve(r.ID, f.bob.ID, ""); err == nil {
+		t.Fatal("已拒绝的申请不能再批准")
+	}
+	if got := strings.Join(f.actions(r), ","); got != "requested,rejected" {
+		t.Fatalf("logs = %s", got)
+	}
+	// 处理后可以重新申请
+	f.request(time.Hour)
+}
+
+// TestWorkflowExtend 批准只延长已有绑定, 不会缩短或把长期绑定改为临时绑定
+func TestWorkflowExtend(t *testing.T) {
+	f := newWorkflowFixture(t)
+	approve := func(duration time.Duration) {
+		t.Helper()
+		_, err := f.w.Approve(f.request(duration).ID, f.bob.ID, "")
+		f.check(err)
+	}
+	expiresAt := func() *time.Time {
+		t.Helper()
+		bindings, err := f.s.Users().RoleBindings(f.alice.ID)
+		f.check(err)
+		if len(bindings) != 1 {
+			t.Fatalf("bindings = %+v", bindings)
+		}
+		return bindings[0].ExpiresAt
+	}
+
+	approve(8 * time.Hour)
+	approve(time.Hour)
+	if got := expiresAt(); got == nil || !got.Equal(f.now.Add(8*time.Hour)) {
+		t.Fatalf("较短的申请不应缩短绑定: %v", got)
+	}
+	f.check(f.s.Transaction(func(s model.Store) error {
+		bindings, err := s.Users().RoleBindings(f.alice.ID)
+		if err != nil {
+			return err
+		}
+		return s.Users().RemoveRoleBinding(bindings[0].ID)
+	}))
+	approve(0)
+	approve(time.Hour)
+	if got := expiresAt(); got != nil {
+		t.Fatalf("长期绑定不应改为临时绑定: %v", got)
+	}
+}
+
+func TestWorkflowSweep(t *testing.T) {
+	f := newWorkflowFixture(t)
+	expired, valid := f.now.Add(-time.Second), f.now.Add(time.Hour)
+	g := f.group("ops", f.alice)
+	f.bindUser(f.alice, f.oncall, f.scope, &expired)
+	f.bindUser(f.alice, f.oncall, model.Scope{}, &valid)
+	f.bindGroup(g, f.oncall, model.Scope{}, &expired)
+	f.bindGroup(g, f.oncall, f.scope, nil)
+
+	count, err := f.w.Sweep()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Fatalf("Sweep = %d", count)
+	}
+	users, _ := f.s.Users().RoleBindings(f.alice.ID)
+	groups, _ := f.s.Groups().RoleBindings(g.ID)
+	if len(users) != 1 || users[0].ExpiresAt == nil || len(groups) != 1 || groups[0].ExpiresAt != nil {
+		t.Fatalf("users = %+v, groups = %+v", users, groups)
+	}
+	logs, err := f.s.Grants().FindLogs(&model.RoleGrantLog{Action: model.GrantExpired})
+	f.check(err)
+	if len(logs) != 2 || logs[0].UserID != f.alice.ID || logs[1].GroupID != g.ID || logs[0].ActorID != 0 {
+		t.Fatalf("logs = %+v", logs)
+	}
+	if count, err := f.w.Sweep(); err != nil || count != 0 {
+		t.Fatalf("second Sweep = %d, %v", count, err)
+	}
+}
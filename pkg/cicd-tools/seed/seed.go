@@ -0,0 +1,254 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package seed
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v3"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+// Data 初始化数据, 字段名与数据表列名保持一致
+type Data struct {
+	Groups   []Group   `yaml:"groups"`
+	Users    []User    `yaml:"users"`
+	Envs     []Env     `yaml:"envs"`
+	Items    []Item    `yaml:"items"`
+	Projects []Project `yaml:"projects"`
+}
+
+type User struct {
+	Name     string   `yaml:"user_name"`
+	FullName string   `yaml:"full_name"`
+	Gender   string   `yaml:"gender"`
+	Location string   `yaml:"location"`
+	Job      string   `yaml:"job"`
+	Email    string   `yaml:"email_address"`
+	Groups   []string `yaml:"groups"`
+}
+
+type Group struct {
+	Name  string `yaml:"group_name"`
+	Intro string `yaml:"intro"`
+}
+
+type Env struct {
+	Name  string `yaml:"env"`
+	Intro string `yaml:"intro"`
+}
+
+type Item struct {
+	Name     string `yaml:"item"`
+	Category string `yaml:"category"`
+	Language string `yaml:"language"`
+	Tier     string `yaml:"tier"`
+	Intro    string `yaml:"intro"`
+}
+
+type Project struct {
+	Name  string   `yaml:"project"`
+	Intro string   `yaml:"intro"`
+	Envs  []string `yaml:"envs"`
+	Items []string `yaml:"items"`
+}
+
+// Result 统计新建与已存在而跳过的记录数
+type Result struct {
+	Created int
+	Skipped int
+}
+
+func LoadFile(path string) (*Data, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取初始化数据文件%s失败\n%w", path, err)
+	}
+	data := new(Data)
+	if err := yaml.Unmarshal(content, data); err != nil {
+		return nil, fmt.Errorf("解析初始化数据文件%s失败\n%w", path, err)
+	}
+	return data, nil
+}
+
+// Load 按名称判断记录是否已存在, 已存在的记录不做修改, 可重复执行
+func Load(s model.Store, data *Data) (*Result, error) {
+	result := new(Result)
+	err := s.Transaction(func(tx model.Store) error {
+		l := &loader{store: tx, result: result}
+		for _, value := range data.Groups {
+			if _, err := l.group(value); err != nil {
+				return err
+			}
+		}
+		for _, value := range data.Users {
+			if err := l.user(value); err != nil {
+				return err
+			}
+		}
+		for _, value := range data.Envs {
+			if _, err := l.env(value); err != nil {
+				return err
+			}
+		}
+		for _, value := range data.Items {
+			if _, err := l.item(value); err != nil {
+				return err
+			}
+		}
+		for _, value := range data.Projects {
+			if err := l.project(value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return result, err
+}
+
+type loader struct {
+	store  model.Store
+	result *Result
+}
+
+// found 根据查询结果统计, 查询不到时返回 false 表示需要新建
+func (l *loader) found(err error) (bool, error) {
+	if err == nil {
+		l.result.Skipped++
+		return true, nil
+	} else if errors.Is(err, model.ErrNotFound) {
+		l.result.Created++
+		return false, nil
+	}
+	return false, err
+}
+
+func (l *loader) group(value Group) (*model.Group, error) {
+	g, err := l.store.Groups().First(&model.Group{Name: value.Name})
+	if ok, err := l.found(err); err != nil {
+		return nil, fmt.Errorf("查询组%s失败\n%w", value.Name, err)
+	} else if ok {
+		return g, nil
+	}
+	g = &model.Group{Name: value.Name, Intro: value.Intro}
+	if err := l.store.Groups().Create(g); err != nil {
+		return nil, fmt.Errorf("创建组%s失败\n%w", value.Name, err)
+	}
+	return g, nil
+}
+
+func (l *loader) user(value User) error {
+	if value.Email == "" {
+		return fmt.Errorf("用户%s未设置email_address", value.Name)
+	}
+	u, err := l.store.Users().First(&model.User{Email: value.Email})
+	if ok, err := l.found(err); err != nil {
+		return fmt.Errorf("查询用户%s失败\n%w", value.Name, err)
+	} else if !ok {
+		u = &model.User{
+			Name:     value.Name,
+			FullName: value.FullName,
+			Gender:   value.Gender,
+			Location: value.Location,
+			Job:      value.Job,
+			Email:    value.Email,
+		}
+		if err := l.store.Users().Create(u); err != nil {
+			return fmt.Errorf("创建用户%s失败\n%w", value.Name, err)
+		}
+	}
+
+	for _, name := range value.Groups {
+		g, err := l.store.Groups().First(&model.Group{Name: name})
+		if err != nil {
+			return fmt.Errorf("用户%s所属的组%s不存在\n%w", value.Name, name, err)
+		}
+		if _, err := l.store.Users().AddGroup(u.ID, g.ID); err != nil {
+			return fmt.Errorf("用户%s添加到组%s时发生错误\n%w", value.Name, name, err)
+		}
+	}
+	return nil
+}
+
+func (l *loader) env(value Env) (*model.Env, error) {
+	e, err := l.store.Projects().FirstEnv(&model.Env{Name: value.Name})
+	if ok, err := l.found(err); err != nil {
+		return nil, fmt.Errorf("查询环境%s失败\n%w", value.Name, err)
+	} else if ok {
+		return e, nil
+	}
+	e = &model.Env{Name: value.Name, Intro: value.Intro}
+	if err := l.store.Projects().FirstOrCreateEnv(e); err != nil {
+		return nil, fmt.Errorf("创建环境%s失败\n%w", value.Name, err)
+	}
+	return e, nil
+}
+
+func (l *loader) item(value Item) (*model.Item, error) {
+	i, err := l.store.Projects().FirstItem(&model.Item{Name: value.Name})
+	if ok, err := l.found(err); err != nil {
+		return nil, fmt.Errorf("查询应用%s失败\n%w", value.Name, err)
+	} else if ok {
+		return i, nil
+	}
+	i = &model.Item{
+		Name:     value.Name,
+		Category: value.Category,
+		Language: value.Language,
+		Tier:     value.Tier,
+		Intro:    value.Intro,
+	}
+	if err := l.store.Projects().FirstOrCreateItem(i); err != nil {
+		return nil, fmt.Errorf("创建应用%s失败\n%w", value.Name, err)
+	}
+	return i, nil
+}
+
+func (l *loader) project(value Project) error {
+	p, err := l.store.Projects().First(&model.Project{Name: value.Name})
+	if ok, err := l.found(err); err != nil {
+		return fmt.Errorf("查询项目%s失败\n%w", value.Name, err)
+	} else if !ok {
+		p = &model.Project{Name: value.Name, Intro: value.Intro}
+		if err := l.store.Projects().Create(p); err != nil {
+			return fmt.Errorf("创建项目%s失败\n%w", value.Name, err)
+		}
+	}
+
+	for _, name := range value.Envs {
+		e, err := l.store.Projects().FirstEnv(&model.Env{Name: name})
+		if err != nil {
+			return fmt.Errorf("项目%s关联的环境%s不存在\n%w", value.Name, name, err)
+		}
+		if _, err := l.store.Projects().AddEnv(p.ID, e.ID); err != nil {
+			return fmt.Errorf("项目%s关联环境%s时发生错误\n%w", value.Name, name, err)
+		}
+	}
+	for _, name := range value.Items {
+		i, err := l.store.Projects().FirstItem(&model.Item{Name: name})
+		if err != nil {
+			return fmt.Errorf("项目%s关联的应用%s不存在\n%w", value.Name, name, err)
+		}
+		if _, err := l.store.Projects().AddItem(p.ID, i.ID); err != nil {
+			return fmt.Errorf("项目%s关联应用%s时发生错误\n%w", value.Name, name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package gormstore
+
+import (
+	"gorm.io/gorm"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+type artifactStore struct {
+	db *gorm.DB
+}
+
+func (s *artifactStore) Get(id uint) (*model.Artifact, error) {
+	a := new(model.Artifact)
+	if err := get(s.db, id, a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (s *artifactStore) First(cond *model.Artifact) (*model.Artifact, error) {
+	a := new(model.Artifact)
+	if err := first(s.db, cond, a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (s *artifactStore) Find(cond *model.Artifact) ([]model.Artifact, error) {
+	var artifacts []model.Artifact
+	return artifacts, find(s.db, cond, &artifacts)
+}
+
+func (s *artifactStore) Create(a *model.Artifact) error {
+	return s.db.Create(a).Error
+}
+
+func (s *artifactStore) FirstOrCreate(a *model.Artifact) error {
+	return firstOrCreate(s.db, a)
+}
+
+func (s *artifactStore) Save(a *model.Artifact) error {
+	return s.db.Save(a).Error
+}
+
+func (s *artifactStore) Delete(id uint) error {
+	return s.db.Delete(&model.Artifact{}, id).Error
+}
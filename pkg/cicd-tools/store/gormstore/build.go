@@ -0,0 +1,195 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package gormstore
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+type buildStore struct {
+	db *gorm.DB
+}
+
+func (s *buildStore) Get(id uint) (*model.BuildInfo, error) {
+	b := new(model.BuildInfo)
+	if err := get(s.db, id, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (s *buildStore) First(cond *model.BuildInfo) (*model.BuildInfo, error) {
+	b := new(model.BuildInfo)
+	if err := first(s.db, cond, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (s *buildStore) Find(cond *model.BuildInfo) ([]model.BuildInfo, error) {
+	var builds []model.BuildInfo
+	return builds, find(s.db, cond, &builds)
+}
+
+func (s *buildStore) MaxBuildID(projectEnvItemID uint) (uint, error) {
+	var max uint
+	err := s.db.Unscoped().Model(&model.BuildInfo{}).Where("project_env_item_id = ?", projectEnvItemID).
+		Select("COALESCE(MAX(build_id), 0)").Scan(&max).Error
+	return max, err
+}
+
+func (s *buildStore) Create(b *model.BuildInfo) error {
+	if err := s.db.Create(b).Error; err != nil {
+		if duplicated(s.db, err) {
+			return fmt.Errorf("应用环境%d的构建编号%d已存在\n%w", b.ProjectEnvItemID, b.BuildID, model.ErrDuplicated)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *buildStore) Save(b *model.BuildInfo) error {
+	return s.db.Save(b).Error
+}
+
+func (s *buildStore) Delete(id uint) error {
+	return s.db.Delete(&model.BuildInfo{}, id).Error
+}
+
+func (s *buildStore) GetConfig(id uint) (*model.BuildConfig, error) {
+	c := new(model.BuildConfig)
+	if err := get(s.db, id, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *buildStore) FirstConfig(cond *model.BuildConfig) (*model.BuildConfig, error) {
+	c := new(model.BuildConfig)
+	if err := first(s.db, cond, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *buildStore) FindConfigs(cond *model.BuildConfig) ([]model.BuildConfig, error) {
+	var configs []model.BuildConfig
+	return configs, find(s.db, cond, &configs)
+}
+
+func (s *buildStore) FirstOrCreateConfig(c *model.BuildConfig) error {
+	return firstOrCreate(s.db, c)
+}
+
+func (s *buildStore) SaveConfig(c *model.BuildConfig) error {
+	return s.db.Save(c).Error
+}
+
+func (s *buildStore) DeleteConfig(id uint) error {
+	return s.db.Delete(&model.BuildConfig{}, id).Error
+}
+
+func (s *buildStore) GetRepo(id uint) (*model.GitRepo, error) {
+	r := new(model.GitRepo)
+	if err := get(s.db, id, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *buildStore) FirstRepo(cond *model.GitRepo) (*model.GitRepo, error) {
+	r := new(model.GitRepo)
+	if err := first(s.db, cond, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *buildStore) FindRepos(cond *model.GitRepo) ([]model.GitRepo, error) {
+	var repos []model.GitRepo
+	return repos, find(s.db, cond, &repos)
+}
+
+func (s *buildStore) FirstOrCreateRepo(r *model.GitRepo) error {
+	return firstOrCreate(s.db, r)
+}
+
+func (s *buildStore) SaveRepo(r *model.GitRepo) error {
+	return s.db.Save(r).Error
+}
+
+func (s *buildStore) DeleteRepo(id uint) error {
+	return s.db.Delete(&model.GitRepo{}, id).Error
+}
+
+func (s *buildStore) FirstGitConfig(cond *model.GitConfig) (*model.GitConfig, error) {
+	c := new(model.GitConfig)
+	if err := first(s.db, cond, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *buildStore) FindGitConfigs(cond *model.GitConfig) ([]model.GitConfig, error) {
+	var configs []model.GitConfig
+	return configs, find(s.db, cond, &configs)
+}
+
+func (s *buildStore) FirstOrCreateGitConfig(c *model.GitConfig) error {
+	return firstOrCreate(s.db, c)
+}
+
+func (s *buildStore) SaveGitConfig(c *model.GitConfig) error {
+	return s.db.Save(c).Error
+}
+
+func (s *buildStore) DeleteGitConfig(id uint) error {
+	return s.db.Delete(&model.GitConfig{}, id).Error
+}
+
+func (s *buildStore) FirstCommit(cond *model.CommitInfo) (*model.CommitInfo, error) {
+	c := new(model.CommitInfo)
+	if err := first(s.db, cond, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *buildStore) FindCommits(cond *model.CommitInfo) ([]model.CommitInfo, error) {
+	var commits []model.CommitInfo
+	return commits, find(s.db, cond, &commits)
+}
+
+func (s *buildStore) FirstOrCreateCommit(c *model.CommitInfo) error {
+	return firstOrCreate(s.db, c)
+}
+
+func (s *buildStore) AddLogs(logs []model.BuildLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	return s.db.Create(&logs).Error
+}
+
+func (s *buildStore) Logs(buildID uint, afterID uint) ([]model.BuildLog, error) {
+	var logs []model.BuildLog
+	return logs, s.db.Where("build_info_id = ? AND id > ?", buildID, afterID).Order("id").Find(&logs).Error
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package gormstore
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+type grantStore struct {
+	db *gorm.DB
+}
+
+func (s *grantStore) CreateRequest(r *model.RoleRequest) error {
+	return s.db.Create(r).Error
+}
+
+func (s *grantStore) GetRequest(id uint) (*model.RoleRequest, error) {
+	r := new(model.RoleRequest)
+	if err := get(s.db, id, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// LockRequest 使用 SELECT ... FOR UPDATE, SQLite 不支持行锁, 由数据库级的写锁保证串行
+func (s *grantStore) LockRequest(id uint) (*model.RoleRequest, error) {
+	r := new(model.RoleRequest)
+	if err := get(s.db.Clauses(clause.Locking{Strength: "UPDATE"}), id, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *grantStore) FindRequests(cond *model.RoleRequest) ([]model.RoleRequest, error) {
+	var requests []model.RoleRequest
+	return requests, find(s.db, cond, &requests)
+}
+
+func (s *grantStore) SaveRequest(r *model.RoleRequest) error {
+	return s.db.Save(r).Error
+}
+
+func (s *grantStore) AddLog(l *model.RoleGrantLog) error {
+	return s.db.Create(l).Error
+}
+
+func (s *grantStore) FindLogs(cond *model.RoleGrantLog) ([]model.RoleGrantLog, error) {
+	var logs []model.RoleGrantLog
+	return logs, find(s.db, cond, &logs)
+}
+
+func (s *grantStore) ExpiredUserRoles(now time.Time) ([]model.UserRole, error) {
+	var bindings []model.UserRole
+	return bindings, s.db.Where("expires_at IS NOT NULL AND expires_at <= ?", now).Find(&bindings).Error
+}
+
+func (s *grantStore) ExpiredGroupRoles(now time.Time) ([]model.GroupRole, error) {
+	var bindings []model.GroupRole
+	return bindings, s.db.Where("expires_at IS NOT NULL AND expires_at <= ?", now).Find(&bindings).Error
+}
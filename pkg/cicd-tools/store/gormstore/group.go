@@ -0,0 +1,104 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package gormstore
+
+import (
+	"gorm.io/gorm"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+type groupStore struct {
+	db *gorm.DB
+}
+
+func (s *groupStore) Get(id uint) (*model.Group, error) {
+	g := new(model.Group)
+	if err := get(s.db, id, g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (s *groupStore) First(cond *model.Group) (*model.Group, error) {
+	g := new(model.Group)
+	if err := first(s.db, cond, g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (s *groupStore) Find(cond *model.Group) ([]model.Group, error) {
+	var groups []model.Group
+	return groups, find(s.db, cond, &groups)
+}
+
+func (s *groupStore) Create(g *model.Group) error {
+	return s.db.Create(g).Error
+}
+
+func (s *groupStore) FirstOrCreate(g *model.Group) error {
+	return firstOrCreate(s.db, g)
+}
+
+func (s *groupStore) Save(g *model.Group) error {
+	return s.db.Save(g).Error
+}
+
+func (s *groupStore) Delete(id uint) error {
+	return s.db.Delete(&model.Group{}, id).Error
+}
+
+func (s *groupStore) Users(gid uint) ([]model.User, error) {
+	var users []model.User
+	_, err := list(s.db, &model.User{}, &model.Query{Via: model.UsersOfGroup(gid)}, &users)
+	return users, err
+}
+
+func (s *groupStore) AddRole(gid uint, rid uint) (*model.GroupRole, error) {
+	gr := &model.GroupRole{GroupID: gid, RoleID: rid}
+	return gr, s.AddRoleBinding(gr)
+}
+
+func (s *groupStore) RemoveRole(gid uint, rid uint) error {
+	return s.db.Where("group_id = ? AND role_id = ? AND project_id = 0 AND project_env_id = 0", gid, rid).
+		Delete(&model.GroupRole{}).Error
+}
+
+func (s *groupStore) Roles(gid uint) ([]model.Role, error) {
+	var roles []model.Role
+	rids := s.db.Model(&model.GroupRole{}).Select("role_id").Where("group_id = ?", gid)
+	return roles, s.db.Where("id IN (?)", rids).Find(&roles).Error
+}
+
+func (s *groupStore) AddRoleBinding(gr *model.GroupRole) error {
+	return s.db.Where(map[string]interface{}{
+		"group_id":       gr.GroupID,
+		"role_id":        gr.RoleID,
+		"project_id":     gr.ProjectID,
+		"project_env_id": gr.ProjectEnvID,
+	}).Assign(map[string]interface{}{"expires_at": gr.ExpiresAt}).FirstOrCreate(gr).Error
+}
+
+func (s *groupStore) RemoveRoleBinding(id uint) error {
+	return s.db.Delete(&model.GroupRole{}, id).Error
+}
+
+func (s *groupStore) RoleBindings(gid uint) ([]model.GroupRole, error) {
+	var bindings []model.GroupRole
+	return bindings, s.db.Where("group_id = ?", gid).Find(&bindings).Error
+}
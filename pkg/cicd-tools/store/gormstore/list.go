@@ -0,0 +1,110 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package gormstore
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+func (s *Store) List(cond interface{}, q *model.Query, out interface{}) (*model.Page, error) {
+	return list(s.db, cond, q, out)
+}
+
+// list 供各实体的存储复用, 关联查询同样经过 Query 的校验与分页
+func list(db *gorm.DB, cond interface{}, q *model.Query, out interface{}) (*model.Page, error) {
+	p, err := q.Plan(cond)
+	if err != nil {
+		return nil, err
+	}
+	if p.Via != nil {
+		ids := db.Model(p.Via.Cond).Select(p.Via.Column).Where(p.Via.Cond)
+		db = db.Where("id IN (?)", ids)
+	}
+	db = db.Model(cond).Where(cond)
+	for _, f := range p.Filters {
+		db = db.Where(filterExpr(f))
+	}
+	var total int64
+	if err := db.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, err
+	}
+	db = db.Session(&gorm.Session{})
+	if len(p.After) > 0 {
+		db = db.Where(afterExpr(p))
+	}
+	for _, sort := range p.Sort {
+		db = db.Order(clause.OrderByColumn{Column: clause.Column{Name: sort.Column}, Desc: sort.Desc})
+	}
+	if p.Limit > 0 {
+		db = db.Limit(p.Limit + 1)
+	}
+	if p.Offset > 0 {
+		db = db.Offset(p.Offset)
+	}
+	if err := db.Find(out).Error; err != nil {
+		return nil, err
+	}
+	return p.Page(out, total)
+}
+
+// likeEscaper LIKE 模式中的转义, 以 ! 作为转义字符以兼容 MySQL 与 SQLite
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+func filterExpr(f model.PlanFilter) clause.Expression {
+	column := clause.Column{Name: f.Column}
+	switch f.Op {
+	case model.OpNe:
+		return clause.Neq{Column: column, Value: f.Value}
+	case model.OpGt:
+		return clause.Gt{Column: column, Value: f.Value}
+	case model.OpGe:
+		return clause.Gte{Column: column, Value: f.Value}
+	case model.OpLt:
+		return clause.Lt{Column: column, Value: f.Value}
+	case model.OpLe:
+		return clause.Lte{Column: column, Value: f.Value}
+	case model.OpContains:
+		pattern := "%" + likeEscaper.Replace(strings.ToLower(f.Value.(string))) + "%"
+		return clause.Expr{SQL: "LOWER(?) LIKE ? ESCAPE '!'", Vars: []interface{}{column, pattern}}
+	default:
+		return clause.Eq{Column: column, Value: f.Value}
+	}
+}
+
+// afterExpr 游标之后的记录, 即排序字段依次相等、且第一个不相等的字段排在游标之后
+func afterExpr(p *model.QueryPlan) clause.Expression {
+	var or []clause.Expression
+	for i, sort := range p.Sort {
+		and := make([]clause.Expression, 0, i+1)
+		for j := 0; j < i; j++ {
+			and = append(and, clause.Eq{Column: clause.Column{Name: p.Sort[j].Column}, Value: p.After[j]})
+		}
+		column := clause.Column{Name: sort.Column}
+		if sort.Desc {
+			and = append(and, clause.Lt{Column: column, Value: p.After[i]})
+		} else {
+			and = append(and, clause.Gt{Column: column, Value: p.After[i]})
+		}
+		or = append(or, clause.And(and...))
+	}
+	return clause.Or(or...)
+}
@@ -0,0 +1,52 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package gormstore
+
+import (
+	"gorm.io/gorm"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+type loginStore struct {
+	db *gorm.DB
+}
+
+func (s *loginStore) Add(h *model.LoginHistory) error {
+	return s.db.Create(h).Error
+}
+
+func (s *loginStore) Find(q model.LoginQuery) ([]model.LoginHistory, error) {
+	var history []model.LoginHistory
+	db := s.db.Order("id DESC")
+	if q.UserID != 0 {
+		db = db.Where("user_id = ?", q.UserID)
+	}
+	if q.Username != "" {
+		db = db.Where("user_name = ?", q.Username)
+	}
+	if q.Failed {
+		db = db.Where("success = ?", false)
+	}
+	if !q.Since.IsZero() {
+		db = db.Where("created_at >= ?", q.Since)
+	}
+	if q.Limit > 0 {
+		db = db.Limit(q.Limit)
+	}
+	return history, db.Find(&history).Error
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package gormstore
+
+import (
+	"gorm.io/gorm"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+// mfaStore 密钥与恢复码删除后不再需要, 均物理删除, 以便重新绑定
+type mfaStore struct {
+	db *gorm.DB
+}
+
+func (s *mfaStore) TOTP(uid uint) (*model.UserTOTP, error) {
+	t := new(model.UserTOTP)
+	if err := s.db.Where("user_id = ?", uid).First(t).Error; err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (s *mfaStore) SaveTOTP(t *model.UserTOTP) error {
+	return s.db.Save(t).Error
+}
+
+func (s *mfaStore) DeleteTOTP(uid uint) error {
+	if err := s.db.Unscoped().Where("user_id = ?", uid).Delete(&model.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	return s.db.Unscoped().Where("user_id = ?", uid).Delete(&model.UserTOTP{}).Error
+}
+
+func (s *mfaStore) ReplaceRecoveryCodes(uid uint, codes []model.RecoveryCode) error {
+	if err := s.db.Unscoped().Where("user_id = ?", uid).Delete(&model.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	return s.db.Create(&codes).Error
+}
+
+func (s *mfaStore) RecoveryCodes(uid uint) ([]model.RecoveryCode, error) {
+	var codes []model.RecoveryCode
+	return codes, s.db.Where("user_id = ?", uid).Order("id").Find(&codes).Error
+}
+
+func (s *mfaStore) SaveRecoveryCode(c *model.RecoveryCode) error {
+	return s.db.Save(c).Error
+}
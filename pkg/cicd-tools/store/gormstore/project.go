@@ -0,0 +1,201 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package gormstore
+
+import (
+	"gorm.io/gorm"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+type projectStore struct {
+	db *gorm.DB
+}
+
+func (s *projectStore) Get(id uint) (*model.Project, error) {
+	p := new(model.Project)
+	if err := get(s.db, id, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *projectStore) First(cond *model.Project) (*model.Project, error) {
+	p := new(model.Project)
+	if err := first(s.db, cond, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *projectStore) Find(cond *model.Project) ([]model.Project, error) {
+	var projects []model.Project
+	return projects, find(s.db, cond, &projects)
+}
+
+func (s *projectStore) Create(p *model.Project) error {
+	return s.db.Create(p).Error
+}
+
+func (s *projectStore) FirstOrCreate(p *model.Project) error {
+	return firstOrCreate(s.db, p)
+}
+
+func (s *projectStore) Save(p *model.Project) error {
+	return s.db.Save(p).Error
+}
+
+func (s *projectStore) Delete(id uint) error {
+	return s.db.Delete(&model.Project{}, id).Error
+}
+
+func (s *projectStore) GetEnv(id uint) (*model.Env, error) {
+	e := new(model.Env)
+	if err := get(s.db, id, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (s *projectStore) FirstEnv(cond *model.Env) (*model.Env, error) {
+	e := new(model.Env)
+	if err := first(s.db, cond, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (s *projectStore) FindEnvs(cond *model.Env) ([]model.Env, error) {
+	var envs []model.Env
+	return envs, find(s.db, cond, &envs)
+}
+
+func (s *projectStore) FirstOrCreateEnv(e *model.Env) error {
+	return firstOrCreate(s.db, e)
+}
+
+func (s *projectStore) SaveEnv(e *model.Env) error {
+	return s.db.Save(e).Error
+}
+
+func (s *projectStore) DeleteEnv(id uint) error {
+	return s.db.Delete(&model.Env{}, id).Error
+}
+
+func (s *projectStore) GetItem(id uint) (*model.Item, error) {
+	i := new(model.Item)
+	if err := get(s.db, id, i); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+func (s *projectStore) FirstItem(cond *model.Item) (*model.Item, error) {
+	i := new(model.Item)
+	if err := first(s.db, cond, i); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+func (s *projectStore) FindItems(cond *model.Item) ([]model.Item, error) {
+	var items []model.Item
+	return items, find(s.db, cond, &items)
+}
+
+func (s *projectStore) FirstOrCreateItem(i *model.Item) error {
+	return firstOrCreate(s.db, i)
+}
+
+func (s *projectStore) SaveItem(i *model.Item) error {
+	return s.db.Save(i).Error
+}
+
+func (s *projectStore) DeleteItem(id uint) error {
+	return s.db.Delete(&model.Item{}, id).Error
+}
+
+func (s *projectStore) AddEnv(pid uint, eid uint) (*model.ProjectEnv, error) {
+	pe := &model.ProjectEnv{ProjectID: pid, EnvID: eid}
+	return pe, firstOrCreate(s.db, pe)
+}
+
+func (s *projectStore) RemoveEnv(pid uint, eid uint) error {
+	return s.db.Where("project_id = ? AND env_id = ?", pid, eid).Delete(&model.ProjectEnv{}).Error
+}
+
+func (s *projectStore) ProjectEnv(pid uint, eid uint) (*model.ProjectEnv, error) {
+	pe := new(model.ProjectEnv)
+	if err := first(s.db, &model.ProjectEnv{ProjectID: pid, EnvID: eid}, pe); err != nil {
+		return nil, err
+	}
+	return pe, nil
+}
+
+func (s *projectStore) GetProjectEnv(id uint) (*model.ProjectEnv, error) {
+	pe := new(model.ProjectEnv)
+	if err := get(s.db, id, pe); err != nil {
+		return nil, err
+	}
+	return pe, nil
+}
+
+func (s *projectStore) Envs(pid uint) ([]model.Env, error) {
+	var envs []model.Env
+	eids := s.db.Model(&model.ProjectEnv{}).Select("env_id").Where("project_id = ?", pid)
+	return envs, s.db.Where("id IN (?)", eids).Find(&envs).Error
+}
+
+func (s *projectStore) AddItem(pid uint, iid uint) (*model.ProjectItem, error) {
+	pi := &model.ProjectItem{ProjectID: pid, ItemID: iid}
+	return pi, firstOrCreate(s.db, pi)
+}
+
+func (s *projectStore) RemoveItem(pid uint, iid uint) error {
+	return s.db.Where("project_id = ? AND item_id = ?", pid, iid).Delete(&model.ProjectItem{}).Error
+}
+
+func (s *projectStore) Items(pid uint) ([]model.Item, error) {
+	var items []model.Item
+	iids := s.db.Model(&model.ProjectItem{}).Select("item_id").Where("project_id = ?", pid)
+	return items, s.db.Where("id IN (?)", iids).Find(&items).Error
+}
+
+func (s *projectStore) FirstEnvItem(cond *model.ProjectEnvItem) (*model.ProjectEnvItem, error) {
+	pei := new(model.ProjectEnvItem)
+	if err := first(s.db, cond, pei); err != nil {
+		return nil, err
+	}
+	return pei, nil
+}
+
+func (s *projectStore) FindEnvItems(cond *model.ProjectEnvItem) ([]model.ProjectEnvItem, error) {
+	var envItems []model.ProjectEnvItem
+	return envItems, find(s.db, cond, &envItems)
+}
+
+func (s *projectStore) FirstOrCreateEnvItem(pei *model.ProjectEnvItem) error {
+	return firstOrCreate(s.db, pei)
+}
+
+func (s *projectStore) SaveEnvItem(pei *model.ProjectEnvItem) error {
+	return s.db.Save(pei).Error
+}
+
+func (s *projectStore) DeleteEnvItem(id uint) error {
+	return s.db.Delete(&model.ProjectEnvItem{}, id).Error
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package gormstore
+
+import (
+	"gorm.io/gorm"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+type roleStore struct {
+	db *gorm.DB
+}
+
+func (s *roleStore) Get(id uint) (*model.Role, error) {
+	r := new(model.Role)
+	if err := get(s.db, id, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *roleStore) First(cond *model.Role) (*model.Role, error) {
+	r := new(model.Role)
+	if err := first(s.db, cond, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *roleStore) Find(cond *model.Role) ([]model.Role, error) {
+	var roles []model.Role
+	return roles, find(s.db, cond, &roles)
+}
+
+func (s *roleStore) Create(r *model.Role) error {
+	return s.db.Create(r).Error
+}
+
+func (s *roleStore) FirstOrCreate(r *model.Role) error {
+	return firstOrCreate(s.db, r)
+}
+
+func (s *roleStore) Save(r *model.Role) error {
+	return s.db.Save(r).Error
+}
+
+func (s *roleStore) Delete(id uint) error {
+	return s.db.Delete(&model.Role{}, id).Error
+}
+
+func (s *roleStore) Users(rid uint) ([]model.User, error) {
+	var users []model.User
+	_, err := list(s.db, &model.User{}, &model.Query{Via: model.UsersOfRole(rid)}, &users)
+	return users, err
+}
+
+func (s *roleStore) Groups(rid uint) ([]model.Group, error) {
+	var groups []model.Group
+	_, err := list(s.db, &model.Group{}, &model.Query{Via: model.GroupsOfRole(rid)}, &groups)
+	return groups, err
+}
+
+func (s *roleStore) Permissions(rid uint) ([]model.Permission, error) {
+	var permissions []model.Permission
+	return permissions, s.db.Where("role_id = ?", rid).Find(&permissions).Error
+}
+
+func (s *roleStore) AddPermission(p *model.Permission) error {
+	return s.db.Create(p).Error
+}
+
+func (s *roleStore) RemovePermission(id uint) error {
+	return s.db.Delete(&model.Permission{}, id).Error
+}
+
+func (s *roleStore) AddParent(rid uint, pid uint) (*model.RoleParent, error) {
+	rp := &model.RoleParent{RoleID: rid, ParentID: pid}
+	return rp, firstOrCreate(s.db, rp)
+}
+
+func (s *roleStore) RemoveParent(rid uint, pid uint) error {
+	return s.db.Where("role_id = ? AND parent_id = ?", rid, pid).Delete(&model.RoleParent{}).Error
+}
+
+func (s *roleStore) Parents(rid uint) ([]model.Role, error) {
+	var roles []model.Role
+	pids := s.db.Model(&model.RoleParent{}).Select("parent_id").Where("role_id = ?", rid)
+	return roles, s.db.Where("id IN (?)", pids).Find(&roles).Error
+}
+
+func (s *roleStore) Children(rid uint) ([]model.Role, error) {
+	var roles []model.Role
+	cids := s.db.Model(&model.RoleParent{}).Select("role_id").Where("parent_id = ?", rid)
+	return roles, s.db.Where("id IN (?)", cids).Find(&roles).Error
+}
@@ -0,0 +1,109 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package gormstore
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+// Store 基于 GORM 的存储实现, 支持 MySQL 与 SQLite
+type Store struct {
+	db *gorm.DB
+}
+
+func New(db *gorm.DB) *Store {
+	return &Store{db: db}
+}
+
+// DB 返回底层连接, 供迁移等需要直接操作数据库的场景使用
+func (s *Store) DB() *gorm.DB {
+	return s.db
+}
+
+func (s *Store) Users() model.UserStore {
+	return &userStore{db: s.db}
+}
+
+func (s *Store) Groups() model.GroupStore {
+	return &groupStore{db: s.db}
+}
+
+func (s *Store) Roles() model.RoleStore {
+	return &roleStore{db: s.db}
+}
+
+func (s *Store) Projects() model.ProjectStore {
+	return &projectStore{db: s.db}
+}
+
+func (s *Store) Builds() model.BuildStore {
+	return &buildStore{db: s.db}
+}
+
+func (s *Store) Artifacts() model.ArtifactStore {
+	return &artifactStore{db: s.db}
+}
+
+func (s *Store) Grants() model.GrantStore {
+	return &grantStore{db: s.db}
+}
+
+func (s *Store) Tokens() model.TokenStore {
+	return &tokenStore{db: s.db}
+}
+
+func (s *Store) MFA() model.MFAStore {
+	return &mfaStore{db: s.db}
+}
+
+func (s *Store) Logins() model.LoginStore {
+	return &loginStore{db: s.db}
+}
+
+func (s *Store) Transaction(fn func(s model.Store) error) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return fn(New(tx))
+	})
+}
+
+// duplicated 判断 err 是否为违反唯一索引的错误, 由数据库驱动转换错误码
+func duplicated(db *gorm.DB, err error) bool {
+	if t, ok := db.Dialector.(gorm.ErrorTranslator); ok {
+		err = t.Translate(err)
+	}
+	return errors.Is(err, gorm.ErrDuplicatedKey)
+}
+
+func get(db *gorm.DB, id uint, out interface{}) error {
+	return db.First(out, id).Error
+}
+
+func first(db *gorm.DB, cond interface{}, out interface{}) error {
+	return db.Where(cond).First(out).Error
+}
+
+func find(db *gorm.DB, cond interface{}, out interface{}) error {
+	return db.Where(cond).Find(out).Error
+}
+
+func firstOrCreate(db *gorm.DB, v interface{}) error {
+	return db.Where(v).FirstOrCreate(v).Error
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package gormstore
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+type tokenStore struct {
+	db *gorm.DB
+}
+
+// Revoke 依靠 token_id 的唯一索引判断是否已吊销, 冲突时不插入, 影响行数为 0
+func (s *tokenStore) Revoke(t *model.RevokedToken) (bool, error) {
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(t)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (s *tokenStore) IsRevoked(tokenID string) (bool, error) {
+	var count int64
+	err := s.db.Model(&model.RevokedToken{}).Where("token_id = ?", tokenID).Count(&count).Error
+	return count > 0, err
+}
+
+// Purge 吊销记录无需保留, 直接物理删除
+func (s *tokenStore) Purge(before time.Time) error {
+	return s.db.Unscoped().Where("expires_at < ?", before).Delete(&model.RevokedToken{}).Error
+}
+
+func (s *tokenStore) CreatePersonal(t *model.PersonalToken) error {
+	return s.db.Create(t).Error
+}
+
+func (s *tokenStore) GetPersonal(id uint) (*model.PersonalToken, error) {
+	t := new(model.PersonalToken)
+	if err := get(s.db, id, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (s *tokenStore) FindPersonal(cond *model.PersonalToken) ([]model.PersonalToken, error) {
+	var tokens []model.PersonalToken
+	return tokens, find(s.db, cond, &tokens)
+}
+
+func (s *tokenStore) PersonalByHash(hash string) (*model.PersonalToken, error) {
+	t := new(model.PersonalToken)
+	if err := s.db.Where("hash = ?", hash).First(t).Error; err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (s *tokenStore) TouchPersonal(id uint, at time.Time) (bool, error) {
+	result := s.db.Model(&model.PersonalToken{}).Where("id = ? AND revoked_at IS NULL", id).Update("last_used_at", at)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (s *tokenStore) RevokePersonal(id uint, at time.Time) error {
+	return s.db.Model(&model.PersonalToken{}).Where("id = ? AND revoked_at IS NULL", id).Update("revoked_at", at).Error
+}
+
+func (s *tokenStore) RevokePersonalByUser(uid uint, at time.Time) error {
+	return s.db.Model(&model.PersonalToken{}).Where("user_id = ? AND revoked_at IS NULL", uid).Update("revoked_at", at).Error
+}
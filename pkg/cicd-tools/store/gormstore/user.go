@@ -0,0 +1,176 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package gormstore
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+type userStore struct {
+	db *gorm.DB
+}
+
+func (s *userStore) Get(id uint) (*model.User, error) {
+	u := new(model.User)
+	if err := get(s.db, id, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (s *userStore) First(cond *model.User) (*model.User, error) {
+	u := new(model.User)
+	if err := first(s.db, cond, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (s *userStore) Find(cond *model.User) ([]model.User, error) {
+	var users []model.User
+	return users, find(s.db, cond, &users)
+}
+
+func (s *userStore) Create(u *model.User) error {
+	return s.db.Create(u).Error
+}
+
+func (s *userStore) FirstOrCreate(u *model.User) error {
+	return firstOrCreate(s.db, u)
+}
+
+func (s *userStore) Save(u *model.User) error {
+	return s.db.Save(u).Error
+}
+
+func (s *userStore) Delete(id uint) error {
+	return s.db.Delete(&model.User{}, id).Error
+}
+
+func (s *userStore) AddGroup(uid uint, gid uint) (*model.UserGroup, error) {
+	ug := &model.UserGroup{UserID: uid, GroupID: gid}
+	return ug, firstOrCreate(s.db, ug)
+}
+
+func (s *userStore) RemoveGroup(uid uint, gid uint) error {
+	return s.db.Where("user_id = ? AND group_id = ?", uid, gid).Delete(&model.UserGroup{}).Error
+}
+
+func (s *userStore) Groups(uid uint) ([]model.Group, error) {
+	var groups []model.Group
+	_, err := list(s.db, &model.Group{}, &model.Query{Via: model.GroupsOfUser(uid)}, &groups)
+	return groups, err
+}
+
+func (s *userStore) AddRole(uid uint, rid uint) (*model.UserRole, error) {
+	ur := &model.UserRole{UserID: uid, RoleID: rid}
+	return ur, s.AddRoleBinding(ur)
+}
+
+func (s *userStore) RemoveRole(uid uint, rid uint) error {
+	return s.db.Where("user_id = ? AND role_id = ? AND project_id = 0 AND project_env_id = 0", uid, rid).
+		Delete(&model.UserRole{}).Error
+}
+
+func (s *userStore) Roles(uid uint) ([]model.Role, error) {
+	var roles []model.Role
+	rids := s.db.Model(&model.UserRole{}).Select("role_id").Where("user_id = ?", uid)
+	return roles, s.db.Where("id IN (?)", rids).Find(&roles).Error
+}
+
+// AddRoleBinding 结构体条件会忽略零值, 这里用 map 条件精确匹配范围, 避免全局绑定匹配到项目绑定
+func (s *userStore) AddRoleBinding(ur *model.UserRole) error {
+	return s.db.Where(map[string]interface{}{
+		"user_id":        ur.UserID,
+		"role_id":        ur.RoleID,
+		"project_id":     ur.ProjectID,
+		"project_env_id": ur.ProjectEnvID,
+	}).Assign(map[string]interface{}{"expires_at": ur.ExpiresAt}).FirstOrCreate(ur).Error
+}
+
+func (s *userStore) RemoveRoleBinding(id uint) error {
+	return s.db.Delete(&model.UserRole{}, id).Error
+}
+
+func (s *userStore) RoleBindings(uid uint) ([]model.UserRole, error) {
+	var bindings []model.UserRole
+	return bindings, s.db.Where("user_id = ?", uid).Find(&bindings).Error
+}
+
+// UpdatePassword 只更新密码列, 避免覆盖其它字段
+func (s *userStore) UpdatePassword(uid uint, hash model.PasswordHash) error {
+	return s.db.Model(&model.User{}).Where("id = ?", uid).Update("password", hash).Error
+}
+
+// profileColumns UpdateProfile 更新的列
+var profileColumns = []string{
+	"user_name", "email_address", "full_name", "gender", "age", "location", "job",
+	"mobile", "dingtalk_id", "wxwork_id", "service_account", "disabled", "updated_at",
+}
+
+func (s *userStore) UpdateProfile(u *model.User) error {
+	result := s.db.Model(u).Select(profileColumns).Updates(u)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return model.ErrNotFound
+	}
+	return nil
+}
+
+func (s *userStore) UpdateLoginState(uid uint, failedLogins int, lockedUntil *time.Time) error {
+	return s.db.Model(&model.User{}).Where("id = ?", uid).
+		Updates(map[string]interface{}{"failed_logins": failedLogins, "locked_until": lockedUntil}).Error
+}
+
+// IncrementFailedLogins 在数据库中递增, 并在同一事务内读回, 并发失败时每次都能计入
+func (s *userStore) IncrementFailedLogins(uid uint) (int, error) {
+	var count int
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.User{}).Where("id = ?", uid).Update("failed_logins", gorm.Expr("failed_logins + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return model.ErrNotFound
+		}
+		return tx.Model(&model.User{}).Where("id = ?", uid).Pluck("failed_logins", &count).Error
+	})
+	return count, err
+}
+
+func (s *userStore) SetDisabled(uid uint, disabled bool) error {
+	return s.db.Model(&model.User{}).Where("id = ?", uid).Update("disabled", disabled).Error
+}
+
+func (s *userStore) IncrementTokenVersion(uid uint) error {
+	return s.db.Model(&model.User{}).Where("id = ?", uid).Update("token_version", gorm.Expr("token_version + 1")).Error
+}
+
+func (s *userStore) AddPasswordHistory(h *model.PasswordHistory) error {
+	return s.db.Create(h).Error
+}
+
+func (s *userStore) PasswordHistory(uid uint, limit int) ([]model.PasswordHistory, error) {
+	var history []model.PasswordHistory
+	return history, s.db.Where("user_id = ?", uid).Order("id DESC").Limit(limit).Find(&history).Error
+}
@@ -0,0 +1,198 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package store_test
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+// seedUsers 创建 n 个用户, 年龄只有 5 种取值, 职位只有 3 种取值, 用于验证排序字段相同时分页仍然稳定
+func seedUsers(t *testing.T, s model.Store, n int) []model.User {
+	jobs := []string{"dev", "ops", "qa_lead"}
+	var users []model.User
+	for i := 0; i < n; i++ {
+		u := model.User{
+			Name:  fmt.Sprintf("user%02d", (i*7)%n),
+			Email: fmt.Sprintf("user%02d@example.org", i),
+			Age:   uint(20 + i%5),
+			Job:   jobs[i%3],
+		}
+		if err := s.Users().Create(&u); err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, u)
+	}
+	return users
+}
+
+func userIDs(users []model.User) []uint {
+	var out []uint
+	for _, u := range users {
+		out = append(out, u.ID)
+	}
+	return out
+}
+
+func filters(t *testing.T, exprs ...string) []model.Filter {
+	var out []model.Filter
+	for _, expr := range exprs {
+		f, err := model.ParseFilter(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+func TestListFilter(t *testing.T) {
+	each(t, func(t *testing.T, s model.Store) {
+		users := seedUsers(t, s, 25)
+		tests := []struct {
+			filters []string
+			match   func(u model.User) bool
+		}{
+			{[]string{"age=22"}, func(u model.User) bool { return u.Age == 22 }},
+			{[]string{"age>=23", "job!=dev"}, func(u model.User) bool { return u.Age >= 23 && u.Job != "dev" }},
+			{[]string{"age<21"}, func(u model.User) bool { return u.Age < 21 }},
+			{[]string{"job~p"}, func(u model.User) bool { return strings.Contains(u.Job, "p") }},
+			// _ 与 % 按普通字符匹配, 不作为 LIKE 的通配符
+			{[]string{"job~a_"}, func(u model.User) bool { return u.Job == "qa_lead" }},
+			{[]string{"job~%"}, func(u model.User) bool { return false }},
+			{[]string{"user_name=user07"}, func(u model.User) bool { return u.Name == "user07" }},
+		}
+		for _, tt := range tests {
+			var want []model.User
+			for _, u := range users {
+				if tt.match(u) {
+					want = append(want, u)
+				}
+			}
+			var got []model.User
+			page, err := s.List(&model.User{}, &model.Query{Filters: filters(t, tt.filters...)}, &got)
+			if err != nil {
+				t.Fatalf("%v: %v", tt.filters, err)
+			}
+			if fmt.Sprint(userIDs(got)) != fmt.Sprint(userIDs(want)) || page.Total != int64(len(want)) || page.Next != "" {
+				t.Errorf("%v = %v, %+v, want %v", tt.filters, userIDs(got), page, userIDs(want))
+			}
+		}
+	})
+}
+
+func TestListInvalid(t *testing.T) {
+	each(t, func(t *testing.T, s model.Store) {
+		seedUsers(t, s, 5)
+		var first []model.User
+		page, err := s.List(&model.User{}, &model.Query{Limit: 2, Sort: model.ParseSort("age")}, &first)
+		if err != nil || page.Next == "" {
+			t.Fatalf("first page = %+v, %v", page, err)
+		}
+		tests := []struct {
+			name string
+			q    model.Query
+		}{
+			{"unknown field", model.Query{Filters: filters(t, "salary>1")}},
+			{"hidden filter", model.Query{Filters: filters(t, "password=x")}},
+			{"hidden sort", model.Query{Sort: model.ParseSort("token_version")}},
+			{"unknown sort", model.Query{Sort: model.ParseSort("-salary")}},
+			{"nullable sort", model.Query{Sort: model.ParseSort("locked_until")}},
+			{"contains on number", model.Query{Filters: filters(t, "age~2")}},
+			{"bad value", model.Query{Filters: filters(t, "age=old")}},
+			{"bad time", model.Query{Filters: filters(t, "created_at>yesterday")}},
+			{"bad op", model.Query{Filters: []model.Filter{{Field: "age", Op: "==", Value: "1"}}}},
+			{"negative limit", model.Query{Limit: -1}},
+			{"cursor and offset", model.Query{Limit: 2, Offset: 2, Cursor: page.Next, Sort: model.ParseSort("age")}},
+		}
+		for _, tt := range tests {
+			var out []model.User
+			if _, err := s.List(&model.User{}, &tt.q, &out); !errors.Is(err, model.ErrInvalidQuery) {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+		}
+		if _, err := model.ParseFilter("age"); !errors.Is(err, model.ErrInvalidQuery) {
+			t.Errorf("ParseFilter without op: %v", err)
+		}
+	})
+}
+
+func TestListCursor(t *testing.T) {
+	each(t, func(t *testing.T, s model.Store) {
+		seedUsers(t, s, 25)
+		for _, spec := range []string{"", "age", "-age,user_name", "job,-age"} {
+			var all []model.User
+			if _, err := s.List(&model.User{}, &model.Query{Sort: model.ParseSort(spec)}, &all); err != nil {
+				t.Fatal(err)
+			}
+			// 每页 4 条, 年龄与职位有大量重复, 各页拼接后应与不分页的结果完全相同
+			var paged []model.User
+			q := model.Query{Limit: 4, Sort: model.ParseSort(spec)}
+			for i := 0; ; i++ {
+				var out []model.User
+				page, err := s.List(&model.User{}, &q, &out)
+				if err != nil {
+					t.Fatalf("%q page %d: %v", spec, i, err)
+				}
+				if page.Total != 25 || len(out) > 4 {
+					t.Fatalf("%q page %d = %d users, %+v", spec, i, len(out), page)
+				}
+				paged = append(paged, out...)
+				if page.Next == "" {
+					break
+				}
+				q.Cursor = page.Next
+			}
+			if fmt.Sprint(userIDs(paged)) != fmt.Sprint(userIDs(all)) {
+				t.Errorf("%q paged = %v, want %v", spec, userIDs(paged), userIDs(all))
+			}
+		}
+
+		var out []model.User
+		page, err := s.List(&model.User{}, &model.Query{Limit: 3, Sort: model.ParseSort("-age")}, &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := base64.RawURLEncoding.DecodeString(page.Next)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tampered := map[string]string{
+			"not base64":   page.Next + "!",
+			"not json":     base64.RawURLEncoding.EncodeToString(data[1:]),
+			"wrong values": base64.RawURLEncoding.EncodeToString([]byte(`{"s":"-age,id","v":[20]}`)),
+			"wrong type":   base64.RawURLEncoding.EncodeToString([]byte(`{"s":"-age,id","v":["old",1]}`)),
+			"other sort":   base64.RawURLEncoding.EncodeToString([]byte(strings.Replace(string(data), "-age", "age", 1))),
+		}
+		for name, cursor := range tampered {
+			q := model.Query{Limit: 3, Sort: model.ParseSort("-age"), Cursor: cursor}
+			if _, err := s.List(&model.User{}, &q, &out); !errors.Is(err, model.ErrInvalidQuery) {
+				t.Errorf("%s: %v", name, err)
+			}
+		}
+		// 游标只能用于生成它的排序条件
+		q := model.Query{Limit: 3, Sort: model.ParseSort("age"), Cursor: page.Next}
+		if _, err := s.List(&model.User{}, &q, &out); !errors.Is(err, model.ErrInvalidQuery) {
+			t.Errorf("cursor with other sort: %v", err)
+		}
+	})
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package memstore
+
+import (
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+type artifactStore struct {
+	db *database
+}
+
+func (s *artifactStore) Get(id uint) (*model.Artifact, error) {
+	a := new(model.Artifact)
+	if err := s.db.get(tableArtifact, id, a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (s *artifactStore) First(cond *model.Artifact) (*model.Artifact, error) {
+	a := new(model.Artifact)
+	if err := s.db.first(tableArtifact, cond, a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (s *artifactStore) Find(cond *model.Artifact) ([]model.Artifact, error) {
+	var artifacts []model.Artifact
+	return artifacts, s.db.find(tableArtifact, cond, &artifacts)
+}
+
+func (s *artifactStore) Create(a *model.Artifact) error {
+	s.db.insert(tableArtifact, a)
+	return nil
+}
+
+func (s *artifactStore) FirstOrCreate(a *model.Artifact) error {
+	return s.db.firstOrCreate(tableArtifact, a)
+}
+
+func (s *artifactStore) Save(a *model.Artifact) error {
+	s.db.save(tableArtifact, a)
+	return nil
+}
+
+func (s *artifactStore) Delete(id uint) error {
+	return s.db.delete(tableArtifact, id)
+}
@@ -0,0 +1,211 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package memstore
+
+import (
+	"fmt"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+type buildStore struct {
+	db *database
+}
+
+func (s *buildStore) Get(id uint) (*model.BuildInfo, error) {
+	b := new(model.BuildInfo)
+	if err := s.db.get(tableBuildInfo, id, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (s *buildStore) First(cond *model.BuildInfo) (*model.BuildInfo, error) {
+	b := new(model.BuildInfo)
+	if err := s.db.first(tableBuildInfo, cond, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (s *buildStore) Find(cond *model.BuildInfo) ([]model.BuildInfo, error) {
+	var builds []model.BuildInfo
+	return builds, s.db.find(tableBuildInfo, cond, &builds)
+}
+
+// MaxBuildID 已删除的构建不再保留, 只统计现有的构建
+func (s *buildStore) MaxBuildID(projectEnvItemID uint) (uint, error) {
+	builds, err := s.Find(&model.BuildInfo{ProjectEnvItemID: projectEnvItemID})
+	if err != nil {
+		return 0, err
+	}
+	var max uint
+	for _, value := range builds {
+		if value.BuildID > max {
+			max = value.BuildID
+		}
+	}
+	return max, nil
+}
+
+// Create 相当于 (project_env_item_id, build_id) 的唯一索引
+func (s *buildStore) Create(b *model.BuildInfo) error {
+	inserted := s.db.insertUnique(tableBuildInfo, b, func(row interface{}) bool {
+		value := row.(model.BuildInfo)
+		return value.ProjectEnvItemID == b.ProjectEnvItemID && value.BuildID == b.BuildID
+	})
+	if !inserted {
+		return fmt.Errorf("应用环境%d的构建编号%d已存在\n%w", b.ProjectEnvItemID, b.BuildID, model.ErrDuplicated)
+	}
+	return nil
+}
+
+func (s *buildStore) Save(b *model.BuildInfo) error {
+	s.db.save(tableBuildInfo, b)
+	return nil
+}
+
+func (s *buildStore) Delete(id uint) error {
+	return s.db.delete(tableBuildInfo, id)
+}
+
+func (s *buildStore) GetConfig(id uint) (*model.BuildConfig, error) {
+	c := new(model.BuildConfig)
+	if err := s.db.get(tableBuildConfig, id, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *buildStore) FirstConfig(cond *model.BuildConfig) (*model.BuildConfig, error) {
+	c := new(model.BuildConfig)
+	if err := s.db.first(tableBuildConfig, cond, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *buildStore) FindConfigs(cond *model.BuildConfig) ([]model.BuildConfig, error) {
+	var configs []model.BuildConfig
+	return configs, s.db.find(tableBuildConfig, cond, &configs)
+}
+
+func (s *buildStore) FirstOrCreateConfig(c *model.BuildConfig) error {
+	return s.db.firstOrCreate(tableBuildConfig, c)
+}
+
+func (s *buildStore) SaveConfig(c *model.BuildConfig) error {
+	s.db.save(tableBuildConfig, c)
+	return nil
+}
+
+func (s *buildStore) DeleteConfig(id uint) error {
+	return s.db.delete(tableBuildConfig, id)
+}
+
+func (s *buildStore) GetRepo(id uint) (*model.GitRepo, error) {
+	r := new(model.GitRepo)
+	if err := s.db.get(tableGitRepo, id, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *buildStore) FirstRepo(cond *model.GitRepo) (*model.GitRepo, error) {
+	r := new(model.GitRepo)
+	if err := s.db.first(tableGitRepo, cond, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *buildStore) FindRepos(cond *model.GitRepo) ([]model.GitRepo, error) {
+	var repos []model.GitRepo
+	return repos, s.db.find(tableGitRepo, cond, &repos)
+}
+
+func (s *buildStore) FirstOrCreateRepo(r *model.GitRepo) error {
+	return s.db.firstOrCreate(tableGitRepo, r)
+}
+
+func (s *buildStore) SaveRepo(r *model.GitRepo) error {
+	s.db.save(tableGitRepo, r)
+	return nil
+}
+
+func (s *buildStore) DeleteRepo(id uint) error {
+	return s.db.delete(tableGitRepo, id)
+}
+
+func (s *buildStore) FirstGitConfig(cond *model.GitConfig) (*model.GitConfig, error) {
+	c := new(model.GitConfig)
+	if err := s.db.first(tableGitConfig, cond, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *buildStore) FindGitConfigs(cond *model.GitConfig) ([]model.GitConfig, error) {
+	var configs []model.GitConfig
+	return configs, s.db.find(tableGitConfig, cond, &configs)
+}
+
+func (s *buildStore) FirstOrCreateGitConfig(c *model.GitConfig) error {
+	return s.db.firstOrCreate(tableGitConfig, c)
+}
+
+func (s *buildStore) SaveGitConfig(c *model.GitConfig) error {
+	s.db.save(tableGitConfig, c)
+	return nil
+}
+
+func (s *buildStore) DeleteGitConfig(id uint) error {
+	return s.db.delete(tableGitConfig, id)
+}
+
+func (s *buildStore) FirstCommit(cond *model.CommitInfo) (*model.CommitInfo, error) {
+	c := new(model.CommitInfo)
+	if err := s.db.first(tableCommitInfo, cond, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *buildStore) FindCommits(cond *model.CommitInfo) ([]model.CommitInfo, error) {
+	var commits []model.CommitInfo
+	return commits, s.db.find(tableCommitInfo, cond, &commits)
+}
+
+func (s *buildStore) FirstOrCreateCommit(c *model.CommitInfo) error {
+	return s.db.firstOrCreate(tableCommitInfo, c)
+}
+
+func (s *buildStore) AddLogs(logs []model.BuildLog) error {
+	for i := range logs {
+		s.db.insert(tableBuildLog, &logs[i])
+	}
+	return nil
+}
+
+func (s *buildStore) Logs(buildID uint, afterID uint) ([]model.BuildLog, error) {
+	var logs []model.BuildLog
+	err := s.db.findFunc(tableBuildLog, &logs, func(row interface{}) bool {
+		l := row.(model.BuildLog)
+		return l.BuildInfoID == buildID && l.ID > afterID
+	})
+	return logs, err
+}
@@ -0,0 +1,349 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package memstore
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+// table 以 ID 为键保存结构体副本, 不保存 gorm:"-" 字段
+type table struct {
+	seq  uint
+	rows map[uint]interface{}
+}
+
+// database 事务内外的 database 共享 mu 与 tables, 事务内的 journal 记录本事务的写入
+type database struct {
+	mu      *sync.Mutex
+	tables  map[string]*table
+	journal *journal
+}
+
+func newDatabase() *database {
+	return &database{mu: new(sync.Mutex), tables: map[string]*table{}}
+}
+
+func (d *database) table(name string) *table {
+	t, ok := d.tables[name]
+	if !ok {
+		t = &table{rows: map[uint]interface{}{}}
+		d.tables[name] = t
+	}
+	return t
+}
+
+// journal 事务中每次写入前的记录, 回滚时按相反顺序恢复, 不影响事务外的并发写入;
+// 与数据库的自增序列一样, 回滚不恢复 seq
+type journal struct {
+	entries []undo
+}
+
+// undo row 为写入前的记录, existed 为 false 时写入前不存在
+type undo struct {
+	table   string
+	id      uint
+	row     interface{}
+	existed bool
+}
+
+// begin 返回在事务中使用的 database, 嵌套事务沿用外层的 journal
+func (d *database) begin() *database {
+	j := d.journal
+	if j == nil {
+		j = new(journal)
+	}
+	return &database{mu: d.mu, tables: d.tables, journal: j}
+}
+
+// rollback 撤销 journal 中 mark 之后的写入
+func (d *database) rollback(mark int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	entries := d.journal.entries
+	for i := len(entries) - 1; i >= mark; i-- {
+		e := entries[i]
+		t := d.table(e.table)
+		if e.existed {
+			t.rows[e.id] = e.row
+		} else {
+			delete(t.rows, e.id)
+		}
+	}
+	d.journal.entries = entries[:mark]
+}
+
+// record 在修改 name 表中 id 对应的记录前调用
+func (d *database) record(name string, id uint) {
+	if d.journal == nil {
+		return
+	}
+	row, ok := d.table(name).rows[id]
+	d.journal.entries = append(d.journal.entries, undo{table: name, id: id, row: row, existed: ok})
+}
+
+// removeLocked 删除一条记录并记录到 journal
+func (d *database) removeLocked(name string, id uint) {
+	t := d.table(name)
+	if _, ok := t.rows[id]; !ok {
+		return
+	}
+	d.record(name, id)
+	delete(t.rows, id)
+}
+
+func (d *database) insert(name string, v interface{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.insertLocked(name, v)
+}
+
+func (d *database) insertLocked(name string, v interface{}) {
+	t := d.table(name)
+	rv := reflect.ValueOf(v).Elem()
+	id := rv.FieldByName("ID")
+	if id.Uint() == 0 {
+		t.seq++
+		id.SetUint(uint64(t.seq))
+	} else if uint(id.Uint()) > t.seq {
+		t.seq = uint(id.Uint())
+	}
+	now := time.Now()
+	if f := rv.FieldByName("CreatedAt"); f.IsValid() && f.Interface().(time.Time).IsZero() {
+		f.Set(reflect.ValueOf(now))
+	}
+	if f := rv.FieldByName("UpdatedAt"); f.IsValid() {
+		f.Set(reflect.ValueOf(now))
+	}
+	d.record(name, uint(id.Uint()))
+	t.rows[uint(id.Uint())] = persist(rv)
+}
+
+// save ID 为零时新增, 否则整行覆盖
+func (d *database) save(name string, v interface{}) {
+	d.insert(name, v)
+}
+
+// update 在锁内修改一条记录, fn 返回 false 时不保存; 记录不存在时返回 model.ErrNotFound
+func (d *database) update(name string, id uint, fn func(v reflect.Value) bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	row, ok := d.table(name).rows[id]
+	if !ok {
+		return model.ErrNotFound
+	}
+	v := reflect.New(reflect.TypeOf(row))
+	v.Elem().Set(reflect.ValueOf(row))
+	if fn(v.Elem()) {
+		d.insertLocked(name, v.Interface())
+	}
+	return nil
+}
+
+// updateFunc 在锁内修改全部满足 match 的记录
+func (d *database) updateFunc(name string, match func(row interface{}) bool, fn func(v reflect.Value)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, row := range d.rowsLocked(name) {
+		if !match(row) {
+			continue
+		}
+		v := reflect.New(reflect.TypeOf(row))
+		v.Elem().Set(reflect.ValueOf(row))
+		fn(v.Elem())
+		d.insertLocked(name, v.Interface())
+	}
+}
+
+func (d *database) get(name string, id uint, out interface{}) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	row, ok := d.table(name).rows[id]
+	if !ok {
+		return model.ErrNotFound
+	}
+	reflect.ValueOf(out).Elem().Set(reflect.ValueOf(row))
+	return nil
+}
+
+func (d *database) first(name string, cond interface{}, out interface{}) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, row := range d.rowsLocked(name) {
+		if matches(cond, row) {
+			reflect.ValueOf(out).Elem().Set(reflect.ValueOf(row))
+			return nil
+		}
+	}
+	return model.ErrNotFound
+}
+
+// find out 为指向切片的指针
+func (d *database) find(name string, cond interface{}, out interface{}) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	slice := reflect.ValueOf(out).Elem()
+	for _, row := range d.rowsLocked(name) {
+		if matches(cond, row) {
+			slice.Set(reflect.Append(slice, reflect.ValueOf(row)))
+		}
+	}
+	return nil
+}
+
+// findFunc 与 find 相同, 但由 match 筛选记录
+func (d *database) findFunc(name string, out interface{}, match func(row interface{}) bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	slice := reflect.ValueOf(out).Elem()
+	for _, row := range d.rowsLocked(name) {
+		if match(row) {
+			slice.Set(reflect.Append(slice, reflect.ValueOf(row)))
+		}
+	}
+	return nil
+}
+
+func (d *database) firstOrCreate(name string, v interface{}) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, row := range d.rowsLocked(name) {
+		if matches(v, row) {
+			reflect.ValueOf(v).Elem().Set(reflect.ValueOf(row))
+			return nil
+		}
+	}
+	d.insertLocked(name, v)
+	return nil
+}
+
+// firstOrCreateFunc 与 firstOrCreate 相同, 但由 match 判断是否为同一条记录, 用于需要比较零值的场景
+func (d *database) firstOrCreateFunc(name string, v interface{}, match func(row interface{}) bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, row := range d.rowsLocked(name) {
+		if match(row) {
+			reflect.ValueOf(v).Elem().Set(reflect.ValueOf(row))
+			return nil
+		}
+	}
+	d.insertLocked(name, v)
+	return nil
+}
+
+// insertUnique 没有满足 match 的记录时插入 v, 返回是否插入, 相当于唯一索引冲突时不插入
+func (d *database) insertUnique(name string, v interface{}, match func(row interface{}) bool) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, row := range d.rowsLocked(name) {
+		if match(row) {
+			return false
+		}
+	}
+	d.insertLocked(name, v)
+	return true
+}
+
+func (d *database) deleteFunc(name string, match func(row interface{}) bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	t := d.table(name)
+	for id, row := range t.rows {
+		if match(row) {
+			d.removeLocked(name, id)
+		}
+	}
+	return nil
+}
+
+func (d *database) delete(name string, id uint) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.removeLocked(name, id)
+	return nil
+}
+
+func (d *database) deleteWhere(name string, cond interface{}) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	t := d.table(name)
+	for id, row := range t.rows {
+		if matches(cond, row) {
+			d.removeLocked(name, id)
+		}
+	}
+	return nil
+}
+
+func (d *database) rowsLocked(name string) []interface{} {
+	t := d.table(name)
+	ids := make([]uint, 0, len(t.rows))
+	for id := range t.rows {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	rows := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		rows = append(rows, t.rows[id])
+	}
+	return rows
+}
+
+// persist 复制结构体并清空 gorm:"-" 字段
+func persist(rv reflect.Value) interface{} {
+	c := reflect.New(rv.Type()).Elem()
+	c.Set(rv)
+	for i := 0; i < c.NumField(); i++ {
+		if c.Type().Field(i).Tag.Get("gorm") == "-" {
+			c.Field(i).Set(reflect.Zero(c.Field(i).Type()))
+		}
+	}
+	return c.Interface()
+}
+
+// matches 与 GORM 的 Where(struct) 一致, 只比较条件中的非零字段
+func matches(cond interface{}, row interface{}) bool {
+	cv := reflect.Indirect(reflect.ValueOf(cond))
+	rv := reflect.Indirect(reflect.ValueOf(row))
+	return matchValue(cv, rv)
+}
+
+func matchValue(cv reflect.Value, rv reflect.Value) bool {
+	for i := 0; i < cv.NumField(); i++ {
+		field := cv.Type().Field(i)
+		if field.PkgPath != "" || field.Tag.Get("gorm") == "-" {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if !matchValue(cv.Field(i), rv.Field(i)) {
+				return false
+			}
+			continue
+		}
+		if cv.Field(i).IsZero() {
+			continue
+		}
+		if !reflect.DeepEqual(cv.Field(i).Interface(), rv.Field(i).Interface()) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package memstore
+
+import (
+	"time"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+type grantStore struct {
+	db *database
+}
+
+func (s *grantStore) CreateRequest(r *model.RoleRequest) error {
+	s.db.insert(tableRoleRequest, r)
+	return nil
+}
+
+func (s *grantStore) GetRequest(id uint) (*model.RoleRequest, error) {
+	r := new(model.RoleRequest)
+	if err := s.db.get(tableRoleRequest, id, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// LockRequest 内存存储的事务已串行执行, 直接查询即可
+func (s *grantStore) LockRequest(id uint) (*model.RoleRequest, error) {
+	return s.GetRequest(id)
+}
+
+func (s *grantStore) FindRequests(cond *model.RoleRequest) ([]model.RoleRequest, error) {
+	var requests []model.RoleRequest
+	return requests, s.db.find(tableRoleRequest, cond, &requests)
+}
+
+func (s *grantStore) SaveRequest(r *model.RoleRequest) error {
+	s.db.save(tableRoleRequest, r)
+	return nil
+}
+
+func (s *grantStore) AddLog(l *model.RoleGrantLog) error {
+	s.db.insert(tableRoleGrantLog, l)
+	return nil
+}
+
+func (s *grantStore) FindLogs(cond *model.RoleGrantLog) ([]model.RoleGrantLog, error) {
+	var logs []model.RoleGrantLog
+	return logs, s.db.find(tableRoleGrantLog, cond, &logs)
+}
+
+func (s *grantStore) ExpiredUserRoles(now time.Time) ([]model.UserRole, error) {
+	var bindings []model.UserRole
+	return bindings, s.db.findFunc(tableUserRole, &bindings, func(row interface{}) bool {
+		ur := row.(model.UserRole)
+		return ur.Expired(now)
+	})
+}
+
+func (s *grantStore) ExpiredGroupRoles(now time.Time) ([]model.GroupRole, error) {
+	var bindings []model.GroupRole
+	return bindings, s.db.findFunc(tableGroupRole, &bindings, func(row interface{}) bool {
+		gr := row.(model.GroupRole)
+		return gr.Expired(now)
+	})
+}
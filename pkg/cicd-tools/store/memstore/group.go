@@ -0,0 +1,124 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package memstore
+
+import (
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+type groupStore struct {
+	db *database
+}
+
+func (s *groupStore) Get(id uint) (*model.Group, error) {
+	g := new(model.Group)
+	if err := s.db.get(tableGroup, id, g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (s *groupStore) First(cond *model.Group) (*model.Group, error) {
+	g := new(model.Group)
+	if err := s.db.first(tableGroup, cond, g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (s *groupStore) Find(cond *model.Group) ([]model.Group, error) {
+	var groups []model.Group
+	return groups, s.db.find(tableGroup, cond, &groups)
+}
+
+func (s *groupStore) Create(g *model.Group) error {
+	s.db.insert(tableGroup, g)
+	return nil
+}
+
+func (s *groupStore) FirstOrCreate(g *model.Group) error {
+	return s.db.firstOrCreate(tableGroup, g)
+}
+
+func (s *groupStore) Save(g *model.Group) error {
+	s.db.save(tableGroup, g)
+	return nil
+}
+
+func (s *groupStore) Delete(id uint) error {
+	return s.db.delete(tableGroup, id)
+}
+
+func (s *groupStore) Users(gid uint) ([]model.User, error) {
+	var users []model.User
+	_, err := s.db.list(&model.User{}, &model.Query{Via: model.UsersOfGroup(gid)}, &users)
+	return users, err
+}
+
+func (s *groupStore) AddRole(gid uint, rid uint) (*model.GroupRole, error) {
+	gr := &model.GroupRole{GroupID: gid, RoleID: rid}
+	return gr, s.AddRoleBinding(gr)
+}
+
+func (s *groupStore) RemoveRole(gid uint, rid uint) error {
+	global := model.GroupRole{GroupID: gid, RoleID: rid}
+	return s.db.deleteFunc(tableGroupRole, func(row interface{}) bool {
+		return sameGroupRole(row.(model.GroupRole), global)
+	})
+}
+
+func (s *groupStore) Roles(gid uint) ([]model.Role, error) {
+	var rows []model.GroupRole
+	if err := s.db.find(tableGroupRole, &model.GroupRole{GroupID: gid}, &rows); err != nil {
+		return nil, err
+	}
+	var roles []model.Role
+	for _, row := range rows {
+		r := new(model.Role)
+		if err := s.db.get(tableRole, row.RoleID, r); err == nil {
+			roles = append(roles, *r)
+		}
+	}
+	return roles, nil
+}
+
+func (s *groupStore) AddRoleBinding(gr *model.GroupRole) error {
+	binding := *gr
+	err := s.db.firstOrCreateFunc(tableGroupRole, gr, func(row interface{}) bool {
+		return sameGroupRole(row.(model.GroupRole), binding)
+	})
+	if err != nil {
+		return err
+	}
+	gr.ExpiresAt = binding.ExpiresAt
+	s.db.save(tableGroupRole, gr)
+	return nil
+}
+
+func (s *groupStore) RemoveRoleBinding(id uint) error {
+	return s.db.delete(tableGroupRole, id)
+}
+
+func (s *groupStore) RoleBindings(gid uint) ([]model.GroupRole, error) {
+	var bindings []model.GroupRole
+	return bindings, s.db.find(tableGroupRole, &model.GroupRole{GroupID: gid}, &bindings)
+}
+
+func sameGroupRole(a model.GroupRole, b model.GroupRole) bool {
+	return a.GroupID == b.GroupID && a.RoleID == b.RoleID &&
+		a.ProjectID == b.ProjectID && a.ProjectEnvID == b.ProjectEnvID
+}
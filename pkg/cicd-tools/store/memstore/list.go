@@ -0,0 +1,249 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package memstore
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+// tables 模型类型与表名的对应关系, 供 List 按条件的类型查找表
+var tables = map[reflect.Type]string{
+	reflect.TypeOf(model.User{}):            tableUser,
+	reflect.TypeOf(model.Group{}):           tableGroup,
+	reflect.TypeOf(model.Role{}):            tableRole,
+	reflect.TypeOf(model.Permission{}):      tablePermission,
+	reflect.TypeOf(model.UserGroup{}):       tableUserGroup,
+	reflect.TypeOf(model.UserRole{}):        tableUserRole,
+	reflect.TypeOf(model.GroupRole{}):       tableGroupRole,
+	reflect.TypeOf(model.RoleParent{}):      tableRoleParent,
+	reflect.TypeOf(model.RoleRequest{}):     tableRoleRequest,
+	reflect.TypeOf(model.RoleGrantLog{}):    tableRoleGrantLog,
+	reflect.TypeOf(model.PasswordHistory{}): tablePasswordHistory,
+	reflect.TypeOf(model.RevokedToken{}):    tableRevokedToken,
+	reflect.TypeOf(model.PersonalToken{}):   tablePersonalToken,
+	reflect.TypeOf(model.UserTOTP{}):        tableUserTOTP,
+	reflect.TypeOf(model.RecoveryCode{}):    tableRecoveryCode,
+	reflect.TypeOf(model.LoginHistory{}):    tableLoginHistory,
+	reflect.TypeOf(model.Project{}):         tableProject,
+	reflect.TypeOf(model.Env{}):             tableEnv,
+	reflect.TypeOf(model.Item{}):            tableItem,
+	reflect.TypeOf(model.ProjectEnv{}):      tableProjectEnv,
+	reflect.TypeOf(model.ProjectItem{}):     tableProjectItem,
+	reflect.TypeOf(model.ProjectEnvItem{}):  tableProjectEnvItem,
+	reflect.TypeOf(model.GitRepo{}):         tableGitRepo,
+	reflect.TypeOf(model.GitConfig{}):       tableGitConfig,
+	reflect.TypeOf(model.CommitInfo{}):      tableCommitInfo,
+	reflect.TypeOf(model.Artifact{}):        tableArtifact,
+	reflect.TypeOf(model.BuildConfig{}):     tableBuildConfig,
+	reflect.TypeOf(model.BuildInfo{}):       tableBuildInfo,
+	reflect.TypeOf(model.BuildLog{}):        tableBuildLog,
+}
+
+func (s *Store) List(cond interface{}, q *model.Query, out interface{}) (*model.Page, error) {
+	return s.db.list(cond, q, out)
+}
+
+// list 供各实体的存储复用, 关联查询同样经过 Query 的校验与分页
+func (d *database) list(cond interface{}, q *model.Query, out interface{}) (*model.Page, error) {
+	name, ok := tables[reflect.Indirect(reflect.ValueOf(cond)).Type()]
+	if !ok {
+		return nil, fmt.Errorf("不支持查询%T", cond)
+	}
+	p, err := q.Plan(cond)
+	if err != nil {
+		return nil, err
+	}
+	var via map[uint]bool
+	if p.Via != nil {
+		if via, err = d.via(p.Via); err != nil {
+			return nil, err
+		}
+	}
+	d.mu.Lock()
+	all := d.rowsLocked(name)
+	d.mu.Unlock()
+	var rows []reflect.Value
+	for _, row := range all {
+		v := reflect.ValueOf(row)
+		if via != nil && !via[uint(v.FieldByName("ID").Uint())] {
+			continue
+		}
+		if matches(cond, row) && matchFilters(p, v) {
+			rows = append(rows, v)
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return compareRows(p, rows[i], rows[j]) < 0
+	})
+	total := int64(len(rows))
+	if len(p.After) > 0 {
+		i := sort.Search(len(rows), func(i int) bool {
+			return compareAfter(p, rows[i]) > 0
+		})
+		rows = rows[i:]
+	}
+	if p.Offset > 0 {
+		if p.Offset > len(rows) {
+			rows = nil
+		} else {
+			rows = rows[p.Offset:]
+		}
+	}
+	if p.Limit > 0 && len(rows) > p.Limit+1 {
+		rows = rows[:p.Limit+1]
+	}
+	slice := reflect.ValueOf(out).Elem()
+	slice.Set(reflect.MakeSlice(slice.Type(), 0, len(rows)))
+	for _, row := range rows {
+		slice.Set(reflect.Append(slice, row))
+	}
+	return p.Page(out, total)
+}
+
+// via 关联表中满足条件的记录指向的 id
+func (d *database) via(v *model.PlanVia) (map[uint]bool, error) {
+	name, ok := tables[reflect.Indirect(reflect.ValueOf(v.Cond)).Type()]
+	if !ok {
+		return nil, fmt.Errorf("不支持关联查询%T", v.Cond)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ids := make(map[uint]bool)
+	for _, row := range d.rowsLocked(name) {
+		if matches(v.Cond, row) {
+			ids[uint(reflect.ValueOf(row).FieldByIndex(v.Index).Uint())] = true
+		}
+	}
+	return ids, nil
+}
+
+func matchFilters(p *model.QueryPlan, row reflect.Value) bool {
+	for _, f := range p.Filters {
+		if !matchFilter(f, row.FieldByIndex(f.Index)) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchFilter 与 SQL 一致, 为空的指针字段不满足任何条件
+func matchFilter(f model.PlanFilter, v reflect.Value) bool {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return false
+		}
+		v = v.Elem()
+	}
+	if f.Op == model.OpContains {
+		return strings.Contains(strings.ToLower(v.String()), strings.ToLower(f.Value.(string)))
+	}
+	c := compareValues(v, reflect.ValueOf(f.Value))
+	switch f.Op {
+	case model.OpNe:
+		return c != 0
+	case model.OpGt:
+		return c > 0
+	case model.OpGe:
+		return c >= 0
+	case model.OpLt:
+		return c < 0
+	case model.OpLe:
+		return c <= 0
+	default:
+		return c == 0
+	}
+}
+
+func compareRows(p *model.QueryPlan, a, b reflect.Value) int {
+	for _, s := range p.Sort {
+		if c := compareValues(a.FieldByIndex(s.Index), b.FieldByIndex(s.Index)); c != 0 {
+			if s.Desc {
+				return -c
+			}
+			return c
+		}
+	}
+	return 0
+}
+
+// compareAfter 比较记录与游标的位置, 大于 0 时记录排在游标之后
+func compareAfter(p *model.QueryPlan, row reflect.Value) int {
+	for i, s := range p.Sort {
+		if c := compareValues(row.FieldByIndex(s.Index), reflect.ValueOf(p.After[i])); c != 0 {
+			if s.Desc {
+				return -c
+			}
+			return c
+		}
+	}
+	return 0
+}
+
+func compareValues(a, b reflect.Value) int {
+	if t, ok := a.Interface().(time.Time); ok {
+		u := b.Interface().(time.Time)
+		switch {
+		case t.Before(u):
+			return -1
+		case t.After(u):
+			return 1
+		}
+		return 0
+	}
+	switch a.Kind() {
+	case reflect.String:
+		return strings.Compare(a.String(), b.String())
+	case reflect.Bool:
+		if a.Bool() == b.Bool() {
+			return 0
+		} else if b.Bool() {
+			return -1
+		}
+		return 1
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		x, y := a.Int(), b.Int()
+		if x < y {
+			return -1
+		} else if x > y {
+			return 1
+		}
+		return 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		x, y := a.Uint(), b.Uint()
+		if x < y {
+			return -1
+		} else if x > y {
+			return 1
+		}
+		return 0
+	case reflect.Float32, reflect.Float64:
+		x, y := a.Float(), b.Float()
+		if x < y {
+			return -1
+		} else if x > y {
+			return 1
+		}
+		return 0
+	}
+	return 0
+}
@@ -0,0 +1,51 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package memstore
+
+import (
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+type loginStore struct {
+	db *database
+}
+
+func (s *loginStore) Add(h *model.LoginHistory) error {
+	s.db.insert(tableLoginHistory, h)
+	return nil
+}
+
+func (s *loginStore) Find(q model.LoginQuery) ([]model.LoginHistory, error) {
+	var history []model.LoginHistory
+	err := s.db.findFunc(tableLoginHistory, &history, func(row interface{}) bool {
+		h := row.(model.LoginHistory)
+		return (q.UserID == 0 || h.UserID == q.UserID) &&
+			(q.Username == "" || h.Username == q.Username) &&
+			(!q.Failed || !h.Success) &&
+			(q.Since.IsZero() || !h.CreatedAt.Before(q.Since))
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+		history[i], history[j] = history[j], history[i]
+	}
+	if q.Limit > 0 && len(history) > q.Limit {
+		history = history[:q.Limit]
+	}
+	return history, nil
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package memstore
+
+import (
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+type mfaStore struct {
+	db *database
+}
+
+func (s *mfaStore) TOTP(uid uint) (*model.UserTOTP, error) {
+	t := new(model.UserTOTP)
+	if err := s.db.first(tableUserTOTP, &model.UserTOTP{UserID: uid}, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (s *mfaStore) SaveTOTP(t *model.UserTOTP) error {
+	s.db.save(tableUserTOTP, t)
+	return nil
+}
+
+func (s *mfaStore) DeleteTOTP(uid uint) error {
+	if err := s.db.deleteWhere(tableRecoveryCode, &model.RecoveryCode{UserID: uid}); err != nil {
+		return err
+	}
+	return s.db.deleteWhere(tableUserTOTP, &model.UserTOTP{UserID: uid})
+}
+
+func (s *mfaStore) ReplaceRecoveryCodes(uid uint, codes []model.RecoveryCode) error {
+	if err := s.db.deleteWhere(tableRecoveryCode, &model.RecoveryCode{UserID: uid}); err != nil {
+		return err
+	}
+	for i := range codes {
+		s.db.insert(tableRecoveryCode, &codes[i])
+	}
+	return nil
+}
+
+func (s *mfaStore) RecoveryCodes(uid uint) ([]model.RecoveryCode, error) {
+	var codes []model.RecoveryCode
+	return codes, s.db.find(tableRecoveryCode, &model.RecoveryCode{UserID: uid}, &codes)
+}
+
+func (s *mfaStore) SaveRecoveryCode(c *model.RecoveryCode) error {
+	s.db.save(tableRecoveryCode, c)
+	return nil
+}
@@ -0,0 +1,222 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package memstore
+
+import (
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+type projectStore struct {
+	db *database
+}
+
+func (s *projectStore) Get(id uint) (*model.Project, error) {
+	p := new(model.Project)
+	if err := s.db.get(tableProject, id, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *projectStore) First(cond *model.Project) (*model.Project, error) {
+	p := new(model.Project)
+	if err := s.db.first(tableProject, cond, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *projectStore) Find(cond *model.Project) ([]model.Project, error) {
+	var projects []model.Project
+	return projects, s.db.find(tableProject, cond, &projects)
+}
+
+func (s *projectStore) Create(p *model.Project) error {
+	s.db.insert(tableProject, p)
+	return nil
+}
+
+func (s *projectStore) FirstOrCreate(p *model.Project) error {
+	return s.db.firstOrCreate(tableProject, p)
+}
+
+func (s *projectStore) Save(p *model.Project) error {
+	s.db.save(tableProject, p)
+	return nil
+}
+
+func (s *projectStore) Delete(id uint) error {
+	return s.db.delete(tableProject, id)
+}
+
+func (s *projectStore) GetEnv(id uint) (*model.Env, error) {
+	e := new(model.Env)
+	if err := s.db.get(tableEnv, id, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (s *projectStore) FirstEnv(cond *model.Env) (*model.Env, error) {
+	e := new(model.Env)
+	if err := s.db.first(tableEnv, cond, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (s *projectStore) FindEnvs(cond *model.Env) ([]model.Env, error) {
+	var envs []model.Env
+	return envs, s.db.find(tableEnv, cond, &envs)
+}
+
+func (s *projectStore) FirstOrCreateEnv(e *model.Env) error {
+	return s.db.firstOrCreate(tableEnv, e)
+}
+
+func (s *projectStore) SaveEnv(e *model.Env) error {
+	s.db.save(tableEnv, e)
+	return nil
+}
+
+func (s *projectStore) DeleteEnv(id uint) error {
+	return s.db.delete(tableEnv, id)
+}
+
+func (s *projectStore) GetItem(id uint) (*model.Item, error) {
+	i := new(model.Item)
+	if err := s.db.get(tableItem, id, i); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+func (s *projectStore) FirstItem(cond *model.Item) (*model.Item, error) {
+	i := new(model.Item)
+	if err := s.db.first(tableItem, cond, i); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+func (s *projectStore) FindItems(cond *model.Item) ([]model.Item, error) {
+	var items []model.Item
+	return items, s.db.find(tableItem, cond, &items)
+}
+
+func (s *projectStore) FirstOrCreateItem(i *model.Item) error {
+	return s.db.firstOrCreate(tableItem, i)
+}
+
+func (s *projectStore) SaveItem(i *model.Item) error {
+	s.db.save(tableItem, i)
+	return nil
+}
+
+func (s *projectStore) DeleteItem(id uint) error {
+	return s.db.delete(tableItem, id)
+}
+
+func (s *projectStore) AddEnv(pid uint, eid uint) (*model.ProjectEnv, error) {
+	pe := &model.ProjectEnv{ProjectID: pid, EnvID: eid}
+	return pe, s.db.firstOrCreate(tableProjectEnv, pe)
+}
+
+func (s *projectStore) RemoveEnv(pid uint, eid uint) error {
+	return s.db.deleteWhere(tableProjectEnv, &model.ProjectEnv{ProjectID: pid, EnvID: eid})
+}
+
+func (s *projectStore) ProjectEnv(pid uint, eid uint) (*model.ProjectEnv, error) {
+	pe := new(model.ProjectEnv)
+	if err := s.db.first(tableProjectEnv, &model.ProjectEnv{ProjectID: pid, EnvID: eid}, pe); err != nil {
+		return nil, err
+	}
+	return pe, nil
+}
+
+func (s *projectStore) GetProjectEnv(id uint) (*model.ProjectEnv, error) {
+	pe := new(model.ProjectEnv)
+	if err := s.db.get(tableProjectEnv, id, pe); err != nil {
+		return nil, err
+	}
+	return pe, nil
+}
+
+func (s *projectStore) Envs(pid uint) ([]model.Env, error) {
+	var rows []model.ProjectEnv
+	if err := s.db.find(tableProjectEnv, &model.ProjectEnv{ProjectID: pid}, &rows); err != nil {
+		return nil, err
+	}
+	var envs []model.Env
+	for _, row := range rows {
+		e := new(model.Env)
+		if err := s.db.get(tableEnv, row.EnvID, e); err == nil {
+			envs = append(envs, *e)
+		}
+	}
+	return envs, nil
+}
+
+func (s *projectStore) AddItem(pid uint, iid uint) (*model.ProjectItem, error) {
+	pi := &model.ProjectItem{ProjectID: pid, ItemID: iid}
+	return pi, s.db.firstOrCreate(tableProjectItem, pi)
+}
+
+func (s *projectStore) RemoveItem(pid uint, iid uint) error {
+	return s.db.deleteWhere(tableProjectItem, &model.ProjectItem{ProjectID: pid, ItemID: iid})
+}
+
+func (s *projectStore) Items(pid uint) ([]model.Item, error) {
+	var rows []model.ProjectItem
+	if err := s.db.find(tableProjectItem, &model.ProjectItem{ProjectID: pid}, &rows); err != nil {
+		return nil, err
+	}
+	var items []model.Item
+	for _, row := range rows {
+		i := new(model.Item)
+		if err := s.db.get(tableItem, row.ItemID, i); err == nil {
+			items = append(items, *i)
+		}
+	}
+	return items, nil
+}
+
+func (s *projectStore) FirstEnvItem(cond *model.ProjectEnvItem) (*model.ProjectEnvItem, error) {
+	pei := new(model.ProjectEnvItem)
+	if err := s.db.first(tableProjectEnvItem, cond, pei); err != nil {
+		return nil, err
+	}
+	return pei, nil
+}
+
+func (s *projectStore) FindEnvItems(cond *model.ProjectEnvItem) ([]model.ProjectEnvItem, error) {
+	var envItems []model.ProjectEnvItem
+	return envItems, s.db.find(tableProjectEnvItem, cond, &envItems)
+}
+
+func (s *projectStore) FirstOrCreateEnvItem(pei *model.ProjectEnvItem) error {
+	return s.db.firstOrCreate(tableProjectEnvItem, pei)
+}
+
+func (s *projectStore) SaveEnvItem(pei *model.ProjectEnvItem) error {
+	s.db.save(tableProjectEnvItem, pei)
+	return nil
+}
+
+func (s *projectStore) DeleteEnvItem(id uint) error {
+	return s.db.delete(tableProjectEnvItem, id)
+}
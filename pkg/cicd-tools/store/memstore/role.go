@@ -0,0 +1,129 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package memstore
+
+import (
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+type roleStore struct {
+	db *database
+}
+
+func (s *roleStore) Get(id uint) (*model.Role, error) {
+	r := new(model.Role)
+	if err := s.db.get(tableRole, id, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *roleStore) First(cond *model.Role) (*model.Role, error) {
+	r := new(model.Role)
+	if err := s.db.first(tableRole, cond, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *roleStore) Find(cond *model.Role) ([]model.Role, error) {
+	var roles []model.Role
+	return roles, s.db.find(tableRole, cond, &roles)
+}
+
+func (s *roleStore) Create(r *model.Role) error {
+	s.db.insert(tableRole, r)
+	return nil
+}
+
+func (s *roleStore) FirstOrCreate(r *model.Role) error {
+	return s.db.firstOrCreate(tableRole, r)
+}
+
+func (s *roleStore) Save(r *model.Role) error {
+	s.db.save(tableRole, r)
+	return nil
+}
+
+func (s *roleStore) Delete(id uint) error {
+	return s.db.delete(tableRole, id)
+}
+
+func (s *roleStore) Users(rid uint) ([]model.User, error) {
+	var users []model.User
+	_, err := s.db.list(&model.User{}, &model.Query{Via: model.UsersOfRole(rid)}, &users)
+	return users, err
+}
+
+func (s *roleStore) Groups(rid uint) ([]model.Group, error) {
+	var groups []model.Group
+	_, err := s.db.list(&model.Group{}, &model.Query{Via: model.GroupsOfRole(rid)}, &groups)
+	return groups, err
+}
+
+func (s *roleStore) Permissions(rid uint) ([]model.Permission, error) {
+	var permissions []model.Permission
+	return permissions, s.db.find(tablePermission, &model.Permission{RoleID: rid}, &permissions)
+}
+
+func (s *roleStore) AddPermission(p *model.Permission) error {
+	s.db.insert(tablePermission, p)
+	return nil
+}
+
+func (s *roleStore) RemovePermission(id uint) error {
+	return s.db.delete(tablePermission, id)
+}
+
+func (s *roleStore) AddParent(rid uint, pid uint) (*model.RoleParent, error) {
+	rp := &model.RoleParent{RoleID: rid, ParentID: pid}
+	return rp, s.db.firstOrCreate(tableRoleParent, rp)
+}
+
+func (s *roleStore) RemoveParent(rid uint, pid uint) error {
+	return s.db.deleteWhere(tableRoleParent, &model.RoleParent{RoleID: rid, ParentID: pid})
+}
+
+func (s *roleStore) Parents(rid uint) ([]model.Role, error) {
+	var rows []model.RoleParent
+	if err := s.db.find(tableRoleParent, &model.RoleParent{RoleID: rid}, &rows); err != nil {
+		return nil, err
+	}
+	var roles []model.Role
+	for _, row := range rows {
+		r := new(model.Role)
+		if err := s.db.get(tableRole, row.ParentID, r); err == nil {
+			roles = append(roles, *r)
+		}
+	}
+	return roles, nil
+}
+
+func (s *roleStore) Children(rid uint) ([]model.Role, error) {
+	var rows []model.RoleParent
+	if err := s.db.find(tableRoleParent, &model.RoleParent{ParentID: rid}, &rows); err != nil {
+		return nil, err
+	}
+	var roles []model.Role
+	for _, row := range rows {
+		r := new(model.Role)
+		if err := s.db.get(tableRole, row.RoleID, r); err == nil {
+			roles = append(roles, *r)
+		}
+	}
+	return roles, nil
+}
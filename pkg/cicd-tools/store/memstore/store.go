@@ -0,0 +1,122 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package memstore
+
+import (
+	"sync"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+const (
+	tableUser            = "user"
+	tableGroup           = "group"
+	tableRole            = "role"
+	tablePermission      = "permission"
+	tableUserGroup       = "user_group"
+	tableUserRole        = "user_role"
+	tableGroupRole       = "group_role"
+	tableRoleParent      = "role_parent"
+	tableRoleRequest     = "role_request"
+	tableRoleGrantLog    = "role_grant_log"
+	tablePasswordHistory = "password_history"
+	tableRevokedToken    = "revoked_token"
+	tablePersonalToken   = "personal_token"
+	tableUserTOTP        = "user_totp"
+	tableRecoveryCode    = "recovery_code"
+	tableLoginHistory    = "login_history"
+	tableProject         = "project"
+	tableEnv             = "env"
+	tableItem            = "item"
+	tableProjectEnv      = "project_env"
+	tableProjectItem     = "project_item"
+	tableProjectEnvItem  = "project_env_item"
+	tableGitRepo         = "git_repo"
+	tableGitConfig       = "git_config"
+	tableCommitInfo      = "commit_info"
+	tableArtifact        = "artifact"
+	tableBuildConfig     = "build_config"
+	tableBuildInfo       = "build_info"
+	tableBuildLog        = "build_log"
+)
+
+// Store 内存存储实现, 用于测试和本地演示, 进程退出后数据丢失
+type Store struct {
+	db     *database
+	tx     *sync.Mutex
+	nested bool
+}
+
+func New() *Store {
+	return &Store{db: newDatabase(), tx: new(sync.Mutex)}
+}
+
+func (s *Store) Users() model.UserStore {
+	return &userStore{db: s.db}
+}
+
+func (s *Store) Groups() model.GroupStore {
+	return &groupStore{db: s.db}
+}
+
+func (s *Store) Roles() model.RoleStore {
+	return &roleStore{db: s.db}
+}
+
+func (s *Store) Projects() model.ProjectStore {
+	return &projectStore{db: s.db}
+}
+
+func (s *Store) Builds() model.BuildStore {
+	return &buildStore{db: s.db}
+}
+
+func (s *Store) Artifacts() model.ArtifactStore {
+	return &artifactStore{db: s.db}
+}
+
+func (s *Store) Grants() model.GrantStore {
+	return &grantStore{db: s.db}
+}
+
+func (s *Store) Tokens() model.TokenStore {
+	return &tokenStore{db: s.db}
+}
+
+func (s *Store) MFA() model.MFAStore {
+	return &mfaStore{db: s.db}
+}
+
+func (s *Store) Logins() model.LoginStore {
+	return &loginStore{db: s.db}
+}
+
+// Transaction 串行执行事务, fn 返回错误时只撤销本事务 (包括其中的嵌套事务) 的写入,
+// 事务外的并发写入不受影响; 事务之间串行执行, 但事务外的读写不等待事务结束
+func (s *Store) Transaction(fn func(s model.Store) error) error {
+	if !s.nested {
+		s.tx.Lock()
+		defer s.tx.Unlock()
+	}
+	db := s.db.begin()
+	mark := len(db.journal.entries)
+	if err := fn(&Store{db: db, tx: s.tx, nested: true}); err != nil {
+		db.rollback(mark)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package memstore
+
+import (
+	"errors"
+	"testing"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+// TestTransactionConcurrentWrite 回滚只撤销事务自身的写入, 事务进行中事务外的写入保留
+func TestTransactionConcurrentWrite(t *testing.T) {
+	s := New()
+	shared := &model.User{Name: "shared", Email: "shared@example.org"}
+	if err := s.Users().Create(shared); err != nil {
+		t.Fatal(err)
+	}
+	rollback := errors.New("rollback")
+	err := s.Transaction(func(tx model.Store) error {
+		if err := tx.Users().Create(&model.User{Name: "temp", Email: "temp@example.org"}); err != nil {
+			return err
+		}
+		done := make(chan error)
+		go func() {
+			if err := s.Users().Create(&model.User{Name: "outside", Email: "outside@example.org"}); err != nil {
+				done <- err
+				return
+			}
+			done <- s.Users().SetDisabled(shared.ID, true)
+		}()
+		if err := <-done; err != nil {
+			return err
+		}
+		return rollback
+	})
+	if !errors.Is(err, rollback) {
+		t.Fatalf("Transaction = %v", err)
+	}
+	if _, err := s.Users().First(&model.User{Name: "temp"}); !errors.Is(err, model.ErrNotFound) {
+		t.Fatalf("temp after rollback: %v", err)
+	}
+	if _, err := s.Users().First(&model.User{Name: "outside"}); err != nil {
+		t.Fatalf("outside write lost: %v", err)
+	}
+	got, err := s.Users().Get(shared.ID)
+	if err != nil || !got.Disabled {
+		t.Fatalf("outside update lost: %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package memstore
+
+import (
+	"reflect"
+	"time"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+type tokenStore struct {
+	db *database
+}
+
+func (s *tokenStore) Revoke(t *model.RevokedToken) (bool, error) {
+	tokenID := t.TokenID
+	return s.db.insertUnique(tableRevokedToken, t, func(row interface{}) bool {
+		return row.(model.RevokedToken).TokenID == tokenID
+	}), nil
+}
+
+func (s *tokenStore) IsRevoked(tokenID string) (bool, error) {
+	err := s.db.first(tableRevokedToken, &model.RevokedToken{TokenID: tokenID}, new(model.RevokedToken))
+	if err == model.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *tokenStore) Purge(before time.Time) error {
+	return s.db.deleteFunc(tableRevokedToken, func(row interface{}) bool {
+		return row.(model.RevokedToken).ExpiresAt.Before(before)
+	})
+}
+
+func (s *tokenStore) CreatePersonal(t *model.PersonalToken) error {
+	s.db.insert(tablePersonalToken, t)
+	return nil
+}
+
+func (s *tokenStore) GetPersonal(id uint) (*model.PersonalToken, error) {
+	t := new(model.PersonalToken)
+	if err := s.db.get(tablePersonalToken, id, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (s *tokenStore) FindPersonal(cond *model.PersonalToken) ([]model.PersonalToken, error) {
+	var tokens []model.PersonalToken
+	return tokens, s.db.find(tablePersonalToken, cond, &tokens)
+}
+
+func (s *tokenStore) PersonalByHash(hash string) (*model.PersonalToken, error) {
+	t := new(model.PersonalToken)
+	if err := s.db.first(tablePersonalToken, &model.PersonalToken{Hash: hash}, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (s *tokenStore) TouchPersonal(id uint, at time.Time) (bool, error) {
+	var touched bool
+	err := s.db.update(tablePersonalToken, id, func(v reflect.Value) bool {
+		t := v.Addr().Interface().(*model.PersonalToken)
+		if t.RevokedAt != nil {
+			return false
+		}
+		t.LastUsedAt = &at
+		touched = true
+		return true
+	})
+	return touched, err
+}
+
+func (s *tokenStore) RevokePersonal(id uint, at time.Time) error {
+	return s.db.update(tablePersonalToken, id, func(v reflect.Value) bool {
+		t := v.Addr().Interface().(*model.PersonalToken)
+		if t.RevokedAt != nil {
+			return false
+		}
+		t.RevokedAt = &at
+		return true
+	})
+}
+
+func (s *tokenStore) RevokePersonalByUser(uid uint, at time.Time) error {
+	s.db.updateFunc(tablePersonalToken, func(row interface{}) bool {
+		t := row.(model.PersonalToken)
+		return t.UserID == uid && t.RevokedAt == nil
+	}, func(v reflect.Value) {
+		v.Addr().Interface().(*model.PersonalToken).RevokedAt = &at
+	})
+	return nil
+}
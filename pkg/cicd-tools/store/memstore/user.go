@@ -0,0 +1,231 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package memstore
+
+import (
+	"reflect"
+	"time"
+
+	"devops/cicd-tools/pkg/cicd-tools/model"
+)
+
+type userStore struct {
+	db *database
+}
+
+func (s *userStore) Get(id uint) (*model.User, error) {
+	u := new(model.User)
+	if err := s.db.get(tableUser, id, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (s *userStore) First(cond *model.User) (*model.User, error) {
+	u := new(model.User)
+	if err := s.db.first(tableUser, cond, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (s *userStore) Find(cond *model.User) ([]model.User, error) {
+	var users []model.User
+	return users, s.db.find(tableUser, cond, &users)
+}
+
+func (s *userStore) Create(u *model.User) error {
+	s.db.insert(tableUser, u)
+	return nil
+}
+
+func (s *userStore) FirstOrCreate(u *model.User) error {
+	return s.db.firstOrCreate(tableUser, u)
+}
+
+func (s *userStore) Save(u *model.User) error {
+	s.db.save(tableUser, u)
+	return nil
+}
+
+func (s *userStore) Delete(id uint) error {
+	return s.db.delete(tableUser, id)
+}
+
+func (s *userStore) AddGroup(uid uint, gid uint) (*model.UserGroup, error) {
+	ug := &model.UserGroup{UserID: uid, GroupID: gid}
+	return ug, s.db.firstOrCreate(tableUserGroup, ug)
+}
+
+func (s *userStore) RemoveGroup(uid uint, gid uint) error {
+	return s.db.deleteWhere(tableUserGroup, &model.UserGroup{UserID: uid, GroupID: gid})
+}
+
+func (s *userStore) Groups(uid uint) ([]model.Group, error) {
+	var groups []model.Group
+	_, err := s.db.list(&model.Group{}, &model.Query{Via: model.GroupsOfUser(uid)}, &groups)
+	return groups, err
+}
+
+func (s *userStore) AddRole(uid uint, rid uint) (*model.UserRole, error) {
+	ur := &model.UserRole{UserID: uid, RoleID: rid}
+	return ur, s.AddRoleBinding(ur)
+}
+
+func (s *userStore) RemoveRole(uid uint, rid uint) error {
+	global := model.UserRole{UserID: uid, RoleID: rid}
+	return s.db.deleteFunc(tableUserRole, func(row interface{}) bool {
+		return sameUserRole(row.(model.UserRole), global)
+	})
+}
+
+func (s *userStore) Roles(uid uint) ([]model.Role, error) {
+	var rows []model.UserRole
+	if err := s.db.find(tableUserRole, &model.UserRole{UserID: uid}, &rows); err != nil {
+		return nil, err
+	}
+	var roles []model.Role
+	for _, row := range rows {
+		r := new(model.Role)
+		if err := s.db.get(tableRole, row.RoleID, r); err == nil {
+			roles = append(roles, *r)
+		}
+	}
+	return roles, nil
+}
+
+func (s *userStore) AddRoleBinding(ur *model.UserRole) error {
+	binding := *ur
+	err := s.db.firstOrCreateFunc(tableUserRole, ur, func(row interface{}) bool {
+		return sameUserRole(row.(model.UserRole), binding)
+	})
+	if err != nil {
+		return err
+	}
+	ur.ExpiresAt = binding.ExpiresAt
+	s.db.save(tableUserRole, ur)
+	return nil
+}
+
+func (s *userStore) RemoveRoleBinding(id uint) error {
+	return s.db.delete(tableUserRole, id)
+}
+
+func (s *userStore) RoleBindings(uid uint) ([]model.UserRole, error) {
+	var bindings []model.UserRole
+	return bindings, s.db.find(tableUserRole, &model.UserRole{UserID: uid}, &bindings)
+}
+
+func sameUserRole(a model.UserRole, b model.UserRole) bool {
+	return a.UserID == b.UserID && a.RoleID == b.RoleID &&
+		a.ProjectID == b.ProjectID && a.ProjectEnvID == b.ProjectEnvID
+}
+
+func (s *userStore) UpdatePassword(uid uint, hash model.PasswordHash) error {
+	u, err := s.Get(uid)
+	if err != nil {
+		return err
+	}
+	u.Password = hash
+	s.db.save(tableUser, u)
+	return nil
+}
+
+func (s *userStore) UpdateProfile(u *model.User) error {
+	err := s.db.update(tableUser, u.ID, func(v reflect.Value) bool {
+		stored := v.Addr().Interface().(*model.User)
+		stored.Name = u.Name
+		stored.Email = u.Email
+		stored.FullName = u.FullName
+		stored.Gender = u.Gender
+		stored.Age = u.Age
+		stored.Location = u.Location
+		stored.Job = u.Job
+		stored.Mobile = u.Mobile
+		stored.DingTalkID = u.DingTalkID
+		stored.WXWorkID = u.WXWorkID
+		stored.ServiceAccount = u.ServiceAccount
+		stored.Disabled = u.Disabled
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	stored, err := s.Get(u.ID)
+	if err != nil {
+		return err
+	}
+	u.UpdatedAt = stored.UpdatedAt
+	return nil
+}
+
+func (s *userStore) UpdateLoginState(uid uint, failedLogins int, lockedUntil *time.Time) error {
+	return s.db.update(tableUser, uid, func(v reflect.Value) bool {
+		u := v.Addr().Interface().(*model.User)
+		u.FailedLogins = failedLogins
+		u.LockedUntil = lockedUntil
+		return true
+	})
+}
+
+func (s *userStore) IncrementFailedLogins(uid uint) (int, error) {
+	var count int
+	err := s.db.update(tableUser, uid, func(v reflect.Value) bool {
+		u := v.Addr().Interface().(*model.User)
+		u.FailedLogins++
+		count = u.FailedLogins
+		return true
+	})
+	return count, err
+}
+
+func (s *userStore) SetDisabled(uid uint, disabled bool) error {
+	u, err := s.Get(uid)
+	if err != nil {
+		return err
+	}
+	u.Disabled = disabled
+	s.db.save(tableUser, u)
+	return nil
+}
+
+func (s *userStore) IncrementTokenVersion(uid uint) error {
+	return s.db.update(tableUser, uid, func(v reflect.Value) bool {
+		u := v.Addr().Interface().(*model.User)
+		u.TokenVersion++
+		return true
+	})
+}
+
+func (s *userStore) AddPasswordHistory(h *model.PasswordHistory) error {
+	s.db.insert(tablePasswordHistory, h)
+	return nil
+}
+
+func (s *userStore) PasswordHistory(uid uint, limit int) ([]model.PasswordHistory, error) {
+	var history []model.PasswordHistory
+	if err := s.db.find(tablePasswordHistory, &model.PasswordHistory{UserID: uid}, &history); err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+		history[i], history[j] = history[j], history[i]
+	}
+	if len(history) > limit {
+		history = history[:limit]
+	}
+	return history, nil
+}
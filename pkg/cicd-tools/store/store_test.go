@@ -0,0 +1,508 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package store_test
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"devops/cicd-tools/pkg/cicd-tools/migrate"
+	"devops/cicd-tools/pkg/cicd-tools/model"
+	"devops/cicd-tools/pkg/cicd-tools/store/gormstore"
+	"devops/cicd-tools/pkg/cicd-tools/store/memstore"
+)
+
+var errRollback = errors.New("rollback")
+
+// each 对 gormstore 与 memstore 执行相同的用例, 保证两种实现行为一致; gormstore 使用按迁移创建表结构的内存 SQLite
+func each(t *testing.T, fn func(t *testing.T, s model.Store)) {
+	t.Run("gormstore", func(t *testing.T) {
+		db, err := model.OpenSQLite(":memory:", "cicd_")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := migrate.New(db).Up(0); err != nil {
+			t.Fatal(err)
+		}
+		fn(t, gormstore.New(db))
+	})
+	t.Run("memstore", func(t *testing.T) {
+		fn(t, memstore.New())
+	})
+}
+
+func names(users []model.User) []string {
+	var out []string
+	for _, u := range users {
+		out = append(out, u.Name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func groupNames(groups []model.Group) []string {
+	var out []string
+	for _, g := range groups {
+		out = append(out, g.Name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func roleNames(roles []model.Role) []string {
+	var out []string
+	for _, r := range roles {
+		out = append(out, r.Name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func equal(a []string, b ...string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestUserCRUD(t *testing.T) {
+	each(t, func(t *testing.T, s model.Store) {
+		u := &model.User{Name: "alice", Email: "alice@example.org", Job: "dev"}
+		if err := s.Users().Create(u); err != nil {
+			t.Fatal(err)
+		}
+		if u.ID == 0 || u.CreatedAt.IsZero() {
+			t.Fatalf("created = %+v", u)
+		}
+		if err := s.Users().Create(&model.User{Name: "bob", Email: "bob@example.org", Job: "ops"}); err != nil {
+			t.Fatal(err)
+		}
+		got, err := s.Users().First(&model.User{Email: "alice@example.org"})
+		if err != nil || got.ID != u.ID {
+			t.Fatalf("First = %+v, %v", got, err)
+		}
+		found, err := s.Users().Find(&model.User{Job: "ops"})
+		if err != nil || !equal(names(found), "bob") {
+			t.Fatalf("Find = %v, %v", names(found), err)
+		}
+		all, err := s.Users().Find(&model.User{})
+		if err != nil || !equal(names(all), "alice", "bob") {
+			t.Fatalf("Find all = %v, %v", names(all), err)
+		}
+
+		got.FullName = "Alice"
+		if err := s.Users().Save(got); err != nil {
+			t.Fatal(err)
+		}
+		got, err = s.Users().Get(u.ID)
+		if err != nil || got.FullName != "Alice" || got.Email != "alice@example.org" {
+			t.Fatalf("Get after save = %+v, %v", got, err)
+		}
+		if err := s.Users().Delete(u.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Users().Get(u.ID); !errors.Is(err, model.ErrNotFound) {
+			t.Fatalf("Get after delete: %v", err)
+		}
+		if _, err := s.Users().First(&model.User{Name: "alice"}); !errors.Is(err, model.ErrNotFound) {
+			t.Fatalf("First after delete: %v", err)
+		}
+	})
+}
+
+func TestUserLoginState(t *testing.T) {
+	each(t, func(t *testing.T, s model.Store) {
+		u := &model.User{Name: "alice", Email: "alice@example.org"}
+		if err := s.Users().Create(u); err != nil {
+			t.Fatal(err)
+		}
+		for i := 1; i <= 3; i++ {
+			n, err := s.Users().IncrementFailedLogins(u.ID)
+			if err != nil || n != i {
+				t.Fatalf("IncrementFailedLogins = %d, %v, want %d", n, err, i)
+			}
+		}
+		if _, err := s.Users().IncrementFailedLogins(u.ID + 100); !errors.Is(err, model.ErrNotFound) {
+			t.Fatalf("IncrementFailedLogins(unknown): %v", err)
+		}
+		until := time.Now().Add(time.Hour).Truncate(time.Second)
+		if err := s.Users().UpdateLoginState(u.ID, 0, &until); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Users().SetDisabled(u.ID, true); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Users().IncrementTokenVersion(u.ID); err != nil {
+			t.Fatal(err)
+		}
+		got, err := s.Users().Get(u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.FailedLogins != 0 || got.LockedUntil == nil || !got.LockedUntil.Equal(until) || !got.Disabled || got.TokenVersion != 1 {
+			t.Fatalf("user = %+v", got)
+		}
+		if got.Email != "alice@example.org" {
+			t.Fatalf("partial update changed other fields: %+v", got)
+		}
+		if err := s.Users().UpdateLoginState(u.ID, 0, nil); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := s.Users().Get(u.ID); err != nil || got.LockedUntil != nil {
+			t.Fatalf("unlock = %+v, %v", got, err)
+		}
+	})
+}
+
+func TestMembership(t *testing.T) {
+	each(t, func(t *testing.T, s model.Store) {
+		alice := &model.User{Name: "alice", Email: "alice@example.org"}
+		bob := &model.User{Name: "bob", Email: "bob@example.org"}
+		dev := &model.Group{Name: "dev"}
+		ops := &model.Group{Name: "ops"}
+		for _, u := range []*model.User{alice, bob} {
+			if err := s.Users().Create(u); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, g := range []*model.Group{dev, ops} {
+			if err := s.Groups().Create(g); err != nil {
+				t.Fatal(err)
+			}
+		}
+		first, err := s.Users().AddGroup(alice.ID, dev.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 重复加入返回已有的记录
+		again, err := s.Users().AddGroup(alice.ID, dev.ID)
+		if err != nil || again.ID != first.ID {
+			t.Fatalf("AddGroup again = %+v, %v, want id %d", again, err, first.ID)
+		}
+		for _, pair := range [][2]uint{{alice.ID, ops.ID}, {bob.ID, dev.ID}} {
+			if _, err := s.Users().AddGroup(pair[0], pair[1]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		groups, err := s.Users().Groups(alice.ID)
+		if err != nil || !equal(groupNames(groups), "dev", "ops") {
+			t.Fatalf("Groups = %v, %v", groupNames(groups), err)
+		}
+		users, err := s.Groups().Users(dev.ID)
+		if err != nil || !equal(names(users), "alice", "bob") {
+			t.Fatalf("Users = %v, %v", names(users), err)
+		}
+		if err := s.Users().RemoveGroup(alice.ID, dev.ID); err != nil {
+			t.Fatal(err)
+		}
+		users, err = s.Groups().Users(dev.ID)
+		if err != nil || !equal(names(users), "bob") {
+			t.Fatalf("Users after remove = %v, %v", names(users), err)
+		}
+	})
+}
+
+func TestRoleBindings(t *testing.T) {
+	each(t, func(t *testing.T, s model.Store) {
+		u := &model.User{Name: "alice", Email: "alice@example.org"}
+		if err := s.Users().Create(u); err != nil {
+			t.Fatal(err)
+		}
+		g := &model.Group{Name: "dev"}
+		if err := s.Groups().Create(g); err != nil {
+			t.Fatal(err)
+		}
+		viewer := &model.Role{Name: "viewer"}
+		developer := &model.Role{Name: "developer"}
+		for _, r := range []*model.Role{viewer, developer} {
+			if err := s.Roles().Create(r); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := s.Users().AddRole(u.ID, viewer.ID); err != nil {
+			t.Fatal(err)
+		}
+		expires := time.Now().Add(time.Hour).Truncate(time.Second)
+		scoped := &model.UserRole{UserID: u.ID, RoleID: developer.ID, ProjectID: 3, ExpiresAt: &expires}
+		if err := s.Users().AddRoleBinding(scoped); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Groups().AddRole(g.ID, developer.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		bindings, err := s.Users().RoleBindings(u.ID)
+		if err != nil || len(bindings) != 2 {
+			t.Fatalf("RoleBindings = %v, %v", bindings, err)
+		}
+		roles, err := s.Users().Roles(u.ID)
+		if err != nil || !equal(roleNames(roles), "developer", "viewer") {
+			t.Fatalf("Roles = %v, %v", roleNames(roles), err)
+		}
+		users, err := s.Roles().Users(developer.ID)
+		if err != nil || !equal(names(users), "alice") {
+			t.Fatalf("Roles().Users = %v, %v", names(users), err)
+		}
+		groups, err := s.Roles().Groups(developer.ID)
+		if err != nil || !equal(groupNames(groups), "dev") {
+			t.Fatalf("Roles().Groups = %v, %v", groupNames(groups), err)
+		}
+
+		// 移除全局角色不影响限定范围的绑定
+		if err := s.Users().RemoveRole(u.ID, developer.ID); err != nil {
+			t.Fatal(err)
+		}
+		if bindings, err := s.Users().RoleBindings(u.ID); err != nil || len(bindings) != 2 {
+			t.Fatalf("RoleBindings after RemoveRole = %v, %v", bindings, err)
+		}
+		if err := s.Users().RemoveRoleBinding(scoped.ID); err != nil {
+			t.Fatal(err)
+		}
+		roles, err = s.Users().Roles(u.ID)
+		if err != nil || !equal(roleNames(roles), "viewer") {
+			t.Fatalf("Roles after RemoveRoleBinding = %v, %v", roleNames(roles), err)
+		}
+	})
+}
+
+func TestRoleParents(t *testing.T) {
+	each(t, func(t *testing.T, s model.Store) {
+		base := &model.Role{Name: "base"}
+		dev := &model.Role{Name: "dev"}
+		admin := &model.Role{Name: "admin"}
+		for _, r := range []*model.Role{base, dev, admin} {
+			if err := s.Roles().Create(r); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, pair := range [][2]uint{{dev.ID, base.ID}, {admin.ID, base.ID}, {admin.ID, dev.ID}, {admin.ID, dev.ID}} {
+			if _, err := s.Roles().AddParent(pair[0], pair[1]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		parents, err := s.Roles().Parents(admin.ID)
+		if err != nil || !equal(roleNames(parents), "base", "dev") {
+			t.Fatalf("Parents = %v, %v", roleNames(parents), err)
+		}
+		children, err := s.Roles().Children(base.ID)
+		if err != nil || !equal(roleNames(children), "admin", "dev") {
+			t.Fatalf("Children = %v, %v", roleNames(children), err)
+		}
+		if err := s.Roles().RemoveParent(admin.ID, base.ID); err != nil {
+			t.Fatal(err)
+		}
+		if parents, err := s.Roles().Parents(admin.ID); err != nil || !equal(roleNames(parents), "dev") {
+			t.Fatalf("Parents after remove = %v, %v", roleNames(parents), err)
+		}
+	})
+}
+
+func TestRevokedTokens(t *testing.T) {
+	each(t, func(t *testing.T, s model.Store) {
+		now := time.Now()
+		revoked, err := s.Tokens().Revoke(&model.RevokedToken{TokenID: "a", UserID: 1, ExpiresAt: now.Add(-time.Minute)})
+		if err != nil || !revoked {
+			t.Fatalf("Revoke = %v, %v", revoked, err)
+		}
+		revoked, err = s.Tokens().Revoke(&model.RevokedToken{TokenID: "a", UserID: 1, ExpiresAt: now.Add(-time.Minute)})
+		if err != nil || revoked {
+			t.Fatalf("Revoke again = %v, %v", revoked, err)
+		}
+		if _, err := s.Tokens().Revoke(&model.RevokedToken{TokenID: "b", UserID: 1, ExpiresAt: now.Add(time.Hour)}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Tokens().Purge(now); err != nil {
+			t.Fatal(err)
+		}
+		for id, want := range map[string]bool{"a": false, "b": true, "c": false} {
+			if got, err := s.Tokens().IsRevoked(id); err != nil || got != want {
+				t.Errorf("IsRevoked(%s) = %v, %v, want %v", id, got, err, want)
+			}
+		}
+	})
+}
+
+func TestTransaction(t *testing.T) {
+	each(t, func(t *testing.T, s model.Store) {
+		keep := &model.User{Name: "keep", Email: "keep@example.org"}
+		if err := s.Users().Create(keep); err != nil {
+			t.Fatal(err)
+		}
+		g := &model.Group{Name: "dev"}
+		if err := s.Groups().Create(g); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Users().AddGroup(keep.ID, g.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		err := s.Transaction(func(tx model.Store) error {
+			if err := tx.Users().Create(&model.User{Name: "temp", Email: "temp@example.org"}); err != nil {
+				return err
+			}
+			keep.Job = "changed"
+			if err := tx.Users().Save(keep); err != nil {
+				return err
+			}
+			if err := tx.Users().RemoveGroup(keep.ID, g.ID); err != nil {
+				return err
+			}
+			return errRollback
+		})
+		if !errors.Is(err, errRollback) {
+			t.Fatalf("Transaction = %v", err)
+		}
+		all, err := s.Users().Find(&model.User{})
+		if err != nil || !equal(names(all), "keep") {
+			t.Fatalf("users after rollback = %v, %v", names(all), err)
+		}
+		if got, err := s.Users().Get(keep.ID); err != nil || got.Job != "" {
+			t.Fatalf("user after rollback = %+v, %v", got, err)
+		}
+		if groups, err := s.Users().Groups(keep.ID); err != nil || !equal(groupNames(groups), "dev") {
+			t.Fatalf("groups after rollback = %v, %v", groupNames(groups), err)
+		}
+
+		err = s.Transaction(func(tx model.Store) error {
+			if err := tx.Users().Create(&model.User{Name: "outer", Email: "outer@example.org"}); err != nil {
+				return err
+			}
+			// 嵌套事务失败时只撤销其自身的写入
+			nested := tx.Transaction(func(tx model.Store) error {
+				if err := tx.Users().Create(&model.User{Name: "inner", Email: "inner@example.org"}); err != nil {
+					return err
+				}
+				return errRollback
+			})
+			if !errors.Is(nested, errRollback) {
+				return nested
+			}
+			return tx.Groups().Delete(g.ID)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		all, err = s.Users().Find(&model.User{})
+		if err != nil || !equal(names(all), "keep", "outer") {
+			t.Fatalf("users after commit = %v, %v", names(all), err)
+		}
+		if _, err := s.Groups().Get(g.ID); !errors.Is(err, model.ErrNotFound) {
+			t.Fatalf("group after commit: %v", err)
+		}
+	})
+}
+
+func TestUserUpdateProfile(t *testing.T) {
+	each(t, func(t *testing.T, s model.Store) {
+		u := &model.User{Name: "alice", Email: "alice@example.org"}
+		if err := s.Users().Create(u); err != nil {
+			t.Fatal(err)
+		}
+		stale, err := s.Users().Get(u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 读取之后发生的修改密码、注销与锁定不被资料更新覆盖
+		if err := s.Users().UpdatePassword(u.ID, "hash"); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Users().IncrementTokenVersion(u.ID); err != nil {
+			t.Fatal(err)
+		}
+		until := time.Now().Add(time.Hour).Truncate(time.Second)
+		if err := s.Users().UpdateLoginState(u.ID, 2, &until); err != nil {
+			t.Fatal(err)
+		}
+		stale.FullName = "Alice"
+		stale.Email = "a@example.org"
+		stale.Disabled = true
+		if err := s.Users().UpdateProfile(stale); err != nil {
+			t.Fatal(err)
+		}
+		got, err := s.Users().Get(u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.FullName != "Alice" || got.Email != "a@example.org" || !got.Disabled {
+			t.Fatalf("profile not updated: %+v", got)
+		}
+		if got.Password != "hash" || got.TokenVersion != 1 || got.FailedLogins != 2 || got.LockedUntil == nil {
+			t.Fatalf("login state overwritten: %+v", got)
+		}
+		if err := s.Users().UpdateProfile(&model.User{Model: gorm.Model{ID: u.ID + 100}, Name: "x", Email: "x@example.org"}); !errors.Is(err, model.ErrNotFound) {
+			t.Fatalf("UpdateProfile(unknown): %v", err)
+		}
+	})
+}
+
+// TestCreateBuild 并发登记的构建在应用环境内编号连续且不重复, 重复的编号违反唯一索引
+func TestCreateBuild(t *testing.T) {
+	each(t, func(t *testing.T, s model.Store) {
+		const n = 10
+		var wg sync.WaitGroup
+		errs := make(chan error, n)
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- model.CreateBuild(s, &model.BuildInfo{ProjectEnvItemID: 1})
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := model.CreateBuild(s, &model.BuildInfo{ProjectEnvItemID: 2}); err != nil {
+			t.Fatal(err)
+		}
+		builds, err := s.Builds().Find(&model.BuildInfo{ProjectEnvItemID: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		numbers := map[uint]bool{}
+		for _, b := range builds {
+			numbers[b.BuildID] = true
+		}
+		if len(builds) != n || len(numbers) != n || !numbers[1] || !numbers[n] {
+			t.Fatalf("build numbers = %v", numbers)
+		}
+		if max, err := s.Builds().MaxBuildID(2); err != nil || max != 1 {
+			t.Fatalf("MaxBuildID(2) = %d, %v", max, err)
+		}
+
+		err = s.Builds().Create(&model.BuildInfo{ProjectEnvItemID: 1, BuildID: 3})
+		if !errors.Is(err, model.ErrDuplicated) {
+			t.Fatalf("Create duplicate: %v", err)
+		}
+		if err := s.Builds().Create(&model.BuildInfo{ProjectEnvItemID: 3, BuildID: 3}); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,389 @@
+/*
+ * Copyright 2022. The CICD-Tools Authors
+ * This program is free software: you can redistribute it and/or
+ * modify it under the terms of the GNU General Public License as
+ * published by the Free Software Foundation, either version 3 of
+ * the License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package printer 将实体列表以表格、JSON、YAML、CSV 或 Go 模板格式输出, 支持选择列与排序
+package printer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 输出格式, Go 模板通过 go-template=<模板> 或 go-template-file=<文件> 指定
+const (
+	FormatTable        = "table"
+	FormatJSON         = "json"
+	FormatYAML         = "yaml"
+	FormatCSV          = "csv"
+	FormatTemplate     = "go-template"
+	FormatTemplateFile = "go-template-file"
+)
+
+// TimeLayout 表格与 CSV 中时间的格式
+const TimeLayout = "2006-01-02 15:04:05"
+
+// Table 待输出的列表, Columns 为大写的列名, JSON、YAML 与模板中以小写列名为键;
+// 单元格保留原始类型, 排序与 JSON、YAML 输出按类型处理
+type Table struct {
+	Columns []string
+	Rows    [][]interface{}
+}
+
+func NewTable(columns ...string) *Table {
+	return &Table{Columns: columns}
+}
+
+func (t *Table) AddRow(values ...interface{}) {
+	t.Rows = append(t.Rows, values)
+}
+
+// Options 输出选项, Columns 为空时输出全部列, SortBy 以 - 开头时倒序
+type Options struct {
+	Format    string
+	Columns   []string
+	SortBy    string
+	NoHeaders bool
+}
+
+// Parse 校验输出格式并解析 Go 模板
+func (o Options) Parse() (*Printer, error) {
+	p := &Printer{options: o}
+	format, value := o.Format, ""
+	if i := strings.Index(format, "="); i >= 0 {
+		format, value = format[:i], format[i+1:]
+	}
+	switch format {
+	case "", FormatTable, FormatJSON, FormatYAML, FormatCSV:
+		if value != "" {
+			return nil, fmt.Errorf("输出格式%s不需要参数", format)
+		}
+	case FormatTemplate, FormatTemplateFile:
+		if value == "" {
+			return nil, fmt.Errorf("输出格式%s需指定模板, 如%s={{.name}}", format, format)
+		}
+		if format == FormatTemplateFile {
+			content, err := ioutil.ReadFile(value)
+			if err != nil {
+				return nil, fmt.Errorf("读取模板文件%s失败\n%w", value, err)
+			}
+			value = string(content)
+		}
+		tmpl, err := template.New("output").Option("missingkey=error").Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("解析输出模板失败\n%w", err)
+		}
+		p.template = tmpl
+		format = FormatTemplate
+	default:
+		return nil, fmt.Errorf("不支持的输出格式%s, 可选table、json、yaml、csv、go-template=...和go-template-file=...", format)
+	}
+	if format == "" {
+		format = FormatTable
+	}
+	p.format = format
+	return p, nil
+}
+
+// Printer 按 Options 输出 Table
+type Printer struct {
+	options  Options
+	format   string
+	template *template.Template
+}
+
+func (p *Printer) Print(w io.Writer, t *Table) error {
+	columns, err := p.columns(t)
+	if err != nil {
+		return err
+	}
+	rows, err := p.sort(t)
+	if err != nil {
+		return err
+	}
+	switch p.format {
+	case FormatJSON:
+		return printJSON(w, t, columns, rows)
+	case FormatYAML:
+		return printYAML(w, t, columns, rows)
+	case FormatCSV:
+		return p.printCSV(w, t, columns, rows)
+	case FormatTemplate:
+		return p.printTemplate(w, t, columns, rows)
+	}
+	return p.printTable(w, t, columns, rows)
+}
+
+// columns 返回需要输出的列的下标, 列名不区分大小写
+func (p *Printer) columns(t *Table) ([]int, error) {
+	if len(p.options.Columns) == 0 {
+		all := make([]int, len(t.Columns))
+		for i := range all {
+			all[i] = i
+		}
+		return all, nil
+	}
+	selected := make([]int, 0, len(p.options.Columns))
+	for _, name := range p.options.Columns {
+		i := t.index(name)
+		if i < 0 {
+			return nil, fmt.Errorf("列%s不存在, 可选%s", name, strings.Join(t.Keys(), ","))
+		}
+		selected = append(selected, i)
+	}
+	return selected, nil
+}
+
+func (p *Printer) sort(t *Table) ([][]interface{}, error) {
+	rows := t.Rows
+	name := p.options.SortBy
+	if name == "" {
+		return rows, nil
+	}
+	desc := strings.HasPrefix(name, "-")
+	name = strings.TrimPrefix(name, "-")
+	i := t.index(name)
+	if i < 0 {
+		return nil, fmt.Errorf("排序列%s不存在, 可选%s", name, strings.Join(t.Keys(), ","))
+	}
+	rows = append([][]interface{}{}, rows...)
+	sort.SliceStable(rows, func(a, b int) bool {
+		if desc {
+			return less(rows[b][i], rows[a][i])
+		}
+		return less(rows[a][i], rows[b][i])
+	})
+	return rows, nil
+}
+
+func (t *Table) index(name string) int {
+	for i, value := range t.Columns {
+		if strings.EqualFold(value, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Keys 返回小写列名, 即 JSON、YAML、CSV 与模板中使用的键
+func (t *Table) Keys() []string {
+	keys := make([]string, 0, len(t.Columns))
+	for _, value := range t.Columns {
+		keys = append(keys, strings.ToLower(value))
+	}
+	return keys
+}
+
+func (p *Printer) printTable(w io.Writer, t *Table, columns []int, rows [][]interface{}) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	if !p.options.NoHeaders {
+		fmt.Fprintln(tw, strings.Join(pick(t.Columns, columns), "\t"))
+	}
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(texts(row, columns), "\t"))
+	}
+	return tw.Flush()
+}
+
+func (p *Printer) printCSV(w io.Writer, t *Table, columns []int, rows [][]interface{}) error {
+	cw := csv.NewWriter(w)
+	if !p.options.NoHeaders {
+		if err := cw.Write(pick(t.Keys(), columns)); err != nil {
+			return err
+		}
+	}
+	for _, row := range rows {
+		if err := cw.Write(texts(row, columns)); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// printTemplate 对每一行执行一次模板, 模板不以换行结尾时自动换行
+func (p *Printer) printTemplate(w io.Writer, t *Table, columns []int, rows [][]interface{}) error {
+	keys := t.Keys()
+	newline := !strings.HasSuffix(p.template.Root.String(), "\n")
+	for _, row := range rows {
+		data := make(map[string]interface{}, len(columns))
+		for _, i := range columns {
+			data[keys[i]] = row[i]
+		}
+		if err := p.template.Execute(w, data); err != nil {
+			return fmt.Errorf("执行输出模板失败\n%w", err)
+		}
+		if newline {
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// printJSON 按列的顺序输出对象数组
+func printJSON(w io.Writer, t *Table, columns []int, rows [][]interface{}) error {
+	keys := t.Keys()
+	var b strings.Builder
+	b.WriteString("[")
+	for n, row := range rows {
+		if n > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n  {")
+		for m, i := range columns {
+			if m > 0 {
+				b.WriteString(",")
+			}
+			key, _ := json.Marshal(keys[i])
+			value, err := json.Marshal(row[i])
+			if err != nil {
+				return fmt.Errorf("列%s无法转换为JSON\n%w", keys[i], err)
+			}
+			fmt.Fprintf(&b, "\n    %s: %s", key, value)
+		}
+		b.WriteString("\n  }")
+	}
+	if len(rows) > 0 {
+		b.WriteString("\n")
+	}
+	b.WriteString("]\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// printYAML 按列的顺序输出对象数组
+func printYAML(w io.Writer, t *Table, columns []int, rows [][]interface{}) error {
+	keys := t.Keys()
+	list := &yaml.Node{Kind: yaml.SequenceNode}
+	for _, row := range rows {
+		item := &yaml.Node{Kind: yaml.MappingNode}
+		for _, i := range columns {
+			value := new(yaml.Node)
+			if err := value.Encode(row[i]); err != nil {
+				return fmt.Errorf("列%s无法转换为YAML\n%w", keys[i], err)
+			}
+			item.Content = append(item.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: keys[i]}, value)
+		}
+		list.Content = append(list.Content, item)
+	}
+	e := yaml.NewEncoder(w)
+	e.SetIndent(2)
+	if err := e.Encode(list); err != nil {
+		return err
+	}
+	return e.Close()
+}
+
+func pick(values []string, columns []int) []string {
+	picked := make([]string, 0, len(columns))
+	for _, i := range columns {
+		picked = append(picked, values[i])
+	}
+	return picked
+}
+
+func texts(row []interface{}, columns []int) []string {
+	values := make([]string, 0, len(columns))
+	for _, i := range columns {
+		values = append(values, Text(row[i]))
+	}
+	return values
+}
+
+// Text 返回单元格在表格与 CSV 中的文本, 空时间显示为 -
+func Text(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case time.Time:
+		if value.IsZero() {
+			return "-"
+		}
+		return value.Format(TimeLayout)
+	case *time.Time:
+		if value == nil {
+			return "-"
+		}
+		return Text(*value)
+	case []string:
+		return strings.Join(value, ",")
+	case error:
+		return value.Error()
+	}
+	return fmt.Sprint(v)
+}
+
+// less 按单元格的类型比较, 数字按数值, 时间按先后, 空值排在最前, 其它按文本比较
+func less(a interface{}, b interface{}) bool {
+	ta, aok := timeOf(a)
+	tb, bok := timeOf(b)
+	if aok || bok {
+		return !aok || (bok && ta.Before(tb))
+	}
+	na, aok := numberOf(a)
+	nb, bok := numberOf(b)
+	if aok && bok {
+		return na < nb
+	}
+	return Text(a) < Text(b)
+}
+
+func timeOf(v interface{}) (time.Time, bool) {
+	switch value := v.(type) {
+	case time.Time:
+		return value, !value.IsZero()
+	case *time.Time:
+		if value != nil {
+			return timeOf(*value)
+		}
+	}
+	return time.Time{}, false
+}
+
+func numberOf(v interface{}) (float64, bool) {
+	if v == nil {
+		return 0, false
+	}
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), true
+	case reflect.Bool:
+		if value.Bool() {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}